@@ -8,37 +8,56 @@ import (
 
 	"github.com/nyaruka/ezconf"
 	"github.com/nyaruka/gocommon/uuids"
-	"github.com/nyaruka/logrus_sentry"
 	"github.com/nyaruka/mailroom"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/logs"
 
 	_ "github.com/nyaruka/mailroom/core/handlers"
 	_ "github.com/nyaruka/mailroom/core/hooks"
 	_ "github.com/nyaruka/mailroom/core/tasks/analytics"
 	_ "github.com/nyaruka/mailroom/core/tasks/campaigns"
 	_ "github.com/nyaruka/mailroom/core/tasks/contacts"
+	_ "github.com/nyaruka/mailroom/core/tasks/counts"
+	_ "github.com/nyaruka/mailroom/core/tasks/delayed"
 	_ "github.com/nyaruka/mailroom/core/tasks/expirations"
+	_ "github.com/nyaruka/mailroom/core/tasks/fhir"
+	_ "github.com/nyaruka/mailroom/core/tasks/flows"
 	_ "github.com/nyaruka/mailroom/core/tasks/handler"
 	_ "github.com/nyaruka/mailroom/core/tasks/incidents"
 	_ "github.com/nyaruka/mailroom/core/tasks/interrupts"
 	_ "github.com/nyaruka/mailroom/core/tasks/ivr"
 	_ "github.com/nyaruka/mailroom/core/tasks/msgs"
+	_ "github.com/nyaruka/mailroom/core/tasks/orgs"
+	_ "github.com/nyaruka/mailroom/core/tasks/resthooks"
+	_ "github.com/nyaruka/mailroom/core/tasks/retention"
 	_ "github.com/nyaruka/mailroom/core/tasks/schedules"
 	_ "github.com/nyaruka/mailroom/core/tasks/starts"
+	_ "github.com/nyaruka/mailroom/core/tasks/templates"
 	_ "github.com/nyaruka/mailroom/core/tasks/timeouts"
+	_ "github.com/nyaruka/mailroom/services/airtime/reloadly"
 	_ "github.com/nyaruka/mailroom/services/ivr/twiml"
 	_ "github.com/nyaruka/mailroom/services/ivr/vonage"
+	_ "github.com/nyaruka/mailroom/services/lookup/twilio"
+	_ "github.com/nyaruka/mailroom/services/lookup/vonage"
+	_ "github.com/nyaruka/mailroom/services/templates/rcs"
+	_ "github.com/nyaruka/mailroom/services/templates/whatsapp"
 	_ "github.com/nyaruka/mailroom/services/tickets/intern"
 	_ "github.com/nyaruka/mailroom/services/tickets/mailgun"
 	_ "github.com/nyaruka/mailroom/services/tickets/zendesk"
+	_ "github.com/nyaruka/mailroom/web/admin"
+	_ "github.com/nyaruka/mailroom/web/campaign"
 	_ "github.com/nyaruka/mailroom/web/contact"
 	_ "github.com/nyaruka/mailroom/web/docs"
+	_ "github.com/nyaruka/mailroom/web/email"
 	_ "github.com/nyaruka/mailroom/web/expression"
 	_ "github.com/nyaruka/mailroom/web/flow"
+	_ "github.com/nyaruka/mailroom/web/group"
 	_ "github.com/nyaruka/mailroom/web/ivr"
+	_ "github.com/nyaruka/mailroom/web/link"
 	_ "github.com/nyaruka/mailroom/web/msg"
 	_ "github.com/nyaruka/mailroom/web/org"
 	_ "github.com/nyaruka/mailroom/web/po"
+	_ "github.com/nyaruka/mailroom/web/resthook"
 	_ "github.com/nyaruka/mailroom/web/simulation"
 	_ "github.com/nyaruka/mailroom/web/surveyor"
 	_ "github.com/nyaruka/mailroom/web/ticket"
@@ -75,17 +94,12 @@ func main() {
 
 	logrus.SetLevel(level)
 	logrus.SetOutput(os.Stdout)
-	logrus.SetFormatter(&logrus.TextFormatter{})
+	logs.SetFormat(config.LogFormat)
 	logrus.WithField("version", version).WithField("released", date).Info("starting mailroom")
 
 	// if we have a DSN entry, try to initialize it
 	if config.SentryDSN != "" {
-		hook, err := logrus_sentry.NewSentryHook(config.SentryDSN, []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel})
-		hook.Timeout = 0
-		hook.StacktraceConfiguration.Enable = true
-		hook.StacktraceConfiguration.Skip = 4
-		hook.StacktraceConfiguration.Context = 5
-		hook.StacktraceConfiguration.IncludeErrorBreadcrumb = true
+		hook, err := logs.NewSentryHook(config.SentryDSN)
 		if err != nil {
 			logrus.Fatalf("invalid sentry DSN: '%s': %s", config.SentryDSN, err)
 		}
@@ -56,7 +56,7 @@ func Engine(c *runtime.Config) flows.Engine {
 		httpClient, httpRetries, httpAccess := HTTP(c)
 
 		eng = engine.NewBuilder().
-			WithWebhookServiceFactory(webhooks.NewServiceFactory(httpClient, httpRetries, httpAccess, webhookHeaders, c.WebhooksMaxBodyBytes)).
+			WithWebhookServiceFactory(deferringWebhookServiceFactory(signingWebhookServiceFactory(webhooks.NewServiceFactory(httpClient, httpRetries, httpAccess, webhookHeaders, c.WebhooksMaxBodyBytes)))).
 			WithClassificationServiceFactory(classificationFactory(c)).
 			WithEmailServiceFactory(emailFactory(c)).
 			WithTicketServiceFactory(ticketFactory(c)).
@@ -80,7 +80,7 @@ func Simulator(c *runtime.Config) flows.Engine {
 		httpClient, _, httpAccess := HTTP(c) // don't do retries in simulator
 
 		simulator = engine.NewBuilder().
-			WithWebhookServiceFactory(webhooks.NewServiceFactory(httpClient, nil, httpAccess, webhookHeaders, c.WebhooksMaxBodyBytes)).
+			WithWebhookServiceFactory(signingWebhookServiceFactory(webhooks.NewServiceFactory(httpClient, nil, httpAccess, webhookHeaders, c.WebhooksMaxBodyBytes))).
 			WithClassificationServiceFactory(classificationFactory(c)). // simulated sessions do real classification
 			WithEmailServiceFactory(simulatorEmailServiceFactory).      // but faked emails
 			WithTicketServiceFactory(simulatorTicketServiceFactory).    // and faked tickets
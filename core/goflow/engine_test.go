@@ -2,6 +2,7 @@ package goflow_test
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/nyaruka/gocommon/httpx"
@@ -39,6 +40,32 @@ func TestEngineWebhook(t *testing.T) {
 	assert.Equal(t, "OK", string(call.ResponseBody))
 }
 
+func TestEngineWebhookSigning(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"webhook_signing": {"secrets": ["0123456789abcdef"]}}' WHERE id = $1`, testdata.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	svc, err := goflow.Engine(rt.Config).Services().Webhook(oa.SessionAssets())
+	assert.NoError(t, err)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://rapidpro.io": {httpx.NewMockResponse(200, nil, []byte("OK"))},
+	}))
+
+	request, err := http.NewRequest("POST", "http://rapidpro.io", strings.NewReader(`{"foo":"bar"}`))
+	require.NoError(t, err)
+
+	call, err := svc.Call(request)
+	assert.NoError(t, err)
+	assert.Contains(t, string(call.RequestTrace), "X-Mailroom-Signature: t=")
+}
+
 func TestSimulatorAirtime(t *testing.T) {
 	_, rt, _, _ := testsuite.Get()
 
@@ -0,0 +1,74 @@
+package goflow
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/excellent"
+	"github.com/nyaruka/goflow/flows"
+)
+
+// TypeInvalidExpression is our type for an expression which can't be parsed
+const TypeInvalidExpression string = "invalid_expression"
+
+// InvalidExpression is an issue for an expression in a template which can't be parsed and so will always error
+type InvalidExpression struct {
+	Type_        string           `json:"type"`
+	NodeUUID_    flows.NodeUUID   `json:"node_uuid"`
+	ActionUUID_  flows.ActionUUID `json:"action_uuid,omitempty"`
+	Language_    envs.Language    `json:"language,omitempty"`
+	Description_ string           `json:"description"`
+	Expression   string           `json:"expression"`
+}
+
+func newInvalidExpression(nodeUUID flows.NodeUUID, actionUUID flows.ActionUUID, language envs.Language, expression string, err error) *InvalidExpression {
+	return &InvalidExpression{
+		Type_:        TypeInvalidExpression,
+		NodeUUID_:    nodeUUID,
+		ActionUUID_:  actionUUID,
+		Language_:    language,
+		Description_: fmt.Sprintf("invalid expression %s: %s", expression, err),
+		Expression:   expression,
+	}
+}
+
+func (i *InvalidExpression) Type() string                 { return i.Type_ }
+func (i *InvalidExpression) NodeUUID() flows.NodeUUID     { return i.NodeUUID_ }
+func (i *InvalidExpression) ActionUUID() flows.ActionUUID { return i.ActionUUID_ }
+func (i *InvalidExpression) Language() envs.Language      { return i.Language_ }
+func (i *InvalidExpression) Description() string          { return i.Description_ }
+
+// CheckFlow returns all issues in the given flow, i.e. those found by the engine's inspection such as missing
+// dependencies, and any expressions which can't be parsed. Issues are ordered by the position of their node.
+func CheckFlow(sa flows.SessionAssets, flow flows.Flow) []flows.Issue {
+	issues := flow.Inspect(sa).Issues
+
+	for _, node := range flow.Nodes() {
+		node.EnumerateTemplates(flow.Localization(), func(a flows.Action, r flows.Router, l envs.Language, t string) {
+			var actionUUID flows.ActionUUID
+			if a != nil {
+				actionUUID = a.UUID()
+			}
+
+			excellent.VisitTemplate(t, flows.RunContextTopLevels, func(tokenType excellent.XTokenType, token string) error {
+				if tokenType == excellent.EXPRESSION {
+					if _, err := excellent.Parse(token, nil); err != nil {
+						issues = append(issues, newInvalidExpression(node.UUID(), actionUUID, l, "@("+token+")", err))
+					}
+				}
+				return nil
+			})
+		})
+	}
+
+	nodeOrder := make(map[flows.NodeUUID]int, len(flow.Nodes()))
+	for i, node := range flow.Nodes() {
+		nodeOrder[node.UUID()] = i
+	}
+	sort.SliceStable(issues, func(i, j int) bool {
+		return nodeOrder[issues[i].NodeUUID()] < nodeOrder[issues[j].NodeUUID()]
+	})
+
+	return issues
+}
@@ -0,0 +1,61 @@
+package goflow_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckFlow(t *testing.T) {
+	_, rt, _, _ := testsuite.Get()
+
+	flow, err := goflow.ReadFlow(rt.Config, []byte(`{
+		"uuid": "502c3ee4-3249-4dee-8e71-c62070667d52",
+		"name": "Test",
+		"spec_version": "13.0.0",
+		"type": "messaging",
+		"language": "eng",
+		"nodes": [
+			{
+				"uuid": "a58be63b-907d-4a1a-856b-0bb5579d7507",
+				"actions": [
+					{"uuid": "2d3a4a2f-e9a1-4b7a-a8a0-f6f4e1bbd1f2", "type": "send_msg", "text": "Hi @contact.name, you owe @(1 * * 2)"}
+				],
+				"exits": [{"uuid": "6a0a4a7c-6a5b-4e8d-8f3b-2c5c9f0c1a83"}]
+			},
+			{
+				"uuid": "8c4a7c3d-6f1f-4d8e-9d6e-0e5b3a2c1d47",
+				"actions": [
+					{"uuid": "e5b8c4f2-1a3d-4b6c-8e7f-9a0b1c2d3e4f", "type": "send_msg", "text": "Bye @(upper(contact.name))"}
+				],
+				"exits": [{"uuid": "1b2c3d4e-5f6a-4b7c-8d9e-0f1a2b3c4d5e"}]
+			}
+		],
+		"localization": {
+			"spa": {
+				"e5b8c4f2-1a3d-4b6c-8e7f-9a0b1c2d3e4f": {"text": ["Adios @(contact.name + + 1)"]}
+			}
+		}
+	}`))
+	require.NoError(t, err)
+
+	issues := goflow.CheckFlow(nil, flow)
+
+	require.Len(t, issues, 2)
+	assert.Equal(t, goflow.TypeInvalidExpression, issues[0].Type())
+	assert.Equal(t, flows.NodeUUID("a58be63b-907d-4a1a-856b-0bb5579d7507"), issues[0].NodeUUID())
+	assert.Equal(t, flows.ActionUUID("2d3a4a2f-e9a1-4b7a-a8a0-f6f4e1bbd1f2"), issues[0].ActionUUID())
+	assert.Equal(t, envs.NilLanguage, issues[0].Language())
+	assert.Equal(t, "invalid expression @(1 * * 2): syntax error at * 2", issues[0].Description())
+
+	// expressions in translations are checked too
+	assert.Equal(t, goflow.TypeInvalidExpression, issues[1].Type())
+	assert.Equal(t, flows.NodeUUID("8c4a7c3d-6f1f-4d8e-9d6e-0e5b3a2c1d47"), issues[1].NodeUUID())
+	assert.Equal(t, envs.Language("spa"), issues[1].Language())
+	assert.Equal(t, "invalid expression @(contact.name + + 1): syntax error at + 1", issues[1].Description())
+}
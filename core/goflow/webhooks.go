@@ -0,0 +1,105 @@
+package goflow
+
+import (
+	"net/http"
+	"net/http/httputil"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/engine"
+	"github.com/pkg/errors"
+)
+
+// an assets source which can sign the webhooks called by sessions using it, i.e. an org's assets
+type webhookSigner interface {
+	SignWebhook(*http.Request) error
+}
+
+// wraps a webhook service factory so that webhooks are signed if the session assets source supports it
+func signingWebhookServiceFactory(factory engine.WebhookServiceFactory) engine.WebhookServiceFactory {
+	return func(sa flows.SessionAssets) (flows.WebhookService, error) {
+		svc, err := factory(sa)
+		if err != nil || sa == nil {
+			return svc, err
+		}
+
+		if signer, ok := sa.Source().(webhookSigner); ok {
+			return &signingWebhookService{svc: svc, signer: signer}, nil
+		}
+		return svc, nil
+	}
+}
+
+type signingWebhookService struct {
+	svc    flows.WebhookService
+	signer webhookSigner
+}
+
+func (s *signingWebhookService) Call(request *http.Request) (*flows.WebhookCall, error) {
+	if err := s.signer.SignWebhook(request); err != nil {
+		return nil, errors.Wrap(err, "error signing webhook")
+	}
+	return s.svc.Call(request)
+}
+
+// an assets source which defers some webhook calls to be made later, i.e. an org's assets which defers calls to resthook
+// subscribers to our delivery worker
+type webhookDeferrer interface {
+	DefersResthookCall(*http.Request) bool
+}
+
+// wraps a webhook service factory so that calls which the session assets source defers aren't made, but instead get a
+// 202 Accepted response with no body. That's what flows see as the result of the call so they'll always take the
+// success route, and the real response is only recorded in the log of the delivery once it's made.
+func deferringWebhookServiceFactory(factory engine.WebhookServiceFactory) engine.WebhookServiceFactory {
+	return func(sa flows.SessionAssets) (flows.WebhookService, error) {
+		svc, err := factory(sa)
+		if err != nil || sa == nil {
+			return svc, err
+		}
+
+		if deferrer, ok := sa.Source().(webhookDeferrer); ok {
+			return &deferringWebhookService{svc: svc, deferrer: deferrer}, nil
+		}
+		return svc, nil
+	}
+}
+
+type deferringWebhookService struct {
+	svc      flows.WebhookService
+	deferrer webhookDeferrer
+}
+
+func (s *deferringWebhookService) Call(request *http.Request) (*flows.WebhookCall, error) {
+	if !s.deferrer.DefersResthookCall(request) {
+		return s.svc.Call(request)
+	}
+
+	requestTrace, err := httputil.DumpRequestOut(request, true)
+	if err != nil {
+		return nil, errors.Wrap(err, "error dumping deferred request")
+	}
+
+	now := dates.Now()
+	response := &http.Response{
+		Status:     "202 Accepted",
+		StatusCode: http.StatusAccepted,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Request:    request,
+	}
+
+	return &flows.WebhookCall{
+		Trace: &httpx.Trace{
+			Request:       request,
+			RequestTrace:  requestTrace,
+			Response:      response,
+			ResponseTrace: []byte("HTTP/1.1 202 Accepted\r\n\r\n"),
+			StartTime:     now,
+			EndTime:       now,
+		},
+	}, nil
+}
@@ -39,6 +39,7 @@ func handleAirtimeTransferred(ctx context.Context, rt *runtime.Runtime, tx *sqlx
 		event.ActualAmount,
 		event.CreatedOn(),
 	)
+	transfer.SetSessionID(scene.SessionID())
 
 	logrus.WithFields(logrus.Fields{
 		"contact_uuid":   scene.ContactUUID(),
@@ -52,6 +53,15 @@ func handleAirtimeTransferred(ctx context.Context, rt *runtime.Runtime, tx *sqlx
 
 	// add a log for each HTTP call
 	for _, httpLog := range event.HTTPLogs {
+		if external, found := models.AirtimeExternalTransfers.Take(httpLog); found {
+			transfer.SetExternalID(external.ID)
+
+			// transfers which are still pending get their final status when the provider reports it
+			if external.Pending {
+				transfer.SetStatus(models.AirtimeTransferStatusPending)
+			}
+		}
+
 		transfer.AddLog(models.NewAirtimeTransferredLog(
 			oa.OrgID(),
 			httpLog.URL,
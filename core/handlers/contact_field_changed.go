@@ -20,6 +20,15 @@ func init() {
 // handleContactFieldChanged is called when a contact field changes
 func handleContactFieldChanged(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scene *models.Scene, e flows.Event) error {
 	event := e.(*events.ContactFieldChangedEvent)
+
+	// location paths are only matched by canonical names in flows so reparse any which use aliases
+	if field := oa.SessionAssets().Fields().Get(event.Field.Key); field != nil && scene.Contact() != nil {
+		if value := models.ReparseLocationValue(oa, scene.Contact(), field, event.Value); value != event.Value {
+			scene.Contact().Fields().Set(field, value)
+			event.Value = value
+		}
+	}
+
 	logrus.WithFields(logrus.Fields{
 		"contact_uuid": scene.ContactUUID(),
 		"session_id":   scene.SessionID(),
@@ -30,6 +39,8 @@ func handleContactFieldChanged(ctx context.Context, rt *runtime.Runtime, tx *sql
 	scene.AppendToEventPreCommitHook(hooks.CommitFieldChangesHook, event)
 	scene.AppendToEventPreCommitHook(hooks.UpdateCampaignEventsHook, event)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
+	scene.AppendToEventPostCommitHook(hooks.PublishContactChangedHook, event)
+	scene.AppendToEventPostCommitHook(hooks.PushFHIRPatientsHook, event)
 
 	return nil
 }
@@ -48,6 +48,7 @@ func handleContactGroupsChanged(ctx context.Context, rt *runtime.Runtime, tx *sq
 		scene.AppendToEventPreCommitHook(hooks.CommitGroupChangesHook, hookEvent)
 		scene.AppendToEventPreCommitHook(hooks.UpdateCampaignEventsHook, hookEvent)
 		scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
+		scene.AppendToEventPostCommitHook(hooks.PublishContactChangedHook, event)
 	}
 
 	// add each of our groups
@@ -71,6 +72,7 @@ func handleContactGroupsChanged(ctx context.Context, rt *runtime.Runtime, tx *sq
 		scene.AppendToEventPreCommitHook(hooks.CommitGroupChangesHook, hookEvent)
 		scene.AppendToEventPreCommitHook(hooks.UpdateCampaignEventsHook, hookEvent)
 		scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
+		scene.AppendToEventPostCommitHook(hooks.PublishContactChangedHook, event)
 	}
 
 	return nil
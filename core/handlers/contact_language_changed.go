@@ -28,6 +28,7 @@ func handleContactLanguageChanged(ctx context.Context, rt *runtime.Runtime, tx *
 
 	scene.AppendToEventPreCommitHook(hooks.CommitLanguageChangesHook, event)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
+	scene.AppendToEventPostCommitHook(hooks.PublishContactChangedHook, event)
 
 	return nil
 }
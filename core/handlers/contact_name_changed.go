@@ -28,6 +28,8 @@ func handleContactNameChanged(ctx context.Context, rt *runtime.Runtime, tx *sqlx
 
 	scene.AppendToEventPreCommitHook(hooks.CommitNameChangesHook, event)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
+	scene.AppendToEventPostCommitHook(hooks.PublishContactChangedHook, event)
+	scene.AppendToEventPostCommitHook(hooks.PushFHIRPatientsHook, event)
 
 	return nil
 }
@@ -28,6 +28,7 @@ func handleContactStatusChanged(ctx context.Context, rt *runtime.Runtime, tx *sq
 
 	scene.AppendToEventPreCommitHook(hooks.CommitStatusChangesHook, event)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
+	scene.AppendToEventPostCommitHook(hooks.PublishContactChangedHook, event)
 
 	return nil
 }
@@ -35,6 +35,7 @@ func handleContactURNsChanged(ctx context.Context, rt *runtime.Runtime, tx *sqlx
 
 	scene.AppendToEventPreCommitHook(hooks.CommitURNChangesHook, change)
 	scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
+	scene.AppendToEventPostCommitHook(hooks.PublishContactChangedHook, event)
 
 	return nil
 }
@@ -66,8 +66,8 @@ func TestMsgCreated(t *testing.T) {
 			},
 			SQLAssertions: []handlers.SQLAssertion{
 				{
-					SQL:   "SELECT COUNT(*) FROM msgs_msg WHERE text='Hello World' AND contact_id = $1 AND metadata = $2 AND high_priority = TRUE",
-					Args:  []interface{}{testdata.Cathy.ID, `{"quick_replies":["yes","no"]}`},
+					SQL:   "SELECT COUNT(*) FROM msgs_msg WHERE text = $2 AND contact_id = $1 AND metadata IS NULL AND high_priority = TRUE",
+					Args:  []interface{}{testdata.Cathy.ID, "Hello World\n\n1. yes\n2. no"},
 					Count: 2,
 				},
 				{
@@ -40,5 +40,8 @@ func handleMsgReceived(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa
 	scene.AppendToEventPreCommitHook(hooks.ContactLastSeenHook, event)
 	scene.AppendToEventPreCommitHook(hooks.UpdateCampaignEventsHook, event)
 
+	// and let any live consoles know about it once it's committed
+	scene.AppendToEventPostCommitHook(hooks.PublishOrgEventsHook, models.NewMsgReceivedOrgEvent(scene.ContactID(), &event.Msg, event.CreatedOn()))
+
 	return nil
 }
@@ -42,5 +42,14 @@ func handleResthookCalled(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx,
 	)
 	scene.AppendToEventPreCommitHook(hooks.InsertWebhookEventHook, re)
 
+	// if the org defers resthook calls, the engine didn't call the subscribers so we queue that for once we've committed
+	if oa.Org().ResthooksAsync() {
+		scene.AppendToEventPostCommitHook(hooks.QueueResthookDeliveriesHook, &models.ResthookDelivery{
+			Resthook:  event.Resthook,
+			Payload:   event.Payload,
+			CreatedOn: event.CreatedOn(),
+		})
+	}
+
 	return nil
 }
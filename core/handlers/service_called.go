@@ -9,6 +9,7 @@ import (
 	"github.com/nyaruka/mailroom/core/hooks"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/services/classification/openai"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -78,6 +79,13 @@ func handleServiceCalled(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx,
 		}
 
 		scene.AppendToEventPreCommitHook(hooks.InsertHTTPLogsHook, log)
+
+		// LLM calls are metered by the tokens they use
+		if classifier != nil && classifier.Type() == models.ClassifierTypeOpenAI {
+			if tokens := openai.TakeUsage(httpLog); tokens > 0 {
+				scene.AppendToEventPreCommitHook(hooks.InsertLLMUsageHook, &models.LLMUsage{Classifier: classifier, Tokens: tokens})
+			}
+		}
 	}
 
 	return nil
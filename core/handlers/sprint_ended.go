@@ -29,6 +29,13 @@ func handleSprintEnded(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa
 	// then flow history may have changed too in a way that won't be captured by a flow_entered event
 	if currentFlowChanged || !event.Resumed {
 		scene.AppendToEventPostCommitHook(hooks.ContactModifiedHook, event)
+		scene.AppendToEventPostCommitHook(hooks.PublishContactChangedHook, event)
+	}
+
+	started, completed := scene.Session().SprintRunCounts()
+	if started > 0 || completed > 0 {
+		scene.AppendToEventPreCommitHook(hooks.InsertAnalyticsHook, &models.AnalyticsIncrement{Type: models.AnalyticsCountFlowStarts, Count: started})
+		scene.AppendToEventPreCommitHook(hooks.InsertAnalyticsHook, &models.AnalyticsIncrement{Type: models.AnalyticsCountFlowCompletions, Count: completed})
 	}
 
 	return nil
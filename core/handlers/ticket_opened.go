@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 
+	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
 	"github.com/nyaruka/mailroom/core/hooks"
@@ -47,14 +48,27 @@ func handleTicketOpened(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, o
 	}
 
 	var openedInID models.FlowID
+	var openedInUUID assets.FlowUUID
 	if scene.Session() != nil {
 		run, _ := scene.Session().FindStep(e.StepUUID())
-		flowAsset, _ := oa.FlowByUUID(run.FlowReference().UUID)
+		openedInUUID = run.FlowReference().UUID
+		flowAsset, _ := oa.FlowByUUID(openedInUUID)
 		if flowAsset != nil {
 			openedInID = flowAsset.(*models.Flow).ID()
 		}
 	}
 
+	// apply the org's routing rules to tickets which weren't given a specific topic or assignee
+	if routing := oa.Org().TicketRouting(); routing != nil {
+		if rule := routing.Route(scene.Contact(), openedInUUID); rule != nil {
+			var err error
+			topicID, assigneeID, err = routeTicket(rt, oa, rule, topicID, assigneeID)
+			if err != nil {
+				return errors.Wrapf(err, "error routing ticket")
+			}
+		}
+	}
+
 	ticket := models.NewTicket(
 		event.Ticket.UUID,
 		oa.OrgID(),
@@ -84,3 +98,31 @@ func handleTicketOpened(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, o
 
 	return nil
 }
+
+// applies the given routing rule to a new ticket, setting the topic if it only has the default topic, and assigning it
+// to the next agent of the team if it isn't already assigned
+func routeTicket(rt *runtime.Runtime, oa *models.OrgAssets, rule *models.TicketRoutingRule, topicID models.TopicID, assigneeID models.UserID) (models.TopicID, models.UserID, error) {
+	if rule.Topic != "" {
+		current := oa.TopicByID(topicID)
+		if current == nil || current.IsDefault() {
+			if topic := oa.TopicByUUID(rule.Topic); topic != nil {
+				topicID = topic.ID()
+			}
+		}
+	}
+
+	if rule.Team != "" && assigneeID == models.NilUserID {
+		rc := rt.RP.Get()
+		defer rc.Close()
+
+		assignee, err := models.NextTeamAssignee(rc, oa, rule.Team)
+		if err != nil {
+			return topicID, assigneeID, err
+		}
+		if assignee != nil {
+			assigneeID = assignee.ID()
+		}
+	}
+
+	return topicID, assigneeID, nil
+}
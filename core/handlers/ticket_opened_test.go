@@ -2,6 +2,7 @@ package handlers_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/uuids"
@@ -135,3 +136,83 @@ func TestTicketOpened(t *testing.T) {
 
 	handlers.RunTestCases(t, ctx, rt, tcs)
 }
+
+func TestTicketOpenedWithRouting(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	mailgunResponse := func() *httpx.MockResponse {
+		return httpx.NewMockResponse(200, nil, []byte(`{"id": "<20200426161758.1.590432020254B2BF@tickets.rapidpro.io>", "message": "Queued. Thank you."}`))
+	}
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://api.mailgun.net/v3/tickets.rapidpro.io/messages": {mailgunResponse(), mailgunResponse(), mailgunResponse(), mailgunResponse()},
+	}))
+
+	// tickets opened by doctors go to the sales topic and are shared between the agents of the partners team
+	db.MustExec(`UPDATE orgs_usersettings SET team_id = $1 WHERE user_id = $2 OR user_id = $3`, testdata.Partners.ID, testdata.Editor.ID, testdata.Agent.ID)
+	db.MustExec(`UPDATE orgs_org SET config = jsonb_build_object('ticket_routing', jsonb_build_object('rules', jsonb_build_array(jsonb_build_object('group', $2::text, 'topic', $3::text, 'team', $4::text)))) WHERE id = $1`,
+		testdata.Org1.ID, testdata.DoctorsGroup.UUID, testdata.SalesTopic.UUID, testdata.Partners.UUID)
+	models.FlushCache()
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	// both agents are online
+	for _, u := range []*testdata.User{testdata.Editor, testdata.Agent} {
+		err := models.RecordAgentHeartbeat(rc, testdata.Org1.ID, u.ID, models.AgentStatusOnline, 0, time.Now())
+		require.NoError(t, err)
+	}
+
+	openTicket := func(body string, assignee *assets.UserReference) flows.Action {
+		return actions.NewOpenTicket(handlers.NewActionUUID(), assets.NewTicketerReference(testdata.Mailgun.UUID, "Mailgun (IT Support)"), nil, body, assignee, "Ticket")
+	}
+
+	tcs := []handlers.TestCase{
+		{
+			Actions: handlers.ContactActionMap{
+				testdata.Cathy: []flows.Action{openTicket("Help!", nil)},
+				testdata.Bob:   []flows.Action{openTicket("Help me too!", nil)},
+			},
+			SQLAssertions: []handlers.SQLAssertion{
+				{ // cathy is a doctor so her ticket is routed to the sales topic and the first agent of the team
+					SQL:   "select count(*) from tickets_ticket where contact_id = $1 AND topic_id = $2 AND assignee_id = $3",
+					Args:  []interface{}{testdata.Cathy.ID, testdata.SalesTopic.ID, testdata.Editor.ID},
+					Count: 1,
+				},
+				{ // bob isn't so his ticket gets the default topic and is unassigned
+					SQL:   "select count(*) from tickets_ticket where contact_id = $1 AND topic_id = $2 AND assignee_id IS NULL",
+					Args:  []interface{}{testdata.Bob.ID, testdata.DefaultTopic.ID},
+					Count: 1,
+				},
+			},
+		},
+		{
+			Actions: handlers.ContactActionMap{
+				testdata.Cathy: []flows.Action{openTicket("Still need help", nil)},
+			},
+			SQLAssertions: []handlers.SQLAssertion{
+				{ // her next ticket goes to the next agent of the team
+					SQL:   "select count(*) from tickets_ticket where contact_id = $1 AND topic_id = $2 AND assignee_id = $3",
+					Args:  []interface{}{testdata.Cathy.ID, testdata.SalesTopic.ID, testdata.Agent.ID},
+					Count: 1,
+				},
+			},
+		},
+		{
+			Actions: handlers.ContactActionMap{
+				testdata.Cathy: []flows.Action{openTicket("For admin", assets.NewUserReference(testdata.Admin.Email, "Admin"))},
+			},
+			SQLAssertions: []handlers.SQLAssertion{
+				{ // tickets which are explicitly assigned keep their assignee
+					SQL:   "select count(*) from tickets_ticket where contact_id = $1 AND topic_id = $2 AND assignee_id = $3",
+					Args:  []interface{}{testdata.Cathy.ID, testdata.SalesTopic.ID, testdata.Admin.ID},
+					Count: 1,
+				},
+			},
+		},
+	}
+
+	handlers.RunTestCases(t, ctx, rt, tcs)
+}
@@ -30,6 +30,11 @@ func handleWebhookCalled(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx,
 		"extraction":   event.Extraction,
 	}).Debug("webhook called")
 
+	// calls to resthook subscribers which the org defers weren't really made, our delivery worker logs them when they are
+	if event.Resthook != "" && oa.Org().ResthooksAsync() {
+		return nil
+	}
+
 	// if this was a resthook and the status was 410, that means we should remove it
 	if event.Status == flows.CallStatusSubscriberGone {
 		unsub := &models.ResthookUnsubscribe{
@@ -26,6 +26,7 @@ func (h *commitFieldChangesHook) Apply(ctx context.Context, rt *runtime.Runtime,
 	fieldDeletes := make(map[assets.FieldUUID][]interface{})
 	for scene, es := range scenes {
 		updates := make(map[assets.FieldUUID]*flows.Value, len(es))
+		sensitive := make(map[assets.FieldUUID]bool)
 		for _, e := range es {
 			event := e.(*events.ContactFieldChangedEvent)
 			field := oa.FieldByKey(event.Field.Key)
@@ -39,6 +40,7 @@ func (h *commitFieldChangesHook) Apply(ctx context.Context, rt *runtime.Runtime,
 			}
 
 			updates[field.UUID()] = event.Value
+			sensitive[field.UUID()] = oa.Org().IsSensitiveField(field.Key())
 		}
 
 		// trim out deletes, adding to our list of global deletes
@@ -52,8 +54,22 @@ func (h *commitFieldChangesHook) Apply(ctx context.Context, rt *runtime.Runtime,
 			}
 		}
 
+		// sensitive values are encrypted, and if we can't do that then we can't write them at all
+		values := make(map[assets.FieldUUID]interface{}, len(updates))
+		for k, v := range updates {
+			if sensitive[k] {
+				encrypted, err := oa.Org().EncryptFieldValue(v)
+				if err != nil {
+					return errors.Wrapf(err, "error encrypting value of field %s", k)
+				}
+				values[k] = encrypted
+			} else {
+				values[k] = v
+			}
+		}
+
 		// marshal the rest of our updates to JSON
-		fieldJSON, err := json.Marshal(updates)
+		fieldJSON, err := json.Marshal(values)
 		if err != nil {
 			return errors.Wrapf(err, "error marshalling field values")
 		}
@@ -29,5 +29,9 @@ func (h *commitIVRHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx
 		return errors.Wrapf(err, "error writing messages")
 	}
 
+	if err := models.InsertAnalyticsCounts(ctx, tx, oa, models.MsgAnalyticsIncrements(msgs)); err != nil {
+		return errors.Wrapf(err, "error inserting message analytics counts")
+	}
+
 	return nil
 }
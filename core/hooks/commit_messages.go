@@ -29,5 +29,13 @@ func (h *commitMessagesHook) Apply(ctx context.Context, rt *runtime.Runtime, tx
 		return errors.Wrapf(err, "error writing messages")
 	}
 
+	if err := models.InsertAnalyticsCounts(ctx, tx, oa, models.MsgAnalyticsIncrements(msgs)); err != nil {
+		return errors.Wrapf(err, "error inserting message analytics counts")
+	}
+
+	if err := models.RecordConversations(ctx, tx, oa, models.ConversationMsgsFor(msgs)); err != nil {
+		return errors.Wrapf(err, "error recording message conversations")
+	}
+
 	return nil
 }
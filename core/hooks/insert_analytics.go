@@ -0,0 +1,32 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// InsertAnalyticsHook is our hook for updating the org's daily analytics rollups
+var InsertAnalyticsHook models.EventCommitHook = &insertAnalyticsHook{}
+
+type insertAnalyticsHook struct{}
+
+// Apply adds all the analytics increments of the passed in scenes
+func (h *insertAnalyticsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
+	increments := make([]*models.AnalyticsIncrement, 0, len(scenes))
+	for _, is := range scenes {
+		for _, i := range is {
+			increments = append(increments, i.(*models.AnalyticsIncrement))
+		}
+	}
+
+	if err := models.InsertAnalyticsCounts(ctx, tx, oa, increments); err != nil {
+		return errors.Wrapf(err, "error inserting analytics counts")
+	}
+
+	return nil
+}
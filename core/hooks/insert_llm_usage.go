@@ -0,0 +1,33 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// InsertLLMUsageHook is our hook for metering the tokens used by LLM classifiers
+var InsertLLMUsageHook models.EventCommitHook = &insertLLMUsageHook{}
+
+type insertLLMUsageHook struct{}
+
+// Apply records the usage of all the LLM classifier calls
+func (h *insertLLMUsageHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
+	usages := make([]*models.LLMUsage, 0, len(scenes))
+	for _, us := range scenes {
+		for _, u := range us {
+			usages = append(usages, u.(*models.LLMUsage))
+		}
+	}
+
+	err := models.InsertLLMUsage(ctx, tx, oa, usages)
+	if err != nil {
+		return errors.Wrapf(err, "error inserting LLM usage")
+	}
+
+	return nil
+}
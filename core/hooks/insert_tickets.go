@@ -19,10 +19,12 @@ type insertTicketsHook struct{}
 func (h *insertTicketsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
 	// gather all our tickets
 	tickets := make([]*models.Ticket, 0, len(scenes))
+	ticketScenes := make(map[*models.Ticket]*models.Scene, len(scenes))
 
-	for _, ts := range scenes {
+	for scene, ts := range scenes {
 		for _, t := range ts {
 			tickets = append(tickets, t.(*models.Ticket))
+			ticketScenes[t.(*models.Ticket)] = scene
 		}
 	}
 
@@ -53,5 +55,10 @@ func (h *insertTicketsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *
 		return errors.Wrapf(err, "error inserting notifications")
 	}
 
+	// consoles are only told about the new tickets once they're committed
+	for ticket, evt := range eventsByTicket {
+		ticketScenes[ticket].AppendToEventPostCommitHook(PublishOrgEventsHook, models.NewTicketOrgEvent(evt))
+	}
+
 	return nil
 }
@@ -0,0 +1,48 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// PublishOrgEventsHook is our hook for publishing events to the org's live event stream
+var PublishOrgEventsHook models.EventCommitHook = &publishOrgEventsHook{}
+
+type publishOrgEventsHook struct{}
+
+// Apply publishes all the org events that were created
+func (h *publishOrgEventsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
+	events := make([]*models.OrgEvent, 0, len(scenes))
+
+	for _, es := range scenes {
+		for _, e := range es {
+			events = append(events, e.(*models.OrgEvent))
+		}
+	}
+
+	models.PublishOrgEvents(ctx, rt, oa.OrgID(), events)
+
+	return nil
+}
+
+// PublishContactChangedHook is our hook for letting the org's live event stream know that contacts have changed
+var PublishContactChangedHook models.EventCommitHook = &publishContactChangedHook{}
+
+type publishContactChangedHook struct{}
+
+// Apply squashes and publishes a single changed event for each contact
+func (h *publishContactChangedHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
+	events := make([]*models.OrgEvent, 0, len(scenes))
+
+	for scene := range scenes {
+		events = append(events, models.NewContactChangedOrgEvent(scene.ContactID()))
+	}
+
+	models.PublishOrgEvents(ctx, rt, oa.OrgID(), events)
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// PushFHIRPatientsHook is our hook for pushing changed contacts to the FHIR patients they're linked to
+var PushFHIRPatientsHook models.EventCommitHook = &pushFHIRPatientsHook{}
+
+type pushFHIRPatientsHook struct{}
+
+// Apply queues a single task to push all the changed contacts
+func (h *pushFHIRPatientsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
+	if oa.Org().FHIRSync() == nil {
+		return nil
+	}
+
+	contactIDs := make([]models.ContactID, 0, len(scenes))
+	for scene := range scenes {
+		contactIDs = append(contactIDs, scene.ContactID())
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	err := queue.AddTask(ctx, rc, queue.BatchQueue, queue.PushFHIRPatients, int(oa.OrgID()), &models.FHIRPush{ContactIDs: contactIDs}, queue.DefaultPriority)
+	return errors.Wrap(err, "error queuing push of FHIR patients")
+}
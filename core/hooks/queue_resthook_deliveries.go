@@ -0,0 +1,36 @@
+package hooks
+
+import (
+	"context"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// QueueResthookDeliveriesHook is our hook for queuing resthook events to be delivered to their subscribers
+var QueueResthookDeliveriesHook models.EventCommitHook = &queueResthookDeliveriesHook{}
+
+type queueResthookDeliveriesHook struct{}
+
+// Apply queues a delivery task for each resthook event
+func (h *queueResthookDeliveriesHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	for _, es := range scenes {
+		for _, e := range es {
+			delivery := e.(*models.ResthookDelivery)
+
+			err := queue.AddTask(ctx, rc, queue.BatchQueue, queue.DeliverResthookEvent, int(oa.OrgID()), delivery, queue.DefaultPriority)
+			if err != nil {
+				return errors.Wrapf(err, "error queuing delivery of resthook event")
+			}
+		}
+	}
+
+	return nil
+}
@@ -19,9 +19,12 @@ type updateCampaignEventsHook struct{}
 
 // Apply will update all the campaigns for the passed in scene, minimizing the number of queries to do so
 func (h *updateCampaignEventsHook) Apply(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx, oa *models.OrgAssets, scenes map[*models.Scene][]interface{}) error {
-	// these are all the events we need to delete unfired fires for
+	// these are all the events we need to delete unfired fires for because they're being rescheduled
 	deletes := make([]*models.FireDelete, 0, 5)
 
+	// these are all the events we need to skip unfired fires for because they no longer apply
+	skips := make([]*models.FireSkip, 0, 5)
+
 	// these are all the new events we need to insert
 	inserts := make([]*models.FireAdd, 0, 5)
 
@@ -59,8 +62,8 @@ func (h *updateCampaignEventsHook) Apply(ctx context.Context, rt *runtime.Runtim
 			}
 		}
 
-		// those events that need deleting
-		deleteEvents := make(map[models.CampaignEventID]bool, len(groupRemoves)+len(fieldChanges))
+		// those events that need deleting, and why if they aren't rescheduled
+		deleteEvents := make(map[models.CampaignEventID]models.FireSkipReason, len(groupRemoves)+len(fieldChanges))
 
 		// those events we need to add
 		addEvents := make(map[*models.CampaignEvent]bool, len(groupAdds)+len(fieldChanges))
@@ -71,7 +74,7 @@ func (h *updateCampaignEventsHook) Apply(ctx context.Context, rt *runtime.Runtim
 				for _, e := range c.Events() {
 					// only delete events that we qualify for or that were changed
 					if e.QualifiesByField(s.Contact()) || fieldChanges[e.RelativeToID()] {
-						deleteEvents[e.ID()] = true
+						deleteEvents[e.ID()] = models.FireSkipLeftGroup
 					}
 				}
 			}
@@ -83,20 +86,14 @@ func (h *updateCampaignEventsHook) Apply(ctx context.Context, rt *runtime.Runtim
 			for _, e := range fieldEvents {
 				// only recalculate the events if this contact qualifies for this event or this group was removed
 				if e.QualifiesByGroup(s.Contact()) || groupRemoves[e.Campaign().GroupID()] {
-					deleteEvents[e.ID()] = true
+					if _, removed := deleteEvents[e.ID()]; !removed {
+						deleteEvents[e.ID()] = models.FireSkipFieldChanged
+					}
 					addEvents[e] = true
 				}
 			}
 		}
 
-		// ok, create all our deletes
-		for e := range deleteEvents {
-			deletes = append(deletes, &models.FireDelete{
-				ContactID: s.ContactID(),
-				EventID:   e,
-			})
-		}
-
 		// add in all the events we qualify for in campaigns we are now part of
 		for g := range groupAdds {
 			for _, c := range oa.CampaignByGroupID(g) {
@@ -107,6 +104,7 @@ func (h *updateCampaignEventsHook) Apply(ctx context.Context, rt *runtime.Runtim
 		}
 
 		// ok, for all the unique events we now calculate our fire date
+		rescheduled := make(map[models.CampaignEventID]bool, len(addEvents))
 		tz := oa.Env().Timezone()
 		now := time.Now()
 		for ce := range addEvents {
@@ -126,6 +124,16 @@ func (h *updateCampaignEventsHook) Apply(ctx context.Context, rt *runtime.Runtim
 				EventID:   ce.ID(),
 				Scheduled: *scheduled,
 			})
+			rescheduled[ce.ID()] = true
+		}
+
+		// fires of rescheduled events can be deleted, others are skipped so we have a record of why they didn't fire
+		for e, reason := range deleteEvents {
+			if rescheduled[e] {
+				deletes = append(deletes, &models.FireDelete{ContactID: s.ContactID(), EventID: e})
+			} else {
+				skips = append(skips, &models.FireSkip{ContactID: s.ContactID(), EventID: e, Reason: reason})
+			}
 		}
 	}
 
@@ -135,6 +143,12 @@ func (h *updateCampaignEventsHook) Apply(ctx context.Context, rt *runtime.Runtim
 		return errors.Wrapf(err, "error deleting unfired event fires")
 	}
 
+	// and skip those which no longer apply
+	err = models.SkipUnfiredEventFires(ctx, tx, skips)
+	if err != nil {
+		return errors.Wrapf(err, "error skipping unfired event fires")
+	}
+
 	// then insert our new ones
 	err = models.AddEventFires(ctx, tx, inserts)
 	if err != nil {
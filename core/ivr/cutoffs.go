@@ -0,0 +1,101 @@
+package ivr
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CutoffCallTask is the task which hangs up a call once it has reached its maximum duration
+type CutoffCallTask struct {
+	CallID models.CallID `json:"call_id" validate:"required"`
+}
+
+// MaxCallDuration returns the maximum duration of calls on the given channel, which can be set on the channel itself or
+// for the whole org, or zero if calls aren't limited
+func MaxCallDuration(oa *models.OrgAssets, channel *models.Channel) time.Duration {
+	if secs, _ := strconv.Atoi(channel.ConfigValue(models.ChannelConfigMaxCallDuration, "0")); secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	return oa.Org().MaxCallDuration()
+}
+
+// ScheduleCutoff schedules a hangup of the given call for when it will have reached its maximum duration, if calls on its
+// channel are limited
+func ScheduleCutoff(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, channel *models.Channel, call *models.Call) error {
+	maxDuration := MaxCallDuration(oa, channel)
+	if maxDuration <= 0 {
+		return nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	task := &CutoffCallTask{CallID: call.ID()}
+
+	return queue.AddDelayedTask(ctx, rc, queue.HandlerQueue, queue.CutoffCall, int(oa.OrgID()), task, queue.HighPriority, maxDuration)
+}
+
+// CutoffCall hangs up the call in the given task if it's still in progress, recording that it was cut off
+func CutoffCall(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, task *CutoffCallTask) error {
+	call, err := models.GetCallByID(ctx, rt.DB, orgID, task.CallID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load call #%d", task.CallID)
+	}
+
+	// call may well have ended by itself already
+	if call.Status() != models.CallStatusWired && call.Status() != models.CallStatusInProgress {
+		return nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load org")
+	}
+
+	channel := oa.ChannelByID(call.ChannelID())
+	if channel == nil {
+		return errors.Errorf("unable to load channel #%d", call.ChannelID())
+	}
+
+	svc, err := GetService(channel)
+	if err != nil {
+		return errors.Wrapf(err, "unable to create IVR service")
+	}
+
+	clog := models.NewChannelLog(models.ChannelLogTypeIVRHangup, channel, svc.RedactValues(channel))
+	clog.SetCall(call)
+	defer clog.End()
+
+	trace, err := svc.HangupCall(call.ExternalID())
+	if trace != nil {
+		clog.HTTP(trace)
+	}
+	if err != nil {
+		clog.Error(err)
+	}
+
+	if err := call.AttachLog(ctx, rt.DB, clog); err != nil {
+		logrus.WithError(err).Error("error attaching ivr channel log")
+	}
+
+	if err := models.InsertChannelLogs(ctx, rt.DB, []*models.ChannelLog{clog}); err != nil {
+		logrus.WithError(err).Error("error inserting channel log")
+	}
+
+	if err != nil {
+		return errors.Wrapf(err, "error hanging up call #%d", call.ID())
+	}
+
+	if err := call.MarkCutoff(ctx, rt.DB, time.Now()); err != nil {
+		return err
+	}
+
+	return models.InterruptSessionsForCalls(ctx, rt.DB, []models.CallID{call.ID()})
+}
@@ -0,0 +1,73 @@
+package ivr
+
+import (
+	"fmt"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/ivr/state"
+	"github.com/pkg/errors"
+)
+
+// Dialing another number is done by some services by putting the original call in a conference and starting a separate
+// call, or leg, to the dialed number which joins that conference. The status callbacks of the leg then tell us how the
+// dial went, and once the leg has ended, the original call is resumed with a dial resume. The legs are tracked in the call
+// state store so that this works regardless of which provider is being used.
+
+// DialLeg is a tracked leg of a dial
+type DialLeg struct {
+	CallID    string           // the external ID of the call which is waiting on this leg
+	ResumeURL string           // the URL to resume that call with, includes the dial status and duration once ended
+	Status    flows.DialStatus // the last status of this leg
+	Ended     bool             // whether this leg has ended
+}
+
+// TrackDialLeg starts tracking the dial leg with the given id, which the call with the given id is waiting on. The
+// resume URL is what the call should be resumed with once the leg has ended.
+func TrackDialLeg(rc redis.Conn, legID, callID, resumeURL string) error {
+	return state.SetDialLeg(rc, legID, &state.DialLeg{CallID: callID, ResumeURL: resumeURL})
+}
+
+// UpdateDialLeg updates the dial leg with the given id with a status from its provider. Statuses that say how the dial
+// went are recorded and once the leg has ended, the resume URL of the returned leg will include the last recorded
+// status and the given duration. Returns nil if the leg isn't being tracked.
+func UpdateDialLeg(rc redis.Conn, legID string, status flows.DialStatus, ended bool, duration int) (*DialLeg, error) {
+	tracked, err := state.GetDialLeg(rc, legID)
+	if err != nil || tracked == nil {
+		return nil, err
+	}
+
+	leg := &DialLeg{CallID: tracked.CallID, ResumeURL: tracked.ResumeURL, Status: status}
+
+	if status != "" {
+		if err := state.SetDialStatus(rc, leg.CallID, status); err != nil {
+			return nil, err
+		}
+	}
+
+	if !ended {
+		return leg, nil
+	}
+
+	if status == "" {
+		leg.Status, err = state.GetDialStatus(rc, leg.CallID)
+		if err != nil {
+			return nil, err
+		}
+		if leg.Status == "" {
+			return nil, errors.Errorf("unable to find dial status for call %s", leg.CallID)
+		}
+	}
+
+	leg.Ended = true
+	leg.ResumeURL += fmt.Sprintf("&dial_status=%s&dial_duration=%d", leg.Status, duration)
+
+	if err := state.DeleteDialLeg(rc, legID); err != nil {
+		return nil, err
+	}
+	if err := state.DeleteDialStatus(rc, leg.CallID); err != nil {
+		return nil, err
+	}
+
+	return leg, nil
+}
@@ -0,0 +1,57 @@
+package ivr_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialLegs(t *testing.T) {
+	_, rt, _, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	// statuses for legs we aren't tracking are ignored
+	leg, err := ivr.UpdateDialLeg(rc, "leg1", flows.DialStatusBusy, true, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, leg)
+
+	err = ivr.TrackDialLeg(rc, "leg1", "call1", "https://mr.io/resume?session=1&wait_type=dial")
+	require.NoError(t, err)
+
+	// an intermediate status is recorded
+	leg, err = ivr.UpdateDialLeg(rc, "leg1", flows.DialStatusAnswered, false, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, &ivr.DialLeg{CallID: "call1", ResumeURL: "https://mr.io/resume?session=1&wait_type=dial", Status: flows.DialStatusAnswered}, leg)
+
+	// and used when the leg ends without a status of its own
+	leg, err = ivr.UpdateDialLeg(rc, "leg1", "", true, 23)
+	assert.NoError(t, err)
+	assert.Equal(t, &ivr.DialLeg{CallID: "call1", ResumeURL: "https://mr.io/resume?session=1&wait_type=dial&dial_status=answered&dial_duration=23", Status: flows.DialStatusAnswered, Ended: true}, leg)
+
+	// leg is no longer tracked
+	leg, err = ivr.UpdateDialLeg(rc, "leg1", "", true, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, leg)
+
+	// a leg which ends with a status
+	err = ivr.TrackDialLeg(rc, "leg2", "call2", "https://mr.io/resume?session=2&wait_type=dial")
+	require.NoError(t, err)
+
+	leg, err = ivr.UpdateDialLeg(rc, "leg2", flows.DialStatusNoAnswer, true, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://mr.io/resume?session=2&wait_type=dial&dial_status=no_answer&dial_duration=0", leg.ResumeURL)
+
+	// a leg which ends without us ever having a status for it
+	err = ivr.TrackDialLeg(rc, "leg3", "call3", "https://mr.io/resume?session=3&wait_type=dial")
+	require.NoError(t, err)
+
+	_, err = ivr.UpdateDialLeg(rc, "leg3", "", true, 0)
+	assert.EqualError(t, err, "unable to find dial status for call call3")
+}
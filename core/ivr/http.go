@@ -0,0 +1,101 @@
+package ivr
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/pkg/errors"
+)
+
+// channel config keys for customizing the requests made to a channel's provider, e.g. for deployments which can only
+// reach the internet through a proxy or which use private provider endpoints
+const (
+	configHTTPProxy     = "http_proxy"      // URL of the proxy to make requests through
+	configHTTPHeaders   = "http_headers"    // object of extra headers to add to every request
+	configTLSClientCert = "tls_client_cert" // PEM encoded certificate to authenticate with
+	configTLSClientKey  = "tls_client_key"  // PEM encoded private key of that certificate
+)
+
+// clients are cached by channel so that connections are reused, and replaced if the channel's config changes
+var channelClients = struct {
+	sync.Mutex
+	clients map[models.ChannelID]*channelClient
+}{clients: make(map[models.ChannelID]*channelClient)}
+
+type channelClient struct {
+	configKey string
+	client    *http.Client
+}
+
+// HTTPClientForChannel returns the HTTP client to use for requests to the provider of the given channel, which is the
+// default client unless the channel configures a proxy, headers or a client certificate
+func HTTPClientForChannel(channel *models.Channel) (*http.Client, error) {
+	proxy := channel.ConfigValue(configHTTPProxy, "")
+	cert := channel.ConfigValue(configTLSClientCert, "")
+	key := channel.ConfigValue(configTLSClientKey, "")
+	headers, _ := channel.Config()[configHTTPHeaders].(map[string]interface{})
+
+	if proxy == "" && cert == "" && len(headers) == 0 {
+		return http.DefaultClient, nil
+	}
+
+	configKey := fmt.Sprintf("%s|%v|%s|%s", proxy, headers, cert, key)
+
+	channelClients.Lock()
+	defer channelClients.Unlock()
+
+	if cached := channelClients.clients[channel.ID()]; cached != nil && cached.configKey == configKey {
+		return cached.client, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy URL for channel %s", channel.UUID())
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if cert != "" {
+		certificate, err := tls.X509KeyPair([]byte(cert), []byte(key))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid TLS client certificate for channel %s", channel.UUID())
+		}
+		transport.TLSClientConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	}
+
+	var roundTripper http.RoundTripper = transport
+
+	if len(headers) > 0 {
+		h := make(map[string]string, len(headers))
+		for k, v := range headers {
+			h[k] = fmt.Sprint(v)
+		}
+		roundTripper = &headersTransport{headers: h, base: transport}
+	}
+
+	client := &http.Client{Transport: roundTripper}
+	channelClients.clients[channel.ID()] = &channelClient{configKey: configKey, client: client}
+
+	return client, nil
+}
+
+// adds headers to every request before passing it on
+type headersTransport struct {
+	headers map[string]string
+	base    http.RoundTripper
+}
+
+func (t *headersTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	for k, v := range t.headers {
+		r.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(r)
+}
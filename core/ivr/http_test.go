@@ -0,0 +1,71 @@
+package ivr_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPClientForChannel(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	var received *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	loadChannel := func() *models.Channel {
+		oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+		require.NoError(t, err)
+		return oa.ChannelByID(testdata.TwilioChannel.ID)
+	}
+
+	// channel without any customization uses the default client
+	client, err := ivr.HTTPClientForChannel(loadChannel())
+	assert.NoError(t, err)
+	assert.Equal(t, http.DefaultClient, client)
+
+	// channel with custom headers gets a client which adds them
+	db.MustExec(`UPDATE channels_channel SET config = '{"http_headers": {"X-Tenant": "acme"}}' WHERE id = $1`, testdata.TwilioChannel.ID)
+
+	client, err = ivr.HTTPClientForChannel(loadChannel())
+	assert.NoError(t, err)
+	assert.NotEqual(t, http.DefaultClient, client)
+
+	_, err = client.Get(server.URL + "/calls")
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", received.Header.Get("X-Tenant"))
+
+	// which is reused until the config changes
+	client2, err := ivr.HTTPClientForChannel(loadChannel())
+	assert.NoError(t, err)
+	assert.Same(t, client, client2)
+
+	// channel with a proxy sends requests through it
+	db.MustExec(`UPDATE channels_channel SET config = jsonb_build_object('http_proxy', $2::text) WHERE id = $1`, testdata.TwilioChannel.ID, server.URL)
+
+	client, err = ivr.HTTPClientForChannel(loadChannel())
+	assert.NoError(t, err)
+	assert.NotSame(t, client, client2)
+
+	_, err = client.Get("http://provider.example.com/calls")
+	assert.NoError(t, err)
+	assert.Equal(t, "provider.example.com", received.Host)
+
+	// invalid certificates are errors
+	db.MustExec(`UPDATE channels_channel SET config = '{"tls_client_cert": "xxx", "tls_client_key": "yyy"}' WHERE id = $1`, testdata.TwilioChannel.ID)
+
+	_, err = ivr.HTTPClientForChannel(loadChannel())
+	assert.EqualError(t, err, "invalid TLS client certificate for channel 74729f45-7f29-4868-9dc4-90e491e3c7d8: tls: failed to find any PEM data in certificate input")
+}
@@ -1,8 +1,10 @@
 package ivr
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
@@ -14,20 +16,20 @@ import (
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
-	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/resumes"
 	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/ivr/state"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/runner"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/logs"
 	"github.com/nyaruka/null"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 type CallID string
@@ -58,15 +60,34 @@ func GetService(channel *models.Channel) (Service, error) {
 		return nil, errors.Errorf("no IVR service for channel type: %s", channel.Type())
 	}
 
-	return constructor(http.DefaultClient, channel)
+	httpClient, err := HTTPClientForChannel(channel)
+	if err != nil {
+		return nil, err
+	}
+
+	return constructor(httpClient, channel)
+}
+
+// Capabilities describes which features of IVR calls a service supports, so that flows which use unsupported features
+// can degrade gracefully rather than failing
+type Capabilities struct {
+	Dial             bool // can connect the call to another number
+	Record           bool // can record audio from the caller
+	MachineDetection bool // can detect answering machines picking up outgoing calls
 }
 
 // Service defines the interface IVR services must satisfy
 type Service interface {
+	Capabilities() Capabilities
+
 	RequestCall(number urns.URN, handleURL string, statusURL string, machineDetection bool) (CallID, *httpx.Trace, error)
 
 	HangupCall(externalID string) (*httpx.Trace, error)
 
+	// GetCallStatus fetches the status of the call with the passed in external ID from the provider, and if it's an
+	// error the reason, and if available, the call duration
+	GetCallStatus(externalID string) (models.CallStatus, models.CallError, int, *httpx.Trace, error)
+
 	WriteSessionResponse(ctx context.Context, rt *runtime.Runtime, channel *models.Channel, call *models.Call, session *models.Session, number urns.URN, resumeURL string, req *http.Request, w http.ResponseWriter) error
 	WriteRejectResponse(w http.ResponseWriter) error
 	WriteErrorResponse(w http.ResponseWriter, err error) error
@@ -96,6 +117,14 @@ type Service interface {
 	RedactValues(*models.Channel) []string
 }
 
+// StatusURL returns the URL which the provider of the given channel should send call status updates to
+func StatusURL(rt *runtime.Runtime, channel *models.Channel) string {
+	// the domain that will be used for callbacks, can be specific for channels due to white labeling
+	domain := channel.ConfigValue(models.ChannelConfigCallbackDomain, rt.Config.Domain)
+
+	return fmt.Sprintf("https://%s/mr/ivr/c/%s/status", domain, channel.UUID())
+}
+
 // HangupCall hangs up the passed in call also taking care of updating the status of our call in the process
 func HangupCall(ctx context.Context, rt *runtime.Runtime, call *models.Call) (*models.ChannelLog, error) {
 	// no matter what mark our call as failed
@@ -133,14 +162,77 @@ func HangupCall(ctx context.Context, rt *runtime.Runtime, call *models.Call) (*m
 	}
 
 	if err := call.AttachLog(ctx, rt.DB, clog); err != nil {
-		logrus.WithError(err).Error("error attaching ivr channel log")
+		logs.From(ctx).WithError(err).Error("error attaching ivr channel log")
 	}
 
 	return clog, err
 }
 
+// RepairCall checks the status of the passed in stuck call with its provider and updates our call to match, returning
+// whether the call has ended according to the provider
+func RepairCall(ctx context.Context, rt *runtime.Runtime, call *models.Call) (*models.ChannelLog, bool, error) {
+	oa, err := models.GetOrgAssets(ctx, rt, call.OrgID())
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to load org")
+	}
+
+	// if the channel is no longer active, there's no way to check the call so fail it
+	channel := oa.ChannelByID(call.ChannelID())
+	if channel == nil {
+		return nil, true, call.MarkFailed(ctx, rt.DB, time.Now())
+	}
+
+	svc, err := GetService(channel)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "unable to create IVR service")
+	}
+
+	clog := models.NewChannelLog(models.ChannelLogTypeIVRStatus, channel, svc.RedactValues(channel))
+	clog.SetCall(call)
+	defer clog.End()
+
+	status, errorReason, duration, trace, err := svc.GetCallStatus(call.ExternalID())
+	if trace != nil {
+		clog.HTTP(trace)
+	}
+	if err != nil {
+		clog.Error(err)
+	}
+
+	if err := call.AttachLog(ctx, rt.DB, clog); err != nil {
+		logs.From(ctx).WithError(err).Error("error attaching ivr channel log")
+	}
+
+	if err != nil {
+		return clog, false, errors.Wrapf(err, "error fetching call status")
+	}
+
+	switch status {
+	case models.CallStatusWired, models.CallStatusInProgress:
+		// call really is still ongoing
+		if status != call.Status() {
+			err = call.UpdateStatus(ctx, rt.DB, status, 0, time.Now())
+		}
+		return clog, false, err
+
+	case models.CallStatusCompleted:
+		err = call.UpdateStatus(ctx, rt.DB, status, duration, time.Now())
+
+	case models.CallStatusErrored:
+		// a call we've lost track of isn't retried so this fails it permanently
+		err = call.MarkErrored(ctx, rt.DB, time.Now(), nil, errorReason)
+
+	default:
+		err = call.MarkFailed(ctx, rt.DB, time.Now())
+	}
+
+	return clog, true, err
+}
+
 // RequestCall creates a new ChannelSession for the passed in flow start and contact, returning the created session
-func RequestCall(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, start *models.FlowStartBatch, contact *models.Contact) (*models.Call, error) {
+func RequestCall(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, start *models.FlowStartBatch, contact *models.Contact, delay time.Duration) (*models.Call, error) {
+	ctx = logs.With(ctx, "contact_id", contact.ID())
+
 	// find a tel URL for the contact
 	telURN := urns.NilURN
 	for _, u := range contact.URNs() {
@@ -195,22 +287,104 @@ func RequestCall(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 		return nil, errors.Wrapf(err, "error creating call")
 	}
 
+	// if the start is paced and this call isn't due yet, hold it as throttled until it is
+	if delay > 0 {
+		if err := conn.MarkThrottledUntil(ctx, rt.DB, time.Now().Add(delay)); err != nil {
+			return nil, errors.Wrapf(err, "error marking paced call as throttled")
+		}
+		return conn, nil
+	}
+
+	// if channel checks numbers before dialing, don't request calls to unreachable numbers
+	if channel.ConfigValue(models.ChannelConfigPreDialCheck, "") == "true" {
+		clog, reachable, err := preDialCheck(ctx, rt, oa, channel, telURN, conn)
+		if clog != nil {
+			if err := models.InsertChannelLogs(ctx, rt.DB, []*models.ChannelLog{clog}); err != nil {
+				logs.From(ctx).WithError(err).Error("error inserting channel log")
+			}
+		}
+		if err != nil || !reachable {
+			return conn, err
+		}
+	}
+
 	clog, err := RequestStartForCall(ctx, rt, channel, telURN, conn)
 
 	// log any error inserting our channel log, but continue
 	if clog != nil {
 		if err := models.InsertChannelLogs(ctx, rt.DB, []*models.ChannelLog{clog}); err != nil {
-			logrus.WithError(err).Error("error inserting channel log")
+			logs.From(ctx).WithError(err).Error("error inserting channel log")
 		}
 	}
 
 	return conn, err
 }
 
+// lookups before dialing delay the call so they can't take long
+var preDialHTTPClient = &http.Client{Timeout: time.Second * 10}
+
+// looks up the number of the given call with the org's number lookup provider, and if it's known to be unreachable, fails
+// the call without dialing. Lookup errors are logged but don't prevent the call.
+func preDialCheck(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, channel *models.Channel, telURN urns.URN, call *models.Call) (*models.ChannelLog, bool, error) {
+	svc, err := oa.Org().NumberLookupService(preDialHTTPClient, nil)
+	if err != nil {
+		logs.From(ctx).WithError(err).WithField("org_id", oa.OrgID()).Warn("error creating number lookup service for pre-dial check")
+		return nil, true, nil
+	}
+	if svc == nil {
+		return nil, true, nil
+	}
+
+	clog := models.NewChannelLog(models.ChannelLogTypeIVRStart, channel, svc.RedactValues())
+	clog.SetCall(call)
+	defer clog.End()
+
+	info, trace, err := svc.Lookup(telURN.Path())
+	if trace != nil {
+		clog.HTTP(trace)
+	}
+
+	reachable := true
+
+	if err != nil {
+		clog.Error(errors.Wrap(err, "pre-dial number lookup failed"))
+	} else if info.Unreachable {
+		clog.Error(errors.Errorf("number %s is unreachable", telURN.Path()))
+		reachable = false
+
+		if err := call.MarkErrored(ctx, rt.DB, time.Now(), nil, models.CallErrorUnreachable); err != nil {
+			return clog, false, errors.Wrap(err, "error marking unreachable call as failed")
+		}
+	}
+
+	if err := call.AttachLog(ctx, rt.DB, clog); err != nil {
+		logs.From(ctx).WithError(err).Error("error attaching ivr channel log")
+	}
+
+	return clog, reachable, nil
+}
+
 func RequestStartForCall(ctx context.Context, rt *runtime.Runtime, channel *models.Channel, telURN urns.URN, call *models.Call) (*models.ChannelLog, error) {
+	ctx = logs.With(ctx, "call_id", call.ID())
+
 	// the domain that will be used for callbacks, can be specific for channels due to white labeling
 	domain := channel.ConfigValue(models.ChannelConfigCallbackDomain, rt.Config.Domain)
 
+	// if org has paused outbound, hold this call as throttled so it will be retried once they resume
+	rc := rt.RP.Get()
+	paused, err := models.IsOrgOutboundPaused(rc, call.OrgID())
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+	if paused {
+		logs.From(ctx).WithField("org_id", call.OrgID()).Info("call being held, org outbound paused")
+		if err := call.MarkThrottled(ctx, rt.DB, time.Now()); err != nil {
+			return nil, errors.Wrapf(err, "error marking call as throttled")
+		}
+		return nil, nil
+	}
+
 	// get max concurrent events if any
 	maxCalls := channel.ConfigValue(models.ChannelConfigMaxConcurrentEvents, "")
 	if maxCalls != "" {
@@ -225,7 +399,7 @@ func RequestStartForCall(ctx context.Context, rt *runtime.Runtime, channel *mode
 
 			// we are at max calls, do not move on
 			if count >= maxCalls {
-				logrus.WithField("channel_id", channel.ID()).Info("call being queued, max concurrent reached")
+				logs.From(ctx).WithField("channel_id", channel.ID()).Info("call being queued, max concurrent reached")
 				err := call.MarkThrottled(ctx, rt.DB, time.Now())
 				if err != nil {
 					return nil, errors.Wrapf(err, "error marking call as throttled")
@@ -244,7 +418,7 @@ func RequestStartForCall(ctx context.Context, rt *runtime.Runtime, channel *mode
 	}
 
 	resumeURL := fmt.Sprintf("https://%s/mr/ivr/c/%s/handle?%s", domain, channel.UUID(), form.Encode())
-	statusURL := fmt.Sprintf("https://%s/mr/ivr/c/%s/status", domain, channel.UUID())
+	statusURL := StatusURL(rt, channel)
 
 	// create the right service
 	svc, err := GetService(channel)
@@ -257,7 +431,11 @@ func RequestStartForCall(ctx context.Context, rt *runtime.Runtime, channel *mode
 	defer clog.End()
 
 	// try to request our call start
-	callID, trace, err := svc.RequestCall(telURN, resumeURL, statusURL, channel.MachineDetection())
+	machineDetection := channel.MachineDetection() && svc.Capabilities().MachineDetection
+
+	requestStart := time.Now()
+
+	callID, trace, err := svc.RequestCall(telURN, resumeURL, statusURL, machineDetection)
 	if trace != nil {
 		clog.HTTP(trace)
 	}
@@ -272,12 +450,14 @@ func RequestStartForCall(ctx context.Context, rt *runtime.Runtime, channel *mode
 		return clog, nil
 	}
 
+	recordCallRequested(call.OrgID(), channel, time.Since(requestStart))
+
 	// update our channel session
 	if err := call.UpdateExternalID(ctx, rt.DB, string(callID)); err != nil {
 		return clog, errors.Wrapf(err, "error updating session external id")
 	}
 	if err := call.AttachLog(ctx, rt.DB, clog); err != nil {
-		logrus.WithError(err).Error("error attaching ivr channel log")
+		logs.From(ctx).WithError(err).Error("error attaching ivr channel log")
 	}
 
 	return clog, nil
@@ -287,7 +467,7 @@ func RequestStartForCall(ctx context.Context, rt *runtime.Runtime, channel *mode
 func HandleAsFailure(ctx context.Context, db *sqlx.DB, svc Service, call *models.Call, w http.ResponseWriter, rootErr error) error {
 	err := call.MarkFailed(ctx, db, time.Now())
 	if err != nil {
-		logrus.WithError(err).Error("error marking call as failed")
+		logs.From(ctx).WithError(err).Error("error marking call as failed")
 	}
 	return svc.WriteErrorResponse(w, rootErr)
 }
@@ -334,12 +514,9 @@ func StartIVRFlow(
 		return errors.Wrapf(err, "error loading flow contact")
 	}
 
-	var params *types.XObject
-	if len(start.Extra()) > 0 {
-		params, err = types.ReadXObject(start.Extra())
-		if err != nil {
-			return errors.Wrap(err, "unable to read JSON from flow start extra")
-		}
+	params, err := start.TriggerParams()
+	if err != nil {
+		return err
 	}
 
 	var history *flows.SessionHistory
@@ -373,10 +550,19 @@ func StartIVRFlow(
 		return errors.Wrapf(err, "error updating call status")
 	}
 
-	// we set the call on the session before our event hooks fire so that IVR messages can be created with the right call reference
+	if err := ScheduleCutoff(ctx, rt, oa, channel, call); err != nil {
+		logs.From(ctx).WithError(err).Error("error scheduling call cutoff")
+	}
+
+	// we set the call on the session before our event hooks fire so that IVR messages can be created with the right call
+	// reference, and any start metadata on its runs
 	hook := func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, oa *models.OrgAssets, sessions []*models.Session) error {
 		for _, session := range sessions {
 			session.SetCall(call)
+
+			for _, r := range session.Runs() {
+				r.SetMetadata(start.Metadata())
+			}
 		}
 		return nil
 	}
@@ -432,7 +618,7 @@ func ResumeIVRFlow(
 	if call.Status() == models.CallStatusErrored || call.Status() == models.CallStatusFailed {
 		err = models.ExitSessions(ctx, rt.DB, []models.SessionID{session.ID()}, models.SessionStatusInterrupted)
 		if err != nil {
-			logrus.WithError(err).Error("error interrupting session")
+			logs.From(ctx).WithError(err).Error("error interrupting session")
 		}
 
 		return svc.WriteErrorResponse(w, fmt.Errorf("ending call due to previous status callback"))
@@ -475,9 +661,34 @@ func ResumeIVRFlow(
 		return HandleAsFailure(ctx, rt.DB, svc, call, w, errors.Wrapf(err, "error finding input for request"))
 	}
 
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	// a timeout of a wait without a timeout category is treated as the caller entering nothing
+	if _, isTimeout := ivrResume.(TimeoutResume); isTimeout && session.WaitTimeoutOn() == nil {
+		ivrResume = InputResume{}
+	}
+
 	var resume flows.Resume
 	var svcErr error
 	switch res := ivrResume.(type) {
+	case TimeoutResume:
+		// count consecutive timeouts of this wait so that a flow which reprompts on timeout can't loop forever
+		timeouts, err := countWaitTimeout(rc, rt, oa, session)
+		if err != nil {
+			return errors.Wrapf(err, "error counting wait timeouts")
+		}
+
+		if rt.Config.IVRMaxWaitTimeouts > 0 && timeouts > rt.Config.IVRMaxWaitTimeouts {
+			if err := models.ExitSessions(ctx, rt.DB, []models.SessionID{session.ID()}, models.SessionStatusExpired); err != nil {
+				logs.From(ctx).WithError(err).Error("error expiring session")
+			}
+
+			return svc.WriteEmptyResponse(w, fmt.Sprintf("ending call after %d timeouts", timeouts-1))
+		}
+
+		resume = resumes.NewWaitTimeout(oa.Env(), contact)
+
 	case InputResume:
 		resume, svcErr, err = buildMsgResume(ctx, rt, svc, channel, contact, urn, call, oa, r, res)
 		if resume != nil {
@@ -501,6 +712,13 @@ func ResumeIVRFlow(
 		return svc.WriteErrorResponse(w, fmt.Errorf("no resume found, ending call"))
 	}
 
+	// any response other than a timeout ends a run of timeouts
+	if _, isTimeout := ivrResume.(TimeoutResume); !isTimeout {
+		if err := state.DeleteWaitTimeouts(rc, session.UUID()); err != nil {
+			logs.From(ctx).WithError(err).Error("error clearing wait timeouts")
+		}
+	}
+
 	session, err = runner.ResumeFlow(ctx, rt, oa, session, c, resume, hook)
 	if err != nil {
 		return errors.Wrapf(err, "error resuming ivr flow")
@@ -515,7 +733,7 @@ func ResumeIVRFlow(
 	} else {
 		err = models.ExitSessions(ctx, rt.DB, []models.SessionID{session.ID()}, models.SessionStatusCompleted)
 		if err != nil {
-			logrus.WithError(err).Error("error closing session")
+			logs.From(ctx).WithError(err).Error("error closing session")
 		}
 
 		return svc.WriteErrorResponse(w, fmt.Errorf("call completed"))
@@ -524,6 +742,24 @@ func ResumeIVRFlow(
 	return nil
 }
 
+// records a timeout of the wait the given session is waiting at, returning the number of consecutive times it has timed out
+func countWaitTimeout(rc redis.Conn, rt *runtime.Runtime, oa *models.OrgAssets, session *models.Session) (int, error) {
+	fs, err := session.FlowSession(rt.Config, oa.SessionAssets(), oa.Env())
+	if err != nil {
+		return 0, err
+	}
+
+	var nodeUUID flows.NodeUUID
+	for _, run := range fs.Runs() {
+		if run.Status() == flows.RunStatusWaiting {
+			path := run.Path()
+			nodeUUID = path[len(path)-1].NodeUUID()
+		}
+	}
+
+	return state.IncrWaitTimeouts(rc, session.UUID(), nodeUUID)
+}
+
 func buildDialResume(oa *models.OrgAssets, contact *flows.Contact, resume DialResume) (flows.Resume, error, error) {
 	return resumes.NewDial(oa.Env(), contact, flows.NewDial(resume.Status, resume.Duration)), nil, nil
 }
@@ -547,27 +783,41 @@ func buildMsgResume(
 			time.Sleep(time.Second)
 
 			if resp != nil {
-				logrus.WithField("retry", retry).WithField("status", resp.StatusCode).WithField("url", resume.Attachment.URL()).Info("retrying download of attachment")
+				logs.From(ctx).WithField("retry", retry).WithField("status", resp.StatusCode).WithField("url", resume.Attachment.URL()).Info("retrying download of attachment")
 			} else {
-				logrus.WithError(err).WithField("retry", retry).WithField("url", resume.Attachment.URL()).Info("retrying download of attachment")
+				logs.From(ctx).WithError(err).WithField("retry", retry).WithField("url", resume.Attachment.URL()).Info("retrying download of attachment")
 			}
 		}
 
 		if err != nil {
+			recordDownloadFailure(oa.OrgID(), channel)
 			return nil, errors.Wrapf(err, "error downloading attachment, ending call"), nil
 		}
 
 		if resp == nil {
+			recordDownloadFailure(oa.OrgID(), channel)
 			return nil, errors.Errorf("unable to download attachment, ending call"), nil
 		}
 
+		recording, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to read attachment, ending call"), nil
+		}
+
 		// filename is based on our org id and msg UUID
 		filename := string(msgUUID) + path.Ext(resume.Attachment.URL())
+		contentType := resume.Attachment.ContentType()
 
-		resume.Attachment, err = oa.Org().StoreAttachment(ctx, rt, filename, resume.Attachment.ContentType(), resp.Body)
+		resume.Attachment, err = oa.Org().StoreAttachment(ctx, rt, filename, contentType, io.NopCloser(bytes.NewReader(recording)))
 		if err != nil {
 			return nil, errors.Wrapf(err, "unable to download and store attachment, ending call"), nil
 		}
+
+		// if we have a transcription service and no other input, use the transcript as the input text
+		if transcriber := NewTranscriber(rt.Config); transcriber != nil && resume.Input == "" {
+			resume.Input = transcribeRecording(ctx, transcriber, filename, contentType, recording)
+		}
 	}
 
 	attachments := []utils.Attachment{}
@@ -585,16 +835,44 @@ func buildMsgResume(
 		return nil, nil, errors.Wrapf(err, "error committing new message")
 	}
 
+	// if we're transcoding recordings, do that in the background so we don't hold up the call
+	if resume.Attachment != NilAttachment && rt.Config.IVRTranscodeFormat != "" {
+		if err := queueTranscodeRecording(ctx, rt, oa.OrgID(), msg, resume.Attachment); err != nil {
+			logs.From(ctx).WithError(err).WithField("msg_uuid", msgUUID).Error("error queuing recording for transcoding")
+		}
+	}
+
 	// create our msg resume event
 	return resumes.NewMsg(oa.Env(), contact, msgIn), nil, nil
 }
 
+// transcribes the given recording, failures are logged but otherwise ignored so as not to end the call
+func transcribeRecording(ctx context.Context, transcriber Transcriber, filename, contentType string, recording []byte) string {
+	ctx, cancel := context.WithTimeout(ctx, transcriptionTimeout)
+	defer cancel()
+
+	start := time.Now()
+
+	transcript, err := transcriber.Transcribe(ctx, filename, contentType, recording)
+	if err != nil {
+		logs.From(ctx).WithError(err).WithField("filename", filename).Error("error transcribing recording")
+		return ""
+	}
+
+	logs.From(ctx).WithField("filename", filename).WithField("elapsed", time.Since(start)).Debug("transcribed recording")
+	return transcript
+}
+
 // HandleIVRStatus is called on status callbacks for an IVR call. We let the service decide whether the call has
 // ended for some reason and update the state of the call and session if so
 func HandleIVRStatus(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, svc Service, call *models.Call, r *http.Request, w http.ResponseWriter) error {
 	// read our status and duration from our service
 	status, errorReason, duration := svc.StatusForRequest(r)
 
+	if channel := oa.ChannelByID(call.ChannelID()); channel != nil {
+		recordCallStatus(oa.OrgID(), channel, status)
+	}
+
 	if call.Status() == models.CallStatusErrored || call.Status() == models.CallStatusFailed {
 		return svc.WriteEmptyResponse(w, fmt.Sprintf("status %s ignored, already errored", status))
 	}
@@ -629,10 +907,32 @@ func HandleIVRStatus(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAss
 		call.MarkFailed(ctx, rt.DB, time.Now())
 	} else {
 		if status != call.Status() || duration > 0 {
-			err := call.UpdateStatus(ctx, rt.DB, status, duration, time.Now())
+			previousDuration := call.Duration()
+
+			tx, err := rt.DB.BeginTxx(ctx, nil)
 			if err != nil {
+				return errors.Wrapf(err, "error starting transaction")
+			}
+
+			err = call.UpdateStatus(ctx, tx, status, duration, time.Now())
+			if err != nil {
+				tx.Rollback()
 				return errors.Wrapf(err, "error updating call status")
 			}
+
+			// only count the part of the duration which hasn't already been counted, in the same transaction so that it
+			// can't be counted twice
+			if duration > previousDuration {
+				increment := &models.AnalyticsIncrement{Type: models.AnalyticsCountIVRSeconds, Count: duration - previousDuration}
+				if err := models.InsertAnalyticsCounts(ctx, tx, oa, []*models.AnalyticsIncrement{increment}); err != nil {
+					tx.Rollback()
+					return errors.Wrapf(err, "error inserting call analytics counts")
+				}
+			}
+
+			if err := tx.Commit(); err != nil {
+				return errors.Wrapf(err, "error committing call status")
+			}
 		}
 	}
 
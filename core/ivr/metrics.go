@@ -0,0 +1,159 @@
+package ivr
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/nyaruka/mailroom/core/models"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// upper bounds in seconds of the buckets used by our histograms
+var metricBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var (
+	callsRequested = newMetric(dto.MetricType_COUNTER, "rapidpro_ivr_calls_requested_total", "the number of calls requested from IVR providers", "channel_type")
+	callSetup      = newMetric(dto.MetricType_HISTOGRAM, "rapidpro_ivr_call_setup_seconds", "the time taken by IVR providers to accept call requests", "channel_type")
+	callbacks      = newMetric(dto.MetricType_HISTOGRAM, "rapidpro_ivr_callback_seconds", "the time taken to process callbacks from IVR providers", "channel_type", "callback_type")
+	callStatuses   = newMetric(dto.MetricType_COUNTER, "rapidpro_ivr_call_status_total", "the number of call status updates received from IVR providers", "channel_type", "status")
+	downloadFails  = newMetric(dto.MetricType_COUNTER, "rapidpro_ivr_recording_download_failures_total", "the number of recordings which couldn't be downloaded from IVR providers", "channel_type")
+	signatureFails = newMetric(dto.MetricType_COUNTER, "rapidpro_ivr_signature_failures_total", "the number of IVR callbacks which failed signature validation", "channel_type")
+
+	allMetrics = []*metric{callsRequested, callSetup, callbacks, callStatuses, downloadFails, signatureFails}
+)
+
+// RecordCallbackDuration records the time taken to process a callback of the given type on the given channel
+func RecordCallbackDuration(orgID models.OrgID, channel *models.Channel, logType models.ChannelLogType, elapsed time.Duration) {
+	callbacks.observe(orgID, elapsed.Seconds(), string(channel.Type()), string(logType))
+}
+
+// RecordSignatureFailure records a callback on the given channel which failed signature validation
+func RecordSignatureFailure(orgID models.OrgID, channel *models.Channel) {
+	signatureFails.observe(orgID, 1, string(channel.Type()))
+}
+
+func recordCallRequested(orgID models.OrgID, channel *models.Channel, elapsed time.Duration) {
+	callsRequested.observe(orgID, 1, string(channel.Type()))
+	callSetup.observe(orgID, elapsed.Seconds(), string(channel.Type()))
+}
+
+func recordCallStatus(orgID models.OrgID, channel *models.Channel, status models.CallStatus) {
+	callStatuses.observe(orgID, 1, string(channel.Type()), string(status))
+}
+
+func recordDownloadFailure(orgID models.OrgID, channel *models.Channel) {
+	downloadFails.observe(orgID, 1, string(channel.Type()))
+}
+
+// MetricFamilies returns the IVR metrics recorded by this instance for the given org
+func MetricFamilies(org *models.OrgReference) []*dto.MetricFamily {
+	families := make([]*dto.MetricFamily, 0, len(allMetrics))
+	for _, m := range allMetrics {
+		families = append(families, m.family(org))
+	}
+	return families
+}
+
+// a single set of label values of a metric
+type series struct {
+	labels  []string
+	value   float64  // the total for counters, the sum of observations for histograms
+	count   uint64   // the number of observations for histograms
+	buckets []uint64 // the cumulative number of observations in each bucket for histograms
+}
+
+// a counter or histogram which has a series per org and set of label values
+type metric struct {
+	type_  dto.MetricType
+	name   string
+	help   string
+	labels []string
+
+	mutex  sync.Mutex
+	series map[models.OrgID]map[string]*series
+}
+
+func newMetric(type_ dto.MetricType, name, help string, labels ...string) *metric {
+	return &metric{type_: type_, name: name, help: help, labels: labels, series: make(map[models.OrgID]map[string]*series)}
+}
+
+func (m *metric) observe(orgID models.OrgID, value float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	orgSeries := m.series[orgID]
+	if orgSeries == nil {
+		orgSeries = make(map[string]*series)
+		m.series[orgID] = orgSeries
+	}
+
+	key := strings.Join(labels, "\x00")
+	s := orgSeries[key]
+	if s == nil {
+		s = &series{labels: labels}
+		if m.type_ == dto.MetricType_HISTOGRAM {
+			s.buckets = make([]uint64, len(metricBuckets))
+		}
+		orgSeries[key] = s
+	}
+
+	s.value += value
+
+	if m.type_ == dto.MetricType_HISTOGRAM {
+		s.count++
+		for i, bound := range metricBuckets {
+			if value <= bound {
+				s.buckets[i]++
+			}
+		}
+	}
+}
+
+func (m *metric) family(org *models.OrgReference) *dto.MetricFamily {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	family := &dto.MetricFamily{
+		Name:   proto.String(m.name),
+		Help:   proto.String(m.help),
+		Type:   m.type_.Enum(),
+		Metric: []*dto.Metric{},
+	}
+
+	// sort our series so output is stable
+	orgSeries := m.series[org.ID]
+	keys := make([]string, 0, len(orgSeries))
+	for k := range orgSeries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := orgSeries[k]
+
+		labels := make([]*dto.LabelPair, 0, len(m.labels)+1)
+		for i, name := range m.labels {
+			labels = append(labels, &dto.LabelPair{Name: proto.String(name), Value: proto.String(s.labels[i])})
+		}
+		labels = append(labels, &dto.LabelPair{Name: proto.String("org"), Value: proto.String(org.Name)})
+
+		metric := &dto.Metric{Label: labels}
+
+		if m.type_ == dto.MetricType_HISTOGRAM {
+			buckets := make([]*dto.Bucket, len(metricBuckets))
+			for i, bound := range metricBuckets {
+				buckets[i] = &dto.Bucket{UpperBound: proto.Float64(bound), CumulativeCount: proto.Uint64(s.buckets[i])}
+			}
+			metric.Histogram = &dto.Histogram{SampleCount: proto.Uint64(s.count), SampleSum: proto.Float64(s.value), Bucket: buckets}
+		} else {
+			metric.Counter = &dto.Counter{Value: proto.Float64(s.value)}
+		}
+
+		family.Metric = append(family.Metric, metric)
+	}
+
+	return family
+}
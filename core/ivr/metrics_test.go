@@ -0,0 +1,52 @@
+package ivr_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	channel := oa.ChannelByID(testdata.TwilioChannel.ID)
+	org1 := &models.OrgReference{ID: testdata.Org1.ID, Name: "UNICEF"}
+	org2 := &models.OrgReference{ID: testdata.Org2.ID, Name: "Trileet Inc."}
+
+	ivr.RecordCallbackDuration(testdata.Org1.ID, channel, models.ChannelLogTypeIVRCallback, time.Millisecond*300)
+	ivr.RecordCallbackDuration(testdata.Org1.ID, channel, models.ChannelLogTypeIVRCallback, time.Second*3)
+	ivr.RecordSignatureFailure(testdata.Org1.ID, channel)
+
+	render := func(org *models.OrgReference) string {
+		out := &strings.Builder{}
+		for _, family := range ivr.MetricFamilies(org) {
+			if len(family.Metric) > 0 {
+				_, err := expfmt.MetricFamilyToText(out, family)
+				require.NoError(t, err)
+			}
+		}
+		return out.String()
+	}
+
+	output := render(org1)
+	assert.Contains(t, output, `rapidpro_ivr_signature_failures_total{channel_type="T",org="UNICEF"} 1`)
+	assert.Contains(t, output, `rapidpro_ivr_callback_seconds_bucket{channel_type="T",callback_type="ivr_callback",org="UNICEF",le="0.25"} 0`)
+	assert.Contains(t, output, `rapidpro_ivr_callback_seconds_bucket{channel_type="T",callback_type="ivr_callback",org="UNICEF",le="0.5"} 1`)
+	assert.Contains(t, output, `rapidpro_ivr_callback_seconds_bucket{channel_type="T",callback_type="ivr_callback",org="UNICEF",le="+Inf"} 2`)
+	assert.Contains(t, output, `rapidpro_ivr_callback_seconds_sum{channel_type="T",callback_type="ivr_callback",org="UNICEF"} 3.3`)
+	assert.Contains(t, output, `rapidpro_ivr_callback_seconds_count{channel_type="T",callback_type="ivr_callback",org="UNICEF"} 2`)
+
+	// metrics of other orgs aren't included
+	assert.Equal(t, "", render(org2))
+}
@@ -39,3 +39,11 @@ type DialResume struct {
 func (r DialResume) Type() ResumeType {
 	return DialResumeType
 }
+
+// TimeoutResume is our type for resumes as consequences of the caller not responding to a wait
+type TimeoutResume struct{}
+
+// Type returns the type for TimeoutResume
+func (r TimeoutResume) Type() ResumeType {
+	return TimeoutResumeType
+}
@@ -0,0 +1,126 @@
+package ivr
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ScreeningAction is what a screening hook tells us to do with an incoming call
+type ScreeningAction string
+
+// possible screening actions
+const (
+	ScreeningActionProceed = ScreeningAction("proceed") // handle the call as normal
+	ScreeningActionReject  = ScreeningAction("reject")  // reject the call without starting a flow
+	ScreeningActionRoute   = ScreeningAction("route")   // start the given flow instead of whatever the triggers match
+)
+
+// ScreeningRequest is what we send to an org's screening hook about an incoming call
+//
+//	{
+//	  "channel": {"uuid": "74729f45-7f29-4868-9dc4-90e491e3c7d8", "name": "Twilio"},
+//	  "call_id": "CA1234",
+//	  "urn": "tel:+12065551212",
+//	  "contact": {"uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf", "name": "Cathy"},
+//	  "new_contact": false
+//	}
+type ScreeningRequest struct {
+	Channel    *assets.ChannelReference `json:"channel"`
+	CallID     string                   `json:"call_id"`
+	URN        urns.URN                 `json:"urn"`
+	Contact    *flows.ContactReference  `json:"contact"`
+	NewContact bool                     `json:"new_contact"`
+}
+
+// ScreeningResponse is what an org's screening hook responds with. Any params are added to the trigger of the flow
+// that is started so that flows can make use of what the hook knows about the caller.
+//
+//	{
+//	  "action": "route",
+//	  "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85",
+//	  "params": {"caller_name": "Acme Ltd", "spam_score": "0.2"}
+//	}
+type ScreeningResponse struct {
+	Action   ScreeningAction        `json:"action"    validate:"required,eq=proceed|eq=reject|eq=route"`
+	FlowUUID assets.FlowUUID        `json:"flow_uuid" validate:"omitempty,uuid"`
+	Params   map[string]interface{} `json:"params"`
+}
+
+// the caller is waiting on us so screening can't take long
+var screeningHTTPClient = &http.Client{Timeout: time.Second * 5}
+
+// ScreenCall asks the org's screening hook what to do with the given incoming call. Returns nil if the org doesn't have
+// a hook. If the hook can't be reached or its response is invalid, that's logged and the call proceeds as normal.
+func ScreenCall(ctx context.Context, oa *models.OrgAssets, channel *models.Channel, call *models.Call, contact *flows.Contact, urn urns.URN, isNewContact bool) (*ScreeningResponse, *models.ChannelLog) {
+	url := oa.Org().IVRScreeningURL()
+	if url == "" {
+		return nil, nil
+	}
+
+	clog := models.NewChannelLog(models.ChannelLogTypeIVRIncoming, channel, nil)
+	clog.SetCall(call)
+	defer clog.End()
+
+	body := jsonx.MustMarshal(&ScreeningRequest{
+		Channel:    channel.ChannelReference(),
+		CallID:     call.ExternalID(),
+		URN:        urn,
+		Contact:    contact.Reference(),
+		NewContact: isNewContact,
+	})
+
+	response, trace, err := requestScreening(ctx, oa, url, body)
+	if trace != nil {
+		clog.HTTP(trace)
+	}
+	if err != nil {
+		clog.Error(errors.Wrap(err, "call screening failed"))
+		logrus.WithError(err).WithField("org_id", oa.OrgID()).Warn("error screening incoming call")
+
+		return &ScreeningResponse{Action: ScreeningActionProceed}, clog
+	}
+
+	return response, clog
+}
+
+func requestScreening(ctx context.Context, oa *models.OrgAssets, url string, body []byte) (*ScreeningResponse, *httpx.Trace, error) {
+	req, err := httpx.NewRequest(http.MethodPost, url, bytes.NewReader(body), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if err := oa.SignWebhook(req); err != nil {
+		return nil, nil, err
+	}
+
+	trace, err := httpx.DoTrace(screeningHTTPClient, req, nil, nil, 10000)
+	if err != nil {
+		return nil, trace, err
+	}
+	if trace.Response.StatusCode/100 != 2 {
+		return nil, trace, errors.Errorf("screening hook returned status %d", trace.Response.StatusCode)
+	}
+
+	response := &ScreeningResponse{}
+	if err := utils.UnmarshalAndValidate(trace.ResponseBody, response); err != nil {
+		return nil, trace, errors.Wrap(err, "invalid screening hook response")
+	}
+	if response.Action == ScreeningActionRoute && response.FlowUUID == "" {
+		return nil, trace, errors.New("invalid screening hook response: route action requires a flow")
+	}
+
+	return response, trace, nil
+}
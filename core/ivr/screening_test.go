@@ -0,0 +1,83 @@
+package ivr_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScreenCall(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://screening.example.com/": {
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "proceed", "params": {"caller_name": "Cathy Smith"}}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "reject"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "route", "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"action": "route"}`)),
+			httpx.NewMockResponse(503, nil, []byte(`unavailable`)),
+		},
+	})
+	httpx.SetRequestor(mocks)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	channel := oa.ChannelByID(testdata.TwilioChannel.ID)
+	callID := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy)
+	call, err := models.GetCallByID(ctx, db, testdata.Org1.ID, callID)
+	require.NoError(t, err)
+	_, contact := testdata.Cathy.Load(db, oa)
+	urn := urns.URN("tel:+16055741111")
+
+	// org doesn't screen calls
+	response, clog := ivr.ScreenCall(ctx, oa, channel, call, contact, urn, false)
+	assert.Nil(t, response)
+	assert.Nil(t, clog)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"ivr_screening_url": "https://screening.example.com/"}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	oa, err = models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	response, clog = ivr.ScreenCall(ctx, oa, channel, call, contact, urn, false)
+	assert.Equal(t, &ivr.ScreeningResponse{Action: ivr.ScreeningActionProceed, Params: map[string]interface{}{"caller_name": "Cathy Smith"}}, response)
+	assert.NotNil(t, clog)
+
+	body, err := io.ReadAll(mocks.Requests()[0].Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"channel": {"uuid": "74729f45-7f29-4868-9dc4-90e491e3c7d8", "name": "Twilio"},
+		"call_id": "ext1",
+		"urn": "tel:+16055741111",
+		"contact": {"uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf", "name": "Cathy"},
+		"new_contact": false
+	}`, string(body))
+
+	response, _ = ivr.ScreenCall(ctx, oa, channel, call, contact, urn, false)
+	assert.Equal(t, ivr.ScreeningActionReject, response.Action)
+
+	response, _ = ivr.ScreenCall(ctx, oa, channel, call, contact, urn, false)
+	assert.Equal(t, ivr.ScreeningActionRoute, response.Action)
+	assert.Equal(t, assets.FlowUUID("9de3663f-c5c5-4c92-9f45-ecbc09abcc85"), response.FlowUUID)
+
+	// invalid responses and errors mean the call proceeds as normal
+	response, _ = ivr.ScreenCall(ctx, oa, channel, call, contact, urn, false)
+	assert.Equal(t, ivr.ScreeningActionProceed, response.Action)
+
+	response, _ = ivr.ScreenCall(ctx, oa, channel, call, contact, urn, false)
+	assert.Equal(t, ivr.ScreeningActionProceed, response.Action)
+}
@@ -0,0 +1,173 @@
+// Package state stores the short lived state of IVR calls which has to survive between the separate callbacks of a
+// call, such as the legs of dials and recordings which arrive asynchronously. Values are kept in redis so that they are
+// shared by all mailroom instances, and expire on their own so nothing needs to clean up after calls which are dropped.
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ShortTTL is how long we keep state which is written and read within the span of a few callbacks
+	ShortTTL = 5 * time.Minute
+
+	// LongTTL is how long we keep state which has to last as long as a call might, e.g. the leg of a dial
+	LongTTL = time.Hour
+)
+
+// a kind of state value, identified in redis by its key prefix
+type kind struct {
+	name   string
+	prefix string
+	ttl    time.Duration
+}
+
+var (
+	dialLegs     = &kind{"dial leg", "dial_", LongTTL}
+	dialStatuses = &kind{"dial status", "dial_status_", ShortTTL}
+	recordings   = &kind{"recording", "recording_", ShortTTL}
+	waitTimeouts = &kind{"wait timeouts", "wait_timeouts_", LongTTL}
+)
+
+func (k *kind) key(id string) string {
+	return k.prefix + id
+}
+
+func (k *kind) set(rc redis.Conn, id, value string) error {
+	if _, err := rc.Do("SETEX", k.key(id), int(k.ttl/time.Second), value); err != nil {
+		return errors.Wrapf(err, "error setting %s %s", k.name, id)
+	}
+
+	atomic.AddInt64(&numSets, 1)
+	return nil
+}
+
+// gets the value with the given id, returning empty string if it doesn't exist or has expired
+func (k *kind) get(rc redis.Conn, id string) (string, error) {
+	value, err := redis.String(rc.Do("GET", k.key(id)))
+	if err == redis.ErrNil {
+		atomic.AddInt64(&numMisses, 1)
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "error getting %s %s", k.name, id)
+	}
+
+	atomic.AddInt64(&numHits, 1)
+	return value, nil
+}
+
+func (k *kind) del(rc redis.Conn, id string) error {
+	_, err := rc.Do("DEL", k.key(id))
+	return errors.Wrapf(err, "error deleting %s %s", k.name, id)
+}
+
+// DialLeg is the state of the separate call made to the dialed number by providers which dial using conferences
+type DialLeg struct {
+	CallID    string // the external ID of the call which is waiting on this leg
+	ResumeURL string // the URL to resume that call with once this leg has ended
+}
+
+// SetDialLeg saves the dial leg with the given id
+func SetDialLeg(rc redis.Conn, legID string, leg *DialLeg) error {
+	return dialLegs.set(rc, legID, fmt.Sprintf("%s:%s", leg.CallID, leg.ResumeURL))
+}
+
+// GetDialLeg gets the dial leg with the given id, returning nil if it doesn't exist
+func GetDialLeg(rc redis.Conn, legID string) (*DialLeg, error) {
+	value, err := dialLegs.get(rc, legID)
+	if err != nil || value == "" {
+		return nil, err
+	}
+
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid dial leg %s: %s", legID, value)
+	}
+
+	return &DialLeg{CallID: parts[0], ResumeURL: parts[1]}, nil
+}
+
+// DeleteDialLeg deletes the dial leg with the given id
+func DeleteDialLeg(rc redis.Conn, legID string) error {
+	return dialLegs.del(rc, legID)
+}
+
+// SetDialStatus saves the last status of the dial leg of the call with the given external ID
+func SetDialStatus(rc redis.Conn, callID string, status flows.DialStatus) error {
+	return dialStatuses.set(rc, callID, string(status))
+}
+
+// GetDialStatus gets the last status of the dial leg of the call with the given external ID, returning empty string if
+// there isn't one
+func GetDialStatus(rc redis.Conn, callID string) (flows.DialStatus, error) {
+	value, err := dialStatuses.get(rc, callID)
+	return flows.DialStatus(value), err
+}
+
+// DeleteDialStatus deletes the last status of the dial leg of the call with the given external ID
+func DeleteDialStatus(rc redis.Conn, callID string) error {
+	return dialStatuses.del(rc, callID)
+}
+
+// SetRecordingURL saves the URL of the recording with the given UUID
+func SetRecordingURL(rc redis.Conn, recordingUUID, url string) error {
+	return recordings.set(rc, recordingUUID, url)
+}
+
+// GetRecordingURL gets the URL of the recording with the given UUID, returning empty string if it hasn't arrived yet
+func GetRecordingURL(rc redis.Conn, recordingUUID string) (string, error) {
+	return recordings.get(rc, recordingUUID)
+}
+
+// DeleteRecordingURL deletes the URL of the recording with the given UUID
+func DeleteRecordingURL(rc redis.Conn, recordingUUID string) error {
+	return recordings.del(rc, recordingUUID)
+}
+
+// IncrWaitTimeouts increments the number of consecutive times the wait at the given node in the given session has
+// timed out, returning the new count. The count restarts if the session's last timeout was at a different node.
+func IncrWaitTimeouts(rc redis.Conn, sessionUUID flows.SessionUUID, nodeUUID flows.NodeUUID) (int, error) {
+	value, err := waitTimeouts.get(rc, string(sessionUUID))
+	if err != nil {
+		return 0, err
+	}
+
+	count := 1
+
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) == 2 && parts[0] == string(nodeUUID) {
+		last, _ := strconv.Atoi(parts[1])
+		count = last + 1
+	}
+
+	return count, waitTimeouts.set(rc, string(sessionUUID), fmt.Sprintf("%s:%d", nodeUUID, count))
+}
+
+// DeleteWaitTimeouts deletes the count of consecutive wait timeouts in the given session
+func DeleteWaitTimeouts(rc redis.Conn, sessionUUID flows.SessionUUID) error {
+	return waitTimeouts.del(rc, string(sessionUUID))
+}
+
+// cumulative counts of state operations
+var numSets, numHits, numMisses int64
+
+// Stats are the cumulative counts of state operations since startup
+type Stats struct {
+	Sets   int64
+	Hits   int64
+	Misses int64
+}
+
+// GetStats returns the cumulative counts of state operations since startup
+func GetStats() Stats {
+	return Stats{Sets: atomic.LoadInt64(&numSets), Hits: atomic.LoadInt64(&numHits), Misses: atomic.LoadInt64(&numMisses)}
+}
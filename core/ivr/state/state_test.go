@@ -0,0 +1,84 @@
+package state_test
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/ivr/state"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/redisx/assertredis"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestState(t *testing.T) {
+	_, rt, _, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	before := state.GetStats()
+
+	leg, err := state.GetDialLeg(rc, "leg1")
+	assert.NoError(t, err)
+	assert.Nil(t, leg)
+
+	err = state.SetDialLeg(rc, "leg1", &state.DialLeg{CallID: "call1", ResumeURL: "https://mr.io/resume?session=1"})
+	assert.NoError(t, err)
+
+	leg, err = state.GetDialLeg(rc, "leg1")
+	assert.NoError(t, err)
+	assert.Equal(t, &state.DialLeg{CallID: "call1", ResumeURL: "https://mr.io/resume?session=1"}, leg)
+
+	// values are stored under the keys they've always used and expire
+	assertredis.Get(t, rt.RP, "dial_leg1", "call1:https://mr.io/resume?session=1")
+	ttl, _ := redis.Int(rc.Do("TTL", "dial_leg1"))
+	assert.Equal(t, 3600, ttl)
+
+	assert.NoError(t, state.DeleteDialLeg(rc, "leg1"))
+	leg, err = state.GetDialLeg(rc, "leg1")
+	assert.NoError(t, err)
+	assert.Nil(t, leg)
+
+	status, err := state.GetDialStatus(rc, "call1")
+	assert.NoError(t, err)
+	assert.Equal(t, flows.DialStatus(""), status)
+
+	assert.NoError(t, state.SetDialStatus(rc, "call1", flows.DialStatusBusy))
+
+	status, err = state.GetDialStatus(rc, "call1")
+	assert.NoError(t, err)
+	assert.Equal(t, flows.DialStatusBusy, status)
+
+	assert.NoError(t, state.SetRecordingURL(rc, "0d2c4ebc-2d2e-4d95-8b0a-c7b0c0d8d0e2", "https://vonage.com/recording.mp3"))
+
+	recordingURL, err := state.GetRecordingURL(rc, "0d2c4ebc-2d2e-4d95-8b0a-c7b0c0d8d0e2")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://vonage.com/recording.mp3", recordingURL)
+
+	ttl, _ = redis.Int(rc.Do("TTL", "recording_0d2c4ebc-2d2e-4d95-8b0a-c7b0c0d8d0e2"))
+	assert.Equal(t, 300, ttl)
+
+	// timeouts of the same node are counted, and the count restarts at a different node
+	count, err := state.IncrWaitTimeouts(rc, "6e9e8b2e-5b3c-4f4b-a0b8-2f3c3b5c1d2e", "3bfb3b7e-8c8e-4d4a-9e8f-4ae2fa1e2d4f")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	count, err = state.IncrWaitTimeouts(rc, "6e9e8b2e-5b3c-4f4b-a0b8-2f3c3b5c1d2e", "3bfb3b7e-8c8e-4d4a-9e8f-4ae2fa1e2d4f")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	count, err = state.IncrWaitTimeouts(rc, "6e9e8b2e-5b3c-4f4b-a0b8-2f3c3b5c1d2e", "a1d5d7b2-1c3e-4f5a-8b9c-0d1e2f3a4b5c")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	assert.NoError(t, state.DeleteWaitTimeouts(rc, "6e9e8b2e-5b3c-4f4b-a0b8-2f3c3b5c1d2e"))
+
+	count, err = state.IncrWaitTimeouts(rc, "6e9e8b2e-5b3c-4f4b-a0b8-2f3c3b5c1d2e", "a1d5d7b2-1c3e-4f5a-8b9c-0d1e2f3a4b5c")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	after := state.GetStats()
+	assert.Equal(t, state.Stats{Sets: 7, Hits: 5, Misses: 5}, state.Stats{Sets: after.Sets - before.Sets, Hits: after.Hits - before.Hits, Misses: after.Misses - before.Misses})
+}
@@ -0,0 +1,205 @@
+package ivr
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os/exec"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+// content types of the formats we can transcode recordings to
+var transcodeContentTypes = map[string]string{
+	"mp3": "audio/mpeg",
+	"ogg": "audio/ogg",
+	"wav": "audio/wav",
+}
+
+// ffmpeg output arguments for each format
+var ffmpegFormatArgs = map[string][]string{
+	"mp3": {"-c:a", "libmp3lame", "-f", "mp3"},
+	"ogg": {"-c:a", "libopus", "-f", "ogg"},
+	"wav": {"-c:a", "pcm_s16le", "-f", "wav"},
+}
+
+// Transcoder converts IVR recordings to a format that all channels can play back
+type Transcoder interface {
+	// Format is the file extension of the format we transcode to
+	Format() string
+
+	// ContentType is the content type of the format we transcode to
+	ContentType() string
+
+	// Transcode transcodes the given recording, returning the new content type and body
+	Transcode(ctx context.Context, contentType string, body []byte) (string, []byte, error)
+}
+
+// NewTranscoder creates a transcoder from the given config, returning nil if transcoding is disabled
+func NewTranscoder(cfg *runtime.Config) Transcoder {
+	if cfg.IVRTranscodeFormat == "" {
+		return nil
+	}
+	if cfg.IVRTranscodeURL != "" {
+		return &serviceTranscoder{url: cfg.IVRTranscodeURL, format: cfg.IVRTranscodeFormat, bitrate: cfg.IVRTranscodeBitrate}
+	}
+	return &ffmpegTranscoder{binary: cfg.IVRTranscodeFFmpeg, format: cfg.IVRTranscodeFormat, bitrate: cfg.IVRTranscodeBitrate}
+}
+
+// transcodes by piping recordings through a local ffmpeg process
+type ffmpegTranscoder struct {
+	binary  string
+	format  string
+	bitrate string
+}
+
+func (t *ffmpegTranscoder) Format() string      { return t.format }
+func (t *ffmpegTranscoder) ContentType() string { return transcodeContentTypes[t.format] }
+
+func (t *ffmpegTranscoder) Transcode(ctx context.Context, contentType string, body []byte) (string, []byte, error) {
+	args := []string{"-hide_banner", "-loglevel", "error", "-i", "pipe:0", "-vn"}
+	if t.bitrate != "" && t.format != "wav" {
+		args = append(args, "-b:a", t.bitrate)
+	}
+	args = append(args, ffmpegFormatArgs[t.format]...)
+	args = append(args, "pipe:1")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, t.binary, args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", nil, errors.Wrapf(err, "error running ffmpeg: %s", bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return t.ContentType(), stdout.Bytes(), nil
+}
+
+// transcodes by posting recordings to an external service which responds with the transcoded audio
+type serviceTranscoder struct {
+	url     string
+	format  string
+	bitrate string
+}
+
+func (t *serviceTranscoder) Format() string      { return t.format }
+func (t *serviceTranscoder) ContentType() string { return transcodeContentTypes[t.format] }
+
+func (t *serviceTranscoder) Transcode(ctx context.Context, contentType string, body []byte) (string, []byte, error) {
+	params := url.Values{"format": []string{t.format}}
+	if t.bitrate != "" {
+		params.Set("bitrate", t.bitrate)
+	}
+
+	req, err := httpx.NewRequest(http.MethodPost, fmt.Sprintf("%s?%s", t.url, params.Encode()), bytes.NewReader(body), map[string]string{"Content-Type": contentType})
+	if err != nil {
+		return "", nil, err
+	}
+	req = req.WithContext(ctx)
+
+	// recordings can be large so we don't trace these requests
+	resp, err := httpx.Do(http.DefaultClient, req, nil, nil)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error calling transcoding service")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", nil, errors.Errorf("transcoding service returned status %d", resp.StatusCode)
+	}
+
+	transcoded, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "error reading transcoding service response")
+	}
+
+	// use the content type of the response if the service gave us one
+	respType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if respType == "" || respType == "application/octet-stream" {
+		respType = t.ContentType()
+	}
+
+	return respType, transcoded, nil
+}
+
+// TranscodeRecordingTask is the task which transcodes a recording and adds it to the message as another attachment
+type TranscodeRecordingTask struct {
+	MsgID     flows.MsgID      `json:"msg_id"    validate:"required"`
+	MsgUUID   flows.MsgUUID    `json:"msg_uuid"  validate:"required"`
+	Recording utils.Attachment `json:"recording" validate:"required"`
+}
+
+func queueTranscodeRecording(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, msg *models.Msg, recording utils.Attachment) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	task := &TranscodeRecordingTask{MsgID: msg.ID(), MsgUUID: msg.UUID(), Recording: recording}
+
+	return queue.AddTask(ctx, rc, queue.BatchQueue, queue.TranscodeRecording, int(orgID), task, queue.DefaultPriority)
+}
+
+// TranscodeRecording transcodes the recording on an IVR message and adds the transcoded version as another attachment
+func TranscodeRecording(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, task *TranscodeRecordingTask) error {
+	transcoder := NewTranscoder(rt.Config)
+	if transcoder == nil {
+		return nil
+	}
+
+	// nothing to do if the recording is already in our target format
+	if task.Recording.ContentType() == transcoder.ContentType() {
+		return nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return errors.Wrapf(err, "error loading org assets")
+	}
+
+	req, err := httpx.NewRequest(http.MethodGet, task.Recording.URL(), nil, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	resp, err := httpx.Do(http.DefaultClient, req, nil, nil)
+	if err != nil {
+		return errors.Wrapf(err, "error downloading recording")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("error downloading recording, got status %d", resp.StatusCode)
+	}
+
+	original, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrapf(err, "error reading recording")
+	}
+
+	contentType, transcoded, err := transcoder.Transcode(ctx, task.Recording.ContentType(), original)
+	if err != nil {
+		return errors.Wrapf(err, "error transcoding recording")
+	}
+
+	// original is stored as {msg_uuid}.{ext} so this sits alongside it
+	filename := fmt.Sprintf("%s_transcoded.%s", task.MsgUUID, transcoder.Format())
+
+	attachment, err := oa.Org().StoreAttachment(ctx, rt, filename, contentType, io.NopCloser(bytes.NewReader(transcoded)))
+	if err != nil {
+		return errors.Wrapf(err, "error storing transcoded recording")
+	}
+
+	return models.AddMsgAttachment(ctx, rt.DB, task.MsgID, models.NormalizeAttachment(rt.Config, attachment))
+}
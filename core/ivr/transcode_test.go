@@ -0,0 +1,76 @@
+package ivr_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscoder(t *testing.T) {
+	ctx := context.Background()
+	cfg := runtime.NewDefaultConfig()
+
+	// disabled by default
+	assert.Nil(t, ivr.NewTranscoder(cfg))
+
+	// use a fake ffmpeg which records its arguments and echoes its input back
+	dir := t.TempDir()
+	argsFile := filepath.Join(dir, "args")
+	fakeFFmpeg := filepath.Join(dir, "ffmpeg")
+	require.NoError(t, os.WriteFile(fakeFFmpeg, []byte("#!/bin/sh\necho \"$@\" > "+argsFile+"\ncat\n"), 0755))
+
+	cfg.IVRTranscodeFormat = "mp3"
+	cfg.IVRTranscodeFFmpeg = fakeFFmpeg
+
+	transcoder := ivr.NewTranscoder(cfg)
+	assert.Equal(t, "mp3", transcoder.Format())
+	assert.Equal(t, "audio/mpeg", transcoder.ContentType())
+
+	contentType, body, err := transcoder.Transcode(ctx, "audio/wav", []byte("RIFF..."))
+	assert.NoError(t, err)
+	assert.Equal(t, "audio/mpeg", contentType)
+	assert.Equal(t, []byte("RIFF..."), body)
+
+	args, _ := os.ReadFile(argsFile)
+	assert.Equal(t, "-hide_banner -loglevel error -i pipe:0 -vn -b:a 32k -c:a libmp3lame -f mp3 pipe:1\n", string(args))
+
+	cfg.IVRTranscodeFFmpeg = filepath.Join(dir, "missing")
+	_, _, err = ivr.NewTranscoder(cfg).Transcode(ctx, "audio/wav", []byte("RIFF..."))
+	assert.Error(t, err)
+
+	// now use an external service
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://transcoder.example.com/?bitrate=32k&format=ogg": {
+			httpx.NewMockResponse(200, map[string]string{"Content-Type": "audio/ogg; codecs=opus"}, []byte("OggS...")),
+			httpx.NewMockResponse(500, nil, []byte("boom")),
+		},
+	})
+	httpx.SetRequestor(mocks)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	cfg.IVRTranscodeFormat = "ogg"
+	cfg.IVRTranscodeURL = "https://transcoder.example.com/"
+
+	transcoder = ivr.NewTranscoder(cfg)
+	assert.Equal(t, "audio/ogg", transcoder.ContentType())
+
+	contentType, body, err = transcoder.Transcode(ctx, "audio/mpeg", []byte("ID3..."))
+	assert.NoError(t, err)
+	assert.Equal(t, "audio/ogg", contentType)
+	assert.Equal(t, []byte("OggS..."), body)
+
+	sent, _ := io.ReadAll(mocks.Requests()[0].Body)
+	assert.Equal(t, "ID3...", string(sent))
+	assert.Equal(t, "audio/mpeg", mocks.Requests()[0].Header.Get("Content-Type"))
+
+	_, _, err = transcoder.Transcode(ctx, "audio/mpeg", []byte("ID3..."))
+	assert.EqualError(t, err, "transcoding service returned status 500")
+}
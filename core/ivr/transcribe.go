@@ -0,0 +1,172 @@
+package ivr
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+const (
+	whisperURL      = "https://api.openai.com/v1/audio/transcriptions"
+	whisperModel    = "whisper-1"
+	googleSpeechURL = "https://speech.googleapis.com/v1p1beta1/speech:recognize"
+
+	// the caller is waiting on the line whilst we transcribe, and providers like Twilio give up on our webhook after
+	// 15 seconds, which also has to cover downloading the recording and resuming the flow, so keep this well under that
+	transcriptionTimeout = time.Second * 5
+
+	// recordings of calls are narrowband telephone audio
+	callSampleRate = 8000
+)
+
+// Transcriber converts IVR recordings to text so that flows can branch on what the caller said
+type Transcriber interface {
+	// Transcribe returns the text of the given recording
+	Transcribe(ctx context.Context, filename, contentType string, body []byte) (string, error)
+}
+
+// NewTranscriber creates a transcriber from the given config, returning nil if transcription is disabled
+func NewTranscriber(cfg *runtime.Config) Transcriber {
+	switch cfg.IVRTranscriptionService {
+	case "whisper":
+		return &whisperTranscriber{url: transcriptionURL(cfg, whisperURL), apiKey: cfg.IVRTranscriptionKey, language: cfg.IVRTranscriptionLanguage}
+	case "google":
+		return &googleTranscriber{url: transcriptionURL(cfg, googleSpeechURL), apiKey: cfg.IVRTranscriptionKey, language: cfg.IVRTranscriptionLanguage}
+	}
+	return nil
+}
+
+func transcriptionURL(cfg *runtime.Config, def string) string {
+	if cfg.IVRTranscriptionURL != "" {
+		return cfg.IVRTranscriptionURL
+	}
+	return def
+}
+
+// transcribes using the OpenAI Whisper API
+type whisperTranscriber struct {
+	url      string
+	apiKey   string
+	language string
+}
+
+func (t *whisperTranscriber) Transcribe(ctx context.Context, filename, contentType string, body []byte) (string, error) {
+	b := &bytes.Buffer{}
+	w := multipart.NewWriter(b)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filename))
+	h.Set("Content-Type", contentType)
+	fw, err := w.CreatePart(h)
+	if err != nil {
+		return "", err
+	}
+	fw.Write(body)
+
+	w.WriteField("model", whisperModel)
+	if t.language != "" {
+		// whisper wants ISO-639-1 codes so ignore any region
+		w.WriteField("language", strings.SplitN(t.language, "-", 2)[0])
+	}
+	w.Close()
+
+	headers := map[string]string{"Content-Type": w.FormDataContentType(), "Authorization": "Bearer " + t.apiKey}
+
+	response := &struct {
+		Text string `json:"text"`
+	}{}
+	if err := transcribeRequest(ctx, t.url, headers, b.Bytes(), response); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(response.Text), nil
+}
+
+// transcribes using the Google Cloud Speech-to-Text API
+type googleTranscriber struct {
+	url      string
+	apiKey   string
+	language string
+}
+
+func (t *googleTranscriber) Transcribe(ctx context.Context, filename, contentType string, body []byte) (string, error) {
+	language := t.language
+	if language == "" {
+		language = "en-US"
+	}
+
+	// Google can't always work out the format of the audio itself so tell it
+	payload := map[string]interface{}{
+		"config": map[string]interface{}{"encoding": googleEncoding(contentType), "sampleRateHertz": callSampleRate, "languageCode": language},
+		"audio":  map[string]interface{}{"content": base64.StdEncoding.EncodeToString(body)},
+	}
+
+	response := &struct {
+		Results []struct {
+			Alternatives []struct {
+				Transcript string `json:"transcript"`
+			} `json:"alternatives"`
+		} `json:"results"`
+	}{}
+	if err := transcribeRequest(ctx, t.url+"?key="+t.apiKey, map[string]string{"Content-Type": "application/json"}, jsonx.MustMarshal(payload), response); err != nil {
+		return "", err
+	}
+
+	// results are consecutive portions of the audio so join the best alternative of each
+	parts := make([]string, 0, len(response.Results))
+	for _, r := range response.Results {
+		if len(r.Alternatives) > 0 {
+			parts = append(parts, strings.TrimSpace(r.Alternatives[0].Transcript))
+		}
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// gets the Google encoding of a recording with the given content type. Twilio and Vonage both record calls as MP3 by
+// default, and Vonage doesn't give us a content type for its recordings, so that's what we assume.
+func googleEncoding(contentType string) string {
+	switch contentType {
+	case "audio/wav", "audio/x-wav", "audio/wave":
+		return "LINEAR16"
+	case "audio/ogg":
+		return "OGG_OPUS"
+	default:
+		return "MP3"
+	}
+}
+
+func transcribeRequest(ctx context.Context, url string, headers map[string]string, body []byte, response interface{}) error {
+	req, err := httpx.NewRequest(http.MethodPost, url, bytes.NewReader(body), headers)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	// recordings can be large so we don't trace these requests
+	resp, err := httpx.Do(http.DefaultClient, req, nil, nil)
+	if err != nil {
+		return errors.Wrap(err, "error calling transcription service")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("transcription service returned status %d", resp.StatusCode)
+	}
+
+	if err := jsonx.UnmarshalWithLimit(resp.Body, response, 1024*1024); err != nil {
+		return errors.Wrap(err, "error reading transcription service response")
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package ivr_test
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranscriber(t *testing.T) {
+	ctx := context.Background()
+	cfg := runtime.NewDefaultConfig()
+
+	// disabled by default
+	assert.Nil(t, ivr.NewTranscriber(cfg))
+
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/audio/transcriptions": {
+			httpx.NewMockResponse(200, nil, []byte(`{"text": " I'd like to speak to an agent "}`)),
+			httpx.NewMockResponse(401, nil, []byte(`{"error": {"message": "Incorrect API key"}}`)),
+		},
+		"https://speech.googleapis.com/v1p1beta1/speech:recognize?key=sesame": {
+			httpx.NewMockResponse(200, nil, []byte(`{"results": [{"alternatives": [{"transcript": "yes please", "confidence": 0.9}]}, {"alternatives": [{"transcript": " call me back"}]}]}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{}`)),
+		},
+	})
+	httpx.SetRequestor(mocks)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	cfg.IVRTranscriptionService = "whisper"
+	cfg.IVRTranscriptionKey = "sesame"
+	cfg.IVRTranscriptionLanguage = "en-US"
+
+	transcriber := ivr.NewTranscriber(cfg)
+
+	text, err := transcriber.Transcribe(ctx, "1234.wav", "audio/wav", []byte("RIFF..."))
+	assert.NoError(t, err)
+	assert.Equal(t, "I'd like to speak to an agent", text)
+
+	req := mocks.Requests()[0]
+	assert.Equal(t, "Bearer sesame", req.Header.Get("Authorization"))
+	require.NoError(t, req.ParseMultipartForm(1024))
+	assert.Equal(t, "whisper-1", req.FormValue("model"))
+	assert.Equal(t, "en", req.FormValue("language"))
+	file, header, err := req.FormFile("file")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(file)
+	assert.Equal(t, "1234.wav", header.Filename)
+	assert.Equal(t, "RIFF...", string(body))
+
+	_, err = transcriber.Transcribe(ctx, "1234.wav", "audio/wav", []byte("RIFF..."))
+	assert.EqualError(t, err, "transcription service returned status 401")
+
+	cfg.IVRTranscriptionService = "google"
+	transcriber = ivr.NewTranscriber(cfg)
+
+	text, err = transcriber.Transcribe(ctx, "1234.wav", "audio/wav", []byte("RIFF..."))
+	assert.NoError(t, err)
+	assert.Equal(t, "yes please call me back", text)
+
+	body, _ = io.ReadAll(mocks.Requests()[2].Body)
+	assert.JSONEq(t, `{"audio": {"content": "UklGRi4uLg=="}, "config": {"encoding": "LINEAR16", "sampleRateHertz": 8000, "languageCode": "en-US"}}`, string(body))
+
+	// no results means nothing was said, and recordings without a known type are assumed to be MP3
+	text, err = transcriber.Transcribe(ctx, "1234", "audio", []byte("ID3..."))
+	assert.NoError(t, err)
+	assert.Equal(t, "", text)
+
+	body, _ = io.ReadAll(mocks.Requests()[3].Body)
+	assert.JSONEq(t, `{"audio": {"content": "SUQzLi4u"}, "config": {"encoding": "MP3", "sampleRateHertz": 8000, "languageCode": "en-US"}}`, string(body))
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+const (
+	// how long after their last heartbeat an agent is considered to have gone offline
+	agentPresenceTimeout = time.Minute * 2
+
+	// how long we keep presence and open ticket counts for an org's agents after the last heartbeat from any of them
+	agentPresenceExpiry = time.Hour * 24
+)
+
+// AgentStatus is whether an agent is available to be assigned tickets
+type AgentStatus string
+
+const (
+	AgentStatusOnline  = AgentStatus("online")
+	AgentStatusOffline = AgentStatus("offline")
+)
+
+// AgentAvailability is the presence and current load of an agent
+type AgentAvailability struct {
+	Online      bool
+	OpenTickets int
+}
+
+var agentPresenceKeys = orgkeys.Register("agent_presence:%d")
+
+// sorted set of agents' last heartbeats as epoch seconds
+func agentPresenceKey(orgID OrgID) string {
+	return agentPresenceKeys.Key(int(orgID))
+}
+
+var agentOpenTicketsKeys = orgkeys.Register("agent_open_tickets:%d")
+
+// hash of agents' open ticket counts
+func agentOpenTicketsKey(orgID OrgID) string {
+	return agentOpenTicketsKeys.Key(int(orgID))
+}
+
+// RecordAgentHeartbeat records the status of an agent and their number of open tickets at the given time
+func RecordAgentHeartbeat(rc redis.Conn, orgID OrgID, userID UserID, status AgentStatus, openTickets int, now time.Time) error {
+	presenceKey, openKey := agentPresenceKey(orgID), agentOpenTicketsKey(orgID)
+
+	rc.Send("MULTI")
+	if status == AgentStatusOnline {
+		rc.Send("ZADD", presenceKey, now.Unix(), userID)
+	} else {
+		rc.Send("ZREM", presenceKey, userID)
+	}
+	rc.Send("HSET", openKey, userID, openTickets)
+	rc.Send("EXPIRE", presenceKey, int(agentPresenceExpiry/time.Second))
+	rc.Send("EXPIRE", openKey, int(agentPresenceExpiry/time.Second))
+	_, err := rc.Do("EXEC")
+
+	return errors.Wrapf(err, "error recording heartbeat for user #%d", userID)
+}
+
+// GetAgentAvailability gets the presence and open ticket counts of the given agents at the given time
+func GetAgentAvailability(rc redis.Conn, orgID OrgID, userIDs []UserID, now time.Time) (map[UserID]*AgentAvailability, error) {
+	availability := make(map[UserID]*AgentAvailability, len(userIDs))
+	if len(userIDs) == 0 {
+		return availability, nil
+	}
+
+	presenceKey, openKey := agentPresenceKey(orgID), agentOpenTicketsKey(orgID)
+
+	rc.Send("MULTI")
+	for _, id := range userIDs {
+		rc.Send("ZSCORE", presenceKey, id)
+		rc.Send("HGET", openKey, id)
+	}
+	replies, err := redis.Values(rc.Do("EXEC"))
+	if err != nil {
+		return nil, errors.Wrap(err, "error getting agent availability")
+	}
+
+	onlineSince := now.Add(-agentPresenceTimeout).Unix()
+
+	for i, id := range userIDs {
+		lastSeen, _ := redis.Int64(replies[i*2], nil)
+		openTickets, _ := redis.Int(replies[i*2+1], nil)
+
+		availability[id] = &AgentAvailability{Online: lastSeen >= onlineSince, OpenTickets: openTickets}
+	}
+
+	return availability, nil
+}
+
+// IncrementAgentOpenTickets increments the open ticket count of an agent when they're assigned a ticket, until it's
+// refreshed by their next heartbeat
+func IncrementAgentOpenTickets(rc redis.Conn, orgID OrgID, userID UserID) error {
+	_, err := rc.Do("HINCRBY", agentOpenTicketsKey(orgID), userID, 1)
+	return errors.Wrapf(err, "error incrementing open tickets for user #%d", userID)
+}
+
+const sqlCountAgentOpenTickets = `SELECT COUNT(*) FROM tickets_ticket WHERE org_id = $1 AND assignee_id = $2 AND status = 'O'`
+
+// CountAgentOpenTickets counts the open tickets assigned to the given agent
+func CountAgentOpenTickets(ctx context.Context, db Queryer, orgID OrgID, userID UserID) (int, error) {
+	var count int
+	err := db.GetContext(ctx, &count, sqlCountAgentOpenTickets, orgID, userID)
+	return count, errors.Wrapf(err, "error counting open tickets for user #%d", userID)
+}
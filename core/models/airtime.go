@@ -2,11 +2,14 @@ package models
 
 import (
 	"context"
+	"database/sql"
 	"database/sql/driver"
 	"time"
 
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/utils/httplogs"
 	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
 	"github.com/shopspring/decimal"
 )
 
@@ -25,6 +28,9 @@ const (
 
 	// AirtimeTransferStatusFailed is our status for failed transfers
 	AirtimeTransferStatusFailed AirtimeTransferStatus = "F"
+
+	// AirtimeTransferStatusPending is our status for transfers whose final status the provider will report later
+	AirtimeTransferStatusPending AirtimeTransferStatus = "P"
 )
 
 // AirtimeTransfer is our type for an airtime transfer
@@ -39,6 +45,8 @@ type AirtimeTransfer struct {
 		Currency      null.String           `db:"currency"`
 		DesiredAmount decimal.Decimal       `db:"desired_amount"`
 		ActualAmount  decimal.Decimal       `db:"actual_amount"`
+		ExternalID    null.String           `db:"external_id"`
+		SessionID     null.Int              `db:"session_id"`
 		CreatedOn     time.Time             `db:"created_on"`
 	}
 
@@ -64,13 +72,28 @@ func (t *AirtimeTransfer) ID() AirtimeTransferID {
 	return t.t.ID
 }
 
+// SetStatus sets the status of this transfer
+func (t *AirtimeTransfer) SetStatus(status AirtimeTransferStatus) {
+	t.t.Status = status
+}
+
+// SetExternalID sets the ID the provider gave this transfer, for providers which report its final status later
+func (t *AirtimeTransfer) SetExternalID(id string) {
+	t.t.ExternalID = null.String(id)
+}
+
+// SetSessionID sets the session which made this transfer
+func (t *AirtimeTransfer) SetSessionID(id SessionID) {
+	t.t.SessionID = null.Int(id)
+}
+
 func (t *AirtimeTransfer) AddLog(l *HTTPLog) {
 	t.Logs = append(t.Logs, l)
 }
 
 const sqlInsertAirtimeTransfers = `
-INSERT INTO airtime_airtimetransfer(org_id,  status,  contact_id,  sender,  recipient,  currency,  desired_amount,  actual_amount,  created_on)
-					        VALUES(:org_id, :status, :contact_id, :sender, :recipient, :currency, :desired_amount, :actual_amount, :created_on)
+INSERT INTO airtime_airtimetransfer(org_id,  status,  contact_id,  sender,  recipient,  currency,  desired_amount,  actual_amount,  external_id,  session_id,  created_on)
+					        VALUES(:org_id, :status, :contact_id, :sender, :recipient, :currency, :desired_amount, :actual_amount, :external_id, :session_id, :created_on)
 RETURNING id
 `
 
@@ -88,6 +111,44 @@ func InsertAirtimeTransfers(ctx context.Context, db Queryer, transfers []*Airtim
 	return BulkQuery(ctx, "inserted airtime transfers", db, sqlInsertAirtimeTransfers, ts)
 }
 
+// ExternalAirtimeTransfer is what a provider told us about a transfer when it was made
+type ExternalAirtimeTransfer struct {
+	ID      string
+	Pending bool
+}
+
+// AirtimeExternalTransfers holds what providers told us about transfers by the HTTP log of the request which made each
+// transfer, for providers which report the final status of transfers asynchronously
+var AirtimeExternalTransfers = httplogs.NewStore[ExternalAirtimeTransfer]()
+
+// UpdatedAirtimeTransfer is a transfer whose final status has been reported by its provider
+type UpdatedAirtimeTransfer struct {
+	ID        AirtimeTransferID `db:"id"`
+	ContactID ContactID         `db:"contact_id"`
+	SessionID SessionID         `db:"session_id"`
+	CreatedOn time.Time         `db:"created_on"`
+}
+
+const sqlUpdateAirtimeTransferByExternalID = `
+   UPDATE airtime_airtimetransfer SET status = $3, actual_amount = $4
+    WHERE org_id = $1 AND external_id = $2 AND status = 'P'
+RETURNING id, contact_id, COALESCE(session_id, 0) AS session_id, created_on`
+
+// UpdateAirtimeTransferByExternalID updates the status and actual amount of the pending transfer the provider gave the
+// given ID, for providers which report the final status of transfers asynchronously. It returns nil if there was no such
+// transfer to update, e.g. because its final status has already been reported.
+func UpdateAirtimeTransferByExternalID(ctx context.Context, db Queryer, orgID OrgID, externalID string, status AirtimeTransferStatus, actualAmount decimal.Decimal) (*UpdatedAirtimeTransfer, error) {
+	updated := &UpdatedAirtimeTransfer{}
+	err := db.GetContext(ctx, updated, sqlUpdateAirtimeTransferByExternalID, orgID, externalID, status, actualAmount)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error updating airtime transfer %s", externalID)
+	}
+	return updated, nil
+}
+
 // MarshalJSON marshals into JSON. 0 values will become null
 func (i AirtimeTransferID) MarshalJSON() ([]byte, error) {
 	return null.Int(i).MarshalJSON()
@@ -52,4 +52,41 @@ func TestAirtimeTransfers(t *testing.T) {
 	assert.Nil(t, err)
 
 	assertdb.Query(t, db, `SELECT count(*) from airtime_airtimetransfer WHERE org_id = $1 AND status = $2`, testdata.Org1.ID, models.AirtimeTransferStatusFailed).Returns(1)
+
+	// insert a pending transfer whose final status will be reported later
+	transfer = models.NewAirtimeTransfer(
+		testdata.Org1.ID,
+		models.AirtimeTransferStatusPending,
+		testdata.Bob.ID,
+		urns.NilURN,
+		urns.URN("tel:+250700000003"),
+		"RWF",
+		decimal.RequireFromString(`500`),
+		decimal.Zero,
+		time.Now(),
+	)
+	transfer.SetExternalID("4603")
+	transfer.SetSessionID(models.SessionID(123))
+	err = models.InsertAirtimeTransfers(ctx, db, []*models.AirtimeTransfer{transfer})
+	assert.Nil(t, err)
+
+	updated, err := models.UpdateAirtimeTransferByExternalID(ctx, db, testdata.Org1.ID, "4603", models.AirtimeTransferStatusFailed, decimal.Zero)
+	assert.NoError(t, err)
+	assert.Equal(t, transfer.ID(), updated.ID)
+	assert.Equal(t, testdata.Bob.ID, updated.ContactID)
+	assert.Equal(t, models.SessionID(123), updated.SessionID)
+
+	assertdb.Query(t, db, `SELECT status FROM airtime_airtimetransfer WHERE external_id = '4603'`).Returns("F")
+
+	// once its final status is known it can't be changed by a repeated report
+	updated, err = models.UpdateAirtimeTransferByExternalID(ctx, db, testdata.Org1.ID, "4603", models.AirtimeTransferStatusSuccess, decimal.RequireFromString(`500`))
+	assert.NoError(t, err)
+	assert.Nil(t, updated)
+
+	assertdb.Query(t, db, `SELECT status FROM airtime_airtimetransfer WHERE external_id = '4603'`).Returns("F")
+
+	// transfers of other orgs can't be updated
+	updated, err = models.UpdateAirtimeTransferByExternalID(ctx, db, testdata.Org2.ID, "4603", models.AirtimeTransferStatusSuccess, decimal.Zero)
+	assert.NoError(t, err)
+	assert.Nil(t, updated)
 }
@@ -0,0 +1,293 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/pkg/errors"
+)
+
+// AnalyticsCountType is the type of a count in an org's daily analytics rollups
+type AnalyticsCountType string
+
+const (
+	AnalyticsCountMsgsIn          = AnalyticsCountType("msgs_in")
+	AnalyticsCountMsgsOut         = AnalyticsCountType("msgs_out")
+	AnalyticsCountFlowStarts      = AnalyticsCountType("flow_starts")
+	AnalyticsCountFlowCompletions = AnalyticsCountType("flow_completions")
+	AnalyticsCountIVRSeconds      = AnalyticsCountType("ivr_seconds")
+	AnalyticsCountTicketsOpened   = AnalyticsCountType("tickets_opened")
+	AnalyticsCountTicketsClosed   = AnalyticsCountType("tickets_closed")
+	AnalyticsCountConversations   = AnalyticsCountType("conversations")
+	AnalyticsCountMsgSegments     = AnalyticsCountType("msg_segments")
+	AnalyticsCountMsgCostMicros   = AnalyticsCountType("msg_cost_micros")
+)
+
+// message, segment, cost and conversation counts are also rolled up per channel
+var analyticsChannelCountTypes = map[AnalyticsCountType]bool{
+	AnalyticsCountMsgsIn:        true,
+	AnalyticsCountMsgsOut:       true,
+	AnalyticsCountMsgSegments:   true,
+	AnalyticsCountMsgCostMicros: true,
+	AnalyticsCountConversations: true,
+}
+
+// AnalyticsIncrement is an increment to one of an org's analytics counts
+type AnalyticsIncrement struct {
+	Type      AnalyticsCountType
+	ChannelID ChannelID
+	Count     int
+}
+
+// MsgAnalyticsIncrements returns the analytics increments for the given new messages, which for outgoing messages
+// includes their segments and cost so that billing doesn't need to look at message text
+func MsgAnalyticsIncrements(msgs []*Msg) []*AnalyticsIncrement {
+	increments := make([]*AnalyticsIncrement, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Direction() != DirectionOut {
+			increments = append(increments, &AnalyticsIncrement{Type: AnalyticsCountMsgsIn, ChannelID: m.ChannelID(), Count: 1})
+			continue
+		}
+
+		increments = append(increments,
+			&AnalyticsIncrement{Type: AnalyticsCountMsgsOut, ChannelID: m.ChannelID(), Count: 1},
+			&AnalyticsIncrement{Type: AnalyticsCountMsgSegments, ChannelID: m.ChannelID(), Count: m.MsgCount()},
+		)
+		if cost := m.Cost(); cost != nil {
+			increments = append(increments, &AnalyticsIncrement{Type: AnalyticsCountMsgCostMicros, ChannelID: m.ChannelID(), Count: costToMicros(*cost)})
+		}
+	}
+	return increments
+}
+
+func scopeChannel(oa *OrgAssets, channelID ChannelID) string {
+	return fmt.Sprintf("o:%d:ch:%d", oa.OrgID(), channelID)
+}
+
+// InsertAnalyticsCounts adds the given increments to the org's analytics rollups for the current day in its timezone
+func InsertAnalyticsCounts(ctx context.Context, tx Queryer, oa *OrgAssets, increments []*AnalyticsIncrement) error {
+	for countType, counts := range analyticsScopeCounts(oa, increments) {
+		if err := insertDailyCounts(ctx, tx, "orgs_analyticsdailycount", string(countType), oa.Org().Timezone(), counts); err != nil {
+			return errors.Wrapf(err, "error inserting %s analytics counts", countType)
+		}
+	}
+	return nil
+}
+
+// totals the given increments by count type and scope
+func analyticsScopeCounts(oa *OrgAssets, increments []*AnalyticsIncrement) map[AnalyticsCountType]map[string]int {
+	countsByType := make(map[AnalyticsCountType]map[string]int)
+
+	for _, inc := range increments {
+		if inc.Count == 0 {
+			continue
+		}
+
+		counts := countsByType[inc.Type]
+		if counts == nil {
+			counts = make(map[string]int, 2)
+			countsByType[inc.Type] = counts
+		}
+
+		counts[scopeOrg(oa)] += inc.Count
+
+		if analyticsChannelCountTypes[inc.Type] && inc.ChannelID != NilChannelID {
+			counts[scopeChannel(oa, inc.ChannelID)] += inc.Count
+		}
+	}
+
+	return countsByType
+}
+
+// AnalyticsDay is the analytics rollup of a single day for an org
+type AnalyticsDay struct {
+	Day      string                                            `json:"day"`
+	Counts   map[AnalyticsCountType]int                        `json:"counts"`
+	Channels map[assets.ChannelUUID]map[AnalyticsCountType]int `json:"channels"`
+}
+
+const sqlSelectAnalyticsCounts = `
+  SELECT day, count_type, scope, SUM(count) AS count
+    FROM orgs_analyticsdailycount
+   WHERE (scope = $1 OR scope LIKE $1 || ':ch:%') AND day >= $2 AND day <= $3
+GROUP BY day, count_type, scope
+ORDER BY day, count_type, scope`
+
+// GetAnalytics gets the analytics rollups of the given org for each day in the given range which has counts
+func GetAnalytics(ctx context.Context, db *sqlx.DB, oa *OrgAssets, since, until dates.Date) ([]*AnalyticsDay, error) {
+	rows, err := db.QueryxContext(ctx, sqlSelectAnalyticsCounts, scopeOrg(oa), since, until)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying analytics counts")
+	}
+	defer rows.Close()
+
+	days := make([]*AnalyticsDay, 0, 31)
+	orgScope := scopeOrg(oa)
+
+	for rows.Next() {
+		count := &dailyCount{}
+		if err := rows.StructScan(count); err != nil {
+			return nil, errors.Wrap(err, "error scanning analytics count")
+		}
+
+		day := count.Day.String()
+		if len(days) == 0 || days[len(days)-1].Day != day {
+			days = append(days, &AnalyticsDay{Day: day, Counts: make(map[AnalyticsCountType]int), Channels: make(map[assets.ChannelUUID]map[AnalyticsCountType]int)})
+		}
+		current := days[len(days)-1]
+		countType := AnalyticsCountType(count.CountType)
+
+		if count.Scope == orgScope {
+			current.Counts[countType] = count.Count
+			continue
+		}
+
+		// ignore counts of channels which have since been deleted
+		channelID, _ := strconv.Atoi(strings.TrimPrefix(count.Scope, orgScope+":ch:"))
+		channel := oa.ChannelByID(ChannelID(channelID))
+		if channel == nil {
+			continue
+		}
+		if current.Channels[channel.UUID()] == nil {
+			current.Channels[channel.UUID()] = make(map[AnalyticsCountType]int, 2)
+		}
+		current.Channels[channel.UUID()][countType] = count.Count
+	}
+
+	return days, errors.Wrap(rows.Err(), "error reading analytics counts")
+}
+
+const sqlSelectAnalyticsMsgCounts = `
+  SELECT direction, channel_id, COUNT(*) AS count, SUM(msg_count) AS segments
+    FROM msgs_msg
+   WHERE org_id = $1 AND created_on >= $2 AND created_on < $3
+GROUP BY direction, channel_id`
+
+const sqlSelectAnalyticsConversationCounts = `
+  SELECT channel_id, COUNT(*) AS count
+    FROM msgs_conversation
+   WHERE org_id = $1 AND started_on >= $2 AND started_on < $3
+GROUP BY channel_id`
+
+const sqlSelectAnalyticsOrgCounts = `
+SELECT
+	(SELECT COUNT(*) FROM flows_flowrun WHERE org_id = $1 AND created_on >= $2 AND created_on < $3) AS flow_starts,
+	(SELECT COUNT(*) FROM flows_flowrun WHERE org_id = $1 AND status = 'C' AND exited_on >= $2 AND exited_on < $3) AS flow_completions,
+	(SELECT COALESCE(SUM(duration), 0) FROM ivr_call WHERE org_id = $1 AND status = 'D' AND ended_on >= $2 AND ended_on < $3) AS ivr_seconds,
+	(SELECT COUNT(*) FROM tickets_ticket WHERE org_id = $1 AND opened_on >= $2 AND opened_on < $3) AS tickets_opened,
+	(SELECT COUNT(*) FROM tickets_ticket WHERE org_id = $1 AND closed_on >= $2 AND closed_on < $3) AS tickets_closed`
+
+const sqlDeleteAnalyticsCounts = `DELETE FROM orgs_analyticsdailycount WHERE (scope = $1 OR scope LIKE $1 || ':ch:%') AND day = $2`
+
+const sqlInsertSquashedDailyCount = `INSERT INTO orgs_analyticsdailycount(count_type, scope, day, count, is_squashed) VALUES(:count_type, :scope, :day, :count, TRUE)`
+
+// ReconcileAnalytics replaces the analytics rollups of the given org for the given day with counts calculated from the
+// underlying data, fixing any drift from increments which were lost or counted twice
+func ReconcileAnalytics(ctx context.Context, db *sqlx.DB, oa *OrgAssets, day dates.Date) error {
+	tz := oa.Org().Timezone()
+	start := time.Date(day.Year, day.Month, day.Day, 0, 0, 0, 0, tz)
+	end := start.AddDate(0, 0, 1)
+
+	msgCounts := make([]*struct {
+		Direction MsgDirection `db:"direction"`
+		ChannelID ChannelID    `db:"channel_id"`
+		Count     int          `db:"count"`
+		Segments  int          `db:"segments"`
+	}, 0)
+	if err := db.SelectContext(ctx, &msgCounts, sqlSelectAnalyticsMsgCounts, oa.OrgID(), start, end); err != nil {
+		return errors.Wrap(err, "error selecting message counts")
+	}
+
+	conversationCounts := make([]*struct {
+		ChannelID ChannelID `db:"channel_id"`
+		Count     int       `db:"count"`
+	}, 0)
+	if err := db.SelectContext(ctx, &conversationCounts, sqlSelectAnalyticsConversationCounts, oa.OrgID(), start, end); err != nil {
+		return errors.Wrap(err, "error selecting conversation counts")
+	}
+
+	orgCounts := &struct {
+		FlowStarts      int `db:"flow_starts"`
+		FlowCompletions int `db:"flow_completions"`
+		IVRSeconds      int `db:"ivr_seconds"`
+		TicketsOpened   int `db:"tickets_opened"`
+		TicketsClosed   int `db:"tickets_closed"`
+	}{}
+	if err := db.GetContext(ctx, orgCounts, sqlSelectAnalyticsOrgCounts, oa.OrgID(), start, end); err != nil {
+		return errors.Wrap(err, "error selecting org counts")
+	}
+
+	increments := []*AnalyticsIncrement{
+		{Type: AnalyticsCountFlowStarts, Count: orgCounts.FlowStarts},
+		{Type: AnalyticsCountFlowCompletions, Count: orgCounts.FlowCompletions},
+		{Type: AnalyticsCountIVRSeconds, Count: orgCounts.IVRSeconds},
+		{Type: AnalyticsCountTicketsOpened, Count: orgCounts.TicketsOpened},
+		{Type: AnalyticsCountTicketsClosed, Count: orgCounts.TicketsClosed},
+	}
+	for _, c := range msgCounts {
+		if c.Direction != DirectionOut {
+			increments = append(increments, &AnalyticsIncrement{Type: AnalyticsCountMsgsIn, ChannelID: c.ChannelID, Count: c.Count})
+			continue
+		}
+
+		increments = append(increments,
+			&AnalyticsIncrement{Type: AnalyticsCountMsgsOut, ChannelID: c.ChannelID, Count: c.Count},
+			&AnalyticsIncrement{Type: AnalyticsCountMsgSegments, ChannelID: c.ChannelID, Count: c.Segments},
+		)
+
+		// costs can only be recalculated at the channel's current rate
+		if channel := oa.ChannelByID(c.ChannelID); channel != nil {
+			if cost := segmentsCost(channel, c.Segments); cost != nil {
+				increments = append(increments, &AnalyticsIncrement{Type: AnalyticsCountMsgCostMicros, ChannelID: c.ChannelID, Count: costToMicros(*cost)})
+			}
+		}
+	}
+	for _, c := range conversationCounts {
+		increments = append(increments, &AnalyticsIncrement{Type: AnalyticsCountConversations, ChannelID: c.ChannelID, Count: c.Count})
+	}
+
+	counts := make([]interface{}, 0, len(increments))
+	for countType, scopeCounts := range analyticsScopeCounts(oa, increments) {
+		for scope, count := range scopeCounts {
+			counts = append(counts, &dailyCount{scopedCount: scopedCount{CountType: string(countType), Scope: scope, Count: count}, Day: day})
+		}
+	}
+
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "error starting transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, sqlDeleteAnalyticsCounts, scopeOrg(oa), day); err != nil {
+		return errors.Wrap(err, "error deleting analytics counts")
+	}
+	if err := BulkQuery(ctx, "inserted reconciled analytics counts", tx, sqlInsertSquashedDailyCount, counts); err != nil {
+		return errors.Wrap(err, "error inserting reconciled analytics counts")
+	}
+
+	return errors.Wrap(tx.Commit(), "error committing reconciled analytics counts")
+}
+
+// OrgTimezone is an active org and its timezone
+type OrgTimezone struct {
+	OrgID    OrgID  `db:"id"`
+	Timezone string `db:"timezone"`
+}
+
+const sqlSelectActiveOrgTimezones = `SELECT id, timezone FROM orgs_org WHERE is_active = TRUE ORDER BY id`
+
+// LoadActiveOrgTimezones loads the timezones of all active orgs
+func LoadActiveOrgTimezones(ctx context.Context, db Queryer) ([]*OrgTimezone, error) {
+	orgs := make([]*OrgTimezone, 0, 10)
+	if err := db.SelectContext(ctx, &orgs, sqlSelectActiveOrgTimezones); err != nil {
+		return nil, errors.Wrap(err, "error loading active org timezones")
+	}
+	return orgs, nil
+}
@@ -0,0 +1,60 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalytics(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+	defer dates.SetNowSource(dates.DefaultNowSource)
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 10, 1, 20, 0, 0, 0, time.UTC)))
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	err = models.InsertAnalyticsCounts(ctx, db, oa, []*models.AnalyticsIncrement{
+		{Type: models.AnalyticsCountMsgsIn, ChannelID: testdata.TwilioChannel.ID, Count: 1},
+		{Type: models.AnalyticsCountMsgsIn, ChannelID: testdata.TwilioChannel.ID, Count: 1},
+		{Type: models.AnalyticsCountMsgsOut, ChannelID: testdata.VonageChannel.ID, Count: 3},
+		{Type: models.AnalyticsCountFlowStarts, Count: 2},
+		{Type: models.AnalyticsCountFlowCompletions, Count: 0},
+	})
+	require.NoError(t, err)
+
+	err = models.InsertAnalyticsCounts(ctx, db, oa, []*models.AnalyticsIncrement{{Type: models.AnalyticsCountIVRSeconds, Count: 45}})
+	require.NoError(t, err)
+
+	days, err := models.GetAnalytics(ctx, db, oa, dates.NewDate(2022, 9, 30), dates.NewDate(2022, 10, 2))
+	require.NoError(t, err)
+	require.Len(t, days, 1)
+
+	assert.Equal(t, "2022-10-01", days[0].Day)
+	assert.Equal(t, map[models.AnalyticsCountType]int{"msgs_in": 2, "msgs_out": 3, "flow_starts": 2, "ivr_seconds": 45}, days[0].Counts)
+	assert.Equal(t, map[assets.ChannelUUID]map[models.AnalyticsCountType]int{
+		testdata.TwilioChannel.UUID: {"msgs_in": 2},
+		testdata.VonageChannel.UUID: {"msgs_out": 3},
+	}, days[0].Channels)
+
+	// reconciling replaces the counts with counts calculated from the underlying data
+	err = models.ReconcileAnalytics(ctx, db, oa, dates.NewDate(2022, 10, 1))
+	require.NoError(t, err)
+
+	days, err = models.GetAnalytics(ctx, db, oa, dates.NewDate(2022, 9, 30), dates.NewDate(2022, 10, 2))
+	require.NoError(t, err)
+	assert.Len(t, days, 0)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM orgs_analyticsdailycount`).Returns(0)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/nyaruka/mailroom/runtime"
 	cache "github.com/patrickmn/go-cache"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // OrgAssets is our top level cache of all things contained in an org. It is used to build
@@ -86,6 +87,9 @@ var orgCache = cache.New(time.Second*5, time.Minute)
 // map of org id -> assetLoader used to make sure we only load an individual org once when expired
 var assetLoaders = sync.Map{}
 
+// map of org id -> time of the last refresh of that org's assets, so that scoped assets built before it aren't used
+var assetRefreshes = sync.Map{}
+
 // represents a goroutine loading assets for an org, stores the loaded assets (and possible error) and
 // a channel to notify any listeners that the loading is complete
 type assetLoader struct {
@@ -110,9 +114,11 @@ func loadOrgAssetsOnce(ctx context.Context, rt *runtime.Runtime, orgID OrgID) (*
 	return actualLoader.assets, actualLoader.err
 }
 
-// FlushCache clears our entire org cache
+// FlushCache clears our entire org cache and feature flag cache
 func FlushCache() {
 	orgCache.Flush()
+	assetRefreshes.Range(func(k, _ interface{}) bool { assetRefreshes.Delete(k); return true })
+	featureFlagCache.Flush()
 }
 
 // NewOrgAssets creates and returns a new org assets objects, potentially using the previous
@@ -141,6 +147,12 @@ func NewOrgAssets(ctx context.Context, rt *runtime.Runtime, orgID OrgID, prev *O
 		if err != nil {
 			return nil, errors.Wrapf(err, "error loading environment for org %d", orgID)
 		}
+
+		// without the data key, sensitive field values can't be read but other values can so we don't fail here, but
+		// loading any contacts with sensitive field values will
+		if err := oa.org.unlockFieldEncryption(ctx, rt.KMS); err != nil {
+			logrus.WithError(err).WithField("org_id", orgID).Error("error unlocking field encryption for org")
+		}
 	} else {
 		oa.org = prev.org
 	}
@@ -402,6 +414,10 @@ func GetOrgAssets(ctx context.Context, rt *runtime.Runtime, orgID OrgID) (*OrgAs
 
 // GetOrgAssetsWithRefresh creates or gets org assets for the passed in org refreshing the passed in assets
 func GetOrgAssetsWithRefresh(ctx context.Context, rt *runtime.Runtime, orgID OrgID, refresh Refresh) (*OrgAssets, error) {
+	if refresh != RefreshNone {
+		assetRefreshes.Store(orgID, time.Now())
+	}
+
 	// do we have a recent cache?
 	key := fmt.Sprintf("%d", orgID)
 	var cached *OrgAssets
@@ -439,6 +455,36 @@ func GetOrgAssetsWithRefresh(ctx context.Context, rt *runtime.Runtime, orgID Org
 	return o, nil
 }
 
+// GetOrgAssetsScoped gets org assets for the passed in org for callers which only need some types of asset. If the
+// full assets for the org aren't already cached, assets are built which only contain the org itself, the given types of
+// asset and lazily loaded flows. These are cached separately so they're never used by callers which need everything,
+// and are rebuilt if the org's assets have been refreshed since they were built.
+func GetOrgAssetsScoped(ctx context.Context, rt *runtime.Runtime, orgID OrgID, scope Refresh) (*OrgAssets, error) {
+	// if we have the full assets cached, use them
+	if c, found := orgCache.Get(fmt.Sprintf("%d", orgID)); found {
+		return c.(*OrgAssets), nil
+	}
+
+	key := fmt.Sprintf("%d:%d", orgID, scope)
+	if c, found := orgCache.Get(key); found {
+		cached := c.(*OrgAssets)
+		if refreshedOn, refreshed := assetRefreshes.Load(orgID); !refreshed || !cached.builtAt.Before(refreshedOn.(time.Time)) {
+			return cached, nil
+		}
+	}
+
+	// build on top of empty assets so that only the requested types are loaded
+	empty := &OrgAssets{builtAt: time.Now()}
+
+	o, err := NewOrgAssets(ctx, rt, orgID, empty, scope|RefreshOrg|RefreshFlows)
+	if err != nil {
+		return nil, err
+	}
+
+	orgCache.SetDefault(key, o)
+	return o, nil
+}
+
 func (a *OrgAssets) OrgID() OrgID { return a.orgID }
 
 func (a *OrgAssets) Env() envs.Environment { return a.org }
@@ -591,6 +637,15 @@ func (a *OrgAssets) Campaigns() []*Campaign {
 	return a.campaigns
 }
 
+func (a *OrgAssets) CampaignByID(campaignID CampaignID) *Campaign {
+	for _, c := range a.campaigns {
+		if c.ID() == campaignID {
+			return c
+		}
+	}
+	return nil
+}
+
 func (a *OrgAssets) CampaignByGroupID(groupID GroupID) []*Campaign {
 	return a.campaignsByGroup[groupID]
 }
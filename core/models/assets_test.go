@@ -59,6 +59,36 @@ func TestAssets(t *testing.T) {
 	assert.Nil(t, dbFlow)
 }
 
+func TestGetOrgAssetsScoped(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer models.FlushCache()
+
+	models.FlushCache()
+
+	oa, err := models.GetOrgAssetsScoped(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+	assert.Equal(t, testdata.Org1.ID, oa.OrgID())
+	assert.NotNil(t, oa.Org())
+	assert.NotNil(t, oa.ChannelByID(testdata.TwilioChannel.ID))
+	assert.Nil(t, oa.GroupByID(testdata.DoctorsGroup.ID)) // groups not loaded
+
+	flow, err := oa.FlowByUUID(testdata.Favorites.UUID) // flows always available
+	assert.NoError(t, err)
+	assert.Equal(t, "Favorites", flow.Name())
+
+	// scoped assets are cached separately from full assets
+	full, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.NotSame(t, oa, full)
+	assert.NotNil(t, full.GroupByID(testdata.DoctorsGroup.ID))
+
+	// but if full assets are cached they're used instead
+	oa, err = models.GetOrgAssetsScoped(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+	assert.Same(t, full, oa)
+}
+
 func TestCloneForSimulation(t *testing.T) {
 	ctx, rt, _, _ := testsuite.Get()
 
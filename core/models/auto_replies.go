@@ -0,0 +1,189 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/actions"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
+)
+
+// AutoReply is the static reply of a flow which does nothing but send messages without any expressions, and so can be
+// sent in response to a keyword without starting a session in the flow engine
+type AutoReply struct {
+	Msgs []*AutoReplyMsg
+}
+
+// AutoReplyMsg is a single message of an auto reply
+type AutoReplyMsg struct {
+	Text         string
+	Attachments  []utils.Attachment
+	QuickReplies []string
+}
+
+// the subset of a flow definition we need to know whether it's a static reply
+type autoReplyDefinition struct {
+	SpecVersion  string          `json:"spec_version"`
+	Localization json.RawMessage `json:"localization"`
+	Nodes        []struct {
+		Actions []struct {
+			Type         string          `json:"type"`
+			Text         string          `json:"text"`
+			Attachments  []string        `json:"attachments"`
+			QuickReplies []string        `json:"quick_replies"`
+			Templating   json.RawMessage `json:"templating"`
+			Topic        string          `json:"topic"`
+			AllURNs      bool            `json:"all_urns"`
+		} `json:"actions"`
+		Router json.RawMessage `json:"router"`
+		Exits  []struct {
+			DestinationUUID string `json:"destination_uuid"`
+		} `json:"exits"`
+	} `json:"nodes"`
+}
+
+// reads the auto reply from a flow definition if it has one, i.e. it's a single node of send_msg actions with static
+// content and no localization, otherwise returns nil
+func readAutoReply(flowType FlowType, definition []byte) *AutoReply {
+	if flowType != FlowTypeMessaging {
+		return nil
+	}
+
+	def := &autoReplyDefinition{}
+	if err := jsonx.Unmarshal(definition, def); err != nil {
+		return nil
+	}
+
+	// only current definitions can be read without migrating them
+	if !strings.HasPrefix(def.SpecVersion, "13.") || len(def.Nodes) != 1 || !isEmptyJSON(def.Localization) {
+		return nil
+	}
+
+	node := def.Nodes[0]
+	if !isEmptyJSON(node.Router) {
+		return nil
+	}
+	for _, e := range node.Exits {
+		if e.DestinationUUID != "" {
+			return nil
+		}
+	}
+
+	reply := &AutoReply{Msgs: make([]*AutoReplyMsg, 0, len(node.Actions))}
+
+	for _, a := range node.Actions {
+		if a.Type != actions.TypeSendMsg || a.AllURNs || !isEmptyJSON(a.Templating) || a.Topic != "" {
+			return nil
+		}
+
+		if hasExpression(a.Text) {
+			return nil
+		}
+		msg := &AutoReplyMsg{Text: a.Text, QuickReplies: a.QuickReplies}
+		for _, qr := range a.QuickReplies {
+			if hasExpression(qr) {
+				return nil
+			}
+		}
+		for _, att := range a.Attachments {
+			if hasExpression(att) {
+				return nil
+			}
+			msg.Attachments = append(msg.Attachments, utils.Attachment(att))
+		}
+
+		reply.Msgs = append(reply.Msgs, msg)
+	}
+
+	if len(reply.Msgs) == 0 {
+		return nil
+	}
+	return reply
+}
+
+func isEmptyJSON(v json.RawMessage) bool {
+	s := strings.TrimSpace(string(v))
+	return s == "" || s == "null" || s == "{}" || s == "[]"
+}
+
+func hasExpression(s string) bool {
+	return strings.Contains(s, "@")
+}
+
+// AutoReplyFastPath returns whether this org sends the static replies of keyword triggered flows without starting them
+func (o *Org) AutoReplyFastPath() bool {
+	enabled, _ := o.o.Config.Get(configAutoReplyFastPath, false).(bool)
+	return enabled
+}
+
+// SendAutoReply creates and commits the messages of the given flow's auto reply to the given incoming message, marking
+// it as handled by the flow, and returns the outgoing messages which should then be sent. No session or run is created.
+// The given hook, if any, is called in the same transaction.
+func SendAutoReply(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, channel *Channel, contact *flows.Contact, flow *Flow, in *flows.MsgIn, attachments []utils.Attachment, logUUIDs []ChannelLogUUID, hook func(context.Context, *sqlx.Tx) error) ([]*Msg, error) {
+	reply := flow.AutoReply()
+	if reply == nil {
+		return nil, errors.Errorf("flow %s doesn't have an auto reply", flow.UUID())
+	}
+
+	now := time.Now()
+	msgs := make([]*Msg, 0, len(reply.Msgs))
+
+	for _, r := range reply.Msgs {
+		out := flows.NewMsgOut(in.URN(), in.Channel(), r.Text, r.Attachments, r.QuickReplies, nil, flows.NilMsgTopic, flows.NilUnsendableReason)
+
+		msg, err := newOutgoingMsg(rt, oa.Org(), channel, contact, out, now, nil, nil, NilBroadcastID)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating auto reply message")
+		}
+
+		// we're responding to an incoming message so set the same fields as a session would
+		msg.m.FlowID = flow.ID()
+		msg.m.Flow = flow.Reference()
+		msg.m.ResponseToExternalID = null.String(in.ExternalID())
+		msg.m.HighPriority = true
+
+		msgs = append(msgs, msg)
+	}
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting transaction")
+	}
+
+	if err := InsertMessages(ctx, tx, msgs); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "error inserting auto reply messages")
+	}
+	if err := InsertAnalyticsCounts(ctx, tx, oa, MsgAnalyticsIncrements(msgs)); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "error inserting auto reply analytics counts")
+	}
+	if err := RecordConversations(ctx, tx, oa, ConversationMsgsFor(msgs)); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "error recording auto reply conversations")
+	}
+	if err := UpdateMessage(ctx, tx, in.ID(), MsgStatusHandled, VisibilityVisible, MsgTypeFlow, flow.ID(), attachments, logUUIDs); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrap(err, "error marking message as handled")
+	}
+	if hook != nil {
+		if err := hook(ctx, tx); err != nil {
+			tx.Rollback()
+			return nil, errors.Wrap(err, "error running auto reply hook")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "error committing auto reply")
+	}
+
+	return msgs, nil
+}
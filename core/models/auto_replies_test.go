@@ -0,0 +1,86 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoReplies(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	static := testdata.InsertFlow(db, testdata.Org1, []byte(`{
+		"uuid": "f0a4a5c4-4d1b-4bb6-a7b3-8a0ed1a25a9b",
+		"name": "Opening Hours",
+		"spec_version": "13.1.0",
+		"language": "eng",
+		"type": "messaging",
+		"nodes": [
+			{
+				"uuid": "5d58c1b4-4a5f-4ed4-9e44-8b5a1c9f2a11",
+				"actions": [
+					{"uuid": "e1d2b7d6-9c8e-4a4f-8a3c-0c6b1b3c2f10", "type": "send_msg", "text": "We're open 9am to 5pm", "quick_replies": ["Address"]},
+					{"uuid": "a3a4d1ce-7f4a-4a0b-8b2c-6a1e5f3d9e22", "type": "send_msg", "text": "See you soon", "attachments": ["image/jpeg:https://example.com/map.jpg"]}
+				],
+				"exits": [{"uuid": "bc2a0e63-0c5f-4cfc-8a6c-6b8d4c3e2a33"}]
+			}
+		],
+		"localization": {}
+	}`))
+	dynamic := testdata.InsertFlow(db, testdata.Org1, []byte(`{
+		"uuid": "8c1f7c1a-0e5d-4a9f-9c1e-2f7d5b3a4e44",
+		"name": "Greeting",
+		"spec_version": "13.1.0",
+		"language": "eng",
+		"type": "messaging",
+		"nodes": [
+			{
+				"uuid": "0b7e1e4a-5f2d-4c3a-8e1b-9d6c4a2f3b55",
+				"actions": [{"uuid": "4e3d2c1b-6a5f-4e7d-9c8b-1a2b3c4d5e66", "type": "send_msg", "text": "Hi @contact.name"}],
+				"exits": [{"uuid": "7f6e5d4c-3b2a-4190-8f7e-6d5c4b3a2f77"}]
+			}
+		]
+	}`))
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshFlows)
+	require.NoError(t, err)
+
+	flow, err := oa.FlowByID(static.ID)
+	require.NoError(t, err)
+	require.NotNil(t, flow.AutoReply())
+	assert.Equal(t, 2, len(flow.AutoReply().Msgs))
+	assert.Equal(t, "We're open 9am to 5pm", flow.AutoReply().Msgs[0].Text)
+	assert.Equal(t, []string{"Address"}, flow.AutoReply().Msgs[0].QuickReplies)
+
+	// flows with expressions, routers or multiple nodes don't have auto replies
+	for _, f := range []*testdata.Flow{dynamic, testdata.Favorites, testdata.PickANumber} {
+		flow, err := oa.FlowByID(f.ID)
+		require.NoError(t, err)
+		assert.Nil(t, flow.AutoReply(), "unexpected auto reply for flow %s", f.UUID)
+	}
+
+	_, cathy := testdata.Cathy.Load(db, oa)
+	in := testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "hours", models.MsgStatusPending)
+	channel := oa.ChannelByID(testdata.TwilioChannel.ID)
+
+	flow, _ = oa.FlowByID(static.ID)
+	msgs, err := models.SendAutoReply(ctx, rt, oa, channel, cathy, flow, in, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(msgs))
+	assert.True(t, msgs[0].HighPriority())
+	assert.Equal(t, static.ID, msgs[0].FlowID())
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE direction = 'O' AND flow_id = $1 AND contact_id = $2`, static.ID, testdata.Cathy.ID).Returns(2)
+	assertdb.Query(t, db, `SELECT status, msg_type, flow_id FROM msgs_msg WHERE id = $1`, in.ID()).Columns(map[string]interface{}{"status": "H", "msg_type": "F", "flow_id": int64(static.ID)})
+
+	// and no session or run was created
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrun WHERE flow_id = $1`, static.ID).Returns(0)
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/excellent"
+	"github.com/nyaruka/goflow/excellent/types"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+)
+
+// the top level names of the context that broadcast templates are evaluated with
+var broadcastTemplateTopLevels = []string{"contact", "fields", "globals", "urns"}
+
+// same limit as the engine applies to attachments on messages sent from flows
+const maxBroadcastAttachmentLength = 2048
+
+// ValidateAttachments checks that the attachments of each translation are valid templates. Attachments without
+// expressions must have a content type, whereas those with expressions, e.g. image/jpeg:@fields.certificate_url, can
+// only be fully checked once they're evaluated for each contact.
+func (b *Broadcast) ValidateAttachments() error {
+	if b.b.TemplateState != TemplateStateUnevaluated {
+		return nil
+	}
+
+	for lang, t := range b.b.Translations {
+		for _, a := range t.Attachments {
+			if err := validateAttachmentTemplate(string(a)); err != nil {
+				return errors.Wrapf(err, "invalid attachment '%s' in %s translation", a, lang)
+			}
+		}
+	}
+	return nil
+}
+
+func validateAttachmentTemplate(template string) error {
+	if !excellent.HasExpressions(template, broadcastTemplateTopLevels) {
+		if utils.Attachment(template).ContentType() == "" {
+			return errors.New("attachment has no content type")
+		}
+		return nil
+	}
+
+	return excellent.VisitTemplate(template, broadcastTemplateTopLevels, func(tokenType excellent.XTokenType, token string) error {
+		if tokenType == excellent.EXPRESSION {
+			_, err := excellent.Parse(token, nil)
+			return err
+		}
+		return nil
+	})
+}
+
+// evaluates the given attachment templates for a single contact, skipping any which don't evaluate to a valid
+// attachment and returning an error for each of those
+func evaluateBroadcastAttachments(env envs.Environment, ctx *types.XObject, templates []utils.Attachment) ([]utils.Attachment, []error) {
+	attachments := make([]utils.Attachment, 0, len(templates))
+	var errs []error
+
+	for _, template := range templates {
+		evaluated, err := excellent.EvaluateTemplate(env, ctx, string(template), nil)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "error evaluating attachment '%s'", template))
+			continue
+		}
+
+		attachment := utils.Attachment(evaluated)
+		contentType, url := attachment.ToParts()
+
+		if contentType == "" || url == "" {
+			errs = append(errs, errors.Errorf("attachment '%s' evaluated to '%s' which isn't a valid attachment", template, evaluated))
+			continue
+		}
+		if len(evaluated) > maxBroadcastAttachmentLength {
+			errs = append(errs, errors.Errorf("attachment '%s' evaluated to more than %d characters", template, maxBroadcastAttachmentLength))
+			continue
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, errs
+}
@@ -0,0 +1,37 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroadcastValidateAttachments(t *testing.T) {
+	tcs := []struct {
+		attachments []utils.Attachment
+		state       models.TemplateState
+		err         string
+	}{
+		{[]utils.Attachment{"image/jpeg:https://example.com/cert.jpg"}, models.TemplateStateUnevaluated, ""},
+		{[]utils.Attachment{"image/jpeg:@fields.certificate_url"}, models.TemplateStateUnevaluated, ""},
+		{[]utils.Attachment{"@fields.certificate"}, models.TemplateStateUnevaluated, ""},
+		{[]utils.Attachment{"https://example.com/cert.jpg"}, models.TemplateStateUnevaluated, "invalid attachment 'https://example.com/cert.jpg' in eng translation: attachment has no content type"},
+		{[]utils.Attachment{"image/jpeg:@(1 * * 2)"}, models.TemplateStateUnevaluated, "invalid attachment 'image/jpeg:@(1 * * 2)' in eng translation: error evaluating @(1 * * 2): syntax error at * 2"},
+		{[]utils.Attachment{"https://example.com/cert.jpg"}, models.TemplateStateEvaluated, ""}, // not our problem
+	}
+
+	for _, tc := range tcs {
+		translations := map[envs.Language]*models.BroadcastTranslation{"eng": {Text: "Your certificate", Attachments: tc.attachments}}
+		bcast := models.NewBroadcast(1, models.NilBroadcastID, translations, tc.state, "eng", nil, nil, nil, models.NilTicketID, models.NilUserID)
+
+		err := bcast.ValidateAttachments()
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, "error mismatch for attachments %v", tc.attachments)
+		} else {
+			assert.NoError(t, err, "unexpected error for attachments %v", tc.attachments)
+		}
+	}
+}
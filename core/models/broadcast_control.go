@@ -0,0 +1,239 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// how long we keep the progress of a broadcast after it was last updated
+const broadcastProgressExpiry = time.Hour * 24 * 7
+
+// BroadcastStatus is the sending status of a broadcast which has been queued
+type BroadcastStatus string
+
+const (
+	BroadcastStatusQueued    = BroadcastStatus("queued")
+	BroadcastStatusSending   = BroadcastStatus("sending")
+	BroadcastStatusPaused    = BroadcastStatus("paused")
+	BroadcastStatusCancelled = BroadcastStatus("cancelled")
+)
+
+// BroadcastProgress is the status of a queued broadcast, how many of its contacts have been sent to, and the total
+// segments and cost of the messages created so far
+type BroadcastProgress struct {
+	BroadcastID BroadcastID     `json:"broadcast_id"`
+	Status      BroadcastStatus `json:"status"`
+	Total       int             `json:"total"`
+	Processed   int             `json:"processed"`
+	Segments    int             `json:"segments"`
+	Cost        decimal.Decimal `json:"cost"`
+}
+
+// Remaining returns the number of contacts the broadcast hasn't been sent to yet
+func (p *BroadcastProgress) Remaining() int {
+	if p.Processed > p.Total {
+		return 0
+	}
+	return p.Total - p.Processed
+}
+
+var broadcastProgressKeys = orgkeys.Register("broadcast_progress:%d:%d")
+
+func broadcastProgressKey(orgID OrgID, broadcastID BroadcastID) string {
+	return broadcastProgressKeys.Key(int(orgID), broadcastID)
+}
+
+var broadcastHeldKeys = orgkeys.Register("broadcast_held:%d:%d")
+
+// batches which arrive whilst a broadcast is paused are held here until it's resumed
+func broadcastHeldKey(orgID OrgID, broadcastID BroadcastID) string {
+	return broadcastHeldKeys.Key(int(orgID), broadcastID)
+}
+
+// InitBroadcastProgress records that the given broadcast has been queued to send to the given number of contacts
+func InitBroadcastProgress(rc redis.Conn, orgID OrgID, broadcastID BroadcastID, total int) error {
+	key := broadcastProgressKey(orgID, broadcastID)
+
+	rc.Send("MULTI")
+	rc.Send("HSET", key, "status", BroadcastStatusQueued, "total", total, "processed", 0)
+	rc.Send("EXPIRE", key, int(broadcastProgressExpiry/time.Second))
+	_, err := rc.Do("EXEC")
+
+	return errors.Wrapf(err, "error initializing progress of broadcast #%d", broadcastID)
+}
+
+// GetBroadcastProgress gets the progress of the given broadcast, or nil if it isn't being tracked
+func GetBroadcastProgress(rc redis.Conn, orgID OrgID, broadcastID BroadcastID) (*BroadcastProgress, error) {
+	values, err := redis.StringMap(rc.Do("HGETALL", broadcastProgressKey(orgID, broadcastID)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting progress of broadcast #%d", broadcastID)
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+
+	p := &BroadcastProgress{BroadcastID: broadcastID, Status: BroadcastStatus(values["status"])}
+	fmt.Sscan(values["total"], &p.Total)
+	fmt.Sscan(values["processed"], &p.Processed)
+	fmt.Sscan(values["segments"], &p.Segments)
+
+	var costMicros int
+	fmt.Sscan(values["cost_micros"], &costMicros)
+	p.Cost = costFromMicros(costMicros)
+
+	return p, nil
+}
+
+const sqlCountBroadcastMsgs = `SELECT COUNT(*) FROM msgs_msg WHERE broadcast_id = $1`
+
+// CountBroadcastMsgs counts the messages which have been created for the given broadcast
+func CountBroadcastMsgs(ctx context.Context, db Queryer, broadcastID BroadcastID) (int, error) {
+	var count int
+	err := db.GetContext(ctx, &count, sqlCountBroadcastMsgs, broadcastID)
+	return count, errors.Wrapf(err, "error counting messages of broadcast #%d", broadcastID)
+}
+
+var holdBroadcastBatchScript = redis.NewScript(2, `
+local progressKey, heldKey = KEYS[1], KEYS[2]
+local batch, expiry = ARGV[1], ARGV[2]
+
+local status = redis.call("HGET", progressKey, "status")
+if status == "paused" then
+	redis.call("RPUSH", heldKey, batch)
+	redis.call("EXPIRE", heldKey, expiry)
+elseif status == "queued" then
+	redis.call("HSET", progressKey, "status", "sending")
+	status = "sending"
+end
+
+return status or ""
+`)
+
+// HoldBroadcastBatch checks the status of the broadcast of the given batch before it's sent. If the broadcast is
+// paused the batch is held until it's resumed. The returned status is empty if the broadcast isn't being tracked.
+func HoldBroadcastBatch(rc redis.Conn, batch *BroadcastBatch) (BroadcastStatus, error) {
+	status, err := redis.String(holdBroadcastBatchScript.Do(rc,
+		broadcastProgressKey(batch.OrgID, batch.BroadcastID), broadcastHeldKey(batch.OrgID, batch.BroadcastID),
+		jsonx.MustMarshal(batch), int(broadcastProgressExpiry/time.Second),
+	))
+	if err != nil {
+		return "", errors.Wrapf(err, "error checking status of broadcast #%d", batch.BroadcastID)
+	}
+	return BroadcastStatus(status), nil
+}
+
+// NumContacts returns the number of unique contacts in this batch
+func (b *BroadcastBatch) NumContacts() int {
+	num := len(b.URNs)
+	for _, id := range b.ContactIDs {
+		if _, hasURN := b.URNs[id]; !hasURN {
+			num++
+		}
+	}
+	return num
+}
+
+// RecordBroadcastBatchProcessed records that the given number of contacts in a batch of the given broadcast were sent to
+// with messages totalling the given segments and cost
+func RecordBroadcastBatchProcessed(rc redis.Conn, orgID OrgID, broadcastID BroadcastID, contacts int, costs MsgCostTotals) error {
+	key := broadcastProgressKey(orgID, broadcastID)
+
+	rc.Send("MULTI")
+	rc.Send("HINCRBY", key, "processed", contacts)
+	rc.Send("HINCRBY", key, "segments", costs.Segments)
+	rc.Send("HINCRBY", key, "cost_micros", costs.CostMicros)
+	rc.Send("EXPIRE", key, int(broadcastProgressExpiry/time.Second))
+	_, err := rc.Do("EXEC")
+
+	return errors.Wrapf(err, "error recording progress of broadcast #%d", broadcastID)
+}
+
+var changeBroadcastStatusScript = redis.NewScript(2, `
+local progressKey, heldKey = KEYS[1], KEYS[2]
+local from1, from2, from3, to = ARGV[1], ARGV[2], ARGV[3], ARGV[4]
+
+local status = redis.call("HGET", progressKey, "status")
+if status ~= from1 and status ~= from2 and status ~= from3 then
+	return {0, {}}
+end
+
+redis.call("HSET", progressKey, "status", to)
+
+-- resuming or cancelling releases any held batches
+local held = {}
+if to ~= "paused" then
+	held = redis.call("LRANGE", heldKey, 0, -1)
+	redis.call("DEL", heldKey)
+end
+
+return {1, held}
+`)
+
+// ErrBroadcastStatusUnchanged is returned when a broadcast can't be paused, resumed or cancelled from its current status
+var ErrBroadcastStatusUnchanged = errors.New("broadcast status can't be changed from its current status")
+
+func changeBroadcastStatus(rc redis.Conn, orgID OrgID, broadcastID BroadcastID, from []BroadcastStatus, to BroadcastStatus) ([]*BroadcastBatch, error) {
+	args := []interface{}{broadcastProgressKey(orgID, broadcastID), broadcastHeldKey(orgID, broadcastID)}
+	for i := 0; i < 3; i++ {
+		if i < len(from) {
+			args = append(args, from[i])
+		} else {
+			args = append(args, "")
+		}
+	}
+	args = append(args, to)
+
+	replies, err := redis.Values(changeBroadcastStatusScript.Do(rc, args...))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error changing status of broadcast #%d", broadcastID)
+	}
+
+	changed, _ := redis.Int(replies[0], nil)
+	if changed == 0 {
+		return nil, ErrBroadcastStatusUnchanged
+	}
+
+	items, err := redis.ByteSlices(replies[1], nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading held batches of broadcast #%d", broadcastID)
+	}
+
+	batches := make([]*BroadcastBatch, len(items))
+	for i, item := range items {
+		batches[i] = &BroadcastBatch{}
+		if err := jsonx.Unmarshal(item, batches[i]); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling held batch of broadcast #%d", broadcastID)
+		}
+	}
+	return batches, nil
+}
+
+// PauseBroadcast pauses a queued or sending broadcast so that any remaining batches are held until it's resumed
+func PauseBroadcast(rc redis.Conn, orgID OrgID, broadcastID BroadcastID) error {
+	_, err := changeBroadcastStatus(rc, orgID, broadcastID, []BroadcastStatus{BroadcastStatusQueued, BroadcastStatusSending}, BroadcastStatusPaused)
+	return err
+}
+
+// ResumeBroadcast resumes a paused broadcast, returning the batches which were held whilst it was paused and which
+// need to be queued again
+func ResumeBroadcast(rc redis.Conn, orgID OrgID, broadcastID BroadcastID) ([]*BroadcastBatch, error) {
+	return changeBroadcastStatus(rc, orgID, broadcastID, []BroadcastStatus{BroadcastStatusPaused}, BroadcastStatusSending)
+}
+
+// CancelBroadcast cancels a queued, sending or paused broadcast so that no more of its messages are created, and marks
+// it as failed as it will never be completely sent
+func CancelBroadcast(ctx context.Context, db Queryer, rc redis.Conn, orgID OrgID, broadcastID BroadcastID) error {
+	_, err := changeBroadcastStatus(rc, orgID, broadcastID, []BroadcastStatus{BroadcastStatusQueued, BroadcastStatusSending, BroadcastStatusPaused}, BroadcastStatusCancelled)
+	if err != nil {
+		return err
+	}
+
+	return MarkBroadcastFailed(ctx, db, broadcastID)
+}
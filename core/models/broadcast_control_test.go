@@ -0,0 +1,115 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBroadcastControl(t *testing.T) {
+	ctx, _, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	bcastID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "hello"}, models.NilScheduleID, nil, []*testdata.Group{testdata.DoctorsGroup})
+
+	assertProgress := func(status models.BroadcastStatus, total, processed int) {
+		progress, err := models.GetBroadcastProgress(rc, testdata.Org1.ID, bcastID)
+		require.NoError(t, err)
+		require.NotNil(t, progress)
+		assert.Equal(t, status, progress.Status)
+		assert.Equal(t, total, progress.Total)
+		assert.Equal(t, processed, progress.Processed)
+	}
+
+	// broadcasts which haven't been queued aren't tracked
+	progress, err := models.GetBroadcastProgress(rc, testdata.Org1.ID, bcastID)
+	assert.NoError(t, err)
+	assert.Nil(t, progress)
+
+	err = models.PauseBroadcast(rc, testdata.Org1.ID, bcastID)
+	assert.Equal(t, models.ErrBroadcastStatusUnchanged, err)
+
+	err = models.InitBroadcastProgress(rc, testdata.Org1.ID, bcastID, 3)
+	require.NoError(t, err)
+	assertProgress(models.BroadcastStatusQueued, 3, 0)
+
+	batch1 := &models.BroadcastBatch{BroadcastID: bcastID, OrgID: testdata.Org1.ID, ContactIDs: []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID}}
+	batch2 := &models.BroadcastBatch{BroadcastID: bcastID, OrgID: testdata.Org1.ID, ContactIDs: []models.ContactID{testdata.George.ID}, URNs: map[models.ContactID]urns.URN{testdata.George.ID: testdata.George.URN}, IsLast: true}
+	assert.Equal(t, 2, batch1.NumContacts())
+	assert.Equal(t, 1, batch2.NumContacts())
+
+	// first batch starts sending the broadcast
+	status, err := models.HoldBroadcastBatch(rc, batch1)
+	require.NoError(t, err)
+	assert.Equal(t, models.BroadcastStatusSending, status)
+
+	err = models.RecordBroadcastBatchProcessed(rc, testdata.Org1.ID, bcastID, batch1.NumContacts(), models.MsgCostTotals{Segments: 3, CostMicros: 75000})
+	require.NoError(t, err)
+	assertProgress(models.BroadcastStatusSending, 3, 2)
+
+	progress, err = models.GetBroadcastProgress(rc, testdata.Org1.ID, bcastID)
+	require.NoError(t, err)
+	assert.Equal(t, 3, progress.Segments)
+	assert.Equal(t, "0.075", progress.Cost.String())
+
+	// pause it so that the second batch is held
+	err = models.PauseBroadcast(rc, testdata.Org1.ID, bcastID)
+	require.NoError(t, err)
+	assertProgress(models.BroadcastStatusPaused, 3, 2)
+
+	status, err = models.HoldBroadcastBatch(rc, batch2)
+	require.NoError(t, err)
+	assert.Equal(t, models.BroadcastStatusPaused, status)
+
+	// can't pause it again
+	err = models.PauseBroadcast(rc, testdata.Org1.ID, bcastID)
+	assert.Equal(t, models.ErrBroadcastStatusUnchanged, err)
+
+	// resuming returns the held batch
+	held, err := models.ResumeBroadcast(rc, testdata.Org1.ID, bcastID)
+	require.NoError(t, err)
+	assertProgress(models.BroadcastStatusSending, 3, 2)
+	require.Len(t, held, 1)
+	assert.Equal(t, []models.ContactID{testdata.George.ID}, held[0].ContactIDs)
+	assert.Equal(t, testdata.George.URN, held[0].URNs[testdata.George.ID])
+	assert.True(t, held[0].IsLast)
+
+	_, err = models.ResumeBroadcast(rc, testdata.Org1.ID, bcastID)
+	assert.Equal(t, models.ErrBroadcastStatusUnchanged, err)
+
+	// pause again and then cancel, which drops any held batches and fails the broadcast
+	err = models.PauseBroadcast(rc, testdata.Org1.ID, bcastID)
+	require.NoError(t, err)
+
+	status, err = models.HoldBroadcastBatch(rc, batch2)
+	require.NoError(t, err)
+	assert.Equal(t, models.BroadcastStatusPaused, status)
+
+	err = models.CancelBroadcast(ctx, db, rc, testdata.Org1.ID, bcastID)
+	require.NoError(t, err)
+	assertProgress(models.BroadcastStatusCancelled, 3, 2)
+
+	assertdb.Query(t, db, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcastID).Returns("F")
+
+	status, err = models.HoldBroadcastBatch(rc, batch2)
+	require.NoError(t, err)
+	assert.Equal(t, models.BroadcastStatusCancelled, status)
+
+	_, err = models.ResumeBroadcast(rc, testdata.Org1.ID, bcastID)
+	assert.Equal(t, models.ErrBroadcastStatusUnchanged, err)
+
+	sent, err := models.CountBroadcastMsgs(ctx, db, bcastID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, sent)
+}
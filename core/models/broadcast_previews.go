@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/pkg/errors"
+)
+
+// how long a broadcast waits for confirmation after its preview has been sent
+const broadcastPreviewExpiry = time.Hour * 24 * 7
+
+// ErrBroadcastPreviewExpired is returned when confirming a broadcast whose preview was sent too long ago
+var ErrBroadcastPreviewExpired = errors.New("broadcast preview has expired")
+
+const sqlInsertBroadcastPreview = `
+INSERT INTO msgs_broadcastpreview(broadcast_id, org_id, broadcast, created_on)
+     VALUES($1, $2, $3, $4)
+ON CONFLICT (broadcast_id) DO UPDATE SET broadcast = EXCLUDED.broadcast, created_on = EXCLUDED.created_on`
+
+// StoreBroadcastPreview stores a broadcast whose preview has been sent so that it can be sent to its real audience once
+// confirmed
+func StoreBroadcastPreview(ctx context.Context, db Queryer, bcast *Broadcast) error {
+	if bcast.ID() == NilBroadcastID {
+		return errors.New("can't preview a broadcast without an id")
+	}
+
+	_, err := db.ExecContext(ctx, sqlInsertBroadcastPreview, bcast.ID(), bcast.OrgID(), jsonx.MustMarshal(bcast), dates.Now())
+	return errors.Wrapf(err, "error storing preview of broadcast #%d", bcast.ID())
+}
+
+const sqlDeleteBroadcastPreview = `
+DELETE FROM msgs_broadcastpreview
+      WHERE org_id = $1 AND broadcast_id = $2
+  RETURNING broadcast, created_on`
+
+// PopBroadcastPreview removes and returns a broadcast awaiting confirmation of its preview, or nil if there isn't one.
+// The returned broadcast no longer has a preview group so it can be queued to send to its real audience. If the
+// preview was sent too long ago, ErrBroadcastPreviewExpired is returned instead.
+func PopBroadcastPreview(ctx context.Context, db Queryer, orgID OrgID, broadcastID BroadcastID) (*Broadcast, error) {
+	var preview struct {
+		Broadcast []byte    `db:"broadcast"`
+		CreatedOn time.Time `db:"created_on"`
+	}
+
+	err := db.GetContext(ctx, &preview, sqlDeleteBroadcastPreview, orgID, broadcastID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error popping preview of broadcast #%d", broadcastID)
+	}
+
+	if dates.Since(preview.CreatedOn) > broadcastPreviewExpiry {
+		return nil, ErrBroadcastPreviewExpired
+	}
+
+	bcast := &Broadcast{}
+	if err := jsonx.Unmarshal(preview.Broadcast, bcast); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling preview of broadcast #%d", broadcastID)
+	}
+
+	bcast.b.PreviewGroupID = NilGroupID
+	return bcast, nil
+}
@@ -47,6 +47,12 @@ const (
 	CallErrorNoAnswer = CallError("N")
 	CallErrorMachine  = CallError("M")
 
+	// CallErrorUnreachable is used when a number lookup before dialing found the number to be unreachable
+	CallErrorUnreachable = CallError("U")
+
+	// CallErrorCutoff is used when a call was hung up by us for reaching its maximum duration
+	CallErrorCutoff = CallError("C")
+
 	CallMaxRetries = 3
 
 	// CallRetryWait is our default wait to retry call requests
@@ -90,6 +96,7 @@ func (c *Call) StartID() StartID        { return c.c.StartID }
 func (c *Call) ErrorReason() CallError  { return CallError(c.c.ErrorReason) }
 func (c *Call) ErrorCount() int         { return c.c.ErrorCount }
 func (c *Call) NextAttempt() *time.Time { return c.c.NextAttempt }
+func (c *Call) Duration() int           { return c.c.Duration }
 
 const sqlInsertCall = `
 INSERT INTO ivr_call
@@ -296,6 +303,118 @@ func LoadCallsToRetry(ctx context.Context, db Queryer, limit int) ([]*Call, erro
 	return calls, nil
 }
 
+const sqlSelectStuckCalls = `
+SELECT
+	cc.id as id, 
+	cc.created_on as created_on, 
+	cc.modified_on as modified_on, 
+	cc.external_id as external_id,  
+	cc.status as status, 
+	cc.direction as direction, 
+	cc.started_on as started_on, 
+	cc.ended_on as ended_on, 
+	cc.duration as duration, 
+	cc.error_reason as error_reason,
+	cc.error_count as error_count,
+	cc.next_attempt as next_attempt, 
+	cc.channel_id as channel_id, 
+	cc.contact_id as contact_id, 
+	cc.contact_urn_id as contact_urn_id, 
+	cc.org_id as org_id, 
+	fsc.flowstart_id as start_id
+FROM
+	ivr_call as cc
+LEFT OUTER JOIN 
+	flows_flowstart_calls fsc ON cc.id = fsc.call_id
+WHERE
+	cc.external_id != '' AND (
+		(cc.status = 'W' AND cc.modified_on < $1) OR 
+		(cc.status = 'I' AND COALESCE(cc.started_on, cc.modified_on) < $1)
+	)
+ORDER BY 
+	cc.modified_on ASC
+LIMIT
+    $2
+`
+
+// LoadStuckCalls returns up to limit calls which have been wired or in progress since before the given time
+func LoadStuckCalls(ctx context.Context, db Queryer, since time.Time, limit int) ([]*Call, error) {
+	rows, err := db.QueryxContext(ctx, sqlSelectStuckCalls, since, limit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting stuck calls")
+	}
+	defer rows.Close()
+
+	calls := make([]*Call, 0, 10)
+	for rows.Next() {
+		c := &Call{}
+		err = rows.StructScan(&c.c)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error scanning call")
+		}
+		calls = append(calls, c)
+	}
+
+	return calls, nil
+}
+
+// CallRecord is the detail record of a single call for reporting
+type CallRecord struct {
+	ID          CallID        `db:"id"`
+	ExternalID  string        `db:"external_id"`
+	ChannelID   ChannelID     `db:"channel_id"`
+	ChannelUUID string        `db:"channel_uuid"`
+	ChannelName string        `db:"channel_name"`
+	ContactUUID string        `db:"contact_uuid"`
+	Direction   CallDirection `db:"direction"`
+	Status      CallStatus    `db:"status"`
+	ErrorReason null.String   `db:"error_reason"`
+	ErrorCount  int           `db:"error_count"`
+	CreatedOn   time.Time     `db:"created_on"`
+	StartedOn   *time.Time    `db:"started_on"`
+	EndedOn     *time.Time    `db:"ended_on"`
+	Duration    int           `db:"duration"`
+}
+
+const sqlSelectCallRecords = `
+SELECT
+	cc.id as id,
+	cc.external_id as external_id,
+	cc.channel_id as channel_id,
+	ch.uuid as channel_uuid,
+	ch.name as channel_name,
+	c.uuid as contact_uuid,
+	cc.direction as direction,
+	cc.status as status,
+	cc.error_reason as error_reason,
+	cc.error_count as error_count,
+	cc.created_on as created_on,
+	cc.started_on as started_on,
+	cc.ended_on as ended_on,
+	cc.duration as duration
+FROM
+	ivr_call as cc
+JOIN
+	channels_channel ch ON cc.channel_id = ch.id
+JOIN
+	contacts_contact c ON cc.contact_id = c.id
+WHERE
+	cc.org_id = $1 AND cc.created_on >= $2 AND cc.created_on < $3
+ORDER BY
+	cc.created_on ASC, cc.id ASC
+`
+
+// LoadCallRecords returns the detail records of all calls in the given org which were created in the given date range
+func LoadCallRecords(ctx context.Context, db Queryer, orgID OrgID, start, end time.Time) ([]*CallRecord, error) {
+	records := make([]*CallRecord, 0, 100)
+
+	if err := db.SelectContext(ctx, &records, sqlSelectCallRecords, orgID, start, end); err != nil {
+		return nil, errors.Wrapf(err, "error selecting call records")
+	}
+
+	return records, nil
+}
+
 // UpdateExternalID updates the external id on the passed in channel session
 func (c *Call) UpdateExternalID(ctx context.Context, db Queryer, id string) error {
 	c.c.ExternalID = id
@@ -366,10 +485,32 @@ func (c *Call) MarkFailed(ctx context.Context, db Queryer, now time.Time) error
 	return nil
 }
 
+// MarkCutoff updates the status for this call to completed, recording that it ended because it was cut off
+func (c *Call) MarkCutoff(ctx context.Context, db Queryer, now time.Time) error {
+	c.c.Status = CallStatusCompleted
+	c.c.ErrorReason = null.String(CallErrorCutoff)
+	c.c.EndedOn = &now
+
+	_, err := db.ExecContext(ctx,
+		`UPDATE ivr_call SET status = $2, ended_on = $3, error_reason = $4, modified_on = NOW() WHERE id = $1`,
+		c.c.ID, c.c.Status, c.c.EndedOn, c.c.ErrorReason,
+	)
+
+	if err != nil {
+		return errors.Wrapf(err, "error marking call as cutoff")
+	}
+
+	return nil
+}
+
 // MarkThrottled updates the status for this call to be queued, to be retried in a minute
 func (c *Call) MarkThrottled(ctx context.Context, db Queryer, now time.Time) error {
+	return c.MarkThrottledUntil(ctx, db, now.Add(CallThrottleWait))
+}
+
+// MarkThrottledUntil updates the status for this call to be queued, to be retried at the given time
+func (c *Call) MarkThrottledUntil(ctx context.Context, db Queryer, next time.Time) error {
 	c.c.Status = CallStatusQueued
-	next := now.Add(CallThrottleWait)
 	c.c.NextAttempt = &next
 
 	_, err := db.ExecContext(ctx, `UPDATE ivr_call SET status = $2, next_attempt = $3, modified_on = NOW() WHERE id = $1`, c.c.ID, c.c.Status, c.c.NextAttempt)
@@ -433,6 +574,30 @@ func ActiveCallCount(ctx context.Context, db Queryer, id ChannelID) (int, error)
 	return count, nil
 }
 
+const sqlSelectDuplicateCallContacts = `
+SELECT
+	DISTINCT(c.contact_id)
+FROM
+	ivr_call c
+LEFT OUTER JOIN
+	flows_flowstart_calls fc ON fc.call_id = c.id
+WHERE
+	c.contact_id = ANY($1) AND
+	c.direction = 'O' AND
+	(c.status IN ('P', 'Q', 'W', 'I') OR (fc.flowstart_id = $2 AND c.modified_on > $3))
+`
+
+// FindDuplicateCallContacts returns which of the passed in contacts either have an outgoing call which is still active
+// or were called by the given start since the given time
+func FindDuplicateCallContacts(ctx context.Context, db Queryer, startID StartID, since time.Time, contactIDs []ContactID) ([]ContactID, error) {
+	var duplicates []ContactID
+	err := db.SelectContext(ctx, &duplicates, sqlSelectDuplicateCallContacts, pq.Array(contactIDs), startID, since)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting duplicate call contacts")
+	}
+	return duplicates, nil
+}
+
 // MarshalJSON marshals into JSON. 0 values will become null
 func (i CallID) MarshalJSON() ([]byte, error) {
 	return null.Int(i).MarshalJSON()
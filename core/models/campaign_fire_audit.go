@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// the skip reason of fires which were skipped before reasons were recorded
+const fireSkipReasonUnknown = "unknown"
+
+// EventFireAudit is a breakdown of the fires of a campaign event by whether they're pending, were fired, or were
+// skipped and why, so that it's possible to see why contacts didn't receive an event
+type EventFireAudit struct {
+	EventID   CampaignEventID   `json:"event_id"`
+	EventUUID CampaignEventUUID `json:"event_uuid"`
+	Pending   int               `json:"pending"`
+	Fired     int               `json:"fired"`
+	Skipped   map[string]int    `json:"skipped"`
+}
+
+type eventFireCount struct {
+	EventID    CampaignEventID `db:"event_id"`
+	Result     EventFireResult `db:"fired_result"`
+	SkipReason string          `db:"skip_reason"`
+	Count      int             `db:"count"`
+}
+
+const sqlSelectEventFireCounts = `
+  SELECT event_id, fired_result, COALESCE(skip_reason, '') AS skip_reason, count(*) AS count
+    FROM campaigns_eventfire
+   WHERE event_id = ANY($1) AND (fired IS NULL OR fired >= $2)
+GROUP BY event_id, fired_result, skip_reason`
+
+// AuditCampaignFires returns a breakdown of the fires of each event of the given campaign which are pending or were
+// fired or skipped since the given time
+func AuditCampaignFires(ctx context.Context, db Queryer, campaign *Campaign, since time.Time) ([]*EventFireAudit, error) {
+	audits := make([]*EventFireAudit, len(campaign.Events()))
+	byEvent := make(map[CampaignEventID]*EventFireAudit, len(campaign.Events()))
+	eventIDs := make([]CampaignEventID, len(campaign.Events()))
+
+	for i, e := range campaign.Events() {
+		audits[i] = &EventFireAudit{EventID: e.ID(), EventUUID: e.UUID(), Skipped: map[string]int{}}
+		byEvent[e.ID()] = audits[i]
+		eventIDs[i] = e.ID()
+	}
+
+	var counts []*eventFireCount
+	if err := db.SelectContext(ctx, &counts, sqlSelectEventFireCounts, pq.Array(eventIDs), since); err != nil {
+		return nil, errors.Wrap(err, "error counting event fires")
+	}
+
+	for _, c := range counts {
+		audit := byEvent[c.EventID]
+
+		switch c.Result {
+		case FireResultFired:
+			audit.Fired += c.Count
+		case FireResultSkipped:
+			reason := c.SkipReason
+			if reason == "" {
+				reason = fireSkipReasonUnknown
+			}
+			audit.Skipped[reason] += c.Count
+		default:
+			audit.Pending += c.Count
+		}
+	}
+
+	return audits, nil
+}
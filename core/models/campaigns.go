@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -11,8 +12,10 @@ import (
 	"github.com/nyaruka/gocommon/dbutil"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/trace"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -105,16 +108,17 @@ func (c *Campaign) Events() []*CampaignEvent { return c.c.Events }
 // CampaignEvent is our struct for an individual campaign event
 type CampaignEvent struct {
 	e struct {
-		ID            CampaignEventID   `json:"id"`
-		UUID          CampaignEventUUID `json:"uuid"`
-		EventType     string            `json:"event_type"`
-		StartMode     StartMode         `json:"start_mode"`
-		RelativeToID  FieldID           `json:"relative_to_id"`
-		RelativeToKey string            `json:"relative_to_key"`
-		Offset        int               `json:"offset"`
-		Unit          OffsetUnit        `json:"unit"`
-		DeliveryHour  int               `json:"delivery_hour"`
-		FlowID        FlowID            `json:"flow_id"`
+		ID             CampaignEventID   `json:"id"`
+		UUID           CampaignEventUUID `json:"uuid"`
+		EventType      string            `json:"event_type"`
+		StartMode      StartMode         `json:"start_mode"`
+		RelativeToID   FieldID           `json:"relative_to_id"`
+		RelativeToKey  string            `json:"relative_to_key"`
+		Offset         int               `json:"offset"`
+		Unit           OffsetUnit        `json:"unit"`
+		DeliveryHour   int               `json:"delivery_hour"`
+		FlowID         FlowID            `json:"flow_id"`
+		CallsPerMinute int               `json:"calls_per_minute"`
 	}
 
 	campaign *Campaign
@@ -256,6 +260,9 @@ func (e *CampaignEvent) Campaign() *Campaign { return e.campaign }
 // StartMode returns the start mode for this campaign event
 func (e *CampaignEvent) StartMode() StartMode { return e.e.StartMode }
 
+// CallsPerMinute returns the pace at which calls are made for this event if it's a voice flow, 0 meaning unpaced
+func (e *CampaignEvent) CallsPerMinute() int { return e.e.CallsPerMinute }
+
 // loadCampaigns loads all the campaigns for the passed in org
 func loadCampaigns(ctx context.Context, db sqlx.Queryer, orgID OrgID) ([]*Campaign, error) {
 	start := time.Now()
@@ -308,7 +315,8 @@ SELECT ROW_TO_JSON(r) FROM (SELECT
             e.offset as offset,
 			e.unit as unit,
 			e.delivery_hour as delivery_hour,
-			e.flow_id as flow_id
+			e.flow_id as flow_id,
+			COALESCE(e.calls_per_minute, 0) as calls_per_minute
 		FROM 
 			campaigns_campaignevent e
 			JOIN contacts_contactfield f on e.relative_to_id = f.id
@@ -330,32 +338,138 @@ WHERE
 ) r;
 `
 
+// CampaignEventMessage is a message type campaign event and its translations
+type CampaignEventMessage struct {
+	ID           CampaignEventID          `json:"id"`
+	UUID         CampaignEventUUID        `json:"uuid"`
+	Translations map[envs.Language]string `json:"translations"`
+}
+
+const selectCampaignEventMessagesSQL = `
+SELECT ROW_TO_JSON(r) FROM (SELECT
+	e.id as id,
+	e.uuid as uuid,
+	COALESCE(hstore_to_json(e.message), '{}'::json) as translations
+FROM
+	campaigns_campaignevent e
+	JOIN campaigns_campaign c ON c.id = e.campaign_id
+WHERE
+	c.org_id = $1 AND
+	c.id = $2 AND
+	c.is_active = TRUE AND
+	e.is_active = TRUE AND
+	e.event_type = 'M'
+ORDER BY
+	e.id
+) r;
+`
+
+// LoadCampaignEventMessages loads the message type events for the given campaign
+func LoadCampaignEventMessages(ctx context.Context, db Queryer, orgID OrgID, campaignID CampaignID) ([]*CampaignEventMessage, error) {
+	rows, err := db.QueryxContext(ctx, selectCampaignEventMessagesSQL, orgID, campaignID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error querying message events for campaign: %d", campaignID)
+	}
+	defer rows.Close()
+
+	events := make([]*CampaignEventMessage, 0, 5)
+	for rows.Next() {
+		e := &CampaignEventMessage{}
+		if err := dbutil.ScanJSON(rows, e); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshalling campaign event message")
+		}
+		events = append(events, e)
+	}
+
+	return events, nil
+}
+
+// MissingLanguages returns which of the given languages this message doesn't have a non-empty translation for
+func (e *CampaignEventMessage) MissingLanguages(langs []envs.Language) []envs.Language {
+	missing := make([]envs.Language, 0)
+	for _, lang := range langs {
+		if strings.TrimSpace(e.Translations[lang]) == "" {
+			missing = append(missing, lang)
+		}
+	}
+	return missing
+}
+
 // MarkEventsFired updates the passed in event fires with the fired time and result
 func MarkEventsFired(ctx context.Context, db Queryer, fires []*EventFire, fired time.Time, result EventFireResult) error {
+	return markEventsFired(ctx, db, fires, fired, result, NilFireSkipReason)
+}
+
+// MarkEventsSkipped updates the passed in event fires as skipped for the given reason
+func MarkEventsSkipped(ctx context.Context, db Queryer, fires []*EventFire, fired time.Time, reason FireSkipReason) error {
+	return markEventsFired(ctx, db, fires, fired, FireResultSkipped, reason)
+}
+
+func markEventsFired(ctx context.Context, db Queryer, fires []*EventFire, fired time.Time, result EventFireResult, reason FireSkipReason) error {
+	if len(fires) == 0 {
+		return nil
+	}
+
 	// set fired on all our values
-	updates := make([]interface{}, 0, len(fires))
-	for _, f := range fires {
+	ids := make([]FireID, len(fires))
+	for i, f := range fires {
 		f.Fired = &fired
 		f.FiredResult = result
-		updates = append(updates, f)
+		f.SkipReason = reason
+		ids[i] = f.FireID
 	}
 
-	return BulkQuery(ctx, "mark events fired", db, sqlMarkEventsFired, updates)
+	_, err := db.ExecContext(ctx, sqlMarkEventsFired, pq.Array(ids), fired, result, reason)
+	return errors.Wrap(err, "error marking events fired")
 }
 
 const sqlMarkEventsFired = `
-UPDATE 
-	campaigns_eventfire f
-SET
-	fired = r.fired::timestamp with time zone,
-	fired_result = r.fired_result::varchar
-FROM (
-	VALUES(:fire_id, :fired, :fired_result)
-) AS
-	r(fire_id, fired, fired_result)
-WHERE
-	f.id = r.fire_id::int
-`
+UPDATE campaigns_eventfire
+   SET fired = $2, fired_result = $3, skip_reason = $4
+ WHERE id = ANY($1)`
+
+// SkipIneligibleEventFires marks as skipped any of the passed in event fires whose contacts have since been deleted,
+// blocked, stopped or archived, and returns the remaining fires which are still eligible to be fired
+func SkipIneligibleEventFires(ctx context.Context, db Queryer, fires []*EventFire, fired time.Time) ([]*EventFire, error) {
+	if len(fires) == 0 {
+		return fires, nil
+	}
+
+	ids := make([]FireID, len(fires))
+	for i, f := range fires {
+		ids[i] = f.FireID
+	}
+
+	var skippedIDs []FireID
+	if err := db.SelectContext(ctx, &skippedIDs, sqlSkipIneligibleEventFires, pq.Array(ids), fired); err != nil {
+		return nil, errors.Wrap(err, "error skipping ineligible event fires")
+	}
+
+	skipped := make(map[FireID]bool, len(skippedIDs))
+	for _, id := range skippedIDs {
+		skipped[id] = true
+	}
+
+	eligible := make([]*EventFire, 0, len(fires)-len(skippedIDs))
+	for _, f := range fires {
+		if skipped[f.FireID] {
+			f.Fired = &fired
+			f.FiredResult = FireResultSkipped
+			f.SkipReason = FireSkipContactInactive
+		} else {
+			eligible = append(eligible, f)
+		}
+	}
+
+	return eligible, nil
+}
+
+const sqlSkipIneligibleEventFires = `
+   UPDATE campaigns_eventfire f
+      SET fired = $2, fired_result = 'S', skip_reason = 'contact_inactive'
+     FROM contacts_contact c
+    WHERE f.id = ANY($1) AND f.fired IS NULL AND c.id = f.contact_id AND (c.is_active = FALSE OR c.status != 'A')
+RETURNING f.id`
 
 // DeleteEventFires deletes all event fires passed in (used when an event has been marked as inactive)
 func DeleteEventFires(ctx context.Context, db Queryer, fires []*EventFire) error {
@@ -388,6 +502,25 @@ const (
 	FireResultSkipped = "S"
 )
 
+// FireSkipReason is why an event fire was skipped rather than fired
+type FireSkipReason = null.String
+
+const (
+	NilFireSkipReason = FireSkipReason("")
+
+	// FireSkipContactInactive means the contact was deleted, blocked, stopped or archived
+	FireSkipContactInactive = "contact_inactive"
+
+	// FireSkipLeftGroup means the contact left the campaign group
+	FireSkipLeftGroup = "left_group"
+
+	// FireSkipFieldChanged means the field the event is relative to changed so that the event no longer applied
+	FireSkipFieldChanged = "field_changed"
+
+	// FireSkipInFlow means the event skips contacts who are in a flow and the contact was
+	FireSkipInFlow = "in_flow"
+)
+
 // EventFire represents a single campaign event fire for an event and contact
 type EventFire struct {
 	FireID      FireID          `db:"fire_id"`
@@ -396,32 +529,16 @@ type EventFire struct {
 	Scheduled   time.Time       `db:"scheduled"`
 	Fired       *time.Time      `db:"fired"`
 	FiredResult EventFireResult `db:"fired_result"`
+	SkipReason  FireSkipReason  `db:"skip_reason"`
 }
 
 // LoadEventFires loads all the event fires with the passed in ids
 func LoadEventFires(ctx context.Context, db Queryer, ids []FireID) ([]*EventFire, error) {
 	start := time.Now()
 
-	q, vs, err := sqlx.In(sqlSelectEventFires, ids)
-	if err != nil {
-		return nil, errors.Wrap(err, "error rebinding campaign fire query")
-	}
-	q = db.Rebind(q)
-
-	rows, err := db.QueryxContext(ctx, q, vs...)
-	if err != nil {
-		return nil, errors.Wrap(err, "error querying event fires")
-	}
-	defer rows.Close()
-
 	fires := make([]*EventFire, 0, len(ids))
-	for rows.Next() {
-		fire := &EventFire{}
-		err := rows.StructScan(fire)
-		if err != nil {
-			return nil, errors.Wrap(err, "error scanning campaign fire")
-		}
-		fires = append(fires, fire)
+	if err := db.SelectContext(ctx, &fires, sqlSelectEventFires, pq.Array(ids)); err != nil {
+		return nil, errors.Wrap(err, "error querying event fires")
 	}
 
 	logrus.WithField("elapsed", time.Since(start)).WithField("count", len(fires)).Debug("event fires loaded")
@@ -432,7 +549,7 @@ func LoadEventFires(ctx context.Context, db Queryer, ids []FireID) ([]*EventFire
 const sqlSelectEventFires = `
 SELECT f.id as fire_id, f.event_id as event_id, f.contact_id as contact_id, f.scheduled as scheduled, f.fired as fired
   FROM campaigns_eventfire f
- WHERE f.id IN(?) AND f.fired IS NULL`
+ WHERE f.id = ANY($1) AND f.fired IS NULL`
 
 // DeleteUnfiredEventFires removes event fires for the passed in event and contact
 func DeleteUnfiredEventFires(ctx context.Context, tx Queryer, removes []*FireDelete) error {
@@ -471,6 +588,37 @@ type FireDelete struct {
 	EventID   CampaignEventID `db:"event_id"`
 }
 
+// FireSkip is an unfired event fire for a contact which should be skipped for the given reason
+type FireSkip struct {
+	ContactID ContactID
+	EventID   CampaignEventID
+	Reason    FireSkipReason
+}
+
+// SkipUnfiredEventFires marks the unfired event fires for the passed in events and contacts as skipped, recording why
+func SkipUnfiredEventFires(ctx context.Context, tx Queryer, skips []*FireSkip) error {
+	if len(skips) == 0 {
+		return nil
+	}
+
+	contactIDs := make([]ContactID, len(skips))
+	eventIDs := make([]CampaignEventID, len(skips))
+	reasons := make([]string, len(skips))
+	for i, s := range skips {
+		contactIDs[i] = s.ContactID
+		eventIDs[i] = s.EventID
+		reasons[i] = string(s.Reason)
+	}
+
+	return Exec(ctx, "skipping campaign event fires", tx, sqlSkipUnfiredFires, pq.Array(contactIDs), pq.Array(eventIDs), pq.Array(reasons))
+}
+
+const sqlSkipUnfiredFires = `
+UPDATE campaigns_eventfire f
+   SET fired = NOW(), fired_result = 'S', skip_reason = s.reason
+  FROM unnest($1::int[], $2::int[], $3::varchar[]) AS s(contact_id, event_id, reason)
+ WHERE f.contact_id = s.contact_id AND f.event_id = s.event_id AND f.fired IS NULL`
+
 // DeleteUnfiredContactEvents deletes all unfired event fires for the passed in contacts
 func DeleteUnfiredContactEvents(ctx context.Context, tx Queryer, contactIDs []ContactID) error {
 	_, err := tx.ExecContext(ctx, `DELETE FROM campaigns_eventfire WHERE contact_id = ANY($1) AND fired IS NULL`, pq.Array(contactIDs))
@@ -481,8 +629,8 @@ func DeleteUnfiredContactEvents(ctx context.Context, tx Queryer, contactIDs []Co
 }
 
 const sqlInsertEventFires = `
-INSERT INTO campaigns_eventfire(contact_id,  event_id,  scheduled)
-                         VALUES(:contact_id, :event_id, :scheduled)
+INSERT INTO campaigns_eventfire(contact_id,  event_id,  scheduled,  trace_id)
+                         VALUES(:contact_id, :event_id, :scheduled, :trace_id)
 ON CONFLICT DO NOTHING
 `
 
@@ -490,6 +638,7 @@ type FireAdd struct {
 	ContactID ContactID       `db:"contact_id"`
 	EventID   CampaignEventID `db:"event_id"`
 	Scheduled time.Time       `db:"scheduled"`
+	TraceID   trace.ID        `db:"trace_id"`
 }
 
 // AddEventFires adds the passed in event fires to our db
@@ -498,9 +647,14 @@ func AddEventFires(ctx context.Context, tx Queryer, adds []*FireAdd) error {
 		return nil
 	}
 
+	traceID := trace.FromContext(ctx)
+
 	// convert to list of interfaces
 	is := make([]interface{}, len(adds))
 	for i := range adds {
+		if adds[i].TraceID == trace.NilID {
+			adds[i].TraceID = traceID
+		}
 		is[i] = adds[i]
 	}
 	return BulkQueryBatches(ctx, "adding campaign event fires", tx, sqlInsertEventFires, 1000, is)
@@ -526,6 +680,22 @@ func DeleteUnfiredEventsForGroupRemoval(ctx context.Context, tx Queryer, oa *Org
 	return DeleteUnfiredEventFires(ctx, tx, fds)
 }
 
+// SkipUnfiredEventsForGroupRemoval skips any unfired events for all campaigns that are based on the passed in group id
+// for all the passed in contacts, as they've left the group.
+func SkipUnfiredEventsForGroupRemoval(ctx context.Context, tx Queryer, oa *OrgAssets, contactIDs []ContactID, groupID GroupID) error {
+	skips := make([]*FireSkip, 0, 10)
+
+	for _, c := range oa.CampaignByGroupID(groupID) {
+		for _, e := range c.Events() {
+			for _, cid := range contactIDs {
+				skips = append(skips, &FireSkip{ContactID: cid, EventID: e.ID(), Reason: FireSkipLeftGroup})
+			}
+		}
+	}
+
+	return SkipUnfiredEventFires(ctx, tx, skips)
+}
+
 // AddCampaignEventsForGroupAddition first removes the passed in contacts from any events that group change may effect, then recreates
 // the campaign events they qualify for.
 func AddCampaignEventsForGroupAddition(ctx context.Context, tx Queryer, oa *OrgAssets, contacts []*flows.Contact, groupID GroupID) error {
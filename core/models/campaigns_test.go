@@ -114,3 +114,96 @@ func TestAddEventFires(t *testing.T) {
 	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1 AND event_id = $2`, testdata.Cathy.ID, testdata.RemindersEvent1.ID).Returns(2)
 	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1`, testdata.Bob.ID).Returns(2)
 }
+
+func TestEventFireProcessing(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	now := time.Now()
+	fire1ID := testdata.InsertEventFire(db, testdata.Cathy, testdata.RemindersEvent1, now)
+	fire2ID := testdata.InsertEventFire(db, testdata.Bob, testdata.RemindersEvent1, now)
+	fire3ID := testdata.InsertEventFire(db, testdata.George, testdata.RemindersEvent1, now)
+	fire4ID := testdata.InsertEventFire(db, testdata.Alexandria, testdata.RemindersEvent1, now)
+
+	// bob is stopped and george is deleted since their fires were scheduled
+	db.MustExec(`UPDATE contacts_contact SET status = 'S' WHERE id = $1`, testdata.Bob.ID)
+	db.MustExec(`UPDATE contacts_contact SET is_active = FALSE WHERE id = $1`, testdata.George.ID)
+
+	fires, err := models.LoadEventFires(ctx, db, []models.FireID{fire1ID, fire2ID, fire3ID, fire4ID})
+	require.NoError(t, err)
+	require.Len(t, fires, 4)
+
+	eligible, err := models.SkipIneligibleEventFires(ctx, db, fires, now)
+	require.NoError(t, err)
+	require.Len(t, eligible, 2)
+	assert.ElementsMatch(t, []models.ContactID{testdata.Cathy.ID, testdata.Alexandria.ID}, []models.ContactID{eligible[0].ContactID, eligible[1].ContactID})
+
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE fired IS NOT NULL AND fired_result = 'S'`).Returns(2)
+
+	err = models.MarkEventsFired(ctx, db, eligible, now, models.FireResultFired)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE fired IS NOT NULL AND fired_result = 'F'`).Returns(2)
+
+	// fired fires are no longer loaded
+	fires, err = models.LoadEventFires(ctx, db, []models.FireID{fire1ID, fire2ID, fire3ID, fire4ID})
+	require.NoError(t, err)
+	assert.Len(t, fires, 0)
+}
+
+func TestEventFireSkipReasons(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	now := time.Now()
+	testdata.InsertEventFire(db, testdata.Cathy, testdata.RemindersEvent1, now)
+	testdata.InsertEventFire(db, testdata.Bob, testdata.RemindersEvent1, now)
+	testdata.InsertEventFire(db, testdata.George, testdata.RemindersEvent1, now)
+	testdata.InsertEventFire(db, testdata.Alexandria, testdata.RemindersEvent2, now)
+	testdata.InsertEventFire(db, testdata.Cathy, testdata.RemindersEvent3, now)
+
+	err := models.SkipUnfiredEventFires(ctx, db, []*models.FireSkip{
+		{ContactID: testdata.Cathy.ID, EventID: testdata.RemindersEvent1.ID, Reason: models.FireSkipLeftGroup},
+		{ContactID: testdata.Bob.ID, EventID: testdata.RemindersEvent1.ID, Reason: models.FireSkipFieldChanged},
+		{ContactID: testdata.Bob.ID, EventID: testdata.RemindersEvent2.ID, Reason: models.FireSkipFieldChanged}, // no such fire
+	})
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT skip_reason FROM campaigns_eventfire WHERE contact_id = $1 AND event_id = $2 AND fired_result = 'S'`, testdata.Cathy.ID, testdata.RemindersEvent1.ID).Returns("left_group")
+	assertdb.Query(t, db, `SELECT skip_reason FROM campaigns_eventfire WHERE contact_id = $1 AND event_id = $2 AND fired_result = 'S'`, testdata.Bob.ID, testdata.RemindersEvent1.ID).Returns("field_changed")
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE fired IS NULL`).Returns(3)
+
+	db.MustExec(`UPDATE campaigns_eventfire SET fired = NOW(), fired_result = 'F' WHERE contact_id = $1`, testdata.Alexandria.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshCampaigns)
+	require.NoError(t, err)
+
+	audits, err := models.AuditCampaignFires(ctx, db, oa.CampaignByID(testdata.RemindersCampaign.ID), now.Add(-time.Hour))
+	require.NoError(t, err)
+
+	byEvent := make(map[models.CampaignEventID]*models.EventFireAudit, len(audits))
+	for _, a := range audits {
+		byEvent[a.EventID] = a
+	}
+
+	assert.Equal(t, &models.EventFireAudit{
+		EventID:   testdata.RemindersEvent1.ID,
+		EventUUID: testdata.RemindersEvent1.UUID,
+		Pending:   1,
+		Skipped:   map[string]int{"left_group": 1, "field_changed": 1},
+	}, byEvent[testdata.RemindersEvent1.ID])
+	assert.Equal(t, &models.EventFireAudit{
+		EventID:   testdata.RemindersEvent2.ID,
+		EventUUID: testdata.RemindersEvent2.UUID,
+		Fired:     1,
+		Skipped:   map[string]int{},
+	}, byEvent[testdata.RemindersEvent2.ID])
+	assert.Equal(t, &models.EventFireAudit{
+		EventID:   testdata.RemindersEvent3.ID,
+		EventUUID: testdata.RemindersEvent3.UUID,
+		Pending:   1,
+		Skipped:   map[string]int{},
+	}, byEvent[testdata.RemindersEvent3.ID])
+}
@@ -19,6 +19,7 @@ const (
 	MOMissEventType          = ChannelEventType("mo_miss")
 	MOCallEventType          = ChannelEventType("mo_call")
 	StopContactEventType     = ChannelEventType("stop_contact")
+	LinkClickedEventType     = ChannelEventType("link_clicked")
 )
 
 // ContactSeenEvents are those which count as the contact having been seen
@@ -28,6 +29,7 @@ var ContactSeenEvents = map[ChannelEventType]bool{
 	MOMissEventType:          true,
 	MOCallEventType:          true,
 	StopContactEventType:     true,
+	LinkClickedEventType:     true,
 }
 
 // ChannelEvent represents an event that occurred associated with a channel, such as a referral, missed call, etc..
@@ -50,6 +52,9 @@ type ChannelEvent struct {
 	}
 }
 
+// ChannelEventExtraFlowUUID is the key of the extra value which routes an incoming call to a specific flow
+const ChannelEventExtraFlowUUID = "flow_uuid"
+
 func (e *ChannelEvent) ID() ChannelEventID    { return e.e.ID }
 func (e *ChannelEvent) ContactID() ContactID  { return e.e.ContactID }
 func (e *ChannelEvent) URNID() URNID          { return e.e.URNID }
@@ -27,6 +27,8 @@ const (
 	ChannelLogTypeIVRCallback = "ivr_callback"
 	ChannelLogTypeIVRStatus   = "ivr_status"
 	ChannelLogTypeIVRHangup   = "ivr_hangup"
+
+	ChannelLogTypeTemplatesSync = "templates_sync"
 )
 
 type ChannelError struct {
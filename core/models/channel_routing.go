@@ -0,0 +1,167 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// ChannelRoutingPolicy is how an org chooses between a contact's URNs when sending them a message
+type ChannelRoutingPolicy string
+
+const (
+	ChannelRoutingMostRecent = ChannelRoutingPolicy("most_recent")
+	ChannelRoutingCheapest   = ChannelRoutingPolicy("cheapest")
+)
+
+// ChannelRouting is an org's configuration for choosing which of a contact's URNs, and so which channel, messages are
+// sent to. URNs on channels matching the contact's value of the preference field, which can be a channel UUID, channel
+// name or URN scheme, come first. Then URNs are ordered by the policy, either by the channel the contact most recently
+// had a conversation on or by the cost per message configured on the channel. Otherwise URN priority is kept.
+//
+//	{
+//	  "policy": "cheapest",
+//	  "preference_field": "preferred_channel"
+//	}
+type ChannelRouting struct {
+	Policy          ChannelRoutingPolicy `json:"policy"           validate:"omitempty,eq=most_recent|eq=cheapest"`
+	PreferenceField string               `json:"preference_field"`
+}
+
+// ReadChannelRouting reads and validates channel routing config from the given JSON
+func ReadChannelRouting(data []byte) (*ChannelRouting, error) {
+	r := &ChannelRouting{}
+	if err := utils.UnmarshalAndValidate(data, r); err != nil {
+		return nil, err
+	}
+	if r.Policy == "" && r.PreferenceField == "" {
+		return nil, errors.New("one of policy or preference_field is required")
+	}
+	return r, nil
+}
+
+// reads the channel routing config from the given org config value
+func readChannelRoutingConfig(v interface{}) (*ChannelRouting, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadChannelRouting(data)
+}
+
+const sqlSelectContactChannelsLastUsed = `
+  SELECT contact_id, channel_id, MAX(last_msg_on) AS last_used_on
+    FROM msgs_conversation
+   WHERE org_id = $1 AND contact_id = ANY($2)
+GROUP BY contact_id, channel_id`
+
+// loads when each of the given contacts last had a conversation on each channel
+func loadContactChannelsLastUsed(ctx context.Context, db Queryer, orgID OrgID, ids []ContactID) (map[ContactID]map[ChannelID]time.Time, error) {
+	rows := make([]*struct {
+		ContactID  ContactID `db:"contact_id"`
+		ChannelID  ChannelID `db:"channel_id"`
+		LastUsedOn time.Time `db:"last_used_on"`
+	}, 0)
+	if err := db.SelectContext(ctx, &rows, sqlSelectContactChannelsLastUsed, orgID, pq.Array(ids)); err != nil {
+		return nil, errors.Wrap(err, "error loading contact channels last used")
+	}
+
+	lastUsed := make(map[ContactID]map[ChannelID]time.Time)
+	for _, r := range rows {
+		if lastUsed[r.ContactID] == nil {
+			lastUsed[r.ContactID] = make(map[ChannelID]time.Time)
+		}
+		lastUsed[r.ContactID][r.ChannelID] = r.LastUsedOn
+	}
+	return lastUsed, nil
+}
+
+// sorts the given URNs, which are in priority order, according to this routing config
+func (r *ChannelRouting) sortURNs(oa *OrgAssets, contactURNs []ContactURN, fields map[string]*flows.Value, lastUsed map[ChannelID]time.Time) {
+	// the channel each URN would be sent on
+	channels := make(map[URNID]*Channel, len(contactURNs))
+	for i := range contactURNs {
+		channels[contactURNs[i].ID] = oa.sendChannelForURN(&contactURNs[i])
+	}
+
+	preference := ""
+	if r.PreferenceField != "" && fields[r.PreferenceField] != nil {
+		preference = strings.ToLower(strings.TrimSpace(fields[r.PreferenceField].Text.Native()))
+	}
+
+	isPreferred := func(u ContactURN) bool {
+		if preference == "" {
+			return false
+		}
+		if strings.ToLower(u.Scheme) == preference {
+			return true
+		}
+		ch := channels[u.ID]
+		return ch != nil && (strings.ToLower(string(ch.UUID())) == preference || strings.ToLower(ch.Name()) == preference)
+	}
+
+	sort.SliceStable(contactURNs, func(i, j int) bool {
+		ui, uj := contactURNs[i], contactURNs[j]
+
+		if pi, pj := isPreferred(ui), isPreferred(uj); pi != pj {
+			return pi
+		}
+
+		chi, chj := channels[ui.ID], channels[uj.ID]
+
+		switch r.Policy {
+		case ChannelRoutingMostRecent:
+			var ti, tj time.Time
+			if chi != nil {
+				ti = lastUsed[chi.ID()]
+			}
+			if chj != nil {
+				tj = lastUsed[chj.ID()]
+			}
+			return ti.After(tj)
+
+		case ChannelRoutingCheapest:
+			var ci, cj *decimal.Decimal
+			if chi != nil {
+				ci = chi.MsgCost()
+			}
+			if chj != nil {
+				cj = chj.MsgCost()
+			}
+
+			// channels without a cost come after those with one
+			if ci == nil || cj == nil {
+				return ci != nil && cj == nil
+			}
+			return ci.LessThan(*cj)
+		}
+
+		return false
+	})
+}
+
+// gets the channel that messages to the given URN would be sent on, taking into account any channel affinity
+func (a *OrgAssets) sendChannelForURN(u *ContactURN) *Channel {
+	urn, err := u.AsURN(a)
+	if err != nil {
+		return nil
+	}
+	flowURN, err := flows.ParseRawURN(a.SessionAssets().Channels(), urn, assets.IgnoreMissing)
+	if err != nil {
+		return nil
+	}
+	ch := a.SessionAssets().Channels().GetForURN(flowURN, assets.ChannelRoleSend)
+	if ch == nil {
+		return nil
+	}
+	return a.ChannelByUUID(ch.UUID())
+}
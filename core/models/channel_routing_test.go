@@ -0,0 +1,75 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadChannelRouting(t *testing.T) {
+	r, err := models.ReadChannelRouting([]byte(`{"policy": "cheapest", "preference_field": "preferred_channel"}`))
+	require.NoError(t, err)
+	assert.Equal(t, models.ChannelRoutingCheapest, r.Policy)
+	assert.Equal(t, "preferred_channel", r.PreferenceField)
+
+	r, err = models.ReadChannelRouting([]byte(`{"preference_field": "preferred_channel"}`))
+	require.NoError(t, err)
+	assert.Equal(t, models.ChannelRoutingPolicy(""), r.Policy)
+
+	_, err = models.ReadChannelRouting([]byte(`{}`))
+	assert.EqualError(t, err, "one of policy or preference_field is required")
+
+	_, err = models.ReadChannelRouting([]byte(`{"policy": "random"}`))
+	assert.EqualError(t, err, "field 'policy' failed tag 'omitempty,eq=most_recent|eq=cheapest'")
+}
+
+func TestChannelRouting(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	telegram := testdata.InsertChannel(db, testdata.Org1, "TG", "Telegram", []string{"telegram"}, "SR", map[string]interface{}{"msg_cost": 0.01})
+	testdata.InsertContactURN(db, testdata.Org1, testdata.Cathy, urns.URN("telegram:12345"), 999)
+
+	db.MustExec(`INSERT INTO msgs_conversation(org_id, contact_id, channel_id, initiated_by, started_on, last_msg_on, msgs_in, msgs_out) VALUES($1, $2, $3, 'I', NOW() - INTERVAL '2 days', NOW() - INTERVAL '2 days', 1, 0)`, testdata.Org1.ID, testdata.Cathy.ID, testdata.TwilioChannel.ID)
+	db.MustExec(`INSERT INTO msgs_conversation(org_id, contact_id, channel_id, initiated_by, started_on, last_msg_on, msgs_in, msgs_out) VALUES($1, $2, $3, 'I', NOW() - INTERVAL '1 day', NOW() - INTERVAL '1 day', 1, 0)`, testdata.Org1.ID, testdata.Cathy.ID, telegram.ID)
+
+	assertURNs := func(config string, expected []urns.URN) {
+		db.MustExec(`UPDATE orgs_org SET config = $2::jsonb WHERE id = $1`, testdata.Org1.ID, config)
+
+		oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg|models.RefreshChannels)
+		require.NoError(t, err)
+
+		contacts, err := models.LoadContacts(ctx, db, oa, []models.ContactID{testdata.Cathy.ID})
+		require.NoError(t, err)
+
+		actual := make([]urns.URN, len(contacts[0].URNs()))
+		for i, u := range contacts[0].URNs() {
+			actual[i] = u.Identity()
+		}
+		assert.Equal(t, expected, actual, "URN order mismatch for config %s", config)
+	}
+
+	// no routing config so URNs are in priority order
+	assertURNs(`{}`, []urns.URN{"tel:+16055741111", "telegram:12345"})
+
+	// cheapest puts telegram first as it's the only channel with a cost
+	assertURNs(`{"channel_routing": {"policy": "cheapest"}}`, []urns.URN{"telegram:12345", "tel:+16055741111"})
+
+	// most recent puts telegram first as that's where the last conversation was
+	assertURNs(`{"channel_routing": {"policy": "most_recent"}}`, []urns.URN{"telegram:12345", "tel:+16055741111"})
+
+	// contact preference of a channel beats policy
+	db.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, jsonb_build_object('text', $3::text)) WHERE id = $1`, testdata.Cathy.ID, testdata.GenderField.UUID, testdata.TwilioChannel.UUID)
+	assertURNs(`{"channel_routing": {"policy": "cheapest", "preference_field": "gender"}}`, []urns.URN{"tel:+16055741111", "telegram:12345"})
+
+	// preference can also be a URN scheme
+	db.MustExec(`UPDATE contacts_contact SET fields = fields || jsonb_build_object($2::text, '{"text": "telegram"}'::jsonb) WHERE id = $1`, testdata.Cathy.ID, testdata.GenderField.UUID)
+	assertURNs(`{"channel_routing": {"preference_field": "gender"}}`, []urns.URN{"telegram:12345", "tel:+16055741111"})
+}
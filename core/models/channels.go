@@ -13,6 +13,7 @@ import (
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,7 +28,13 @@ type ChannelType string
 
 // channel type constants
 const (
-	ChannelTypeAndroid = ChannelType("A")
+	ChannelTypeAndroid   = ChannelType("A")
+	ChannelTypeEmail     = ChannelType("EM")
+	ChannelTypeWhatsApp  = ChannelType("WA")
+	ChannelTypeDialog360 = ChannelType("D3")
+	ChannelTypeFacebook  = ChannelType("FBA")
+	ChannelTypeInstagram = ChannelType("IG")
+	ChannelTypeTelegram  = ChannelType("TG")
 )
 
 // config key constants
@@ -35,6 +42,17 @@ const (
 	ChannelConfigCallbackDomain      = "callback_domain"
 	ChannelConfigMaxConcurrentEvents = "max_concurrent_events"
 	ChannelConfigFCMID               = "FCM_ID"
+	ChannelConfigEmailSubject        = "subject"
+	ChannelConfigEmailSecret         = "secret"
+	ChannelConfigRCS                 = "rcs"
+	ChannelConfigPreDialCheck        = "pre_dial_check"
+	ChannelConfigMaxCallDuration     = "max_call_duration"
+	ChannelConfigCallCostPerMinute   = "call_cost_per_minute"
+	ChannelConfigMsgCost             = "msg_cost"
+	ChannelConfigStatusSecret        = "status_secret"
+	ChannelConfigTransliterate       = "transliterate"
+	ChannelConfigEmoji               = "emoji"
+	ChannelConfigMaxLength           = "max_length"
 )
 
 // Channel is the mailroom struct that represents channels
@@ -118,6 +136,47 @@ func (c *Channel) ConfigValue(key string, def string) string {
 	return def
 }
 
+// CallCost returns the cost of a call of the given duration in seconds on this channel, charged per started minute at
+// the rate configured on the channel, or nil if the channel has no rate
+func (c *Channel) CallCost(duration int) *decimal.Decimal {
+	var rate decimal.Decimal
+
+	// can't use ConfigValue here as it rounds numbers to integers
+	switch v := c.c.Config[ChannelConfigCallCostPerMinute].(type) {
+	case float64:
+		rate = decimal.NewFromFloat(v)
+	case string:
+		var err error
+		if rate, err = decimal.NewFromString(v); err != nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	minutes := int64((duration + 59) / 60)
+	cost := rate.Mul(decimal.NewFromInt(minutes))
+	return &cost
+}
+
+// MsgCost returns the cost of sending a message on this channel as configured on the channel, or nil if the channel has
+// no cost
+func (c *Channel) MsgCost() *decimal.Decimal {
+	// can't use ConfigValue here as it rounds numbers to integers
+	switch v := c.c.Config[ChannelConfigMsgCost].(type) {
+	case float64:
+		cost := decimal.NewFromFloat(v)
+		return &cost
+	case string:
+		cost, err := decimal.NewFromString(v)
+		if err != nil {
+			return nil
+		}
+		return &cost
+	}
+	return nil
+}
+
 // ChannelReference return a channel reference for this channel
 func (c *Channel) ChannelReference() *assets.ChannelReference {
 	return assets.NewChannelReference(c.UUID(), c.Name())
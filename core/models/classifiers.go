@@ -3,6 +3,7 @@ package models
 import (
 	"context"
 	"database/sql/driver"
+	"net/http"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -15,6 +16,8 @@ import (
 	"github.com/nyaruka/goflow/services/classification/wit"
 	"github.com/nyaruka/mailroom/core/goflow"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/services/classification/openai"
+	"github.com/nyaruka/mailroom/services/classification/rasa"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -31,6 +34,8 @@ const (
 	ClassifierTypeWit    = "wit"
 	ClassifierTypeLuis   = "luis"
 	ClassifierTypeBothub = "bothub"
+	ClassifierTypeRasa   = "rasa"
+	ClassifierTypeOpenAI = "openai"
 )
 
 // classifier config key constants
@@ -46,8 +51,22 @@ const (
 	LuisConfigPredictionEndpoint = "prediction_endpoint"
 	LuisConfigPredictionKey      = "prediction_key"
 	LuisConfigSlot               = "slot"
+
+	// Rasa config options
+	RasaConfigEndpoint    = "endpoint"
+	RasaConfigAccessToken = "access_token"
+
+	// OpenAI config options
+	OpenAIConfigBaseURL = "base_url"
+	OpenAIConfigAPIKey  = "api_key"
+	OpenAIConfigModel   = "model"
+	OpenAIConfigMode    = "mode"
+	OpenAIConfigPrompt  = "prompt"
 )
 
+// model used by OpenAI classifiers which don't specify one
+const openAIDefaultModel = "gpt-3.5-turbo"
+
 // Register a classification service factory with the engine
 func init() {
 	goflow.RegisterClassificationServiceFactory(classificationServiceFactory)
@@ -121,6 +140,37 @@ func (c *Classifier) AsService(cfg *runtime.Config, classifier *flows.Classifier
 		}
 		return bothub.NewService(httpClient, httpRetries, classifier, accessToken), nil
 
+	case ClassifierTypeRasa:
+		endpoint := c.c.Config[RasaConfigEndpoint]
+		if endpoint == "" {
+			return nil, errors.Errorf("missing %s for Rasa classifier: %s", RasaConfigEndpoint, c.UUID())
+		}
+		return rasa.NewService(httpClient, httpRetries, httpAccess, classifier, endpoint, c.c.Config[RasaConfigAccessToken]), nil
+
+	case ClassifierTypeOpenAI:
+		apiKey := c.c.Config[OpenAIConfigAPIKey]
+		if apiKey == "" {
+			return nil, errors.Errorf("missing %s for OpenAI classifier: %s", OpenAIConfigAPIKey, c.UUID())
+		}
+
+		options := &openai.Options{
+			Model:     c.c.Config[OpenAIConfigModel],
+			Mode:      c.c.Config[OpenAIConfigMode],
+			Prompt:    c.c.Config[OpenAIConfigPrompt],
+			MaxTokens: cfg.LLMMaxTokens,
+		}
+		if options.Model == "" {
+			options.Model = openAIDefaultModel
+		}
+		if options.Mode != openai.ModeGenerate {
+			options.Mode = openai.ModeClassify
+		}
+
+		// LLMs can be a lot slower than webhooks so they get their own timeout
+		llmClient := &http.Client{Transport: httpClient.Transport, Timeout: time.Duration(cfg.LLMTimeout) * time.Millisecond}
+
+		return openai.NewService(llmClient, httpRetries, httpAccess, classifier, c.c.Config[OpenAIConfigBaseURL], apiKey, cfg.LLMMaxBodyBytes, options), nil
+
 	default:
 		return nil, errors.Errorf("unknown classifier type '%s' for classifier: %s", c.Type(), c.UUID())
 	}
@@ -206,3 +256,23 @@ func (i ClassifierID) Value() (driver.Value, error) {
 func (i *ClassifierID) Scan(value interface{}) error {
 	return null.ScanInt(value, (*null.Int)(i))
 }
+
+// LLMDailyCountTokens is the type of daily count used to meter the tokens used by LLM classifiers
+const LLMDailyCountTokens = "T"
+
+// LLMUsage is the number of tokens used by a call to an LLM classifier
+type LLMUsage struct {
+	Classifier *Classifier
+	Tokens     int
+}
+
+// InsertLLMUsage records the given LLM usage as daily counts for the org and each classifier
+func InsertLLMUsage(ctx context.Context, tx Queryer, oa *OrgAssets, usages []*LLMUsage) error {
+	counts := make(map[string]int, len(usages)+1)
+	for _, u := range usages {
+		counts[scopeOrg(oa)] += u.Tokens
+		counts[scopeClassifier(u.Classifier)] += u.Tokens
+	}
+
+	return insertDailyCounts(ctx, tx, "classifiers_llmdailycount", LLMDailyCountTokens, oa.Org().Timezone(), counts)
+}
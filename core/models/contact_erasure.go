@@ -0,0 +1,70 @@
+package models
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const configContactErasure = "contact_erasure"
+
+// ContactErasureMode is how an org wants contacts erased for right-to-erasure requests
+type ContactErasureMode string
+
+const (
+	// ContactErasureDelete means contacts are hard deleted by RapidPro
+	ContactErasureDelete = ContactErasureMode("delete")
+
+	// ContactErasureAnonymize means contacts are kept but their personal data is replaced with placeholders
+	ContactErasureAnonymize = ContactErasureMode("anonymize")
+)
+
+// ContactErasure returns how this org wants contacts erased
+func (o *Org) ContactErasure() ContactErasureMode {
+	if ContactErasureMode(o.ConfigValue(configContactErasure, "")) == ContactErasureAnonymize {
+		return ContactErasureAnonymize
+	}
+	return ContactErasureDelete
+}
+
+// placeholders are hashes of the contact UUID and what is being replaced, never of the personal data itself, so they
+// can't be reversed
+const sqlAnonymizeContacts = `
+UPDATE contacts_contact c
+   SET name = CASE WHEN c.name IS NULL OR c.name = '' THEN c.name ELSE 'anon-' || left(md5(c.uuid || ':name'), 16) END,
+       fields = COALESCE((
+           SELECT jsonb_object_agg(f.key, jsonb_build_object('text', 'anon-' || left(md5(c.uuid || ':field:' || f.key), 16)))
+             FROM jsonb_each(c.fields) f
+       ), '{}'::jsonb),
+       modified_on = NOW(),
+       modified_by_id = $3
+ WHERE c.org_id = $1 AND c.id = ANY($2) AND c.is_active = TRUE`
+
+// URNs are detached as well as scrubbed, since the placeholder paths aren't valid for most schemes
+const sqlAnonymizeContactURNs = `
+UPDATE contacts_contacturn u
+   SET path = 'anon-' || left(md5(c.uuid || ':urn:' || u.id), 16),
+       identity = u.scheme || ':anon-' || left(md5(c.uuid || ':urn:' || u.id), 16),
+       display = NULL,
+       auth = NULL,
+       channel_id = NULL,
+       contact_id = NULL
+  FROM contacts_contact c
+ WHERE u.contact_id = c.id AND c.org_id = $1 AND c.id = ANY($2) AND c.is_active = TRUE`
+
+// AnonymizeContacts erases the personal data of the given contacts by replacing their names, field values and URN paths
+// with hashed placeholders. Contacts themselves are kept along with their messages, runs and group memberships so that
+// aggregate analytics are unchanged. Message bodies and run results are left to the org's retention policy.
+func AnonymizeContacts(ctx context.Context, db Queryer, orgID OrgID, userID UserID, contactIDs []ContactID) error {
+	for _, idBatch := range chunkSlice(contactIDs, 100) {
+		// URNs first as they're scrubbed with the contact UUID which doesn't change
+		if _, err := db.ExecContext(ctx, sqlAnonymizeContactURNs, orgID, pq.Array(idBatch)); err != nil {
+			return errors.Wrap(err, "error anonymizing contact URNs")
+		}
+		if _, err := db.ExecContext(ctx, sqlAnonymizeContacts, orgID, pq.Array(idBatch), userID); err != nil {
+			return errors.Wrap(err, "error anonymizing contacts")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+// event types are snake case slugs like order_shipped
+var contactEventTypeRegex = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+func init() {
+	utils.RegisterValidatorTag("contact_event_type", func(fl validator.FieldLevel) bool {
+		return contactEventTypeRegex.MatchString(fl.Field().String())
+	}, func(validator.FieldError) string { return "is not a valid event type" })
+}
+
+// ContactEventID is our type for contact event ids
+type ContactEventID int
+
+// ContactEvent is an event pushed onto a contact's history by an external system, e.g. an order being shipped. The
+// type says what happened and the payload holds whatever details the external system wants to record with it.
+type ContactEvent struct {
+	ID         ContactEventID `db:"id"          json:"id"`
+	ContactID  ContactID      `db:"contact_id"  json:"contact_id"`
+	Type       string         `db:"event_type"  json:"type"`
+	Source     string         `db:"source"      json:"source"`
+	Payload    null.Map       `db:"payload"     json:"payload"`
+	OccurredOn time.Time      `db:"occurred_on" json:"occurred_on"`
+	CreatedOn  time.Time      `db:"created_on"  json:"created_on"`
+}
+
+const sqlInsertContactEvent = `
+INSERT INTO contacts_contactevent(contact_id, event_type, source, payload, occurred_on, created_on)
+     SELECT c.id, $3, $4, $5, COALESCE($6, NOW()), NOW()
+       FROM contacts_contact c
+      WHERE c.id = $2 AND c.org_id = $1 AND c.is_active = TRUE
+  RETURNING id, contact_id, event_type, source, payload, occurred_on, created_on`
+
+// InsertContactEvent adds an event to the history of the given contact, returning nil if the contact doesn't exist in
+// the given org. If occurredOn is nil the event is recorded as happening now.
+func InsertContactEvent(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID, eventType, source string, payload map[string]interface{}, occurredOn *time.Time) (*ContactEvent, error) {
+	rows, err := db.QueryxContext(ctx, sqlInsertContactEvent, orgID, contactID, eventType, source, null.NewMap(payload), occurredOn)
+	if err != nil {
+		return nil, errors.Wrap(err, "error inserting contact event")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	event := &ContactEvent{}
+	if err := rows.StructScan(event); err != nil {
+		return nil, errors.Wrap(err, "error scanning contact event")
+	}
+	return event, nil
+}
+
+const sqlSelectContactEvents = `
+  SELECT e.id, e.contact_id, e.event_type, e.source, e.payload, e.occurred_on, e.created_on
+    FROM contacts_contactevent e
+    JOIN contacts_contact c ON c.id = e.contact_id
+   WHERE e.contact_id = $2 AND c.org_id = $1 AND ($3::timestamptz IS NULL OR e.occurred_on < $3)
+ORDER BY e.occurred_on DESC, e.id DESC
+   LIMIT $4`
+
+// LoadContactEvents loads the most recent events on the given contact which occurred before the given time, or the
+// most recent events of all if before is nil, newest first
+func LoadContactEvents(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID, before *time.Time, limit int) ([]*ContactEvent, error) {
+	events := make([]*ContactEvent, 0)
+	if err := db.SelectContext(ctx, &events, sqlSelectContactEvents, orgID, contactID, before, limit); err != nil {
+		return nil, errors.Wrap(err, "error loading contact events")
+	}
+	return events, nil
+}
@@ -0,0 +1,64 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactEvents(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	shippedOn := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	event1, err := models.InsertContactEvent(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, "order_shipped", "shopify", map[string]interface{}{"order_id": "A1234"}, &shippedOn)
+	require.NoError(t, err)
+	assert.Equal(t, testdata.Cathy.ID, event1.ContactID)
+	assert.Equal(t, "order_shipped", event1.Type)
+	assert.Equal(t, "shopify", event1.Source)
+	assert.Equal(t, map[string]interface{}{"order_id": "A1234"}, event1.Payload.Map())
+	assert.Equal(t, shippedOn, event1.OccurredOn.UTC())
+
+	// events without a time are recorded as happening now
+	event2, err := models.InsertContactEvent(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, "payment_received", "stripe", nil, nil)
+	require.NoError(t, err)
+	assert.True(t, event2.OccurredOn.After(shippedOn))
+	assert.Equal(t, map[string]interface{}{}, event2.Payload.Map())
+
+	// contact from another org
+	event3, err := models.InsertContactEvent(ctx, db, testdata.Org2.ID, testdata.Cathy.ID, "order_shipped", "shopify", nil, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, event3)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactevent WHERE contact_id = $1`, testdata.Cathy.ID).Returns(2)
+
+	// newest first
+	events, err := models.LoadContactEvents(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, nil, 50)
+	require.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, event2.ID, events[0].ID)
+	assert.Equal(t, event1.ID, events[1].ID)
+
+	// paged by time
+	events, err = models.LoadContactEvents(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, &event2.OccurredOn, 50)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, event1.ID, events[0].ID)
+
+	events, err = models.LoadContactEvents(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, nil, 1)
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+
+	events, err = models.LoadContactEvents(ctx, db, testdata.Org2.ID, testdata.Cathy.ID, nil, 50)
+	require.NoError(t, err)
+	assert.Len(t, events, 0)
+}
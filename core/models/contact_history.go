@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HistoryItemType is the type of an item in a contact's history
+type HistoryItemType string
+
+const (
+	HistoryItemTypeMsg HistoryItemType = "msg"
+	HistoryItemTypeRun HistoryItemType = "run"
+)
+
+// HistoryItem is a single message or run in a contact's history
+type HistoryItem struct {
+	Type      HistoryItemType `json:"type"       db:"type"`
+	CreatedOn time.Time       `json:"created_on" db:"created_on"`
+	Data      json.RawMessage `json:"data"       db:"data"`
+}
+
+const sqlSelectContactHistory = `
+SELECT h.type, h.created_on, h.data FROM (
+	SELECT 'msg' AS type, m.created_on, json_build_object(
+		'id', m.id, 'uuid', m.uuid, 'direction', m.direction, 'status', m.status, 'text', m.text,
+		'attachments', m.attachments, 'channel_id', m.channel_id, 'flow_id', m.flow_id, 'broadcast_id', m.broadcast_id
+	) AS data
+	  FROM msgs_msg m
+	 WHERE m.org_id = $1 AND m.contact_id = $2 AND m.visibility != 'D' AND m.created_on >= $3 AND m.created_on < $4
+	UNION ALL
+	SELECT 'run' AS type, r.created_on, json_build_object(
+		'id', r.id, 'uuid', r.uuid, 'flow_id', r.flow_id, 'status', r.status, 'exited_on', r.exited_on, 'results', r.results::json
+	) AS data
+	  FROM flows_flowrun r
+	 WHERE r.org_id = $1 AND r.contact_id = $2 AND r.created_on >= $3 AND r.created_on < $4
+) h
+ORDER BY h.created_on DESC`
+
+// StreamContactHistory reads the messages and runs of the given contact created in the given window, newest first,
+// passing each to the callback as it's read so that a long history is never held in memory
+func StreamContactHistory(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID, after, before time.Time, callback func(*HistoryItem) error) error {
+	rows, err := db.QueryxContext(ctx, sqlSelectContactHistory, orgID, contactID, after, before)
+	if err != nil {
+		return errors.Wrapf(err, "error querying history for contact %d", contactID)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := &HistoryItem{}
+		if err := rows.StructScan(item); err != nil {
+			return errors.Wrap(err, "error scanning history item")
+		}
+		if err := callback(item); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrapf(rows.Err(), "error reading history for contact %d", contactID)
+}
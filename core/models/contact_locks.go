@@ -0,0 +1,251 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/analytics"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// sorted set of the contact locks currently held, scored by when they were acquired
+	contactLocksHeldKey = "contact_locks:held"
+
+	// hash of the contact locks currently held to their details
+	contactLockHoldersKey = "contact_locks:holders"
+
+	// hash of counts of how long tasks waited for contact locks on each day
+	contactLockWaitsKey    = "contact_locks:waits:%s"
+	contactLockWaitsExpiry = 7 * 24 * time.Hour
+
+	contactLockWaitsTimeouts = "timeouts"
+	contactLockWaitsCount    = "count"
+	contactLockWaitsTotalMS  = "total_ms"
+	contactLockWaitsOver     = "+Inf"
+)
+
+// the upper bounds of the buckets that contact lock wait times are counted in
+var contactLockWaitBuckets = []time.Duration{
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// ContactLock is a lock on a contact held by a task. Locks are tracked in Redis whilst they're held so that we can see
+// which tasks are holding locks on which contacts, and for how long, when contacts appear to be stuck.
+type ContactLock struct {
+	OrgID      OrgID     `json:"org_id"`
+	ContactID  ContactID `json:"contact_id"`
+	Holder     string    `json:"holder"`
+	AcquiredOn time.Time `json:"acquired_on"`
+
+	value string
+}
+
+// the member of a held lock is unique to each acquisition so a lock which expired and was re-acquired isn't confused
+func (l *ContactLock) member() string {
+	return fmt.Sprintf("%d:%d:%s", l.OrgID, l.ContactID, l.value)
+}
+
+// LockContact tries to grab the lock for the given contact for the given holder, e.g. a task type, waiting up to the
+// given retry duration. Returns nil if the lock couldn't be acquired in that time.
+func LockContact(rt *runtime.Runtime, orgID OrgID, contactID ContactID, holder string, retry time.Duration) (*ContactLock, error) {
+	start := time.Now()
+
+	value, err := GetContactLocker(orgID, contactID).Grab(rt.RP, retry)
+	if err != nil {
+		return nil, err
+	}
+
+	waited := time.Since(start)
+	analytics.Gauge("mr.contact_lock_wait", float64(waited)/float64(time.Second))
+
+	var lock *ContactLock
+	if value != "" {
+		lock = &ContactLock{OrgID: orgID, ContactID: contactID, Holder: holder, AcquiredOn: time.Now(), value: value}
+	}
+
+	// telemetry failing shouldn't stop the task so just log errors
+	if err := recordContactLockGrab(rt.RP, lock, waited); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"org_id": orgID, "contact_id": contactID}).Error("error recording contact lock")
+	}
+
+	return lock, nil
+}
+
+// Release releases this lock, logging a warning if it was held for longer than the configured threshold
+func (l *ContactLock) Release(rt *runtime.Runtime) error {
+	held := time.Since(l.AcquiredOn)
+
+	if err := GetContactLocker(l.OrgID, l.ContactID).Release(rt.RP, l.value); err != nil {
+		return err
+	}
+
+	analytics.Gauge("mr.contact_lock_held", float64(held)/float64(time.Second))
+
+	if err := forgetContactLocks(rt.RP, []string{l.member()}); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{"org_id": l.OrgID, "contact_id": l.ContactID}).Error("error recording contact lock release")
+	}
+
+	if held > time.Duration(rt.Config.ContactLockWarnAfter)*time.Second {
+		logrus.WithFields(logrus.Fields{"org_id": l.OrgID, "contact_id": l.ContactID, "holder": l.Holder, "held": held}).Warn("contact lock was held past threshold")
+	}
+
+	return nil
+}
+
+func recordContactLockGrab(rp *redis.Pool, lock *ContactLock, waited time.Duration) error {
+	rc := rp.Get()
+	defer rc.Close()
+
+	waitsKey := fmt.Sprintf(contactLockWaitsKey, time.Now().UTC().Format("2006-01-02"))
+
+	rc.Send("MULTI")
+	if lock != nil {
+		rc.Send("HINCRBY", waitsKey, contactLockWaitBucket(waited), 1)
+		rc.Send("HINCRBY", waitsKey, contactLockWaitsCount, 1)
+		rc.Send("HINCRBY", waitsKey, contactLockWaitsTotalMS, int64(waited/time.Millisecond))
+		rc.Send("ZADD", contactLocksHeldKey, lock.AcquiredOn.UnixMilli(), lock.member())
+		rc.Send("HSET", contactLockHoldersKey, lock.member(), jsonx.MustMarshal(lock))
+	} else {
+		rc.Send("HINCRBY", waitsKey, contactLockWaitsTimeouts, 1)
+	}
+	rc.Send("EXPIRE", waitsKey, int(contactLockWaitsExpiry/time.Second))
+	_, err := rc.Do("EXEC")
+
+	return err
+}
+
+func forgetContactLocks(rp *redis.Pool, members []string) error {
+	rc := rp.Get()
+	defer rc.Close()
+
+	rc.Send("MULTI")
+	for _, m := range members {
+		rc.Send("ZREM", contactLocksHeldKey, m)
+		rc.Send("HDEL", contactLockHoldersKey, m)
+	}
+	_, err := rc.Do("EXEC")
+
+	return err
+}
+
+func contactLockWaitBucket(waited time.Duration) string {
+	for _, b := range contactLockWaitBuckets {
+		if waited <= b {
+			return b.String()
+		}
+	}
+	return contactLockWaitsOver
+}
+
+// ContactLockWaits is the distribution of how long tasks waited for contact locks on a day
+type ContactLockWaits struct {
+	Count    int            `json:"count"`
+	Timeouts int            `json:"timeouts"`
+	AvgMS    int            `json:"avg_ms"`
+	Buckets  map[string]int `json:"buckets"`
+}
+
+// GetContactLockWaits gets the distribution of contact lock wait times on the given day
+func GetContactLockWaits(rc redis.Conn, day time.Time) (*ContactLockWaits, error) {
+	values, err := redis.IntMap(rc.Do("HGETALL", fmt.Sprintf(contactLockWaitsKey, day.UTC().Format("2006-01-02"))))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading contact lock waits")
+	}
+
+	waits := &ContactLockWaits{
+		Count:    values[contactLockWaitsCount],
+		Timeouts: values[contactLockWaitsTimeouts],
+		Buckets:  make(map[string]int, len(contactLockWaitBuckets)+1),
+	}
+	if waits.Count > 0 {
+		waits.AvgMS = values[contactLockWaitsTotalMS] / waits.Count
+	}
+	for _, b := range contactLockWaitBuckets {
+		waits.Buckets[b.String()] = values[b.String()]
+	}
+	waits.Buckets[contactLockWaitsOver] = values[contactLockWaitsOver]
+
+	return waits, nil
+}
+
+// GetHeldContactLocks gets up to the given number of the contact locks which are currently held and were acquired
+// before the given time, longest held first
+func GetHeldContactLocks(rc redis.Conn, before time.Time, limit int) ([]*ContactLock, error) {
+	members, err := redis.Strings(rc.Do("ZRANGEBYSCORE", contactLocksHeldKey, "-inf", fmt.Sprintf("(%d", before.UnixMilli()), "LIMIT", 0, limit))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading held contact locks")
+	}
+	if len(members) == 0 {
+		return []*ContactLock{}, nil
+	}
+
+	args := redis.Args{contactLockHoldersKey}.AddFlat(members)
+	values, err := redis.ByteSlices(rc.Do("HMGET", args...))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading contact lock holders")
+	}
+
+	locks := make([]*ContactLock, 0, len(members))
+	for i, value := range values {
+		if value == nil {
+			continue // released since we read the set
+		}
+
+		lock := &ContactLock{}
+		if err := json.Unmarshal(value, lock); err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling contact lock")
+		}
+		lock.value = members[i][strings.LastIndex(members[i], ":")+1:]
+		locks = append(locks, lock)
+	}
+
+	return locks, nil
+}
+
+// CheckHeldContactLocks logs any contact locks which have been held past the configured threshold. Locks held past
+// their expiration were never released, e.g. because their holder died or is deadlocked, so these are logged as errors
+// and forgotten. Returns the number of locks found held past the threshold.
+func CheckHeldContactLocks(rt *runtime.Runtime) (int, error) {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	now := time.Now()
+	locks, err := GetHeldContactLocks(rc, now.Add(-time.Duration(rt.Config.ContactLockWarnAfter)*time.Second), 1000)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := make([]string, 0)
+
+	for _, l := range locks {
+		held := now.Sub(l.AcquiredOn)
+		log := logrus.WithFields(logrus.Fields{"org_id": l.OrgID, "contact_id": l.ContactID, "holder": l.Holder, "held": held})
+
+		if held > contactLockExpiration {
+			log.Error("contact lock expired without being released")
+			expired = append(expired, l.member())
+		} else {
+			log.Warn("contact lock is being held past threshold")
+		}
+	}
+
+	if len(expired) > 0 {
+		if err := forgetContactLocks(rt.RP, expired); err != nil {
+			return 0, errors.Wrap(err, "error forgetting expired contact locks")
+		}
+	}
+
+	return len(locks), nil
+}
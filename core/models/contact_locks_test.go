@@ -0,0 +1,78 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactLocks(t *testing.T) {
+	_, rt, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	lock1, err := models.LockContact(rt, testdata.Org1.ID, testdata.Cathy.ID, "handle_contact_event", time.Second)
+	require.NoError(t, err)
+	require.NotNil(t, lock1)
+	assert.Equal(t, testdata.Org1.ID, lock1.OrgID)
+	assert.Equal(t, testdata.Cathy.ID, lock1.ContactID)
+	assert.Equal(t, "handle_contact_event", lock1.Holder)
+
+	lock2, err := models.LockContact(rt, testdata.Org1.ID, testdata.Bob.ID, "start_flow", time.Second)
+	require.NoError(t, err)
+	require.NotNil(t, lock2)
+
+	// can't grab the lock for a contact which is already locked
+	lock3, err := models.LockContact(rt, testdata.Org1.ID, testdata.Cathy.ID, "start_flow", time.Millisecond*100)
+	require.NoError(t, err)
+	assert.Nil(t, lock3)
+
+	waits, err := models.GetContactLockWaits(rc, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, waits.Count)
+	assert.Equal(t, 1, waits.Timeouts)
+	assert.Equal(t, 2, waits.Buckets["10ms"])
+
+	held, err := models.GetHeldContactLocks(rc, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, held, 2)
+	assert.Equal(t, testdata.Cathy.ID, held[0].ContactID)
+	assert.Equal(t, "handle_contact_event", held[0].Holder)
+	assert.Equal(t, testdata.Bob.ID, held[1].ContactID)
+	assert.Equal(t, "start_flow", held[1].Holder)
+
+	// nothing held yet past the threshold
+	count, err := models.CheckHeldContactLocks(rt)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	require.NoError(t, lock1.Release(rt))
+
+	held, err = models.GetHeldContactLocks(rc, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, held, 1)
+	assert.Equal(t, testdata.Bob.ID, held[0].ContactID)
+
+	// now lock can be grabbed by someone else
+	lock3, err = models.LockContact(rt, testdata.Org1.ID, testdata.Cathy.ID, "start_flow", time.Second)
+	require.NoError(t, err)
+	assert.NotNil(t, lock3)
+
+	// locks held past the threshold are found by the check
+	rt.Config.ContactLockWarnAfter = 0
+	defer func() { rt.Config.ContactLockWarnAfter = 60 }()
+
+	time.Sleep(time.Millisecond * 5)
+
+	count, err = models.CheckHeldContactLocks(rt)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
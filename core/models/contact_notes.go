@@ -0,0 +1,63 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ContactNoteID is our type for contact note ids
+type ContactNoteID int
+
+// ContactNote is a note added to a contact by a user which is shown in the contact's history
+type ContactNote struct {
+	ID          ContactNoteID `db:"id"            json:"id"`
+	ContactID   ContactID     `db:"contact_id"    json:"contact_id"`
+	Text        string        `db:"text"          json:"text"`
+	CreatedByID UserID        `db:"created_by_id" json:"created_by_id"`
+	CreatedOn   time.Time     `db:"created_on"    json:"created_on"`
+}
+
+const sqlInsertContactNote = `
+INSERT INTO contacts_contactnote(contact_id, text, created_by_id, created_on)
+     SELECT c.id, $3, $4, NOW()
+       FROM contacts_contact c
+      WHERE c.id = $2 AND c.org_id = $1 AND c.is_active = TRUE
+  RETURNING id, contact_id, text, created_by_id, created_on`
+
+// AddContactNote adds a note by the given user to the given contact, returning nil if the contact doesn't exist in
+// the given org
+func AddContactNote(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID, userID UserID, text string) (*ContactNote, error) {
+	rows, err := db.QueryxContext(ctx, sqlInsertContactNote, orgID, contactID, text, userID)
+	if err != nil {
+		return nil, errors.Wrap(err, "error inserting contact note")
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	note := &ContactNote{}
+	if err := rows.StructScan(note); err != nil {
+		return nil, errors.Wrap(err, "error scanning contact note")
+	}
+	return note, nil
+}
+
+const sqlSelectContactNotes = `
+  SELECT n.id, n.contact_id, n.text, n.created_by_id, n.created_on
+    FROM contacts_contactnote n
+    JOIN contacts_contact c ON c.id = n.contact_id
+   WHERE n.contact_id = $2 AND c.org_id = $1
+ORDER BY n.created_on, n.id`
+
+// LoadContactNotes loads the notes on the given contact in the order they were added
+func LoadContactNotes(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID) ([]*ContactNote, error) {
+	notes := make([]*ContactNote, 0)
+	if err := db.SelectContext(ctx, &notes, sqlSelectContactNotes, orgID, contactID); err != nil {
+		return nil, errors.Wrap(err, "error loading contact notes")
+	}
+	return notes, nil
+}
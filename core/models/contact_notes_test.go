@@ -0,0 +1,44 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContactNotes(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	note1, err := models.AddContactNote(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, testdata.Admin.ID, "Prefers evenings")
+	require.NoError(t, err)
+	assert.Equal(t, testdata.Cathy.ID, note1.ContactID)
+	assert.Equal(t, "Prefers evenings", note1.Text)
+	assert.Equal(t, testdata.Admin.ID, note1.CreatedByID)
+	assert.False(t, note1.CreatedOn.IsZero())
+
+	note2, err := models.AddContactNote(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, testdata.Agent.ID, "Called back")
+	require.NoError(t, err)
+
+	// contact from another org
+	note3, err := models.AddContactNote(ctx, db, testdata.Org2.ID, testdata.Cathy.ID, testdata.Admin.ID, "Nope")
+	assert.NoError(t, err)
+	assert.Nil(t, note3)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactnote WHERE contact_id = $1`, testdata.Cathy.ID).Returns(2)
+
+	notes, err := models.LoadContactNotes(ctx, db, testdata.Org1.ID, testdata.Cathy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []*models.ContactNote{note1, note2}, notes)
+
+	notes, err = models.LoadContactNotes(ctx, db, testdata.Org2.ID, testdata.Cathy.ID)
+	require.NoError(t, err)
+	assert.Len(t, notes, 0)
+}
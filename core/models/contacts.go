@@ -18,6 +18,7 @@ import (
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
 	"github.com/nyaruka/null"
 	"github.com/nyaruka/redisx"
 	"github.com/pkg/errors"
@@ -261,6 +262,16 @@ func LoadContacts(ctx context.Context, db Queryer, oa *OrgAssets, ids []ContactI
 	}
 	defer rows.Close()
 
+	// if org chooses between URNs by which channel was used most recently, we need to know when each was last used
+	routing := oa.Org().ChannelRouting()
+	var lastUsed map[ContactID]map[ChannelID]time.Time
+	if routing != nil && routing.Policy == ChannelRoutingMostRecent {
+		lastUsed, err = loadContactChannelsLastUsed(ctx, db, oa.OrgID(), ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	contacts := make([]*Contact, 0, len(ids))
 	for rows.Next() {
 		e := &contactEnvelope{}
@@ -298,6 +309,16 @@ func LoadContacts(ctx context.Context, db Queryer, oa *OrgAssets, ids []ContactI
 			field := f.(*Field)
 			cv, found := e.Fields[field.UUID()]
 			if found {
+				if cv.Encrypted != "" {
+					// better to fail than to run flows as if the contact didn't have a value
+					value, err := oa.Org().DecryptFieldValue(cv.Encrypted)
+					if err != nil {
+						return nil, errors.Wrapf(err, "unable to decrypt value of field '%s' for contact %d", field.Key(), contact.id)
+					}
+					fields[field.Key()] = value
+					continue
+				}
+
 				value := flows.NewValue(
 					cv.Text,
 					cv.Datetime,
@@ -311,6 +332,11 @@ func LoadContacts(ctx context.Context, db Queryer, oa *OrgAssets, ids []ContactI
 		}
 		contact.fields = fields
 
+		// reorder URNs according to the org's channel routing so that messages are sent to the right one
+		if routing != nil {
+			routing.sortURNs(oa, e.URNs, fields, lastUsed[contact.id])
+		}
+
 		// finally build up our URN objects
 		contactURNs := make([]urns.URN, 0, len(e.URNs))
 		for _, u := range e.URNs {
@@ -392,6 +418,15 @@ func getContactIDsFromUUIDs(ctx context.Context, db Queryer, orgID OrgID, uuids
 	return ids, nil
 }
 
+// FilterContactIDsByOrg filters the given contact IDs to those of active contacts which belong to the given org
+func FilterContactIDsByOrg(ctx context.Context, db Queryer, orgID OrgID, contactIDs []ContactID) ([]ContactID, error) {
+	ids, err := queryContactIDs(ctx, db, `SELECT id FROM contacts_contact WHERE org_id = $1 AND id = ANY($2) AND is_active = TRUE ORDER BY id`, orgID, pq.Array(contactIDs))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error filtering contact ids by org")
+	}
+	return ids, nil
+}
+
 // utility to query contact IDs
 func queryContactIDs(ctx context.Context, db Queryer, query string, args ...interface{}) ([]ContactID, error) {
 	ids := make([]ContactID, 0, 10)
@@ -465,6 +500,8 @@ type contactEnvelope struct {
 		State    envs.LocationPath `json:"state,omitempty"`
 		District envs.LocationPath `json:"district,omitempty"`
 		Ward     envs.LocationPath `json:"ward,omitempty"`
+
+		Encrypted string `json:"encrypted,omitempty"`
 	} `json:"fields"`
 	GroupIDs []GroupID    `json:"group_ids"`
 	URNs     []ContactURN `json:"urns"`
@@ -1019,10 +1056,10 @@ func StopContact(ctx context.Context, db Queryer, orgID OrgID, contactID Contact
 		return errors.Wrapf(err, "error removing stopped contact from groups")
 	}
 
-	// remove all unfired campaign event fires
-	_, err = db.ExecContext(ctx, sqlDeleteUnfiredEvents, contactID)
+	// skip all unfired campaign event fires
+	_, err = db.ExecContext(ctx, sqlSkipUnfiredEvents, contactID)
 	if err != nil {
-		return errors.Wrapf(err, "error deleting unfired event fires")
+		return errors.Wrapf(err, "error skipping unfired event fires")
 	}
 
 	// remove the contact from any triggers
@@ -1051,9 +1088,10 @@ const sqlDeleteAllContactTriggers = `
 DELETE FROM triggers_trigger_contacts
       WHERE contact_id = $1`
 
-const sqlDeleteUnfiredEvents = `
-DELETE FROM campaigns_eventfire
-      WHERE contact_id = $1 AND fired IS NULL`
+const sqlSkipUnfiredEvents = `
+UPDATE campaigns_eventfire
+   SET fired = NOW(), fired_result = 'S', skip_reason = 'contact_inactive'
+ WHERE contact_id = $1 AND fired IS NULL`
 
 const sqlMarkContactStopped = `
 UPDATE contacts_contact
@@ -1347,10 +1385,15 @@ func (i *ContactID) Scan(value interface{}) error {
 	return null.ScanInt(value, (*null.Int)(i))
 }
 
+// how long a contact lock is held for if it's never released
+const contactLockExpiration = time.Minute * 5
+
+var contactLockKeys = orgkeys.Register("lock:c:%d:%d")
+
 // GetContactLocker returns the locker for a particular contact
 func GetContactLocker(orgID OrgID, contactID ContactID) *redisx.Locker {
-	key := fmt.Sprintf("lock:c:%d:%d", orgID, contactID)
-	return redisx.NewLocker(key, time.Minute*5)
+	key := contactLockKeys.Key(int(orgID), contactID)
+	return redisx.NewLocker(key, contactLockExpiration)
 }
 
 // ContactStatusChange struct used for our contact status change
@@ -0,0 +1,226 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+)
+
+// ContentPolicyRuleType is the type of matching a content policy rule does
+type ContentPolicyRuleType string
+
+const (
+	ContentPolicyRuleWords      = ContentPolicyRuleType("words")
+	ContentPolicyRulePattern    = ContentPolicyRuleType("pattern")
+	ContentPolicyRuleCreditCard = ContentPolicyRuleType("credit_card")
+)
+
+// ContentPolicyAction is what happens to a message when a content policy rule matches it
+type ContentPolicyAction string
+
+const (
+	ContentPolicyActionFlag   = ContentPolicyAction("flag")
+	ContentPolicyActionRedact = ContentPolicyAction("redact")
+	ContentPolicyActionBlock  = ContentPolicyAction("block")
+)
+
+// the text we replace redacted content with
+const contentPolicyRedactMask = "****"
+
+// finds runs of digits, optionally separated by spaces or dashes, which could be card numbers
+var cardCandidateRegex = regexp.MustCompile(`\d(?:[ \-]?\d){12,18}`)
+
+// ContentPolicyRule is a single rule in an org's content policy
+//
+//	{
+//	  "name": "banned words",
+//	  "type": "words",
+//	  "words": ["darn", "heck"],
+//	  "action": "redact"
+//	}
+type ContentPolicyRule struct {
+	Name    string                `json:"name"              validate:"required,max=64"`
+	Type    ContentPolicyRuleType `json:"type"              validate:"required,eq=words|eq=pattern|eq=credit_card"`
+	Words   []string              `json:"words,omitempty"`
+	Pattern string                `json:"pattern,omitempty"`
+	Action  ContentPolicyAction   `json:"action"            validate:"required,eq=flag|eq=redact|eq=block"`
+
+	regex *regexp.Regexp
+}
+
+// finds the index ranges of all matches of this rule in the given text
+func (r *ContentPolicyRule) match(text string) [][]int {
+	if r.Type == ContentPolicyRuleCreditCard {
+		matches := make([][]int, 0)
+		for _, m := range cardCandidateRegex.FindAllStringIndex(text, -1) {
+			if isLuhnValid(text[m[0]:m[1]]) {
+				matches = append(matches, m)
+			}
+		}
+		return matches
+	}
+	return r.regex.FindAllStringIndex(text, -1)
+}
+
+// ContentPolicy is an org configurable set of rules which are applied to outgoing message text
+type ContentPolicy struct {
+	Rules []*ContentPolicyRule `json:"rules" validate:"dive"`
+}
+
+// ContentPolicyMatch is a rule which matched when a policy was applied to some text
+type ContentPolicyMatch struct {
+	Rule   string              `json:"rule"`
+	Action ContentPolicyAction `json:"action"`
+}
+
+// ReadContentPolicy reads and validates a content policy from the given JSON
+func ReadContentPolicy(data []byte) (*ContentPolicy, error) {
+	p := &ContentPolicy{}
+	if err := utils.UnmarshalAndValidate(data, p); err != nil {
+		return nil, err
+	}
+
+	for _, r := range p.Rules {
+		var err error
+
+		switch r.Type {
+		case ContentPolicyRuleWords:
+			if len(r.Words) == 0 {
+				return nil, errors.Errorf("content policy rule '%s' has no words", r.Name)
+			}
+			words := make([]string, len(r.Words))
+			for i := range r.Words {
+				word := strings.TrimSpace(r.Words[i])
+
+				// an empty alternative would match every message
+				if word == "" {
+					return nil, errors.Errorf("content policy rule '%s' has an empty word", r.Name)
+				}
+				words[i] = regexp.QuoteMeta(word)
+			}
+			r.regex, err = regexp.Compile(`(?i)\b(?:` + strings.Join(words, "|") + `)\b`)
+		case ContentPolicyRulePattern:
+			if r.Pattern == "" {
+				return nil, errors.Errorf("content policy rule '%s' has no pattern", r.Name)
+			}
+			r.regex, err = regexp.Compile(r.Pattern)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid pattern for content policy rule '%s'", r.Name)
+		}
+	}
+
+	return p, nil
+}
+
+// Apply applies this policy to the given text, returning the possibly redacted text, the matched rules and whether
+// the text should be blocked entirely
+func (p *ContentPolicy) Apply(text string) (string, []*ContentPolicyMatch, bool) {
+	matches := make([]*ContentPolicyMatch, 0)
+	blocked := false
+
+	for _, r := range p.Rules {
+		found := r.match(text)
+		if len(found) == 0 {
+			continue
+		}
+
+		matches = append(matches, &ContentPolicyMatch{Rule: r.Name, Action: r.Action})
+
+		switch r.Action {
+		case ContentPolicyActionBlock:
+			blocked = true
+		case ContentPolicyActionRedact:
+			text = redactRanges(text, found)
+		}
+	}
+
+	return text, matches, blocked
+}
+
+// replaces the given index ranges of text with our redaction mask
+func redactRanges(text string, ranges [][]int) string {
+	var sb strings.Builder
+	last := 0
+	for _, r := range ranges {
+		sb.WriteString(text[last:r[0]])
+		sb.WriteString(contentPolicyRedactMask)
+		last = r[1]
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// checks whether the digits in the given string pass the Luhn checksum used by payment cards
+func isLuhnValid(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := rune(s[i])
+		if !unicode.IsDigit(c) {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// ContentPolicyLog is an audit record of a content policy rule matching an outgoing message
+type ContentPolicyLog struct {
+	OrgID     OrgID               `db:"org_id"`
+	MsgID     flows.MsgID         `db:"msg_id"`
+	ContactID ContactID           `db:"contact_id"`
+	Rule      string              `db:"rule"`
+	Action    ContentPolicyAction `db:"action"`
+	CreatedOn time.Time           `db:"created_on"`
+}
+
+const sqlInsertContentPolicyLogs = `
+INSERT INTO msgs_contentpolicylog(org_id, msg_id, contact_id, rule, action, created_on)
+                          VALUES(:org_id, :msg_id, :contact_id, :rule, :action, :created_on)`
+
+// inserts audit records for any content policy matches on the given messages, which must already have ids
+func insertContentPolicyLogs(ctx context.Context, db Queryer, msgs []*Msg) error {
+	logs := make([]*ContentPolicyLog, 0)
+	now := dates.Now()
+
+	for _, m := range msgs {
+		for _, match := range m.policyMatches {
+			logs = append(logs, &ContentPolicyLog{
+				OrgID:     m.OrgID(),
+				MsgID:     m.ID(),
+				ContactID: m.ContactID(),
+				Rule:      match.Rule,
+				Action:    match.Action,
+				CreatedOn: now,
+			})
+		}
+	}
+
+	return BulkQuery(ctx, "insert content policy logs", db, sqlInsertContentPolicyLogs, logs)
+}
+
+// reads the content policy from the given org config value
+func readContentPolicyConfig(v interface{}) (*ContentPolicy, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadContentPolicy(data)
+}
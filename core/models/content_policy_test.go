@@ -0,0 +1,62 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContentPolicy(t *testing.T) {
+	policy, err := models.ReadContentPolicy([]byte(`{
+		"rules": [
+			{"name": "cards", "type": "credit_card", "action": "redact"},
+			{"name": "swears", "type": "words", "words": ["darn", "heck"], "action": "redact"},
+			{"name": "secrets", "type": "pattern", "pattern": "(?i)password:\\s*\\S+", "action": "block"},
+			{"name": "lottery", "type": "words", "words": ["lottery"], "action": "flag"}
+		]
+	}`))
+	require.NoError(t, err)
+
+	tcs := []struct {
+		text            string
+		expectedText    string
+		expectedRules   []string
+		expectedBlocked bool
+	}{
+		{"Hi there", "Hi there", []string{}, false},
+		{"Your card 4111 1111 1111 1111 was charged", "Your card **** was charged", []string{"cards"}, false},
+		{"Order 1234567890123 shipped", "Order 1234567890123 shipped", []string{}, false}, // fails Luhn check
+		{"Oh DARN it, what the heck", "Oh **** it, what the ****", []string{"swears"}, false},
+		{"Darnell is here", "Darnell is here", []string{}, false},
+		{"Your password: hunter2", "Your password: hunter2", []string{"secrets"}, true},
+		{"You won the lottery, darn", "You won the lottery, ****", []string{"swears", "lottery"}, false},
+	}
+
+	for _, tc := range tcs {
+		text, matches, blocked := policy.Apply(tc.text)
+
+		rules := make([]string, len(matches))
+		for i := range matches {
+			rules[i] = matches[i].Rule
+		}
+
+		assert.Equal(t, tc.expectedText, text, "text mismatch for '%s'", tc.text)
+		assert.Equal(t, tc.expectedRules, rules, "rules mismatch for '%s'", tc.text)
+		assert.Equal(t, tc.expectedBlocked, blocked, "blocked mismatch for '%s'", tc.text)
+	}
+
+	_, err = models.ReadContentPolicy([]byte(`{"rules": [{"name": "x", "type": "pattern", "pattern": "[", "action": "flag"}]}`))
+	assert.EqualError(t, err, "invalid pattern for content policy rule 'x': error parsing regexp: missing closing ]: `[`")
+
+	_, err = models.ReadContentPolicy([]byte(`{"rules": [{"name": "x", "type": "words", "action": "flag"}]}`))
+	assert.EqualError(t, err, "content policy rule 'x' has no words")
+
+	_, err = models.ReadContentPolicy([]byte(`{"rules": [{"name": "x", "type": "words", "words": ["darn", " "], "action": "block"}]}`))
+	assert.EqualError(t, err, "content policy rule 'x' has an empty word")
+
+	_, err = models.ReadContentPolicy([]byte(`{"rules": [{"name": "x", "type": "words", "words": ["a"], "action": "delete"}]}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// ConversationWindow is how long a conversation stays open after its last message. A message to or from a contact on a
+// channel after this much inactivity starts a new conversation, which is how channels like WhatsApp price messaging.
+const ConversationWindow = time.Hour * 24
+
+const configConversations = "conversations"
+
+// RecordsConversations returns whether this org records the conversations of its contacts, which it does if it has
+// enabled them or if it routes messages by the channel of the most recent conversation
+func (o *Org) RecordsConversations() bool {
+	if o.channelRouting != nil && o.channelRouting.Policy == ChannelRoutingMostRecent {
+		return true
+	}
+	return o.o.Config.Get(configConversations, false) == true
+}
+
+// ConversationID is our type for conversation ids
+type ConversationID int
+
+// Conversation is a run of messages between a contact and a channel with no gap longer than the conversation window
+type Conversation struct {
+	ID          ConversationID `db:"id"           json:"id"`
+	ContactID   ContactID      `db:"contact_id"   json:"contact_id"`
+	ChannelID   ChannelID      `db:"channel_id"   json:"channel_id"`
+	InitiatedBy MsgDirection   `db:"initiated_by" json:"initiated_by"`
+	StartedOn   time.Time      `db:"started_on"   json:"started_on"`
+	LastMsgOn   time.Time      `db:"last_msg_on"  json:"last_msg_on"`
+	MsgsIn      int            `db:"msgs_in"      json:"msgs_in"`
+	MsgsOut     int            `db:"msgs_out"     json:"msgs_out"`
+}
+
+// ConversationMsg is a new message to be added to a conversation
+type ConversationMsg struct {
+	ContactID ContactID
+	ChannelID ChannelID
+	Direction MsgDirection
+	CreatedOn time.Time
+}
+
+// ConversationMsgsFor returns the conversation messages for the given new messages
+func ConversationMsgsFor(msgs []*Msg) []*ConversationMsg {
+	cms := make([]*ConversationMsg, len(msgs))
+	for i, m := range msgs {
+		cms[i] = &ConversationMsg{ContactID: m.ContactID(), ChannelID: m.ChannelID(), Direction: m.Direction(), CreatedOn: m.CreatedOn()}
+	}
+	return cms
+}
+
+// the messages of a single contact and channel in a batch being recorded
+type conversationGroup struct {
+	contactID   ContactID
+	channelID   ChannelID
+	initiatedBy MsgDirection
+	firstOn     time.Time
+	lastOn      time.Time
+	msgsIn      int
+	msgsOut     int
+}
+
+// the latest conversation of each contact and channel is extended if it's still open, otherwise a new one is started
+const sqlRecordConversations = `
+WITH input AS (
+    SELECT * FROM unnest($2::int[], $3::int[], $4::text[], $5::timestamptz[], $6::timestamptz[], $7::int[], $8::int[])
+        AS i(contact_id, channel_id, initiated_by, first_on, last_on, msgs_in, msgs_out)
+),
+open AS (
+    SELECT DISTINCT ON (c.contact_id, c.channel_id) c.id, c.contact_id, c.channel_id
+      FROM msgs_conversation c
+      JOIN input i ON i.contact_id = c.contact_id AND i.channel_id = c.channel_id
+     WHERE c.last_msg_on > i.first_on - $9 * INTERVAL '1 second'
+  ORDER BY c.contact_id, c.channel_id, c.last_msg_on DESC
+),
+extended AS (
+    UPDATE msgs_conversation c
+       SET last_msg_on = GREATEST(c.last_msg_on, i.last_on), msgs_in = c.msgs_in + i.msgs_in, msgs_out = c.msgs_out + i.msgs_out
+      FROM open o
+      JOIN input i ON i.contact_id = o.contact_id AND i.channel_id = o.channel_id
+     WHERE c.id = o.id
+)
+INSERT INTO msgs_conversation(org_id, contact_id, channel_id, initiated_by, started_on, last_msg_on, msgs_in, msgs_out)
+     SELECT $1, i.contact_id, i.channel_id, i.initiated_by, i.first_on, i.last_on, i.msgs_in, i.msgs_out
+       FROM input i
+      WHERE NOT EXISTS (SELECT 1 FROM open o WHERE o.contact_id = i.contact_id AND o.channel_id = i.channel_id)
+  RETURNING channel_id`
+
+// RecordConversations adds the given new messages to the conversations of their contacts, starting new conversations
+// where there isn't one still open on the message's channel. Messages without a channel aren't part of a conversation.
+// This should be called in the transaction which commits the messages, and does nothing if the org doesn't record
+// conversations.
+func RecordConversations(ctx context.Context, tx Queryer, oa *OrgAssets, msgs []*ConversationMsg) error {
+	if !oa.Org().RecordsConversations() {
+		return nil
+	}
+
+	groups := make(map[ContactID]map[ChannelID]*conversationGroup)
+	ordered := make([]*conversationGroup, 0, len(msgs))
+
+	// messages might not be in order so sort them before working out who initiated each group
+	sorted := make([]*ConversationMsg, len(msgs))
+	copy(sorted, msgs)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].CreatedOn.Before(sorted[j].CreatedOn) })
+
+	for _, m := range sorted {
+		if m.ChannelID == NilChannelID {
+			continue
+		}
+		if groups[m.ContactID] == nil {
+			groups[m.ContactID] = make(map[ChannelID]*conversationGroup)
+		}
+		g := groups[m.ContactID][m.ChannelID]
+		if g == nil {
+			g = &conversationGroup{contactID: m.ContactID, channelID: m.ChannelID, initiatedBy: m.Direction, firstOn: m.CreatedOn}
+			groups[m.ContactID][m.ChannelID] = g
+			ordered = append(ordered, g)
+		}
+		g.lastOn = m.CreatedOn
+		if m.Direction == DirectionIn {
+			g.msgsIn++
+		} else {
+			g.msgsOut++
+		}
+	}
+
+	if len(ordered) == 0 {
+		return nil
+	}
+
+	contactIDs := make([]ContactID, len(ordered))
+	channelIDs := make([]ChannelID, len(ordered))
+	initiatedBy := make([]MsgDirection, len(ordered))
+	firstOns := make([]time.Time, len(ordered))
+	lastOns := make([]time.Time, len(ordered))
+	msgsIn := make([]int, len(ordered))
+	msgsOut := make([]int, len(ordered))
+	for i, g := range ordered {
+		contactIDs[i], channelIDs[i], initiatedBy[i] = g.contactID, g.channelID, g.initiatedBy
+		firstOns[i], lastOns[i], msgsIn[i], msgsOut[i] = g.firstOn, g.lastOn, g.msgsIn, g.msgsOut
+	}
+
+	started := make([]ChannelID, 0, len(ordered))
+	err := tx.SelectContext(ctx, &started, sqlRecordConversations, oa.OrgID(),
+		pq.Array(contactIDs), pq.Array(channelIDs), pq.Array(initiatedBy), pq.Array(firstOns), pq.Array(lastOns), pq.Array(msgsIn), pq.Array(msgsOut),
+		int(ConversationWindow/time.Second),
+	)
+	if err != nil {
+		return errors.Wrap(err, "error recording conversations")
+	}
+
+	increments := make([]*AnalyticsIncrement, len(started))
+	for i, channelID := range started {
+		increments[i] = &AnalyticsIncrement{Type: AnalyticsCountConversations, ChannelID: channelID, Count: 1}
+	}
+
+	return errors.Wrap(InsertAnalyticsCounts(ctx, tx, oa, increments), "error inserting conversation analytics counts")
+}
+
+const sqlSelectContactConversations = `
+  SELECT id, contact_id, channel_id, initiated_by, started_on, last_msg_on, msgs_in, msgs_out
+    FROM msgs_conversation
+   WHERE org_id = $1 AND contact_id = $2 AND ($3::timestamptz IS NULL OR started_on < $3)
+ORDER BY started_on DESC, id DESC
+   LIMIT $4`
+
+// LoadContactConversations loads the most recent conversations of the given contact which started before the given
+// time, or the most recent conversations of all if before is nil, newest first
+func LoadContactConversations(ctx context.Context, db Queryer, orgID OrgID, contactID ContactID, before *time.Time, limit int) ([]*Conversation, error) {
+	conversations := make([]*Conversation, 0)
+	if err := db.SelectContext(ctx, &conversations, sqlSelectContactConversations, orgID, contactID, before, limit); err != nil {
+		return nil, errors.Wrap(err, "error loading contact conversations")
+	}
+	return conversations, nil
+}
@@ -0,0 +1,86 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversations(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	db.MustExec(`UPDATE orgs_org SET config = config || '{"conversations": true}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	t1 := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// orgs which don't record conversations ignore messages
+	oa2, err := models.GetOrgAssets(ctx, rt, testdata.Org2.ID)
+	require.NoError(t, err)
+	assert.False(t, oa2.Org().RecordsConversations())
+
+	err = models.RecordConversations(ctx, db, oa2, []*models.ConversationMsg{
+		{ContactID: testdata.Org2Contact.ID, ChannelID: testdata.Org2Channel.ID, Direction: models.DirectionIn, CreatedOn: t1},
+	})
+	require.NoError(t, err)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_conversation`).Returns(0)
+
+	// messages without a channel aren't part of a conversation
+	err = models.RecordConversations(ctx, db, oa, []*models.ConversationMsg{
+		{ContactID: testdata.Cathy.ID, ChannelID: models.NilChannelID, Direction: models.DirectionOut, CreatedOn: t1},
+	})
+	require.NoError(t, err)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_conversation`).Returns(0)
+
+	// out of order messages in a batch are grouped by contact and channel, initiated by the earliest
+	err = models.RecordConversations(ctx, db, oa, []*models.ConversationMsg{
+		{ContactID: testdata.Cathy.ID, ChannelID: testdata.TwilioChannel.ID, Direction: models.DirectionOut, CreatedOn: t1.Add(time.Minute)},
+		{ContactID: testdata.Cathy.ID, ChannelID: testdata.TwilioChannel.ID, Direction: models.DirectionIn, CreatedOn: t1},
+		{ContactID: testdata.Cathy.ID, ChannelID: testdata.VonageChannel.ID, Direction: models.DirectionOut, CreatedOn: t1},
+		{ContactID: testdata.Bob.ID, ChannelID: testdata.TwilioChannel.ID, Direction: models.DirectionOut, CreatedOn: t1},
+	})
+	require.NoError(t, err)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_conversation`).Returns(3)
+	assertdb.Query(t, db, `SELECT initiated_by, msgs_in, msgs_out FROM msgs_conversation WHERE contact_id = $1 AND channel_id = $2`, testdata.Cathy.ID, testdata.TwilioChannel.ID).
+		Columns(map[string]interface{}{"initiated_by": "I", "msgs_in": int64(1), "msgs_out": int64(1)})
+
+	// a message within the window extends the open conversation
+	err = models.RecordConversations(ctx, db, oa, []*models.ConversationMsg{
+		{ContactID: testdata.Cathy.ID, ChannelID: testdata.TwilioChannel.ID, Direction: models.DirectionIn, CreatedOn: t1.Add(time.Hour * 23)},
+	})
+	require.NoError(t, err)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_conversation`).Returns(3)
+	assertdb.Query(t, db, `SELECT msgs_in FROM msgs_conversation WHERE contact_id = $1 AND channel_id = $2`, testdata.Cathy.ID, testdata.TwilioChannel.ID).Returns(2)
+
+	// and one after the window starts a new conversation
+	err = models.RecordConversations(ctx, db, oa, []*models.ConversationMsg{
+		{ContactID: testdata.Cathy.ID, ChannelID: testdata.TwilioChannel.ID, Direction: models.DirectionOut, CreatedOn: t1.Add(time.Hour * 48)},
+	})
+	require.NoError(t, err)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_conversation WHERE contact_id = $1`, testdata.Cathy.ID).Returns(3)
+
+	// new conversations are counted in the analytics rollups of the org and channel
+	assertdb.Query(t, db, `SELECT SUM(count) FROM orgs_analyticsdailycount WHERE count_type = 'conversations' AND scope = $1`, "o:1").Returns(4)
+	assertdb.Query(t, db, `SELECT SUM(count) FROM orgs_analyticsdailycount WHERE count_type = 'conversations' AND scope = $1`, "o:1:ch:10000").Returns(3)
+
+	conversations, err := models.LoadContactConversations(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, nil, 50)
+	require.NoError(t, err)
+	assert.Len(t, conversations, 3)
+	assert.Equal(t, models.DirectionOut, conversations[0].InitiatedBy)
+	assert.Equal(t, t1.Add(time.Hour*48), conversations[0].StartedOn.UTC())
+
+	conversations, err = models.LoadContactConversations(ctx, db, testdata.Org1.ID, testdata.Cathy.ID, &t1, 50)
+	require.NoError(t, err)
+	assert.Len(t, conversations, 0)
+}
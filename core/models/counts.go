@@ -22,14 +22,14 @@ type dailyCount struct {
 
 const sqlInsertDailyCount = `INSERT INTO %s(count_type, scope, day, count, is_squashed) VALUES(:count_type, :scope, :day, :count, FALSE)`
 
-func insertDailyCounts(ctx context.Context, tx Queryer, table string, countType TicketDailyCountType, tz *time.Location, scopeCounts map[string]int) error {
+func insertDailyCounts(ctx context.Context, tx Queryer, table string, countType string, tz *time.Location, scopeCounts map[string]int) error {
 	day := dates.ExtractDate(dates.Now().In(tz))
 
 	counts := make([]*dailyCount, 0, len(scopeCounts))
 	for scope, count := range scopeCounts {
 		counts = append(counts, &dailyCount{
 			scopedCount: scopedCount{
-				CountType: string(countType),
+				CountType: countType,
 				Scope:     scope,
 				Count:     count,
 			},
@@ -70,6 +70,10 @@ func scopeOrg(oa *OrgAssets) string {
 	return fmt.Sprintf("o:%d", oa.OrgID())
 }
 
+func scopeClassifier(c *Classifier) string {
+	return fmt.Sprintf("c:%d", c.ID())
+}
+
 func scopeTeam(t *Team) string {
 	return fmt.Sprintf("t:%d", t.ID)
 }
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
+)
+
+// how long we remember the last email received from a contact on a channel so that replies can be threaded
+const emailThreadExpiry = 30 * 24 * time.Hour
+
+// matches the message ids we generate for outgoing emails, i.e. <msg-uuid@domain>
+var emailMessageIDRegex = regexp.MustCompile(`<([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})@[^>]+>`)
+
+// EmailThread is the last email received from a contact on an email channel, which outgoing messages reply to
+type EmailThread struct {
+	MessageID  string   `json:"message_id"`
+	Subject    string   `json:"subject"`
+	References []string `json:"references,omitempty"`
+}
+
+var emailThreadKeys = orgkeys.Register("email_thread:%d:%s:%d")
+
+func emailThreadKey(orgID OrgID, channel *Channel, contactID ContactID) string {
+	return emailThreadKeys.Key(int(orgID), channel.UUID(), contactID)
+}
+
+// SetEmailThread records the given email as the last received from the given contact on the given channel
+func SetEmailThread(rc redis.Conn, orgID OrgID, channel *Channel, contactID ContactID, thread *EmailThread) error {
+	_, err := rc.Do("SET", emailThreadKey(orgID, channel, contactID), jsonx.MustMarshal(thread), "EX", int(emailThreadExpiry/time.Second))
+	return errors.Wrap(err, "error setting email thread")
+}
+
+// GetEmailThread gets the last email received from the given contact on the given channel, or nil if there isn't one
+func GetEmailThread(rc redis.Conn, orgID OrgID, channel *Channel, contactID ContactID) (*EmailThread, error) {
+	data, err := redis.Bytes(rc.Do("GET", emailThreadKey(orgID, channel, contactID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting email thread")
+	}
+
+	thread := &EmailThread{}
+	if err := jsonx.Unmarshal(data, thread); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling email thread")
+	}
+	return thread, nil
+}
+
+// EmailMessageID returns the message id header value for the given message sent from the given channel
+func EmailMessageID(msgUUID flows.MsgUUID, channel *Channel) string {
+	domain := channel.Address()
+	if i := strings.LastIndex(domain, "@"); i >= 0 {
+		domain = domain[i+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", msgUUID, domain)
+}
+
+// EmailHTML converts the given plain message text to an HTML body
+func EmailHTML(text string) string {
+	return strings.ReplaceAll(html.EscapeString(text), "\n", "<br>\n")
+}
+
+// adds the subject, HTML body and threading headers needed to send this message as an email
+func (m *Msg) applyEmailHeaders(rt *runtime.Runtime, channel *Channel) error {
+	if channel == nil || channel.Type() != ChannelTypeEmail || m.m.URN.Scheme() != urns.EmailScheme {
+		return nil
+	}
+
+	email := map[string]interface{}{
+		"subject":    channel.ConfigValue(ChannelConfigEmailSubject, ""),
+		"html":       EmailHTML(m.m.Text),
+		"message_id": EmailMessageID(m.m.UUID, channel),
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	thread, err := GetEmailThread(rc, m.m.OrgID, channel, m.m.ContactID)
+	if err != nil {
+		return err
+	}
+
+	// if contact has emailed us, reply to that email
+	if thread != nil {
+		subject := thread.Subject
+		if !strings.HasPrefix(strings.ToLower(subject), "re:") {
+			subject = "Re: " + subject
+		}
+		email["subject"] = subject
+		email["in_reply_to"] = thread.MessageID
+		email["references"] = append(thread.References, thread.MessageID)
+	}
+
+	m.setMetadataValue("email", email)
+
+	return nil
+}
+
+// NewIncomingEmail creates a new incoming message for an email received on the given channel, which is pending until
+// it has been handled
+func NewIncomingEmail(cfg *runtime.Config, orgID OrgID, channel *Channel, contactID ContactID, in *flows.MsgIn, subject, messageID string, createdOn time.Time) *Msg {
+	msg := NewIncomingMsg(cfg, orgID, channel, contactID, in, createdOn)
+
+	m := &msg.m
+	m.Status = MsgStatusPending
+	m.MsgType = MsgTypeInbox
+	m.Metadata = null.NewMap(map[string]interface{}{
+		"email": map[string]interface{}{"subject": subject, "message_id": messageID},
+	})
+
+	return msg
+}
+
+const sqlSelectEmailReplyRecipient = `
+  SELECT m.contact_id, u.id AS contact_urn_id
+    FROM msgs_msg m
+    JOIN contacts_contact c ON c.id = m.contact_id
+    JOIN contacts_contacturn u ON u.contact_id = m.contact_id AND u.identity = $4 AND u.org_id = $2
+   WHERE m.uuid = ANY($1) AND m.org_id = $2 AND m.channel_id = $3 AND m.direction = 'O' AND c.is_active = TRUE
+ORDER BY m.created_on DESC
+   LIMIT 1`
+
+// GetEmailReplyRecipient looks for an email we sent from the given channel which is referenced by the given message
+// ids, e.g. from the In-Reply-To and References headers of an email, and returns the contact it was sent to and their
+// URN for the sender. Since anyone can claim to be replying to an email, a contact is only returned if the sender is
+// one of their URNs.
+func GetEmailReplyRecipient(ctx context.Context, db Queryer, orgID OrgID, channel *Channel, sender urns.URN, messageIDs []string) (ContactID, URNID, error) {
+	uuids := make([]string, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		for _, match := range emailMessageIDRegex.FindAllStringSubmatch(id, -1) {
+			uuids = append(uuids, match[1])
+		}
+	}
+	if len(uuids) == 0 {
+		return NilContactID, NilURNID, nil
+	}
+
+	var recipient struct {
+		ContactID ContactID `db:"contact_id"`
+		URNID     URNID     `db:"contact_urn_id"`
+	}
+
+	rows, err := db.QueryxContext(ctx, sqlSelectEmailReplyRecipient, pq.Array(uuids), orgID, channel.ID(), sender.Identity())
+	if err != nil {
+		return NilContactID, NilURNID, errors.Wrap(err, "error looking up email reply recipient")
+	}
+	defer rows.Close()
+
+	if rows.Next() {
+		if err := rows.StructScan(&recipient); err != nil {
+			return NilContactID, NilURNID, errors.Wrap(err, "error scanning email reply recipient")
+		}
+	}
+
+	return recipient.ContactID, recipient.URNID, rows.Err()
+}
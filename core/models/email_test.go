@@ -0,0 +1,108 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmailHTML(t *testing.T) {
+	assert.Equal(t, "", models.EmailHTML(""))
+	assert.Equal(t, "Hi &lt;b&gt;Bob&lt;/b&gt;<br>\nHow are you?", models.EmailHTML("Hi <b>Bob</b>\nHow are you?"))
+}
+
+func TestEmails(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	emailChannel := testdata.InsertChannel(db, testdata.Org1, models.ChannelTypeEmail, "Email", []string{"mailto"}, "SR", map[string]interface{}{"subject": "Hello"})
+	db.MustExec(`UPDATE channels_channel SET address = 'support@example.com' WHERE id = $1`, emailChannel.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+
+	channel := oa.ChannelByID(emailChannel.ID)
+	require.NotNil(t, channel)
+
+	assert.Equal(t, "<d2f852ec-7b4e-457f-ae7f-f8b243c49ff5@example.com>", models.EmailMessageID("d2f852ec-7b4e-457f-ae7f-f8b243c49ff5", channel))
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	thread, err := models.GetEmailThread(rc, testdata.Org1.ID, channel, testdata.Cathy.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, thread)
+
+	cathyURNID := testdata.InsertContactURN(db, testdata.Org1, testdata.Cathy, "mailto:cathy@example.com", 1000)
+	cathyURN := urns.URN(fmt.Sprintf("mailto:cathy@example.com?id=%d&priority=1000", cathyURNID))
+	session := insertTestSession(t, ctx, rt, testdata.Org1, testdata.Cathy, testdata.Favorites)
+	flow, _ := oa.FlowByID(testdata.Favorites.ID)
+
+	newEmail := func(text string) *models.Msg {
+		out := flows.NewMsgOut(cathyURN, channel.ChannelReference(), text, nil, nil, nil, flows.NilMsgTopic, flows.NilUnsendableReason)
+		msg, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, session, flow, out, time.Now())
+		require.NoError(t, err)
+		return msg
+	}
+
+	// without a thread, emails use the channel's default subject
+	msg := newEmail("Hi <there>\nBye")
+	assert.Equal(t, map[string]interface{}{
+		"subject":    "Hello",
+		"html":       "Hi &lt;there&gt;<br>\nBye",
+		"message_id": models.EmailMessageID(msg.UUID(), channel),
+	}, msg.Metadata()["email"])
+
+	err = models.SetEmailThread(rc, testdata.Org1.ID, channel, testdata.Cathy.ID, &models.EmailThread{MessageID: "<abc@mail.com>", Subject: "Help", References: []string{"<xyz@mail.com>"}})
+	require.NoError(t, err)
+
+	thread, err = models.GetEmailThread(rc, testdata.Org1.ID, channel, testdata.Cathy.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, &models.EmailThread{MessageID: "<abc@mail.com>", Subject: "Help", References: []string{"<xyz@mail.com>"}}, thread)
+
+	// with a thread, emails are sent as replies
+	msg = newEmail("Sure")
+	assert.Equal(t, map[string]interface{}{
+		"subject":     "Re: Help",
+		"html":        "Sure",
+		"message_id":  models.EmailMessageID(msg.UUID(), channel),
+		"in_reply_to": "<abc@mail.com>",
+		"references":  []string{"<xyz@mail.com>", "<abc@mail.com>"},
+	}, msg.Metadata()["email"])
+
+	// threads are per contact
+	thread, err = models.GetEmailThread(rc, testdata.Org1.ID, channel, testdata.Bob.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, thread)
+
+	// replies from the contact that the email was sent to can be mapped back to them
+	out := testdata.InsertOutgoingMsg(db, testdata.Org1, emailChannel, testdata.Cathy, "Hi", nil, models.MsgStatusSent, false)
+
+	contactID, urnID, err := models.GetEmailReplyRecipient(ctx, db, testdata.Org1.ID, channel, "mailto:cathy@example.com", []string{"<abc@mail.com>", models.EmailMessageID(out.UUID(), channel)})
+	assert.NoError(t, err)
+	assert.Equal(t, testdata.Cathy.ID, contactID)
+	assert.Equal(t, cathyURNID, urnID)
+
+	// but not replies from anyone else
+	contactID, _, err = models.GetEmailReplyRecipient(ctx, db, testdata.Org1.ID, channel, "mailto:bob@example.com", []string{models.EmailMessageID(out.UUID(), channel)})
+	assert.NoError(t, err)
+	assert.Equal(t, models.NilContactID, contactID)
+
+	contactID, _, err = models.GetEmailReplyRecipient(ctx, db, testdata.Org1.ID, channel, "mailto:cathy@example.com", []string{fmt.Sprintf("<%s@example.com>", flows.MsgUUID("4bd8e3e8-e9e1-4d84-b3f5-d67c1a1e9a0f"))})
+	assert.NoError(t, err)
+	assert.Equal(t, models.NilContactID, contactID)
+
+	contactID, _, err = models.GetEmailReplyRecipient(ctx, db, testdata.Org1.ID, channel, "mailto:cathy@example.com", []string{"", "<abc@mail.com>"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.NilContactID, contactID)
+}
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/mailroom/runtime"
+	cache "github.com/patrickmn/go-cache"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// names of the feature flags which gate behaviors in mailroom
+const (
+	FeatureMsgBatching = "msg_batching"
+)
+
+// FeatureFlag is a flag used to gradually roll out a new behavior. It's enabled for an org if the org is in its
+// allowlist or falls within the percentage of orgs it's rolled out to.
+type FeatureFlag struct {
+	Name       string        `db:"name"`
+	OrgIDs     pq.Int64Array `db:"org_ids"`
+	Percentage int           `db:"percentage"`
+}
+
+// IsEnabledFor returns whether this flag is enabled for the given org. Orgs are assigned to a percentage bucket by a
+// hash of the flag name and org id, so increasing the percentage of a flag only ever adds orgs to its rollout.
+func (f *FeatureFlag) IsEnabledFor(orgID OrgID) bool {
+	for _, id := range f.OrgIDs {
+		if OrgID(id) == orgID {
+			return true
+		}
+	}
+
+	if f.Percentage <= 0 {
+		return false
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(fmt.Sprintf("%s:%d", f.Name, orgID)))
+	return int(h.Sum32()%100) < f.Percentage
+}
+
+// we cache feature flags for 30 seconds so that changes take effect without a restart, and if they can't be loaded we
+// treat them all as disabled for a few seconds rather than hitting the database on every check
+var featureFlagCache = cache.New(time.Second*30, time.Minute)
+
+const featureFlagsErrorTTL = time.Second * 5
+
+const featureFlagsCacheKey = "flags"
+
+const sqlSelectFeatureFlags = `
+SELECT name, org_ids, percentage
+  FROM orgs_featureflag
+ WHERE is_active = TRUE`
+
+// LoadFeatureFlags loads all active feature flags
+func LoadFeatureFlags(ctx context.Context, db Queryer) (map[string]*FeatureFlag, error) {
+	flags := make([]*FeatureFlag, 0, 10)
+	if err := db.SelectContext(ctx, &flags, sqlSelectFeatureFlags); err != nil {
+		return nil, errors.Wrap(err, "error loading feature flags")
+	}
+
+	byName := make(map[string]*FeatureFlag, len(flags))
+	for _, f := range flags {
+		byName[f.Name] = f
+	}
+	return byName, nil
+}
+
+// IsFeatureEnabled returns whether the named feature flag is enabled for the given org. Flags which don't exist or
+// can't be loaded are treated as disabled. All active flags are cached together so checks of flags which don't exist
+// are cached too.
+func IsFeatureEnabled(ctx context.Context, rt *runtime.Runtime, name string, orgID OrgID) bool {
+	var flags map[string]*FeatureFlag
+
+	cached, found := featureFlagCache.Get(featureFlagsCacheKey)
+	if found {
+		flags = cached.(map[string]*FeatureFlag)
+	} else {
+		var err error
+		flags, err = LoadFeatureFlags(ctx, rt.ReadonlyDB)
+		if err != nil {
+			logrus.WithError(err).WithField("flag", name).Error("error loading feature flags, treating as disabled")
+			featureFlagCache.Set(featureFlagsCacheKey, map[string]*FeatureFlag{}, featureFlagsErrorTTL)
+			return false
+		}
+		featureFlagCache.SetDefault(featureFlagsCacheKey, flags)
+	}
+
+	flag := flags[name]
+	return flag != nil && flag.IsEnabledFor(orgID)
+}
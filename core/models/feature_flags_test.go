@@ -0,0 +1,64 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFeatureFlagIsEnabledFor(t *testing.T) {
+	allowlisted := &models.FeatureFlag{Name: "new_ivr", OrgIDs: pq.Int64Array{1, 3}}
+	assert.True(t, allowlisted.IsEnabledFor(1))
+	assert.True(t, allowlisted.IsEnabledFor(3))
+	assert.False(t, allowlisted.IsEnabledFor(2))
+
+	all := &models.FeatureFlag{Name: "new_ivr", Percentage: 100}
+	none := &models.FeatureFlag{Name: "new_ivr", Percentage: 0}
+	half := &models.FeatureFlag{Name: "new_ivr", Percentage: 50}
+	quarter := &models.FeatureFlag{Name: "new_ivr", Percentage: 25}
+
+	numHalf := 0
+	for i := 1; i <= 1000; i++ {
+		orgID := models.OrgID(i)
+		assert.True(t, all.IsEnabledFor(orgID))
+		assert.False(t, none.IsEnabledFor(orgID))
+
+		// increasing the percentage never removes an org from the rollout
+		if quarter.IsEnabledFor(orgID) {
+			assert.True(t, half.IsEnabledFor(orgID))
+		}
+		if half.IsEnabledFor(orgID) {
+			numHalf++
+		}
+	}
+
+	assert.InDelta(t, 500, numHalf, 75)
+}
+
+func TestIsFeatureEnabled(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer func() {
+		db.MustExec(`DELETE FROM orgs_featureflag`)
+		models.FlushCache()
+	}()
+
+	db.MustExec(`INSERT INTO orgs_featureflag(name, is_active, org_ids, percentage) VALUES('new_ivr', TRUE, '{1}', 0), ('new_imports', FALSE, '{1, 2}', 100)`)
+
+	assert.True(t, models.IsFeatureEnabled(ctx, rt, "new_ivr", testdata.Org1.ID))
+	assert.False(t, models.IsFeatureEnabled(ctx, rt, "new_ivr", testdata.Org2.ID))
+	assert.False(t, models.IsFeatureEnabled(ctx, rt, "new_imports", testdata.Org1.ID)) // inactive
+	assert.False(t, models.IsFeatureEnabled(ctx, rt, "xxxx", testdata.Org1.ID))
+
+	// flags are cached until the cache is flushed
+	db.MustExec(`UPDATE orgs_featureflag SET org_ids = '{1, 2}' WHERE name = 'new_ivr'`)
+	assert.False(t, models.IsFeatureEnabled(ctx, rt, "new_ivr", testdata.Org2.ID))
+
+	models.FlushCache()
+	assert.True(t, models.IsFeatureEnabled(ctx, rt, "new_ivr", testdata.Org2.ID))
+}
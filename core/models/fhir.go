@@ -0,0 +1,396 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+// FHIRConflict is how a contact and its patient are reconciled when both have changed since they were last synced
+type FHIRConflict string
+
+const (
+	FHIRConflictLatest  = FHIRConflict("latest")
+	FHIRConflictFHIR    = FHIRConflict("fhir")
+	FHIRConflictContact = FHIRConflict("contact")
+)
+
+// FHIRSync is an org's configuration for syncing contacts with Patient resources on a FHIR server, e.g.
+//
+//	{
+//	  "url": "https://fhir.example.com/r4",
+//	  "token": "sesame",
+//	  "id_field": "fhir_id",
+//	  "name": "name.0.text",
+//	  "mappings": [
+//	    {"field": "gender", "path": "gender"},
+//	    {"field": "dob", "path": "birthDate"},
+//	    {"field": "district", "path": "address.0.district"}
+//	  ],
+//	  "conflict": "latest"
+//	}
+//
+// Contacts are linked to patients by the patient id saved in the id field. Changes to linked contacts are pushed to
+// their patients, and changes to patients are pulled into their contacts. Paths are dotted paths into the Patient
+// resource where numbers index arrays. When both sides have changed since they were last synced, conflict decides which
+// wins: the side most recently updated, the FHIR server or the contact.
+type FHIRSync struct {
+	URL      string         `json:"url"      validate:"required,url,startswith=https:"`
+	Token    string         `json:"token"`
+	IDField  string         `json:"id_field" validate:"required"`
+	Name     string         `json:"name"`
+	Mappings []*FHIRMapping `json:"mappings" validate:"dive"`
+	Conflict FHIRConflict   `json:"conflict" validate:"omitempty,eq=latest|eq=fhir|eq=contact"`
+}
+
+// FHIRMapping maps a contact field to a path in a Patient resource
+type FHIRMapping struct {
+	Field string `json:"field" validate:"required"`
+	Path  string `json:"path"  validate:"required"`
+}
+
+// ReadFHIRSync reads and validates FHIR sync config from the given JSON
+func ReadFHIRSync(data []byte) (*FHIRSync, error) {
+	s := &FHIRSync{}
+	if err := utils.UnmarshalAndValidate(data, s); err != nil {
+		return nil, err
+	}
+	if s.Name == "" && len(s.Mappings) == 0 {
+		return nil, errors.New("at least one of name and mappings is required")
+	}
+	if s.Conflict == "" {
+		s.Conflict = FHIRConflictLatest
+	}
+	return s, nil
+}
+
+// reads FHIR sync config from the given org config value
+func readFHIRSyncConfig(v interface{}) (*FHIRSync, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadFHIRSync(data)
+}
+
+// ContactWins returns whether a contact which changed at the given time should win over its patient which changed at
+// the given time, when both have changed since they were last synced
+func (s *FHIRSync) ContactWins(contactModified, patientUpdated time.Time) bool {
+	switch s.Conflict {
+	case FHIRConflictFHIR:
+		return false
+	case FHIRConflictContact:
+		return true
+	default:
+		return contactModified.After(patientUpdated)
+	}
+}
+
+// PatientID returns the id of the patient the given contact is linked to, or empty if it isn't linked
+func (s *FHIRSync) PatientID(oa *OrgAssets, contact *flows.Contact) string {
+	return s.fieldValue(oa, contact, s.IDField)
+}
+
+// PatientChanged returns whether the mapped values of the given patient differ from those of the given contact
+func (s *FHIRSync) PatientChanged(oa *OrgAssets, contact *flows.Contact, patient FHIRPatient) bool {
+	if s.Name != "" && patient.Get(s.Name) != contact.Name() {
+		return true
+	}
+	for _, m := range s.Mappings {
+		if patient.Get(m.Path) != s.fieldValue(oa, contact, m.Field) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdatePatient sets the mapped values of the given patient from those of the given contact
+func (s *FHIRSync) UpdatePatient(oa *OrgAssets, contact *flows.Contact, patient FHIRPatient) {
+	if s.Name != "" {
+		patient.Set(s.Name, contact.Name())
+	}
+	for _, m := range s.Mappings {
+		patient.Set(m.Path, s.fieldValue(oa, contact, m.Field))
+	}
+}
+
+// ContactModifiers returns the modifiers which will update the given contact with the mapped values of the given
+// patient. Values which haven't changed aren't modified.
+func (s *FHIRSync) ContactModifiers(oa *OrgAssets, contact *flows.Contact, patient FHIRPatient) []flows.Modifier {
+	mods := make([]flows.Modifier, 0, len(s.Mappings)+1)
+
+	if s.Name != "" {
+		if name := patient.Get(s.Name); name != contact.Name() {
+			mods = append(mods, modifiers.NewName(name))
+		}
+	}
+	for _, m := range s.Mappings {
+		field := oa.SessionAssets().Fields().Get(m.Field)
+		if field == nil {
+			continue
+		}
+		if value := patient.Get(m.Path); value != s.fieldValue(oa, contact, m.Field) {
+			mods = append(mods, modifiers.NewField(field, value))
+		}
+	}
+	return mods
+}
+
+func (s *FHIRSync) fieldValue(oa *OrgAssets, contact *flows.Contact, key string) string {
+	field := oa.SessionAssets().Fields().Get(key)
+	if field == nil {
+		return ""
+	}
+	if value := contact.Fields().Get(field); value != nil {
+		return value.Text.Native()
+	}
+	return ""
+}
+
+// FHIRPatient is a Patient resource read from a FHIR server. Only the mapped parts of a patient are modified, so that
+// anything else is written back as it was read.
+type FHIRPatient map[string]interface{}
+
+// ID returns the id of this patient
+func (p FHIRPatient) ID() string { return p.Get("id") }
+
+// VersionID returns the version of this patient, which changes every time it's updated
+func (p FHIRPatient) VersionID() string { return p.Get("meta.versionId") }
+
+// LastUpdated returns when this patient was last updated
+func (p FHIRPatient) LastUpdated() time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, p.Get("meta.lastUpdated"))
+	return t
+}
+
+// Get returns the value at the given dotted path in this patient as a string, or empty if there's nothing there
+func (p FHIRPatient) Get(path string) string {
+	var v interface{} = map[string]interface{}(p)
+
+	for _, key := range strings.Split(path, ".") {
+		switch typed := v.(type) {
+		case map[string]interface{}:
+			v = typed[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(typed) {
+				return ""
+			}
+			v = typed[i]
+		default:
+			return ""
+		}
+	}
+
+	switch typed := v.(type) {
+	case string:
+		return typed
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	default:
+		return fmt.Sprint(typed)
+	}
+}
+
+// Set sets the value at the given dotted path in this patient, creating any objects or arrays along the way. Setting
+// an empty value removes it.
+func (p FHIRPatient) Set(path string, value string) {
+	keys := strings.Split(path, ".")
+
+	var set func(container interface{}, keys []string) interface{}
+	set = func(container interface{}, keys []string) interface{} {
+		key := keys[0]
+		index, err := strconv.Atoi(key)
+		isIndex := err == nil && index >= 0
+
+		// the value at this key, replacing it if it's the wrong type of container for the next key
+		var current interface{}
+		if isIndex {
+			arr, _ := container.([]interface{})
+			for len(arr) <= index {
+				arr = append(arr, nil)
+			}
+			container, current = arr, arr[index]
+		} else {
+			obj, _ := container.(map[string]interface{})
+			if obj == nil {
+				obj = make(map[string]interface{})
+			}
+			container, current = obj, obj[key]
+		}
+
+		var updated interface{}
+		if len(keys) == 1 {
+			if value != "" {
+				updated = value
+			}
+		} else if updated = set(current, keys[1:]); isEmptyFHIRValue(updated) {
+			updated = nil
+		}
+
+		if isIndex {
+			container.([]interface{})[index] = updated
+		} else if updated == nil {
+			delete(container.(map[string]interface{}), key)
+		} else {
+			container.(map[string]interface{})[key] = updated
+		}
+		return container
+	}
+
+	set(map[string]interface{}(p), keys)
+}
+
+// whether the given value has nothing in it, so that clearing a value doesn't leave empty objects behind
+func isEmptyFHIRValue(v interface{}) bool {
+	switch typed := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(typed) == 0
+	case []interface{}:
+		for _, item := range typed {
+			if !isEmptyFHIRValue(item) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// FHIRPush is the task to push the given contacts to their patients
+type FHIRPush struct {
+	ContactIDs []ContactID `json:"contact_ids" validate:"required"`
+}
+
+// FHIRSyncState is the version of a patient which a contact was last synced with, and when
+type FHIRSyncState struct {
+	VersionID string    `json:"version_id"`
+	SyncedOn  time.Time `json:"synced_on"`
+}
+
+var fhirSyncStatesKeys = orgkeys.Register("fhir_sync_states:%d")
+
+func fhirSyncStatesKey(orgID OrgID) string {
+	return fhirSyncStatesKeys.Key(int(orgID))
+}
+
+var fhirPulledKeys = orgkeys.Register("fhir_pulled:%d")
+
+func fhirPulledKey(orgID OrgID) string {
+	return fhirPulledKeys.Key(int(orgID))
+}
+
+// GetFHIRSyncStates gets the sync states of the given contacts, omitting any which have never been synced
+func GetFHIRSyncStates(rc redis.Conn, orgID OrgID, contactIDs []ContactID) (map[ContactID]*FHIRSyncState, error) {
+	states := make(map[ContactID]*FHIRSyncState, len(contactIDs))
+	if len(contactIDs) == 0 {
+		return states, nil
+	}
+
+	values, err := redis.ByteSlices(rc.Do("HMGET", redis.Args{fhirSyncStatesKey(orgID)}.AddFlat(contactIDs)...))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading FHIR sync states")
+	}
+
+	for i, v := range values {
+		if v == nil {
+			continue
+		}
+		state := &FHIRSyncState{}
+		if err := json.Unmarshal(v, state); err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling FHIR sync state")
+		}
+		states[contactIDs[i]] = state
+	}
+	return states, nil
+}
+
+// SetFHIRSyncStates saves the sync states of the given contacts
+func SetFHIRSyncStates(rc redis.Conn, orgID OrgID, states map[ContactID]*FHIRSyncState) error {
+	if len(states) == 0 {
+		return nil
+	}
+
+	args := redis.Args{fhirSyncStatesKey(orgID)}
+	for contactID, state := range states {
+		args = append(args, contactID, jsonx.MustMarshal(state))
+	}
+
+	_, err := rc.Do("HSET", args...)
+	return errors.Wrap(err, "error saving FHIR sync states")
+}
+
+// GetFHIRPulledOn gets when patients were last pulled for the given org, or zero if they never have been
+func GetFHIRPulledOn(rc redis.Conn, orgID OrgID) (time.Time, error) {
+	ms, err := redis.Int64(rc.Do("GET", fhirPulledKey(orgID)))
+	if err == redis.ErrNil {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, errors.Wrap(err, "error reading FHIR pulled on")
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// SetFHIRPulledOn saves when patients were last pulled for the given org
+func SetFHIRPulledOn(rc redis.Conn, orgID OrgID, t time.Time) error {
+	_, err := rc.Do("SET", fhirPulledKey(orgID), t.UnixMilli())
+	return errors.Wrap(err, "error saving FHIR pulled on")
+}
+
+const sqlSelectFHIRSyncOrgs = `
+  SELECT id
+    FROM orgs_org
+   WHERE is_active = TRUE AND (config::json)->'fhir_sync' IS NOT NULL
+ORDER BY id`
+
+// LoadFHIRSyncOrgs loads the ids of the orgs which sync contacts with a FHIR server
+func LoadFHIRSyncOrgs(ctx context.Context, db Queryer) ([]OrgID, error) {
+	orgIDs := make([]OrgID, 0, 10)
+	if err := db.SelectContext(ctx, &orgIDs, sqlSelectFHIRSyncOrgs); err != nil {
+		return nil, errors.Wrap(err, "error loading orgs with FHIR sync")
+	}
+	return orgIDs, nil
+}
+
+const sqlSelectContactsByPatientID = `
+SELECT id, fields->$2->>'text' AS patient_id
+  FROM contacts_contact
+ WHERE org_id = $1 AND is_active = TRUE AND fields->$2->>'text' = ANY($3)`
+
+// LoadContactIDsByPatientID loads the ids of the contacts linked to the given patients
+func LoadContactIDsByPatientID(ctx context.Context, db Queryer, oa *OrgAssets, patientIDs []string) (map[string]ContactID, error) {
+	field := oa.FieldByKey(oa.Org().FHIRSync().IDField)
+	if field == nil {
+		return nil, errors.Errorf("no field with key %s", oa.Org().FHIRSync().IDField)
+	}
+
+	rows := make([]struct {
+		ID        ContactID `db:"id"`
+		PatientID string    `db:"patient_id"`
+	}, 0, len(patientIDs))
+
+	if err := db.SelectContext(ctx, &rows, sqlSelectContactsByPatientID, oa.OrgID(), field.UUID(), pq.Array(patientIDs)); err != nil {
+		return nil, errors.Wrap(err, "error loading contacts by patient id")
+	}
+
+	contactIDs := make(map[string]ContactID, len(rows))
+	for _, r := range rows {
+		contactIDs[r.PatientID] = r.ID
+	}
+	return contactIDs, nil
+}
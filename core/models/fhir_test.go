@@ -0,0 +1,106 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFHIRSync(t *testing.T) {
+	s, err := models.ReadFHIRSync([]byte(`{
+		"url": "https://fhir.example.com/r4",
+		"id_field": "fhir_id",
+		"mappings": [{"field": "gender", "path": "gender"}]
+	}`))
+	require.NoError(t, err)
+	assert.Equal(t, models.FHIRConflictLatest, s.Conflict)
+
+	_, err = models.ReadFHIRSync([]byte(`{"url": "http://fhir.example.com/r4", "id_field": "fhir_id", "name": "name.0.text"}`))
+	assert.EqualError(t, err, "field 'url' must start with 'https:'")
+
+	_, err = models.ReadFHIRSync([]byte(`{"url": "https://fhir.example.com/r4", "id_field": "fhir_id"}`))
+	assert.EqualError(t, err, "at least one of name and mappings is required")
+
+	t1 := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	t2 := time.Date(2022, 10, 2, 12, 0, 0, 0, time.UTC)
+
+	assert.True(t, s.ContactWins(t2, t1))
+	assert.False(t, s.ContactWins(t1, t2))
+
+	s.Conflict = models.FHIRConflictFHIR
+	assert.False(t, s.ContactWins(t2, t1))
+
+	s.Conflict = models.FHIRConflictContact
+	assert.True(t, s.ContactWins(t1, t2))
+}
+
+func TestFHIRPatient(t *testing.T) {
+	patient := models.FHIRPatient{}
+	jsonx.MustUnmarshal([]byte(`{
+		"resourceType": "Patient",
+		"id": "123",
+		"meta": {"versionId": "4", "lastUpdated": "2022-10-01T12:00:00.123Z"},
+		"name": [{"given": ["Ann", "Marie"], "family": "Smith"}],
+		"gender": "female",
+		"multipleBirthInteger": 2
+	}`), &patient)
+
+	assert.Equal(t, "123", patient.ID())
+	assert.Equal(t, "4", patient.VersionID())
+	assert.Equal(t, time.Date(2022, 10, 1, 12, 0, 0, 123000000, time.UTC), patient.LastUpdated())
+	assert.Equal(t, "Marie", patient.Get("name.0.given.1"))
+	assert.Equal(t, "Smith", patient.Get("name.0.family"))
+	assert.Equal(t, "2", patient.Get("multipleBirthInteger"))
+	assert.Equal(t, "", patient.Get("name.1.family"))
+	assert.Equal(t, "", patient.Get("name.0"))
+	assert.Equal(t, "", patient.Get("gender.x"))
+
+	patient.Set("name.0.family", "Jones")
+	patient.Set("address.0.district", "Kigali")
+	patient.Set("gender", "")
+	patient.Set("telecom.1.value", "")
+
+	assert.JSONEq(t, `{
+		"resourceType": "Patient",
+		"id": "123",
+		"meta": {"versionId": "4", "lastUpdated": "2022-10-01T12:00:00.123Z"},
+		"name": [{"given": ["Ann", "Marie"], "family": "Jones"}],
+		"address": [{"district": "Kigali"}],
+		"multipleBirthInteger": 2
+	}`, string(jsonx.MustMarshal(patient)))
+}
+
+func TestFHIRSyncStates(t *testing.T) {
+	_, _, _, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	syncedOn := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	err := models.SetFHIRSyncStates(rc, testdata.Org1.ID, map[models.ContactID]*models.FHIRSyncState{testdata.Cathy.ID: {VersionID: "3", SyncedOn: syncedOn}})
+	require.NoError(t, err)
+
+	states, err := models.GetFHIRSyncStates(rc, testdata.Org1.ID, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID})
+	require.NoError(t, err)
+	assert.Equal(t, map[models.ContactID]*models.FHIRSyncState{testdata.Cathy.ID: {VersionID: "3", SyncedOn: syncedOn}}, states)
+
+	pulledOn, err := models.GetFHIRPulledOn(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.True(t, pulledOn.IsZero())
+
+	err = models.SetFHIRPulledOn(rc, testdata.Org1.ID, syncedOn)
+	require.NoError(t, err)
+
+	pulledOn, err = models.GetFHIRPulledOn(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, syncedOn, pulledOn)
+}
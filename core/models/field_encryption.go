@@ -0,0 +1,200 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+const configFieldEncryption = "field_encryption"
+
+// FieldEncryption is an org's configuration for encrypting the values of sensitive contact fields at rest. Values are
+// encrypted with the org's data key, which is itself stored encrypted by a master key in KMS (envelope encryption) and
+// only decrypted when the org's assets are loaded.
+//
+//	{
+//	  "key": "AQIDAHhB...",
+//	  "fields": ["national_id", "hiv_status"]
+//	}
+//
+// Values of sensitive fields can't be searched on or used as the basis of campaign events.
+type FieldEncryption struct {
+	Key    string   `json:"key"    validate:"required,base64"`
+	Fields []string `json:"fields" validate:"required,min=1,dive,required"`
+}
+
+// ReadFieldEncryption reads and validates field encryption config from the given JSON
+func ReadFieldEncryption(data []byte) (*FieldEncryption, error) {
+	e := &FieldEncryption{}
+	if err := utils.UnmarshalAndValidate(data, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// IsSensitive returns whether the field with the given key is encrypted
+func (e *FieldEncryption) IsSensitive(key string) bool {
+	for _, k := range e.Fields {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func readFieldEncryptionConfig(v interface{}) (*FieldEncryption, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadFieldEncryption(data)
+}
+
+// FieldEncryption returns the field encryption config for this org if it has one
+func (o *Org) FieldEncryption() *FieldEncryption { return o.fieldEncryption }
+
+// IsSensitiveField returns whether values of the field with the given key are encrypted for this org
+func (o *Org) IsSensitiveField(key string) bool {
+	return o.fieldEncryption != nil && o.fieldEncryption.IsSensitive(key)
+}
+
+// unlocks the org's data key using the given key service so that field values can be encrypted and decrypted
+func (o *Org) unlockFieldEncryption(ctx context.Context, ks runtime.KeyService) error {
+	if o.fieldEncryption == nil {
+		return nil
+	}
+	if ks == nil {
+		return errors.New("no key service configured")
+	}
+
+	encrypted, _ := base64.StdEncoding.DecodeString(o.fieldEncryption.Key)
+
+	key, err := ks.Decrypt(ctx, encrypted)
+	if err != nil {
+		return errors.Wrap(err, "error decrypting data key")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return errors.Wrap(err, "invalid data key")
+	}
+
+	o.fieldCipher, err = cipher.NewGCM(block)
+	return err
+}
+
+// EncryptedFieldValue is how the value of a sensitive field is stored in the contact's fields JSON
+type EncryptedFieldValue struct {
+	Encrypted string `json:"encrypted"`
+}
+
+// EncryptFieldValue encrypts the given field value with the org's data key
+func (o *Org) EncryptFieldValue(value *flows.Value) (*EncryptedFieldValue, error) {
+	if o.fieldCipher == nil {
+		return nil, errors.Errorf("data key for org %d is not available", o.ID())
+	}
+
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, o.fieldCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := o.fieldCipher.Seal(nonce, nonce, plaintext, nil)
+
+	return &EncryptedFieldValue{Encrypted: base64.StdEncoding.EncodeToString(sealed)}, nil
+}
+
+// the placeholder which replaces the values of sensitive fields in session output
+var redactedFieldValue = map[string]interface{}{"text": "********"}
+
+// RedactSensitiveFields replaces the values of sensitive fields in the given marshalled flow session, so that values
+// which were decrypted to run the session are never stored in plaintext in its output or runs. Values are redacted
+// wherever a contact appears, i.e. the session's contact and trigger, and in contact_field_changed events. Sessions
+// are always resumed with contacts freshly loaded from the database so redacted values are never read back.
+func (o *Org) RedactSensitiveFields(output []byte) ([]byte, error) {
+	if o.fieldEncryption == nil {
+		return output, nil
+	}
+
+	d := json.NewDecoder(bytes.NewReader(output))
+	d.UseNumber()
+
+	var session interface{}
+	if err := d.Decode(&session); err != nil {
+		return nil, errors.Wrap(err, "error decoding session output")
+	}
+
+	o.redactSensitiveFields(session)
+
+	return jsonx.Marshal(session)
+}
+
+// walks the given decoded JSON redacting any sensitive field values
+func (o *Org) redactSensitiveFields(v interface{}) {
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		if contact, ok := typed["contact"].(map[string]interface{}); ok {
+			if fields, ok := contact["fields"].(map[string]interface{}); ok {
+				for key := range fields {
+					if o.IsSensitiveField(key) {
+						fields[key] = redactedFieldValue
+					}
+				}
+			}
+		}
+		if typed["type"] == "contact_field_changed" {
+			if field, ok := typed["field"].(map[string]interface{}); ok && typed["value"] != nil {
+				if key, _ := field["key"].(string); o.IsSensitiveField(key) {
+					typed["value"] = redactedFieldValue
+				}
+			}
+		}
+		for _, child := range typed {
+			o.redactSensitiveFields(child)
+		}
+	case []interface{}:
+		for _, child := range typed {
+			o.redactSensitiveFields(child)
+		}
+	}
+}
+
+// DecryptFieldValue decrypts the given value of a sensitive field with the org's data key
+func (o *Org) DecryptFieldValue(encrypted string) (*flows.Value, error) {
+	if o.fieldCipher == nil {
+		return nil, errors.Errorf("data key for org %d is not available", o.ID())
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < o.fieldCipher.NonceSize() {
+		return nil, errors.New("invalid encrypted field value")
+	}
+
+	nonce, ciphertext := sealed[:o.fieldCipher.NonceSize()], sealed[o.fieldCipher.NonceSize():]
+
+	plaintext, err := o.fieldCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error decrypting field value")
+	}
+
+	value := &flows.Value{}
+	if err := json.Unmarshal(plaintext, value); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling decrypted field value")
+	}
+	return value, nil
+}
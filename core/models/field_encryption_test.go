@@ -0,0 +1,87 @@
+package models_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/excellent/types"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// key service which "decrypts" data keys by reversing them
+type testKeyService struct{}
+
+func (s *testKeyService) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	key := make([]byte, len(ciphertext))
+	for i := range ciphertext {
+		key[i] = ciphertext[len(ciphertext)-1-i]
+	}
+	return key, nil
+}
+
+func TestReadFieldEncryption(t *testing.T) {
+	e, err := models.ReadFieldEncryption([]byte(`{"key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", "fields": ["national_id"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"national_id"}, e.Fields)
+	assert.True(t, e.IsSensitive("national_id"))
+	assert.False(t, e.IsSensitive("gender"))
+
+	_, err = models.ReadFieldEncryption([]byte(`{"fields": ["national_id"]}`))
+	assert.EqualError(t, err, "field 'key' is required")
+
+	_, err = models.ReadFieldEncryption([]byte(`{"key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", "fields": []}`))
+	assert.EqualError(t, err, "field 'fields' must have a minimum of 1 items")
+}
+
+func TestFieldEncryption(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+	defer func() { rt.KMS = nil }()
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"field_encryption": {"key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", "fields": ["gender"]}}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	// without a key service, org still loads but values can't be encrypted
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+	assert.True(t, oa.Org().IsSensitiveField("gender"))
+	assert.False(t, oa.Org().IsSensitiveField("age"))
+
+	_, err = oa.Org().EncryptFieldValue(flows.NewValue(types.NewXText("M"), nil, nil, "", "", ""))
+	assert.EqualError(t, err, fmt.Sprintf("data key for org %d is not available", testdata.Org1.ID))
+
+	rt.KMS = &testKeyService{}
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	encrypted, err := oa.Org().EncryptFieldValue(flows.NewValue(types.NewXText("M"), nil, nil, "", "", ""))
+	require.NoError(t, err)
+
+	// write encrypted value to the database as the field changes hook would
+	db.MustExec(`UPDATE contacts_contact SET fields = jsonb_build_object($2::text, $3::jsonb) WHERE id = $1`, testdata.Cathy.ID, testdata.GenderField.UUID, string(jsonx.MustMarshal(encrypted)))
+
+	contacts, err := models.LoadContacts(ctx, db, oa, []models.ContactID{testdata.Cathy.ID})
+	require.NoError(t, err)
+	assert.Equal(t, flows.NewValue(types.NewXText("M"), nil, nil, "", "", ""), contacts[0].Fields()["gender"])
+
+	// sensitive values are redacted from session output
+	output, err := oa.Org().RedactSensitiveFields([]byte(`{"contact": {"fields": {"gender": {"text": "M"}, "age": {"text": "30", "number": 30}}}, "runs": [{"events": [{"type": "contact_field_changed", "field": {"key": "gender", "name": "Gender"}, "value": {"text": "M"}}]}]}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"contact": {"fields": {"gender": {"text": "********"}, "age": {"text": "30", "number": 30}}}, "runs": [{"events": [{"type": "contact_field_changed", "field": {"key": "gender", "name": "Gender"}, "value": {"text": "********"}}]}]}`, string(output))
+
+	// a value which can't be decrypted is an error
+	db.MustExec(`UPDATE contacts_contact SET fields = jsonb_build_object($2::text, jsonb_build_object('encrypted', 'xyz')) WHERE id = $1`, testdata.Cathy.ID, testdata.GenderField.UUID)
+
+	_, err = models.LoadContacts(ctx, db, oa, []models.ContactID{testdata.Cathy.ID})
+	assert.ErrorContains(t, err, fmt.Sprintf("unable to decrypt value of field 'gender' for contact %d", testdata.Cathy.ID))
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+const (
+	fieldRecalculationBatchSize   = 100
+	fieldRecalculationMaxFailures = 100
+	fieldRecalculationExpiry      = time.Hour * 24 * 7
+)
+
+// FieldRecalculationFailure is a contact whose value couldn't be parsed as the new type of its field
+type FieldRecalculationFailure struct {
+	ContactID ContactID `json:"contact_id"`
+	Value     string    `json:"value"`
+}
+
+// FieldRecalculationReport is the result of reparsing the values of a field after its type has changed
+type FieldRecalculationReport struct {
+	FieldKey    string                       `json:"field_key"`
+	FieldType   assets.FieldType             `json:"field_type"`
+	Scanned     int                          `json:"scanned"`
+	Updated     int                          `json:"updated"`
+	Failed      int                          `json:"failed"`
+	Failures    []*FieldRecalculationFailure `json:"failures"`
+	CompletedOn time.Time                    `json:"completed_on"`
+}
+
+const sqlSelectContactsWithFieldBatch = `
+  SELECT id
+    FROM contacts_contact
+   WHERE org_id = $1 AND is_active = TRUE AND fields ? $2 AND id > $3
+ORDER BY id
+   LIMIT $4`
+
+// RecalculateFieldValues reparses the values of the given field for all contacts in the org that have one, e.g. after
+// the field's type has changed from text to datetime. Values are updated through modifiers so they're written and have
+// their side effects, e.g. rescheduling campaign events, as if they'd been set by a user.
+func RecalculateFieldValues(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, field *Field) (*FieldRecalculationReport, error) {
+	flowField := oa.SessionAssets().Fields().Get(field.Key())
+	if flowField == nil {
+		return nil, errors.Errorf("no field with key %s", field.Key())
+	}
+
+	report := &FieldRecalculationReport{FieldKey: field.Key(), FieldType: field.Type(), Failures: []*FieldRecalculationFailure{}}
+	lastID := NilContactID
+
+	for {
+		ids := make([]ContactID, 0, fieldRecalculationBatchSize)
+		if err := rt.DB.SelectContext(ctx, &ids, sqlSelectContactsWithFieldBatch, oa.OrgID(), field.UUID(), lastID, fieldRecalculationBatchSize); err != nil {
+			return nil, errors.Wrap(err, "error selecting contacts with field value")
+		}
+		if len(ids) == 0 {
+			break
+		}
+		lastID = ids[len(ids)-1]
+
+		contacts, err := LoadContacts(ctx, rt.DB, oa, ids)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading contacts")
+		}
+
+		withValues := make([]*flows.Contact, 0, len(contacts))
+		modifiersByContact := make(map[*flows.Contact][]flows.Modifier, len(contacts))
+		for _, c := range contacts {
+			contact, err := c.FlowContact(oa)
+			if err != nil {
+				return nil, errors.Wrapf(err, "error creating flow contact for contact %d", c.ID())
+			}
+
+			if value := contact.Fields().Get(flowField); value != nil {
+				withValues = append(withValues, contact)
+				modifiersByContact[contact] = []flows.Modifier{modifiers.NewField(flowField, value.Text.Native())}
+			}
+		}
+
+		eventsByContact, err := ApplyModifiers(ctx, rt, oa, NilUserID, modifiersByContact)
+		if err != nil {
+			return nil, errors.Wrap(err, "error applying field modifiers")
+		}
+
+		for _, contact := range withValues {
+			report.Scanned++
+
+			if len(eventsByContact[contact]) > 0 {
+				report.Updated++
+			}
+
+			value := contact.Fields().Get(flowField)
+			if !valueHasType(value, field.Type()) {
+				report.Failed++
+
+				if len(report.Failures) < fieldRecalculationMaxFailures {
+					report.Failures = append(report.Failures, &FieldRecalculationFailure{ContactID: ContactID(contact.ID()), Value: value.Text.Native()})
+				}
+			}
+		}
+	}
+
+	report.CompletedOn = time.Now()
+	return report, nil
+}
+
+// checks whether the given value has a value of the given type
+func valueHasType(value *flows.Value, fieldType assets.FieldType) bool {
+	switch fieldType {
+	case assets.FieldTypeDatetime:
+		return value.Datetime != nil
+	case assets.FieldTypeNumber:
+		return value.Number != nil
+	case assets.FieldTypeState:
+		return value.State != ""
+	case assets.FieldTypeDistrict:
+		return value.District != ""
+	case assets.FieldTypeWard:
+		return value.Ward != ""
+	}
+	return true
+}
+
+var fieldRecalculationKeys = orgkeys.Register("field_recalculation:%d:%s")
+
+func fieldRecalculationKey(orgID OrgID, fieldKey string) string {
+	return fieldRecalculationKeys.Key(int(orgID), fieldKey)
+}
+
+// SetFieldRecalculationReport records the given report as the latest recalculation report for its field
+func SetFieldRecalculationReport(rc redis.Conn, orgID OrgID, report *FieldRecalculationReport) error {
+	_, err := rc.Do("SET", fieldRecalculationKey(orgID, report.FieldKey), jsonx.MustMarshal(report), "EX", int(fieldRecalculationExpiry/time.Second))
+	return errors.Wrap(err, "error setting field recalculation report")
+}
+
+// GetFieldRecalculationReport gets the latest recalculation report for the given field, or nil if there isn't one
+func GetFieldRecalculationReport(rc redis.Conn, orgID OrgID, fieldKey string) (*FieldRecalculationReport, error) {
+	data, err := redis.Bytes(rc.Do("GET", fieldRecalculationKey(orgID, fieldKey)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting field recalculation report")
+	}
+
+	report := &FieldRecalculationReport{}
+	if err := jsonx.Unmarshal(data, report); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling field recalculation report")
+	}
+	return report, nil
+}
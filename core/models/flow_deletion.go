@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// FlowDependents are the active objects which would start a flow, and so need to be removed or changed before that
+// flow can be deleted
+type FlowDependents struct {
+	Triggers       []TriggerID       `json:"triggers"`
+	CampaignEvents []CampaignEventID `json:"campaign_events"`
+	Flows          []FlowID          `json:"flows"`
+}
+
+// IsEmpty returns whether there are no dependents
+func (d *FlowDependents) IsEmpty() bool {
+	return len(d.Triggers) == 0 && len(d.CampaignEvents) == 0 && len(d.Flows) == 0
+}
+
+const sqlSelectFlowDependentTriggers = `
+SELECT id FROM triggers_trigger WHERE flow_id = $1 AND is_active = TRUE AND is_archived = FALSE ORDER BY id`
+
+const sqlSelectFlowDependentCampaignEvents = `
+SELECT e.id
+  FROM campaigns_campaignevent e
+  JOIN campaigns_campaign c ON c.id = e.campaign_id
+ WHERE e.flow_id = $1 AND e.is_active = TRUE AND c.is_active = TRUE AND c.is_archived = FALSE
+ORDER BY e.id`
+
+const sqlSelectFlowDependentFlows = `
+SELECT f.id
+  FROM flows_flow_flow_dependencies d
+  JOIN flows_flow f ON f.id = d.from_flow_id
+ WHERE d.to_flow_id = $1 AND f.is_active = TRUE AND f.is_archived = FALSE
+ORDER BY f.id`
+
+// GetFlowDependents gets the active triggers, campaign events and flows which depend on the given flow
+func GetFlowDependents(ctx context.Context, db Queryer, flowID FlowID) (*FlowDependents, error) {
+	d := &FlowDependents{Triggers: []TriggerID{}, CampaignEvents: []CampaignEventID{}, Flows: []FlowID{}}
+
+	if err := db.SelectContext(ctx, &d.Triggers, sqlSelectFlowDependentTriggers, flowID); err != nil {
+		return nil, errors.Wrapf(err, "error selecting dependent triggers for flow #%d", flowID)
+	}
+	if err := db.SelectContext(ctx, &d.CampaignEvents, sqlSelectFlowDependentCampaignEvents, flowID); err != nil {
+		return nil, errors.Wrapf(err, "error selecting dependent campaign events for flow #%d", flowID)
+	}
+	if err := db.SelectContext(ctx, &d.Flows, sqlSelectFlowDependentFlows, flowID); err != nil {
+		return nil, errors.Wrapf(err, "error selecting dependent flows for flow #%d", flowID)
+	}
+	return d, nil
+}
+
+// IsFlowDeleted returns whether the given flow exists but has been soft-deleted
+func IsFlowDeleted(ctx context.Context, db Queryer, orgID OrgID, flowID FlowID) (bool, error) {
+	var deleted bool
+	err := db.GetContext(ctx, &deleted, `SELECT count(*) > 0 FROM flows_flow WHERE org_id = $1 AND id = $2 AND is_active = FALSE`, orgID, flowID)
+	if err != nil {
+		return false, errors.Wrapf(err, "error checking whether flow #%d is deleted", flowID)
+	}
+	return deleted, nil
+}
+
+// DeleteFlows soft-deletes the given flows so that they can later be restored
+func DeleteFlows(ctx context.Context, db Queryer, orgID OrgID, flowIDs []FlowID) error {
+	_, err := db.ExecContext(ctx, `UPDATE flows_flow SET is_active = FALSE, modified_on = NOW() WHERE org_id = $1 AND id = ANY($2)`, orgID, pq.Array(flowIDs))
+	return errors.Wrap(err, "error deleting flows")
+}
+
+// RestoreFlows restores the given soft-deleted flows
+func RestoreFlows(ctx context.Context, db Queryer, orgID OrgID, flowIDs []FlowID) error {
+	_, err := db.ExecContext(ctx, `UPDATE flows_flow SET is_active = TRUE, modified_on = NOW() WHERE org_id = $1 AND id = ANY($2)`, orgID, pq.Array(flowIDs))
+	return errors.Wrap(err, "error restoring flows")
+}
+
+// LoadDeletedFlowByID loads the given soft-deleted flow, returning nil if it doesn't exist or isn't deleted
+func LoadDeletedFlowByID(ctx context.Context, db Queryer, orgID OrgID, flowID FlowID) (*Flow, error) {
+	return loadFlow(ctx, db, sqlSelectDeletedFlowByID, orgID, flowID)
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+const flowFunnelExpiry = time.Hour * 24 * 7
+
+// FlowFunnelNode is the number of runs which passed through a node of a flow, and how many of those ended there
+// without completing the flow, i.e. were interrupted, expired or failed
+type FlowFunnelNode struct {
+	NodeUUID    flows.NodeUUID `json:"node_uuid"`
+	Visits      int            `json:"visits"`
+	DropOffs    int            `json:"drop_offs"`
+	DropOffRate float64        `json:"drop_off_rate"`
+}
+
+// FlowFunnel is the pass-through and drop-off counts of each node of a flow for the runs created in a date range
+type FlowFunnel struct {
+	FlowUUID   assets.FlowUUID   `json:"flow_uuid"`
+	Since      time.Time         `json:"since"`
+	Until      time.Time         `json:"until"`
+	Runs       int               `json:"runs"`
+	Nodes      []*FlowFunnelNode `json:"nodes"`
+	ComputedOn time.Time         `json:"computed_on"`
+}
+
+const sqlSelectFunnelRunCount = `
+SELECT COUNT(*) FROM flows_flowrun WHERE flow_id = $1 AND created_on >= $2 AND created_on < $3`
+
+// a run drops off at the node of the last step in its path if it ended without completing
+const sqlSelectFunnelNodes = `
+  SELECT s.step->>'node_uuid' AS node_uuid,
+         COUNT(DISTINCT r.id) AS visits,
+         COUNT(DISTINCT r.id) FILTER (WHERE r.status IN ('I', 'X', 'F') AND s.ord = jsonb_array_length(r.path::jsonb)) AS drop_offs
+    FROM flows_flowrun r,
+         jsonb_array_elements(r.path::jsonb) WITH ORDINALITY AS s(step, ord)
+   WHERE r.flow_id = $1 AND r.created_on >= $2 AND r.created_on < $3
+GROUP BY s.step->>'node_uuid'`
+
+// ComputeFlowFunnel computes the funnel of the given flow from the paths of its runs created in the given range. Nodes
+// are ordered by the number of runs that passed through them so that the funnel narrows.
+func ComputeFlowFunnel(ctx context.Context, db *sqlx.DB, flow *Flow, since, until time.Time) (*FlowFunnel, error) {
+	funnel := &FlowFunnel{FlowUUID: flow.UUID(), Since: since, Until: until, Nodes: []*FlowFunnelNode{}}
+
+	if err := db.GetContext(ctx, &funnel.Runs, sqlSelectFunnelRunCount, flow.ID(), since, until); err != nil {
+		return nil, errors.Wrap(err, "error counting flow runs")
+	}
+
+	rows, err := db.QueryContext(ctx, sqlSelectFunnelNodes, flow.ID(), since, until)
+	if err != nil {
+		return nil, errors.Wrap(err, "error querying flow funnel nodes")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		node := &FlowFunnelNode{}
+		if err := rows.Scan(&node.NodeUUID, &node.Visits, &node.DropOffs); err != nil {
+			return nil, errors.Wrap(err, "error scanning flow funnel node")
+		}
+		if node.Visits > 0 {
+			node.DropOffRate = math.Round(float64(node.DropOffs)/float64(node.Visits)*10000) / 10000
+		}
+		funnel.Nodes = append(funnel.Nodes, node)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "error reading flow funnel nodes")
+	}
+
+	sort.SliceStable(funnel.Nodes, func(i, j int) bool {
+		if funnel.Nodes[i].Visits != funnel.Nodes[j].Visits {
+			return funnel.Nodes[i].Visits > funnel.Nodes[j].Visits
+		}
+		return funnel.Nodes[i].NodeUUID < funnel.Nodes[j].NodeUUID
+	})
+
+	funnel.ComputedOn = time.Now()
+	return funnel, nil
+}
+
+var flowFunnelKeys = orgkeys.Register("flow_funnel:%d:%s")
+
+func flowFunnelKey(orgID OrgID, flowUUID assets.FlowUUID) string {
+	return flowFunnelKeys.Key(int(orgID), flowUUID)
+}
+
+// SetFlowFunnel records the given funnel as the latest computed funnel for its flow
+func SetFlowFunnel(rc redis.Conn, orgID OrgID, funnel *FlowFunnel) error {
+	_, err := rc.Do("SET", flowFunnelKey(orgID, funnel.FlowUUID), jsonx.MustMarshal(funnel), "EX", int(flowFunnelExpiry/time.Second))
+	return errors.Wrap(err, "error setting flow funnel")
+}
+
+// GetFlowFunnel gets the latest computed funnel for the given flow, or nil if there isn't one
+func GetFlowFunnel(rc redis.Conn, orgID OrgID, flowUUID assets.FlowUUID) (*FlowFunnel, error) {
+	data, err := redis.Bytes(rc.Do("GET", flowFunnelKey(orgID, flowUUID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting flow funnel")
+	}
+
+	funnel := &FlowFunnel{}
+	if err := jsonx.Unmarshal(data, funnel); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling flow funnel")
+	}
+	return funnel, nil
+}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+const flowMigrationExpiry = time.Hour * 24 * 7
+
+// FlowMigrationStatus is the status of an org's flow migration
+type FlowMigrationStatus string
+
+const (
+	FlowMigrationStatusInProgress = FlowMigrationStatus("in_progress")
+	FlowMigrationStatusComplete   = FlowMigrationStatus("complete")
+	FlowMigrationStatusRolledBack = FlowMigrationStatus("rolled_back")
+)
+
+// FlowMigrationResult is the result of migrating a single flow. Revision is the new revision created by a successful
+// migration, and the flow's previous revision is left as is so that the migration can be rolled back.
+type FlowMigrationResult struct {
+	FlowID       FlowID `json:"flow_id"`
+	Name         string `json:"name"`
+	FromVersion  string `json:"from_version"`
+	FromRevision int    `json:"from_revision"`
+	Revision     int    `json:"revision,omitempty"`
+	Error        string `json:"error,omitempty"`
+	RolledBack   bool   `json:"rolled_back,omitempty"`
+}
+
+// FlowMigration is the state of a migration of all of an org's flows to a spec version, which is updated as each batch
+// of flows is migrated
+type FlowMigration struct {
+	Status      FlowMigrationStatus    `json:"status"`
+	ToVersion   string                 `json:"to_version"`
+	Total       int                    `json:"total"`
+	Migrated    int                    `json:"migrated"`
+	Skipped     int                    `json:"skipped"`
+	Failed      int                    `json:"failed"`
+	Results     []*FlowMigrationResult `json:"results"`
+	StartedOn   time.Time              `json:"started_on"`
+	CompletedOn *time.Time             `json:"completed_on,omitempty"`
+}
+
+// NewFlowMigration creates a new in progress flow migration
+func NewFlowMigration(toVersion string, total int) *FlowMigration {
+	return &FlowMigration{
+		Status:    FlowMigrationStatusInProgress,
+		ToVersion: toVersion,
+		Total:     total,
+		Results:   []*FlowMigrationResult{},
+		StartedOn: dates.Now(),
+	}
+}
+
+// Complete marks this migration as complete
+func (m *FlowMigration) Complete() {
+	now := dates.Now()
+	m.Status = FlowMigrationStatusComplete
+	m.CompletedOn = &now
+}
+
+// FlowRevisionToMigrate is the latest revision of a flow which may need migrating
+type FlowRevisionToMigrate struct {
+	FlowID      FlowID          `db:"flow_id"`
+	Name        string          `db:"name"`
+	Revision    int             `db:"revision"`
+	SpecVersion string          `db:"spec_version"`
+	Definition  json.RawMessage `db:"definition"`
+}
+
+const sqlSelectFlowRevisionsToMigrate = `
+SELECT f.id AS flow_id, f.name, fr.revision, fr.spec_version, fr.definition
+  FROM flows_flow f
+ INNER JOIN LATERAL (
+     SELECT revision, spec_version, definition
+       FROM flows_flowrevision
+      WHERE flow_id = f.id AND is_active = TRUE
+   ORDER BY revision DESC
+      LIMIT 1
+ ) fr ON TRUE
+ WHERE f.org_id = $1 AND f.is_active = TRUE AND f.is_system = FALSE
+ ORDER BY f.id`
+
+// LoadFlowRevisionsToMigrate loads the latest revisions of all of the given org's active flows
+func LoadFlowRevisionsToMigrate(ctx context.Context, db Queryer, orgID OrgID) ([]*FlowRevisionToMigrate, error) {
+	revs := make([]*FlowRevisionToMigrate, 0)
+	if err := db.SelectContext(ctx, &revs, sqlSelectFlowRevisionsToMigrate, orgID); err != nil {
+		return nil, errors.Wrapf(err, "error loading flow revisions for org #%d", orgID)
+	}
+	return revs, nil
+}
+
+// deactivates a migrated revision, provided it's still the latest revision of its flow, so that the previous revision
+// becomes current again
+const sqlRollbackFlowRevision = `
+UPDATE flows_flowrevision fr
+   SET is_active = FALSE, modified_on = NOW()
+  FROM flows_flow f
+ WHERE fr.flow_id = $1 AND fr.revision = $2 AND f.id = fr.flow_id AND f.org_id = $3 AND fr.is_active = TRUE AND NOT EXISTS (
+     SELECT 1 FROM flows_flowrevision fr2 WHERE fr2.flow_id = fr.flow_id AND fr2.revision > fr.revision AND fr2.is_active = TRUE
+ )`
+
+// RollbackFlowMigration rolls back each successfully migrated flow in the given migration to its previous revision.
+// Flows which have been saved again since being migrated are left alone.
+func RollbackFlowMigration(ctx context.Context, db Queryer, orgID OrgID, migration *FlowMigration) error {
+	for _, result := range migration.Results {
+		if result.Revision == 0 || result.RolledBack {
+			continue
+		}
+
+		res, err := db.ExecContext(ctx, sqlRollbackFlowRevision, result.FlowID, result.Revision, orgID)
+		if err != nil {
+			return errors.Wrapf(err, "error rolling back flow #%d", result.FlowID)
+		}
+		if rows, _ := res.RowsAffected(); rows == 1 {
+			if err := updateFlowVersion(ctx, db, result.FlowID, result.FromVersion); err != nil {
+				return err
+			}
+			result.RolledBack = true
+		}
+	}
+
+	migration.Status = FlowMigrationStatusRolledBack
+	return nil
+}
+
+var flowMigrationKeys = orgkeys.Register("flow_migration:%d")
+
+func flowMigrationKey(orgID OrgID) string {
+	return flowMigrationKeys.Key(int(orgID))
+}
+
+// SetFlowMigration records the given migration as the latest flow migration for the given org
+func SetFlowMigration(rc redis.Conn, orgID OrgID, migration *FlowMigration) error {
+	_, err := rc.Do("SET", flowMigrationKey(orgID), jsonx.MustMarshal(migration), "EX", int(flowMigrationExpiry/time.Second))
+	return errors.Wrap(err, "error setting flow migration")
+}
+
+// GetFlowMigration gets the latest flow migration for the given org, or nil if there isn't one
+func GetFlowMigration(rc redis.Conn, orgID OrgID) (*FlowMigration, error) {
+	data, err := redis.Bytes(rc.Do("GET", flowMigrationKey(orgID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting flow migration")
+	}
+
+	migration := &FlowMigration{}
+	if err := jsonx.Unmarshal(data, migration); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling flow migration")
+	}
+	return migration, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/nyaruka/gocommon/dbutil"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/null"
 
 	"github.com/jmoiron/sqlx"
@@ -41,6 +42,7 @@ func (t FlowType) Interrupts() bool {
 
 const (
 	flowConfigIVRRetryMinutes = "ivr_retry"
+	flowConfigChildResults    = "child_results"
 )
 
 var flowTypeMapping = map[flows.FlowType]FlowType{
@@ -63,6 +65,9 @@ type Flow struct {
 		Definition     json.RawMessage `json:"definition"`
 		IgnoreTriggers bool            `json:"ignore_triggers"`
 	}
+
+	// read when the flow is loaded so that it's cached for as long as the flow is
+	autoReply *AutoReply
 }
 
 // ID returns the ID for this flow
@@ -104,6 +109,22 @@ func (f *Flow) IVRRetryWait() *time.Duration {
 	return &wait
 }
 
+// ChildResults returns the keys of results which this flow imports from the runs of flows it enters
+func (f *Flow) ChildResults() []string {
+	values, _ := f.f.Config.Get(flowConfigChildResults, nil).([]interface{})
+
+	keys := make([]string, 0, len(values))
+	for _, v := range values {
+		if key, isString := v.(string); isString && key != "" {
+			keys = append(keys, utils.Snakify(key))
+		}
+	}
+	return keys
+}
+
+// AutoReply returns the static reply this flow sends if that's all it does, or nil
+func (f *Flow) AutoReply() *AutoReply { return f.autoReply }
+
 // IgnoreTriggers returns whether this flow ignores triggers
 func (f *Flow) IgnoreTriggers() bool { return f.f.IgnoreTriggers }
 
@@ -116,6 +137,7 @@ func (f *Flow) Reference() *assets.FlowReference {
 func (f *Flow) cloneWithNewDefinition(def []byte) *Flow {
 	c := *f
 	c.f.Definition = def
+	c.autoReply = readAutoReply(c.f.FlowType, def)
 	return &c
 }
 
@@ -165,6 +187,8 @@ func loadFlow(ctx context.Context, db Queryer, sql string, orgID OrgID, arg inte
 		return nil, errors.Wrapf(err, "error reading flow definition by: %s", arg)
 	}
 
+	flow.autoReply = readAutoReply(flow.f.FlowType, flow.f.Definition)
+
 	logrus.WithField("elapsed", time.Since(start)).WithField("org_id", orgID).WithField("flow", arg).Debug("loaded flow")
 
 	return flow, nil
@@ -224,6 +248,7 @@ var sqlSelectFlowByName = fmt.Sprintf(baseSqlSelectFlow,
 	    saved_on DESC LIMIT 1`,
 )
 var sqlSelectFlowByID = fmt.Sprintf(baseSqlSelectFlow, `WHERE org_id = $1 AND id = $2 AND is_active = TRUE AND is_archived = FALSE`)
+var sqlSelectDeletedFlowByID = fmt.Sprintf(baseSqlSelectFlow, `WHERE org_id = $1 AND id = $2 AND is_active = FALSE`)
 
 // MarshalJSON marshals into JSON. 0 values will become null
 func (i FlowID) MarshalJSON() ([]byte, error) {
@@ -244,3 +269,24 @@ func (i FlowID) Value() (driver.Value, error) {
 func (i *FlowID) Scan(value interface{}) error {
 	return null.ScanInt(value, (*null.Int)(i))
 }
+
+const sqlInsertFlowRevision = `
+INSERT INTO flows_flowrevision(flow_id, definition, spec_version, revision, is_active, created_by_id, created_on, modified_by_id, modified_on)
+     SELECT $1, $2, $3, COALESCE(MAX(revision), 0) + 1, TRUE, $4, NOW(), $4, NOW()
+       FROM flows_flowrevision
+      WHERE flow_id = $1
+  RETURNING revision`
+
+// InsertFlowRevision saves the given definition of a flow as its new latest revision, returning the revision number
+func InsertFlowRevision(ctx context.Context, db Queryer, flowID FlowID, definition json.RawMessage, specVersion string, userID UserID) (int, error) {
+	var revision int
+	if err := db.GetContext(ctx, &revision, sqlInsertFlowRevision, flowID, definition, specVersion, userID); err != nil {
+		return 0, errors.Wrapf(err, "error inserting revision of flow #%d", flowID)
+	}
+	return revision, updateFlowVersion(ctx, db, flowID, specVersion)
+}
+
+func updateFlowVersion(ctx context.Context, db Queryer, flowID FlowID, specVersion string) error {
+	_, err := db.ExecContext(ctx, `UPDATE flows_flow SET version_number = $2, saved_on = NOW(), modified_on = NOW() WHERE id = $1`, flowID, specVersion)
+	return errors.Wrapf(err, "error updating version of flow #%d", flowID)
+}
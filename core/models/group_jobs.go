@@ -0,0 +1,262 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
+)
+
+const groupJobExpiry = time.Hour * 24 * 7
+
+// GroupJobType is the type of a group job
+type GroupJobType string
+
+const (
+	GroupJobTypeExport = GroupJobType("export")
+	GroupJobTypeImport = GroupJobType("import")
+)
+
+// GroupJobStatus is the status of a group job
+type GroupJobStatus string
+
+const (
+	GroupJobStatusPending    = GroupJobStatus("pending")
+	GroupJobStatusInProgress = GroupJobStatus("in_progress")
+	GroupJobStatusComplete   = GroupJobStatus("complete")
+	GroupJobStatusFailed     = GroupJobStatus("failed")
+)
+
+// GroupJobResult is the result of exporting or importing a single group. Members is the number of contacts exported or
+// added to the group, and missing is the number of contacts of an imported group which don't exist in the org.
+type GroupJobResult struct {
+	UUID    assets.GroupUUID `json:"uuid"`
+	Name    string           `json:"name"`
+	Query   string           `json:"query,omitempty"`
+	Created bool             `json:"created,omitempty"`
+	Members int              `json:"members"`
+	Missing int              `json:"missing,omitempty"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// GroupJob is the state of a background export or import of a set of groups, which is updated as each group is
+// processed. A completed export has the URL of a JSON file of the groups which can be imported into another org.
+type GroupJob struct {
+	UUID        uuids.UUID        `json:"uuid"`
+	Type        GroupJobType      `json:"type"`
+	Status      GroupJobStatus    `json:"status"`
+	Total       int               `json:"total"`
+	Succeeded   int               `json:"succeeded"`
+	Failed      int               `json:"failed"`
+	Results     []*GroupJobResult `json:"results"`
+	URL         string            `json:"url,omitempty"`
+	Error       string            `json:"error,omitempty"`
+	CreatedOn   time.Time         `json:"created_on"`
+	CompletedOn *time.Time        `json:"completed_on,omitempty"`
+}
+
+// NewGroupJob creates a new pending group job
+func NewGroupJob(typ GroupJobType, total int) *GroupJob {
+	return &GroupJob{
+		UUID:      uuids.New(),
+		Type:      typ,
+		Status:    GroupJobStatusPending,
+		Total:     total,
+		Results:   []*GroupJobResult{},
+		CreatedOn: dates.Now(),
+	}
+}
+
+// AddResult adds the result for a single group to this job
+func (j *GroupJob) AddResult(result *GroupJobResult) {
+	if result.Error != "" {
+		j.Failed++
+	} else {
+		j.Succeeded++
+	}
+	j.Results = append(j.Results, result)
+}
+
+// Complete marks this job as complete
+func (j *GroupJob) Complete() {
+	now := dates.Now()
+	j.Status = GroupJobStatusComplete
+	j.CompletedOn = &now
+}
+
+// Fail marks this job as failed with the given error
+func (j *GroupJob) Fail(err string) {
+	now := dates.Now()
+	j.Status = GroupJobStatusFailed
+	j.Error = err
+	j.CompletedOn = &now
+}
+
+// GroupJobPath gets the path in attachment storage of a file belonging to the given group job
+func GroupJobPath(rt *runtime.Runtime, orgID OrgID, jobUUID uuids.UUID, filename string) string {
+	return path.Join(rt.Config.S3AttachmentsPrefix, fmt.Sprint(orgID), "groups", string(jobUUID), filename)
+}
+
+var groupJobKeys = orgkeys.Register("group_job:%d:%s")
+
+func groupJobKey(orgID OrgID, uuid uuids.UUID) string {
+	return groupJobKeys.Key(int(orgID), uuid)
+}
+
+// SetGroupJob saves the current state of the given group job
+func SetGroupJob(rc redis.Conn, orgID OrgID, job *GroupJob) error {
+	_, err := rc.Do("SET", groupJobKey(orgID, job.UUID), jsonx.MustMarshal(job), "EX", int(groupJobExpiry/time.Second))
+	return errors.Wrap(err, "error setting group job")
+}
+
+// GetGroupJob gets the group job with the given UUID, or nil if there isn't one
+func GetGroupJob(rc redis.Conn, orgID OrgID, uuid uuids.UUID) (*GroupJob, error) {
+	data, err := redis.Bytes(rc.Do("GET", groupJobKey(orgID, uuid)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting group job")
+	}
+
+	job := &GroupJob{}
+	if err := jsonx.Unmarshal(data, job); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling group job")
+	}
+	return job, nil
+}
+
+// ExportedGroup is a group as exported for importing into another org. Manual groups have the UUIDs of their contacts
+// and smart groups have their query, e.g.
+//
+//	{
+//	  "uuid": "c153e265-f7c9-4539-9dbc-9b358714b638",
+//	  "name": "Doctors",
+//	  "contacts": ["6393abc0-283d-4c9b-a1b3-641a035c34bf", "b699a406-7e44-49be-9f01-1a82893e8a10"]
+//	}
+type ExportedGroup struct {
+	UUID     assets.GroupUUID    `json:"uuid"               validate:"required,uuid4"`
+	Name     string              `json:"name"               validate:"required"`
+	Query    string              `json:"query,omitempty"`
+	Contacts []flows.ContactUUID `json:"contacts,omitempty"`
+}
+
+const sqlSelectGroupMemberUUIDs = `
+  SELECT c.uuid
+    FROM contacts_contactgroup_contacts gc
+    JOIN contacts_contact c ON c.id = gc.contact_id
+   WHERE gc.contactgroup_id = $1 AND c.is_active = TRUE
+ORDER BY c.id`
+
+// ExportGroup exports the given group, including the UUIDs of its contacts if it's a manual group
+func ExportGroup(ctx context.Context, db Queryer, group *Group) (*ExportedGroup, error) {
+	exported := &ExportedGroup{UUID: group.UUID(), Name: group.Name()}
+
+	if group.Type() == GroupTypeSmart {
+		exported.Query = group.Query()
+		return exported, nil
+	}
+
+	exported.Contacts = make([]flows.ContactUUID, 0, 10)
+	if err := db.SelectContext(ctx, &exported.Contacts, sqlSelectGroupMemberUUIDs, group.ID()); err != nil {
+		return nil, errors.Wrapf(err, "error loading contacts of group %s", group.UUID())
+	}
+	return exported, nil
+}
+
+const sqlSelectGroupUUIDExists = `SELECT EXISTS(SELECT 1 FROM contacts_contactgroup WHERE uuid = $1)`
+
+const sqlInsertGroup = `
+INSERT INTO contacts_contactgroup(uuid, org_id, group_type, name, query, status, is_system, is_active, created_by_id, created_on, modified_by_id, modified_on)
+                          VALUES($1, $2, $3, $4, $5, $6, FALSE, TRUE, $7, NOW(), $7, NOW())
+  RETURNING id`
+
+const sqlSelectContactIDsByUUID = `SELECT id FROM contacts_contact WHERE org_id = $1 AND uuid = ANY($2) AND is_active = TRUE`
+
+// ImportGroup imports the given exported group into the given org. A group in the org with the same UUID or name is
+// reused, and otherwise a new group is created, keeping the exported UUID unless it's used by another org. Contacts of
+// manual groups are matched by UUID and added to the group. What was done is recorded on the given result and the ID of
+// the group is returned, or NilGroupID if it couldn't be imported. New smart groups are created as initializing and
+// it's up to the caller to populate them.
+func ImportGroup(ctx context.Context, db *sqlx.DB, oa *OrgAssets, userID UserID, exported *ExportedGroup, result *GroupJobResult) (GroupID, error) {
+	groupType := GroupTypeManual
+	if exported.Query != "" {
+		groupType = GroupTypeSmart
+	}
+
+	group := oa.GroupByUUID(exported.UUID)
+	if group == nil {
+		groups, _ := oa.Groups()
+		for _, g := range groups {
+			if strings.EqualFold(g.Name(), exported.Name) {
+				group = g.(*Group)
+				break
+			}
+		}
+	}
+
+	var groupID GroupID
+
+	if group != nil {
+		if group.Type() != groupType {
+			result.Error = fmt.Sprintf("existing group '%s' is not a %s group", group.Name(), groupTypeNames[groupType])
+			return NilGroupID, nil
+		}
+		groupID = group.ID()
+		result.UUID = group.UUID()
+	} else {
+		uuid := exported.UUID
+
+		var exists bool
+		if err := db.GetContext(ctx, &exists, sqlSelectGroupUUIDExists, uuid); err != nil {
+			return NilGroupID, errors.Wrap(err, "error checking group UUID")
+		}
+		if exists {
+			uuid = assets.GroupUUID(uuids.New())
+		}
+
+		status := GroupStatusReady
+		if groupType == GroupTypeSmart {
+			status = GroupStatusInitializing
+		}
+
+		err := db.GetContext(ctx, &groupID, sqlInsertGroup, uuid, oa.OrgID(), groupType, exported.Name, null.String(exported.Query), status, userID)
+		if err != nil {
+			return NilGroupID, errors.Wrapf(err, "error inserting group %s", exported.Name)
+		}
+		result.UUID = uuid
+		result.Created = true
+	}
+
+	if groupType == GroupTypeSmart || len(exported.Contacts) == 0 {
+		return groupID, nil
+	}
+
+	contactIDs := make([]ContactID, 0, len(exported.Contacts))
+	if err := db.SelectContext(ctx, &contactIDs, sqlSelectContactIDsByUUID, oa.OrgID(), pq.Array(exported.Contacts)); err != nil {
+		return NilGroupID, errors.Wrap(err, "error looking up group contacts")
+	}
+
+	if err := AddContactsToGroupAndCampaigns(ctx, db, oa, groupID, contactIDs); err != nil {
+		return NilGroupID, errors.Wrapf(err, "error adding contacts to group %s", exported.Name)
+	}
+
+	result.Members = len(contactIDs)
+	result.Missing = len(exported.Contacts) - len(contactIDs)
+	return groupID, nil
+}
+
+var groupTypeNames = map[GroupType]string{GroupTypeManual: "manual", GroupTypeSmart: "smart"}
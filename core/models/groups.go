@@ -17,6 +17,9 @@ import (
 // GroupID is our type for group ids
 type GroupID int
 
+// NilGroupID is nil value for group IDs
+const NilGroupID = GroupID(0)
+
 // GroupStatus is the current status of the passed in group
 type GroupStatus string
 
@@ -202,8 +205,8 @@ func RemoveContactsFromGroupAndCampaigns(ctx context.Context, db *sqlx.DB, oa *O
 			return errors.Wrapf(err, "error removing contacts from group: %d", groupID)
 		}
 
-		// remove from any campaign events
-		err = DeleteUnfiredEventsForGroupRemoval(ctx, tx, oa, batch, groupID)
+		// skip any campaign events they would have fired
+		err = SkipUnfiredEventsForGroupRemoval(ctx, tx, oa, batch, groupID)
 		if err != nil {
 			tx.Rollback()
 			return errors.Wrapf(err, "error removing contacts from unfired campaign events for group: %d", groupID)
@@ -7,6 +7,7 @@ import (
 
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
 )
 
 // HTTPLogID is our type for HTTPLog ids
@@ -30,6 +31,9 @@ const (
 
 	// LogTypeAirtimeTransferred is our type for when we make an airtime transfer
 	LogTypeAirtimeTransferred = "airtime_transferred"
+
+	// LogTypeResthookDelivered is our type for when we deliver a resthook event to a subscriber
+	LogTypeResthookDelivered = "resthook_delivered"
 )
 
 // HTTPLog is our type for a HTTPLog
@@ -92,6 +96,11 @@ func NewAirtimeTransferredLog(orgID OrgID, url string, statusCode int, request,
 	return newHTTPLog(orgID, LogTypeAirtimeTransferred, url, statusCode, request, response, isError, elapsed, retries, createdOn)
 }
 
+// NewResthookDeliveredLog creates a new HTTP log for the delivery of a resthook event to a subscriber
+func NewResthookDeliveredLog(orgID OrgID, url string, statusCode int, request, response string, isError bool, elapsed time.Duration, retries int, createdOn time.Time) *HTTPLog {
+	return newHTTPLog(orgID, LogTypeResthookDelivered, url, statusCode, request, response, isError, elapsed, retries, createdOn)
+}
+
 // SetAirtimeTransferID called to set the transfer ID on a log after the transfer has been created
 func (h *HTTPLog) SetAirtimeTransferID(tid AirtimeTransferID) {
 	h.AirtimeTransferID = tid
@@ -108,6 +117,22 @@ func InsertHTTPLogs(ctx context.Context, tx Queryer, logs []*HTTPLog) error {
 	return BulkQuery(ctx, "inserted http logs", tx, insertHTTPLogsSQL, logs)
 }
 
+const sqlSelectResthookDeliveryLogs = `
+SELECT id, org_id, log_type, url, status_code, request, response, is_error, request_time, num_retries, created_on, flow_id, classifier_id, ticketer_id, airtime_transfer_id
+  FROM request_logs_httplog
+ WHERE org_id = $1 AND log_type = 'resthook_delivered' AND url = $2
+ORDER BY created_on DESC, id DESC
+ LIMIT $3`
+
+// LoadResthookDeliveryLogs loads the most recent delivery logs for the given resthook subscriber URL
+func LoadResthookDeliveryLogs(ctx context.Context, db Queryer, orgID OrgID, url string, limit int) ([]*HTTPLog, error) {
+	logs := make([]*HTTPLog, 0, limit)
+	if err := db.SelectContext(ctx, &logs, sqlSelectResthookDeliveryLogs, orgID, url, limit); err != nil {
+		return nil, errors.Wrap(err, "error loading resthook delivery logs")
+	}
+	return logs, nil
+}
+
 // MarshalJSON marshals into JSON. 0 values will become null
 func (i HTTPLogID) MarshalJSON() ([]byte, error) {
 	return null.Int(i).MarshalJSON()
@@ -0,0 +1,412 @@
+package models
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+// ContactImportBatchSize is the number of records in each batch of an import
+const ContactImportBatchSize = 100
+
+// ContactImportMappingType is the type of a mapping of an import column
+type ContactImportMappingType string
+
+const (
+	ContactImportMappingAttribute = ContactImportMappingType("attribute")
+	ContactImportMappingScheme    = ContactImportMappingType("scheme")
+	ContactImportMappingField     = ContactImportMappingType("field")
+	ContactImportMappingNewField  = ContactImportMappingType("new_field")
+	ContactImportMappingIgnore    = ContactImportMappingType("ignore")
+)
+
+// ContactImportMapping is how a column of an import file, identified by its header, maps to contacts, e.g.
+//
+//	[
+//	  {"header": "URN:Tel", "mapping": {"type": "scheme", "scheme": "tel"}},
+//	  {"header": "Name", "mapping": {"type": "attribute", "name": "name"}},
+//	  {"header": "Field:Age", "mapping": {"type": "field", "key": "age", "name": "Age"}}
+//	]
+type ContactImportMapping struct {
+	Header  string `json:"header"`
+	Mapping struct {
+		Type   ContactImportMappingType `json:"type"`
+		Name   string                   `json:"name,omitempty"`
+		Scheme string                   `json:"scheme,omitempty"`
+		Key    string                   `json:"key,omitempty"`
+	} `json:"mapping"`
+}
+
+// ContactImportRecordReader reads the records of an import file one at a time, returning io.EOF when there are none left
+type ContactImportRecordReader interface {
+	Read() ([]string, error)
+}
+
+// NewContactImportRecordReader creates a record reader for the given import file, whose format is determined by the
+// extension of its name. CSV files are read as they are streamed but XLSX files have to be read fully into memory.
+func NewContactImportRecordReader(filename string, r io.Reader) (ContactImportRecordReader, error) {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		return cr, nil
+	case ".xlsx":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, errors.Wrap(err, "error reading xlsx file")
+		}
+		rows, err := readXLSXRows(data)
+		if err != nil {
+			return nil, err
+		}
+		return &rowsReader{rows: rows}, nil
+	}
+	return nil, errors.Errorf("unsupported import file format: %s", filename)
+}
+
+// CreateBatches reads the records of the given import file, which must start with a header row, and creates batches of
+// contact specs from them according to this import's mappings, returning the ids of the created batches
+func (i *ContactImport) CreateBatches(ctx context.Context, db Queryer, oa *OrgAssets, reader ContactImportRecordReader) ([]ContactImportBatchID, error) {
+	return i.createBatches(ctx, db, oa, reader, false)
+}
+
+// creates batches from the given import file, optionally skipping records which don't match an existing contact
+func (i *ContactImport) createBatches(ctx context.Context, db Queryer, oa *OrgAssets, reader ContactImportRecordReader, onlyExisting bool) ([]ContactImportBatchID, error) {
+	var mappings []*ContactImportMapping
+	if err := jsonx.Unmarshal(i.Mappings, &mappings); err != nil {
+		return nil, errors.Wrap(err, "error reading import mappings")
+	}
+
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("import file is empty")
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error reading import file headers")
+	}
+
+	// work out which column each mapping applies to
+	columns := make([]*ContactImportMapping, len(headers))
+	for c, header := range headers {
+		for _, m := range mappings {
+			if strings.EqualFold(strings.TrimSpace(header), strings.TrimSpace(m.Header)) {
+				columns[c] = m
+				break
+			}
+		}
+	}
+
+	var groups []assets.GroupUUID
+	if i.GroupID != NilGroupID {
+		if group := oa.GroupByID(i.GroupID); group != nil {
+			groups = []assets.GroupUUID{group.UUID()}
+		}
+	}
+	country := string(oa.Env().DefaultCountry())
+
+	batchIDs := make([]ContactImportBatchID, 0, 10)
+	specs := make([]*ContactSpec, 0, ContactImportBatchSize)
+	numRecords := 0
+
+	flush := func() error {
+		if len(specs) == 0 {
+			return nil
+		}
+		batchID, err := insertContactImportBatch(ctx, db, i.ID, specs, numRecords-len(specs), numRecords)
+		if err != nil {
+			return err
+		}
+		batchIDs = append(batchIDs, batchID)
+		specs = specs[:0]
+		return nil
+	}
+
+	pending := make([]*ContactSpec, 0, ContactImportBatchSize)
+
+	// moves pending specs into the current batch, dropping those without an existing contact if required
+	addPending := func() error {
+		if onlyExisting {
+			var err error
+			if pending, err = filterExistingContactSpecs(ctx, db, oa, pending); err != nil {
+				return err
+			}
+		}
+		for _, spec := range pending {
+			specs = append(specs, spec)
+			numRecords++
+
+			if len(specs) == ContactImportBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "error reading import file row %d", row)
+		}
+
+		spec := recordToContactSpec(columns, record, country)
+		if spec == nil {
+			continue
+		}
+		spec.Groups = groups
+		spec.ImportRow = row
+
+		pending = append(pending, spec)
+
+		if len(pending) == ContactImportBatchSize {
+			if err := addPending(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := addPending(); err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE contacts_contactimport SET num_records = $2 WHERE id = $1`, i.ID, numRecords); err != nil {
+		return nil, errors.Wrap(err, "error updating import record count")
+	}
+
+	return batchIDs, nil
+}
+
+// filters the given specs to those which have a UUID or a URN belonging to an existing contact
+func filterExistingContactSpecs(ctx context.Context, db Queryer, oa *OrgAssets, specs []*ContactSpec) ([]*ContactSpec, error) {
+	urnz := make([]urns.URN, 0, len(specs))
+	for _, spec := range specs {
+		urnz = append(urnz, spec.URNs...)
+	}
+
+	owners, err := contactIDsFromURNs(ctx, db, oa.OrgID(), urnz)
+	if err != nil {
+		return nil, errors.Wrap(err, "error looking up existing contacts")
+	}
+
+	existing := make([]*ContactSpec, 0, len(specs))
+	for _, spec := range specs {
+		match := spec.UUID != ""
+		for _, u := range spec.URNs {
+			if owners[u] != NilContactID {
+				match = true
+			}
+		}
+		if match {
+			existing = append(existing, spec)
+		}
+	}
+	return existing, nil
+}
+
+// converts a record of an import file to a contact spec, returning nil if the record is empty
+func recordToContactSpec(columns []*ContactImportMapping, record []string, country string) *ContactSpec {
+	spec := &ContactSpec{URNs: []urns.URN{}, Fields: map[string]string{}}
+	empty := true
+
+	for c, value := range record {
+		value = strings.TrimSpace(value)
+		if c >= len(columns) || columns[c] == nil || value == "" {
+			continue
+		}
+		empty = false
+
+		m := columns[c].Mapping
+		switch m.Type {
+		case ContactImportMappingAttribute:
+			switch m.Name {
+			case "uuid":
+				spec.UUID = flows.ContactUUID(value)
+			case "name":
+				spec.Name = &value
+			case "language":
+				spec.Language = &value
+			}
+		case ContactImportMappingScheme:
+			spec.URNs = append(spec.URNs, urns.URN(fmt.Sprintf("%s:%s", m.Scheme, value)).Normalize(country))
+		case ContactImportMappingField, ContactImportMappingNewField:
+			spec.Fields[m.Key] = value
+		}
+	}
+
+	if empty {
+		return nil
+	}
+	return spec
+}
+
+const sqlInsertContactImportBatch = `
+INSERT INTO contacts_contactimportbatch(contact_import_id, status, specs, record_start, record_end, num_created, num_updated, num_errored, errors, finished_on)
+                                 VALUES($1, 'P', $2, $3, $4, 0, 0, 0, '[]', NULL)
+  RETURNING id`
+
+func insertContactImportBatch(ctx context.Context, db Queryer, importID ContactImportID, specs []*ContactSpec, start, end int) (ContactImportBatchID, error) {
+	var batchID ContactImportBatchID
+	err := db.GetContext(ctx, &batchID, sqlInsertContactImportBatch, importID, jsonx.MustMarshal(specs), start, end)
+	return batchID, errors.Wrap(err, "error inserting contact import batch")
+}
+
+// reads records from rows which have already been read into memory
+type rowsReader struct {
+	rows [][]string
+	next int
+}
+
+func (r *rowsReader) Read() ([]string, error) {
+	if r.next >= len(r.rows) {
+		return nil, io.EOF
+	}
+	r.next++
+	return r.rows[r.next-1], nil
+}
+
+type xlsxSharedStrings struct {
+	Items []struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Type   string `xml:"t,attr"`
+			Value  string `xml:"v"`
+			Inline struct {
+				Text string `xml:"t"`
+			} `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// reads the rows of the first worksheet of the given XLSX file
+func readXLSXRows(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading xlsx file")
+	}
+
+	sharedStrings := &xlsxSharedStrings{}
+	if err := readXLSXPart(zr, "xl/sharedStrings.xml", sharedStrings); err != nil && err != errXLSXPartMissing {
+		return nil, err
+	}
+
+	sheet := &xlsxSheet{}
+	if err := readXLSXPart(zr, "xl/worksheets/sheet1.xml", sheet); err != nil {
+		return nil, err
+	}
+
+	sharedString := func(s string) string {
+		idx, err := strconv.Atoi(s)
+		if err != nil || idx < 0 || idx >= len(sharedStrings.Items) {
+			return ""
+		}
+		item := sharedStrings.Items[idx]
+		if len(item.Runs) == 0 {
+			return item.Text
+		}
+		var sb strings.Builder
+		for _, r := range item.Runs {
+			sb.WriteString(r.Text)
+		}
+		return sb.String()
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, r := range sheet.Rows {
+		row := make([]string, 0, len(r.Cells))
+		for _, c := range r.Cells {
+			var value string
+			switch c.Type {
+			case "s":
+				value = sharedString(c.Value)
+			case "inlineStr":
+				value = c.Inline.Text
+			case "", "n":
+				value = formatXLSXNumber(c.Value)
+			default:
+				value = c.Value
+			}
+
+			// cells can be missing so use the cell reference to put values in the right column
+			col := xlsxColumn(c.Ref)
+			if col < 0 {
+				col = len(row)
+			}
+			for len(row) < col {
+				row = append(row, "")
+			}
+			if col < len(row) {
+				row[col] = value
+			} else {
+				row = append(row, value)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+var errXLSXPartMissing = errors.New("xlsx part missing")
+
+func readXLSXPart(zr *zip.Reader, name string, v interface{}) error {
+	f, err := zr.Open(name)
+	if err != nil {
+		return errXLSXPartMissing
+	}
+	defer f.Close()
+
+	return errors.Wrapf(xml.NewDecoder(f).Decode(v), "error reading xlsx part %s", name)
+}
+
+// gets the zero based column index from a cell reference like B12
+func xlsxColumn(ref string) int {
+	col := 0
+	n := 0
+	for _, ch := range strings.ToUpper(ref) {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
+
+// Excel stores all numbers as floats so integers like phone numbers can come out in exponent form
+func formatXLSXNumber(v string) string {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsInf(f, 0) || f != math.Trunc(f) || math.Abs(f) >= 1e15 {
+		return v
+	}
+	return strconv.FormatInt(int64(f), 10)
+}
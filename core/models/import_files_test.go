@@ -0,0 +1,112 @@
+package models_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// builds a minimal XLSX file with the given shared strings and sheet data
+func makeXLSX(t *testing.T, sharedStrings, sheetData string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+
+	parts := map[string]string{
+		"xl/sharedStrings.xml":     `<?xml version="1.0" encoding="UTF-8"?><sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` + sharedStrings + `</sst>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?><worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` + sheetData + `</sheetData></worksheet>`,
+	}
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		w.Write([]byte(content))
+	}
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func readAllRecords(t *testing.T, r models.ContactImportRecordReader) [][]string {
+	records := make([][]string, 0)
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestContactImportRecordReader(t *testing.T) {
+	r, err := models.NewContactImportRecordReader("contacts.csv", strings.NewReader("URN:Tel,Name\n+16055740001,\"Bob, Jr\"\n+16055740002\n"))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"URN:Tel", "Name"}, {"+16055740001", "Bob, Jr"}, {"+16055740002"}}, readAllRecords(t, r))
+
+	xlsx := makeXLSX(t,
+		`<si><t>URN:Tel</t></si><si><t>Name</t></si><si><r><t>Ann </t></r><r><t>Smith</t></r></si>`,
+		`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>`+
+			`<row r="2"><c r="A2"><v>2.50788123456E+11</v></c><c r="B2" t="s"><v>2</v></c></row>`+
+			`<row r="3"><c r="B3" t="inlineStr"><is><t>Cat</t></is></c></row>`,
+	)
+	r, err = models.NewContactImportRecordReader("contacts.XLSX", bytes.NewReader(xlsx))
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"URN:Tel", "Name"}, {"250788123456", "Ann Smith"}, {"", "Cat"}}, readAllRecords(t, r))
+
+	_, err = models.NewContactImportRecordReader("contacts.xlsx", strings.NewReader("not a zip"))
+	assert.EqualError(t, err, "error reading xlsx file: zip: not a valid zip file")
+
+	_, err = models.NewContactImportRecordReader("contacts.xls", strings.NewReader(""))
+	assert.EqualError(t, err, "unsupported import file format: contacts.xls")
+}
+
+func TestContactImportCreateBatches(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	importID := testdata.InsertContactImport(db, testdata.Org1, testdata.Admin)
+	db.MustExec(`UPDATE contacts_contactimport SET group_id = $2, mappings = $3 WHERE id = $1`, importID, testdata.DoctorsGroup.ID, `[
+		{"header": "URN:Tel", "mapping": {"type": "scheme", "scheme": "tel"}},
+		{"header": "Name", "mapping": {"type": "attribute", "name": "name"}},
+		{"header": "Field:Gender", "mapping": {"type": "field", "key": "gender", "name": "Gender"}},
+		{"header": "Notes", "mapping": {"type": "ignore"}}
+	]`)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	imp, err := models.LoadContactImport(ctx, db, importID)
+	require.NoError(t, err)
+	assert.Equal(t, testdata.DoctorsGroup.ID, imp.GroupID)
+
+	csv := &strings.Builder{}
+	csv.WriteString("urn:tel,Name,Field:Gender,Notes\n")
+	for i := 0; i < 150; i++ {
+		csv.WriteString(fmt.Sprintf("+1605574%04d,Contact %d,F,ignore me\n", i, i))
+	}
+	csv.WriteString(",,,\n") // empty rows are skipped
+
+	reader, err := models.NewContactImportRecordReader("contacts.csv", strings.NewReader(csv.String()))
+	require.NoError(t, err)
+
+	batchIDs, err := imp.CreateBatches(ctx, db, oa, reader)
+	require.NoError(t, err)
+	assert.Len(t, batchIDs, 2)
+
+	assertdb.Query(t, db, `SELECT num_records FROM contacts_contactimport WHERE id = $1`, importID).Returns(150)
+	assertdb.Query(t, db, `SELECT record_start, record_end FROM contacts_contactimportbatch WHERE id = $1`, batchIDs[1]).Columns(map[string]interface{}{"record_start": int64(100), "record_end": int64(150)})
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactimportbatch WHERE id = $1 AND specs->0 = $2::jsonb`, batchIDs[0],
+		`{"name": "Contact 0", "urns": ["tel:+16055740000"], "uuid": "", "fields": {"gender": "F"}, "groups": ["`+string(testdata.DoctorsGroup.UUID)+`"], "language": null, "_import_row": 2}`,
+	).Returns(1)
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+)
+
+// ContactImportMatch is how records of a recurring import are matched to contacts
+type ContactImportMatch string
+
+const (
+	ContactImportMatchCreate   = ContactImportMatch("create")
+	ContactImportMatchExisting = ContactImportMatch("existing")
+)
+
+// ContactImportSource is a remote CSV or XLSX file which is imported regularly, e.g.
+//
+//	{
+//	  "uuid": "4b9a0a50-ff44-4ab8-9b5d-0e2f3f1c7a8b",
+//	  "name": "CRM Export",
+//	  "url": "https://crm.example.com/exports/contacts.csv",
+//	  "username": "mailroom",
+//	  "password": "sesame",
+//	  "mappings": [{"header": "Phone", "mapping": {"type": "scheme", "scheme": "tel"}}],
+//	  "group": {"uuid": "c153e265-f7c9-4539-9dbc-9b358714b638", "name": "CRM"},
+//	  "match": "existing",
+//	  "interval": 24,
+//	  "created_by": "admin@nyaruka.com"
+//	}
+//
+// Each time it's imported only the records which are new or have changed since the previous import are imported. If
+// match is existing then records which don't match an existing contact are ignored rather than creating new contacts.
+type ContactImportSource struct {
+	UUID      string                  `json:"uuid"       validate:"required,uuid4"`
+	Name      string                  `json:"name"       validate:"required"`
+	URL       string                  `json:"url"        validate:"required,url,startswith=https:"`
+	Username  string                  `json:"username"`
+	Password  string                  `json:"password"`
+	Mappings  []*ContactImportMapping `json:"mappings"   validate:"required,min=1"`
+	Group     *assets.GroupReference  `json:"group"`
+	Match     ContactImportMatch      `json:"match"      validate:"omitempty,eq=create|eq=existing"`
+	Interval  int                     `json:"interval"   validate:"required,min=1"`
+	CreatedBy string                  `json:"created_by" validate:"required,email"`
+}
+
+// ReadContactImportSources reads and validates contact import sources from the given JSON
+func ReadContactImportSources(data []byte) ([]*ContactImportSource, error) {
+	var sources []*ContactImportSource
+	if err := jsonx.Unmarshal(data, &sources); err != nil {
+		return nil, err
+	}
+	for _, s := range sources {
+		if err := utils.Validate(s); err != nil {
+			return nil, err
+		}
+	}
+	return sources, nil
+}
+
+// reads the contact import sources from the given org config value
+func readContactImportSourcesConfig(v interface{}) ([]*ContactImportSource, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadContactImportSources(data)
+}
+
+// Filename returns the filename of this source's file, which determines its format
+func (s *ContactImportSource) Filename() string {
+	return path.Base(s.URL)
+}
+
+const sqlSelectContactImportSourceOrgs = `
+  SELECT id
+    FROM orgs_org
+   WHERE is_active = TRUE AND (config::json)->'contact_import_sources' IS NOT NULL
+ORDER BY id`
+
+// LoadContactImportSourceOrgs loads the ids of the orgs which have contact import sources
+func LoadContactImportSourceOrgs(ctx context.Context, db Queryer) ([]OrgID, error) {
+	orgIDs := make([]OrgID, 0, 10)
+	if err := db.SelectContext(ctx, &orgIDs, sqlSelectContactImportSourceOrgs); err != nil {
+		return nil, errors.Wrap(err, "error loading orgs with contact import sources")
+	}
+	return orgIDs, nil
+}
+
+func contactImportSourceDueKey(s *ContactImportSource) string {
+	return fmt.Sprintf("contact_import_source_due:%s", s.UUID)
+}
+
+func contactImportSourceRowsKey(s *ContactImportSource) string {
+	return fmt.Sprintf("contact_import_source_rows:%s", s.UUID)
+}
+
+// ClaimContactImportSource claims the next import of the given source, returning false if it isn't due yet. Imports which
+// fail aren't retried until the source is next due.
+func ClaimContactImportSource(rc redis.Conn, s *ContactImportSource) (bool, error) {
+	reply, err := rc.Do("SET", contactImportSourceDueKey(s), time.Now().Unix(), "EX", s.Interval*60*60, "NX")
+	if err != nil {
+		return false, errors.Wrapf(err, "error claiming contact import source %s", s.UUID)
+	}
+	return reply != nil, nil
+}
+
+// hashes a record so that we can tell if it's changed between imports
+func hashImportRecord(record []string) string {
+	h := sha1.Sum(jsonx.MustMarshal(record))
+	return hex.EncodeToString(h[:])
+}
+
+// DiffContactImportRecords compares the given records of a source file, the first of which is the header row, with
+// those of the previous import of the source. Records which haven't changed are blanked so that they're skipped but
+// row numbers are kept. Returns the number of changed records and the hashes of all records to save once imported.
+func DiffContactImportRecords(rc redis.Conn, s *ContactImportSource, records [][]string) (int, []string, error) {
+	previous, err := redis.Strings(rc.Do("SMEMBERS", contactImportSourceRowsKey(s)))
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "error loading previous rows of contact import source %s", s.UUID)
+	}
+	seen := make(map[string]bool, len(previous))
+	for _, h := range previous {
+		seen[h] = true
+	}
+
+	hashes := make([]string, 0, len(records))
+	changed := 0
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+		h := hashImportRecord(record)
+		hashes = append(hashes, h)
+
+		if seen[h] {
+			records[i] = []string{}
+		} else {
+			changed++
+		}
+	}
+	return changed, hashes, nil
+}
+
+// SaveContactImportRecords saves the hashes of the records of the latest import of the given source
+func SaveContactImportRecords(rc redis.Conn, s *ContactImportSource, hashes []string) error {
+	key := contactImportSourceRowsKey(s)
+
+	rc.Send("MULTI")
+	rc.Send("DEL", key)
+	for start := 0; start < len(hashes); start += 1000 {
+		end := start + 1000
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		rc.Send("SADD", redis.Args{}.Add(key).AddFlat(hashes[start:end])...)
+	}
+	_, err := rc.Do("EXEC")
+	return errors.Wrapf(err, "error saving rows of contact import source %s", s.UUID)
+}
+
+const sqlInsertContactImport = `
+INSERT INTO contacts_contactimport(org_id, file, original_filename, mappings, num_records, group_id, started_on, status, created_on, created_by_id, modified_on, modified_by_id, is_active)
+                           VALUES($1, $2, $3, $4, 0, $5, NOW(), 'O', NOW(), $6, NOW(), $6, TRUE)
+  RETURNING id`
+
+// ImportFromSource creates a new contact import for the given source and creates batches from the given records of its
+// file, returning the import and its batches
+func ImportFromSource(ctx context.Context, db Queryer, oa *OrgAssets, s *ContactImportSource, records [][]string) (*ContactImport, []ContactImportBatchID, error) {
+	user := oa.UserByEmail(s.CreatedBy)
+	if user == nil {
+		return nil, nil, errors.Errorf("no such user: %s", s.CreatedBy)
+	}
+
+	groupID := NilGroupID
+	if s.Group != nil {
+		group := oa.GroupByUUID(s.Group.UUID)
+		if group == nil {
+			return nil, nil, errors.Errorf("no such group: %s", s.Group.UUID)
+		}
+		groupID = group.ID()
+	}
+
+	mappings := jsonx.MustMarshal(s.Mappings)
+
+	var importID ContactImportID
+	err := db.GetContext(ctx, &importID, sqlInsertContactImport, oa.OrgID(), s.Filename(), s.Name, mappings, nullGroupID(groupID), user.ID())
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error inserting contact import")
+	}
+
+	imp := &ContactImport{ID: importID, OrgID: oa.OrgID(), Status: ContactImportStatusProcessing, CreatedByID: user.ID(), GroupID: groupID, Mappings: mappings}
+
+	batchIDs, err := imp.createBatches(ctx, db, oa, &rowsReader{rows: records}, s.Match == ContactImportMatchExisting)
+	if err != nil {
+		return nil, nil, err
+	}
+	return imp, batchIDs, nil
+}
+
+// group ids aren't nullable so nil group ids need to be written as NULL
+func nullGroupID(id GroupID) interface{} {
+	if id == NilGroupID {
+		return nil
+	}
+	return id
+}
@@ -0,0 +1,74 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadContactImportSources(t *testing.T) {
+	sources, err := models.ReadContactImportSources([]byte(`[{
+		"uuid": "4b9a0a50-ff44-4ab8-9b5d-0e2f3f1c7a8b",
+		"name": "CRM Export",
+		"url": "https://crm.example.com/exports/contacts.csv",
+		"mappings": [{"header": "Phone", "mapping": {"type": "scheme", "scheme": "tel"}}],
+		"match": "existing",
+		"interval": 24,
+		"created_by": "admin1@nyaruka.com"
+	}]`))
+	require.NoError(t, err)
+	assert.Len(t, sources, 1)
+	assert.Equal(t, models.ContactImportMatchExisting, sources[0].Match)
+	assert.Equal(t, "contacts.csv", sources[0].Filename())
+
+	_, err = models.ReadContactImportSources([]byte(`[{
+		"uuid": "4b9a0a50-ff44-4ab8-9b5d-0e2f3f1c7a8b",
+		"name": "CRM Export",
+		"url": "http://crm.example.com/exports/contacts.csv",
+		"mappings": [{"header": "Phone", "mapping": {"type": "scheme", "scheme": "tel"}}],
+		"interval": 24,
+		"created_by": "admin1@nyaruka.com"
+	}]`))
+	assert.EqualError(t, err, "field 'url' must start with 'https:'")
+}
+
+func TestDiffContactImportRecords(t *testing.T) {
+	_, _, _, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	source := &models.ContactImportSource{UUID: "4b9a0a50-ff44-4ab8-9b5d-0e2f3f1c7a8b"}
+
+	records := [][]string{{"Phone", "Name"}, {"+16055740001", "Ann"}, {"+16055740002", "Bob"}}
+	changed, hashes, err := models.DiffContactImportRecords(rc, source, records)
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+	assert.Len(t, hashes, 2)
+	assert.Equal(t, [][]string{{"Phone", "Name"}, {"+16055740001", "Ann"}, {"+16055740002", "Bob"}}, records)
+
+	require.NoError(t, models.SaveContactImportRecords(rc, source, hashes))
+
+	// unchanged records are blanked
+	records = [][]string{{"Phone", "Name"}, {"+16055740001", "Ann"}, {"+16055740002", "Robert"}, {"+16055740003", "Cat"}}
+	changed, hashes, err = models.DiffContactImportRecords(rc, source, records)
+	require.NoError(t, err)
+	assert.Equal(t, 2, changed)
+	assert.Len(t, hashes, 3)
+	assert.Equal(t, [][]string{{"Phone", "Name"}, {}, {"+16055740002", "Robert"}, {"+16055740003", "Cat"}}, records)
+
+	// claiming a source only succeeds once per interval
+	source.Interval = 24
+	due, err := models.ClaimContactImportSource(rc, source)
+	require.NoError(t, err)
+	assert.True(t, due)
+
+	due, err = models.ClaimContactImportSource(rc, source)
+	require.NoError(t, err)
+	assert.False(t, due)
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+// staged imports which aren't approved within this time can no longer be approved
+const stagedImportExpiry = time.Hour * 24 * 7
+
+// ContactImportSummary is what applying a staged import would do. Field changes are the number of existing contacts
+// whose value of each field would change, with changes to name and language counted under those keys.
+type ContactImportSummary struct {
+	Creates      int            `json:"creates"`
+	Updates      int            `json:"updates"`
+	Errors       int            `json:"errors"`
+	FieldChanges map[string]int `json:"field_changes"`
+}
+
+const sqlSelectPendingContactImportBatches = `
+  SELECT id, contact_import_id, status, specs, record_start, record_end
+    FROM contacts_contactimportbatch
+   WHERE contact_import_id = $1 AND status = 'P'
+ORDER BY id`
+
+// LoadPendingContactImportBatches loads the batches of the given import which haven't been imported yet
+func LoadPendingContactImportBatches(ctx context.Context, db Queryer, importID ContactImportID) ([]*ContactImportBatch, error) {
+	batches := make([]*ContactImportBatch, 0, 10)
+	if err := db.SelectContext(ctx, &batches, sqlSelectPendingContactImportBatches, importID); err != nil {
+		return nil, errors.Wrapf(err, "error loading pending batches of contact import %d", importID)
+	}
+	return batches, nil
+}
+
+// SummarizeContactImport works out what applying the pending batches of the given import would do to the contacts of
+// the org without actually changing anything
+func SummarizeContactImport(ctx context.Context, db Queryer, oa *OrgAssets, importID ContactImportID) (*ContactImportSummary, error) {
+	batches, err := LoadPendingContactImportBatches(ctx, db, importID)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &ContactImportSummary{FieldChanges: map[string]int{}}
+
+	for _, batch := range batches {
+		var specs []*ContactSpec
+		if err := jsonx.Unmarshal(batch.Specs, &specs); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling specs of batch %d", batch.ID)
+		}
+		if err := summarizeContactSpecs(ctx, db, oa, specs, summary); err != nil {
+			return nil, err
+		}
+	}
+	return summary, nil
+}
+
+// adds the outcome of applying the given specs to the given summary
+func summarizeContactSpecs(ctx context.Context, db Queryer, oa *OrgAssets, specs []*ContactSpec, summary *ContactImportSummary) error {
+	uuids := make([]flows.ContactUUID, 0, len(specs))
+	urnz := make([]urns.URN, 0, len(specs))
+	for _, spec := range specs {
+		if spec.UUID != "" {
+			uuids = append(uuids, spec.UUID)
+		} else {
+			urnz = append(urnz, spec.URNs...)
+		}
+	}
+
+	byUUID, err := LoadContactsByUUID(ctx, db, oa, uuids)
+	if err != nil {
+		return errors.Wrap(err, "error loading contacts by UUID")
+	}
+	contactsByUUID := make(map[flows.ContactUUID]*Contact, len(byUUID))
+	for _, c := range byUUID {
+		contactsByUUID[c.UUID()] = c
+	}
+
+	owners, err := contactIDsFromURNs(ctx, db, oa.OrgID(), urnz)
+	if err != nil {
+		return errors.Wrap(err, "error looking up contacts by URN")
+	}
+	ownerIDs := make([]ContactID, 0, len(owners))
+	for _, id := range owners {
+		if id != NilContactID {
+			ownerIDs = append(ownerIDs, id)
+		}
+	}
+	byID, err := LoadContacts(ctx, db, oa, ownerIDs)
+	if err != nil {
+		return errors.Wrap(err, "error loading contacts by URN")
+	}
+	contactsByID := make(map[ContactID]*Contact, len(byID))
+	for _, c := range byID {
+		contactsByID[c.ID()] = c
+	}
+
+	for _, spec := range specs {
+		var contact *Contact
+
+		if spec.UUID != "" {
+			contact = contactsByUUID[spec.UUID]
+			if contact == nil {
+				summary.Errors++
+				continue
+			}
+		} else {
+			for _, u := range spec.URNs {
+				if contact = contactsByID[owners[u]]; contact != nil {
+					break
+				}
+			}
+			if contact == nil {
+				summary.Creates++
+				continue
+			}
+		}
+
+		summary.Updates++
+
+		if spec.Name != nil && *spec.Name != contact.Name() {
+			summary.FieldChanges["name"]++
+		}
+		if spec.Language != nil && *spec.Language != string(contact.Language()) {
+			summary.FieldChanges["language"]++
+		}
+		for key, value := range spec.Fields {
+			current := ""
+			if v := contact.Fields()[key]; v != nil {
+				current = v.Text.Native()
+			}
+			if value != current {
+				summary.FieldChanges[key]++
+			}
+		}
+	}
+	return nil
+}
+
+func stagedImportKey(importID ContactImportID) string {
+	return fmt.Sprintf("contact_import_staged:%d", importID)
+}
+
+// SetStagedContactImport records that the given import is staged awaiting approval along with its summary
+func SetStagedContactImport(rc redis.Conn, importID ContactImportID, summary *ContactImportSummary) error {
+	_, err := rc.Do("SET", stagedImportKey(importID), jsonx.MustMarshal(summary), "EX", int(stagedImportExpiry/time.Second))
+	return errors.Wrap(err, "error setting staged contact import")
+}
+
+// GetStagedContactImport gets the summary of the given staged import, or nil if it isn't staged
+func GetStagedContactImport(rc redis.Conn, importID ContactImportID) (*ContactImportSummary, error) {
+	data, err := redis.Bytes(rc.Do("GET", stagedImportKey(importID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting staged contact import")
+	}
+
+	summary := &ContactImportSummary{}
+	if err := jsonx.Unmarshal(data, summary); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling staged contact import")
+	}
+	return summary, nil
+}
+
+// ClearStagedContactImport removes the given import from staging, returning false if it wasn't staged
+func ClearStagedContactImport(rc redis.Conn, importID ContactImportID) (bool, error) {
+	deleted, err := redis.Int(rc.Do("DEL", stagedImportKey(importID)))
+	if err != nil {
+		return false, errors.Wrap(err, "error clearing staged contact import")
+	}
+	return deleted == 1, nil
+}
+
+const sqlUpdateContactImportStatus = `UPDATE contacts_contactimport SET status = $2 WHERE id = $1`
+
+// MarkStaged marks this import as pending approval
+func (i *ContactImport) MarkStaged(ctx context.Context, db Queryer) error {
+	i.Status = ContactImportStatusPending
+
+	_, err := db.ExecContext(ctx, sqlUpdateContactImportStatus, i.ID, i.Status)
+	return errors.Wrap(err, "error marking import as staged")
+}
+
+// MarkApproved marks this staged import as processing once it's been approved
+func (i *ContactImport) MarkApproved(ctx context.Context, db Queryer) error {
+	i.Status = ContactImportStatusProcessing
+
+	_, err := db.ExecContext(ctx, sqlUpdateContactImportStatus, i.ID, i.Status)
+	return errors.Wrap(err, "error marking import as approved")
+}
@@ -1,10 +1,12 @@
 package models
 
 import (
+	"bytes"
 	"context"
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -48,13 +50,15 @@ type ContactImport struct {
 	Status      ContactImportStatus `db:"status"`
 	CreatedByID UserID              `db:"created_by_id"`
 	FinishedOn  *time.Time          `db:"finished_on"`
+	GroupID     GroupID             `db:"group_id"`
+	Mappings    json.RawMessage     `db:"mappings"`
 
 	// we fetch unique batch statuses concatenated as a string, see https://github.com/jmoiron/sqlx/issues/168
 	BatchStatuses string `db:"batch_statuses"`
 }
 
 var sqlLoadContactImport = `
-         SELECT i.id, i.org_id, i.status, i.created_by_id, i.finished_on, array_to_string(array_agg(DISTINCT b.status), '') AS "batch_statuses"
+         SELECT i.id, i.org_id, i.status, i.created_by_id, i.finished_on, COALESCE(i.group_id, 0) AS group_id, i.mappings, array_to_string(array_agg(DISTINCT b.status), '') AS "batch_statuses"
            FROM contacts_contactimport i
 LEFT OUTER JOIN contacts_contactimportbatch b ON b.contact_import_id = i.id
           WHERE i.id = $1
@@ -135,18 +139,49 @@ func (b *ContactImportBatch) tryImport(ctx context.Context, rt *runtime.Runtime,
 		return errors.Wrap(err, "error loading org assets")
 	}
 
-	// unmarshal this batch's specs
-	var specs []*ContactSpec
-	if err := jsonx.Unmarshal(b.Specs, &specs); err != nil {
-		return errors.Wrap(err, "error unmarsaling specs")
+	// decode this batch's specs one at a time rather than all at once, and import them in chunks, so that large batches
+	// don't need all their specs and contacts in memory at the same time
+	decoder := json.NewDecoder(bytes.NewReader(b.Specs))
+	if _, err := decoder.Token(); err != nil {
+		return errors.Wrap(err, "error unmarshaling specs")
 	}
 
-	// create our work data for each contact being created or updated
-	imports := make([]*importContact, len(specs))
-	for i := range imports {
-		imports[i] = &importContact{record: b.RecordStart + i, spec: specs[i]}
+	maxInFlight := rt.Config.ImportMaxInFlight
+	results := &importResults{errors: make([]importError, 0, 10)}
+	chunk := make([]*importContact, 0, 100)
+
+	for record := b.RecordStart; decoder.More(); record++ {
+		spec := &ContactSpec{}
+		if err := decoder.Decode(spec); err != nil {
+			return errors.Wrap(err, "error unmarshaling specs")
+		}
+
+		chunk = append(chunk, &importContact{record: record, spec: spec})
+
+		if maxInFlight > 0 && len(chunk) >= maxInFlight {
+			if err := b.importChunk(ctx, rt, oa, chunk, results); err != nil {
+				return err
+			}
+			chunk = chunk[:0]
+		}
+	}
+
+	if len(chunk) > 0 {
+		if err := b.importChunk(ctx, rt, oa, chunk, results); err != nil {
+			return err
+		}
+	}
+
+	if err := b.markComplete(ctx, rt.DB, results); err != nil {
+		return errors.Wrap(err, "unable to mark as complete")
 	}
 
+	return nil
+}
+
+// imports a chunk of the contacts in this batch, adding the outcome of each to the given results
+func (b *ContactImportBatch) importChunk(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, imports []*importContact, results *importResults) error {
+	// create our work data for each contact being created or updated
 	if err := b.getOrCreateContacts(ctx, rt.DB, oa, imports); err != nil {
 		return errors.Wrap(err, "error getting and creating contacts")
 	}
@@ -162,18 +197,37 @@ func (b *ContactImportBatch) tryImport(ctx context.Context, rt *runtime.Runtime,
 
 	// and apply in bulk
 	// TODO pass user here who created the import?
-	_, err = ApplyModifiers(ctx, rt, oa, NilUserID, modifiersByContact)
-	if err != nil {
+	if _, err := ApplyModifiers(ctx, rt, oa, NilUserID, modifiersByContact); err != nil {
 		return errors.Wrap(err, "error applying modifiers")
 	}
 
-	if err := b.markComplete(ctx, rt.DB, imports); err != nil {
-		return errors.Wrap(err, "unable to mark as complete")
-	}
-
+	results.add(imports)
 	return nil
 }
 
+// the accumulated outcome of importing the contacts in a batch
+type importResults struct {
+	numCreated int
+	numUpdated int
+	numErrored int
+	errors     []importError
+}
+
+func (r *importResults) add(imports []*importContact) {
+	for _, imp := range imports {
+		if imp.contact == nil {
+			r.numErrored++
+		} else if imp.created {
+			r.numCreated++
+		} else {
+			r.numUpdated++
+		}
+		for _, e := range imp.errors {
+			r.errors = append(r.errors, importError{Record: imp.record, Row: imp.spec.ImportRow, Message: e})
+		}
+	}
+}
+
 // for each import, fetches or creates the contact, creates the modifiers needed to set fields etc
 func (b *ContactImportBatch) getOrCreateContacts(ctx context.Context, db QueryerWithTx, oa *OrgAssets, imports []*importContact) error {
 	sa := oa.SessionAssets()
@@ -229,12 +283,12 @@ func (b *ContactImportBatch) getOrCreateContacts(ctx context.Context, db Queryer
 			}
 		}
 
-		for key, value := range spec.Fields {
+		for _, key := range sortedFieldKeys(sa, spec.Fields) {
 			field := sa.Fields().Get(key)
 			if field == nil {
 				addError("'%s' is not a valid contact field key", key)
 			} else {
-				addModifier(modifiers.NewField(field, value))
+				addModifier(modifiers.NewField(field, NormalizeLocationValue(oa, field.Type(), spec.Fields[key])))
 			}
 		}
 
@@ -255,6 +309,30 @@ func (b *ContactImportBatch) getOrCreateContacts(ctx context.Context, db Queryer
 	return nil
 }
 
+// sorts the keys of the given field values so that location fields come last and in order of level, as wards and
+// districts are parsed relative to the contact's district and state values
+func sortedFieldKeys(sa flows.SessionAssets, values map[string]string) []string {
+	levelOf := func(key string) envs.LocationLevel {
+		if field := sa.Fields().Get(key); field != nil {
+			return LocationFieldLevel(field.Type())
+		}
+		return 0
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		li, lj := levelOf(keys[i]), levelOf(keys[j])
+		if li != lj {
+			return li < lj
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
 // loads any import contacts for which we have UUIDs
 func (b *ContactImportBatch) loadContactsByUUID(ctx context.Context, db Queryer, oa *OrgAssets, imports []*importContact) (map[flows.ContactUUID]*Contact, error) {
 	uuids := make([]flows.ContactUUID, 0, 50)
@@ -283,34 +361,17 @@ func (b *ContactImportBatch) markProcessing(ctx context.Context, db Queryer) err
 	return err
 }
 
-func (b *ContactImportBatch) markComplete(ctx context.Context, db Queryer, imports []*importContact) error {
-	numCreated := 0
-	numUpdated := 0
-	numErrored := 0
-	importErrors := make([]importError, 0, 10)
-	for _, imp := range imports {
-		if imp.contact == nil {
-			numErrored++
-		} else if imp.created {
-			numCreated++
-		} else {
-			numUpdated++
-		}
-		for _, e := range imp.errors {
-			importErrors = append(importErrors, importError{Record: imp.record, Row: imp.spec.ImportRow, Message: e})
-		}
-	}
-
-	errorsJSON, err := jsonx.Marshal(importErrors)
+func (b *ContactImportBatch) markComplete(ctx context.Context, db Queryer, results *importResults) error {
+	errorsJSON, err := jsonx.Marshal(results.errors)
 	if err != nil {
 		return errors.Wrap(err, "error marshaling errors")
 	}
 
 	now := dates.Now()
 	b.Status = ContactImportStatusComplete
-	b.NumCreated = numCreated
-	b.NumUpdated = numUpdated
-	b.NumErrored = numErrored
+	b.NumCreated = results.numCreated
+	b.NumUpdated = results.numUpdated
+	b.NumErrored = results.numErrored
 	b.Errors = errorsJSON
 	b.FinishedOn = &now
 	_, err = db.NamedExecContext(ctx,
@@ -191,6 +191,36 @@ func TestLoadContactImport(t *testing.T) {
 	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactimportbatch WHERE status = 'P' AND finished_on IS NULL`).Returns(1)
 }
 
+func TestContactImportBatchInChunks(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer func() { rt.Config.ImportMaxInFlight = 100 }()
+	defer testsuite.Reset(testsuite.ResetData)
+
+	rt.Config.ImportMaxInFlight = 2
+
+	importID := testdata.InsertContactImport(db, testdata.Org1, testdata.Admin)
+	batchID := testdata.InsertContactImportBatch(db, importID, []byte(`[
+		{"name": "Norbert", "urns": ["tel:+16055740001"]},
+		{"name": "Leah", "urns": ["tel:+16055740002"]},
+		{"uuid": "f3c5fbd4-2f7b-4e0c-8d9b-3c1e6a7d2b11"},
+		{"name": "Rowan", "language": "xyz", "urns": ["tel:+16055740003"]},
+		{"name": "Cathy", "urns": ["tel:+16055741111"]}
+	]`))
+
+	batch, err := models.LoadContactImportBatch(ctx, db, batchID)
+	require.NoError(t, err)
+
+	err = batch.Import(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	// results of all chunks are combined
+	assertdb.Query(t, db, `SELECT status, num_created, num_updated, num_errored FROM contacts_contactimportbatch WHERE id = $1`, batchID).
+		Columns(map[string]interface{}{"status": "C", "num_created": int64(3), "num_updated": int64(1), "num_errored": int64(1)})
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactimportbatch WHERE id = $1 AND jsonb_array_length(errors) = 2`, batchID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contact WHERE name IN ('Norbert', 'Leah', 'Rowan')`).Returns(3)
+}
+
 func TestContactSpecUnmarshal(t *testing.T) {
 	s := &models.ContactSpec{}
 	jsonx.Unmarshal([]byte(`{}`), s)
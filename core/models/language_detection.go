@@ -0,0 +1,198 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultDetectionMinWords   = 2
+	defaultDetectionConfidence = 0.7
+)
+
+// common words which are used to recognize languages written in the latin alphabet
+var languageStopwords = map[envs.Language][]string{
+	"eng": {"the", "and", "is", "are", "you", "your", "i", "my", "me", "it", "to", "of", "in", "for", "with", "what", "how", "yes", "no", "please", "thanks", "hello", "have", "want", "this", "that", "not", "can", "do", "where", "when"},
+	"fra": {"le", "la", "les", "et", "est", "je", "tu", "vous", "nous", "mon", "ma", "mes", "un", "une", "des", "du", "pour", "avec", "oui", "non", "merci", "bonjour", "pas", "ce", "que", "qui", "suis", "veux", "ou", "comment"},
+	"spa": {"el", "la", "los", "las", "y", "es", "yo", "tu", "usted", "mi", "un", "una", "por", "para", "con", "si", "no", "gracias", "hola", "que", "como", "quiero", "estoy", "donde", "pero", "muy", "del", "al", "bien"},
+	"por": {"o", "a", "os", "as", "e", "é", "eu", "você", "meu", "minha", "um", "uma", "para", "com", "sim", "não", "obrigado", "obrigada", "olá", "que", "como", "quero", "estou", "onde", "mas", "muito", "do", "da", "bem"},
+	"swa": {"na", "ni", "wa", "ya", "kwa", "za", "mimi", "wewe", "yangu", "habari", "asante", "ndiyo", "hapana", "sana", "nini", "gani", "lini", "wapi", "nataka", "niko", "karibu", "jambo", "tafadhali", "hii", "hiyo"},
+	"kin": {"ni", "na", "muri", "mwe", "cyane", "yego", "oya", "murakoze", "muraho", "amakuru", "ndashaka", "ndi", "iki", "he", "ryari", "ese", "bite", "nde", "uyu", "iyi", "ubu", "kandi", "neza", "mwaramutse"},
+}
+
+// languages which are recognized by the script they're written in
+var languageScripts = map[envs.Language]*unicode.RangeTable{
+	"ara": unicode.Arabic,
+	"amh": unicode.Ethiopic,
+	"rus": unicode.Cyrillic,
+	"hin": unicode.Devanagari,
+}
+
+// LanguageDetection is an org's configuration for detecting the language of incoming messages and setting it as the
+// language of contacts, so that flows are localized for them without having to ask. Contacts without a language are
+// given the detected language if detection is at least as confident as the given confidence, and contacts with a
+// language only have it changed if the override confidence is set and detection is at least that confident. Messages
+// with fewer recognized words than the minimum are ignored.
+//
+//	{
+//	  "min_words": 2,
+//	  "confidence": 0.7,
+//	  "override_confidence": 0.95
+//	}
+type LanguageDetection struct {
+	MinWords           int     `json:"min_words"           validate:"omitempty,gte=1"`
+	Confidence         float64 `json:"confidence"          validate:"omitempty,gt=0,lte=1"`
+	OverrideConfidence float64 `json:"override_confidence" validate:"omitempty,gt=0,lte=1"`
+}
+
+// ReadLanguageDetection reads and validates language detection config from the given JSON
+func ReadLanguageDetection(data []byte) (*LanguageDetection, error) {
+	d := &LanguageDetection{}
+	if err := utils.UnmarshalAndValidate(data, d); err != nil {
+		return nil, err
+	}
+	if d.MinWords == 0 {
+		d.MinWords = defaultDetectionMinWords
+	}
+	if d.Confidence == 0 {
+		d.Confidence = defaultDetectionConfidence
+	}
+	return d, nil
+}
+
+// reads language detection config from the given org config value
+func readLanguageDetectionConfig(v interface{}) (*LanguageDetection, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadLanguageDetection(data)
+}
+
+// DetectedLanguage is the result of detecting the language of some text
+type DetectedLanguage struct {
+	Language   envs.Language
+	Confidence float64
+	Words      int
+}
+
+// DetectLanguage detects which of the given candidate languages the given text is written in, or any language we can
+// recognize if there are no candidates. Returns nil if no language could be recognized. Languages with their own
+// scripts are recognized by the proportion of letters in that script, and others by the proportion of recognized common
+// words which belong to them.
+func DetectLanguage(text string, candidates []envs.Language) *DetectedLanguage {
+	isCandidate := func(l envs.Language) bool {
+		if len(candidates) == 0 {
+			return true
+		}
+		for _, c := range candidates {
+			if c == l {
+				return true
+			}
+		}
+		return false
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.Is(unicode.Mn, r) })
+	if len(words) == 0 {
+		return nil
+	}
+
+	// first check for scripts used only by specific languages
+	letters := 0
+	scriptLetters := make(map[envs.Language]int)
+	for _, w := range words {
+		for _, r := range w {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			letters++
+			for lang, script := range languageScripts {
+				if unicode.Is(script, r) {
+					scriptLetters[lang]++
+				}
+			}
+		}
+	}
+	for lang, count := range scriptLetters {
+		if isCandidate(lang) && count*2 > letters {
+			return &DetectedLanguage{Language: lang, Confidence: float64(count) / float64(letters), Words: len(words)}
+		}
+	}
+
+	// otherwise count the common words from each language
+	hits := make(map[envs.Language]int)
+	recognized := 0
+	for _, w := range words {
+		isRecognized := false
+		for lang, stopwords := range languageStopwords {
+			if isCandidate(lang) && utils.StringSliceContains(stopwords, w, true) {
+				hits[lang]++
+				isRecognized = true
+			}
+		}
+		if isRecognized {
+			recognized++
+		}
+	}
+
+	var best *DetectedLanguage
+	for lang, count := range hits {
+		if best == nil || count > best.Words || (count == best.Words && lang < best.Language) {
+			best = &DetectedLanguage{Language: lang, Words: count}
+		}
+	}
+	if best == nil {
+		return nil
+	}
+
+	best.Confidence = float64(best.Words) / float64(recognized)
+
+	// any tie means we can't be confident about either language
+	for lang, count := range hits {
+		if lang != best.Language && count == best.Words {
+			best.Confidence = best.Confidence / 2
+			break
+		}
+	}
+
+	return best
+}
+
+// DetectContactLanguage detects the language of the given incoming message text and if the org has language detection
+// enabled, and detection is confident enough, sets it as the contact's language
+func DetectContactLanguage(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contact *flows.Contact, text string) error {
+	ld := oa.Org().LanguageDetection()
+	if ld == nil {
+		return nil
+	}
+
+	detected := DetectLanguage(text, oa.Org().AllowedLanguages())
+	if detected == nil || detected.Words < ld.MinWords || detected.Language == contact.Language() {
+		return nil
+	}
+
+	if contact.Language() == envs.NilLanguage {
+		if detected.Confidence < ld.Confidence {
+			return nil
+		}
+	} else if ld.OverrideConfidence == 0 || detected.Confidence < ld.OverrideConfidence {
+		return nil
+	}
+
+	logrus.WithFields(logrus.Fields{"org_id": oa.OrgID(), "contact_uuid": contact.UUID(), "language": detected.Language, "confidence": detected.Confidence}).Debug("detected contact language")
+
+	mods := []flows.Modifier{modifiers.NewLanguage(detected.Language)}
+	_, err := ApplyModifiers(ctx, rt, oa, NilUserID, map[*flows.Contact][]flows.Modifier{contact: mods})
+	return errors.Wrap(err, "error setting detected contact language")
+}
@@ -0,0 +1,64 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLanguageDetection(t *testing.T) {
+	d, err := models.ReadLanguageDetection([]byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.MinWords)
+	assert.Equal(t, 0.7, d.Confidence)
+	assert.Equal(t, 0.0, d.OverrideConfidence)
+
+	d, err = models.ReadLanguageDetection([]byte(`{"min_words": 3, "confidence": 0.8, "override_confidence": 0.95}`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, d.MinWords)
+	assert.Equal(t, 0.8, d.Confidence)
+	assert.Equal(t, 0.95, d.OverrideConfidence)
+
+	_, err = models.ReadLanguageDetection([]byte(`{"confidence": 1.5}`))
+	assert.EqualError(t, err, "field 'confidence' failed tag 'lte'")
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tcs := []struct {
+		text       string
+		candidates []envs.Language
+		language   envs.Language
+		confidence float64
+	}{
+		{"", nil, envs.NilLanguage, 0},
+		{"12345 !!", nil, envs.NilLanguage, 0},
+		{"xyzzy plugh", nil, envs.NilLanguage, 0},
+		{"Hello, how are you?", nil, "eng", 1},
+		{"Bonjour, comment allez-vous?", nil, "fra", 1},
+		{"Hola, ¿cómo estás? Quiero ayuda", nil, "spa", 1},
+		{"Olá, como você está?", nil, "por", 1},
+		{"Habari yako, nataka msaada", nil, "swa", 1},
+		{"Muraho, amakuru yawe?", nil, "kin", 1},
+		{"مرحبا كيف حالك", nil, "ara", 1},
+		{"ሰላም እንዴት ነህ", nil, "amh", 1},
+		{"si no", nil, "spa", 1},
+		{"la que", nil, "fra", 0.5},                  // tie between french and spanish
+		{"la que", []envs.Language{"spa"}, "spa", 1}, // unless only one is a candidate
+		{"Hello, how are you?", []envs.Language{"fra", "spa"}, envs.NilLanguage, 0},
+		{"مرحبا كيف حالك", []envs.Language{"eng"}, envs.NilLanguage, 0},
+	}
+
+	for _, tc := range tcs {
+		detected := models.DetectLanguage(tc.text, tc.candidates)
+		if tc.language == envs.NilLanguage {
+			assert.Nil(t, detected, "expected no language for '%s'", tc.text)
+		} else if assert.NotNil(t, detected, "expected language for '%s'", tc.text) {
+			assert.Equal(t, tc.language, detected.Language, "language mismatch for '%s'", tc.text)
+			assert.Equal(t, tc.confidence, detected.Confidence, "confidence mismatch for '%s'", tc.text)
+		}
+	}
+}
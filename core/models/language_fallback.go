@@ -0,0 +1,63 @@
+package models
+
+import (
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/pkg/errors"
+)
+
+// LanguageFallback is an org's ordered list of languages to fall back along when localizing outgoing messages for a
+// contact whose language has no translation, before falling back to the base language
+//
+//	["kin", "fra", "eng"]
+type LanguageFallback []envs.Language
+
+// ReadLanguageFallback reads and validates a language fallback chain from the given JSON
+func ReadLanguageFallback(data []byte) (LanguageFallback, error) {
+	var codes []string
+	if err := jsonx.Unmarshal(data, &codes); err != nil {
+		return nil, err
+	}
+	if len(codes) == 0 {
+		return nil, errors.New("language fallback must have at least one language")
+	}
+
+	fallback := make(LanguageFallback, len(codes))
+	for i, code := range codes {
+		lang, err := envs.ParseLanguage(code)
+		if err != nil {
+			return nil, err
+		}
+		fallback[i] = lang
+	}
+	return fallback, nil
+}
+
+// reads a language fallback chain from the given org config value
+func readLanguageFallbackConfig(v interface{}) (LanguageFallback, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadLanguageFallback(data)
+}
+
+// LocalizationLanguages returns the languages to try in order when localizing for a contact with the given language,
+// i.e. that language followed by the org's fallback chain, or its default language if it doesn't have a chain
+func (o *Org) LocalizationLanguages(contactLang envs.Language) []envs.Language {
+	chain := []envs.Language(o.languageFallback)
+	if len(chain) == 0 {
+		chain = []envs.Language{o.DefaultLanguage()}
+	}
+
+	languages := make([]envs.Language, 0, len(chain)+1)
+	seen := make(map[envs.Language]bool, len(chain)+1)
+
+	for _, l := range append([]envs.Language{contactLang}, chain...) {
+		if l != envs.NilLanguage && !seen[l] {
+			languages = append(languages, l)
+			seen[l] = true
+		}
+	}
+	return languages
+}
@@ -0,0 +1,40 @@
+package models_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLanguageFallback(t *testing.T) {
+	fallback, err := models.ReadLanguageFallback([]byte(`["kin", "fra", "eng"]`))
+	assert.NoError(t, err)
+	assert.Equal(t, models.LanguageFallback{"kin", "fra", "eng"}, fallback)
+
+	_, err = models.ReadLanguageFallback([]byte(`[]`))
+	assert.EqualError(t, err, "language fallback must have at least one language")
+
+	_, err = models.ReadLanguageFallback([]byte(`["kin", "xyz"]`))
+	assert.Error(t, err)
+
+	org := &models.Org{}
+	err = json.Unmarshal([]byte(`{"id": 1, "allowed_languages": ["eng", "fra", "kin"], "config": {"language_fallback": ["kin", "fra"]}}`), org)
+	require.NoError(t, err)
+
+	assert.Equal(t, models.LanguageFallback{"kin", "fra"}, org.LanguageFallback())
+	assert.Equal(t, []envs.Language{"fra", "kin"}, org.LocalizationLanguages("fra"))
+	assert.Equal(t, []envs.Language{"kin", "fra"}, org.LocalizationLanguages(envs.NilLanguage))
+
+	// without a fallback chain we just fall back to the default language
+	org = &models.Org{}
+	err = json.Unmarshal([]byte(`{"id": 1, "allowed_languages": ["eng", "fra", "kin"]}`), org)
+	require.NoError(t, err)
+
+	assert.Nil(t, org.LanguageFallback())
+	assert.Equal(t, []envs.Language{"fra", "eng"}, org.LocalizationLanguages("fra"))
+	assert.Equal(t, []envs.Language{"eng"}, org.LocalizationLanguages(envs.NilLanguage))
+}
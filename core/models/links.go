@@ -0,0 +1,174 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+)
+
+// TrackedLinkID is our type for tracked link ids
+type TrackedLinkID int64
+
+// the characters and length of the codes in our short links
+const (
+	linkCodeChars  = "abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	linkCodeLength = 8
+)
+
+// finds URLs in message text, trailing punctuation is trimmed after matching
+var linkURLRegex = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// LinkTracking is an org's configuration for rewriting URLs in outgoing flow and broadcast messages as short links
+// whose clicks are tracked. The base URL must be routed to mailroom's /mr/link/ endpoint, e.g. by a proxy.
+//
+//	{
+//	  "base_url": "https://go.example.com"
+//	}
+type LinkTracking struct {
+	BaseURL string `json:"base_url" validate:"required,url"`
+}
+
+// ReadLinkTracking reads and validates link tracking config from the given JSON
+func ReadLinkTracking(data []byte) (*LinkTracking, error) {
+	t := &LinkTracking{}
+	if err := utils.UnmarshalAndValidate(data, t); err != nil {
+		return nil, err
+	}
+	t.BaseURL = strings.TrimSuffix(t.BaseURL, "/")
+	return t, nil
+}
+
+// Rewrite replaces the URLs in the given text with short links, returning the new text and the links created
+func (t *LinkTracking) Rewrite(text string, newLink func(string) *TrackedLink) (string, []*TrackedLink) {
+	links := make([]*TrackedLink, 0)
+
+	rewritten := linkURLRegex.ReplaceAllStringFunc(text, func(match string) string {
+		url := strings.TrimRight(match, ".,;:!?)'")
+		if strings.HasPrefix(url, t.BaseURL+"/") {
+			return match
+		}
+
+		link := newLink(url)
+		links = append(links, link)
+
+		return t.BaseURL + "/" + link.Code + match[len(url):]
+	})
+
+	return rewritten, links
+}
+
+// TrackedLink is a short link created for a URL in an outgoing message
+type TrackedLink struct {
+	ID           TrackedLinkID `db:"id"`
+	OrgID        OrgID         `db:"org_id"`
+	Code         string        `db:"code"`
+	URL          string        `db:"url"`
+	ContactID    ContactID     `db:"contact_id"`
+	ChannelID    ChannelID     `db:"channel_id"`
+	ContactURNID URNID         `db:"contact_urn_id"`
+	MsgID        flows.MsgID   `db:"msg_id"`
+	SessionID    SessionID     `db:"session_id"` // zero if not sent by a session
+	CreatedOn    time.Time     `db:"created_on"`
+}
+
+// NewLinkCode generates a new random code for a short link, using a secure source of randomness so that codes, and
+// hence the contacts who were sent them, can't be guessed
+func NewLinkCode() string {
+	numChars := big.NewInt(int64(len(linkCodeChars)))
+	b := make([]byte, linkCodeLength)
+	for i := range b {
+		n, err := rand.Int(rand.Reader, numChars)
+		if err != nil {
+			panic(errors.Wrap(err, "error generating link code"))
+		}
+		b[i] = linkCodeChars[n.Int64()]
+	}
+	return string(b)
+}
+
+// rewrites the URLs in this message's text as short links if its org has link tracking enabled
+func (m *Msg) applyLinkTracking(org *Org) {
+	lt := org.LinkTracking()
+	if lt == nil || m.m.Status == MsgStatusFailed || m.m.ContactURNID == nil || m.m.ChannelID == NilChannelID {
+		return
+	}
+
+	now := dates.Now()
+
+	m.m.Text, m.links = lt.Rewrite(m.m.Text, func(url string) *TrackedLink {
+		return &TrackedLink{
+			OrgID:        m.m.OrgID,
+			Code:         NewLinkCode(),
+			URL:          url,
+			ContactID:    m.m.ContactID,
+			ChannelID:    m.m.ChannelID,
+			ContactURNID: *m.m.ContactURNID,
+			SessionID:    m.m.SessionID,
+			CreatedOn:    now,
+		}
+	})
+}
+
+const sqlInsertTrackedLinks = `
+INSERT INTO links_trackedlink(org_id, code, url, contact_id, channel_id, contact_urn_id, msg_id, session_id, created_on)
+                       VALUES(:org_id, :code, :url, :contact_id, :channel_id, :contact_urn_id, :msg_id, NULLIF(:session_id, 0), :created_on)
+RETURNING id`
+
+// inserts the tracked links created for any of the given messages, which must already have ids
+func insertTrackedLinks(ctx context.Context, db Queryer, msgs []*Msg) error {
+	links := make([]*TrackedLink, 0)
+
+	for _, m := range msgs {
+		for _, l := range m.links {
+			l.MsgID = m.ID()
+			links = append(links, l)
+		}
+	}
+
+	return BulkQuery(ctx, "insert tracked links", db, sqlInsertTrackedLinks, links)
+}
+
+const sqlSelectTrackedLinkByCode = `
+SELECT l.id, l.org_id, l.code, l.url, l.contact_id, l.channel_id, l.contact_urn_id, l.msg_id, COALESCE(l.session_id, 0) AS session_id, l.created_on
+  FROM links_trackedlink l
+  JOIN orgs_org o ON o.id = l.org_id
+ WHERE l.code = $1 AND o.is_active = TRUE`
+
+// LoadTrackedLinkByCode loads the tracked link with the given code, returning nil if it doesn't exist
+func LoadTrackedLinkByCode(ctx context.Context, db Queryer, code string) (*TrackedLink, error) {
+	links := make([]*TrackedLink, 0, 1)
+	if err := db.SelectContext(ctx, &links, sqlSelectTrackedLinkByCode, code); err != nil {
+		return nil, errors.Wrapf(err, "error loading tracked link with code '%s'", code)
+	}
+	if len(links) == 0 {
+		return nil, nil
+	}
+	return links[0], nil
+}
+
+// NewClickEvent creates a new channel event recording a click on this link
+func (l *TrackedLink) NewClickEvent() *ChannelEvent {
+	extra := map[string]interface{}{
+		"code": l.Code,
+		"url":  l.URL,
+	}
+	return NewChannelEvent(LinkClickedEventType, l.OrgID, l.ChannelID, l.ContactID, l.ContactURNID, extra, false)
+}
+
+// reads the link tracking config from the given org config value
+func readLinkTrackingConfig(v interface{}) (*LinkTracking, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadLinkTracking(data)
+}
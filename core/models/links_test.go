@@ -0,0 +1,70 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadLinkTracking(t *testing.T) {
+	lt, err := models.ReadLinkTracking([]byte(`{"base_url": "https://go.example.com/"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://go.example.com", lt.BaseURL)
+
+	_, err = models.ReadLinkTracking([]byte(`{}`))
+	assert.EqualError(t, err, "field 'base_url' is required")
+
+	_, err = models.ReadLinkTracking([]byte(`{"base_url": "example"}`))
+	assert.EqualError(t, err, "field 'base_url' is not a valid URL")
+}
+
+func TestLinkTrackingRewrite(t *testing.T) {
+	lt, err := models.ReadLinkTracking([]byte(`{"base_url": "https://go.example.com"}`))
+	require.NoError(t, err)
+
+	codes := []string{"mtV5Mh5H", "TrdyQHJf", "RxeGkYSb"}
+	newLink := func(url string) *models.TrackedLink {
+		code := codes[0]
+		codes = codes[1:]
+		return &models.TrackedLink{Code: code, URL: url}
+	}
+
+	tcs := []struct {
+		text      string
+		rewritten string
+		urls      []string
+	}{
+		{"Hi there", "Hi there", []string{}},
+		{"See https://nyaruka.com/about.", "See https://go.example.com/mtV5Mh5H.", []string{"https://nyaruka.com/about"}},
+		{
+			"Go to http://a.com?x=1 or (https://b.com/y)!",
+			"Go to https://go.example.com/TrdyQHJf or (https://go.example.com/RxeGkYSb)!",
+			[]string{"http://a.com?x=1", "https://b.com/y"},
+		},
+		{"Already short https://go.example.com/abcdefgh", "Already short https://go.example.com/abcdefgh", []string{}},
+	}
+
+	for _, tc := range tcs {
+		rewritten, links := lt.Rewrite(tc.text, newLink)
+		assert.Equal(t, tc.rewritten, rewritten, "rewritten text mismatch for '%s'", tc.text)
+
+		urls := make([]string, len(links))
+		for i, l := range links {
+			urls[i] = l.URL
+		}
+		assert.Equal(t, tc.urls, urls, "link URLs mismatch for '%s'", tc.text)
+	}
+}
+
+func TestNewLinkCode(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		code := models.NewLinkCode()
+		assert.Regexp(t, `^[a-km-zA-HJ-NP-Z2-9]{8}$`, code)
+		assert.False(t, seen[code], "duplicate link code %s", code)
+		seen[code] = true
+	}
+}
@@ -3,10 +3,12 @@ package models
 import (
 	"context"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/lib/pq"
@@ -142,3 +144,75 @@ WHERE
 ORDER BY
 	l.level, l.id;
 `
+
+// the levels of location held by location field types
+var locationFieldLevels = map[assets.FieldType]envs.LocationLevel{
+	assets.FieldTypeState:    flows.LocationLevelState,
+	assets.FieldTypeDistrict: flows.LocationLevelDistrict,
+	assets.FieldTypeWard:     flows.LocationLevelWard,
+}
+
+// LocationFieldLevel returns the level of location held by the given field type, or 0 if it's not a location type
+func LocationFieldLevel(fieldType assets.FieldType) envs.LocationLevel {
+	return locationFieldLevels[fieldType]
+}
+
+// NormalizeLocationValue resolves a value of a location field written as a path, e.g. "Rwanda > Kigali City > Gasabo",
+// to the canonical path of that location. Each part of the path can be a name or alias, and the country can be left
+// off. Values which aren't paths or can't be resolved are returned as is, as they're matched by name or alias when
+// they're parsed.
+func NormalizeLocationValue(oa *OrgAssets, fieldType assets.FieldType, value string) string {
+	level := LocationFieldLevel(fieldType)
+	hierarchies := oa.SessionAssets().Locations().Hierarchies()
+
+	if level == 0 || len(hierarchies) == 0 || !envs.IsPossibleLocationPath(value) {
+		return value
+	}
+
+	hierarchy, isEnvHierarchy := hierarchies[0].(*envs.LocationHierarchy)
+	if !isEnvHierarchy {
+		return value
+	}
+
+	parts := strings.Split(value, envs.LocationPathSeparator)
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	// the path can start with the country or with the state
+	location := hierarchy.Root()
+	if matches := hierarchy.FindByName(parts[0], 0, nil); len(matches) > 0 {
+		parts = parts[1:]
+	}
+
+	for i, part := range parts {
+		matches := hierarchy.FindByName(part, envs.LocationLevel(i+1), location)
+		if len(matches) == 0 {
+			return value
+		}
+		location = matches[0]
+	}
+
+	if location.Level() != level {
+		return value
+	}
+
+	return string(location.Path())
+}
+
+// ReparseLocationValue reparses a value of a location field which didn't match a location because it's a path which
+// uses aliases, and returns the new value. Any other value is returned as is.
+func ReparseLocationValue(oa *OrgAssets, contact *flows.Contact, field *flows.Field, value *flows.Value) *flows.Value {
+	if value == nil || LocationFieldLevel(field.Type()) == 0 || valueHasType(value, field.Type()) {
+		return value
+	}
+
+	text := value.Text.Native()
+	normalized := NormalizeLocationValue(oa, field.Type(), text)
+	if normalized == text {
+		return value
+	}
+
+	env := flows.NewEnvironment(oa.Env(), oa.SessionAssets().Locations())
+	return contact.Fields().Parse(env, oa.SessionAssets().Fields(), field, normalized)
+}
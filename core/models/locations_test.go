@@ -3,6 +3,7 @@ package models_test
 import (
 	"testing"
 
+	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/testsuite"
@@ -53,4 +54,14 @@ func TestLocations(t *testing.T) {
 		assert.Equal(t, tc.Aliases, state.Aliases())
 		assert.Equal(t, tc.NumChildren, len(state.Children()))
 	}
+
+	// paths can use aliases and leave off the country
+	assert.Equal(t, "Nigeria > Sokoto", models.NormalizeLocationValue(oa, assets.FieldTypeState, "Nigeria > Soko"))
+	assert.Equal(t, "Nigeria > Zamfara", models.NormalizeLocationValue(oa, assets.FieldTypeState, "Nigeria>zamfara"))
+
+	// other values are left as is, names being matched against aliases when they're parsed
+	assert.Equal(t, "Soko", models.NormalizeLocationValue(oa, assets.FieldTypeState, "Soko"))
+	assert.Equal(t, "Nigeria > Sokoz", models.NormalizeLocationValue(oa, assets.FieldTypeState, "Nigeria > Sokoz"))
+	assert.Equal(t, "Nigeria > Soko", models.NormalizeLocationValue(oa, assets.FieldTypeDistrict, "Nigeria > Soko"))
+	assert.Equal(t, "Nigeria > Soko", models.NormalizeLocationValue(oa, assets.FieldTypeText, "Nigeria > Soko"))
 }
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+// AbuseAction is what happens to a contact whose incoming messages break an org's abuse rules
+type AbuseAction string
+
+const (
+	AbuseActionBlock = AbuseAction("block")
+	AbuseActionStop  = AbuseAction("stop")
+)
+
+// AbuseReason is which of an org's abuse rules a contact broke
+type AbuseReason string
+
+const (
+	AbuseReasonTooManyMsgs  = AbuseReason("too_many_msgs")
+	AbuseReasonRepeatedMsgs = AbuseReason("repeated_msgs")
+)
+
+const defaultAbuseWindow = 300
+
+// AbuseDetection is an org's configuration for automatically blocking or stopping contacts who send too many messages,
+// or the same message too many times, within a window of the given number of seconds. It's checked before any triggers
+// so abusive contacts can't start flows.
+//
+//	{
+//	  "max_msgs": 30,
+//	  "max_repeats": 10,
+//	  "window": 300,
+//	  "action": "block"
+//	}
+type AbuseDetection struct {
+	MaxMsgs    int         `json:"max_msgs"    validate:"omitempty,gt=0"`
+	MaxRepeats int         `json:"max_repeats" validate:"omitempty,gt=0"`
+	Window     int         `json:"window"      validate:"omitempty,gt=0"`
+	Action     AbuseAction `json:"action"      validate:"eq=block|eq=stop"`
+}
+
+// ReadAbuseDetection reads and validates abuse detection config from the given JSON
+func ReadAbuseDetection(data []byte) (*AbuseDetection, error) {
+	d := &AbuseDetection{}
+	if err := utils.UnmarshalAndValidate(data, d); err != nil {
+		return nil, err
+	}
+	if d.MaxMsgs == 0 && d.MaxRepeats == 0 {
+		return nil, errors.New("at least one of max_msgs and max_repeats is required")
+	}
+	if d.Window == 0 {
+		d.Window = defaultAbuseWindow
+	}
+	return d, nil
+}
+
+// reads abuse detection config from the given org config value
+func readAbuseDetectionConfig(v interface{}) (*AbuseDetection, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadAbuseDetection(data)
+}
+
+// Status returns the contact status which this config's action changes abusive contacts to
+func (d *AbuseDetection) Status() flows.ContactStatus {
+	if d.Action == AbuseActionStop {
+		return flows.ContactStatusStopped
+	}
+	return flows.ContactStatusBlocked
+}
+
+var msgAbuseScript = redis.NewScript(1, `
+local key, text, window = KEYS[1], ARGV[1], tonumber(ARGV[2])
+
+local count = redis.call("HINCRBY", key, "count", 1)
+if count == 1 then
+	redis.call("EXPIRE", key, window)
+end
+
+local repeats = 1
+if redis.call("HGET", key, "text") == text then
+	repeats = redis.call("HINCRBY", key, "repeats", 1)
+else
+	redis.call("HSET", key, "text", text, "repeats", 1)
+end
+
+return {count, repeats}
+`)
+
+var msgAbuseKeys = orgkeys.Register("msg_abuse:%d:%d")
+
+// IncrementMsgAbuseCounts increments and returns the number of messages the given contact has sent in the current
+// window, and the number of times in a row they've sent the given text
+func IncrementMsgAbuseCounts(rp *redis.Pool, orgID OrgID, contactID ContactID, text string, window int) (int, int, error) {
+	rc := rp.Get()
+	defer rc.Close()
+
+	hash := sha1.Sum([]byte(text))
+	key := msgAbuseKeys.Key(int(orgID), contactID)
+
+	counts, err := redis.Ints(msgAbuseScript.Do(rc, key, hex.EncodeToString(hash[:]), window))
+	if err != nil {
+		return 0, 0, err
+	}
+	return counts[0], counts[1], nil
+}
+
+// AbuseDetected is the data of the org event raised when a contact is blocked or stopped for abuse
+type AbuseDetected struct {
+	Reason AbuseReason `json:"reason"`
+	Action AbuseAction `json:"action"`
+	Count  int         `json:"count"`
+	Window int         `json:"window"`
+}
+
+// CheckMsgAbuse counts the given incoming message against the org's abuse rules, if it has them, and if the contact has
+// now broken them, blocks or stops the contact and raises an org event. Returns whether the contact was found abusive.
+func CheckMsgAbuse(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contact *flows.Contact, text string) (bool, error) {
+	ad := oa.Org().AbuseDetection()
+	if ad == nil {
+		return false, nil
+	}
+
+	count, repeats, err := IncrementMsgAbuseCounts(rt.RP, oa.OrgID(), ContactID(contact.ID()), text, ad.Window)
+	if err != nil {
+		return false, errors.Wrap(err, "error incrementing msg abuse counts")
+	}
+
+	var detected *AbuseDetected
+	if ad.MaxMsgs > 0 && count > ad.MaxMsgs {
+		detected = &AbuseDetected{Reason: AbuseReasonTooManyMsgs, Action: ad.Action, Count: count, Window: ad.Window}
+	} else if ad.MaxRepeats > 0 && text != "" && repeats > ad.MaxRepeats {
+		detected = &AbuseDetected{Reason: AbuseReasonRepeatedMsgs, Action: ad.Action, Count: repeats, Window: ad.Window}
+	}
+	if detected == nil {
+		return false, nil
+	}
+
+	mods := []flows.Modifier{modifiers.NewStatus(ad.Status())}
+	if _, err := ApplyModifiers(ctx, rt, oa, NilUserID, map[*flows.Contact][]flows.Modifier{contact: mods}); err != nil {
+		return false, errors.Wrap(err, "error changing status of abusive contact")
+	}
+
+	PublishOrgEvents(ctx, rt, oa.OrgID(), []*OrgEvent{NewAbuseDetectedOrgEvent(ContactID(contact.ID()), detected, dates.Now())})
+
+	return true, nil
+}
@@ -0,0 +1,54 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadAbuseDetection(t *testing.T) {
+	d, err := models.ReadAbuseDetection([]byte(`{"max_msgs": 30, "action": "block"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 30, d.MaxMsgs)
+	assert.Equal(t, 0, d.MaxRepeats)
+	assert.Equal(t, 300, d.Window)
+	assert.Equal(t, flows.ContactStatusBlocked, d.Status())
+
+	d, err = models.ReadAbuseDetection([]byte(`{"max_repeats": 5, "window": 60, "action": "stop"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 5, d.MaxRepeats)
+	assert.Equal(t, 60, d.Window)
+	assert.Equal(t, flows.ContactStatusStopped, d.Status())
+
+	_, err = models.ReadAbuseDetection([]byte(`{"action": "block"}`))
+	assert.EqualError(t, err, "at least one of max_msgs and max_repeats is required")
+
+	_, err = models.ReadAbuseDetection([]byte(`{"max_msgs": 30, "action": "delete"}`))
+	assert.Error(t, err)
+}
+
+func TestIncrementMsgAbuseCounts(t *testing.T) {
+	_, _, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	assertCounts := func(contact *testdata.Contact, text string, expectedCount, expectedRepeats int) {
+		count, repeats, err := models.IncrementMsgAbuseCounts(rp, testdata.Org1.ID, contact.ID, text, 300)
+		require.NoError(t, err)
+		assert.Equal(t, expectedCount, count)
+		assert.Equal(t, expectedRepeats, repeats)
+	}
+
+	assertCounts(testdata.Cathy, "hi", 1, 1)
+	assertCounts(testdata.Cathy, "hi", 2, 2)
+	assertCounts(testdata.Bob, "hi", 1, 1)
+	assertCounts(testdata.Cathy, "hi", 3, 3)
+	assertCounts(testdata.Cathy, "bye", 4, 1)
+	assertCounts(testdata.Cathy, "hi", 5, 1)
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"github.com/nyaruka/gocommon/gsm7"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/shopspring/decimal"
+)
+
+// costs are accumulated in analytics counts and broadcast progress as integer millionths of the channel's currency
+var costMicrosPerUnit = decimal.NewFromInt(1000000)
+
+// MsgSegments returns the number of parts an outgoing message with the given text and number of attachments will be
+// sent as. Messages to phone numbers are split into GSM-7 or UCS-2 SMS segments depending on the characters in their
+// text, and other messages are sent as a single part.
+func MsgSegments(urn urns.URN, text string, attachments int) int {
+	if urn.Scheme() != urns.TelScheme {
+		return 1
+	}
+	return gsm7.Segments(text) + attachments
+}
+
+// Cost returns the cost of this message, which is its number of segments at the rate configured on its channel, or nil
+// if it has no channel or the channel has no rate
+func (m *Msg) Cost() *decimal.Decimal {
+	if m.channel == nil {
+		return nil
+	}
+	return segmentsCost(m.channel, m.MsgCount())
+}
+
+// gets the cost of sending the given number of segments on the given channel, or nil if the channel has no rate
+func segmentsCost(channel *Channel, segments int) *decimal.Decimal {
+	rate := channel.MsgCost()
+	if rate == nil {
+		return nil
+	}
+	cost := rate.Mul(decimal.NewFromInt(int64(segments)))
+	return &cost
+}
+
+func costToMicros(cost decimal.Decimal) int {
+	return int(cost.Mul(costMicrosPerUnit).Round(0).IntPart())
+}
+
+func costFromMicros(micros int) decimal.Decimal {
+	return decimal.NewFromInt(int64(micros)).Div(costMicrosPerUnit)
+}
+
+// MsgCostTotals is the total segments and cost of a set of outgoing messages
+type MsgCostTotals struct {
+	Segments   int
+	CostMicros int
+}
+
+// TotalMsgCosts totals the segments and cost of the given outgoing messages
+func TotalMsgCosts(msgs []*Msg) MsgCostTotals {
+	totals := MsgCostTotals{}
+	for _, m := range msgs {
+		if m.Direction() != DirectionOut {
+			continue
+		}
+		totals.Segments += m.MsgCount()
+		if cost := m.Cost(); cost != nil {
+			totals.CostMicros += costToMicros(*cost)
+		}
+	}
+	return totals
+}
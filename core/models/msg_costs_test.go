@@ -0,0 +1,34 @@
+package models_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMsgSegments(t *testing.T) {
+	tcs := []struct {
+		urn         urns.URN
+		text        string
+		attachments int
+		segments    int
+	}{
+		{"tel:+250700000001", "hello", 0, 1},
+		{"tel:+250700000001", strings.Repeat("a", 160), 0, 1},
+		{"tel:+250700000001", strings.Repeat("a", 161), 0, 2},
+		{"tel:+250700000001", strings.Repeat("é", 70), 0, 1}, // é is in the GSM-7 alphabet
+		{"tel:+250700000001", strings.Repeat("ü", 80), 0, 1},
+		{"tel:+250700000001", strings.Repeat("ب", 70), 0, 1}, // UCS-2
+		{"tel:+250700000001", strings.Repeat("ب", 71), 0, 2},
+		{"tel:+250700000001", "hello", 2, 3},
+		{"facebook:123456789", strings.Repeat("a", 500), 2, 1},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.segments, models.MsgSegments(tc.urn, tc.text, tc.attachments), "segments mismatch for %s", tc.text)
+	}
+}
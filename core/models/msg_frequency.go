@@ -0,0 +1,205 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// MsgFrequencyAction is what happens to a non-urgent message which would exceed an org's frequency cap
+type MsgFrequencyAction string
+
+const (
+	MsgFrequencyActionDefer = MsgFrequencyAction("defer")
+	MsgFrequencyActionDrop  = MsgFrequencyAction("drop")
+)
+
+// MsgFrequencyCap is an org's configuration for the maximum number of non-urgent messages such as broadcasts and
+// campaign messages that a contact can be sent per day in the org's timezone. Excess messages are either deferred
+// until the next day or dropped.
+//
+//	{
+//	  "limit": 3,
+//	  "action": "defer"
+//	}
+type MsgFrequencyCap struct {
+	Limit  int                `json:"limit"  validate:"gt=0"`
+	Action MsgFrequencyAction `json:"action" validate:"eq=defer|eq=drop"`
+}
+
+// ReadMsgFrequencyCap reads and validates message frequency cap config from the given JSON
+func ReadMsgFrequencyCap(data []byte) (*MsgFrequencyCap, error) {
+	c := &MsgFrequencyCap{}
+	if err := utils.UnmarshalAndValidate(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+var msgFrequencyScript = redis.NewScript(2, `
+local key, contact_id, limit = KEYS[1], KEYS[2], tonumber(ARGV[1])
+
+local count = tonumber(redis.call("HGET", key, contact_id) or "0")
+if count >= limit then
+	return 0
+end
+
+redis.call("HINCRBY", key, contact_id, 1)
+redis.call("EXPIRE", key, 172800)
+return 1
+`)
+
+var msgFrequencyKeys = orgkeys.Register("msg_frequency:%d:%s")
+
+// TakeMsgFrequency counts a non-urgent message being sent to the given contact on the given day, returning false
+// without counting it if the contact has already been sent as many such messages that day as the limit allows
+func TakeMsgFrequency(rc redis.Conn, orgID OrgID, contactID ContactID, day dates.Date, limit int) (bool, error) {
+	key := msgFrequencyKeys.Key(int(orgID), day)
+	return redis.Bool(msgFrequencyScript.Do(rc, key, contactID, limit))
+}
+
+// how long until messages which couldn't be counted against or suppressed by a frequency cap are retried
+const msgFrequencyRetryDelay = 5 * time.Minute
+
+// ApplyMsgFrequencyCap applies the org's frequency cap, if it has one, to the given non-urgent messages which are about
+// to be sent. Messages are only counted against the cap as they're sent, which is after the transaction that created
+// them has committed, and includes messages being released after being held or deferred. It returns the messages
+// which can be sent, with the rest deferred until the next day or dropped. If messages can't be counted or suppressed,
+// they're errored so that they're retried later rather than sent over the cap or left queued, and an error returned.
+func ApplyMsgFrequencyCap(ctx context.Context, rt *runtime.Runtime, db Queryer, org *Org, msgs []*Msg) ([]*Msg, error) {
+	fc := org.MsgFrequencyCap()
+	if fc == nil {
+		return msgs, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	now := dates.Now().In(org.Timezone())
+	today := dates.ExtractDate(now)
+
+	send := make([]*Msg, 0, len(msgs))
+	suppressed := make([]*Msg, 0)
+
+	for i, m := range msgs {
+		ok, err := TakeMsgFrequency(rc, org.ID(), m.ContactID(), today, fc.Limit)
+		if err != nil {
+			return send, retryCappedMessages(ctx, db, msgs[i:], errors.Wrap(err, "error taking msg frequency"))
+		}
+		if ok {
+			send = append(send, m)
+		} else {
+			suppressed = append(suppressed, m)
+		}
+	}
+
+	if len(suppressed) == 0 {
+		return send, nil
+	}
+
+	switch fc.Action {
+	case MsgFrequencyActionDefer:
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		if err := MarkMessagesHeld(ctx, db, suppressed, tomorrow); err != nil {
+			return send, retryCappedMessages(ctx, db, suppressed, errors.Wrap(err, "error deferring frequency capped messages"))
+		}
+	case MsgFrequencyActionDrop:
+		if err := failMessages(ctx, db, suppressed, MsgFailedFrequencyCap); err != nil {
+			return send, retryCappedMessages(ctx, db, suppressed, errors.Wrap(err, "error dropping frequency capped messages"))
+		}
+	}
+
+	return send, insertMsgSuppressions(ctx, db, suppressed, fc.Action)
+}
+
+const sqlRetryMessages = `
+UPDATE msgs_msg
+   SET status = 'E', next_attempt = $2, modified_on = NOW()
+ WHERE id = ANY($1)`
+
+// errors the given messages which we failed to apply the frequency cap to, so that the retry cron tries them again
+// later, returning the original error
+func retryCappedMessages(ctx context.Context, db Queryer, msgs []*Msg, cause error) error {
+	nextAttempt := dates.Now().Add(msgFrequencyRetryDelay)
+
+	ids := make([]MsgID, len(msgs))
+	for i, m := range msgs {
+		m.m.Status = MsgStatusErrored
+		m.m.NextAttempt = &nextAttempt
+		ids[i] = MsgID(m.ID())
+	}
+
+	if _, err := db.ExecContext(ctx, sqlRetryMessages, pq.Array(ids), nextAttempt); err != nil {
+		logrus.WithError(err).Error("error marking frequency capped messages for retry")
+	}
+	return cause
+}
+
+const sqlFailMessages = `
+UPDATE msgs_msg
+   SET status = 'F', failed_reason = $2, next_attempt = NULL, modified_on = NOW()
+ WHERE id = ANY($1)`
+
+// marks the given outgoing messages as failed for the given reason
+func failMessages(ctx context.Context, db Queryer, msgs []*Msg, reason MsgFailedReason) error {
+	ids := make([]MsgID, len(msgs))
+	for i, m := range msgs {
+		m.m.Status = MsgStatusFailed
+		m.m.FailedReason = reason
+		m.m.NextAttempt = nil
+		ids[i] = MsgID(m.ID())
+	}
+
+	_, err := db.ExecContext(ctx, sqlFailMessages, pq.Array(ids), reason)
+	return err
+}
+
+// MsgSuppression is an audit record of a message being deferred or dropped by an org's frequency cap
+type MsgSuppression struct {
+	OrgID     OrgID              `db:"org_id"`
+	MsgID     flows.MsgID        `db:"msg_id"`
+	ContactID ContactID          `db:"contact_id"`
+	Action    MsgFrequencyAction `db:"action"`
+	CreatedOn time.Time          `db:"created_on"`
+}
+
+const sqlInsertMsgSuppressions = `
+INSERT INTO msgs_msgsuppression(org_id, msg_id, contact_id, action, created_on)
+                         VALUES(:org_id, :msg_id, :contact_id, :action, :created_on)`
+
+// inserts audit records for the given messages being suppressed
+func insertMsgSuppressions(ctx context.Context, db Queryer, msgs []*Msg, action MsgFrequencyAction) error {
+	suppressions := make([]*MsgSuppression, len(msgs))
+	now := dates.Now()
+
+	for i, m := range msgs {
+		suppressions[i] = &MsgSuppression{
+			OrgID:     m.OrgID(),
+			MsgID:     m.ID(),
+			ContactID: m.ContactID(),
+			Action:    action,
+			CreatedOn: now,
+		}
+	}
+
+	return BulkQuery(ctx, "insert msg suppressions", db, sqlInsertMsgSuppressions, suppressions)
+}
+
+// reads the message frequency cap from the given org config value
+func readMsgFrequencyCapConfig(v interface{}) (*MsgFrequencyCap, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadMsgFrequencyCap(data)
+}
@@ -0,0 +1,85 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadMsgFrequencyCap(t *testing.T) {
+	fc, err := models.ReadMsgFrequencyCap([]byte(`{"limit": 3, "action": "defer"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 3, fc.Limit)
+	assert.Equal(t, models.MsgFrequencyActionDefer, fc.Action)
+
+	_, err = models.ReadMsgFrequencyCap([]byte(`{"limit": 0, "action": "drop"}`))
+	assert.EqualError(t, err, "field 'limit' failed tag 'gt'")
+
+	_, err = models.ReadMsgFrequencyCap([]byte(`{"limit": 3, "action": "ignore"}`))
+	assert.Error(t, err)
+}
+
+func TestTakeMsgFrequency(t *testing.T) {
+	_, _, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	day1 := dates.NewDate(2022, 12, 20)
+	day2 := dates.NewDate(2022, 12, 21)
+
+	assertTake := func(contact *testdata.Contact, day dates.Date, expected bool) {
+		ok, err := models.TakeMsgFrequency(rc, testdata.Org1.ID, contact.ID, day, 2)
+		require.NoError(t, err)
+		assert.Equal(t, expected, ok)
+	}
+
+	assertTake(testdata.Cathy, day1, true)
+	assertTake(testdata.Cathy, day1, true)
+	assertTake(testdata.Bob, day1, true)
+	assertTake(testdata.Cathy, day1, false)
+	assertTake(testdata.Cathy, day1, false)
+	assertTake(testdata.Cathy, day2, true)
+}
+
+func TestApplyMsgFrequencyCapErrors(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"msg_frequency_cap": {"limit": 1, "action": "defer"}}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	out1 := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi", nil, models.MsgStatusQueued, false)
+	out2 := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Hi", nil, models.MsgStatusQueued, false)
+
+	msgs, err := models.GetMessagesByID(ctx, db, testdata.Org1.ID, models.DirectionOut, []models.MsgID{models.MsgID(out1.ID()), models.MsgID(out2.ID())})
+	require.NoError(t, err)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	// put something that isn't a hash where today's counts should be so they can't be taken
+	today := dates.ExtractDate(dates.Now().In(oa.Org().Timezone()))
+	_, err = rc.Do("SET", fmt.Sprintf("msg_frequency:%d:%s", testdata.Org1.ID, today), "x")
+	require.NoError(t, err)
+
+	// messages which can't be counted aren't sent over the cap, nor left queued, but are errored to be retried later
+	send, err := models.ApplyMsgFrequencyCap(ctx, rt, db, oa.Org(), msgs)
+	assert.ErrorContains(t, err, "error taking msg frequency")
+	assert.Len(t, send, 0)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE status = 'E' AND next_attempt > NOW()`).Returns(2)
+}
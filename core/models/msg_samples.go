@@ -0,0 +1,164 @@
+package models
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/random"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+const (
+	// key of the set of orgs which have queued message samples
+	msgSampleOrgsKey = "msg_samples:orgs"
+
+	// max number of samples we keep queued per org, if the endpoint is down we drop the oldest
+	msgSamplesMaxQueued = 10000
+
+	// what we replace redacted content in sampled text with
+	msgSampleRedactMask = "****"
+)
+
+var (
+	sampleEmailRegex  = regexp.MustCompile(`[\w.+\-]+@[\w\-]+(?:\.[\w\-]+)+`)
+	sampleNumberRegex = regexp.MustCompile(`\+?\d(?:[ \-.()]*\d){6,}`)
+)
+
+// MsgSampling is an org's configuration for posting a sample of handled incoming messages to an external analytics
+// endpoint for quality monitoring
+//
+//	{
+//	  "url": "https://analytics.example.com/samples",
+//	  "percent": 5
+//	}
+type MsgSampling struct {
+	URL     string  `json:"url"     validate:"required,url"`
+	Percent float64 `json:"percent" validate:"gt=0,lte=100"`
+}
+
+// ReadMsgSampling reads and validates message sampling config from the given JSON
+func ReadMsgSampling(data []byte) (*MsgSampling, error) {
+	s := &MsgSampling{}
+	if err := utils.UnmarshalAndValidate(data, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ShouldSample returns whether a message should be sampled
+func (s *MsgSampling) ShouldSample() bool {
+	return random.Float64()*100 < s.Percent
+}
+
+// MsgSample is a redacted handled incoming message. It never includes URNs or contact names, and text has anything
+// that looks like an email address or phone number masked, so that samples are safe to share without consent.
+type MsgSample struct {
+	MsgUUID     flows.MsgUUID      `json:"msg_uuid"`
+	ContactUUID flows.ContactUUID  `json:"contact_uuid"`
+	ChannelUUID assets.ChannelUUID `json:"channel_uuid"`
+	Text        string             `json:"text"`
+	Attachments int                `json:"attachments"`
+	CreatedOn   time.Time          `json:"created_on"`
+}
+
+// NewMsgSample creates a new redacted sample of the given incoming message
+func NewMsgSample(contact *flows.Contact, msg *flows.MsgIn, createdOn time.Time) *MsgSample {
+	s := &MsgSample{
+		MsgUUID:     msg.UUID(),
+		ContactUUID: contact.UUID(),
+		Text:        RedactSampleText(msg.Text()),
+		Attachments: len(msg.Attachments()),
+		CreatedOn:   createdOn,
+	}
+	if msg.Channel() != nil {
+		s.ChannelUUID = msg.Channel().UUID
+	}
+	return s
+}
+
+// RedactSampleText masks anything in the given text which looks like an email address or phone number
+func RedactSampleText(text string) string {
+	text = sampleEmailRegex.ReplaceAllString(text, msgSampleRedactMask)
+	return sampleNumberRegex.ReplaceAllString(text, msgSampleRedactMask)
+}
+
+var msgSamplesKeys = orgkeys.Register("msg_samples:%d")
+
+func msgSamplesKey(orgID OrgID) string {
+	return msgSamplesKeys.Key(int(orgID))
+}
+
+// QueueMsgSample queues the given sample to be posted in the next batch for the given org
+func QueueMsgSample(rc redis.Conn, orgID OrgID, sample *MsgSample) error {
+	data := jsonx.MustMarshal(sample)
+
+	rc.Send("MULTI")
+	rc.Send("RPUSH", msgSamplesKey(orgID), data)
+	rc.Send("LTRIM", msgSamplesKey(orgID), -msgSamplesMaxQueued, -1)
+	rc.Send("SADD", msgSampleOrgsKey, orgID)
+	_, err := rc.Do("EXEC")
+
+	return errors.Wrap(err, "error queuing message sample")
+}
+
+// GetMsgSampleOrgs returns the ids of orgs which have queued message samples
+func GetMsgSampleOrgs(rc redis.Conn) ([]OrgID, error) {
+	ids, err := redis.Ints(rc.Do("SMEMBERS", msgSampleOrgsKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading message sample orgs")
+	}
+
+	orgIDs := make([]OrgID, len(ids))
+	for i := range ids {
+		orgIDs[i] = OrgID(ids[i])
+	}
+	return orgIDs, nil
+}
+
+var popMsgSamplesScript = redis.NewScript(2, `
+local key, orgs_key, org_id, max = KEYS[1], KEYS[2], ARGV[1], tonumber(ARGV[2])
+
+local items = redis.call("LRANGE", key, 0, max - 1)
+redis.call("LTRIM", key, max, -1)
+
+-- no more samples for this org, remove it from our set
+if redis.call("LLEN", key) == 0 then
+	redis.call("SREM", orgs_key, org_id)
+end
+
+return items
+`)
+
+// PopMsgSamples pops up to the given number of queued samples for the given org. This is atomic so that a sample
+// queued while we pop can't be left without its org in the set of orgs with samples.
+func PopMsgSamples(rc redis.Conn, orgID OrgID, max int) ([]*MsgSample, error) {
+	items, err := redis.ByteSlices(popMsgSamplesScript.Do(rc, msgSamplesKey(orgID), msgSampleOrgsKey, orgID, max))
+	if err != nil {
+		return nil, errors.Wrap(err, "error popping message samples")
+	}
+
+	samples := make([]*MsgSample, 0, len(items))
+	for _, item := range items {
+		s := &MsgSample{}
+		if err := jsonx.Unmarshal(item, s); err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling message sample")
+		}
+		samples = append(samples, s)
+	}
+	return samples, nil
+}
+
+// reads message sampling config from the given org config value
+func readMsgSamplingConfig(v interface{}) (*MsgSampling, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadMsgSampling(data)
+}
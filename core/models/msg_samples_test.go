@@ -0,0 +1,56 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgSampling(t *testing.T) {
+	sampling, err := models.ReadMsgSampling([]byte(`{"url": "https://analytics.example.com/samples", "percent": 100}`))
+	require.NoError(t, err)
+	assert.Equal(t, "https://analytics.example.com/samples", sampling.URL)
+	assert.True(t, sampling.ShouldSample())
+
+	_, err = models.ReadMsgSampling([]byte(`{"url": "https://analytics.example.com/samples", "percent": 0}`))
+	assert.Error(t, err)
+
+	_, err = models.ReadMsgSampling([]byte(`{"url": "https://analytics.example.com/samples", "percent": 101}`))
+	assert.Error(t, err)
+
+	_, err = models.ReadMsgSampling([]byte(`{"percent": 5}`))
+	assert.Error(t, err)
+
+	tcs := []struct {
+		text     string
+		redacted string
+	}{
+		{"Hi there", "Hi there"},
+		{"I'm 25 and live at no 12345", "I'm 25 and live at no 12345"},
+		{"Call me on +1 (605) 574-1111 tomorrow", "Call me on **** tomorrow"},
+		{"My number is 0788123456", "My number is ****"},
+		{"Email bob.smith+work@example.co.uk please", "Email **** please"},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.redacted, models.RedactSampleText(tc.text), "redaction mismatch for '%s'", tc.text)
+	}
+
+	contact := flows.NewEmptyContact(nil, "Bob", "eng", nil)
+	channel := assets.NewChannelReference("74729f45-7f29-4868-9dc4-90e491e3c7d8", "Twilio")
+	msg := flows.NewMsgIn("1bf6f3d5-6b3b-4b3d-8ab0-9ecb5ad59a2f", urns.URN("tel:+16055741111"), channel, "I'm on 0788123456", nil)
+
+	sample := models.NewMsgSample(contact, msg, time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, flows.MsgUUID("1bf6f3d5-6b3b-4b3d-8ab0-9ecb5ad59a2f"), sample.MsgUUID)
+	assert.Equal(t, contact.UUID(), sample.ContactUUID)
+	assert.Equal(t, assets.ChannelUUID("74729f45-7f29-4868-9dc4-90e491e3c7d8"), sample.ChannelUUID)
+	assert.Equal(t, "I'm on ****", sample.Text)
+	assert.Equal(t, 0, sample.Attachments)
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/pkg/errors"
+)
+
+// MsgStatusUpdate is a status update from a channel's provider for an outgoing message, identified by the external ID
+// the provider gave it when it was sent
+type MsgStatusUpdate struct {
+	ExternalID string    `json:"external_id" validate:"required"`
+	Status     MsgStatus `json:"status"      validate:"required,eq=W|eq=S|eq=D|eq=E|eq=F"`
+}
+
+// UpdatedMsgStatus is an outgoing message whose status was changed by a status update
+type UpdatedMsgStatus struct {
+	ID         flows.MsgID `db:"id"          json:"msg_id"`
+	ContactID  ContactID   `db:"contact_id"  json:"contact_id"`
+	ExternalID string      `db:"external_id" json:"external_id"`
+	Status     MsgStatus   `db:"status"      json:"status"`
+}
+
+// errored messages are retried until they've errored this many times, after which they're failed
+const msgStatusErrorLimit = 3
+
+// errored messages are retried after this long multiplied by the number of times they've errored
+const msgStatusRetryBackoff = time.Minute * 5
+
+// statuses are only applied if they don't take a message backwards, e.g. a late sent receipt for a delivered message.
+// Errored messages are scheduled to be retried by our retry cron, unless they've reached the error limit in which case
+// they're failed.
+const sqlUpdateMsgStatusesByExternalID = `
+WITH updates AS (
+    SELECT * FROM unnest($2::text[], $3::text[]) AS u(external_id, status)
+)
+   UPDATE msgs_msg m
+      SET status = CASE WHEN u.status = 'E' AND m.error_count + 1 >= $4 THEN 'F' ELSE u.status END,
+          modified_on = NOW(),
+          sent_on = CASE WHEN u.status IN ('W', 'S', 'D') THEN COALESCE(m.sent_on, NOW()) ELSE m.sent_on END,
+          error_count = CASE WHEN u.status IN ('E', 'F') THEN m.error_count + 1 ELSE m.error_count END,
+          next_attempt = CASE WHEN u.status = 'E' AND m.error_count + 1 < $4 THEN NOW() + (m.error_count + 1) * $5 * INTERVAL '1 second' ELSE NULL END,
+          failed_reason = CASE WHEN u.status = 'E' AND m.error_count + 1 >= $4 THEN 'E' ELSE m.failed_reason END
+     FROM updates u
+    WHERE m.channel_id = $1 AND m.direction = 'O' AND m.external_id = u.external_id AND m.status NOT IN ('F', 'R') AND
+          NOT (m.status = 'D' AND u.status IN ('W', 'S')) AND NOT (m.status = 'S' AND u.status = 'W')
+RETURNING m.id, m.contact_id, m.external_id, m.status`
+
+// UpdateMessageStatusesByExternalID applies the given status updates to the outgoing messages of the given channel,
+// returning the messages which were updated with their new statuses
+func UpdateMessageStatusesByExternalID(ctx context.Context, db Queryer, channelID ChannelID, updates []*MsgStatusUpdate) ([]*UpdatedMsgStatus, error) {
+	externalIDs := make([]string, len(updates))
+	statuses := make([]MsgStatus, len(updates))
+	for i, u := range updates {
+		externalIDs[i], statuses[i] = u.ExternalID, u.Status
+	}
+
+	updated := make([]*UpdatedMsgStatus, 0, len(updates))
+	if err := db.SelectContext(ctx, &updated, sqlUpdateMsgStatusesByExternalID, channelID, pq.Array(externalIDs), pq.Array(statuses), msgStatusErrorLimit, int(msgStatusRetryBackoff/time.Second)); err != nil {
+		return nil, errors.Wrap(err, "error updating message statuses")
+	}
+	return updated, nil
+}
@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/nyaruka/gocommon/dates"
-	"github.com/nyaruka/gocommon/gsm7"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
@@ -19,8 +18,10 @@ import (
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/definition/legacy/expressions"
 	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/trace"
 	"github.com/nyaruka/null"
 
 	"github.com/gomodule/redigo/redis"
@@ -86,6 +87,9 @@ const (
 	MsgFailedTooOld         = MsgFailedReason("O")
 	MsgFailedNoDestination  = MsgFailedReason("D")
 	MsgFailedChannelRemoved = MsgFailedReason("R")
+	MsgFailedContentPolicy  = MsgFailedReason("P") // blocked by org content policy
+	MsgFailedFrequencyCap   = MsgFailedReason("F") // dropped by org frequency cap
+	MsgFailedWindowClosed   = MsgFailedReason("W") // free-form message outside of WhatsApp window
 )
 
 var unsendableToFailedReason = map[flows.UnsendableReason]MsgFailedReason{
@@ -142,6 +146,7 @@ type Msg struct {
 		URNAuth              null.String        `db:"urn_auth"        json:"urn_auth,omitempty"`
 		OrgID                OrgID              `db:"org_id"          json:"org_id"`
 		FlowID               FlowID             `db:"flow_id"         json:"-"`
+		TraceID              trace.ID           `db:"trace_id"        json:"-"`
 
 		// extra data from handling added to the courier payload
 		SessionID     SessionID             `json:"session_id,omitempty"`
@@ -155,7 +160,17 @@ type Msg struct {
 		SessionTimeout       int        `json:"session_timeout,omitempty"`
 	}
 
-	channel *Channel
+	channel       *Channel
+	policyMatches []*ContentPolicyMatch
+
+	// whether this message can be held during the org's quiet hours and is subject to its frequency cap
+	nonUrgent bool
+
+	// how this message was suppressed by the org's frequency cap if it was
+	suppression MsgFrequencyAction
+
+	// short links created for URLs in this message's text
+	links []*TrackedLink
 }
 
 func (m *Msg) ID() flows.MsgID                  { return m.m.ID }
@@ -188,6 +203,11 @@ func (m *Msg) ContactID() ContactID             { return m.m.ContactID }
 func (m *Msg) ContactURNID() *URNID             { return m.m.ContactURNID }
 func (m *Msg) IsResend() bool                   { return m.m.IsResend }
 
+// PolicyMatches returns the content policy rules which matched this message when it was created
+func (m *Msg) PolicyMatches() []*ContentPolicyMatch { return m.policyMatches }
+func (m *Msg) NonUrgent() bool                      { return m.nonUrgent }
+func (m *Msg) Links() []*TrackedLink                { return m.links }
+
 func (m *Msg) SetChannel(channel *Channel) {
 	m.channel = channel
 	if channel != nil {
@@ -354,7 +374,6 @@ func newOutgoingMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *fl
 	m.Status = MsgStatusQueued
 	m.Visibility = VisibilityVisible
 	m.MsgType = MsgTypeFlow
-	m.MsgCount = 1
 	m.CreatedOn = createdOn
 	m.Metadata = null.NewMap(buildMsgMetadata(out))
 
@@ -382,6 +401,21 @@ func newOutgoingMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *fl
 		}
 	}
 
+	// apply our org's content policy if it has one, which may redact or block the message
+	if policy := org.ContentPolicy(); policy != nil && m.Status != MsgStatusFailed {
+		var blocked bool
+		m.Text, msg.policyMatches, blocked = policy.Apply(m.Text)
+		if blocked {
+			m.Status = MsgStatusFailed
+			m.FailedReason = MsgFailedContentPolicy
+		}
+	}
+
+	// free-form WhatsApp messages can only be sent within 24 hours of the contact's last incoming message
+	if err := msg.applyWhatsAppWindow(rt, org, channel, out); err != nil {
+		return nil, errors.Wrap(err, "error applying whatsapp window")
+	}
+
 	// if we have a session, set fields on the message from that
 	if session != nil {
 		m.ResponseToExternalID = session.IncomingMsgExternalID()
@@ -397,8 +431,14 @@ func newOutgoingMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *fl
 		if session.IncomingMsgID() != NilMsgID {
 			m.HighPriority = true
 		}
+
+		// messages from sessions started by campaign events can wait until quiet hours end
+		msg.setNonUrgent(session.TriggerType() == triggers.TypeCampaign)
 	}
 
+	// rewrite any URLs as tracked short links if org has that enabled
+	msg.applyLinkTracking(org)
+
 	// if we have attachments, add them
 	if len(out.Attachments()) > 0 {
 		for _, a := range out.Attachments() {
@@ -406,14 +446,47 @@ func newOutgoingMsg(rt *runtime.Runtime, org *Org, channel *Channel, contact *fl
 		}
 	}
 
-	// if we're sending to a phone, message may have to be sent in multiple parts
-	if m.URN.Scheme() == urns.TelScheme {
-		m.MsgCount = gsm7.Segments(m.Text) + len(m.Attachments)
+	// if channel supports RCS, add rich cards and suggestions which it can use instead of plain text
+	msg.applyRichContent(channel, out.QuickReplies())
+
+	// convert quick replies into whatever structure our channel uses for them
+	msg.renderQuickReplies(channel, out.QuickReplies())
+
+	// transliterate, strip emoji or truncate text if our channel wants that, which is done last so that it includes any
+	// quick replies rendered as text
+	msg.applyTextProcessing(channel)
+
+	// if we're sending by email, add a subject, HTML body and headers to thread replies
+	if err := msg.applyEmailHeaders(rt, channel); err != nil {
+		return nil, errors.Wrap(err, "error applying email headers")
 	}
 
+	// if we're sending to a phone, message may have to be sent in multiple parts
+	m.MsgCount = MsgSegments(m.URN, m.Text, len(m.Attachments))
+
 	return msg, nil
 }
 
+// marks this message as non-urgent, which is also recorded in its metadata so that it's still treated as non-urgent
+// if it's loaded again to be retried
+func (m *Msg) setNonUrgent(nonUrgent bool) {
+	m.nonUrgent = nonUrgent
+	if nonUrgent {
+		m.setMetadataValue("non_urgent", true)
+	}
+}
+
+// sets or, if value is nil, removes a key in this message's metadata
+func (m *Msg) setMetadataValue(key string, value interface{}) {
+	metadata := m.m.Metadata.Map()
+	if value != nil {
+		metadata[key] = value
+	} else {
+		delete(metadata, key)
+	}
+	m.m.Metadata = null.NewMap(metadata)
+}
+
 func buildMsgMetadata(m *flows.MsgOut) map[string]interface{} {
 	metadata := make(map[string]interface{})
 	if len(m.QuickReplies()) > 0 {
@@ -552,6 +625,8 @@ func loadMessages(ctx context.Context, db Queryer, sql string, params ...interfa
 			return nil, errors.Wrap(err, "error scanning msg row")
 		}
 
+		msg.nonUrgent = msg.m.Metadata.Map()["non_urgent"] == true
+
 		msgs = append(msgs, msg)
 
 		if msg.ChannelID() != NilChannelID && !channelIDsSeen[msg.ChannelID()] {
@@ -604,22 +679,35 @@ func (m *Msg) SetTimeout(start time.Time, timeout time.Duration) {
 
 // InsertMessages inserts the passed in messages in a single query
 func InsertMessages(ctx context.Context, tx Queryer, msgs []*Msg) error {
+	traceID := trace.FromContext(ctx)
+
 	is := make([]interface{}, len(msgs))
 	for i := range msgs {
+		if msgs[i].m.TraceID == trace.NilID {
+			msgs[i].m.TraceID = traceID
+		}
 		is[i] = &msgs[i].m
 	}
 
-	return BulkQuery(ctx, "insert messages", tx, insertMsgSQL, is)
+	if err := BulkQuery(ctx, "insert messages", tx, insertMsgSQL, is); err != nil {
+		return err
+	}
+
+	if err := insertContentPolicyLogs(ctx, tx, msgs); err != nil {
+		return err
+	}
+
+	return insertTrackedLinks(ctx, tx, msgs)
 }
 
 const insertMsgSQL = `
 INSERT INTO
 msgs_msg(uuid, text, high_priority, created_on, modified_on, queued_on, sent_on, direction, status, attachments, metadata,
 		 visibility, msg_type, msg_count, error_count, next_attempt, failed_reason, channel_id,
-		 contact_id, contact_urn_id, org_id, flow_id, broadcast_id)
+		 contact_id, contact_urn_id, org_id, flow_id, broadcast_id, trace_id)
   VALUES(:uuid, :text, :high_priority, :created_on, now(), now(), :sent_on, :direction, :status, :attachments, :metadata,
 		 :visibility, :msg_type, :msg_count, :error_count, :next_attempt, :failed_reason, :channel_id,
-		 :contact_id, :contact_urn_id, :org_id, :flow_id, :broadcast_id)
+		 :contact_id, :contact_urn_id, :org_id, :flow_id, :broadcast_id, :trace_id)
 RETURNING 
 	id as id, 
 	now() as modified_on,
@@ -649,6 +737,34 @@ func UpdateMessage(ctx context.Context, tx Queryer, msgID flows.MsgID, status Ms
 	return nil
 }
 
+const sqlCopyMsgHandling = `
+UPDATE msgs_msg m
+   SET status = h.status, visibility = h.visibility, msg_type = h.msg_type, flow_id = h.flow_id
+  FROM msgs_msg h
+ WHERE h.id = $1 AND m.id = ANY($2)`
+
+// CopyMsgHandling updates the given incoming messages to have been handled the same way as the given handled message,
+// which is used when several messages are handled together. Their status, visibility, type and flow are copied but not
+// their text or attachments, so each message keeps what the contact actually sent.
+func CopyMsgHandling(ctx context.Context, db Queryer, handledID flows.MsgID, msgIDs []flows.MsgID) error {
+	_, err := db.ExecContext(ctx, sqlCopyMsgHandling, handledID, pq.Array(msgIDs))
+	if err != nil {
+		return errors.Wrapf(err, "error copying handling of msg: %d", handledID)
+	}
+
+	return nil
+}
+
+// AddMsgAttachment appends the given attachment to a message's existing attachments
+func AddMsgAttachment(ctx context.Context, db Queryer, msgID flows.MsgID, attachment utils.Attachment) error {
+	_, err := db.ExecContext(ctx, `UPDATE msgs_msg SET attachments = array_append(attachments, $2) WHERE id = $1`, msgID, string(attachment))
+	if err != nil {
+		return errors.Wrapf(err, "error adding attachment to msg: %d", msgID)
+	}
+
+	return nil
+}
+
 // MarkMessagesPending marks the passed in messages as pending(P)
 func MarkMessagesPending(ctx context.Context, db Queryer, msgs []*Msg) error {
 	return updateMessageStatus(ctx, db, msgs, MsgStatusPending)
@@ -693,18 +809,20 @@ type BroadcastTranslation struct {
 // Broadcast represents a broadcast that needs to be sent
 type Broadcast struct {
 	b struct {
-		BroadcastID   BroadcastID                             `json:"broadcast_id,omitempty"  db:"id"`
-		Translations  map[envs.Language]*BroadcastTranslation `json:"translations"`
-		Text          hstore.Hstore                           `                               db:"text"`
-		TemplateState TemplateState                           `json:"template_state"`
-		BaseLanguage  envs.Language                           `json:"base_language"           db:"base_language"`
-		URNs          []urns.URN                              `json:"urns,omitempty"`
-		ContactIDs    []ContactID                             `json:"contact_ids,omitempty"`
-		GroupIDs      []GroupID                               `json:"group_ids,omitempty"`
-		OrgID         OrgID                                   `json:"org_id"                  db:"org_id"`
-		CreatedByID   UserID                                  `json:"created_by_id,omitempty" db:"created_by_id"`
-		ParentID      BroadcastID                             `json:"parent_id,omitempty"     db:"parent_id"`
-		TicketID      TicketID                                `json:"ticket_id,omitempty"     db:"ticket_id"`
+		BroadcastID    BroadcastID                             `json:"broadcast_id,omitempty"  db:"id"`
+		Translations   map[envs.Language]*BroadcastTranslation `json:"translations"`
+		Text           hstore.Hstore                           `                               db:"text"`
+		TemplateState  TemplateState                           `json:"template_state"`
+		BaseLanguage   envs.Language                           `json:"base_language"           db:"base_language"`
+		URNs           []urns.URN                              `json:"urns,omitempty"`
+		ContactIDs     []ContactID                             `json:"contact_ids,omitempty"`
+		GroupIDs       []GroupID                               `json:"group_ids,omitempty"`
+		OrgID          OrgID                                   `json:"org_id"                  db:"org_id"`
+		CreatedByID    UserID                                  `json:"created_by_id,omitempty" db:"created_by_id"`
+		ParentID       BroadcastID                             `json:"parent_id,omitempty"     db:"parent_id"`
+		TicketID       TicketID                                `json:"ticket_id,omitempty"     db:"ticket_id"`
+		PreviewGroupID GroupID                                 `json:"preview_group_id,omitempty"`
+		Transactional  bool                                    `json:"transactional,omitempty"`
 	}
 }
 
@@ -718,6 +836,8 @@ func (b *Broadcast) BaseLanguage() envs.Language                           { ret
 func (b *Broadcast) Translations() map[envs.Language]*BroadcastTranslation { return b.b.Translations }
 func (b *Broadcast) TemplateState() TemplateState                          { return b.b.TemplateState }
 func (b *Broadcast) TicketID() TicketID                                    { return b.b.TicketID }
+func (b *Broadcast) PreviewGroupID() GroupID                               { return b.b.PreviewGroupID }
+func (b *Broadcast) Transactional() bool                                   { return b.b.Transactional }
 
 func (b *Broadcast) MarshalJSON() ([]byte, error)    { return json.Marshal(b.b) }
 func (b *Broadcast) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, &b.b) }
@@ -757,6 +877,7 @@ func InsertChildBroadcast(ctx context.Context, db Queryer, parent *Broadcast) (*
 		parent.b.CreatedByID,
 	)
 	child.b.ParentID = parent.ID()
+	child.b.Transactional = parent.b.Transactional
 
 	// populate text from our translations
 	child.b.Text.Map = make(map[string]sql.NullString)
@@ -905,6 +1026,7 @@ func (b *Broadcast) CreateBatch(contactIDs []ContactID) *BroadcastBatch {
 		OrgID:         b.b.OrgID,
 		CreatedByID:   b.b.CreatedByID,
 		TicketID:      b.b.TicketID,
+		Transactional: b.b.Transactional,
 		ContactIDs:    contactIDs,
 	}
 }
@@ -921,6 +1043,8 @@ type BroadcastBatch struct {
 	OrgID         OrgID                                   `json:"org_id"`
 	CreatedByID   UserID                                  `json:"created_by_id"`
 	TicketID      TicketID                                `json:"ticket_id"`
+	Language      envs.Language                           `json:"language,omitempty"`
+	Transactional bool                                    `json:"transactional,omitempty"`
 }
 
 func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets) ([]*Msg, error) {
@@ -1003,11 +1127,14 @@ func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime
 		}
 
 		// resolve our translations, the order is:
-		//   1) valid contact language
-		//   2) org default language
-		//   3) broadcast base language
+		//   1) batch language if this is a preview for a specific language
+		//   2) valid contact language
+		//   3) org language fallback chain, or org default language if it doesn't have one
+		//   4) broadcast base language
 		lang := contact.Language()
-		if lang != envs.NilLanguage {
+		if b.Language != envs.NilLanguage {
+			lang = b.Language
+		} else if lang != envs.NilLanguage {
 			found := false
 			for _, l := range oa.Env().AllowedLanguages() {
 				if l == lang {
@@ -1020,13 +1147,13 @@ func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime
 			}
 		}
 
-		// have a valid contact language, try that
 		trans := b.Translations
-		t := trans[lang]
+		var t *BroadcastTranslation
 
-		// not found? try org default language
-		if t == nil {
-			t = trans[oa.Env().DefaultLanguage()]
+		for _, l := range oa.Org().LocalizationLanguages(lang) {
+			if t = trans[l]; t != nil {
+				break
+			}
 		}
 
 		// not found? use broadcast base language
@@ -1049,9 +1176,10 @@ func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime
 		}
 
 		text := t.Text
+		attachments := t.Attachments
 
-		// if we have a template, evaluate it
-		if template != "" {
+		// if we have templates, evaluate them
+		if template != "" || (b.TemplateState == TemplateStateUnevaluated && len(t.Attachments) > 0) {
 			// build up the minimum viable context for templates
 			templateCtx := types.NewXObject(map[string]types.XValue{
 				"contact": flows.Context(oa.Env(), contact),
@@ -1059,11 +1187,22 @@ func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime
 				"globals": flows.Context(oa.Env(), oa.SessionAssets().Globals()),
 				"urns":    flows.ContextFunc(oa.Env(), contact.URNs().MapContext),
 			})
-			text, _ = excellent.EvaluateTemplate(oa.Env(), templateCtx, template, nil)
+			if template != "" {
+				text, _ = excellent.EvaluateTemplate(oa.Env(), templateCtx, template, nil)
+			}
+
+			// attachments can be expressions like image/jpeg:@fields.certificate_url
+			if b.TemplateState == TemplateStateUnevaluated {
+				var errs []error
+				attachments, errs = evaluateBroadcastAttachments(oa.Env(), templateCtx, t.Attachments)
+				for _, err := range errs {
+					logrus.WithError(err).WithField("broadcast_id", b.BroadcastID).WithField("contact_id", c.ID()).Warn("error evaluating broadcast attachment for contact")
+				}
+			}
 		}
 
 		// don't do anything if we have no text or attachments
-		if text == "" && len(t.Attachments) == 0 {
+		if text == "" && len(attachments) == 0 {
 			return nil, nil
 		}
 
@@ -1075,12 +1214,15 @@ func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime
 		}
 
 		// create our outgoing message
-		out := flows.NewMsgOut(urn, channel.ChannelReference(), text, t.Attachments, t.QuickReplies, nil, flows.NilMsgTopic, unsendableReason)
+		out := flows.NewMsgOut(urn, channel.ChannelReference(), text, attachments, t.QuickReplies, nil, flows.NilMsgTopic, unsendableReason)
 		msg, err := NewOutgoingBroadcastMsg(rt, oa.Org(), channel, contact, out, time.Now(), b.BroadcastID)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error creating outgoing message")
 		}
 
+		// ticket replies and transactional sends can't wait until quiet hours end and aren't frequency capped
+		msg.setNonUrgent(b.TicketID == NilTicketID && !b.Transactional)
+
 		return msg, nil
 	}
 
@@ -1110,19 +1252,40 @@ func (b *BroadcastBatch) CreateMessages(ctx context.Context, rt *runtime.Runtime
 		}
 	}
 
-	// insert them in a single request
-	err = InsertMessages(ctx, rt.DB, msgs)
+	// insert them in a single request, in a transaction with everything that counts them
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error starting transaction")
+	}
+
+	err = InsertMessages(ctx, tx, msgs)
 	if err != nil {
+		tx.Rollback()
 		return nil, errors.Wrapf(err, "error inserting broadcast messages")
 	}
 
+	if err := InsertAnalyticsCounts(ctx, tx, oa, MsgAnalyticsIncrements(msgs)); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrapf(err, "error inserting broadcast message analytics counts")
+	}
+
+	if err := RecordConversations(ctx, tx, oa, ConversationMsgsFor(msgs)); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrapf(err, "error recording broadcast message conversations")
+	}
+
 	// if the broadcast was a ticket reply, update the ticket
 	if b.TicketID != NilTicketID {
-		if err := b.updateTicket(ctx, rt.DB, oa); err != nil {
+		if err := b.updateTicket(ctx, tx, oa); err != nil {
+			tx.Rollback()
 			return nil, err
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrapf(err, "error committing broadcast messages")
+	}
+
 	return msgs, nil
 }
 
@@ -1272,6 +1435,20 @@ func FailChannelMessages(ctx context.Context, db Queryer, orgID OrgID, channelID
 	return nil
 }
 
+// MarkBroadcastFailed marks the passed in broadcast as failed
+func MarkBroadcastFailed(ctx context.Context, db Queryer, id BroadcastID) error {
+	// noop if it is a nil id
+	if id == NilBroadcastID {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, `UPDATE msgs_broadcast SET status = 'F', modified_on = now() WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrapf(err, "error setting broadcast with id %d as failed", id)
+	}
+	return nil
+}
+
 // MarkBroadcastSent marks the passed in broadcast as sent
 func MarkBroadcastSent(ctx context.Context, db Queryer, id BroadcastID) error {
 	// noop if it is a nil id
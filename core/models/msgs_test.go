@@ -49,6 +49,7 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 		ResponseTo   models.MsgID
 		SuspendedOrg bool
 
+		ExpectedText         string // if different to text
 		ExpectedStatus       models.MsgStatus
 		ExpectedFailedReason models.MsgFailedReason
 		ExpectedMetadata     map[string]interface{}
@@ -78,11 +79,11 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 			QuickReplies:         []string{"yes", "no"},
 			Topic:                flows.MsgTopicPurchase,
 			Flow:                 testdata.SingleMessage,
+			ExpectedText:         "test outgoing\n\n1. yes\n2. no",
 			ExpectedStatus:       models.MsgStatusQueued,
 			ExpectedFailedReason: models.NilMsgFailedReason,
 			ExpectedMetadata: map[string]interface{}{
-				"quick_replies": []string{"yes", "no"},
-				"topic":         "purchase",
+				"topic": "purchase",
 			},
 			ExpectedMsgCount: 1,
 			ExpectedPriority: false,
@@ -184,7 +185,11 @@ func TestNewOutgoingFlowMsg(t *testing.T) {
 		err = models.InsertMessages(ctx, db, []*models.Msg{msg})
 		assert.NoError(t, err)
 		assert.Equal(t, oa.OrgID(), msg.OrgID())
-		assert.Equal(t, tc.Text, msg.Text())
+		expectedText := tc.Text
+		if tc.ExpectedText != "" {
+			expectedText = tc.ExpectedText
+		}
+		assert.Equal(t, expectedText, msg.Text())
 		assert.Equal(t, tc.Contact.ID, msg.ContactID())
 		assert.Equal(t, channel, msg.Channel())
 		assert.Equal(t, tc.ChannelUUID, msg.ChannelUUID())
@@ -297,10 +302,6 @@ func TestMarshalMsg(t *testing.T) {
 		"high_priority": false,
 		"id": %d,
 		"metadata": {
-			"quick_replies": [
-				"yes",
-				"no"
-			],
 			"topic": "purchase"
 		},
 		"modified_on": %s,
@@ -311,7 +312,7 @@ func TestMarshalMsg(t *testing.T) {
 		"session_id": %d,
 		"session_status": "W",
 		"status": "Q",
-		"text": "Hi there",
+		"text": "Hi there\n\n1. yes\n2. no",
 		"tps_cost": 2,
 		"urn": "tel:+250700000001?id=10000",
 		"uuid": "%s"
@@ -431,6 +432,27 @@ func TestGetMessagesByID(t *testing.T) {
 	assert.Equal(t, "in 1", msgs[0].Text())
 }
 
+func TestGetMessagesForRetry(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	out1 := testdata.InsertErroredOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "out 1", 1, time.Now().Add(-time.Minute), false)
+	out2 := testdata.InsertErroredOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "out 2", 1, time.Now().Add(-time.Minute), false)
+	testdata.InsertErroredOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "out 3", 1, time.Now().Add(time.Hour), false)
+
+	// second message was sent by a campaign so is non-urgent
+	db.MustExec(`UPDATE msgs_msg SET metadata = '{"non_urgent": true}' WHERE id = $1`, out2.ID())
+
+	msgs, err := models.GetMessagesForRetry(ctx, db)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(msgs))
+	assert.Equal(t, out1.ID(), msgs[0].ID())
+	assert.False(t, msgs[0].NonUrgent())
+	assert.Equal(t, out2.ID(), msgs[1].ID())
+	assert.True(t, msgs[1].NonUrgent())
+}
+
 func TestResendMessages(t *testing.T) {
 	ctx, rt, db, rp := testsuite.Get()
 
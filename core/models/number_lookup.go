@@ -0,0 +1,124 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/modifiers"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	configNumberLookupProvider = "number_lookup_provider"
+
+	// NumberLookupLineTypeField is the key of the contact field which number lookups set to the line type
+	NumberLookupLineTypeField = "line_type"
+
+	// NumberLookupCarrierField is the key of the contact field which number lookups set to the carrier name
+	NumberLookupCarrierField = "carrier"
+)
+
+// line types returned by number lookups
+const (
+	LineTypeMobile   = "mobile"
+	LineTypeLandline = "landline"
+	LineTypeVoIP     = "voip"
+	LineTypeOther    = "other"
+)
+
+// NumberInfo is the result of looking up a phone number. Unreachable is only set if the provider knows that the number
+// can't currently be reached, e.g. it's invalid or disconnected.
+type NumberInfo struct {
+	LineType    string
+	Carrier     string
+	Unreachable bool
+}
+
+// NumberLookupService is a provider of phone number intelligence
+type NumberLookupService interface {
+	// Lookup looks up the given E164 phone number
+	Lookup(number string) (*NumberInfo, *httpx.Trace, error)
+
+	// RedactValues returns the values which should be redacted from logs of lookup requests
+	RedactValues() []string
+}
+
+// NumberLookupServiceFunc is a func which creates a number lookup service for an org
+type NumberLookupServiceFunc func(*Org, *http.Client, *httpx.RetryConfig) (NumberLookupService, error)
+
+var numberLookupServices = map[string]NumberLookupServiceFunc{}
+
+// RegisterNumberLookupService registers a new number lookup provider
+func RegisterNumberLookupService(name string, initFunc NumberLookupServiceFunc) {
+	numberLookupServices[name] = initFunc
+}
+
+// NumberLookupService returns the number lookup service for this org, or nil if it doesn't have one configured
+func (o *Org) NumberLookupService(httpClient *http.Client, httpRetries *httpx.RetryConfig) (NumberLookupService, error) {
+	provider := o.ConfigValue(configNumberLookupProvider, "")
+	if provider == "" {
+		return nil, nil
+	}
+
+	initFunc := numberLookupServices[provider]
+	if initFunc == nil {
+		return nil, errors.Errorf("unrecognized number lookup provider '%s' for org: %d", provider, o.ID())
+	}
+	return initFunc(o, httpClient, httpRetries)
+}
+
+// lookups happen while handling a contact's first message or call so they can't take long
+var numberLookupHTTPClient = &http.Client{Timeout: time.Second * 10}
+
+// LookupNewContactNumber looks up the phone number of a newly created contact if the org has a number lookup provider,
+// and saves the line type and carrier to the contact's line_type and carrier fields if the org has those fields.
+// Lookup failures are logged rather than returned so that they never prevent the contact being handled.
+func LookupNewContactNumber(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, contact *flows.Contact) error {
+	fields := oa.SessionAssets().Fields()
+	lineTypeField, carrierField := fields.Get(NumberLookupLineTypeField), fields.Get(NumberLookupCarrierField)
+	if lineTypeField == nil && carrierField == nil {
+		return nil
+	}
+
+	log := logrus.WithField("org_id", oa.OrgID()).WithField("contact_uuid", contact.UUID())
+
+	svc, err := oa.Org().NumberLookupService(numberLookupHTTPClient, nil)
+	if err != nil {
+		log.WithError(err).Warn("error creating number lookup service")
+		return nil
+	}
+	if svc == nil {
+		return nil
+	}
+
+	telURNs := contact.URNs().WithScheme(urns.TelScheme)
+	if len(telURNs) == 0 {
+		return nil
+	}
+
+	info, _, err := svc.Lookup(telURNs[0].URN().Path())
+	if err != nil {
+		log.WithError(err).Warn("error looking up contact phone number")
+		return nil
+	}
+
+	mods := make([]flows.Modifier, 0, 2)
+	if lineTypeField != nil && info.LineType != "" {
+		mods = append(mods, modifiers.NewField(lineTypeField, info.LineType))
+	}
+	if carrierField != nil && info.Carrier != "" {
+		mods = append(mods, modifiers.NewField(carrierField, info.Carrier))
+	}
+	if len(mods) == 0 {
+		return nil
+	}
+
+	_, err = ApplyModifiers(ctx, rt, oa, NilUserID, map[*flows.Contact][]flows.Modifier{contact: mods})
+	return errors.Wrap(err, "error saving number lookup fields")
+}
@@ -0,0 +1,77 @@
+package models_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLookupService struct {
+	lookups []string
+}
+
+func (s *testLookupService) Lookup(number string) (*models.NumberInfo, *httpx.Trace, error) {
+	s.lookups = append(s.lookups, number)
+	if number == "+16055742222" {
+		return nil, nil, errors.New("boom")
+	}
+	return &models.NumberInfo{LineType: models.LineTypeMobile, Carrier: "Verizon"}, nil, nil
+}
+
+func (s *testLookupService) RedactValues() []string { return nil }
+
+func TestLookupNewContactNumber(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetDB)
+
+	svc := &testLookupService{}
+	models.RegisterNumberLookupService("test", func(*models.Org, *http.Client, *httpx.RetryConfig) (models.NumberLookupService, error) {
+		return svc, nil
+	})
+
+	lookup := func(contact *testdata.Contact) {
+		oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg|models.RefreshFields)
+		require.NoError(t, err)
+
+		mc, err := models.LoadContact(ctx, db, oa, contact.ID)
+		require.NoError(t, err)
+		fc, err := mc.FlowContact(oa)
+		require.NoError(t, err)
+
+		err = models.LookupNewContactNumber(ctx, rt, oa, fc)
+		require.NoError(t, err)
+	}
+
+	// org has no lookup provider
+	lookup(testdata.Cathy)
+	assert.Len(t, svc.lookups, 0)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"number_lookup_provider": "test"}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+
+	// org has a provider but neither of the fields
+	lookup(testdata.Cathy)
+	assert.Len(t, svc.lookups, 0)
+
+	db.MustExec(`UPDATE contacts_contactfield SET key = 'line_type', name = 'Line Type' WHERE id = $1`, testdata.GenderField.ID)
+
+	lookup(testdata.Cathy)
+	assert.Equal(t, []string{"+16055741111"}, svc.lookups)
+
+	assertdb.Query(t, db, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdata.Cathy.ID, string(testdata.GenderField.UUID)).Returns("mobile")
+
+	// failed lookups are ignored
+	lookup(testdata.Bob)
+	assert.Equal(t, []string{"+16055741111", "+16055742222"}, svc.lookups)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND fields->$2->>'text' = 'mobile'`, testdata.Bob.ID, string(testdata.GenderField.UUID)).Returns(0)
+}
@@ -0,0 +1,513 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
+)
+
+const orgCloneExpiry = time.Hour * 24 * 7
+
+// OrgCloneStatus is the status of the cloning of a template org into another org
+type OrgCloneStatus string
+
+const (
+	OrgCloneStatusInProgress = OrgCloneStatus("in_progress")
+	OrgCloneStatusComplete   = OrgCloneStatus("complete")
+	OrgCloneStatusFailed     = OrgCloneStatus("failed")
+)
+
+// OrgClone is the state of the cloning of a template org's fields, groups, flows, campaigns and triggers into another
+// org. UUIDs maps the UUID of each cloned object in the template org to the UUID of its copy, which for fields and
+// groups which already existed in the org is the UUID of the existing object.
+type OrgClone struct {
+	Status          OrgCloneStatus    `json:"status"`
+	SourceOrgID     OrgID             `json:"source_org_id"`
+	Fields          int               `json:"fields"`
+	Groups          int               `json:"groups"`
+	Flows           int               `json:"flows"`
+	Campaigns       int               `json:"campaigns"`
+	CampaignEvents  int               `json:"campaign_events"`
+	Triggers        int               `json:"triggers"`
+	SkippedTriggers int               `json:"skipped_triggers"`
+	UUIDs           map[string]string `json:"uuids"`
+	Error           string            `json:"error,omitempty"`
+	StartedOn       time.Time         `json:"started_on"`
+	CompletedOn     *time.Time        `json:"completed_on,omitempty"`
+
+	// things created by the clone which need further processing once it's committed
+	NewSmartGroups    map[GroupID]string `json:"-"`
+	NewCampaignEvents []CampaignEventID  `json:"-"`
+}
+
+// NewOrgClone creates a new in progress clone of the given template org
+func NewOrgClone(sourceOrgID OrgID) *OrgClone {
+	return &OrgClone{
+		Status:         OrgCloneStatusInProgress,
+		SourceOrgID:    sourceOrgID,
+		UUIDs:          make(map[string]string),
+		StartedOn:      dates.Now(),
+		NewSmartGroups: make(map[GroupID]string),
+	}
+}
+
+// Complete marks this clone as complete
+func (c *OrgClone) Complete() {
+	now := dates.Now()
+	c.Status = OrgCloneStatusComplete
+	c.CompletedOn = &now
+}
+
+// Fail marks this clone as failed with the given error
+func (c *OrgClone) Fail(err string) {
+	now := dates.Now()
+	c.Status = OrgCloneStatusFailed
+	c.Error = err
+	c.CompletedOn = &now
+}
+
+var orgCloneKeys = orgkeys.Register("org_clone:%d")
+
+func orgCloneKey(orgID OrgID) string {
+	return orgCloneKeys.Key(int(orgID))
+}
+
+// SetOrgClone records the given clone as the latest clone into the given org
+func SetOrgClone(rc redis.Conn, orgID OrgID, clone *OrgClone) error {
+	_, err := rc.Do("SET", orgCloneKey(orgID), jsonx.MustMarshal(clone), "EX", int(orgCloneExpiry/time.Second))
+	return errors.Wrap(err, "error setting org clone")
+}
+
+// GetOrgClone gets the latest clone into the given org, or nil if there isn't one
+func GetOrgClone(rc redis.Conn, orgID OrgID) (*OrgClone, error) {
+	data, err := redis.Bytes(rc.Do("GET", orgCloneKey(orgID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting org clone")
+	}
+
+	clone := &OrgClone{}
+	if err := jsonx.Unmarshal(data, clone); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling org clone")
+	}
+	return clone, nil
+}
+
+// CloneOrg clones the fields, groups, flows, campaigns and triggers of the given template org into the target org,
+// recording what was done on the given clone. Everything gets a new UUID and references between them, including those
+// in flow definitions, are rewritten to the new UUIDs. Fields and groups which already exist in the target org, by key
+// and name respectively, are reused. Triggers which depend on channels or schedules of the template org are skipped.
+// New smart groups are created as initializing and new campaign events are unscheduled, and it's up to the caller to
+// populate and schedule them.
+func CloneOrg(ctx context.Context, tx Queryer, sourceOrgID, targetOrgID OrgID, userID UserID, clone *OrgClone) error {
+	c := &orgCloner{
+		tx:       tx,
+		sourceID: sourceOrgID,
+		targetID: targetOrgID,
+		userID:   userID,
+		clone:    clone,
+		fields:   make(map[FieldID]FieldID),
+		groups:   make(map[GroupID]GroupID),
+		flows:    make(map[FlowID]FlowID),
+	}
+
+	if err := c.cloneFields(ctx); err != nil {
+		return err
+	}
+	if err := c.cloneGroups(ctx); err != nil {
+		return err
+	}
+	if err := c.cloneFlows(ctx); err != nil {
+		return err
+	}
+	if err := c.cloneCampaigns(ctx); err != nil {
+		return err
+	}
+	return c.cloneTriggers(ctx)
+}
+
+type orgCloner struct {
+	tx       Queryer
+	sourceID OrgID
+	targetID OrgID
+	userID   UserID
+	clone    *OrgClone
+
+	// mappings of IDs in the template org to IDs in the target org
+	fields map[FieldID]FieldID
+	groups map[GroupID]GroupID
+	flows  map[FlowID]FlowID
+}
+
+type clonedObject struct {
+	ID   int    `db:"id"`
+	UUID string `db:"uuid"`
+	Key  string `db:"key"`
+}
+
+const sqlSelectCloneFields = `
+  SELECT id, uuid, key, is_system
+    FROM contacts_contactfield
+   WHERE org_id = $1 AND is_active = TRUE
+ORDER BY id`
+
+const sqlInsertClonedField = `
+INSERT INTO contacts_contactfield(uuid, org_id, key, name, value_type, show_in_table, priority, is_system, is_active, created_on, modified_on, created_by_id, modified_by_id)
+     SELECT $2, $3, key, name, value_type, show_in_table, priority, FALSE, TRUE, NOW(), NOW(), $4, $4
+       FROM contacts_contactfield
+      WHERE id = $1
+  RETURNING id`
+
+// clones user fields, mapping system fields and fields with the same key to the existing fields in the target org
+func (c *orgCloner) cloneFields(ctx context.Context) error {
+	type field struct {
+		clonedObject
+		IsSystem bool `db:"is_system"`
+	}
+
+	var source, target []*field
+	if err := c.tx.SelectContext(ctx, &source, sqlSelectCloneFields, c.sourceID); err != nil {
+		return errors.Wrap(err, "error loading template fields")
+	}
+	if err := c.tx.SelectContext(ctx, &target, sqlSelectCloneFields, c.targetID); err != nil {
+		return errors.Wrap(err, "error loading existing fields")
+	}
+
+	existing := make(map[string]*field, len(target))
+	for _, f := range target {
+		existing[f.Key] = f
+	}
+
+	for _, f := range source {
+		if e := existing[f.Key]; e != nil {
+			c.mapObject(f.UUID, e.UUID)
+			c.fields[FieldID(f.ID)] = FieldID(e.ID)
+			continue
+		}
+		if f.IsSystem {
+			continue
+		}
+
+		newUUID := string(uuids.New())
+		var newID FieldID
+		if err := c.tx.GetContext(ctx, &newID, sqlInsertClonedField, f.ID, newUUID, c.targetID, c.userID); err != nil {
+			return errors.Wrapf(err, "error cloning field %s", f.Key)
+		}
+
+		c.mapObject(f.UUID, newUUID)
+		c.fields[FieldID(f.ID)] = newID
+		c.clone.Fields++
+	}
+	return nil
+}
+
+const sqlSelectCloneGroups = `
+  SELECT id, uuid, name AS key, group_type, query
+    FROM contacts_contactgroup
+   WHERE org_id = $1 AND is_active = TRUE AND is_system = FALSE
+ORDER BY id`
+
+const sqlInsertClonedGroup = `
+INSERT INTO contacts_contactgroup(uuid, org_id, name, group_type, query, status, is_system, is_active, created_on, modified_on, created_by_id, modified_by_id)
+     SELECT $2, $3, name, group_type, query, $4, FALSE, TRUE, NOW(), NOW(), $5, $5
+       FROM contacts_contactgroup
+      WHERE id = $1
+  RETURNING id`
+
+// clones manual and smart groups without their contacts, mapping groups with the same name to the existing groups in
+// the target org
+func (c *orgCloner) cloneGroups(ctx context.Context) error {
+	type group struct {
+		clonedObject
+		Type  GroupType   `db:"group_type"`
+		Query null.String `db:"query"`
+	}
+
+	var source, target []*group
+	if err := c.tx.SelectContext(ctx, &source, sqlSelectCloneGroups, c.sourceID); err != nil {
+		return errors.Wrap(err, "error loading template groups")
+	}
+	if err := c.tx.SelectContext(ctx, &target, sqlSelectCloneGroups, c.targetID); err != nil {
+		return errors.Wrap(err, "error loading existing groups")
+	}
+
+	existing := make(map[string]*group, len(target))
+	for _, g := range target {
+		existing[strings.ToLower(g.Key)] = g
+	}
+
+	for _, g := range source {
+		if e := existing[strings.ToLower(g.Key)]; e != nil {
+			c.mapObject(g.UUID, e.UUID)
+			c.groups[GroupID(g.ID)] = GroupID(e.ID)
+			continue
+		}
+
+		status := GroupStatusReady
+		if g.Type == GroupTypeSmart {
+			status = GroupStatusInitializing
+		}
+
+		newUUID := string(uuids.New())
+		var newID GroupID
+		if err := c.tx.GetContext(ctx, &newID, sqlInsertClonedGroup, g.ID, newUUID, c.targetID, status, c.userID); err != nil {
+			return errors.Wrapf(err, "error cloning group %s", g.Key)
+		}
+
+		c.mapObject(g.UUID, newUUID)
+		c.groups[GroupID(g.ID)] = newID
+		c.clone.Groups++
+
+		if g.Type == GroupTypeSmart {
+			c.clone.NewSmartGroups[newID] = string(g.Query)
+		}
+	}
+	return nil
+}
+
+// archived flows aren't cloned but system flows are as they're used by campaign message events
+const sqlSelectCloneFlows = `
+SELECT f.id, f.uuid, f.name AS key, fr.spec_version, fr.definition
+  FROM flows_flow f
+ INNER JOIN LATERAL (
+     SELECT spec_version, definition
+       FROM flows_flowrevision
+      WHERE flow_id = f.id AND is_active = TRUE
+   ORDER BY revision DESC
+      LIMIT 1
+ ) fr ON TRUE
+ WHERE f.org_id = $1 AND f.is_active = TRUE AND f.is_archived = FALSE
+ ORDER BY f.id`
+
+const sqlInsertClonedFlow = `
+INSERT INTO flows_flow(uuid, org_id, name, flow_type, metadata, expires_after_minutes, ignore_triggers, base_language, version_number, has_issues, is_system, is_archived, is_active, created_on, modified_on, saved_on, created_by_id, modified_by_id, saved_by_id)
+     SELECT $2, $3, name, flow_type, metadata, expires_after_minutes, ignore_triggers, base_language, version_number, has_issues, is_system, FALSE, TRUE, NOW(), NOW(), NOW(), $4, $4, $4
+       FROM flows_flow
+      WHERE id = $1
+  RETURNING id`
+
+// clones flows, rewriting the UUIDs of the flows and groups they reference and giving their nodes new UUIDs. This happens
+// after fields and groups have been cloned, and all flows are created before their definitions are cloned so that flows
+// can reference each other.
+func (c *orgCloner) cloneFlows(ctx context.Context) error {
+	type flow struct {
+		clonedObject
+		SpecVersion string          `db:"spec_version"`
+		Definition  json.RawMessage `db:"definition"`
+	}
+
+	var source []*flow
+	if err := c.tx.SelectContext(ctx, &source, sqlSelectCloneFlows, c.sourceID); err != nil {
+		return errors.Wrap(err, "error loading template flows")
+	}
+
+	for _, f := range source {
+		newUUID := string(uuids.New())
+		var newID FlowID
+		if err := c.tx.GetContext(ctx, &newID, sqlInsertClonedFlow, f.ID, newUUID, c.targetID, c.userID); err != nil {
+			return errors.Wrapf(err, "error cloning flow %s", f.Key)
+		}
+
+		c.mapObject(f.UUID, newUUID)
+		c.flows[FlowID(f.ID)] = newID
+	}
+
+	mapping := c.dependencyMapping()
+
+	for _, f := range source {
+		definition, err := goflow.CloneDefinition(f.Definition, mapping)
+		if err != nil {
+			return errors.Wrapf(err, "error cloning definition of flow %s", f.Key)
+		}
+
+		if _, err := InsertFlowRevision(ctx, c.tx, c.flows[FlowID(f.ID)], definition, f.SpecVersion, c.userID); err != nil {
+			return errors.Wrapf(err, "error saving definition of cloned flow %s", f.Key)
+		}
+		c.clone.Flows++
+	}
+	return nil
+}
+
+const sqlSelectCloneCampaigns = `
+  SELECT id, uuid, name AS key, group_id
+    FROM campaigns_campaign
+   WHERE org_id = $1 AND is_active = TRUE AND is_archived = FALSE
+ORDER BY id`
+
+const sqlInsertClonedCampaign = `
+INSERT INTO campaigns_campaign(uuid, org_id, name, group_id, is_system, is_archived, is_active, created_on, modified_on, created_by_id, modified_by_id)
+     SELECT $2, $3, name, $4, is_system, FALSE, TRUE, NOW(), NOW(), $5, $5
+       FROM campaigns_campaign
+      WHERE id = $1
+  RETURNING id`
+
+const sqlSelectCloneCampaignEvents = `
+  SELECT id, uuid, flow_id, relative_to_id
+    FROM campaigns_campaignevent
+   WHERE campaign_id = $1 AND is_active = TRUE
+ORDER BY id`
+
+const sqlInsertClonedCampaignEvent = `
+INSERT INTO campaigns_campaignevent(uuid, campaign_id, event_type, flow_id, relative_to_id, "offset", unit, delivery_hour, start_mode, message, is_active, created_on, modified_on, created_by_id, modified_by_id)
+     SELECT $2, $3, event_type, $4, $5, "offset", unit, delivery_hour, start_mode, message, TRUE, NOW(), NOW(), $6, $6
+       FROM campaigns_campaignevent
+      WHERE id = $1
+  RETURNING id`
+
+// clones campaigns and their events. Events whose flow or field wasn't cloned are skipped.
+func (c *orgCloner) cloneCampaigns(ctx context.Context) error {
+	type campaign struct {
+		clonedObject
+		GroupID GroupID `db:"group_id"`
+	}
+	type event struct {
+		clonedObject
+		FlowID       FlowID  `db:"flow_id"`
+		RelativeToID FieldID `db:"relative_to_id"`
+	}
+
+	var source []*campaign
+	if err := c.tx.SelectContext(ctx, &source, sqlSelectCloneCampaigns, c.sourceID); err != nil {
+		return errors.Wrap(err, "error loading template campaigns")
+	}
+
+	for _, camp := range source {
+		groupID, found := c.groups[camp.GroupID]
+		if !found {
+			continue
+		}
+
+		newUUID := string(uuids.New())
+		var newID CampaignID
+		if err := c.tx.GetContext(ctx, &newID, sqlInsertClonedCampaign, camp.ID, newUUID, c.targetID, groupID, c.userID); err != nil {
+			return errors.Wrapf(err, "error cloning campaign %s", camp.Key)
+		}
+
+		c.mapObject(camp.UUID, newUUID)
+		c.clone.Campaigns++
+
+		var events []*event
+		if err := c.tx.SelectContext(ctx, &events, sqlSelectCloneCampaignEvents, camp.ID); err != nil {
+			return errors.Wrapf(err, "error loading events of template campaign %s", camp.Key)
+		}
+
+		for _, e := range events {
+			flowID, flowFound := c.flows[e.FlowID]
+			fieldID, fieldFound := c.fields[e.RelativeToID]
+			if !flowFound || !fieldFound {
+				continue
+			}
+
+			newEventUUID := string(uuids.New())
+			var newEventID CampaignEventID
+			if err := c.tx.GetContext(ctx, &newEventID, sqlInsertClonedCampaignEvent, e.ID, newEventUUID, newID, flowID, fieldID, c.userID); err != nil {
+				return errors.Wrapf(err, "error cloning event of campaign %s", camp.Key)
+			}
+
+			c.mapObject(e.UUID, newEventUUID)
+			c.clone.NewCampaignEvents = append(c.clone.NewCampaignEvents, newEventID)
+			c.clone.CampaignEvents++
+		}
+	}
+	return nil
+}
+
+const sqlSelectCloneTriggers = `
+  SELECT id, flow_id, channel_id IS NOT NULL OR schedule_id IS NOT NULL AS skip
+    FROM triggers_trigger
+   WHERE org_id = $1 AND is_active = TRUE AND is_archived = FALSE
+ORDER BY id`
+
+const sqlInsertClonedTrigger = `
+INSERT INTO triggers_trigger(org_id, flow_id, trigger_type, keyword, referrer_id, match_type, is_archived, is_active, created_on, modified_on, created_by_id, modified_by_id)
+     SELECT $2, $3, trigger_type, keyword, referrer_id, match_type, FALSE, TRUE, NOW(), NOW(), $4, $4
+       FROM triggers_trigger
+      WHERE id = $1
+  RETURNING id`
+
+const sqlSelectCloneTriggerGroups = `SELECT contactgroup_id FROM triggers_trigger_groups WHERE trigger_id = $1`
+const sqlSelectCloneTriggerExcludeGroups = `SELECT contactgroup_id FROM triggers_trigger_exclude_groups WHERE trigger_id = $1`
+
+const sqlInsertClonedTriggerGroups = `INSERT INTO triggers_trigger_groups(trigger_id, contactgroup_id) SELECT $1, unnest($2::int[])`
+const sqlInsertClonedTriggerExcludeGroups = `INSERT INTO triggers_trigger_exclude_groups(trigger_id, contactgroup_id) SELECT $1, unnest($2::int[])`
+
+// clones triggers and their group inclusions and exclusions
+func (c *orgCloner) cloneTriggers(ctx context.Context) error {
+	type trigger struct {
+		ID     TriggerID `db:"id"`
+		FlowID FlowID    `db:"flow_id"`
+		Skip   bool      `db:"skip"`
+	}
+
+	var source []*trigger
+	if err := c.tx.SelectContext(ctx, &source, sqlSelectCloneTriggers, c.sourceID); err != nil {
+		return errors.Wrap(err, "error loading template triggers")
+	}
+
+	for _, t := range source {
+		flowID, found := c.flows[t.FlowID]
+		if t.Skip || !found {
+			c.clone.SkippedTriggers++
+			continue
+		}
+
+		var newID TriggerID
+		if err := c.tx.GetContext(ctx, &newID, sqlInsertClonedTrigger, t.ID, c.targetID, flowID, c.userID); err != nil {
+			return errors.Wrapf(err, "error cloning trigger #%d", t.ID)
+		}
+
+		if err := c.cloneTriggerGroups(ctx, t.ID, newID, sqlSelectCloneTriggerGroups, sqlInsertClonedTriggerGroups); err != nil {
+			return err
+		}
+		if err := c.cloneTriggerGroups(ctx, t.ID, newID, sqlSelectCloneTriggerExcludeGroups, sqlInsertClonedTriggerExcludeGroups); err != nil {
+			return err
+		}
+		c.clone.Triggers++
+	}
+	return nil
+}
+
+func (c *orgCloner) cloneTriggerGroups(ctx context.Context, sourceID, targetID TriggerID, selectSQL, insertSQL string) error {
+	var sourceGroupIDs []GroupID
+	if err := c.tx.SelectContext(ctx, &sourceGroupIDs, selectSQL, sourceID); err != nil {
+		return errors.Wrapf(err, "error loading groups of template trigger #%d", sourceID)
+	}
+
+	groupIDs := make([]GroupID, 0, len(sourceGroupIDs))
+	for _, id := range sourceGroupIDs {
+		if groupID, found := c.groups[id]; found {
+			groupIDs = append(groupIDs, groupID)
+		}
+	}
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	_, err := c.tx.ExecContext(ctx, insertSQL, targetID, pq.Array(groupIDs))
+	return errors.Wrapf(err, "error cloning groups of trigger #%d", sourceID)
+}
+
+func (c *orgCloner) mapObject(oldUUID, newUUID string) {
+	c.clone.UUIDs[oldUUID] = newUUID
+}
+
+// gets the mapping of UUIDs of cloned objects to the UUIDs of their copies for cloning flow definitions
+func (c *orgCloner) dependencyMapping() map[uuids.UUID]uuids.UUID {
+	mapping := make(map[uuids.UUID]uuids.UUID, len(c.clone.UUIDs))
+	for oldUUID, newUUID := range c.clone.UUIDs {
+		mapping[uuids.UUID(oldUUID)] = uuids.UUID(newUUID)
+	}
+	return mapping
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/pkg/errors"
+)
+
+// OrgCounts is a snapshot of the counts for an org's groups, labels and flows taken from the count rollup tables
+type OrgCounts struct {
+	AsOf   time.Time                `json:"as_of"`
+	Groups map[assets.GroupUUID]int `json:"groups"`
+	Labels map[assets.LabelUUID]int `json:"labels"`
+	Flows  map[assets.FlowUUID]int  `json:"flows"`
+}
+
+const sqlSelectGroupCounts = `
+   SELECT g.uuid, COALESCE(SUM(c.count), 0) AS count
+     FROM contacts_contactgroup g
+LEFT JOIN contacts_contactgroupcount c ON c.group_id = g.id
+    WHERE g.org_id = $1 AND g.is_active = TRUE
+ GROUP BY g.uuid`
+
+const sqlSelectLabelCounts = `
+   SELECT l.uuid, COALESCE(SUM(c.count), 0) AS count
+     FROM msgs_label l
+LEFT JOIN msgs_labelcount c ON c.label_id = l.id AND c.is_archived = FALSE
+    WHERE l.org_id = $1 AND l.is_active = TRUE AND l.label_type = 'L'
+ GROUP BY l.uuid`
+
+const sqlSelectActiveRunCounts = `
+   SELECT f.uuid, COALESCE(SUM(c.count), 0) AS count
+     FROM flows_flow f
+LEFT JOIN flows_flowruncount c ON c.flow_id = f.id AND c.exit_type IS NULL
+    WHERE f.org_id = $1 AND f.is_active = TRUE
+ GROUP BY f.uuid`
+
+type uuidCount struct {
+	UUID  string `db:"uuid"`
+	Count int    `db:"count"`
+}
+
+// GetOrgCounts gets the contact counts of the given org's groups, the visible message counts of its labels and the
+// active run counts of its flows. All counts are read from the same snapshot, and the time of that snapshot is
+// returned as AsOf.
+func GetOrgCounts(ctx context.Context, db *sqlx.DB, orgID OrgID) (*OrgCounts, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting transaction")
+	}
+	defer tx.Rollback()
+
+	counts := &OrgCounts{
+		Groups: make(map[assets.GroupUUID]int),
+		Labels: make(map[assets.LabelUUID]int),
+		Flows:  make(map[assets.FlowUUID]int),
+	}
+
+	// NOW() is the start time of the transaction
+	if err := tx.GetContext(ctx, &counts.AsOf, `SELECT NOW()`); err != nil {
+		return nil, errors.Wrap(err, "error selecting snapshot time")
+	}
+
+	rows := make([]*uuidCount, 0)
+
+	if err := tx.SelectContext(ctx, &rows, sqlSelectGroupCounts, orgID); err != nil {
+		return nil, errors.Wrap(err, "error selecting group counts")
+	}
+	for _, r := range rows {
+		counts.Groups[assets.GroupUUID(r.UUID)] = r.Count
+	}
+
+	rows = rows[:0]
+	if err := tx.SelectContext(ctx, &rows, sqlSelectLabelCounts, orgID); err != nil {
+		return nil, errors.Wrap(err, "error selecting label counts")
+	}
+	for _, r := range rows {
+		counts.Labels[assets.LabelUUID(r.UUID)] = r.Count
+	}
+
+	rows = rows[:0]
+	if err := tx.SelectContext(ctx, &rows, sqlSelectActiveRunCounts, orgID); err != nil {
+		return nil, errors.Wrap(err, "error selecting flow run counts")
+	}
+	for _, r := range rows {
+		counts.Flows[assets.FlowUUID(r.UUID)] = r.Count
+	}
+
+	counts.AsOf = counts.AsOf.UTC()
+
+	return counts, tx.Commit()
+}
+
+const sqlRecomputeGroupCounts = `
+WITH deleted AS (
+	DELETE FROM contacts_contactgroupcount WHERE group_id IN (SELECT id FROM contacts_contactgroup WHERE org_id = $1 AND is_active = TRUE)
+)
+INSERT INTO contacts_contactgroupcount(group_id, count, is_squashed)
+     SELECT g.id, COUNT(gc.contact_id), TRUE
+       FROM contacts_contactgroup g
+  LEFT JOIN contacts_contactgroup_contacts gc ON gc.contactgroup_id = g.id
+      WHERE g.org_id = $1 AND g.is_active = TRUE
+   GROUP BY g.id`
+
+const sqlRecomputeLabelCounts = `
+WITH deleted AS (
+	DELETE FROM msgs_labelcount WHERE label_id IN (SELECT id FROM msgs_label WHERE org_id = $1 AND is_active = TRUE AND label_type = 'L')
+)
+INSERT INTO msgs_labelcount(label_id, is_archived, count, is_squashed)
+     SELECT l.id, m.visibility = 'A', COUNT(*), TRUE
+       FROM msgs_label l
+       JOIN msgs_msg_labels ml ON ml.label_id = l.id
+       JOIN msgs_msg m ON m.id = ml.msg_id AND m.visibility IN ('V', 'A')
+      WHERE l.org_id = $1 AND l.is_active = TRUE AND l.label_type = 'L'
+   GROUP BY l.id, m.visibility = 'A'`
+
+// run statuses are mapped to exit types in the same way as the trigger which maintains flows_flowruncount
+const sqlRecomputeRunCounts = `
+WITH deleted AS (
+	DELETE FROM flows_flowruncount WHERE flow_id IN (SELECT id FROM flows_flow WHERE org_id = $1 AND is_active = TRUE)
+)
+INSERT INTO flows_flowruncount(flow_id, exit_type, count, is_squashed)
+     SELECT r.flow_id, CASE r.status WHEN 'I' THEN 'I' WHEN 'C' THEN 'C' WHEN 'X' THEN 'E' WHEN 'F' THEN 'F' END, COUNT(*), TRUE
+       FROM flows_flowrun r
+       JOIN flows_flow f ON f.id = r.flow_id
+      WHERE f.org_id = $1 AND f.is_active = TRUE
+   GROUP BY r.flow_id, CASE r.status WHEN 'I' THEN 'I' WHEN 'C' THEN 'C' WHEN 'X' THEN 'E' WHEN 'F' THEN 'F' END`
+
+// RecomputeOrgCounts replaces the rollup counts of the given org's groups, labels and flows with counts calculated
+// from the underlying data, fixing any drift. Nothing is locked beyond the org's own count rows. The underlying data
+// is counted and the old rollup rows deleted from the same snapshot, so rows added by triggers for changes committed
+// after that snapshot are kept, and if a concurrent squash deletes rows we're replacing, the transaction fails with a
+// serialization error rather than counting them twice, and the recompute can just be queued again.
+func RecomputeOrgCounts(ctx context.Context, db *sqlx.DB, orgID OrgID) error {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return errors.Wrap(err, "error starting transaction")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, sqlRecomputeGroupCounts, orgID); err != nil {
+		return errors.Wrap(err, "error recomputing group counts")
+	}
+	if _, err := tx.ExecContext(ctx, sqlRecomputeLabelCounts, orgID); err != nil {
+		return errors.Wrap(err, "error recomputing label counts")
+	}
+	if _, err := tx.ExecContext(ctx, sqlRecomputeRunCounts, orgID); err != nil {
+		return errors.Wrap(err, "error recomputing flow run counts")
+	}
+
+	return errors.Wrap(tx.Commit(), "error committing recomputed counts")
+}
@@ -0,0 +1,54 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrgCounts(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	var doctorsCount, reportingCount int
+	db.Get(&doctorsCount, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1`, testdata.DoctorsGroup.ID)
+
+	sessionID := testdata.InsertWaitingSession(db, testdata.Org1, testdata.Cathy, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now(), false, nil)
+	testdata.InsertFlowRun(db, testdata.Org1, sessionID, testdata.Cathy, testdata.Favorites, models.RunStatusWaiting)
+	testdata.InsertFlowRun(db, testdata.Org1, sessionID, testdata.Bob, testdata.Favorites, models.RunStatusCompleted)
+
+	// make the counts drift
+	db.MustExec(`INSERT INTO contacts_contactgroupcount(group_id, count, is_squashed) VALUES($1, 7, FALSE)`, testdata.DoctorsGroup.ID)
+	db.MustExec(`INSERT INTO msgs_labelcount(label_id, is_archived, count, is_squashed) VALUES($1, FALSE, 3, FALSE)`, testdata.ReportingLabel.ID)
+	db.MustExec(`INSERT INTO flows_flowruncount(flow_id, exit_type, count, is_squashed) VALUES($1, NULL, 5, FALSE)`, testdata.Favorites.ID)
+
+	counts, err := models.GetOrgCounts(ctx, db, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.False(t, counts.AsOf.IsZero())
+	assert.Equal(t, doctorsCount+7, counts.Groups[testdata.DoctorsGroup.UUID])
+	assert.Equal(t, 3, counts.Labels[testdata.ReportingLabel.UUID])
+	assert.Equal(t, 6, counts.Flows[testdata.Favorites.UUID]) // includes the waiting run we inserted
+
+	err = models.RecomputeOrgCounts(ctx, db, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	db.Get(&reportingCount, `SELECT count(*) FROM msgs_msg_labels ml JOIN msgs_msg m ON m.id = ml.msg_id WHERE ml.label_id = $1 AND m.visibility = 'V'`, testdata.ReportingLabel.ID)
+
+	counts, err = models.GetOrgCounts(ctx, db, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, doctorsCount, counts.Groups[testdata.DoctorsGroup.UUID])
+	assert.Equal(t, reportingCount, counts.Labels[testdata.ReportingLabel.UUID])
+	assert.Equal(t, 1, counts.Flows[testdata.Favorites.UUID])
+
+	// other orgs' counts are untouched
+	counts, err = models.GetOrgCounts(ctx, db, testdata.Org2.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, counts.Groups, testdata.DoctorsGroup.UUID)
+}
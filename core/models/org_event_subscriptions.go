@@ -0,0 +1,164 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+// Resthook returns the slug of the resthook which URLs subscribe to in order to be sent org events of this type, e.g.
+// org-event-msg-received, so that integrations like Zapier can use the same subscriptions as flow resthooks
+func (t OrgEventType) Resthook() string {
+	return "org-event-" + strings.ReplaceAll(string(t), "_", "-")
+}
+
+// OrgEventInfo describes a type of org event for integrations which let users pick events to be sent
+type OrgEventInfo struct {
+	Type        OrgEventType `json:"type"`
+	Description string       `json:"description"`
+	Sample      *OrgEvent    `json:"sample"`
+}
+
+// when our sample events were created
+var orgEventSampleTime = time.Date(2022, 10, 13, 10, 42, 53, 123456000, time.UTC)
+
+// OrgEventCatalog returns descriptions and sample payloads of all the types of org events which can be subscribed to
+func OrgEventCatalog() []*OrgEventInfo {
+	channel := assets.NewChannelReference("0f661e8b-ea9d-4bd3-9953-d368340acf91", "Twilio")
+	msgIn := flows.NewMsgIn("8b7f1c5e-ba3c-4fbc-9b8e-6a1ee6b28c5f", "tel:+16055741111", channel, "hi there", nil)
+	msgIn.SetID(1234)
+
+	ticket := NewTicket("1e1ad57e-4c21-4d7e-9d14-44e5f0e3b3a5", 1, NilUserID, NilFlowID, 123, 4, "", 5, "Where are my cookies?", NilUserID, nil)
+	ticket.t.ID = 45
+	ticketEvent := NewTicketOpenedEvent(ticket, NilUserID, NilUserID)
+	ticketEvent.e.ID = 67
+	ticketEvent.e.CreatedOn = orgEventSampleTime
+
+	contactChanged := NewContactChangedOrgEvent(123)
+	contactChanged.CreatedOn = orgEventSampleTime
+
+	return []*OrgEventInfo{
+		{
+			Type:        OrgEventTypeMsgReceived,
+			Description: "A contact sent a message",
+			Sample:      NewMsgReceivedOrgEvent(123, msgIn, orgEventSampleTime),
+		},
+		{
+			Type:        OrgEventTypeMsgFailed,
+			Description: "An outgoing message was reported as failed by its channel",
+			Sample:      NewMsgFailedOrgEvent(&UpdatedMsgStatus{ID: 1235, ContactID: 123, ExternalID: "SM123", Status: MsgStatusFailed}, orgEventSampleTime),
+		},
+		{
+			Type:        OrgEventTypeTicketEvent,
+			Description: "A ticket was opened, assigned, noted, closed or reopened",
+			Sample:      NewTicketOrgEvent(ticketEvent),
+		},
+		{
+			Type:        OrgEventTypeContactChanged,
+			Description: "A contact was modified",
+			Sample:      contactChanged,
+		},
+		{
+			Type:        OrgEventTypeAbuseDetected,
+			Description: "A contact was blocked or stopped for sending too many messages",
+			Sample:      NewAbuseDetectedOrgEvent(123, &AbuseDetected{Reason: AbuseReasonTooManyMsgs, Action: AbuseActionBlock, Count: 31, Window: 300}, orgEventSampleTime),
+		},
+	}
+}
+
+// GetOrgEventInfo returns the catalog entry for the given type of org event, or nil if there's no such type
+func GetOrgEventInfo(t OrgEventType) *OrgEventInfo {
+	for _, info := range OrgEventCatalog() {
+		if info.Type == t {
+			return info
+		}
+	}
+	return nil
+}
+
+// OrgEventSubscription is a URL subscribed to a type of org event
+type OrgEventSubscription struct {
+	Event OrgEventType `json:"event"`
+	*ResthookSubscriber
+}
+
+// SubscribeOrgEvent subscribes the given URL to the given type of org event. Subscribing a URL which is already
+// subscribed is a noop.
+func SubscribeOrgEvent(ctx context.Context, db Queryer, orgID OrgID, userID UserID, t OrgEventType, url string) (*OrgEventSubscription, error) {
+	sub, err := SubscribeResthook(ctx, db, orgID, userID, t.Resthook(), url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error subscribing to org event '%s'", t)
+	}
+	return &OrgEventSubscription{Event: t, ResthookSubscriber: sub}, nil
+}
+
+// UnsubscribeOrgEvent unsubscribes the given URL from the given type of org event
+func UnsubscribeOrgEvent(ctx context.Context, db Queryer, orgID OrgID, t OrgEventType, url string) error {
+	return UnsubscribeResthooks(ctx, db, []*ResthookUnsubscribe{{OrgID: orgID, Slug: t.Resthook(), URL: url}})
+}
+
+const sqlSelectOrgEventSubscribers = `
+SELECT s.id, r.slug AS resthook, s.target_url AS url, s.created_on
+  FROM api_resthooksubscriber s
+  JOIN api_resthook r ON r.id = s.resthook_id
+ WHERE r.org_id = $1 AND r.slug = ANY($2) AND r.is_active = TRUE AND s.is_active = TRUE
+ORDER BY r.slug, s.target_url`
+
+// LoadOrgEventSubscriptions loads the active subscriptions to all types of org event
+func LoadOrgEventSubscriptions(ctx context.Context, db Queryer, orgID OrgID) ([]*OrgEventSubscription, error) {
+	catalog := OrgEventCatalog()
+	typesBySlug := make(map[string]OrgEventType, len(catalog))
+	slugs := make([]string, len(catalog))
+	for i, info := range catalog {
+		typesBySlug[info.Type.Resthook()] = info.Type
+		slugs[i] = info.Type.Resthook()
+	}
+
+	subs := make([]*ResthookSubscriber, 0, 5)
+	if err := db.SelectContext(ctx, &subs, sqlSelectOrgEventSubscribers, orgID, pq.Array(slugs)); err != nil {
+		return nil, errors.Wrap(err, "error loading org event subscribers")
+	}
+
+	subscriptions := make([]*OrgEventSubscription, len(subs))
+	for i, s := range subs {
+		subscriptions[i] = &OrgEventSubscription{Event: typesBySlug[s.Resthook], ResthookSubscriber: s}
+	}
+	return subscriptions, nil
+}
+
+// queues delivery of the given events to the URLs subscribed to their types. Subscribers are read from the org's
+// cached assets so new subscriptions take effect when those are next refreshed. Deliveries go on the batch queue like
+// other resthook deliveries so that slow subscribers don't hold up message handling, and as a delivery can't be taken
+// back, this must only be called once the events have been committed.
+func queueOrgEventDeliveries(ctx context.Context, rt *runtime.Runtime, rc redis.Conn, orgID OrgID, events []*OrgEvent) error {
+	oa, err := GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return errors.Wrap(err, "error loading org assets")
+	}
+
+	for _, e := range events {
+		slug := e.Type.Resthook()
+
+		rh := oa.ResthookBySlug(slug)
+		if rh == nil || len(rh.Subscribers()) == 0 {
+			continue
+		}
+
+		delivery := &ResthookDelivery{Resthook: slug, Payload: jsonx.MustMarshal(e), CreatedOn: e.CreatedOn}
+
+		if err := queue.AddTask(ctx, rc, queue.BatchQueue, queue.DeliverResthookEvent, int(orgID), delivery, queue.DefaultPriority); err != nil {
+			return errors.Wrapf(err, "error queuing delivery of %s event", e.Type)
+		}
+	}
+
+	return nil
+}
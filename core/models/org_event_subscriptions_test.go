@@ -0,0 +1,83 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrgEventCatalog(t *testing.T) {
+	catalog := models.OrgEventCatalog()
+	assert.Len(t, catalog, 5)
+
+	for _, info := range catalog {
+		assert.Equal(t, info.Type, info.Sample.Type)
+		assert.NotEmpty(t, info.Description)
+	}
+
+	assert.Equal(t, "org-event-msg-received", models.OrgEventTypeMsgReceived.Resthook())
+	assert.Equal(t, models.OrgEventTypeTicketEvent, models.GetOrgEventInfo(models.OrgEventTypeTicketEvent).Type)
+	assert.Nil(t, models.GetOrgEventInfo("xxx"))
+}
+
+func TestOrgEventSubscriptions(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	_, err := models.SubscribeOrgEvent(ctx, db, testdata.Org1.ID, testdata.Admin.ID, models.OrgEventTypeMsgReceived, "https://foo.bar/1")
+	require.NoError(t, err)
+	sub, err := models.SubscribeOrgEvent(ctx, db, testdata.Org1.ID, testdata.Admin.ID, models.OrgEventTypeContactChanged, "https://foo.bar/2")
+	require.NoError(t, err)
+	assert.Equal(t, models.OrgEventTypeContactChanged, sub.Event)
+	assert.Equal(t, "org-event-contact-changed", sub.Resthook)
+
+	// a regular resthook subscription isn't an event subscription
+	_, err = models.SubscribeResthook(ctx, db, testdata.Org1.ID, testdata.Admin.ID, "registration", "https://foo.bar/3")
+	require.NoError(t, err)
+
+	subs, err := models.LoadOrgEventSubscriptions(ctx, db, testdata.Org1.ID)
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+	assert.Equal(t, models.OrgEventTypeContactChanged, subs[0].Event)
+	assert.Equal(t, "https://foo.bar/2", subs[0].URL)
+	assert.Equal(t, models.OrgEventTypeMsgReceived, subs[1].Event)
+	assert.Equal(t, "https://foo.bar/1", subs[1].URL)
+
+	_, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshResthooks)
+	require.NoError(t, err)
+
+	// only events with subscribers are queued for delivery
+	event := models.NewContactChangedOrgEvent(testdata.Cathy.ID)
+	models.PublishOrgEvents(ctx, rt, testdata.Org1.ID, []*models.OrgEvent{event, models.NewContactChangedOrgEvent(testdata.Bob.ID)})
+	models.PublishOrgEvents(ctx, rt, testdata.Org1.ID, []*models.OrgEvent{models.NewAbuseDetectedOrgEvent(testdata.Cathy.ID, &models.AbuseDetected{}, event.CreatedOn)})
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	size, err := queue.Size(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	task, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, queue.DeliverResthookEvent, task.Type)
+
+	delivery := &models.ResthookDelivery{}
+	jsonx.MustUnmarshal(task.Task, delivery)
+	assert.Equal(t, "org-event-contact-changed", delivery.Resthook)
+	assert.JSONEq(t, string(jsonx.MustMarshal(event)), string(delivery.Payload))
+
+	err = models.UnsubscribeOrgEvent(ctx, db, testdata.Org1.ID, models.OrgEventTypeMsgReceived, "https://foo.bar/1")
+	require.NoError(t, err)
+
+	subs, err = models.LoadOrgEventSubscriptions(ctx, db, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Len(t, subs, 1)
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/sirupsen/logrus"
+)
+
+// OrgEventType is the type of an event published to an org's live event stream
+type OrgEventType string
+
+const (
+	OrgEventTypeMsgReceived    = OrgEventType("msg_received")
+	OrgEventTypeMsgFailed      = OrgEventType("msg_failed")
+	OrgEventTypeTicketEvent    = OrgEventType("ticket_event")
+	OrgEventTypeContactChanged = OrgEventType("contact_changed")
+	OrgEventTypeAbuseDetected  = OrgEventType("abuse_detected")
+)
+
+// OrgEvent is an event published to an org's live event stream so that agent consoles don't have to poll for changes
+type OrgEvent struct {
+	Type      OrgEventType `json:"type"`
+	ContactID ContactID    `json:"contact_id"`
+	Data      interface{}  `json:"data,omitempty"`
+	CreatedOn time.Time    `json:"created_on"`
+}
+
+// NewMsgReceivedOrgEvent creates a new event for an incoming message
+func NewMsgReceivedOrgEvent(contactID ContactID, msg *flows.MsgIn, createdOn time.Time) *OrgEvent {
+	return &OrgEvent{Type: OrgEventTypeMsgReceived, ContactID: contactID, Data: msg, CreatedOn: createdOn}
+}
+
+// NewMsgFailedOrgEvent creates a new event for an outgoing message which its channel reported as failed
+func NewMsgFailedOrgEvent(msg *UpdatedMsgStatus, createdOn time.Time) *OrgEvent {
+	return &OrgEvent{Type: OrgEventTypeMsgFailed, ContactID: msg.ContactID, Data: msg, CreatedOn: createdOn}
+}
+
+// NewTicketOrgEvent creates a new event for a ticket being opened, assigned, closed etc
+func NewTicketOrgEvent(evt *TicketEvent) *OrgEvent {
+	return &OrgEvent{Type: OrgEventTypeTicketEvent, ContactID: evt.ContactID(), Data: evt, CreatedOn: evt.e.CreatedOn}
+}
+
+// NewContactChangedOrgEvent creates a new event for a contact being modified
+func NewContactChangedOrgEvent(contactID ContactID) *OrgEvent {
+	return &OrgEvent{Type: OrgEventTypeContactChanged, ContactID: contactID, CreatedOn: dates.Now()}
+}
+
+// NewAbuseDetectedOrgEvent creates a new event for a contact being blocked or stopped for abuse
+func NewAbuseDetectedOrgEvent(contactID ContactID, detected *AbuseDetected, createdOn time.Time) *OrgEvent {
+	return &OrgEvent{Type: OrgEventTypeAbuseDetected, ContactID: contactID, Data: detected, CreatedOn: createdOn}
+}
+
+// OrgEventsChannel returns the redis pub/sub channel that events for the given org are published to
+func OrgEventsChannel(orgID OrgID) string {
+	return fmt.Sprintf("org_events:%d", orgID)
+}
+
+// PublishOrgEvents publishes the given events to the given org's event stream, and queues their delivery to any URLs
+// subscribed to their types. Publishing is best effort, as consumers only see events published while they are
+// subscribed anyway, so errors are logged rather than returned. It should only be called once whatever the events
+// describe has been committed, e.g. from a post-commit hook.
+func PublishOrgEvents(ctx context.Context, rt *runtime.Runtime, orgID OrgID, events []*OrgEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	channel := OrgEventsChannel(orgID)
+	for _, e := range events {
+		rc.Send("PUBLISH", channel, jsonx.MustMarshal(e))
+	}
+
+	if _, err := rc.Do(""); err != nil {
+		logrus.WithError(err).WithField("org_id", orgID).Error("error publishing org events")
+	}
+
+	if err := queueOrgEventDeliveries(ctx, rt, rc, orgID, events); err != nil {
+		logrus.WithError(err).WithField("org_id", orgID).Error("error queuing org event deliveries")
+	}
+}
+
+// PublishTicketEvents publishes the given ticket events to the given org's event stream
+func PublishTicketEvents(ctx context.Context, rt *runtime.Runtime, orgID OrgID, evts map[*Ticket]*TicketEvent) {
+	events := make([]*OrgEvent, 0, len(evts))
+	for _, evt := range evts {
+		events = append(events, NewTicketOrgEvent(evt))
+	}
+
+	PublishOrgEvents(ctx, rt, orgID, events)
+}
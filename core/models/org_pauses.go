@@ -0,0 +1,136 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// hash of org id to the time outbound was paused for that org
+const pausedOrgsKey = "paused_orgs"
+
+// PauseOrgOutbound pauses all outbound messages and calls for the given org, returning when it was paused, which will
+// be the original time if it was already paused
+func PauseOrgOutbound(rc redis.Conn, orgID OrgID, now time.Time) (time.Time, error) {
+	rc.Send("MULTI")
+	rc.Send("HSETNX", pausedOrgsKey, orgID, now.UTC().Format(time.RFC3339Nano))
+	rc.Send("HGET", pausedOrgsKey, orgID)
+	replies, err := redis.Values(rc.Do("EXEC"))
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "error pausing outbound for org #%d", orgID)
+	}
+
+	pausedOn, err := redis.String(replies[1], nil)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(err, "error reading outbound paused time for org #%d", orgID)
+	}
+
+	return time.Parse(time.RFC3339Nano, pausedOn)
+}
+
+// ResumeOrgOutbound resumes outbound messages and calls for the given org, returning when it was paused, or nil if it
+// wasn't paused
+func ResumeOrgOutbound(rc redis.Conn, orgID OrgID) (*time.Time, error) {
+	rc.Send("MULTI")
+	rc.Send("HGET", pausedOrgsKey, orgID)
+	rc.Send("HDEL", pausedOrgsKey, orgID)
+	replies, err := redis.Values(rc.Do("EXEC"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error resuming outbound for org #%d", orgID)
+	}
+
+	pausedOn, err := redis.String(replies[0], nil)
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error reading outbound paused time for org #%d", orgID)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, pausedOn)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// IsOrgOutboundPaused returns whether outbound messages and calls are paused for the given org
+func IsOrgOutboundPaused(rc redis.Conn, orgID OrgID) (bool, error) {
+	paused, err := redis.Bool(rc.Do("HEXISTS", pausedOrgsKey, orgID))
+	if err != nil {
+		return false, errors.Wrapf(err, "error checking whether outbound is paused for org #%d", orgID)
+	}
+	return paused, nil
+}
+
+const markMessagesPausedSQL = `
+UPDATE
+	msgs_msg
+SET
+	status = 'P',
+	next_attempt = NULL
+WHERE
+	id = ANY($1)`
+
+// MarkMessagesPaused marks the given outgoing messages as pending because their org has paused outbound. Unlike
+// messages held for quiet hours or by a frequency cap, these have no next attempt as they're held until the org
+// resumes rather than until a given time.
+func MarkMessagesPaused(ctx context.Context, db Queryer, msgs []*Msg) error {
+	ids := make([]MsgID, len(msgs))
+	for i, m := range msgs {
+		m.m.Status = MsgStatusPending
+		m.m.NextAttempt = nil
+		ids[i] = MsgID(m.ID())
+	}
+
+	_, err := db.ExecContext(ctx, markMessagesPausedSQL, pq.Array(ids))
+	return errors.Wrap(err, "error marking messages as paused")
+}
+
+var loadPausedMessagesSQL = `
+SELECT
+	m.id,
+	m.broadcast_id,
+	m.uuid,
+	m.text,
+	m.created_on,
+	m.direction,
+	m.status,
+	m.visibility,
+	m.msg_count,
+	m.error_count,
+	m.next_attempt,
+	m.failed_reason,
+	m.high_priority,
+	m.external_id,
+	m.attachments,
+	m.metadata,
+	m.channel_id,
+	m.contact_id,
+	m.contact_urn_id,
+	m.org_id,
+	u.identity AS "urn_urn",
+	u.auth AS "urn_auth"
+FROM
+	msgs_msg m
+INNER JOIN
+	contacts_contacturn u ON u.id = m.contact_urn_id
+INNER JOIN
+	channels_channel c ON c.id = m.channel_id
+WHERE
+	m.org_id = $1 AND
+	m.direction = 'O' AND
+	m.status = 'P' AND
+	m.next_attempt IS NULL AND
+	c.is_active = TRUE
+ORDER BY
+	m.id ASC
+LIMIT $2`
+
+// GetPausedMessages gets up to limit outgoing messages with an active channel which are pending without a next attempt,
+// which is how messages are held whilst their org has paused outbound
+func GetPausedMessages(ctx context.Context, db Queryer, orgID OrgID, limit int) ([]*Msg, error) {
+	return loadMessages(ctx, db, loadPausedMessagesSQL, orgID, limit)
+}
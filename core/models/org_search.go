@@ -0,0 +1,89 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// the most matches we count when searching messages and tickets, as counting every match in a large org is slow
+const orgSearchMaxCount = 1000
+
+// the text matches below must use the same expressions as the GIN indexes in migrations/0010_org_search_indexes.sql
+// or they'll scan every message or ticket in the org, and topics are matched by id so that the ticket body index can
+// still be used
+
+const sqlSearchMsgs = `
+  SELECT m.id
+    FROM msgs_msg m
+   WHERE m.org_id = $1 AND m.visibility = 'V' AND to_tsvector('simple', m.text) @@ plainto_tsquery('simple', $2)
+ORDER BY m.created_on DESC, m.id DESC
+   LIMIT $3`
+
+const sqlCountMsgs = `
+SELECT count(*) FROM (
+  SELECT 1
+    FROM msgs_msg m
+   WHERE m.org_id = $1 AND m.visibility = 'V' AND to_tsvector('simple', m.text) @@ plainto_tsquery('simple', $2)
+   LIMIT $3
+) s`
+
+// SearchMsgs does a full text search of the visible messages in the given org, returning the ids of the most recent
+// matches up to the given limit, and the total number of matches up to 1000
+func SearchMsgs(ctx context.Context, db Queryer, orgID OrgID, query string, limit int) ([]MsgID, int64, error) {
+	ids := make([]MsgID, 0, limit)
+	var total int64
+
+	if err := db.SelectContext(ctx, &ids, sqlSearchMsgs, orgID, query, limit); err != nil {
+		return nil, 0, errors.Wrap(err, "error searching messages")
+	}
+	if err := db.GetContext(ctx, &total, sqlCountMsgs, orgID, query, orgSearchMaxCount); err != nil {
+		return nil, 0, errors.Wrap(err, "error counting message matches")
+	}
+	return ids, total, nil
+}
+
+const sqlSearchTickets = `
+   SELECT t.id
+     FROM tickets_ticket t
+    WHERE t.org_id = $1 AND (
+          to_tsvector('simple', t.body) @@ plainto_tsquery('simple', $2) OR
+          t.topic_id IN (SELECT tp.id FROM tickets_topic tp WHERE tp.org_id = $1 AND tp.name ILIKE $3)
+    )
+ ORDER BY t.last_activity_on DESC, t.id DESC
+    LIMIT $4`
+
+const sqlCountTickets = `
+SELECT count(*) FROM (
+   SELECT 1
+     FROM tickets_ticket t
+    WHERE t.org_id = $1 AND (
+          to_tsvector('simple', t.body) @@ plainto_tsquery('simple', $2) OR
+          t.topic_id IN (SELECT tp.id FROM tickets_topic tp WHERE tp.org_id = $1 AND tp.name ILIKE $3)
+    )
+    LIMIT $4
+) s`
+
+// SearchTickets searches the bodies and topic names of the tickets in the given org, returning the ids of the most
+// recently active matches up to the given limit, and the total number of matches up to 1000
+func SearchTickets(ctx context.Context, db Queryer, orgID OrgID, query string, limit int) ([]TicketID, int64, error) {
+	ids := make([]TicketID, 0, limit)
+	var total int64
+	topicLike := "%" + escapeLike(query) + "%"
+
+	if err := db.SelectContext(ctx, &ids, sqlSearchTickets, orgID, query, topicLike, limit); err != nil {
+		return nil, 0, errors.Wrap(err, "error searching tickets")
+	}
+	if err := db.GetContext(ctx, &total, sqlCountTickets, orgID, query, topicLike, orgSearchMaxCount); err != nil {
+		return nil, 0, errors.Wrap(err, "error counting ticket matches")
+	}
+	return ids, total, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapes the wildcard characters in a value to be matched with LIKE
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
@@ -2,12 +2,14 @@ package models
 
 import (
 	"context"
+	"crypto/cipher"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -60,11 +62,46 @@ const (
 	// NilOrgID is the id 0 considered as nil org id
 	NilOrgID = OrgID(0)
 
-	configSMTPServer  = "smtp_server"
-	configDTOneKey    = "dtone_key"
-	configDTOneSecret = "dtone_secret"
+	configSMTPServer        = "smtp_server"
+	configAirtimeProvider   = "airtime_provider"
+	configDTOneKey          = "dtone_key"
+	configDTOneSecret       = "dtone_secret"
+	configContentPolicy     = "content_policy"
+	configMsgSampling       = "msg_sampling"
+	configQuietHours        = "quiet_hours"
+	configMsgFrequencyCap   = "msg_frequency_cap"
+	configLinkTracking      = "link_tracking"
+	configWebhookSigning    = "webhook_signing"
+	configRegion            = "region"
+	configMaxCallDuration   = "ivr_max_call_duration"
+	configIVRScreeningURL   = "ivr_screening_url"
+	configLanguageFallback  = "language_fallback"
+	configLanguageDetect    = "language_detection"
+	configAbuseDetection    = "abuse_detection"
+	configAutoReplyFastPath = "auto_reply_fast_path"
+	configTicketRouting     = "ticket_routing"
+	configWhatsAppWindow    = "whatsapp_window"
+	configChannelRouting    = "channel_routing"
+	configImportSources     = "contact_import_sources"
+	configImportApproval    = "contact_import_approval"
+	configFHIRSync          = "fhir_sync"
+
+	// AirtimeProviderDTOne is the airtime provider used by orgs which don't configure one
+	AirtimeProviderDTOne = "dtone"
 )
 
+// AirtimeServiceFunc is a func which creates an airtime service for an org
+type AirtimeServiceFunc func(*Org, *http.Client, *httpx.RetryConfig) (flows.AirtimeService, error)
+
+var airtimeServices = map[string]AirtimeServiceFunc{
+	AirtimeProviderDTOne: dtoneService,
+}
+
+// RegisterAirtimeService registers a new airtime provider
+func RegisterAirtimeService(name string, initFunc AirtimeServiceFunc) {
+	airtimeServices[name] = initFunc
+}
+
 // Org is mailroom's type for RapidPro orgs. It also implements the envs.Environment interface for GoFlow
 type Org struct {
 	o struct {
@@ -72,7 +109,24 @@ type Org struct {
 		Suspended bool     `json:"is_suspended"`
 		Config    null.Map `json:"config"`
 	}
-	env envs.Environment
+	env              envs.Environment
+	contentPolicy    *ContentPolicy
+	msgSampling      *MsgSampling
+	quietHours       *QuietHours
+	msgFreqCap       *MsgFrequencyCap
+	linkTracking     *LinkTracking
+	webhookSign      *WebhookSigning
+	languageFallback LanguageFallback
+	languageDetect   *LanguageDetection
+	abuseDetection   *AbuseDetection
+	ticketRouting    *TicketRouting
+	whatsAppWindow   *WhatsAppWindowConfig
+	channelRouting   *ChannelRouting
+	importSources    []*ContactImportSource
+	fhirSync         *FHIRSync
+
+	fieldEncryption *FieldEncryption
+	fieldCipher     cipher.AEAD
 }
 
 // ID returns the id of the org
@@ -81,6 +135,71 @@ func (o *Org) ID() OrgID { return o.o.ID }
 // Suspended returns whether the org has been suspended
 func (o *Org) Suspended() bool { return o.o.Suspended }
 
+// ContentPolicy returns the content policy applied to outgoing messages for this org, if any
+func (o *Org) ContentPolicy() *ContentPolicy { return o.contentPolicy }
+
+// MsgSampling returns the message sampling config for this org if it has one
+func (o *Org) MsgSampling() *MsgSampling { return o.msgSampling }
+
+// MsgFrequencyCap returns the message frequency cap for this org if it has one
+func (o *Org) MsgFrequencyCap() *MsgFrequencyCap { return o.msgFreqCap }
+
+// LinkTracking returns the link tracking config for this org if it has one
+func (o *Org) LinkTracking() *LinkTracking { return o.linkTracking }
+
+// WebhookSigning returns the webhook signing config for this org if it has one
+func (o *Org) WebhookSigning() *WebhookSigning { return o.webhookSign }
+
+// LanguageFallback returns the ordered languages to fall back along when localizing for this org, if it has them
+func (o *Org) LanguageFallback() LanguageFallback { return o.languageFallback }
+
+// LanguageDetection returns the language detection config for this org if it has it enabled
+func (o *Org) LanguageDetection() *LanguageDetection { return o.languageDetect }
+
+// AbuseDetection returns the abuse detection rules for incoming messages for this org if it has them
+func (o *Org) AbuseDetection() *AbuseDetection { return o.abuseDetection }
+
+// TicketRouting returns the rules for routing newly opened tickets for this org, if it has them
+func (o *Org) TicketRouting() *TicketRouting { return o.ticketRouting }
+
+// WhatsAppWindow returns what happens to free-form messages sent outside of the WhatsApp window for this org, if configured
+func (o *Org) WhatsAppWindow() *WhatsAppWindowConfig { return o.whatsAppWindow }
+
+// ChannelRouting returns how this org chooses between a contact's URNs when sending, if configured
+func (o *Org) ChannelRouting() *ChannelRouting { return o.channelRouting }
+
+// ContactImportSources returns the remote files which are regularly imported into this org
+func (o *Org) ContactImportSources() []*ContactImportSource { return o.importSources }
+
+// FHIRSync returns the config for syncing contacts with a FHIR server for this org, if it has it
+func (o *Org) FHIRSync() *FHIRSync { return o.fhirSync }
+
+// ContactImportApproval returns whether contact imports for this org are staged until they're explicitly approved
+func (o *Org) ContactImportApproval() bool {
+	approval, _ := o.o.Config.Get(configImportApproval, false).(bool)
+	return approval
+}
+
+// Region returns the region this org is pinned to, or empty if it can be handled in any region
+func (o *Org) Region() string { return o.ConfigValue(configRegion, "") }
+
+// IVRScreeningURL returns the URL of the hook which screens incoming calls for this org, if it has one
+func (o *Org) IVRScreeningURL() string { return o.ConfigValue(configIVRScreeningURL, "") }
+
+// MaxCallDuration returns the maximum duration of IVR calls for this org, or zero if calls aren't limited
+func (o *Org) MaxCallDuration() time.Duration {
+	secs, _ := strconv.Atoi(o.ConfigValue(configMaxCallDuration, "0"))
+	return time.Duration(secs) * time.Second
+}
+
+// QuietUntil returns when the org's quiet hours or holiday containing the given time ends, or nil if it isn't quiet
+func (o *Org) QuietUntil(now time.Time) *time.Time {
+	if o.quietHours == nil {
+		return nil
+	}
+	return o.quietHours.Until(now, o.Timezone())
+}
+
 // DateFormat returns the date format for this org
 func (o *Org) DateFormat() envs.DateFormat { return o.env.DateFormat() }
 
@@ -136,6 +255,98 @@ func (o *Org) UnmarshalJSON(b []byte) error {
 	if err != nil {
 		return err
 	}
+
+	// an invalid content policy fails the org loading rather than letting messages be sent without it
+	if cp := o.o.Config.Get(configContentPolicy, nil); cp != nil {
+		o.contentPolicy, err = readContentPolicyConfig(cp)
+		if err != nil {
+			return errors.Wrapf(err, "error reading content policy for org #%d", o.o.ID)
+		}
+	}
+	if ms := o.o.Config.Get(configMsgSampling, nil); ms != nil {
+		o.msgSampling, err = readMsgSamplingConfig(ms)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading message sampling config for org")
+		}
+	}
+	if qh := o.o.Config.Get(configQuietHours, nil); qh != nil {
+		o.quietHours, err = readQuietHoursConfig(qh)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading quiet hours config for org")
+		}
+	}
+	if fc := o.o.Config.Get(configMsgFrequencyCap, nil); fc != nil {
+		o.msgFreqCap, err = readMsgFrequencyCapConfig(fc)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading message frequency cap config for org")
+		}
+	}
+	if lt := o.o.Config.Get(configLinkTracking, nil); lt != nil {
+		o.linkTracking, err = readLinkTrackingConfig(lt)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading link tracking config for org")
+		}
+	}
+	if ws := o.o.Config.Get(configWebhookSigning, nil); ws != nil {
+		o.webhookSign, err = readWebhookSigningConfig(ws)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading webhook signing config for org")
+		}
+	}
+	if lf := o.o.Config.Get(configLanguageFallback, nil); lf != nil {
+		o.languageFallback, err = readLanguageFallbackConfig(lf)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading language fallback config for org")
+		}
+	}
+	if ld := o.o.Config.Get(configLanguageDetect, nil); ld != nil {
+		o.languageDetect, err = readLanguageDetectionConfig(ld)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading language detection config for org")
+		}
+	}
+	if ad := o.o.Config.Get(configAbuseDetection, nil); ad != nil {
+		o.abuseDetection, err = readAbuseDetectionConfig(ad)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading abuse detection config for org")
+		}
+	}
+	if tr := o.o.Config.Get(configTicketRouting, nil); tr != nil {
+		o.ticketRouting, err = readTicketRoutingConfig(tr)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading ticket routing config for org")
+		}
+	}
+	if ww := o.o.Config.Get(configWhatsAppWindow, nil); ww != nil {
+		o.whatsAppWindow, err = readWhatsAppWindowConfig(ww)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading whatsapp window config for org")
+		}
+	}
+	if cr := o.o.Config.Get(configChannelRouting, nil); cr != nil {
+		o.channelRouting, err = readChannelRoutingConfig(cr)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading channel routing config for org")
+		}
+	}
+	if is := o.o.Config.Get(configImportSources, nil); is != nil {
+		o.importSources, err = readContactImportSourcesConfig(is)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading contact import sources config for org")
+		}
+	}
+	if fs := o.o.Config.Get(configFHIRSync, nil); fs != nil {
+		o.fhirSync, err = readFHIRSyncConfig(fs)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading FHIR sync config for org")
+		}
+	}
+	if fe := o.o.Config.Get(configFieldEncryption, nil); fe != nil {
+		o.fieldEncryption, err = readFieldEncryptionConfig(fe)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.o.ID).Error("error reading field encryption config for org")
+		}
+	}
 	return nil
 }
 
@@ -156,6 +367,16 @@ func (o *Org) EmailService(c *runtime.Config, retries *smtpx.RetryConfig) (flows
 
 // AirtimeService returns the airtime service for this org if one is configured
 func (o *Org) AirtimeService(httpClient *http.Client, httpRetries *httpx.RetryConfig) (flows.AirtimeService, error) {
+	provider := o.ConfigValue(configAirtimeProvider, AirtimeProviderDTOne)
+
+	initFunc := airtimeServices[provider]
+	if initFunc == nil {
+		return nil, errors.Errorf("unrecognized airtime provider '%s' for org: %d", provider, o.ID())
+	}
+	return initFunc(o, httpClient, httpRetries)
+}
+
+func dtoneService(o *Org, httpClient *http.Client, httpRetries *httpx.RetryConfig) (flows.AirtimeService, error) {
 	key := o.ConfigValue(configDTOneKey, "")
 	secret := o.ConfigValue(configDTOneSecret, "")
 
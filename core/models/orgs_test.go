@@ -54,6 +54,12 @@ func TestOrgs(t *testing.T) {
 
 	_, err = models.LoadOrg(ctx, rt.Config, tx, 99)
 	assert.Error(t, err)
+
+	// an org with an invalid content policy fails to load rather than sending messages without it
+	tx.MustExec(`UPDATE orgs_org SET config = '{"content_policy": {"rules": [{"name": "x", "type": "words", "words": [""], "action": "block"}]}}' WHERE id = $1`, testdata.Org2.ID)
+
+	_, err = models.LoadOrg(ctx, rt.Config, tx, testdata.Org2.ID)
+	assert.ErrorContains(t, err, "content policy rule 'x' has an empty word")
 }
 
 func TestStoreAttachment(t *testing.T) {
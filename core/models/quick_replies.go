@@ -0,0 +1,132 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nyaruka/gocommon/urns"
+)
+
+// limits imposed by channels on quick replies
+const (
+	whatsAppMaxButtons     = 3
+	whatsAppMaxListRows    = 10
+	whatsAppMaxButtonTitle = 20
+	whatsAppMaxRowTitle    = 24
+	facebookMaxReplies     = 13
+	facebookMaxReplyTitle  = 20
+)
+
+// the text of the button which opens a WhatsApp list message
+const whatsAppListButton = "Menu"
+
+// renders the quick replies of an outgoing message into the structure used by a type of channel
+type quickReplyRenderer func(*Msg, []string)
+
+var quickReplyRenderers = map[ChannelType]quickReplyRenderer{
+	ChannelTypeWhatsApp:  renderWhatsAppInteractive,
+	ChannelTypeDialog360: renderWhatsAppInteractive,
+	ChannelTypeFacebook:  renderFacebookQuickReplies,
+	ChannelTypeInstagram: renderFacebookQuickReplies,
+	ChannelTypeTelegram:  renderTelegramKeyboard,
+}
+
+// converts the quick replies on this message into what its channel expects. Channels with their own renderer get
+// structured metadata, SMS channels get the replies as a numbered list in the text, and other channels are left with
+// plain quick replies.
+func (m *Msg) renderQuickReplies(channel *Channel, quickReplies []string) {
+	if channel == nil || len(quickReplies) == 0 || m.m.Status == MsgStatusFailed {
+		return
+	}
+
+	if render := quickReplyRenderers[channel.Type()]; render != nil {
+		render(m, quickReplies)
+	} else if m.m.URN.Scheme() == urns.TelScheme && !channel.SupportsRichContent() {
+		renderNumberedText(m, quickReplies)
+	}
+}
+
+// WhatsApp shows up to 3 short replies as buttons and up to 10 as a list, otherwise we fall back to numbered text
+func renderWhatsAppInteractive(m *Msg, quickReplies []string) {
+	if len(quickReplies) <= whatsAppMaxButtons && maxLength(quickReplies) <= whatsAppMaxButtonTitle {
+		buttons := make([]map[string]interface{}, len(quickReplies))
+		for i, qr := range quickReplies {
+			buttons[i] = map[string]interface{}{"id": fmt.Sprint(i), "title": qr}
+		}
+
+		m.setMetadataValue("interactive", map[string]interface{}{"type": "button", "buttons": buttons})
+		m.setMetadataValue("quick_replies", nil)
+
+	} else if len(quickReplies) <= whatsAppMaxListRows && maxLength(quickReplies) <= whatsAppMaxRowTitle {
+		rows := make([]map[string]interface{}, len(quickReplies))
+		for i, qr := range quickReplies {
+			rows[i] = map[string]interface{}{"id": fmt.Sprint(i), "title": qr}
+		}
+
+		m.setMetadataValue("interactive", map[string]interface{}{"type": "list", "button": whatsAppListButton, "sections": []map[string]interface{}{{"rows": rows}}})
+		m.setMetadataValue("quick_replies", nil)
+
+	} else {
+		renderNumberedText(m, quickReplies)
+	}
+}
+
+// Facebook and Instagram show up to 13 quick replies which are truncated to 20 characters
+func renderFacebookQuickReplies(m *Msg, quickReplies []string) {
+	if len(quickReplies) > facebookMaxReplies {
+		renderNumberedText(m, quickReplies)
+		return
+	}
+
+	replies := make([]map[string]interface{}, len(quickReplies))
+	for i, qr := range quickReplies {
+		replies[i] = map[string]interface{}{"content_type": "text", "title": truncate(qr, facebookMaxReplyTitle), "payload": qr}
+	}
+
+	m.setMetadataValue("quick_replies", nil)
+	m.setMetadataValue("facebook_quick_replies", replies)
+}
+
+// Telegram shows quick replies as a one-time reply keyboard with a button per row
+func renderTelegramKeyboard(m *Msg, quickReplies []string) {
+	keyboard := make([][]map[string]interface{}, len(quickReplies))
+	for i, qr := range quickReplies {
+		keyboard[i] = []map[string]interface{}{{"text": qr}}
+	}
+
+	m.setMetadataValue("quick_replies", nil)
+	m.setMetadataValue("reply_markup", map[string]interface{}{"keyboard": keyboard, "resize_keyboard": true, "one_time_keyboard": true})
+}
+
+// SMS can't show quick replies so they're added to the text as a numbered list
+func renderNumberedText(m *Msg, quickReplies []string) {
+	lines := make([]string, len(quickReplies))
+	for i, qr := range quickReplies {
+		lines[i] = fmt.Sprintf("%d. %s", i+1, qr)
+	}
+
+	text := strings.TrimRight(m.m.Text, "\n")
+	if text != "" {
+		text += "\n\n"
+	}
+	m.m.Text = text + strings.Join(lines, "\n")
+	m.setMetadataValue("quick_replies", nil)
+}
+
+func maxLength(ss []string) int {
+	max := 0
+	for _, s := range ss {
+		if n := len([]rune(s)); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+func truncate(s string, length int) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+	return string(runes[:length-1]) + "…"
+}
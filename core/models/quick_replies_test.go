@@ -0,0 +1,151 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderQuickReplies(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	whatsApp := testdata.InsertChannel(db, testdata.Org1, models.ChannelTypeWhatsApp, "WhatsApp", []string{"whatsapp"}, "SR", nil)
+	facebook := testdata.InsertChannel(db, testdata.Org1, models.ChannelTypeFacebook, "Facebook", []string{"facebook"}, "SR", nil)
+	telegram := testdata.InsertChannel(db, testdata.Org1, models.ChannelTypeTelegram, "Telegram", []string{"telegram"}, "SR", nil)
+	gsm7 := testdata.InsertChannel(db, testdata.Org1, models.ChannelType("T"), "GSM7", []string{"tel"}, "SR", map[string]interface{}{"transliterate": "true"})
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+
+	session := insertTestSession(t, ctx, rt, testdata.Org1, testdata.Cathy, testdata.Favorites)
+	flow, _ := oa.FlowByID(testdata.Favorites.ID)
+
+	long := []string{"One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine", "Ten", "Eleven", "Twelve", "Thirteen", "Fourteen"}
+
+	tcs := []struct {
+		channel          *testdata.Channel
+		urn              urns.URN
+		quickReplies     []string
+		expectedText     string
+		expectedMetadata map[string]interface{}
+	}{
+		{
+			channel:          testdata.TwilioChannel,
+			urn:              "tel:+250700000001",
+			quickReplies:     []string{"Yes", "No"},
+			expectedText:     "Pick one\n\n1. Yes\n2. No",
+			expectedMetadata: map[string]interface{}{},
+		},
+		{
+			channel:          gsm7,
+			urn:              "tel:+250700000001",
+			quickReplies:     []string{"Sí", "Não"},
+			expectedText:     "Pick one\n\n1. Si\n2. Nao", // numbered replies are transliterated too
+			expectedMetadata: map[string]interface{}{},
+		},
+		{
+			channel:          testdata.TwitterChannel,
+			urn:              "twitter:12345",
+			quickReplies:     []string{"Yes", "No"},
+			expectedText:     "Pick one",
+			expectedMetadata: map[string]interface{}{"quick_replies": []string{"Yes", "No"}},
+		},
+		{
+			channel:      whatsApp,
+			urn:          "whatsapp:250700000001",
+			quickReplies: []string{"Yes", "No"},
+			expectedText: "Pick one",
+			expectedMetadata: map[string]interface{}{
+				"interactive": map[string]interface{}{
+					"type": "button",
+					"buttons": []map[string]interface{}{
+						{"id": "0", "title": "Yes"},
+						{"id": "1", "title": "No"},
+					},
+				},
+			},
+		},
+		{
+			channel:      whatsApp,
+			urn:          "whatsapp:250700000001",
+			quickReplies: []string{"Red", "Green", "Blue", "Yellow"},
+			expectedText: "Pick one",
+			expectedMetadata: map[string]interface{}{
+				"interactive": map[string]interface{}{
+					"type":   "list",
+					"button": "Menu",
+					"sections": []map[string]interface{}{
+						{"rows": []map[string]interface{}{
+							{"id": "0", "title": "Red"},
+							{"id": "1", "title": "Green"},
+							{"id": "2", "title": "Blue"},
+							{"id": "3", "title": "Yellow"},
+						}},
+					},
+				},
+			},
+		},
+		{
+			channel:          whatsApp,
+			urn:              "whatsapp:250700000001",
+			quickReplies:     long[:11],
+			expectedText:     "Pick one\n\n1. One\n2. Two\n3. Three\n4. Four\n5. Five\n6. Six\n7. Seven\n8. Eight\n9. Nine\n10. Ten\n11. Eleven",
+			expectedMetadata: map[string]interface{}{},
+		},
+		{
+			channel:      facebook,
+			urn:          "facebook:12345",
+			quickReplies: []string{"Yes", "This is a very long answer"},
+			expectedText: "Pick one",
+			expectedMetadata: map[string]interface{}{
+				"facebook_quick_replies": []map[string]interface{}{
+					{"content_type": "text", "title": "Yes", "payload": "Yes"},
+					{"content_type": "text", "title": "This is a very long…", "payload": "This is a very long answer"},
+				},
+			},
+		},
+		{
+			channel:          facebook,
+			urn:              "facebook:12345",
+			quickReplies:     long,
+			expectedText:     "Pick one\n\n1. One\n2. Two\n3. Three\n4. Four\n5. Five\n6. Six\n7. Seven\n8. Eight\n9. Nine\n10. Ten\n11. Eleven\n12. Twelve\n13. Thirteen\n14. Fourteen",
+			expectedMetadata: map[string]interface{}{},
+		},
+		{
+			channel:      telegram,
+			urn:          "telegram:12345",
+			quickReplies: []string{"Yes", "No"},
+			expectedText: "Pick one",
+			expectedMetadata: map[string]interface{}{
+				"reply_markup": map[string]interface{}{
+					"keyboard":          [][]map[string]interface{}{{{"text": "Yes"}}, {{"text": "No"}}},
+					"resize_keyboard":   true,
+					"one_time_keyboard": true,
+				},
+			},
+		},
+	}
+
+	for i, tc := range tcs {
+		channel := oa.ChannelByID(tc.channel.ID)
+		urn := urns.URN(fmt.Sprintf("%s?id=%d", tc.urn, testdata.Cathy.URNID))
+
+		out := flows.NewMsgOut(urn, channel.ChannelReference(), "Pick one", nil, tc.quickReplies, nil, flows.NilMsgTopic, flows.NilUnsendableReason)
+		msg, err := models.NewOutgoingFlowMsg(rt, oa.Org(), channel, session, flow, out, time.Now())
+		require.NoError(t, err)
+
+		assert.Equal(t, tc.expectedText, msg.Text(), "%d: text mismatch", i)
+		assert.Equal(t, tc.expectedMetadata, msg.Metadata(), "%d: metadata mismatch", i)
+	}
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+)
+
+// the most days we'll look ahead for the end of a quiet period, e.g. when an org has a long run of holidays
+const quietHoursMaxDays = 60
+
+// QuietHours is an org's configuration for when non-urgent outgoing messages such as broadcasts and campaign
+// messages should be held rather than sent. Start and end are times of day in the org's timezone, and the period
+// can span midnight. Holidays are dates on which such messages are held all day.
+//
+//	{
+//	  "start": "21:00",
+//	  "end": "07:30",
+//	  "holidays": ["2022-12-25", "2023-01-01"]
+//	}
+type QuietHours struct {
+	Start    string   `json:"start"    validate:"required_with=End"`
+	End      string   `json:"end"      validate:"required_with=Start"`
+	Holidays []string `json:"holidays"`
+
+	start    int // minute of day
+	end      int // minute of day
+	holidays map[string]bool
+}
+
+// ReadQuietHours reads and validates quiet hours config from the given JSON
+func ReadQuietHours(data []byte) (*QuietHours, error) {
+	q := &QuietHours{}
+	if err := utils.UnmarshalAndValidate(data, q); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if q.start, err = minuteOfDay(q.Start); err != nil {
+		return nil, errors.Errorf("invalid start time '%s'", q.Start)
+	}
+	if q.end, err = minuteOfDay(q.End); err != nil {
+		return nil, errors.Errorf("invalid end time '%s'", q.End)
+	}
+
+	q.holidays = make(map[string]bool, len(q.Holidays))
+	for _, h := range q.Holidays {
+		if _, err := time.Parse("2006-01-02", h); err != nil {
+			return nil, errors.Errorf("invalid holiday date '%s'", h)
+		}
+		q.holidays[h] = true
+	}
+	return q, nil
+}
+
+// Until returns when the quiet period containing the given time ends in the given timezone, or nil if that time
+// isn't quiet
+func (q *QuietHours) Until(now time.Time, tz *time.Location) *time.Time {
+	now = now.In(tz)
+	until := now
+
+	// a quiet period can run into a holiday and vice versa so keep going until we find a time that isn't quiet
+	for i := 0; i < quietHoursMaxDays*2; i++ {
+		end := q.periodEnd(until)
+		if end == nil {
+			break
+		}
+		until = *end
+	}
+
+	if until.Equal(now) {
+		return nil
+	}
+	return &until
+}
+
+// returns the end of the quiet hours or holiday which contains the given time, or nil if it's not quiet
+func (q *QuietHours) periodEnd(t time.Time) *time.Time {
+	y, m, d := t.Date()
+
+	if q.holidays[t.Format("2006-01-02")] {
+		end := time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+		return &end
+	}
+
+	if q.start == q.end {
+		return nil
+	}
+
+	now := t.Hour()*60 + t.Minute()
+	endToday := time.Date(y, m, d, q.end/60, q.end%60, 0, 0, t.Location())
+
+	if q.start < q.end {
+		if now >= q.start && now < q.end {
+			return &endToday
+		}
+	} else {
+		// period spans midnight
+		if now < q.end {
+			return &endToday
+		} else if now >= q.start {
+			endTomorrow := time.Date(y, m, d+1, q.end/60, q.end%60, 0, 0, t.Location())
+			return &endTomorrow
+		}
+	}
+	return nil
+}
+
+func minuteOfDay(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func readQuietHoursConfig(v interface{}) (*QuietHours, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadQuietHours(data)
+}
+
+const markMessagesHeldSQL = `
+UPDATE
+	msgs_msg
+SET
+	status = 'P',
+	next_attempt = $2
+WHERE
+	id = ANY($1)`
+
+// MarkMessagesHeld marks the given outgoing messages as pending until the given time when they'll be released
+func MarkMessagesHeld(ctx context.Context, db Queryer, msgs []*Msg, until time.Time) error {
+	ids := make([]MsgID, len(msgs))
+	for i, m := range msgs {
+		m.m.Status = MsgStatusPending
+		m.m.NextAttempt = &until
+		ids[i] = MsgID(m.ID())
+	}
+
+	_, err := db.ExecContext(ctx, markMessagesHeldSQL, pq.Array(ids), until)
+	return errors.Wrap(err, "error marking messages as held")
+}
+
+var loadMessagesToReleaseSQL = `
+SELECT
+	m.id,
+	m.broadcast_id,
+	m.uuid,
+	m.text,
+	m.created_on,
+	m.direction,
+	m.status,
+	m.visibility,
+	m.msg_count,
+	m.error_count,
+	m.next_attempt,
+	m.failed_reason,
+	m.high_priority,
+	m.external_id,
+	m.attachments,
+	m.metadata,
+	m.channel_id,
+	m.contact_id,
+	m.contact_urn_id,
+	m.org_id,
+	u.identity AS "urn_urn",
+	u.auth AS "urn_auth"
+FROM
+	msgs_msg m
+INNER JOIN
+	contacts_contacturn u ON u.id = m.contact_urn_id
+INNER JOIN
+	channels_channel c ON c.id = m.channel_id
+WHERE
+	m.direction = 'O' AND
+	m.status = 'P' AND
+	m.next_attempt <= NOW() AND
+	c.is_active = TRUE
+ORDER BY
+	m.next_attempt ASC, m.created_on ASC
+LIMIT 5000`
+
+// GetMessagesToRelease gets the outgoing messages with an active channel which were held during quiet hours or deferred
+// by a frequency cap, and are now due to be sent
+func GetMessagesToRelease(ctx context.Context, db Queryer) ([]*Msg, error) {
+	return loadMessages(ctx, db, loadMessagesToReleaseSQL)
+}
+
+const releaseMessagesSQL = `
+UPDATE
+	msgs_msg
+SET
+	status = 'Q',
+	next_attempt = NULL
+WHERE
+	id = ANY($1)`
+
+// ReleaseHeldMessages marks the given held messages as queued. Only non-urgent messages are held so they're still
+// subject to quiet hours and frequency caps when they're sent.
+func ReleaseHeldMessages(ctx context.Context, db Queryer, msgs []*Msg) error {
+	ids := make([]MsgID, len(msgs))
+	for i, m := range msgs {
+		m.m.Status = MsgStatusQueued
+		m.m.NextAttempt = nil
+		m.nonUrgent = true
+		ids[i] = MsgID(m.ID())
+	}
+
+	_, err := db.ExecContext(ctx, releaseMessagesSQL, pq.Array(ids))
+	return errors.Wrap(err, "error releasing held messages")
+}
@@ -0,0 +1,64 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuietHours(t *testing.T) {
+	_, err := models.ReadQuietHours([]byte(`{"start": "21:00"}`))
+	assert.EqualError(t, err, "field 'end' failed tag 'required_with'")
+
+	_, err = models.ReadQuietHours([]byte(`{"start": "21:00", "end": "25:00"}`))
+	assert.EqualError(t, err, "invalid end time '25:00'")
+
+	_, err = models.ReadQuietHours([]byte(`{"holidays": ["25/12/2022"]}`))
+	assert.EqualError(t, err, "invalid holiday date '25/12/2022'")
+
+	kgl, _ := time.LoadLocation("Africa/Kigali")
+
+	overnight, err := models.ReadQuietHours([]byte(`{"start": "21:00", "end": "07:30", "holidays": ["2022-12-25", "2022-12-26"]}`))
+	require.NoError(t, err)
+
+	daytime, err := models.ReadQuietHours([]byte(`{"start": "12:00", "end": "14:00"}`))
+	require.NoError(t, err)
+
+	holidaysOnly, err := models.ReadQuietHours([]byte(`{"holidays": ["2022-12-25"]}`))
+	require.NoError(t, err)
+
+	tcs := []struct {
+		quietHours *models.QuietHours
+		now        time.Time
+		expected   *time.Time
+	}{
+		{overnight, time.Date(2022, 12, 20, 12, 0, 0, 0, kgl), nil},
+		{overnight, time.Date(2022, 12, 20, 20, 59, 0, 0, kgl), nil},
+		{overnight, time.Date(2022, 12, 20, 21, 0, 0, 0, kgl), ptime(time.Date(2022, 12, 21, 7, 30, 0, 0, kgl))},
+		{overnight, time.Date(2022, 12, 21, 3, 15, 0, 0, kgl), ptime(time.Date(2022, 12, 21, 7, 30, 0, 0, kgl))},
+		{overnight, time.Date(2022, 12, 21, 7, 30, 0, 0, kgl), nil},
+		{overnight, time.Date(2022, 12, 20, 19, 30, 0, 0, time.UTC), ptime(time.Date(2022, 12, 21, 7, 30, 0, 0, kgl))}, // 21:30 in Kigali
+		{overnight, time.Date(2022, 12, 24, 22, 0, 0, 0, kgl), ptime(time.Date(2022, 12, 27, 7, 30, 0, 0, kgl))},       // runs into holidays
+		{overnight, time.Date(2022, 12, 25, 12, 0, 0, 0, kgl), ptime(time.Date(2022, 12, 27, 7, 30, 0, 0, kgl))},
+		{daytime, time.Date(2022, 12, 20, 11, 59, 0, 0, kgl), nil},
+		{daytime, time.Date(2022, 12, 20, 13, 0, 0, 0, kgl), ptime(time.Date(2022, 12, 20, 14, 0, 0, 0, kgl))},
+		{daytime, time.Date(2022, 12, 20, 14, 0, 0, 0, kgl), nil},
+		{holidaysOnly, time.Date(2022, 12, 24, 23, 0, 0, 0, kgl), nil},
+		{holidaysOnly, time.Date(2022, 12, 25, 9, 0, 0, 0, kgl), ptime(time.Date(2022, 12, 26, 0, 0, 0, 0, kgl))},
+	}
+
+	for _, tc := range tcs {
+		actual := tc.quietHours.Until(tc.now, kgl)
+		if tc.expected == nil {
+			assert.Nil(t, actual, "expected nil for %s", tc.now)
+		} else if assert.NotNil(t, actual, "expected non-nil for %s", tc.now) {
+			assert.Equal(t, *tc.expected, *actual, "until mismatch for %s", tc.now)
+		}
+	}
+}
+
+func ptime(t time.Time) *time.Time { return &t }
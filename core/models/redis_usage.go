@@ -0,0 +1,101 @@
+package models
+
+import (
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+// hash of org id to that org's last calculated redis usage
+const orgRedisUsageKey = "org_redis_usage"
+
+// OrgIDForRedisKey returns the id of the org the given redis key belongs to, or NilOrgID if it isn't specific to an org
+func OrgIDForRedisKey(key string) OrgID {
+	return OrgID(orgkeys.OrgID(key))
+}
+
+// OrgRedisUsage is the number of redis keys which belong to an org and the memory they use
+type OrgRedisUsage struct {
+	Keys  int   `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// CalculateOrgRedisUsage scans the entire keyspace and returns the usage of each org which has keys
+func CalculateOrgRedisUsage(rc redis.Conn) (map[OrgID]*OrgRedisUsage, error) {
+	usages := make(map[OrgID]*OrgRedisUsage)
+	cursor := 0
+
+	for {
+		values, err := redis.Values(rc.Do("SCAN", cursor, "COUNT", 1000))
+		if err != nil {
+			return nil, errors.Wrap(err, "error scanning redis keys")
+		}
+		cursor, _ = redis.Int(values[0], nil)
+		keys, _ := redis.Strings(values[1], nil)
+
+		// pipeline the memory usage lookups for the org keys in this batch
+		orgIDs := make([]OrgID, 0, len(keys))
+		for _, key := range keys {
+			if orgID := OrgIDForRedisKey(key); orgID != NilOrgID {
+				rc.Send("MEMORY", "USAGE", key)
+				orgIDs = append(orgIDs, orgID)
+			}
+		}
+		if len(orgIDs) > 0 {
+			if err := rc.Flush(); err != nil {
+				return nil, errors.Wrap(err, "error getting redis memory usage")
+			}
+		}
+
+		for _, orgID := range orgIDs {
+			// keys can expire between being scanned and measured in which case usage is nil
+			bytes, err := redis.Int64(rc.Receive())
+			if err != nil && err != redis.ErrNil {
+				return nil, errors.Wrap(err, "error getting redis memory usage")
+			}
+
+			usage := usages[orgID]
+			if usage == nil {
+				usage = &OrgRedisUsage{}
+				usages[orgID] = usage
+			}
+			usage.Keys++
+			usage.Bytes += bytes
+		}
+
+		if cursor == 0 {
+			break
+		}
+	}
+
+	return usages, nil
+}
+
+// SetOrgRedisUsages replaces the recorded redis usage of all orgs
+func SetOrgRedisUsages(rc redis.Conn, usages map[OrgID]*OrgRedisUsage) error {
+	rc.Send("MULTI")
+	rc.Send("DEL", orgRedisUsageKey)
+	for orgID, usage := range usages {
+		rc.Send("HSET", orgRedisUsageKey, orgID, jsonx.MustMarshal(usage))
+	}
+	_, err := rc.Do("EXEC")
+	return errors.Wrap(err, "error recording org redis usage")
+}
+
+// GetOrgRedisUsage gets the last recorded redis usage of the given org
+func GetOrgRedisUsage(rc redis.Conn, orgID OrgID) (*OrgRedisUsage, error) {
+	usage := &OrgRedisUsage{}
+
+	data, err := redis.Bytes(rc.Do("HGET", orgRedisUsageKey, orgID))
+	if err == redis.ErrNil {
+		return usage, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting org redis usage")
+	}
+
+	if err := jsonx.Unmarshal(data, usage); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling org redis usage")
+	}
+	return usage, nil
+}
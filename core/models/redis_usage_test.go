@@ -0,0 +1,70 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+	_ "github.com/nyaruka/mailroom/core/tasks/handler" // registers contact queue keys
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOrgIDForRedisKey(t *testing.T) {
+	tcs := []struct {
+		key   string
+		orgID models.OrgID
+	}{
+		{"handler:1", 1},
+		{"batch:23", 23},
+		{"handler:active", models.NilOrgID},
+		{"c:1:10000", 1},
+		{"lock:c:2:10000", 2},
+		{"email_thread:4:8a3e1d2b-8a5c-4e7e-9d3a-d6e1f8c1f3a2:10000", 4},
+		{"msg_frequency:5:2022-10-16", 5},
+		{"msg_samples:6", 6},
+		{"msg_samples:orgs", models.NilOrgID},
+		{"urn_normalization:7", 7},
+		{"flow_funnel:8:2022-10-16", 8},
+		{"resthook_gone:9:new-registration:https://example.com/hook", 9},
+		{"paused_orgs", models.NilOrgID},
+		{"msg_repetitions:2022-10-16T12:05", models.NilOrgID},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.orgID, models.OrgIDForRedisKey(tc.key), "org id mismatch for key %s", tc.key)
+	}
+}
+
+func TestOrgRedisUsage(t *testing.T) {
+	_, rt, _, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc.Do("SET", "c:1:10000", "x")
+	rc.Do("SET", "lock:c:1:10000", "x")
+	rc.Do("SET", "msg_samples:2", "x")
+	rc.Do("SET", "paused_orgs", "x")
+
+	usages, err := models.CalculateOrgRedisUsage(rc)
+	require.NoError(t, err)
+	assert.Len(t, usages, 2)
+	assert.Equal(t, 2, usages[testdata.Org1.ID].Keys)
+	assert.Greater(t, usages[testdata.Org1.ID].Bytes, int64(0))
+	assert.Equal(t, 1, usages[testdata.Org2.ID].Keys)
+
+	err = models.SetOrgRedisUsages(rc, usages)
+	require.NoError(t, err)
+
+	usage, err := models.GetOrgRedisUsage(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, usages[testdata.Org1.ID], usage)
+
+	usage, err = models.GetOrgRedisUsage(rc, 12345)
+	require.NoError(t, err)
+	assert.Equal(t, &models.OrgRedisUsage{}, usage)
+}
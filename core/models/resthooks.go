@@ -2,10 +2,17 @@ package models
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
 	"time"
 
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/dbutil"
 	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -85,8 +92,8 @@ ORDER BY
 `
 
 // UnsubscribeResthooks unsubscribles all the resthooks passed in
-func UnsubscribeResthooks(ctx context.Context, tx *sqlx.Tx, unsubs []*ResthookUnsubscribe) error {
-	err := BulkQuery(ctx, "unsubscribing resthooks", tx, sqlUnsubscribeResthooks, unsubs)
+func UnsubscribeResthooks(ctx context.Context, db Queryer, unsubs []*ResthookUnsubscribe) error {
+	err := BulkQuery(ctx, "unsubscribing resthooks", db, sqlUnsubscribeResthooks, unsubs)
 	return errors.Wrapf(err, "error unsubscribing from resthooks")
 }
 
@@ -105,3 +112,148 @@ UPDATE api_resthooksubscriber
       JOIN api_resthook r ON s.resthook_id = r.id, (VALUES(:org_id, :slug, :url)) AS u(org_id, slug, url)
      WHERE s.is_active = TRUE AND r.org_id = u.org_id::int AND r.slug = u.slug AND s.target_url = u.url
 )`
+
+const configResthooksAsync = "resthooks_async"
+
+// ResthooksAsync returns whether this org's resthook events are delivered by a worker rather than during flow execution.
+// Flows then see every call to a resthook subscriber succeed with a 202 Accepted response, as they can't wait for the
+// real responses, so orgs shouldn't enable this if their flows route on the responses of resthook calls.
+func (o *Org) ResthooksAsync() bool {
+	return o.o.Config.Get(configResthooksAsync, false) == true
+}
+
+// DefersResthookCall returns whether the given request is a call to a resthook subscriber which should be deferred to
+// our delivery worker rather than made during flow execution
+func (a *OrgAssets) DefersResthookCall(r *http.Request) bool {
+	if !a.org.ResthooksAsync() || r.Method != http.MethodPost {
+		return false
+	}
+
+	for _, rh := range a.resthooks {
+		for _, url := range rh.Subscribers() {
+			if url == r.URL.String() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ResthookSubscriberID is our type for the database id of a resthook subscriber
+type ResthookSubscriberID int64
+
+// ResthookSubscriber is a target URL subscribed to a resthook
+type ResthookSubscriber struct {
+	ID        ResthookSubscriberID `json:"id"         db:"id"`
+	Resthook  string               `json:"resthook"   db:"resthook"`
+	URL       string               `json:"url"        db:"url"`
+	CreatedOn time.Time            `json:"created_on" db:"created_on"`
+}
+
+const sqlSelectResthookSubscribers = `
+SELECT s.id, r.slug AS resthook, s.target_url AS url, s.created_on
+  FROM api_resthooksubscriber s
+  JOIN api_resthook r ON r.id = s.resthook_id
+ WHERE r.org_id = $1 AND r.slug = $2 AND r.is_active = TRUE AND s.is_active = TRUE
+ORDER BY s.target_url`
+
+// LoadResthookSubscribers loads the active subscribers of the resthook with the given slug
+func LoadResthookSubscribers(ctx context.Context, db Queryer, orgID OrgID, slug string) ([]*ResthookSubscriber, error) {
+	subs := make([]*ResthookSubscriber, 0, 5)
+	if err := db.SelectContext(ctx, &subs, sqlSelectResthookSubscribers, orgID, slug); err != nil {
+		return nil, errors.Wrapf(err, "error loading subscribers for resthook '%s'", slug)
+	}
+	return subs, nil
+}
+
+const sqlInsertResthook = `
+INSERT INTO api_resthook(is_active, slug, org_id, created_on, modified_on, created_by_id, modified_by_id)
+     SELECT TRUE, $2, $1, NOW(), NOW(), $3, $3
+      WHERE NOT EXISTS (SELECT 1 FROM api_resthook WHERE org_id = $1 AND slug = $2)`
+
+const sqlActivateResthook = `
+UPDATE api_resthook SET is_active = TRUE, modified_on = NOW(), modified_by_id = $3
+ WHERE org_id = $1 AND slug = $2 AND is_active = FALSE`
+
+const sqlInsertResthookSubscriber = `
+INSERT INTO api_resthooksubscriber(is_active, target_url, resthook_id, created_on, modified_on, created_by_id, modified_by_id)
+     SELECT TRUE, $3, r.id, $5, $5, $4, $4
+       FROM api_resthook r
+      WHERE r.org_id = $1 AND r.slug = $2 AND r.is_active = TRUE AND NOT EXISTS (
+          SELECT 1 FROM api_resthooksubscriber s WHERE s.resthook_id = r.id AND s.target_url = $3 AND s.is_active = TRUE
+      )`
+
+// SubscribeResthook subscribes the given URL to the resthook with the given slug, creating or reactivating the resthook
+// if need be. Subscribing a URL which is already subscribed is a noop.
+func SubscribeResthook(ctx context.Context, db Queryer, orgID OrgID, userID UserID, slug, url string) (*ResthookSubscriber, error) {
+	if _, err := db.ExecContext(ctx, sqlInsertResthook, orgID, slug, userID); err != nil {
+		return nil, errors.Wrapf(err, "error creating resthook '%s'", slug)
+	}
+	if _, err := db.ExecContext(ctx, sqlActivateResthook, orgID, slug, userID); err != nil {
+		return nil, errors.Wrapf(err, "error activating resthook '%s'", slug)
+	}
+	if _, err := db.ExecContext(ctx, sqlInsertResthookSubscriber, orgID, slug, url, userID, dates.Now()); err != nil {
+		return nil, errors.Wrapf(err, "error subscribing to resthook '%s'", slug)
+	}
+
+	subs, err := LoadResthookSubscribers(ctx, db, orgID, slug)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subs {
+		if s.URL == url {
+			return s, nil
+		}
+	}
+	return nil, errors.Errorf("no active resthook with slug '%s'", slug)
+}
+
+// ResthookDelivery is an event to be delivered to the current subscribers of a resthook. Deliveries which are being
+// retried are only delivered to the subscriber which they failed for.
+type ResthookDelivery struct {
+	Resthook  string          `json:"resthook"           validate:"required"`
+	Payload   json.RawMessage `json:"payload"            validate:"required"`
+	CreatedOn time.Time       `json:"created_on"`
+	URL       string          `json:"url,omitempty"`
+	Attempts  int             `json:"attempts,omitempty"`
+}
+
+// a subscriber is unsubscribed after this many consecutive deliveries get a 410 response
+const resthookGoneLimit = 3
+
+// consecutive 410s are forgotten if a subscriber doesn't get another for this long
+const resthookGoneExpiry = time.Hour * 24 * 7
+
+var resthookGoneKeys = orgkeys.Register("resthook_gone:%d:%s:%s")
+
+func resthookGoneKey(orgID OrgID, slug, url string) string {
+	hash := md5.Sum([]byte(url))
+	return resthookGoneKeys.Key(int(orgID), slug, hex.EncodeToString(hash[:]))
+}
+
+// RecordResthookGone records that a delivery to the given subscriber got a 410 response, and returns whether that has
+// now happened enough consecutive times that the subscriber should be unsubscribed
+func RecordResthookGone(rc redis.Conn, orgID OrgID, slug, url string) (bool, error) {
+	key := resthookGoneKey(orgID, slug, url)
+
+	rc.Send("MULTI")
+	rc.Send("INCR", key)
+	rc.Send("EXPIRE", key, int(resthookGoneExpiry/time.Second))
+	replies, err := redis.Values(rc.Do("EXEC"))
+	if err != nil {
+		return false, errors.Wrap(err, "error recording resthook 410")
+	}
+
+	count, _ := redis.Int(replies[0], nil)
+	if count >= resthookGoneLimit {
+		_, err := rc.Do("DEL", key)
+		return true, err
+	}
+	return false, nil
+}
+
+// ClearResthookGone clears any consecutive 410s recorded for the given subscriber after a successful delivery
+func ClearResthookGone(rc redis.Conn, orgID OrgID, slug, url string) error {
+	_, err := rc.Do("DEL", resthookGoneKey(orgID, slug, url))
+	return err
+}
@@ -45,3 +45,58 @@ func TestResthooks(t *testing.T) {
 		assert.Equal(t, tc.Subscribers, resthook.Subscribers())
 	}
 }
+
+func TestSubscribeResthook(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	sub, err := models.SubscribeResthook(ctx, db, testdata.Org1.ID, testdata.Admin.ID, "registration", "https://foo.bar/1")
+	require.NoError(t, err)
+	assert.Equal(t, "registration", sub.Resthook)
+	assert.Equal(t, "https://foo.bar/1", sub.URL)
+
+	// subscribing again is a noop
+	sub2, err := models.SubscribeResthook(ctx, db, testdata.Org1.ID, testdata.Admin.ID, "registration", "https://foo.bar/1")
+	require.NoError(t, err)
+	assert.Equal(t, sub.ID, sub2.ID)
+
+	_, err = models.SubscribeResthook(ctx, db, testdata.Org1.ID, testdata.Admin.ID, "registration", "https://foo.bar/2")
+	require.NoError(t, err)
+
+	subs, err := models.LoadResthookSubscribers(ctx, db, testdata.Org1.ID, "registration")
+	require.NoError(t, err)
+	assert.Len(t, subs, 2)
+
+	err = models.UnsubscribeResthooks(ctx, db, []*models.ResthookUnsubscribe{{OrgID: testdata.Org1.ID, Slug: "registration", URL: "https://foo.bar/1"}})
+	require.NoError(t, err)
+
+	subs, err = models.LoadResthookSubscribers(ctx, db, testdata.Org1.ID, "registration")
+	require.NoError(t, err)
+	assert.Len(t, subs, 1)
+	assert.Equal(t, "https://foo.bar/2", subs[0].URL)
+
+	// resthooks are per org
+	subs, err = models.LoadResthookSubscribers(ctx, db, testdata.Org2.ID, "registration")
+	require.NoError(t, err)
+	assert.Len(t, subs, 0)
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	// subscribers are only considered gone after repeated 410s
+	for i := 0; i < 2; i++ {
+		gone, err := models.RecordResthookGone(rc, testdata.Org1.ID, "registration", "https://foo.bar/2")
+		require.NoError(t, err)
+		assert.False(t, gone)
+	}
+
+	// and a successful delivery resets the count
+	require.NoError(t, models.ClearResthookGone(rc, testdata.Org1.ID, "registration", "https://foo.bar/2"))
+
+	for i := 0; i < 3; i++ {
+		gone, err := models.RecordResthookGone(rc, testdata.Org1.ID, "registration", "https://foo.bar/2")
+		require.NoError(t, err)
+		assert.Equal(t, i == 2, gone)
+	}
+}
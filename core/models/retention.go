@@ -0,0 +1,171 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+)
+
+const (
+	// number of rows we change in each statement so that we never hold locks on too many rows at once
+	retentionBatchSize = 1000
+
+	// max number of batches of each type we process per org per run, anything left is picked up by the next run
+	retentionMaxBatches = 100
+)
+
+// RetentionPolicy is an org's configuration for how long data is kept, where each value is a number of days and zero
+// means that type of data is kept forever.
+//
+//	{
+//	  "msg_bodies": 90,
+//	  "runs": 365,
+//	  "sessions": 30
+//	}
+type RetentionPolicy struct {
+	MsgBodies int `json:"msg_bodies" validate:"gte=0"`
+	Runs      int `json:"runs"       validate:"gte=0"`
+	Sessions  int `json:"sessions"   validate:"gte=0"`
+}
+
+// ReadRetentionPolicy reads and validates a retention policy from the given JSON
+func ReadRetentionPolicy(data []byte) (*RetentionPolicy, error) {
+	p := &RetentionPolicy{}
+	if err := utils.UnmarshalAndValidate(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// RetentionReport is the number of things changed by applying an org's retention policy
+type RetentionReport struct {
+	MsgBodiesCleared int `json:"msg_bodies_cleared"`
+	RunsDeleted      int `json:"runs_deleted"`
+	SessionsDeleted  int `json:"sessions_deleted"`
+}
+
+// OrgRetentionPolicy is an org with a retention policy configured
+type OrgRetentionPolicy struct {
+	OrgID  OrgID           `db:"id"`
+	Policy json.RawMessage `db:"policy"`
+}
+
+const sqlSelectOrgRetentionPolicies = `
+SELECT id, (config::json)->'retention_policy' AS policy
+  FROM orgs_org
+ WHERE is_active = TRUE AND (config::json)->'retention_policy' IS NOT NULL
+ORDER BY id`
+
+// LoadOrgRetentionPolicies loads the unparsed retention policies of all active orgs which have one
+func LoadOrgRetentionPolicies(ctx context.Context, db Queryer) ([]*OrgRetentionPolicy, error) {
+	policies := make([]*OrgRetentionPolicy, 0, 10)
+	if err := db.SelectContext(ctx, &policies, sqlSelectOrgRetentionPolicies); err != nil {
+		return nil, errors.Wrap(err, "error loading org retention policies")
+	}
+	return policies, nil
+}
+
+// only messages in a final state are cleared, as anything else might still be sent or handled
+const sqlClearMsgBodies = `
+UPDATE msgs_msg SET text = '', attachments = NULL, modified_on = NOW()
+ WHERE id IN (
+    SELECT id FROM msgs_msg
+     WHERE org_id = $1 AND created_on < $2 AND status IN ('W', 'S', 'D', 'H', 'F') AND (text != '' OR attachments IS NOT NULL)
+     LIMIT $3
+)`
+
+// runs which are deleted from results have been deleted by a user and are left to RapidPro, otherwise deleting a
+// run doesn't change flow results
+const sqlDeleteRuns = `
+DELETE FROM flows_flowrun
+ WHERE id IN (
+    SELECT id FROM flows_flowrun
+     WHERE org_id = $1 AND status IN ('C', 'X', 'I', 'F') AND exited_on < $2 AND delete_from_results IS NOT TRUE
+     LIMIT $3
+)`
+
+const sqlSelectSessionsToDelete = `
+SELECT id FROM flows_flowsession
+ WHERE org_id = $1 AND status != 'W' AND ended_on < $2
+ LIMIT $3`
+
+// ApplyRetentionPolicy clears or deletes the given org's data which is older than its retention policy allows, in
+// batches so that large orgs don't block other activity
+func ApplyRetentionPolicy(ctx context.Context, db Queryer, orgID OrgID, policy *RetentionPolicy, now time.Time) (*RetentionReport, error) {
+	report := &RetentionReport{}
+	var err error
+
+	if policy.MsgBodies > 0 {
+		report.MsgBodiesCleared, err = execRetentionBatches(ctx, db, sqlClearMsgBodies, orgID, retentionCutoff(now, policy.MsgBodies))
+		if err != nil {
+			return nil, errors.Wrap(err, "error clearing message bodies")
+		}
+	}
+	if policy.Runs > 0 {
+		report.RunsDeleted, err = execRetentionBatches(ctx, db, sqlDeleteRuns, orgID, retentionCutoff(now, policy.Runs))
+		if err != nil {
+			return nil, errors.Wrap(err, "error deleting runs")
+		}
+	}
+	if policy.Sessions > 0 {
+		report.SessionsDeleted, err = deleteOldSessions(ctx, db, orgID, retentionCutoff(now, policy.Sessions))
+		if err != nil {
+			return nil, errors.Wrap(err, "error deleting sessions")
+		}
+	}
+
+	return report, nil
+}
+
+func retentionCutoff(now time.Time, days int) time.Time {
+	return now.Add(-time.Duration(days) * time.Hour * 24)
+}
+
+// executes the given batch statement until it no longer affects any rows, returning the total affected
+func execRetentionBatches(ctx context.Context, db Queryer, sql string, orgID OrgID, before time.Time) (int, error) {
+	total := 0
+	for i := 0; i < retentionMaxBatches; i++ {
+		res, err := db.ExecContext(ctx, sql, orgID, before, retentionBatchSize)
+		if err != nil {
+			return total, err
+		}
+		affected, _ := res.RowsAffected()
+		total += int(affected)
+
+		if affected < retentionBatchSize {
+			break
+		}
+	}
+	return total, nil
+}
+
+// deletes ended sessions, detaching any remaining runs from them first since runs might be kept for longer
+func deleteOldSessions(ctx context.Context, db Queryer, orgID OrgID, before time.Time) (int, error) {
+	total := 0
+	for i := 0; i < retentionMaxBatches; i++ {
+		ids := make([]SessionID, 0, retentionBatchSize)
+		if err := db.SelectContext(ctx, &ids, sqlSelectSessionsToDelete, orgID, before, retentionBatchSize); err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		if _, err := db.ExecContext(ctx, `UPDATE flows_flowrun SET session_id = NULL WHERE session_id = ANY($1)`, pq.Array(ids)); err != nil {
+			return total, err
+		}
+		if _, err := db.ExecContext(ctx, `DELETE FROM flows_flowsession WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+			return total, err
+		}
+		total += len(ids)
+
+		if len(ids) < retentionBatchSize {
+			break
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,67 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadRetentionPolicy(t *testing.T) {
+	_, err := models.ReadRetentionPolicy([]byte(`{"msg_bodies": -1}`))
+	assert.EqualError(t, err, "field 'msg_bodies' must be greater than or equal to 0")
+
+	policy, err := models.ReadRetentionPolicy([]byte(`{"msg_bodies": 90, "runs": 365}`))
+	assert.NoError(t, err)
+	assert.Equal(t, &models.RetentionPolicy{MsgBodies: 90, Runs: 365}, policy)
+}
+
+func TestApplyRetentionPolicy(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	oldIn := testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "old", models.MsgStatusHandled)
+	oldPending := testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "old but pending", models.MsgStatusPending)
+	newIn := testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "new", models.MsgStatusHandled)
+	otherOrg := testdata.InsertIncomingMsg(db, testdata.Org2, testdata.Org2Channel, testdata.Org2Contact, "other org", models.MsgStatusHandled)
+	db.MustExec(`UPDATE msgs_msg SET created_on = NOW() - INTERVAL '100 days' WHERE id = ANY(ARRAY[$1, $2, $3]::bigint[])`, oldIn.ID(), oldPending.ID(), otherOrg.ID())
+
+	oldSessionID := testdata.InsertFlowSession(db, testdata.Org1, testdata.Cathy, models.FlowTypeMessaging, models.SessionStatusCompleted, testdata.Favorites, models.NilCallID)
+	oldRunID := testdata.InsertFlowRun(db, testdata.Org1, oldSessionID, testdata.Cathy, testdata.Favorites, models.RunStatusCompleted)
+	waitingSessionID := testdata.InsertFlowSession(db, testdata.Org1, testdata.Bob, models.FlowTypeMessaging, models.SessionStatusWaiting, testdata.Favorites, models.NilCallID)
+	waitingRunID := testdata.InsertFlowRun(db, testdata.Org1, waitingSessionID, testdata.Bob, testdata.Favorites, models.RunStatusWaiting)
+	newSessionID := testdata.InsertFlowSession(db, testdata.Org1, testdata.George, models.FlowTypeMessaging, models.SessionStatusCompleted, testdata.Favorites, models.NilCallID)
+	newRunID := testdata.InsertFlowRun(db, testdata.Org1, newSessionID, testdata.George, testdata.Favorites, models.RunStatusCompleted)
+	db.MustExec(`UPDATE flows_flowsession SET created_on = NOW() - INTERVAL '400 days', ended_on = NOW() - INTERVAL '400 days' WHERE id = $1`, oldSessionID)
+	db.MustExec(`UPDATE flows_flowrun SET exited_on = NOW() - INTERVAL '400 days' WHERE id = $1`, oldRunID)
+
+	// a policy with nothing to retain does nothing
+	report, err := models.ApplyRetentionPolicy(ctx, db, testdata.Org1.ID, &models.RetentionPolicy{}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, &models.RetentionReport{}, report)
+
+	// sessions are kept for less time than runs, so old runs lose their session first
+	report, err = models.ApplyRetentionPolicy(ctx, db, testdata.Org1.ID, &models.RetentionPolicy{MsgBodies: 90, Sessions: 30}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, &models.RetentionReport{MsgBodiesCleared: 1, SessionsDeleted: 1}, report)
+
+	assertdb.Query(t, db, `SELECT text FROM msgs_msg WHERE id = $1`, oldIn.ID()).Returns("")
+	assertdb.Query(t, db, `SELECT text FROM msgs_msg WHERE id = $1`, oldPending.ID()).Returns("old but pending")
+	assertdb.Query(t, db, `SELECT text FROM msgs_msg WHERE id = $1`, newIn.ID()).Returns("new")
+	assertdb.Query(t, db, `SELECT text FROM msgs_msg WHERE id = $1`, otherOrg.ID()).Returns("other org")
+	assertdb.Query(t, db, `SELECT id FROM flows_flowsession WHERE org_id = $1 ORDER BY id`, testdata.Org1.ID).Columns(map[string]interface{}{"id": []interface{}{int64(waitingSessionID), int64(newSessionID)}})
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrun WHERE id = $1 AND session_id IS NULL`, oldRunID).Returns(1)
+
+	report, err = models.ApplyRetentionPolicy(ctx, db, testdata.Org1.ID, &models.RetentionPolicy{MsgBodies: 90, Runs: 365, Sessions: 30}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, &models.RetentionReport{RunsDeleted: 1}, report)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrun WHERE id = $1`, oldRunID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrun WHERE id = ANY(ARRAY[$1, $2]::bigint[])`, waitingRunID, newRunID).Returns(2)
+}
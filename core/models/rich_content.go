@@ -0,0 +1,138 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/utils"
+)
+
+// the most cards that can be shown in a carousel and the most suggestions that can be shown with a message
+const (
+	richCarouselMaxCards = 10
+	richMaxSuggestions   = 11
+)
+
+// splits message text into sections for each card
+var richSectionRegex = regexp.MustCompile(`\n\s*\n`)
+
+// SuggestionType is the type of a suggestion chip
+type SuggestionType string
+
+const (
+	SuggestionTypeReply   = SuggestionType("reply")
+	SuggestionTypeOpenURL = SuggestionType("open_url")
+)
+
+// Suggestion is a suggestion chip shown with a rich message, which either sends its text back as a reply or opens a URL
+type Suggestion struct {
+	Type SuggestionType `json:"type"`
+	Text string         `json:"text"`
+	URL  string         `json:"url,omitempty"`
+}
+
+// RichCard is a card with a media attachment and optional title and description
+type RichCard struct {
+	Title       string           `json:"title,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Media       utils.Attachment `json:"media"`
+}
+
+// RichContent is how an outgoing message should be displayed by a channel which supports RCS. It's saved on the
+// message metadata alongside the plain text, attachments and quick replies which other channels continue to use.
+//
+//	{
+//	  "cards": [{"title": "Red Shoes", "description": "Only $20", "media": "image/jpeg:https://..."}],
+//	  "suggestions": [{"type": "reply", "text": "Buy"}, {"type": "open_url", "text": "https://...", "url": "https://..."}]
+//	}
+type RichContent struct {
+	Cards       []*RichCard   `json:"cards,omitempty"`
+	Suggestions []*Suggestion `json:"suggestions,omitempty"`
+}
+
+// IsCarousel returns whether this content should be displayed as a carousel of cards
+func (c *RichContent) IsCarousel() bool { return len(c.Cards) > 1 }
+
+// NewRichContent builds rich content from the given message text, attachments and quick replies. Each image or video
+// attachment becomes a card, and the text is split into sections separated by blank lines which are used in order for
+// the cards. The first line of a section is the card's title if the section has more than one line. Quick replies
+// become suggestion chips, with those which are URLs opening that URL. Returns nil if the message has nothing which
+// would be displayed differently to plain text.
+func NewRichContent(text string, attachments []utils.Attachment, quickReplies []string) *RichContent {
+	content := &RichContent{}
+
+	for _, a := range attachments {
+		if len(content.Cards) == richCarouselMaxCards {
+			break
+		}
+		if strings.HasPrefix(a.ContentType(), "image/") || strings.HasPrefix(a.ContentType(), "video/") {
+			content.Cards = append(content.Cards, &RichCard{Media: a})
+		}
+	}
+
+	if len(content.Cards) > 0 {
+		sections := make([]string, 0)
+		for _, s := range richSectionRegex.Split(strings.TrimSpace(text), -1) {
+			if s = strings.TrimSpace(s); s != "" {
+				sections = append(sections, s)
+			}
+		}
+
+		// any sections beyond the number of cards are added to the last card
+		if len(sections) > len(content.Cards) {
+			n := len(content.Cards)
+			sections = append(sections[:n-1], strings.Join(sections[n-1:], "\n\n"))
+		}
+
+		for i, s := range sections {
+			card := content.Cards[i]
+			lines := strings.SplitN(s, "\n", 2)
+			if len(lines) == 2 {
+				card.Title, card.Description = strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1])
+			} else {
+				card.Description = s
+			}
+		}
+	}
+
+	for _, qr := range quickReplies {
+		if len(content.Suggestions) == richMaxSuggestions {
+			break
+		}
+		if linkURLRegex.FindString(qr) == qr {
+			content.Suggestions = append(content.Suggestions, &Suggestion{Type: SuggestionTypeOpenURL, Text: qr, URL: qr})
+		} else {
+			content.Suggestions = append(content.Suggestions, &Suggestion{Type: SuggestionTypeReply, Text: qr})
+		}
+	}
+
+	if len(content.Cards) == 0 && len(content.Suggestions) == 0 {
+		return nil
+	}
+	return content
+}
+
+// SupportsRichContent returns whether this channel can send RCS rich cards and suggestions
+func (c *Channel) SupportsRichContent() bool {
+	return c.ConfigValue(ChannelConfigRCS, "false") == "true"
+}
+
+// adds rich content to this message if it's being sent to a phone by a channel that supports it
+func (m *Msg) applyRichContent(channel *Channel, quickReplies []string) {
+	if channel == nil || !channel.SupportsRichContent() || m.m.URN.Scheme() != urns.TelScheme || m.m.Status == MsgStatusFailed {
+		return
+	}
+
+	attachments := make([]utils.Attachment, len(m.m.Attachments))
+	for i, a := range m.m.Attachments {
+		attachments[i] = utils.Attachment(a)
+	}
+
+	content := NewRichContent(m.m.Text, attachments, quickReplies)
+	if content == nil {
+		return
+	}
+
+	m.setMetadataValue("rcs", content)
+}
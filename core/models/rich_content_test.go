@@ -0,0 +1,84 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRichContent(t *testing.T) {
+	tcs := []struct {
+		text         string
+		attachments  []utils.Attachment
+		quickReplies []string
+		content      *models.RichContent
+	}{
+		{
+			text:    "Hello",
+			content: nil,
+		},
+		{
+			text:        "Hello",
+			attachments: []utils.Attachment{"audio/mp3:https://example.com/hello.mp3"},
+			content:     nil,
+		},
+		{
+			text:        "Hello",
+			attachments: []utils.Attachment{"image/jpeg:https://example.com/hello.jpg"},
+			content: &models.RichContent{
+				Cards: []*models.RichCard{{Description: "Hello", Media: "image/jpeg:https://example.com/hello.jpg"}},
+			},
+		},
+		{
+			text:         "Red Shoes\nOnly $20",
+			attachments:  []utils.Attachment{"image/jpeg:https://example.com/red.jpg"},
+			quickReplies: []string{"Buy", "https://example.com/shoes"},
+			content: &models.RichContent{
+				Cards: []*models.RichCard{{Title: "Red Shoes", Description: "Only $20", Media: "image/jpeg:https://example.com/red.jpg"}},
+				Suggestions: []*models.Suggestion{
+					{Type: models.SuggestionTypeReply, Text: "Buy"},
+					{Type: models.SuggestionTypeOpenURL, Text: "https://example.com/shoes", URL: "https://example.com/shoes"},
+				},
+			},
+		},
+		{
+			text:        "Red Shoes\nOnly $20\n\nBlue Shoes\nOnly $30\n\nWhile stocks last!",
+			attachments: []utils.Attachment{"image/jpeg:https://example.com/red.jpg", "video/mp4:https://example.com/blue.mp4", "image/png:https://example.com/green.png"},
+			content: &models.RichContent{
+				Cards: []*models.RichCard{
+					{Title: "Red Shoes", Description: "Only $20", Media: "image/jpeg:https://example.com/red.jpg"},
+					{Title: "Blue Shoes", Description: "Only $30", Media: "video/mp4:https://example.com/blue.mp4"},
+					{Description: "While stocks last!", Media: "image/png:https://example.com/green.png"},
+				},
+			},
+		},
+		{
+			text:        "Red Shoes\nOnly $20\n\nBlue Shoes\nOnly $30\n\nWhile stocks last!",
+			attachments: []utils.Attachment{"image/jpeg:https://example.com/red.jpg", "image/jpeg:https://example.com/blue.jpg"},
+			content: &models.RichContent{
+				Cards: []*models.RichCard{
+					{Title: "Red Shoes", Description: "Only $20", Media: "image/jpeg:https://example.com/red.jpg"},
+					{Title: "Blue Shoes", Description: "Only $30\n\nWhile stocks last!", Media: "image/jpeg:https://example.com/blue.jpg"},
+				},
+			},
+		},
+		{
+			text:         "Pick one",
+			quickReplies: []string{"Yes", "No"},
+			content: &models.RichContent{
+				Suggestions: []*models.Suggestion{{Type: models.SuggestionTypeReply, Text: "Yes"}, {Type: models.SuggestionTypeReply, Text: "No"}},
+			},
+		},
+	}
+
+	for _, tc := range tcs {
+		content := models.NewRichContent(tc.text, tc.attachments, tc.quickReplies)
+		assert.Equal(t, tc.content, content, "rich content mismatch for text '%s'", tc.text)
+	}
+
+	content := models.NewRichContent("", []utils.Attachment{"image/jpeg:https://example.com/1.jpg", "image/jpeg:https://example.com/2.jpg"}, nil)
+	assert.True(t, content.IsCarousel())
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/mailroom/utils/trace"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 )
@@ -72,16 +73,19 @@ type FlowRun struct {
 		OrgID           OrgID           `db:"org_id"`
 		SessionID       SessionID       `db:"session_id"`
 		StartID         StartID         `db:"start_id"`
+		TraceID         trace.ID        `db:"trace_id"`
+		Metadata        null.Map        `db:"metadata"`
 	}
 
 	// we keep a reference to the engine's run
 	run flows.Run
 }
 
-func (r *FlowRun) SetSessionID(sessionID SessionID) { r.r.SessionID = sessionID }
-func (r *FlowRun) SetStartID(startID StartID)       { r.r.StartID = startID }
-func (r *FlowRun) UUID() flows.RunUUID              { return r.r.UUID }
-func (r *FlowRun) ModifiedOn() time.Time            { return r.r.ModifiedOn }
+func (r *FlowRun) SetSessionID(sessionID SessionID)     { r.r.SessionID = sessionID }
+func (r *FlowRun) SetStartID(startID StartID)           { r.r.StartID = startID }
+func (r *FlowRun) SetMetadata(m map[string]interface{}) { r.r.Metadata = null.NewMap(m) }
+func (r *FlowRun) UUID() flows.RunUUID                  { return r.r.UUID }
+func (r *FlowRun) ModifiedOn() time.Time                { return r.r.ModifiedOn }
 
 // MarshalJSON is our custom marshaller so that our inner struct get output
 func (r *FlowRun) MarshalJSON() ([]byte, error) {
@@ -104,9 +108,9 @@ type Step struct {
 const sqlInsertRun = `
 INSERT INTO
 flows_flowrun(uuid, created_on, modified_on, exited_on, status, responded, results, path, 
-	          current_node_uuid, contact_id, flow_id, org_id, session_id, start_id)
+	          current_node_uuid, contact_id, flow_id, org_id, session_id, start_id, trace_id, metadata)
 	   VALUES(:uuid, :created_on, NOW(), :exited_on, :status, :responded, :results, :path,
-	          :current_node_uuid, :contact_id, :flow_id, :org_id, :session_id, :start_id)
+	          :current_node_uuid, :contact_id, :flow_id, :org_id, :session_id, :start_id, :trace_id, :metadata)
 RETURNING id
 `
 
@@ -141,7 +145,8 @@ func newRun(ctx context.Context, tx *sqlx.Tx, oa *OrgAssets, session *Session, f
 	r.StartID = NilStartID
 	r.OrgID = oa.OrgID()
 	r.Path = string(jsonx.MustMarshal(path))
-	r.Results = string(jsonx.MustMarshal(fr.Results()))
+	r.Results = string(jsonx.MustMarshal(runResults(oa, fr)))
+	r.TraceID = trace.FromContext(ctx)
 
 	if len(path) > 0 {
 		r.CurrentNodeUUID = null.String(path[len(path)-1].NodeUUID)
@@ -159,6 +164,40 @@ func newRun(ctx context.Context, tx *sqlx.Tx, oa *OrgAssets, session *Session, f
 	return run, nil
 }
 
+// returns the results to save for the given run, which are its own results plus any results which its flow imports
+// from the runs of flows it has entered. If the run and a child run both have a result with the same key, the most
+// recently created one is saved.
+func runResults(oa *OrgAssets, fr flows.Run) flows.Results {
+	flow, _ := oa.FlowByUUID(fr.FlowReference().UUID)
+	if flow == nil {
+		return fr.Results()
+	}
+
+	keys := flow.(*Flow).ChildResults()
+	if len(keys) == 0 {
+		return fr.Results()
+	}
+
+	results := fr.Results().Clone()
+
+	for _, child := range fr.Session().Runs() {
+		if child.Parent() == nil || child.Parent().UUID() != fr.UUID() {
+			continue
+		}
+
+		for _, key := range keys {
+			imported := child.Results().Get(key)
+			existing := results.Get(key)
+
+			if imported != nil && (existing == nil || imported.CreatedOn.After(existing.CreatedOn)) {
+				results[key] = imported
+			}
+		}
+	}
+
+	return results
+}
+
 // FindFlowStartedOverlap returns the list of contact ids which overlap with those passed in and which
 // have been in the flow passed in.
 func FindFlowStartedOverlap(ctx context.Context, db *sqlx.DB, flowID FlowID, contacts []ContactID) ([]ContactID, error) {
@@ -178,3 +217,45 @@ WHERE
 	contact_id = ANY($1) AND
 	flow_id = $2
 `
+
+// ExportedRun is a single run of a flow as exported
+type ExportedRun struct {
+	ID         FlowRunID       `json:"id"         db:"id"`
+	UUID       flows.RunUUID   `json:"uuid"       db:"uuid"`
+	ContactID  ContactID       `json:"contact_id" db:"contact_id"`
+	Status     RunStatus       `json:"status"     db:"status"`
+	Responded  bool            `json:"responded"  db:"responded"`
+	Results    json.RawMessage `json:"results"    db:"results"`
+	CreatedOn  time.Time       `json:"created_on" db:"created_on"`
+	ModifiedOn time.Time       `json:"modified_on" db:"modified_on"`
+	ExitedOn   *time.Time      `json:"exited_on"  db:"exited_on"`
+}
+
+const sqlSelectExportedRuns = `
+SELECT id, uuid, contact_id, status, responded, results::json AS results, created_on, modified_on, exited_on
+  FROM flows_flowrun
+ WHERE org_id = $1 AND flow_id = $2 AND id > $3 AND modified_on >= $4
+ ORDER BY id`
+
+// StreamFlowRuns reads the runs of the given flow modified since the given time, in order of id, passing each to the
+// callback as it's read so that exports of large flows are never held in memory. Exports can be resumed by passing the
+// id of the last run seen as afterID.
+func StreamFlowRuns(ctx context.Context, db Queryer, orgID OrgID, flowID FlowID, afterID FlowRunID, since time.Time, callback func(*ExportedRun) error) error {
+	rows, err := db.QueryxContext(ctx, sqlSelectExportedRuns, orgID, flowID, afterID, since)
+	if err != nil {
+		return errors.Wrapf(err, "error querying runs for flow %d", flowID)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		run := &ExportedRun{}
+		if err := rows.StructScan(run); err != nil {
+			return errors.Wrap(err, "error scanning run")
+		}
+		if err := callback(run); err != nil {
+			return err
+		}
+	}
+
+	return errors.Wrapf(rows.Err(), "error reading runs for flow %d", flowID)
+}
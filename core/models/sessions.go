@@ -72,6 +72,9 @@ type Session struct {
 	incomingMsgID      MsgID
 	incomingExternalID null.String
 
+	// type of the trigger which started this session, only known for new sessions
+	triggerType string
+
 	// any call associated with this flow session
 	call *Call
 
@@ -112,6 +115,7 @@ func (s *Session) CallID() *CallID                    { return s.s.CallID }
 func (s *Session) IncomingMsgID() MsgID               { return s.incomingMsgID }
 func (s *Session) IncomingMsgExternalID() null.String { return s.incomingExternalID }
 func (s *Session) Scene() *Scene                      { return s.scene }
+func (s *Session) TriggerType() string                { return s.triggerType }
 
 // StoragePath returns the path for the session
 func (s *Session) StoragePath(cfg *runtime.Config) string {
@@ -144,6 +148,21 @@ func (s *Session) Runs() []*FlowRun {
 	return s.runs
 }
 
+// SprintRunCounts returns the number of runs which were started and completed during the last sprint. A run which has
+// been modified since the session was loaded and is now completed must have been completed by the sprint.
+func (s *Session) SprintRunCounts() (started, completed int) {
+	for _, r := range s.runs {
+		modified, seen := s.seenRuns[r.UUID()]
+		if !seen {
+			started++
+		}
+		if r.r.Status == RunStatusCompleted && (!seen || r.ModifiedOn().After(modified)) {
+			completed++
+		}
+	}
+	return started, completed
+}
+
 // Sprint returns the sprint associated with this session
 func (s *Session) Sprint() flows.Sprint {
 	return s.sprint
@@ -303,6 +322,10 @@ func (s *Session) Update(ctx context.Context, rt *runtime.Runtime, tx *sqlx.Tx,
 	if err != nil {
 		return errors.Wrapf(err, "error marshalling flow session")
 	}
+	output, err = oa.Org().RedactSensitiveFields(output)
+	if err != nil {
+		return errors.Wrapf(err, "error redacting flow session")
+	}
 	s.s.Output = null.String(output)
 
 	// map our status over
@@ -492,6 +515,10 @@ func NewSession(ctx context.Context, tx *sqlx.Tx, oa *OrgAssets, fs flows.Sessio
 	if err != nil {
 		return nil, errors.Wrapf(err, "error marshalling flow session")
 	}
+	output, err = oa.Org().RedactSensitiveFields(output)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error redacting flow session")
+	}
 
 	// map our status over
 	sessionStatus, found := sessionStatusMap[fs.Status()]
@@ -526,6 +553,7 @@ func NewSession(ctx context.Context, tx *sqlx.Tx, oa *OrgAssets, fs flows.Sessio
 	s.ContactID = ContactID(fs.Contact().ID())
 	s.OrgID = oa.OrgID()
 	s.CreatedOn = fs.Runs()[0].CreatedOn()
+	session.triggerType = fs.Trigger().Type()
 
 	if s.Status != SessionStatusWaiting {
 		now := time.Now()
@@ -974,6 +1002,27 @@ func InterruptSessionsForChannel(ctx context.Context, db *sqlx.DB, channelID Cha
 	return errors.Wrapf(ExitSessions(ctx, db, sessionIDs, SessionStatusInterrupted), "error exiting sessions")
 }
 
+const sqlWaitingSessionIDsForCalls = `
+SELECT id
+  FROM flows_flowsession
+ WHERE status = 'W' AND call_id = ANY($1);`
+
+// InterruptSessionsForCalls interrupts any waiting sessions for the given calls
+func InterruptSessionsForCalls(ctx context.Context, db *sqlx.DB, callIDs []CallID) error {
+	if len(callIDs) == 0 {
+		return nil
+	}
+
+	sessionIDs := make([]SessionID, 0, len(callIDs))
+
+	err := db.SelectContext(ctx, &sessionIDs, sqlWaitingSessionIDsForCalls, pq.Array(callIDs))
+	if err != nil {
+		return errors.Wrapf(err, "error selecting waiting sessions for calls")
+	}
+
+	return errors.Wrapf(ExitSessions(ctx, db, sessionIDs, SessionStatusInterrupted), "error exiting sessions")
+}
+
 const sqlWaitingSessionIDsForFlows = `
 SELECT id
   FROM flows_flowsession
@@ -184,6 +184,9 @@ func TestSessionWithSubflows(t *testing.T) {
 	testFlows := testdata.ImportFlows(db, testdata.Org1, "testdata/session_test_flows.json")
 	parent, child := testFlows[2], testFlows[3]
 
+	// have the parent flow import the child flow's result
+	db.MustExec(`UPDATE flows_flow SET metadata = '{"child_results": ["Result 1"]}'::json WHERE id = $1`, parent.ID)
+
 	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshFlows)
 	require.NoError(t, err)
 
@@ -247,6 +250,10 @@ func TestSessionWithSubflows(t *testing.T) {
 	assert.Nil(t, session.WaitExpiresOn())
 	assert.False(t, session.WaitResumeOnExpire())
 	assert.Nil(t, session.Timeout())
+
+	// result from the child run is saved on both runs
+	assertdb.Query(t, db, `SELECT results::jsonb->'result_1'->>'value' FROM flows_flowrun WHERE flow_id = $1`, child.ID).Returns("yes")
+	assertdb.Query(t, db, `SELECT results::jsonb->'result_1'->>'value' FROM flows_flowrun WHERE flow_id = $1`, parent.ID).Returns("yes")
 }
 
 func TestSessionFailedStart(t *testing.T) {
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil"
+	"github.com/pkg/errors"
+)
+
+// SimulatedEventFire is a campaign event which would fire for a contact if the current time were a simulated time
+type SimulatedEventFire struct {
+	CampaignUUID CampaignUUID      `json:"campaign_uuid"`
+	EventUUID    CampaignEventUUID `json:"event_uuid"`
+	ContactID    ContactID         `json:"contact_id"`
+	Scheduled    time.Time         `json:"scheduled"`
+}
+
+// SimulateCampaignFires calculates the campaign event fires of the org which would be scheduled at the given simulated
+// time, and which would fire before the given end time. Returns at most limit fires in the order they'd fire, and the
+// total number of fires.
+func SimulateCampaignFires(ctx context.Context, db Queryer, oa *OrgAssets, asOf, until time.Time, limit int) ([]*SimulatedEventFire, int, error) {
+	tz := oa.Env().Timezone()
+	fires := make([]*SimulatedEventFire, 0, 100)
+
+	for _, campaign := range oa.Campaigns() {
+		for _, event := range campaign.Events() {
+			field := oa.FieldByKey(event.RelativeToKey())
+			if field == nil {
+				continue
+			}
+
+			eligible, err := campaignEventEligibleContacts(ctx, db, campaign.GroupID(), field)
+			if err != nil {
+				return nil, 0, errors.Wrapf(err, "unable to calculate eligible contacts for event %d", event.ID())
+			}
+
+			for _, el := range eligible {
+				if el.RelToValue == nil {
+					continue
+				}
+
+				scheduled, err := event.ScheduleForTime(tz, asOf, *el.RelToValue)
+				if err != nil {
+					return nil, 0, errors.Wrapf(err, "error calculating offset for start: %s and event: %d", *el.RelToValue, event.ID())
+				}
+
+				if scheduled != nil && scheduled.Before(until) {
+					fires = append(fires, &SimulatedEventFire{CampaignUUID: campaign.UUID(), EventUUID: event.UUID(), ContactID: el.ContactID, Scheduled: *scheduled})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(fires, func(i, j int) bool { return fires[i].Scheduled.Before(fires[j].Scheduled) })
+
+	total := len(fires)
+	if total > limit {
+		fires = fires[:limit]
+	}
+	return fires, total, nil
+}
+
+// SimulatedScheduleFires is when a schedule would fire if the current time were a simulated time
+type SimulatedScheduleFires struct {
+	ScheduleID  ScheduleID  `json:"schedule_id"`
+	BroadcastID BroadcastID `json:"broadcast_id,omitempty"`
+	FlowID      FlowID      `json:"flow_id,omitempty"`
+	Fires       []time.Time `json:"fires"`
+}
+
+// SimulateScheduleFires calculates when each of the given schedules would fire from the given simulated time until the
+// given end time, returning at most limit fires per schedule. Schedules which wouldn't fire are omitted.
+func SimulateScheduleFires(schedules []*Schedule, asOf, until time.Time, limit int) ([]*SimulatedScheduleFires, error) {
+	simulated := make([]*SimulatedScheduleFires, 0, len(schedules))
+
+	for _, s := range schedules {
+		tz, err := s.Timezone()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading timezone of schedule %d", s.ID())
+		}
+
+		fires := make([]time.Time, 0, 1)
+
+		// schedules which haven't started yet first fire on their next fire
+		next := s.NextFire()
+		if next == nil || !next.After(asOf) {
+			next = nil
+			if s.RepeatPeriod() != RepeatPeriodNever {
+				if next, err = s.GetNextFire(tz, asOf); err != nil {
+					return nil, errors.Wrapf(err, "error calculating next fire of schedule %d", s.ID())
+				}
+			}
+		}
+
+		for next != nil && next.Before(until) && len(fires) < limit {
+			fires = append(fires, *next)
+
+			if next, err = s.GetNextFire(tz, *next); err != nil {
+				return nil, errors.Wrapf(err, "error calculating next fire of schedule %d", s.ID())
+			}
+		}
+
+		if len(fires) > 0 {
+			sf := &SimulatedScheduleFires{ScheduleID: s.ID(), Fires: fires}
+			if s.Broadcast() != nil {
+				sf.BroadcastID = s.Broadcast().ID()
+			}
+			if s.FlowStart() != nil {
+				sf.FlowID = s.FlowStart().FlowID()
+			}
+			simulated = append(simulated, sf)
+		}
+	}
+
+	return simulated, nil
+}
+
+const sqlSelectActiveSchedules = `
+SELECT ROW_TO_JSON(s) FROM (SELECT
+	s.id as id,
+	s.repeat_hour_of_day as repeat_hour_of_day,
+	s.repeat_minute_of_hour as repeat_minute_of_hour,
+	s.repeat_day_of_month as repeat_day_of_month,
+	s.repeat_days_of_week as repeat_days_of_week,
+	s.repeat_period as repeat_period,
+	s.next_fire as next_fire,
+	s.last_fire as last_fire,
+	s.org_id as org_id,
+	o.timezone as timezone,
+	(SELECT ROW_TO_JSON(sb) FROM (SELECT b.id as broadcast_id FROM msgs_broadcast b WHERE b.schedule_id = s.id) sb) as broadcast,
+	(SELECT ROW_TO_JSON(st) FROM (
+		SELECT t.flow_id as flow_id FROM triggers_trigger t WHERE t.schedule_id = s.id AND t.is_active = TRUE AND t.is_archived = FALSE
+	) st) as start
+FROM
+	schedules_schedule s JOIN
+	orgs_org o ON s.org_id = o.id
+WHERE
+	s.org_id = $1 AND
+	s.is_active = TRUE
+ORDER BY
+    s.id ASC
+) s;
+`
+
+// LoadActiveSchedules loads the active schedules of the given org. Associated broadcasts and flow starts only have
+// their ids.
+func LoadActiveSchedules(ctx context.Context, db Queryer, orgID OrgID) ([]*Schedule, error) {
+	rows, err := db.QueryxContext(ctx, sqlSelectActiveSchedules, orgID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error selecting active schedules")
+	}
+	defer rows.Close()
+
+	schedules := make([]*Schedule, 0, 10)
+	for rows.Next() {
+		s := &Schedule{}
+		if err := dbutil.ScanJSON(rows, &s.s); err != nil {
+			return nil, errors.Wrapf(err, "error reading schedule")
+		}
+		schedules = append(schedules, s)
+	}
+
+	return schedules, rows.Err()
+}
@@ -0,0 +1,117 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulateCampaignFires(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	testdata.DoctorsGroup.Add(db, testdata.Bob)
+	db.MustExec(`UPDATE contacts_contact SET fields = '{"d83aae24-4bbf-49d0-ab85-6bfd201eac6d": {"datetime": "2030-01-01T00:00:00Z"}}' WHERE id = $1`, testdata.Bob.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshCampaigns)
+	require.NoError(t, err)
+
+	bobFires := func(fires []*models.SimulatedEventFire) map[models.CampaignEventUUID]time.Time {
+		byEvent := make(map[models.CampaignEventUUID]time.Time)
+		for _, f := range fires {
+			if f.ContactID == testdata.Bob.ID {
+				byEvent[f.EventUUID] = f.Scheduled.UTC()
+			}
+		}
+		return byEvent
+	}
+
+	// simulating the day before bob joins, both joined events would fire for him in the following week
+	fires, total, err := models.SimulateCampaignFires(ctx, db, oa, time.Date(2029, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 7, 0, 0, 0, 0, time.UTC), 1000)
+	require.NoError(t, err)
+	assert.Equal(t, len(fires), total)
+	assert.Equal(t, time.Date(2030, 1, 1, 0, 10, 0, 0, time.UTC), bobFires(fires)[models.CampaignEventUUID(testdata.RemindersEvent2.UUID)])
+	assert.Equal(t, time.Date(2030, 1, 5, 20, 0, 0, 0, time.UTC), bobFires(fires)[models.CampaignEventUUID(testdata.RemindersEvent1.UUID)])
+
+	// simulating a window that ends before the 5 day event, only the message event fires
+	fires, _, err = models.SimulateCampaignFires(ctx, db, oa, time.Date(2029, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC), 1000)
+	require.NoError(t, err)
+	assert.Equal(t, map[models.CampaignEventUUID]time.Time{
+		models.CampaignEventUUID(testdata.RemindersEvent2.UUID): time.Date(2030, 1, 1, 0, 10, 0, 0, time.UTC),
+	}, bobFires(fires))
+
+	// simulating after both events have passed, nothing fires for bob
+	fires, _, err = models.SimulateCampaignFires(ctx, db, oa, time.Date(2030, 2, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, 2, 8, 0, 0, 0, 0, time.UTC), 1000)
+	require.NoError(t, err)
+	assert.Len(t, bobFires(fires), 0)
+
+	// fires are limited but total is still counted
+	fires, total, err = models.SimulateCampaignFires(ctx, db, oa, time.Date(2029, 12, 31, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 7, 0, 0, 0, 0, time.UTC), 1)
+	require.NoError(t, err)
+	assert.Len(t, fires, 1)
+	assert.GreaterOrEqual(t, total, 2)
+}
+
+func TestSimulateScheduleFires(t *testing.T) {
+	ctx, _, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	// a daily schedule at 10:15 org time (Los Angeles) and a one-off schedule, each with a broadcast
+	var daily, once models.ScheduleID
+	db.Get(&daily,
+		`INSERT INTO schedules_schedule(is_active, repeat_period, repeat_hour_of_day, repeat_minute_of_hour, created_on, modified_on, next_fire, created_by_id, modified_by_id, org_id)
+		 VALUES(TRUE, 'D', 10, 15, NOW(), NOW(), '2029-12-01T18:15:00Z', 1, 1, $1) RETURNING id`, testdata.Org1.ID,
+	)
+	db.Get(&once,
+		`INSERT INTO schedules_schedule(is_active, repeat_period, created_on, modified_on, next_fire, created_by_id, modified_by_id, org_id)
+		 VALUES(TRUE, 'O', NOW(), NOW(), '2030-01-02T12:00:00Z', 1, 1, $1) RETURNING id`, testdata.Org1.ID,
+	)
+	b1 := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "Daily"}, daily, nil, []*testdata.Group{testdata.DoctorsGroup})
+	b2 := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "Once"}, once, nil, []*testdata.Group{testdata.DoctorsGroup})
+
+	schedules, err := models.LoadActiveSchedules(ctx, db, testdata.Org1.ID)
+	require.NoError(t, err)
+	require.Len(t, schedules, 2)
+
+	fires, err := models.SimulateScheduleFires(schedules, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC), 100)
+	require.NoError(t, err)
+	require.Len(t, fires, 2)
+
+	assert.Equal(t, daily, fires[0].ScheduleID)
+	assert.Equal(t, b1, fires[0].BroadcastID)
+	assert.Len(t, fires[0].Fires, 3)
+	assert.Equal(t, time.Date(2030, 1, 1, 18, 15, 0, 0, time.UTC), fires[0].Fires[0].UTC())
+	assert.Equal(t, time.Date(2030, 1, 3, 18, 15, 0, 0, time.UTC), fires[0].Fires[2].UTC())
+
+	assert.Equal(t, once, fires[1].ScheduleID)
+	assert.Equal(t, b2, fires[1].BroadcastID)
+	assert.Equal(t, []time.Time{time.Date(2030, 1, 2, 12, 0, 0, 0, time.UTC)}, utcTimes(fires[1].Fires))
+
+	// limit applies per schedule
+	fires, err = models.SimulateScheduleFires(schedules, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC), 1)
+	require.NoError(t, err)
+	assert.Len(t, fires[0].Fires, 1)
+
+	// one-off schedule won't fire again once its time has passed
+	fires, err = models.SimulateScheduleFires(schedules, time.Date(2030, 1, 3, 0, 0, 0, 0, time.UTC), time.Date(2030, 1, 4, 0, 0, 0, 0, time.UTC), 100)
+	require.NoError(t, err)
+	require.Len(t, fires, 1)
+	assert.Equal(t, daily, fires[0].ScheduleID)
+}
+
+func utcTimes(ts []time.Time) []time.Time {
+	utc := make([]time.Time, len(ts))
+	for i := range ts {
+		utc[i] = ts[i].UTC()
+	}
+	return utc
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/pkg/errors"
+)
+
+// the duration in seconds we assume for calls when an org has no recent completed calls to go by
+const defaultCallDuration = 60
+
+const sqlCountContactsByPreferredScheme = `
+   SELECT COALESCE(u.scheme, '') AS scheme, count(*) AS count
+     FROM unnest($1::int[]) AS c(id)
+LEFT JOIN LATERAL (
+             SELECT scheme FROM contacts_contacturn WHERE contact_id = c.id ORDER BY priority DESC, id LIMIT 1
+          ) u ON TRUE
+ GROUP BY 1`
+
+// CountContactsByPreferredScheme counts the given contacts by the scheme of their highest priority URN, which is the
+// URN they'd be messaged or called on. Contacts without any URNs are counted under the empty scheme.
+func CountContactsByPreferredScheme(ctx context.Context, db Queryer, contactIDs []ContactID) (map[string]int, error) {
+	rows, err := db.QueryxContext(ctx, sqlCountContactsByPreferredScheme, pq.Array(contactIDs))
+	if err != nil {
+		return nil, errors.Wrap(err, "error counting contacts by scheme")
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var scheme string
+		var count int
+		if err := rows.Scan(&scheme, &count); err != nil {
+			return nil, errors.Wrap(err, "error scanning scheme count")
+		}
+		counts[scheme] = count
+	}
+	return counts, rows.Err()
+}
+
+const sqlSelectAverageCallDuration = `
+SELECT COALESCE(ROUND(AVG(duration)), 0)
+  FROM ivr_call
+ WHERE org_id = $1 AND direction = 'O' AND status = 'D' AND duration > 0 AND created_on > $2`
+
+// GetAverageCallDuration gets the average duration in seconds of the given org's completed outgoing calls since the
+// given time, or a default duration if there are none
+func GetAverageCallDuration(ctx context.Context, db Queryer, orgID OrgID, since time.Time) (int, error) {
+	var duration int
+	if err := db.GetContext(ctx, &duration, sqlSelectAverageCallDuration, orgID, since); err != nil {
+		return 0, errors.Wrapf(err, "error getting average call duration for org #%d", orgID)
+	}
+	if duration == 0 {
+		duration = defaultCallDuration
+	}
+	return duration, nil
+}
+
+// ChannelsForScheme returns the org's channels which have the given role and support the given URN scheme, in the
+// order they'd be considered for sending
+func (a *OrgAssets) ChannelsForScheme(scheme string, role assets.ChannelRole) []*Channel {
+	matching := make([]*Channel, 0, 1)
+	for _, c := range a.channels {
+		ch := c.(*Channel)
+		if hasScheme(ch.Schemes(), scheme) && hasRole(ch.Roles(), role) {
+			matching = append(matching, ch)
+		}
+	}
+	return matching
+}
+
+func hasScheme(schemes []string, scheme string) bool {
+	for _, s := range schemes {
+		if s == scheme {
+			return true
+		}
+	}
+	return false
+}
+
+func hasRole(roles []assets.ChannelRole, role assets.ChannelRole) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
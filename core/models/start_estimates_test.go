@@ -0,0 +1,49 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartEstimates(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	// give Bob a higher priority facebook URN and detach George's URNs
+	testdata.InsertContactURN(db, testdata.Org1, testdata.Bob, "facebook:123456", 1001)
+	db.MustExec(`UPDATE contacts_contacturn SET contact_id = NULL WHERE contact_id = $1`, testdata.George.ID)
+
+	counts, err := models.CountContactsByPreferredScheme(ctx, db, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID, testdata.George.ID})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"tel": 1, "facebook": 1, "": 1}, counts)
+
+	// no recent calls so we get the default duration
+	duration, err := models.GetAverageCallDuration(ctx, db, testdata.Org1.ID, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 60, duration)
+
+	call1 := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy)
+	call2 := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob)
+	db.MustExec(`UPDATE ivr_call SET direction = 'O', status = 'D', duration = 100 WHERE id = $1`, call1)
+	db.MustExec(`UPDATE ivr_call SET direction = 'O', status = 'D', duration = 150 WHERE id = $1`, call2)
+
+	duration, err = models.GetAverageCallDuration(ctx, db, testdata.Org1.ID, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 125, duration)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	channels := oa.ChannelsForScheme("tel", assets.ChannelRoleSend)
+	assert.Equal(t, testdata.TwilioChannel.UUID, channels[0].UUID())
+	assert.Len(t, oa.ChannelsForScheme("facebook", assets.ChannelRoleSend), 0)
+}
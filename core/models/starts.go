@@ -4,11 +4,16 @@ import (
 	"context"
 	"database/sql/driver"
 	"encoding/json"
+	"fmt"
+	"time"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/utils/trace"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 )
@@ -101,6 +106,7 @@ type FlowStartBatch struct {
 		ParentSummary  null.JSON `json:"parent_summary,omitempty"`
 		SessionHistory null.JSON `json:"session_history,omitempty"`
 		Extra          null.JSON `json:"extra,omitempty"`
+		Metadata       null.Map  `json:"metadata,omitempty"`
 
 		RestartParticipants bool `json:"restart_participants"`
 		IncludeActive       bool `json:"include_active"`
@@ -108,6 +114,8 @@ type FlowStartBatch struct {
 		IsLast        bool `json:"is_last,omitempty"`
 		TotalContacts int  `json:"total_contacts"`
 
+		CallsPerMinute int `json:"calls_per_minute,omitempty"`
+
 		CreatedBy string `json:"created_by"` // deprecated
 	}
 }
@@ -122,10 +130,17 @@ func (b *FlowStartBatch) ExcludeStartedPreviously() bool { return !b.b.RestartPa
 func (b *FlowStartBatch) ExcludeInAFlow() bool           { return !b.b.IncludeActive }
 func (b *FlowStartBatch) IsLast() bool                   { return b.b.IsLast }
 func (b *FlowStartBatch) TotalContacts() int             { return b.b.TotalContacts }
+func (b *FlowStartBatch) CallsPerMinute() int            { return b.b.CallsPerMinute }
+
+func (b *FlowStartBatch) ParentSummary() json.RawMessage   { return json.RawMessage(b.b.ParentSummary) }
+func (b *FlowStartBatch) SessionHistory() json.RawMessage  { return json.RawMessage(b.b.SessionHistory) }
+func (b *FlowStartBatch) Extra() json.RawMessage           { return json.RawMessage(b.b.Extra) }
+func (b *FlowStartBatch) Metadata() map[string]interface{} { return b.b.Metadata.Map() }
 
-func (b *FlowStartBatch) ParentSummary() json.RawMessage  { return json.RawMessage(b.b.ParentSummary) }
-func (b *FlowStartBatch) SessionHistory() json.RawMessage { return json.RawMessage(b.b.SessionHistory) }
-func (b *FlowStartBatch) Extra() json.RawMessage          { return json.RawMessage(b.b.Extra) }
+// TriggerParams returns the params for triggers created by this batch, or nil if there are none
+func (b *FlowStartBatch) TriggerParams() (*types.XObject, error) {
+	return readTriggerParams(b.Extra(), b.Metadata())
+}
 
 func (b *FlowStartBatch) MarshalJSON() ([]byte, error)    { return json.Marshal(b.b) }
 func (b *FlowStartBatch) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, &b.b) }
@@ -152,8 +167,11 @@ type FlowStart struct {
 		IncludeActive       bool `json:"include_active"       db:"include_active"`
 
 		Extra          null.JSON `json:"extra,omitempty"           db:"extra"`
+		Metadata       null.Map  `json:"metadata,omitempty"        db:"metadata"`
 		ParentSummary  null.JSON `json:"parent_summary,omitempty"  db:"parent_summary"`
 		SessionHistory null.JSON `json:"session_history,omitempty" db:"session_history"`
+
+		TraceID trace.ID `json:"-" db:"trace_id"`
 	}
 }
 
@@ -229,13 +247,46 @@ func (s *FlowStart) WithExtra(extra json.RawMessage) *FlowStart {
 	return s
 }
 
+func (s *FlowStart) Metadata() map[string]interface{} { return s.s.Metadata.Map() }
+func (s *FlowStart) WithMetadata(metadata map[string]interface{}) *FlowStart {
+	s.s.Metadata = null.NewMap(metadata)
+	return s
+}
+
+// TriggerParams returns the params for triggers created by this start, or nil if there are none
+func (s *FlowStart) TriggerParams() (*types.XObject, error) {
+	return readTriggerParams(s.Extra(), s.Metadata())
+}
+
 func (s *FlowStart) MarshalJSON() ([]byte, error)    { return json.Marshal(s.s) }
 func (s *FlowStart) UnmarshalJSON(data []byte) error { return json.Unmarshal(data, &s.s) }
 
-// GetFlowStartAttributes gets the basic attributes for the passed in start id, this includes ONLY its id, uuid, flow_id and extra
+// readTriggerParams reads trigger params from a start's extra, with any metadata included as the metadata key
+func readTriggerParams(extra json.RawMessage, metadata map[string]interface{}) (*types.XObject, error) {
+	if len(metadata) > 0 {
+		params := make(map[string]json.RawMessage)
+		if len(extra) > 0 {
+			if err := json.Unmarshal(extra, &params); err != nil {
+				return nil, errors.Wrap(err, "unable to read JSON from flow start extra")
+			}
+		}
+		params["metadata"] = jsonx.MustMarshal(metadata)
+		extra = jsonx.MustMarshal(params)
+	}
+
+	if len(extra) == 0 {
+		return nil, nil
+	}
+
+	params, err := types.ReadXObject(extra)
+	return params, errors.Wrap(err, "unable to read JSON from flow start extra")
+}
+
+// GetFlowStartAttributes gets the basic attributes for the passed in start id, this includes ONLY its id, uuid, flow_id,
+// extra and metadata
 func GetFlowStartAttributes(ctx context.Context, db Queryer, startID StartID) (*FlowStart, error) {
 	start := &FlowStart{}
-	err := db.GetContext(ctx, &start.s, `SELECT id, uuid, flow_id, extra, parent_summary, session_history FROM flows_flowstart WHERE id = $1`, startID)
+	err := db.GetContext(ctx, &start.s, `SELECT id, uuid, flow_id, extra, metadata, parent_summary, session_history FROM flows_flowstart WHERE id = $1`, startID)
 	if err != nil {
 		return nil, errors.Wrapf(err, "unable to load start attributes for id: %d", startID)
 	}
@@ -273,6 +324,9 @@ func InsertFlowStarts(ctx context.Context, db Queryer, starts []*FlowStart) erro
 		if s.s.UUID == "" {
 			s.s.UUID = uuids.New()
 		}
+		if s.s.TraceID == trace.NilID {
+			s.s.TraceID = trace.FromContext(ctx)
+		}
 
 		is[i] = &s.s
 	}
@@ -322,8 +376,8 @@ func InsertFlowStarts(ctx context.Context, db Queryer, starts []*FlowStart) erro
 
 const sqlInsertStart = `
 INSERT INTO
-	flows_flowstart(uuid,  org_id,  flow_id,  start_type,  created_on,  modified_on,  restart_participants,  include_active,  query,  status, extra,  parent_summary,  session_history)
-			 VALUES(:uuid, :org_id, :flow_id, :start_type, NOW(),       NOW(),        :restart_participants, :include_active, :query, 'P',    :extra, :parent_summary, :session_history)
+	flows_flowstart(uuid,  org_id,  flow_id,  start_type,  created_on,  modified_on,  restart_participants,  include_active,  query,  status, extra,  metadata,  parent_summary,  session_history,  trace_id)
+			 VALUES(:uuid, :org_id, :flow_id, :start_type, NOW(),       NOW(),        :restart_participants, :include_active, :query, 'P',    :extra, :metadata, :parent_summary, :session_history, :trace_id)
 RETURNING
 	id
 `
@@ -348,12 +402,57 @@ func (s *FlowStart) CreateBatch(contactIDs []ContactID, last bool, totalContacts
 	b.b.ParentSummary = null.JSON(s.ParentSummary())
 	b.b.SessionHistory = null.JSON(s.SessionHistory())
 	b.b.Extra = null.JSON(s.Extra())
+	b.b.Metadata = s.s.Metadata
 	b.b.IsLast = last
 	b.b.TotalContacts = totalContacts
 	b.b.CreatedByID = s.s.CreatedByID
 	return b
 }
 
+// WithCallsPerMinute paces the calls of this batch if it's for a voice flow
+func (b *FlowStartBatch) WithCallsPerMinute(callsPerMinute int) *FlowStartBatch {
+	b.b.CallsPerMinute = callsPerMinute
+	return b
+}
+
+var reserveCallSlotsScript = redis.NewScript(1, `
+local key, interval, count, now = KEYS[1], tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+
+local first = tonumber(redis.call("GET", key) or "0")
+if first < now then
+	first = now
+end
+
+local next = first + interval * count
+redis.call("SET", key, next, "PX", next - now + 60000)
+return first
+`)
+
+// ReserveCallDelays reserves the next count call slots for this batch's flow and returns how long each call has to wait
+// for its slot. Slots are tracked per flow in redis rather than per batch so that the pace holds across all the batches
+// and starts of the flow, e.g. a campaign event firing for several batches of contacts.
+func (b *FlowStartBatch) ReserveCallDelays(rc redis.Conn, count int) ([]time.Duration, error) {
+	delays := make([]time.Duration, count)
+	if b.b.CallsPerMinute <= 0 || count == 0 {
+		return delays, nil
+	}
+
+	interval := time.Minute / time.Duration(b.b.CallsPerMinute)
+	now := time.Now()
+	key := fmt.Sprintf("ivr_pacing:%d", b.b.FlowID)
+
+	first, err := redis.Int64(reserveCallSlotsScript.Do(rc, key, interval.Milliseconds(), count, now.UnixMilli()))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reserving call slots for flow %d", b.b.FlowID)
+	}
+
+	wait := time.UnixMilli(first).Sub(now)
+	for i := range delays {
+		delays[i] = wait + interval*time.Duration(i)
+	}
+	return delays, nil
+}
+
 // MarshalJSON marshals into JSON. 0 values will become null
 func (i StartID) MarshalJSON() ([]byte, error) {
 	return null.Int(i).MarshalJSON()
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/gocommon/jsonx"
@@ -39,7 +40,8 @@ func TestStarts(t *testing.T) {
 		"include_active": true,
 		"parent_summary": {"uuid": "b65b1a22-db6d-4f5a-9b3d-7302368a82e6"},
 		"session_history": {"parent_uuid": "532a3899-492f-4ffe-aed7-e75ad524efab", "ancestors": 3, "ancestors_since_input": 1},
-		"extra": {"foo": "bar"}
+		"extra": {"foo": "bar"},
+		"metadata": {"campaign_code": "SPRING22"}
 	}`, startID, testdata.Org1.ID, testdata.Admin.ID, testdata.SingleMessage.ID, testdata.Cathy.ID, testdata.Bob.ID, testdata.DoctorsGroup.ID, testdata.TestersGroup.ID))
 
 	start := &models.FlowStart{}
@@ -61,6 +63,7 @@ func TestStarts(t *testing.T) {
 	assert.Equal(t, json.RawMessage(`{"uuid": "b65b1a22-db6d-4f5a-9b3d-7302368a82e6"}`), start.ParentSummary())
 	assert.Equal(t, json.RawMessage(`{"parent_uuid": "532a3899-492f-4ffe-aed7-e75ad524efab", "ancestors": 3, "ancestors_since_input": 1}`), start.SessionHistory())
 	assert.Equal(t, json.RawMessage(`{"foo": "bar"}`), start.Extra())
+	assert.Equal(t, map[string]interface{}{"campaign_code": "SPRING22"}, start.Metadata())
 
 	err = models.MarkStartStarted(ctx, db, startID, 2, []models.ContactID{testdata.George.ID})
 	require.NoError(t, err)
@@ -82,6 +85,11 @@ func TestStarts(t *testing.T) {
 	assert.Equal(t, json.RawMessage(`{"uuid": "b65b1a22-db6d-4f5a-9b3d-7302368a82e6"}`), batch.ParentSummary())
 	assert.Equal(t, json.RawMessage(`{"parent_uuid": "532a3899-492f-4ffe-aed7-e75ad524efab", "ancestors": 3, "ancestors_since_input": 1}`), batch.SessionHistory())
 	assert.Equal(t, json.RawMessage(`{"foo": "bar"}`), batch.Extra())
+	assert.Equal(t, map[string]interface{}{"campaign_code": "SPRING22"}, batch.Metadata())
+
+	params, err := batch.TriggerParams()
+	require.NoError(t, err)
+	assert.Equal(t, `{"foo":"bar","metadata":{"campaign_code":"SPRING22"}}`, string(jsonx.MustMarshal(params)))
 
 	history, err := models.ReadSessionHistory(batch.SessionHistory())
 	assert.NoError(t, err)
@@ -96,6 +104,58 @@ func TestStarts(t *testing.T) {
 	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowstart WHERE id = $1 AND status = 'C'`, startID).Returns(1)
 }
 
+func TestStartTriggerParams(t *testing.T) {
+	start := models.NewFlowStart(testdata.Org1.ID, models.StartTypeAPI, models.FlowTypeMessaging, testdata.Favorites.ID)
+
+	params, err := start.TriggerParams()
+	assert.NoError(t, err)
+	assert.Nil(t, params)
+
+	start.WithExtra(json.RawMessage(`{"foo": "bar"}`))
+
+	params, err = start.TriggerParams()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"foo":"bar"}`, string(jsonx.MustMarshal(params)))
+
+	start.WithMetadata(map[string]interface{}{"request_id": "abc123"})
+
+	params, err = start.TriggerParams()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"foo":"bar","metadata":{"request_id":"abc123"}}`, string(jsonx.MustMarshal(params)))
+
+	start.WithExtra(json.RawMessage(`[1, 2]`))
+
+	_, err = start.TriggerParams()
+	assert.ErrorContains(t, err, "unable to read JSON from flow start extra")
+}
+
+func TestReserveCallDelays(t *testing.T) {
+	_, _, _, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	start := models.NewFlowStart(testdata.Org1.ID, models.StartTypeTrigger, models.FlowTypeVoice, testdata.IVRFlow.ID)
+
+	// unpaced batches don't wait
+	delays, err := start.CreateBatch(nil, true, 3).ReserveCallDelays(rc, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{0, 0, 0}, delays)
+
+	// paced batches are spread out at their pace
+	delays, err = start.CreateBatch(nil, false, 4).WithCallsPerMinute(2).ReserveCallDelays(rc, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delays[0])
+	assert.InDelta(t, float64(30*time.Second), float64(delays[1]), float64(time.Second))
+
+	// and the next batch of the same flow carries on from where the last left off
+	delays, err = start.CreateBatch(nil, true, 4).WithCallsPerMinute(2).ReserveCallDelays(rc, 2)
+	assert.NoError(t, err)
+	assert.InDelta(t, float64(time.Minute), float64(delays[0]), float64(time.Second))
+	assert.InDelta(t, float64(90*time.Second), float64(delays[1]), float64(time.Second))
+}
+
 func TestStartsBuilding(t *testing.T) {
 	uuids.SetGenerator(uuids.NewSeededGenerator(12345))
 	defer uuids.SetGenerator(uuids.DefaultGenerator)
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/mailroom/utils/trace"
+	"github.com/pkg/errors"
+)
+
+const (
+	// the number of task incidents kept for each org
+	taskIncidentsMax = 100
+
+	// how long task incidents are kept for after the last one for an org
+	taskIncidentsExpiry = 7 * 24 * time.Hour
+
+	taskIncidentRedacted = "********"
+)
+
+// task payload keys containing any of these have their values redacted in incidents
+var taskIncidentSensitiveKeys = []string{"token", "secret", "password", "auth", "api_key", "credential"}
+
+// TaskIncident is a record of a task which panicked. These are kept in Redis for a week so that they can be listed per
+// org without having to go digging through logs.
+type TaskIncident struct {
+	UUID      uuids.UUID      `json:"uuid"`
+	OrgID     OrgID           `json:"org_id"`
+	Queue     string          `json:"queue"`
+	TaskType  string          `json:"task_type"`
+	Task      json.RawMessage `json:"task"`
+	Panic     string          `json:"panic"`
+	Stack     string          `json:"stack"`
+	TraceID   trace.ID        `json:"trace_id,omitempty"`
+	StartedOn time.Time       `json:"started_on"`
+	ElapsedMS int             `json:"elapsed_ms"`
+}
+
+// NewTaskIncident creates a new incident for a task which panicked, redacting any sensitive values in its payload
+func NewTaskIncident(orgID OrgID, queue, taskType string, task json.RawMessage, panicValue interface{}, stack []byte, traceID trace.ID, startedOn time.Time, elapsed time.Duration) *TaskIncident {
+	return &TaskIncident{
+		UUID:      uuids.New(),
+		OrgID:     orgID,
+		Queue:     queue,
+		TaskType:  taskType,
+		Task:      RedactTaskPayload(task),
+		Panic:     fmt.Sprint(panicValue),
+		Stack:     string(stack),
+		TraceID:   traceID,
+		StartedOn: startedOn,
+		ElapsedMS: int(elapsed / time.Millisecond),
+	}
+}
+
+// RedactTaskPayload redacts the values of any sensitive looking keys in the given task payload
+func RedactTaskPayload(task json.RawMessage) json.RawMessage {
+	var payload interface{}
+	if err := json.Unmarshal(task, &payload); err != nil {
+		return jsonx.MustMarshal(taskIncidentRedacted)
+	}
+
+	return jsonx.MustMarshal(redactTaskValue(payload))
+}
+
+func redactTaskValue(v interface{}) interface{} {
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		for key, value := range typed {
+			if isSensitiveTaskKey(key) {
+				typed[key] = taskIncidentRedacted
+			} else {
+				typed[key] = redactTaskValue(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range typed {
+			typed[i] = redactTaskValue(value)
+		}
+	}
+	return v
+}
+
+func isSensitiveTaskKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, sensitive := range taskIncidentSensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+var taskIncidentsKeys = orgkeys.Register("task_incidents:%d")
+
+func taskIncidentsKey(orgID OrgID) string {
+	return taskIncidentsKeys.Key(int(orgID))
+}
+
+// RecordTaskIncident records the given incident, discarding the oldest incidents for the org if it has too many
+func RecordTaskIncident(rc redis.Conn, incident *TaskIncident) error {
+	key := taskIncidentsKey(incident.OrgID)
+
+	rc.Send("MULTI")
+	rc.Send("LPUSH", key, jsonx.MustMarshal(incident))
+	rc.Send("LTRIM", key, 0, taskIncidentsMax-1)
+	rc.Send("EXPIRE", key, int(taskIncidentsExpiry/time.Second))
+	_, err := rc.Do("EXEC")
+
+	return errors.Wrap(err, "error recording task incident")
+}
+
+// GetTaskIncidents gets the recorded incidents for the given org, most recent first
+func GetTaskIncidents(rc redis.Conn, orgID OrgID) ([]*TaskIncident, error) {
+	values, err := redis.ByteSlices(rc.Do("LRANGE", taskIncidentsKey(orgID), 0, -1))
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading task incidents")
+	}
+
+	incidents := make([]*TaskIncident, len(values))
+	for i, value := range values {
+		incidents[i] = &TaskIncident{}
+		if err := json.Unmarshal(value, incidents[i]); err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling task incident")
+		}
+	}
+
+	return incidents, nil
+}
@@ -0,0 +1,71 @@
+package models_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/utils/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactTaskPayload(t *testing.T) {
+	tcs := []struct {
+		task     string
+		redacted string
+	}{
+		{`{"contact_id": 123}`, `{"contact_id":123}`},
+		{`{"auth_token": "sesame", "urns": ["tel:+250788123123"]}`, `{"auth_token":"********","urns":["tel:+250788123123"]}`},
+		{`{"channel": {"config": {"API_KEY": "123", "Password": "456"}}}`, `{"channel":{"config":{"API_KEY":"********","Password":"********"}}}`},
+		{`[{"secret": {"nested": 1}}]`, `[{"secret":"********"}]`},
+		{`not json`, `"********"`},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.redacted, string(models.RedactTaskPayload(json.RawMessage(tc.task))), "redaction mismatch for %s", tc.task)
+	}
+}
+
+func TestTaskIncidents(t *testing.T) {
+	_, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	started := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	incidents, err := models.GetTaskIncidents(rc, testdata.Org1.ID)
+	assert.NoError(t, err)
+	assert.Len(t, incidents, 0)
+
+	for i := 0; i < 102; i++ {
+		task := json.RawMessage(fmt.Sprintf(`{"contact_id": %d, "token": "abc"}`, i))
+		incident := models.NewTaskIncident(testdata.Org1.ID, "handler", "handle_contact_event", task, "boom", []byte("goroutine 1 [running]:"), trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"), started, time.Millisecond*12)
+		require.NoError(t, models.RecordTaskIncident(rc, incident))
+	}
+
+	// only the most recent 100 are kept
+	incidents, err = models.GetTaskIncidents(rc, testdata.Org1.ID)
+	assert.NoError(t, err)
+	assert.Len(t, incidents, 100)
+	assert.Equal(t, testdata.Org1.ID, incidents[0].OrgID)
+	assert.Equal(t, "handle_contact_event", incidents[0].TaskType)
+	assert.JSONEq(t, `{"contact_id": 101, "token": "********"}`, string(incidents[0].Task))
+	assert.Equal(t, "boom", incidents[0].Panic)
+	assert.Equal(t, "goroutine 1 [running]:", incidents[0].Stack)
+	assert.Equal(t, started, incidents[0].StartedOn)
+	assert.Equal(t, 12, incidents[0].ElapsedMS)
+	assert.JSONEq(t, `{"contact_id": 2, "token": "********"}`, string(incidents[99].Task))
+
+	// other orgs have their own incidents
+	incidents, err = models.GetTaskIncidents(rc, testdata.Org2.ID)
+	assert.NoError(t, err)
+	assert.Len(t, incidents, 0)
+}
@@ -0,0 +1,182 @@
+package models
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/null"
+	"github.com/pkg/errors"
+	"golang.org/x/text/language"
+)
+
+// TemplateStatus is the approval status of a template translation with the channel's provider
+type TemplateStatus string
+
+const (
+	TemplateStatusApproved    = TemplateStatus("A")
+	TemplateStatusPending     = TemplateStatus("P")
+	TemplateStatusRejected    = TemplateStatus("R")
+	TemplateStatusUnsupported = TemplateStatus("U")
+)
+
+// CatalogTemplate is a template translation as it exists in a channel provider's template catalog
+type CatalogTemplate struct {
+	ExternalID string
+	Name       string
+	Language   envs.Language
+	Country    envs.Country
+	Namespace  string
+	Content    string
+	Status     TemplateStatus
+}
+
+// TemplateCatalogService is a channel provider's catalog of message templates
+type TemplateCatalogService interface {
+	// FetchTemplates fetches all the templates in the catalog, including those which aren't approved
+	FetchTemplates() ([]*CatalogTemplate, []*httpx.Trace, error)
+
+	// RedactValues returns the values which should be redacted from logs of catalog requests
+	RedactValues() []string
+}
+
+// TemplateCatalogServiceFunc is a func which creates a template catalog service for a channel
+type TemplateCatalogServiceFunc func(*Channel, *http.Client, *httpx.RetryConfig) (TemplateCatalogService, error)
+
+// TemplateCatalogRCS is the name that the catalog service used for RCS enabled channels is registered under
+const TemplateCatalogRCS = "rcs"
+
+var templateCatalogServices = map[string]TemplateCatalogServiceFunc{}
+
+// RegisterTemplateCatalogService registers a new template catalog provider for the given channel type
+func RegisterTemplateCatalogService(name string, initFunc TemplateCatalogServiceFunc) {
+	templateCatalogServices[name] = initFunc
+}
+
+// TemplateCatalogService returns the template catalog service for this channel, or nil if its provider doesn't have one
+func (c *Channel) TemplateCatalogService(httpClient *http.Client, httpRetries *httpx.RetryConfig) (TemplateCatalogService, error) {
+	initFunc := templateCatalogServices[string(c.Type())]
+	if initFunc == nil && c.SupportsRichContent() {
+		initFunc = templateCatalogServices[TemplateCatalogRCS]
+	}
+	if initFunc == nil {
+		return nil, nil
+	}
+	return initFunc(c, httpClient, httpRetries)
+}
+
+// ParseTemplateLocale parses a provider locale like en_US into a language and country, returning an error if the
+// language isn't recognized
+func ParseTemplateLocale(locale string) (envs.Language, envs.Country, error) {
+	tag, err := language.Parse(strings.ReplaceAll(locale, "_", "-"))
+	if err != nil {
+		return envs.NilLanguage, envs.NilCountry, errors.Errorf("unrecognized template locale: %s", locale)
+	}
+
+	base, _ := tag.Base()
+	region, confidence := tag.Region()
+
+	country := envs.NilCountry
+	if confidence == language.Exact {
+		country = envs.Country(region.String())
+	}
+	return envs.Language(base.ISO3()), country, nil
+}
+
+var templateVariableRegex = regexp.MustCompile(`\{\{\s*(\d+)\s*\}\}`)
+
+// counts the unique numbered variables like {{1}} in the given template content
+func templateVariableCount(content string) int {
+	variables := make(map[string]bool)
+	for _, match := range templateVariableRegex.FindAllStringSubmatch(content, -1) {
+		variables[match[1]] = true
+	}
+	return len(variables)
+}
+
+const sqlSelectOrgsWithTemplateCatalogs = `
+  SELECT DISTINCT org_id
+    FROM channels_channel
+   WHERE is_active = TRUE AND (channel_type = ANY($1) OR config->>'rcs' = 'true')
+ORDER BY org_id`
+
+// LoadTemplateCatalogOrgs loads the ids of the orgs which have channels with template catalogs
+func LoadTemplateCatalogOrgs(ctx context.Context, db Queryer) ([]OrgID, error) {
+	channelTypes := make([]string, 0, len(templateCatalogServices))
+	for name := range templateCatalogServices {
+		channelTypes = append(channelTypes, name)
+	}
+
+	orgIDs := make([]OrgID, 0, 10)
+	if err := db.SelectContext(ctx, &orgIDs, sqlSelectOrgsWithTemplateCatalogs, pq.Array(channelTypes)); err != nil {
+		return nil, errors.Wrap(err, "error loading orgs with template catalogs")
+	}
+	return orgIDs, nil
+}
+
+const sqlSelectTemplateID = `SELECT id FROM templates_template WHERE org_id = $1 AND name = $2`
+
+const sqlInsertTemplate = `
+INSERT INTO templates_template(uuid, org_id, name, created_on, modified_on)
+                        VALUES($1, $2, $3, NOW(), NOW())
+  RETURNING id`
+
+const sqlUpdateTemplateTranslation = `
+   UPDATE templates_templatetranslation
+      SET content = $5, variable_count = $6, status = $7, namespace = $8, external_id = $9, is_active = TRUE
+    WHERE template_id = $1 AND channel_id = $2 AND language = $3 AND country IS NOT DISTINCT FROM $4
+RETURNING id`
+
+const sqlInsertTemplateTranslation = `
+INSERT INTO templates_templatetranslation(template_id, channel_id, language, country, content, variable_count, status, namespace, external_id, is_active)
+                                   VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, TRUE)
+  RETURNING id`
+
+const sqlDeactivateTemplateTranslations = `
+UPDATE templates_templatetranslation SET is_active = FALSE WHERE channel_id = $1 AND is_active = TRUE AND NOT (id = ANY($2))`
+
+// SyncChannelTemplates makes the template translations of the given channel match the given templates from its
+// provider's catalog, creating templates as needed and deactivating translations which are no longer in the catalog
+func SyncChannelTemplates(ctx context.Context, db Queryer, oa *OrgAssets, channel *Channel, templates []*CatalogTemplate) error {
+	templateIDs := make(map[string]int, len(templates))
+	translationIDs := make([]int, 0, len(templates))
+
+	for _, t := range templates {
+		templateID, seen := templateIDs[t.Name]
+		if !seen {
+			ids := make([]int, 0, 1)
+			if err := db.SelectContext(ctx, &ids, sqlSelectTemplateID, oa.OrgID(), t.Name); err != nil {
+				return errors.Wrapf(err, "error looking up template '%s'", t.Name)
+			}
+			if len(ids) > 0 {
+				templateID = ids[0]
+			} else if err := db.GetContext(ctx, &templateID, sqlInsertTemplate, uuids.New(), oa.OrgID(), t.Name); err != nil {
+				return errors.Wrapf(err, "error inserting template '%s'", t.Name)
+			}
+			templateIDs[t.Name] = templateID
+		}
+
+		args := []interface{}{templateID, channel.ID(), t.Language, null.String(t.Country), t.Content, templateVariableCount(t.Content), t.Status, t.Namespace, t.ExternalID}
+
+		ids := make([]int, 0, 1)
+		if err := db.SelectContext(ctx, &ids, sqlUpdateTemplateTranslation, args...); err != nil {
+			return errors.Wrapf(err, "error updating translation of template '%s'", t.Name)
+		}
+		if len(ids) == 0 {
+			if err := db.SelectContext(ctx, &ids, sqlInsertTemplateTranslation, args...); err != nil {
+				return errors.Wrapf(err, "error inserting translation of template '%s'", t.Name)
+			}
+		}
+		translationIDs = append(translationIDs, ids...)
+	}
+
+	if _, err := db.ExecContext(ctx, sqlDeactivateTemplateTranslations, channel.ID(), pq.Array(translationIDs)); err != nil {
+		return errors.Wrap(err, "error deactivating removed template translations")
+	}
+	return nil
+}
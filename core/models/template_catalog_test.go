@@ -0,0 +1,94 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTemplateLocale(t *testing.T) {
+	tcs := []struct {
+		locale  string
+		lang    envs.Language
+		country envs.Country
+		err     string
+	}{
+		{"en_US", "eng", "US", ""},
+		{"en-GB", "eng", "GB", ""},
+		{"en", "eng", "", ""},
+		{"pt_BR", "por", "BR", ""},
+		{"rw", "kin", "", ""},
+		{"xx_YY", "", "", "unrecognized template locale: xx_YY"},
+	}
+
+	for _, tc := range tcs {
+		lang, country, err := models.ParseTemplateLocale(tc.locale)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, "error mismatch for %s", tc.locale)
+		} else {
+			assert.NoError(t, err, "unexpected error for %s", tc.locale)
+			assert.Equal(t, tc.lang, lang, "language mismatch for %s", tc.locale)
+			assert.Equal(t, tc.country, country, "country mismatch for %s", tc.locale)
+		}
+	}
+}
+
+func TestSyncChannelTemplates(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	waChannel := testdata.InsertChannel(db, testdata.Org1, models.ChannelTypeWhatsApp, "WhatsApp", []string{"whatsapp"}, "SR", map[string]interface{}{})
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+
+	channel := oa.ChannelByID(waChannel.ID)
+
+	orgIDs, err := models.LoadTemplateCatalogOrgs(ctx, db)
+	require.NoError(t, err)
+	assert.Contains(t, orgIDs, testdata.Org1.ID)
+
+	err = models.SyncChannelTemplates(ctx, db, oa, channel, []*models.CatalogTemplate{
+		{ExternalID: "1", Name: "revive_issue", Language: "eng", Country: "US", Namespace: "abc_123", Content: "Hi {{1}}, still having problems with {{2}}? {{1}}", Status: models.TemplateStatusApproved},
+		{ExternalID: "2", Name: "order_update", Language: "eng", Content: "Your order {{1}} has shipped", Status: models.TemplateStatusPending},
+		{ExternalID: "3", Name: "order_update", Language: "fra", Content: "Votre commande {{1}} est partie", Status: models.TemplateStatusRejected},
+	})
+	require.NoError(t, err)
+
+	// existing template is reused and new one created
+	assertdb.Query(t, db, `SELECT count(*) FROM templates_template WHERE org_id = $1 AND name = 'revive_issue'`, testdata.Org1.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM templates_template WHERE org_id = $1 AND name = 'order_update'`, testdata.Org1.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM templates_templatetranslation WHERE channel_id = $1 AND is_active = TRUE`, waChannel.ID).Returns(3)
+	assertdb.Query(t, db, `SELECT variable_count FROM templates_templatetranslation WHERE channel_id = $1 AND external_id = '1'`, waChannel.ID).Returns(2)
+
+	// sync again with one translation's status changed and one removed from the catalog
+	err = models.SyncChannelTemplates(ctx, db, oa, channel, []*models.CatalogTemplate{
+		{ExternalID: "1", Name: "revive_issue", Language: "eng", Country: "US", Namespace: "abc_123", Content: "Hi {{1}}, still having problems with {{2}}? {{1}}", Status: models.TemplateStatusApproved},
+		{ExternalID: "2", Name: "order_update", Language: "eng", Content: "Your order {{1}} has shipped", Status: models.TemplateStatusApproved},
+	})
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM templates_templatetranslation WHERE channel_id = $1`, waChannel.ID).Returns(3)
+	assertdb.Query(t, db, `SELECT count(*) FROM templates_templatetranslation WHERE channel_id = $1 AND is_active = TRUE`, waChannel.ID).Returns(2)
+	assertdb.Query(t, db, `SELECT status FROM templates_templatetranslation WHERE channel_id = $1 AND external_id = '2'`, waChannel.ID).Returns("A")
+
+	// only approved translations are loaded into org assets
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshTemplates)
+	require.NoError(t, err)
+
+	templates, err := oa.Templates()
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(templates))
+	assert.Equal(t, "order_update", templates[1].Name())
+	assert.Equal(t, 1, len(templates[1].Translations()))
+	assert.Equal(t, "revive_issue", templates[2].Name())
+	assert.Equal(t, 2, len(templates[2].Translations()))
+}
@@ -0,0 +1,249 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nyaruka/gocommon/gsm7"
+	"golang.org/x/text/unicode/norm"
+)
+
+// EmojiMode is what a channel wants done with emoji in the text of outgoing messages
+type EmojiMode string
+
+const (
+	EmojiModeKeep    = EmojiMode("")
+	EmojiModeStrip   = EmojiMode("strip")
+	EmojiModeReplace = EmojiMode("replace")
+)
+
+// what we append to text which has been truncated part way through a sentence
+const truncationSuffix = "..."
+
+// text substitutions for common emoji when they're being replaced rather than stripped
+var emojiReplacements = map[rune]string{
+	'😀': ":D",
+	'😃': ":D",
+	'😄': ":D",
+	'😁': ":D",
+	'😂': ":'D",
+	'🙂': ":)",
+	'😊': ":)",
+	'☺': ":)",
+	'😉': ";)",
+	'😛': ":P",
+	'😜': ";P",
+	'😮': ":O",
+	'😐': ":|",
+	'🙁': ":(",
+	'☹': ":(",
+	'😞': ":(",
+	'😢': ":'(",
+	'😭': ":'(",
+	'😠': ">:(",
+	'😍': "<3",
+	'😘': ":*",
+	'❤': "<3",
+	'💔': "</3",
+	'👍': "(y)",
+	'👎': "(n)",
+	'👋': "o/",
+}
+
+// non-GSM7 characters which have a multi-character GSM7 equivalent
+var gsm7Transliterations = map[rune]string{
+	'…': "...",
+	'—': "-",
+	'«': "\"",
+	'»': "\"",
+	'„': "\"",
+	'‚': "'",
+	'•': "-",
+	'™': "TM",
+	'©': "(C)",
+	'®': "(R)",
+	'½': "1/2",
+	'¼': "1/4",
+	'¾': "3/4",
+	'œ': "oe",
+	'Œ': "OE",
+	'æ': "ae",
+	'Ł': "L",
+	'ł': "l",
+	'Đ': "D",
+	'đ': "d",
+}
+
+// TextProcessing is how a channel wants the text of outgoing messages altered before they are sent
+type TextProcessing struct {
+	Transliterate bool
+	Emoji         EmojiMode
+	MaxLength     int
+}
+
+// TextProcessing returns how this channel wants the text of outgoing messages processed, or nil if it doesn't
+func (c *Channel) TextProcessing() *TextProcessing {
+	maxLength, _ := strconv.Atoi(c.ConfigValue(ChannelConfigMaxLength, "0"))
+
+	p := &TextProcessing{
+		Transliterate: c.ConfigValue(ChannelConfigTransliterate, "false") == "true",
+		Emoji:         EmojiMode(c.ConfigValue(ChannelConfigEmoji, "")),
+		MaxLength:     maxLength,
+	}
+	if !p.Transliterate && p.Emoji == EmojiModeKeep && p.MaxLength <= 0 {
+		return nil
+	}
+	return p
+}
+
+// Apply processes the given text, first removing or replacing emoji, then transliterating to GSM7 and finally truncating
+// to the max length
+func (p *TextProcessing) Apply(text string) string {
+	if p.Emoji == EmojiModeStrip || p.Emoji == EmojiModeReplace {
+		text = processEmoji(text, p.Emoji == EmojiModeReplace)
+	}
+	if p.Transliterate {
+		text = TransliterateGSM7(text)
+	}
+	if p.MaxLength > 0 {
+		text = TruncateText(text, p.MaxLength)
+	}
+	return text
+}
+
+// TransliterateGSM7 replaces characters which aren't in the GSM7 alphabet with their closest GSM7 equivalents, falling
+// back to the character without its accents, and finally to a question mark
+func TransliterateGSM7(text string) string {
+	text = gsm7.ReplaceSubstitutions(text)
+	if gsm7.IsValid(text) {
+		return text
+	}
+
+	var b strings.Builder
+	for _, r := range text {
+		s := string(r)
+		if gsm7.IsValid(s) {
+			b.WriteRune(r)
+		} else if t, found := gsm7Transliterations[r]; found {
+			b.WriteString(t)
+		} else if base := stripMarks(s); base != "" && gsm7.IsValid(base) {
+			b.WriteString(base)
+		} else {
+			b.WriteRune('?')
+		}
+	}
+	return b.String()
+}
+
+// TruncateText truncates the given text so that it's no longer than the given number of characters, ending it at the
+// end of a sentence if there's one in the second half of the allowed text, and otherwise at a word boundary with an
+// ellipsis
+func TruncateText(text string, maxLength int) string {
+	runes := []rune(text)
+	if len(runes) <= maxLength {
+		return text
+	}
+
+	// look for the last sentence which ends within our limit
+	for i := maxLength - 1; i >= maxLength/2; i-- {
+		if isSentenceEnd(runes[i]) && unicode.IsSpace(runes[i+1]) {
+			return string(runes[:i+1])
+		}
+	}
+
+	if maxLength <= len(truncationSuffix) {
+		return string(runes[:maxLength])
+	}
+
+	// otherwise look for the last word which ends within our limit leaving room for the suffix
+	limit := maxLength - len(truncationSuffix)
+	cut := limit
+	for i := limit; i >= limit/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + truncationSuffix
+}
+
+// removes or replaces emoji in the given text, treating sequences joined by zero width joiners as a single emoji
+func processEmoji(text string, replace bool) string {
+	var b strings.Builder
+	var last rune
+	removed, anyRemoved, joining := false, false, false
+
+	for _, r := range text {
+		if isEmojiModifier(r) {
+			joining = joining || r == '\u200d'
+			continue
+		}
+		if isEmoji(r) {
+			if !joining {
+				if replacement, found := emojiReplacements[r]; replace && found {
+					b.WriteString(replacement)
+					last, removed = rune(replacement[len(replacement)-1]), false
+				} else {
+					removed, anyRemoved = true, true
+				}
+			}
+			joining = false
+			continue
+		}
+
+		// don't leave behind doubled spaces where an emoji was removed
+		if removed && r == ' ' && (b.Len() == 0 || last == ' ' || last == '\n') {
+			continue
+		}
+		b.WriteRune(r)
+		last = r
+		removed, joining = false, false
+	}
+
+	if anyRemoved {
+		return strings.TrimRightFunc(b.String(), unicode.IsSpace)
+	}
+	return b.String()
+}
+
+// strips combining marks (i.e. accents) from the given string
+func stripMarks(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isSentenceEnd(r rune) bool {
+	return r == '.' || r == '!' || r == '?'
+}
+
+// whether the given rune is an emoji or pictograph
+func isEmoji(r rune) bool {
+	return (r >= 0x1F000 && r <= 0x1FAFF) || // emoticons, pictographs, transport, flags etc
+		(r >= 0x2600 && r <= 0x27BF) || // misc symbols and dingbats
+		(r >= 0x2B00 && r <= 0x2BFF) // arrows, stars etc
+}
+
+// whether the given rune modifies or joins emoji rather than being displayed itself
+func isEmojiModifier(r rune) bool {
+	return r == '\u200d' || // zero width joiner
+		r == '\ufe0e' || r == '\ufe0f' || // variation selectors
+		(r >= 0x1F3FB && r <= 0x1F3FF) || // skin tones
+		(r >= 0xE0020 && r <= 0xE007F) // tags
+}
+
+// applies our channel's text processing to this message's text
+func (m *Msg) applyTextProcessing(channel *Channel) {
+	if channel == nil {
+		return
+	}
+	if p := channel.TextProcessing(); p != nil {
+		m.m.Text = p.Apply(m.m.Text)
+	}
+}
@@ -0,0 +1,41 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTextProcessing(t *testing.T) {
+	tcs := []struct {
+		processing *models.TextProcessing
+		text       string
+		expected   string
+	}{
+		{&models.TextProcessing{}, "Hi 👋 there 😀", "Hi 👋 there 😀"},
+		{&models.TextProcessing{Emoji: models.EmojiModeStrip}, "Hi 👋 there 😀", "Hi there"},
+		{&models.TextProcessing{Emoji: models.EmojiModeStrip}, "👍🏽 Great", "Great"},
+		{&models.TextProcessing{Emoji: models.EmojiModeStrip}, "Family: 👨‍👩‍👧 ok", "Family: ok"},
+		{&models.TextProcessing{Emoji: models.EmojiModeStrip}, "I ❤️ it", "I it"},
+		{&models.TextProcessing{Emoji: models.EmojiModeStrip}, "No emoji  here ", "No emoji  here "},
+		{&models.TextProcessing{Emoji: models.EmojiModeReplace}, "Hi 👋 there 😀", "Hi o/ there :D"},
+		{&models.TextProcessing{Emoji: models.EmojiModeReplace}, "I ❤️ it 🐱 🙂 ok", "I <3 it :) ok"},
+		{&models.TextProcessing{Transliterate: true}, "Hello world", "Hello world"},
+		{&models.TextProcessing{Transliterate: true}, "Café “quoted” – ok…", "Café \"quoted\" - ok..."},
+		{&models.TextProcessing{Transliterate: true}, "Łódź, Straße, naïve", "Lodz, Straße, naive"},
+		{&models.TextProcessing{Transliterate: true}, "سلام", "????"},
+		{&models.TextProcessing{Transliterate: true, Emoji: models.EmojiModeReplace}, "Ça va 🙂", "Ca va :)"},
+		{&models.TextProcessing{MaxLength: 20}, "Short", "Short"},
+		{&models.TextProcessing{MaxLength: 20}, "First sentence. Second sentence.", "First sentence."},
+		{&models.TextProcessing{MaxLength: 20}, "Hi. This is a much longer sentence", "Hi. This is a..."},
+		{&models.TextProcessing{MaxLength: 10}, "Supercalifragilistic", "Superca..."},
+		{&models.TextProcessing{MaxLength: 3}, "Hello", "Hel"},
+		{&models.TextProcessing{MaxLength: 12, Emoji: models.EmojiModeStrip}, "😀😀😀 Hello there friend", "Hello..."},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, tc.processing.Apply(tc.text), "processing mismatch for '%s'", tc.text)
+	}
+}
@@ -0,0 +1,172 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+// how long we remember the position in a team's round-robin after a ticket was last routed to it
+const ticketRoutingExpiry = time.Hour * 24 * 30
+
+// TicketRouting is an org's rules for routing newly opened tickets to topics and teams. Rules are evaluated in order and
+// the first rule that matches is applied. A rule matches if the contact has the given field value, is in the given group
+// and the ticket was opened in the given flow, ignoring any of those which aren't set, so a rule without any conditions
+// matches every ticket. Tickets routed to a team are only assigned to its online agents with fewer open tickets than
+// the agent capacity, if one is set.
+//
+//	{
+//	  "agent_capacity": 10,
+//	  "rules": [
+//	    {"field": "district", "value": "Gasabo", "team": "4a9a4a3e-ab5c-4a0f-bd96-0b85e0c4c2a5"},
+//	    {"group": "c153e265-f7c9-4539-9dbc-9b358714b638", "topic": "472a7a73-96cb-4736-b567-056d987cc5b4"},
+//	    {"flow": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "topic": "472a7a73-96cb-4736-b567-056d987cc5b4", "team": "4a9a4a3e-ab5c-4a0f-bd96-0b85e0c4c2a5"}
+//	  ]
+//	}
+type TicketRouting struct {
+	AgentCapacity int                  `json:"agent_capacity" validate:"gte=0"`
+	Rules         []*TicketRoutingRule `json:"rules"          validate:"required,min=1,dive"`
+}
+
+// TicketRoutingRule is a single rule in an org's ticket routing
+type TicketRoutingRule struct {
+	Field string           `json:"field,omitempty" validate:"required_with=Value"`
+	Value string           `json:"value,omitempty" validate:"required_with=Field"`
+	Group assets.GroupUUID `json:"group,omitempty"`
+	Flow  assets.FlowUUID  `json:"flow,omitempty"`
+	Topic assets.TopicUUID `json:"topic,omitempty" validate:"required_without=Team"`
+	Team  TeamUUID         `json:"team,omitempty"  validate:"required_without=Topic"`
+}
+
+// ReadTicketRouting reads and validates ticket routing config from the given JSON
+func ReadTicketRouting(data []byte) (*TicketRouting, error) {
+	r := &TicketRouting{}
+	if err := utils.UnmarshalAndValidate(data, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reads ticket routing from the given org config value
+func readTicketRoutingConfig(v interface{}) (*TicketRouting, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadTicketRouting(data)
+}
+
+// Route returns the first rule which matches a ticket opened for the given contact in the given flow, if any
+func (r *TicketRouting) Route(contact *flows.Contact, flowUUID assets.FlowUUID) *TicketRoutingRule {
+	for _, rule := range r.Rules {
+		if rule.matches(contact, flowUUID) {
+			return rule
+		}
+	}
+	return nil
+}
+
+func (r *TicketRoutingRule) matches(contact *flows.Contact, flowUUID assets.FlowUUID) bool {
+	if r.Field != "" {
+		value := contact.Fields()[r.Field]
+		if value == nil || !strings.EqualFold(strings.TrimSpace(value.Text.Native()), strings.TrimSpace(r.Value)) {
+			return false
+		}
+	}
+	if r.Group != "" && contact.Groups().FindByUUID(r.Group) == nil {
+		return false
+	}
+	if r.Flow != "" && r.Flow != flowUUID {
+		return false
+	}
+	return true
+}
+
+var ticketRoutingKeys = orgkeys.Register("ticket_routing:%d:%s")
+
+func ticketRoutingKey(orgID OrgID, teamUUID TeamUUID) string {
+	return ticketRoutingKeys.Key(int(orgID), teamUUID)
+}
+
+// TeamAgents returns the users of the org in the given team who can be assigned tickets, ordered by id
+func TeamAgents(oa *OrgAssets, teamUUID TeamUUID) []*User {
+	users, _ := oa.Users()
+	agents := make([]*User, 0, len(users))
+
+	for _, u := range users {
+		user := u.(*User)
+		if user.Team() == nil || user.Team().UUID != teamUUID {
+			continue
+		}
+		switch user.Role() {
+		case UserRoleAdministrator, UserRoleEditor, UserRoleAgent:
+			agents = append(agents, user)
+		}
+	}
+
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID() < agents[j].ID() })
+	return agents
+}
+
+// NextTeamAssignee picks the next available agent of the given team to assign a ticket to in round-robin order, or nil
+// if none of the team's agents are online and under capacity
+func NextTeamAssignee(rc redis.Conn, oa *OrgAssets, teamUUID TeamUUID) (*User, error) {
+	agents := TeamAgents(oa, teamUUID)
+	if len(agents) == 0 {
+		return nil, nil
+	}
+
+	capacity := 0
+	if routing := oa.Org().TicketRouting(); routing != nil {
+		capacity = routing.AgentCapacity
+	}
+
+	agentIDs := make([]UserID, len(agents))
+	for i, a := range agents {
+		agentIDs[i] = a.ID()
+	}
+
+	availability, err := GetAgentAvailability(rc, oa.OrgID(), agentIDs, dates.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	available := make([]*User, 0, len(agents))
+	for _, a := range agents {
+		av := availability[a.ID()]
+		if av.Online && (capacity == 0 || av.OpenTickets < capacity) {
+			available = append(available, a)
+		}
+	}
+	if len(available) == 0 {
+		return nil, nil
+	}
+
+	key := ticketRoutingKey(oa.OrgID(), teamUUID)
+
+	rc.Send("MULTI")
+	rc.Send("INCR", key)
+	rc.Send("EXPIRE", key, int(ticketRoutingExpiry/time.Second))
+	replies, err := redis.Values(rc.Do("EXEC"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error incrementing round-robin of team %s", teamUUID)
+	}
+
+	count, _ := redis.Int(replies[0], nil)
+	assignee := available[(count-1)%len(available)]
+
+	if err := IncrementAgentOpenTickets(rc, oa.OrgID(), assignee.ID()); err != nil {
+		return nil, err
+	}
+
+	return assignee, nil
+}
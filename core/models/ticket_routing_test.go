@@ -0,0 +1,118 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTicketRouting(t *testing.T) {
+	r, err := models.ReadTicketRouting([]byte(`{"rules": [{"field": "district", "value": "Gasabo", "team": "4321c30b-b596-46fa-adb4-4a46d37923f6"}, {"topic": "9ef2ff21-064a-41f1-8560-ccc990b4f937"}]}`))
+	require.NoError(t, err)
+	assert.Len(t, r.Rules, 2)
+	assert.Equal(t, "district", r.Rules[0].Field)
+	assert.Equal(t, models.TeamUUID("4321c30b-b596-46fa-adb4-4a46d37923f6"), r.Rules[0].Team)
+	assert.Equal(t, assets.TopicUUID("9ef2ff21-064a-41f1-8560-ccc990b4f937"), r.Rules[1].Topic)
+
+	_, err = models.ReadTicketRouting([]byte(`{"rules": []}`))
+	assert.Error(t, err)
+
+	// rules must route to a topic or a team
+	_, err = models.ReadTicketRouting([]byte(`{"rules": [{"field": "district", "value": "Gasabo"}]}`))
+	assert.Error(t, err)
+
+	// field conditions need a value
+	_, err = models.ReadTicketRouting([]byte(`{"rules": [{"field": "district", "team": "4321c30b-b596-46fa-adb4-4a46d37923f6"}]}`))
+	assert.Error(t, err)
+}
+
+func TestTicketRouting(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	db.MustExec(`UPDATE orgs_usersettings SET team_id = $1 WHERE user_id = $2 OR user_id = $3`, testdata.Partners.ID, testdata.Editor.ID, testdata.Agent.ID)
+	db.MustExec(`UPDATE contacts_contact SET fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "female "}}' WHERE id = $1`, testdata.Bob.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshUsers)
+	require.NoError(t, err)
+
+	routing, err := models.ReadTicketRouting([]byte(`{"rules": [
+		{"field": "gender", "value": "Female", "topic": "9ef2ff21-064a-41f1-8560-ccc990b4f937"},
+		{"flow": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85", "team": "4321c30b-b596-46fa-adb4-4a46d37923f6"},
+		{"team": "f14c1762-d38b-4072-ae63-2705332a3719"}
+	]}`))
+	require.NoError(t, err)
+
+	_, cathy := testdata.Cathy.Load(db, oa)
+	_, bob := testdata.Bob.Load(db, oa)
+
+	// field values are matched ignoring case and surrounding whitespace
+	assert.Equal(t, routing.Rules[0], routing.Route(bob, ""))
+	assert.Equal(t, routing.Rules[1], routing.Route(cathy, "9de3663f-c5c5-4c92-9f45-ecbc09abcc85"))
+	assert.Equal(t, routing.Rules[2], routing.Route(cathy, ""))
+
+	assert.Equal(t, []*models.User{oa.UserByID(testdata.Editor.ID), oa.UserByID(testdata.Agent.ID)}, models.TeamAgents(oa, testdata.Partners.UUID))
+
+	assertAssignees := func(expected ...*testdata.User) {
+		for _, e := range expected {
+			assignee, err := models.NextTeamAssignee(rc, oa, testdata.Partners.UUID)
+			require.NoError(t, err)
+			if e == nil {
+				assert.Nil(t, assignee)
+			} else if assert.NotNil(t, assignee) {
+				assert.Equal(t, e.ID, assignee.ID())
+			}
+		}
+	}
+
+	// no agents are online
+	assertAssignees(nil)
+
+	err = models.RecordAgentHeartbeat(rc, testdata.Org1.ID, testdata.Editor.ID, models.AgentStatusOnline, 0, time.Now())
+	require.NoError(t, err)
+	err = models.RecordAgentHeartbeat(rc, testdata.Org1.ID, testdata.Agent.ID, models.AgentStatusOnline, 0, time.Now())
+	require.NoError(t, err)
+
+	// partners team agents are assigned in turn
+	assertAssignees(testdata.Editor, testdata.Agent, testdata.Editor)
+
+	// and their open ticket counts incremented
+	availability, err := models.GetAgentAvailability(rc, testdata.Org1.ID, []models.UserID{testdata.Editor.ID, testdata.Agent.ID, testdata.Admin.ID}, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, &models.AgentAvailability{Online: true, OpenTickets: 2}, availability[testdata.Editor.ID])
+	assert.Equal(t, &models.AgentAvailability{Online: true, OpenTickets: 1}, availability[testdata.Agent.ID])
+	assert.Equal(t, &models.AgentAvailability{Online: false, OpenTickets: 0}, availability[testdata.Admin.ID])
+
+	// agents who go offline are skipped
+	err = models.RecordAgentHeartbeat(rc, testdata.Org1.ID, testdata.Editor.ID, models.AgentStatusOffline, 2, time.Now())
+	require.NoError(t, err)
+
+	assertAssignees(testdata.Agent, testdata.Agent)
+
+	// as are agents who haven't sent a heartbeat recently
+	availability, err = models.GetAgentAvailability(rc, testdata.Org1.ID, []models.UserID{testdata.Agent.ID}, time.Now().Add(3*time.Minute))
+	require.NoError(t, err)
+	assert.False(t, availability[testdata.Agent.ID].Online)
+
+	// with an agent capacity of 4, agent can only take one more ticket
+	db.MustExec(`UPDATE orgs_org SET config = '{"ticket_routing": {"agent_capacity": 4, "rules": [{"team": "4321c30b-b596-46fa-adb4-4a46d37923f6"}]}}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	assertAssignees(testdata.Agent, nil)
+
+	// office team has no agents
+	assignee, err := models.NextTeamAssignee(rc, oa, testdata.Office.UUID)
+	assert.NoError(t, err)
+	assert.Nil(t, assignee)
+}
@@ -386,6 +386,9 @@ func InsertTickets(ctx context.Context, tx Queryer, oa *OrgAssets, tickets []*Ti
 	if err := insertTicketDailyCounts(ctx, tx, TicketDailyCountAssignment, oa.Org().Timezone(), assignmentCounts); err != nil {
 		return err
 	}
+	if err := InsertAnalyticsCounts(ctx, tx, oa, []*AnalyticsIncrement{{Type: AnalyticsCountTicketsOpened, Count: len(tickets)}}); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -600,16 +603,32 @@ func CloseTickets(ctx context.Context, rt *runtime.Runtime, oa *OrgAssets, userI
 		}
 	}
 
-	// mark the tickets as closed in the db
-	err := Exec(ctx, "close tickets", rt.DB, sqlCloseTickets, pq.Array(ids), now)
+	// mark the tickets as closed in the db, counting them in the same transaction
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error starting transaction")
+	}
+
+	err = Exec(ctx, "close tickets", tx, sqlCloseTickets, pq.Array(ids), now)
 	if err != nil {
+		tx.Rollback()
 		return nil, errors.Wrapf(err, "error updating tickets")
 	}
 
-	if err := InsertTicketEvents(ctx, rt.DB, events); err != nil {
+	if err := InsertTicketEvents(ctx, tx, events); err != nil {
+		tx.Rollback()
 		return nil, errors.Wrapf(err, "error inserting ticket events")
 	}
 
+	if err := InsertAnalyticsCounts(ctx, tx, oa, []*AnalyticsIncrement{{Type: AnalyticsCountTicketsClosed, Count: len(ids)}}); err != nil {
+		tx.Rollback()
+		return nil, errors.Wrapf(err, "error inserting ticket analytics counts")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrapf(err, "error committing closed tickets")
+	}
+
 	if err := recalcGroupsForTicketChanges(ctx, rt.DB, oa, contactIDs); err != nil {
 		return nil, errors.Wrapf(err, "error recalculting groups")
 	}
@@ -926,7 +945,7 @@ func (i *TicketerID) Scan(value interface{}) error {
 }
 
 func insertTicketDailyCounts(ctx context.Context, tx Queryer, countType TicketDailyCountType, tz *time.Location, scopeCounts map[string]int) error {
-	return insertDailyCounts(ctx, tx, "tickets_ticketdailycount", countType, tz, scopeCounts)
+	return insertDailyCounts(ctx, tx, "tickets_ticketdailycount", string(countType), tz, scopeCounts)
 }
 
 func insertTicketDailyTiming(ctx context.Context, tx Queryer, countType TicketDailyTimingType, tz *time.Location, scope string, duration time.Duration) error {
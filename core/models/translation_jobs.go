@@ -0,0 +1,133 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+const translationJobExpiry = time.Hour * 24 * 7
+
+// TranslationJobType is the type of a translation job
+type TranslationJobType string
+
+const (
+	TranslationJobTypeExport = TranslationJobType("export")
+	TranslationJobTypeImport = TranslationJobType("import")
+)
+
+// TranslationJobStatus is the status of a translation job
+type TranslationJobStatus string
+
+const (
+	TranslationJobStatusPending    = TranslationJobStatus("pending")
+	TranslationJobStatusInProgress = TranslationJobStatus("in_progress")
+	TranslationJobStatusComplete   = TranslationJobStatus("complete")
+	TranslationJobStatusFailed     = TranslationJobStatus("failed")
+)
+
+// TranslationJobResult is the result of exporting or importing the translations of a single flow. Revision is the new
+// revision created by a successful import.
+type TranslationJobResult struct {
+	FlowID   FlowID `json:"flow_id"`
+	Name     string `json:"name,omitempty"`
+	Revision int    `json:"revision,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// TranslationJob is the state of a background export or import of the translations of a set of flows, which is updated
+// as each batch of flows is processed. A completed export has the URL of an archive of PO files, one per flow.
+type TranslationJob struct {
+	UUID        uuids.UUID              `json:"uuid"`
+	Type        TranslationJobType      `json:"type"`
+	Status      TranslationJobStatus    `json:"status"`
+	Language    envs.Language           `json:"language,omitempty"`
+	Total       int                     `json:"total"`
+	Succeeded   int                     `json:"succeeded"`
+	Failed      int                     `json:"failed"`
+	Results     []*TranslationJobResult `json:"results"`
+	URL         string                  `json:"url,omitempty"`
+	Error       string                  `json:"error,omitempty"`
+	CreatedOn   time.Time               `json:"created_on"`
+	CompletedOn *time.Time              `json:"completed_on,omitempty"`
+}
+
+// NewTranslationJob creates a new pending translation job
+func NewTranslationJob(typ TranslationJobType, language envs.Language, total int) *TranslationJob {
+	return &TranslationJob{
+		UUID:      uuids.New(),
+		Type:      typ,
+		Status:    TranslationJobStatusPending,
+		Language:  language,
+		Total:     total,
+		Results:   []*TranslationJobResult{},
+		CreatedOn: dates.Now(),
+	}
+}
+
+// AddResult adds the result for a single flow to this job
+func (j *TranslationJob) AddResult(result *TranslationJobResult) {
+	if result.Error != "" {
+		j.Failed++
+	} else {
+		j.Succeeded++
+	}
+	j.Results = append(j.Results, result)
+}
+
+// Complete marks this job as complete
+func (j *TranslationJob) Complete() {
+	now := dates.Now()
+	j.Status = TranslationJobStatusComplete
+	j.CompletedOn = &now
+}
+
+// Fail marks this job as failed with the given error
+func (j *TranslationJob) Fail(err string) {
+	now := dates.Now()
+	j.Status = TranslationJobStatusFailed
+	j.Error = err
+	j.CompletedOn = &now
+}
+
+// TranslationJobPath gets the path in attachment storage of a file belonging to the given translation job
+func TranslationJobPath(rt *runtime.Runtime, orgID OrgID, jobUUID uuids.UUID, filename string) string {
+	return path.Join(rt.Config.S3AttachmentsPrefix, fmt.Sprint(orgID), "translations", string(jobUUID), filename)
+}
+
+var translationJobKeys = orgkeys.Register("translation_job:%d:%s")
+
+func translationJobKey(orgID OrgID, uuid uuids.UUID) string {
+	return translationJobKeys.Key(int(orgID), uuid)
+}
+
+// SetTranslationJob saves the current state of the given translation job
+func SetTranslationJob(rc redis.Conn, orgID OrgID, job *TranslationJob) error {
+	_, err := rc.Do("SET", translationJobKey(orgID, job.UUID), jsonx.MustMarshal(job), "EX", int(translationJobExpiry/time.Second))
+	return errors.Wrap(err, "error setting translation job")
+}
+
+// GetTranslationJob gets the translation job with the given UUID, or nil if there isn't one
+func GetTranslationJob(rc redis.Conn, orgID OrgID, uuid uuids.UUID) (*TranslationJob, error) {
+	data, err := redis.Bytes(rc.Do("GET", translationJobKey(orgID, uuid)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting translation job")
+	}
+
+	job := &TranslationJob{}
+	if err := jsonx.Unmarshal(data, job); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling translation job")
+	}
+	return job, nil
+}
@@ -119,6 +119,30 @@ func loadTriggers(ctx context.Context, db Queryer, orgID OrgID) ([]*Trigger, err
 
 // FindMatchingMsgTrigger finds the best match trigger for an incoming message from the given contact
 func FindMatchingMsgTrigger(oa *OrgAssets, contact *flows.Contact, text string) *Trigger {
+	// if we have a matching keyword trigger return that, otherwise we move on to catchall triggers..
+	byKeyword := findKeywordTriggerMatch(oa, contact, text)
+	if byKeyword != nil {
+		return byKeyword
+	}
+
+	candidates := findTriggerCandidates(oa, CatchallTriggerType, nil)
+
+	return findBestTriggerMatch(candidates, nil, contact)
+}
+
+// FindMatchingEmailTrigger finds the best match trigger for an incoming email. Keywords can be in the subject of the
+// email as well as its body, so that emails can start flows regardless of what's in their body.
+func FindMatchingEmailTrigger(oa *OrgAssets, contact *flows.Contact, subject, text string) *Trigger {
+	bySubject := findKeywordTriggerMatch(oa, contact, subject)
+	if bySubject != nil {
+		return bySubject
+	}
+
+	return FindMatchingMsgTrigger(oa, contact, text)
+}
+
+// finds the best match keyword trigger for the given text, if any
+func findKeywordTriggerMatch(oa *OrgAssets, contact *flows.Contact, text string) *Trigger {
 	// determine our message keyword
 	words := utils.TokenizeString(text)
 	keyword := ""
@@ -133,14 +157,6 @@ func FindMatchingMsgTrigger(oa *OrgAssets, contact *flows.Contact, text string)
 		return t.Keyword() == keyword && (t.MatchType() == MatchFirst || (t.MatchType() == MatchOnly && only))
 	})
 
-	// if we have a matching keyword trigger return that, otherwise we move on to catchall triggers..
-	byKeyword := findBestTriggerMatch(candidates, nil, contact)
-	if byKeyword != nil {
-		return byKeyword
-	}
-
-	candidates = findTriggerCandidates(oa, CatchallTriggerType, nil)
-
 	return findBestTriggerMatch(candidates, nil, contact)
 }
 
@@ -193,6 +209,11 @@ func FindMatchingTicketClosedTrigger(oa *OrgAssets, contact *flows.Contact) *Tri
 }
 
 // finds trigger candidates based on type and optional filter
+// HasTriggerOfType returns whether the org has any triggers of the given type
+func HasTriggerOfType(oa *OrgAssets, type_ TriggerType) bool {
+	return len(findTriggerCandidates(oa, type_, nil)) > 0
+}
+
 func findTriggerCandidates(oa *OrgAssets, type_ TriggerType, filter func(*Trigger) bool) []*Trigger {
 	candidates := make([]*Trigger, 0, 10)
 
@@ -308,11 +329,13 @@ SELECT ROW_TO_JSON(r) FROM (SELECT
 	ARRAY_REMOVE(ARRAY_AGG(DISTINCT eg.contactgroup_id), NULL) as exclude_group_ids
 FROM 
 	triggers_trigger t
+	JOIN flows_flow f ON f.id = t.flow_id
 	LEFT OUTER JOIN triggers_trigger_groups ig ON t.id = ig.trigger_id
 	LEFT OUTER JOIN triggers_trigger_exclude_groups eg ON t.id = eg.trigger_id
 WHERE 
 	t.org_id = $1 AND 
 	t.is_active = TRUE AND
+	f.is_active = TRUE AND
 	t.is_archived = FALSE AND
 	t.trigger_type != 'S'
 GROUP BY 
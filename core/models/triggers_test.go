@@ -170,6 +170,41 @@ func TestFindMatchingMsgTrigger(t *testing.T) {
 	}
 }
 
+func TestFindMatchingEmailTrigger(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	db.MustExec(`DELETE FROM triggers_trigger`)
+
+	joinID := testdata.InsertKeywordTrigger(db, testdata.Org1, testdata.Favorites, "join", models.MatchFirst, nil, nil)
+	resistID := testdata.InsertKeywordTrigger(db, testdata.Org1, testdata.SingleMessage, "resist", models.MatchOnly, nil, nil)
+	catchallID := testdata.InsertCatchallTrigger(db, testdata.Org1, testdata.SingleMessage, nil, nil)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshTriggers)
+	require.NoError(t, err)
+
+	_, cathy := testdata.Cathy.Load(db, oa)
+
+	tcs := []struct {
+		subject           string
+		text              string
+		expectedTriggerID models.TriggerID
+	}{
+		{"Join", "Please sign me up", joinID},
+		{"resist", "join", resistID},
+		{"Hello", "join now", joinID},
+		{"Re: join", "thanks", catchallID},
+		{"Question", "what time is it?", catchallID},
+	}
+
+	for _, tc := range tcs {
+		trigger := models.FindMatchingEmailTrigger(oa, cathy, tc.subject, tc.text)
+
+		assertTrigger(t, tc.expectedTriggerID, trigger, "trigger mismatch for email with subject '%s' and text '%s'", tc.subject, tc.text)
+	}
+}
+
 func TestFindMatchingIncomingCallTrigger(t *testing.T) {
 	ctx, rt, db, _ := testsuite.Get()
 
@@ -0,0 +1,243 @@
+package models
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+const (
+	urnNormalizationBatchSize   = 1000
+	urnNormalizationMaxExamples = 100
+	urnNormalizationExpiry      = time.Hour * 24 * 7
+)
+
+// URNIssueType is the type of problem found with a URN
+type URNIssueType string
+
+const (
+	URNIssueUnnormalized = URNIssueType("unnormalized")
+	URNIssueConflict     = URNIssueType("conflict")
+	URNIssueInvalid      = URNIssueType("invalid")
+)
+
+// URNIssue is a problem found with a URN during normalization
+type URNIssue struct {
+	Type       URNIssueType `json:"type"`
+	URNID      URNID        `json:"urn_id"`
+	ContactID  ContactID    `json:"contact_id,omitempty"`
+	Identity   urns.URN     `json:"identity"`
+	Normalized urns.URN     `json:"normalized,omitempty"`
+	Error      string       `json:"error,omitempty"`
+}
+
+// URNNormalizationReport is the result of normalizing an org's URNs. Unnormalized URNs are fixed unless there's already
+// another URN in the org with the normalized identity, in which case they're reported as conflicts. Invalid URNs are
+// only detached from their contacts if requested. Nothing is changed for a dry run.
+type URNNormalizationReport struct {
+	DryRun       bool        `json:"dry_run"`
+	Scanned      int         `json:"scanned"`
+	Unnormalized int         `json:"unnormalized"`
+	Conflicts    int         `json:"conflicts"`
+	Invalid      int         `json:"invalid"`
+	Fixed        int         `json:"fixed"`
+	Detached     int         `json:"detached"`
+	Examples     []*URNIssue `json:"examples"`
+	CompletedOn  time.Time   `json:"completed_on"`
+}
+
+func (r *URNNormalizationReport) addExample(issue *URNIssue) {
+	if len(r.Examples) < urnNormalizationMaxExamples {
+		r.Examples = append(r.Examples, issue)
+	}
+}
+
+// NormalizeTelURN normalizes the given tel URN for the given country, returning an error if it isn't a valid number.
+// Numbers with a + prefix must be possible numbers, and those without are assumed to be short codes if they can't be
+// parsed as numbers for the country.
+func NormalizeTelURN(urn urns.URN, country string) (urns.URN, error) {
+	if path := urn.Path(); strings.HasPrefix(path, "+") {
+		if _, err := urns.ParseNumber(path, ""); err != nil {
+			return urn, errors.Errorf("invalid phone number: %s", path)
+		}
+	}
+
+	normalized := urn.Normalize(country)
+	if err := normalized.Validate(); err != nil {
+		return normalized, err
+	}
+	return normalized, nil
+}
+
+type urnRow struct {
+	ID        URNID     `db:"id"`
+	ContactID ContactID `db:"contact_id"`
+	Identity  urns.URN  `db:"identity"`
+}
+
+// URNs scrubbed by contact anonymization have placeholder paths which aren't numbers
+const sqlSelectTelURNsBatch = `
+  SELECT id, COALESCE(contact_id, 0) AS contact_id, identity
+    FROM contacts_contacturn
+   WHERE org_id = $1 AND scheme = 'tel' AND id > $2 AND path NOT LIKE 'anon-%'
+ORDER BY id
+   LIMIT $3`
+
+const sqlSelectExistingURNIdentities = `
+SELECT identity FROM contacts_contacturn WHERE org_id = $1 AND identity = ANY($2)`
+
+// NormalizeOrgURNs checks all of the tel URNs in the given org against the current phone number metadata, fixing
+// those which aren't normalized and optionally detaching those which are invalid
+func NormalizeOrgURNs(ctx context.Context, db Queryer, oa *OrgAssets, dryRun, detachInvalid bool) (*URNNormalizationReport, error) {
+	country := string(oa.Env().DefaultCountry())
+	report := &URNNormalizationReport{DryRun: dryRun, Examples: []*URNIssue{}}
+	lastID := URNID(0)
+
+	for {
+		rows := make([]*urnRow, 0, urnNormalizationBatchSize)
+		if err := db.SelectContext(ctx, &rows, sqlSelectTelURNsBatch, oa.OrgID(), lastID, urnNormalizationBatchSize); err != nil {
+			return nil, errors.Wrap(err, "error selecting tel URNs")
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+		report.Scanned += len(rows)
+
+		unnormalized := make([]*URNIssue, 0)
+		invalid := make([]*URNIssue, 0)
+
+		for _, row := range rows {
+			normalized, err := NormalizeTelURN(row.Identity, country)
+			if err != nil {
+				invalid = append(invalid, &URNIssue{Type: URNIssueInvalid, URNID: row.ID, ContactID: row.ContactID, Identity: row.Identity, Error: err.Error()})
+			} else if normalized.Identity() != row.Identity {
+				unnormalized = append(unnormalized, &URNIssue{Type: URNIssueUnnormalized, URNID: row.ID, ContactID: row.ContactID, Identity: row.Identity, Normalized: normalized.Identity()})
+			}
+		}
+
+		if err := normalizeURNs(ctx, db, oa.OrgID(), unnormalized, report); err != nil {
+			return nil, err
+		}
+		if err := detachInvalidURNs(ctx, db, invalid, detachInvalid, report); err != nil {
+			return nil, err
+		}
+	}
+
+	report.CompletedOn = time.Now()
+	return report, nil
+}
+
+// fixes the given unnormalized URNs unless another URN in the org already has the normalized identity
+func normalizeURNs(ctx context.Context, db Queryer, orgID OrgID, issues []*URNIssue, report *URNNormalizationReport) error {
+	if len(issues) == 0 {
+		return nil
+	}
+
+	identities := make([]string, len(issues))
+	for i, issue := range issues {
+		identities[i] = string(issue.Normalized)
+	}
+
+	existing := make([]urns.URN, 0)
+	if err := db.SelectContext(ctx, &existing, sqlSelectExistingURNIdentities, orgID, pq.Array(identities)); err != nil {
+		return errors.Wrap(err, "error checking for existing URNs")
+	}
+
+	taken := make(map[urns.URN]bool, len(existing))
+	for _, identity := range existing {
+		taken[identity] = true
+	}
+
+	contactIDs := make([]ContactID, 0, len(issues))
+
+	for _, issue := range issues {
+		// two URNs in the same batch might also normalize to the same identity
+		if taken[issue.Normalized] {
+			issue.Type = URNIssueConflict
+			report.Conflicts++
+			report.addExample(issue)
+			continue
+		}
+		taken[issue.Normalized] = true
+
+		report.Unnormalized++
+		report.addExample(issue)
+
+		if !report.DryRun {
+			_, err := db.ExecContext(ctx, `UPDATE contacts_contacturn SET identity = $2, path = $3 WHERE id = $1`, issue.URNID, issue.Normalized, issue.Normalized.Path())
+			if err != nil {
+				return errors.Wrapf(err, "error normalizing URN #%d", issue.URNID)
+			}
+			report.Fixed++
+
+			if issue.ContactID != NilContactID {
+				contactIDs = append(contactIDs, issue.ContactID)
+			}
+		}
+	}
+
+	return UpdateContactModifiedOn(ctx, db, contactIDs)
+}
+
+// detaches the given invalid URNs from their contacts if requested
+func detachInvalidURNs(ctx context.Context, db Queryer, issues []*URNIssue, detach bool, report *URNNormalizationReport) error {
+	urnIDs := make([]URNID, 0, len(issues))
+	contactIDs := make([]ContactID, 0, len(issues))
+
+	for _, issue := range issues {
+		report.Invalid++
+		report.addExample(issue)
+
+		if issue.ContactID != NilContactID {
+			urnIDs = append(urnIDs, issue.URNID)
+			contactIDs = append(contactIDs, issue.ContactID)
+		}
+	}
+
+	if report.DryRun || !detach || len(urnIDs) == 0 {
+		return nil
+	}
+
+	if _, err := db.ExecContext(ctx, `UPDATE contacts_contacturn SET contact_id = NULL WHERE id = ANY($1)`, pq.Array(urnIDs)); err != nil {
+		return errors.Wrap(err, "error detaching invalid URNs")
+	}
+	report.Detached += len(urnIDs)
+
+	return UpdateContactModifiedOn(ctx, db, contactIDs)
+}
+
+var urnNormalizationKeys = orgkeys.Register("urn_normalization:%d")
+
+func urnNormalizationKey(orgID OrgID) string {
+	return urnNormalizationKeys.Key(int(orgID))
+}
+
+// SetURNNormalizationReport records the given report as the latest URN normalization report for the given org
+func SetURNNormalizationReport(rc redis.Conn, orgID OrgID, report *URNNormalizationReport) error {
+	_, err := rc.Do("SET", urnNormalizationKey(orgID), jsonx.MustMarshal(report), "EX", int(urnNormalizationExpiry/time.Second))
+	return errors.Wrap(err, "error setting URN normalization report")
+}
+
+// GetURNNormalizationReport gets the latest URN normalization report for the given org, or nil if there isn't one
+func GetURNNormalizationReport(rc redis.Conn, orgID OrgID) (*URNNormalizationReport, error) {
+	data, err := redis.Bytes(rc.Do("GET", urnNormalizationKey(orgID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting URN normalization report")
+	}
+
+	report := &URNNormalizationReport{}
+	if err := jsonx.Unmarshal(data, report); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling URN normalization report")
+	}
+	return report, nil
+}
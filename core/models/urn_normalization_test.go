@@ -0,0 +1,96 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTelURN(t *testing.T) {
+	tcs := []struct {
+		urn        urns.URN
+		country    string
+		normalized urns.URN
+		err        string
+	}{
+		{"tel:+250788123123", "RW", "tel:+250788123123", ""},
+		{"tel:0788123123", "RW", "tel:+250788123123", ""},
+		{"tel:+250 788 123 123", "", "tel:+250788123123", ""},
+		{"tel:1234", "RW", "tel:1234", ""},
+		{"tel:+1234", "RW", "tel:+1234", "invalid phone number: +1234"},
+		{"tel:+250 788 123 123 123 123", "RW", "tel:+250 788 123 123 123 123", "invalid phone number: +250 788 123 123 123 123"},
+	}
+
+	for _, tc := range tcs {
+		normalized, err := models.NormalizeTelURN(tc.urn, tc.country)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, "error mismatch for %s", tc.urn)
+		} else {
+			assert.NoError(t, err, "unexpected error for %s", tc.urn)
+			assert.Equal(t, tc.normalized, normalized, "normalized mismatch for %s", tc.urn)
+		}
+	}
+}
+
+func TestNormalizeOrgURNs(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// give our org a country by setting country on a channel
+	db.MustExec(`UPDATE channels_channel SET country = 'RW' WHERE id = $1`, testdata.TwilioChannel.ID)
+	models.FlushCache()
+
+	unnormalizedID := testdata.InsertContactURN(db, testdata.Org1, testdata.Cathy, "tel:0788123123", 1000)
+	conflictID := testdata.InsertContactURN(db, testdata.Org1, testdata.Bob, "tel:+250788456456", 1000)
+	db.MustExec(`UPDATE contacts_contacturn SET identity = 'tel:0788 456 456', path = '0788 456 456' WHERE id = $1`, conflictID)
+	testdata.InsertContactURN(db, testdata.Org1, testdata.George, "tel:+250788456456", 1000)
+	invalidID := testdata.InsertContactURN(db, testdata.Org1, testdata.Alexandria, "tel:+1234", 1000)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	// a dry run changes nothing
+	report, err := models.NormalizeOrgURNs(ctx, db, oa, true, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Unnormalized)
+	assert.Equal(t, 1, report.Conflicts)
+	assert.Equal(t, 1, report.Invalid)
+	assert.Equal(t, 0, report.Fixed)
+	assert.Equal(t, 0, report.Detached)
+	assert.Len(t, report.Examples, 3)
+
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, unnormalizedID).Returns("tel:0788123123")
+	assertdb.Query(t, db, `SELECT contact_id FROM contacts_contacturn WHERE id = $1`, invalidID).Returns(int64(testdata.Alexandria.ID))
+
+	report, err = models.NormalizeOrgURNs(ctx, db, oa, false, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Fixed)
+	assert.Equal(t, 1, report.Detached)
+
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, unnormalizedID).Returns("tel:+250788123123")
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, conflictID).Returns("tel:0788 456 456")
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contacturn WHERE id = $1 AND contact_id IS NULL`, invalidID).Returns(1)
+
+	// save and fetch the report
+	require.NoError(t, models.SetURNNormalizationReport(rc, testdata.Org1.ID, report))
+
+	saved, err := models.GetURNNormalizationReport(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, report.Fixed, saved.Fixed)
+	assert.Equal(t, report.Examples, saved.Examples)
+
+	saved, err = models.GetURNNormalizationReport(rc, testdata.Org2.ID)
+	assert.NoError(t, err)
+	assert.Nil(t, saved)
+}
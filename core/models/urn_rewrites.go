@@ -0,0 +1,216 @@
+package models
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/lib/pq"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/pkg/errors"
+)
+
+const (
+	urnRewriteBatchSize   = 1000
+	urnRewriteMaxExamples = 100
+	urnRewriteExpiry      = time.Hour * 24 * 7
+)
+
+// URNRewriteRule is how to rewrite the URNs of a scheme, e.g. when a telco changes a country prefix or the length of its
+// numbers. URNs whose path starts with the prefix, if given, and matches the pattern have the matched part of their
+// path replaced with the replacement, which can refer to groups in the pattern like $1.
+//
+//	{
+//	  "scheme": "tel",
+//	  "prefix": "+2507",
+//	  "pattern": "^\\+2507(\\d{8})$",
+//	  "replacement": "+25079$1"
+//	}
+type URNRewriteRule struct {
+	Scheme      string `json:"scheme"      validate:"required"`
+	Prefix      string `json:"prefix"`
+	Pattern     string `json:"pattern"     validate:"required"`
+	Replacement string `json:"replacement"`
+}
+
+// URNRewrite is the rewrite of a single URN, which is a collision if another URN in the org already has the new
+// identity, or invalid if the new identity isn't a valid URN
+type URNRewrite struct {
+	URNID     URNID     `json:"urn_id"`
+	ContactID ContactID `json:"contact_id,omitempty"`
+	Identity  urns.URN  `json:"identity"`
+	Rewritten urns.URN  `json:"rewritten"`
+	Collision bool      `json:"collision,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// URNRewriteReport is the result of rewriting an org's URNs. Matching URNs are rewritten unless their new identity
+// collides with another URN in the org or isn't valid. Nothing is changed for a dry run.
+type URNRewriteReport struct {
+	Rule        *URNRewriteRule `json:"rule"`
+	DryRun      bool            `json:"dry_run"`
+	Scanned     int             `json:"scanned"`
+	Matched     int             `json:"matched"`
+	Collisions  int             `json:"collisions"`
+	Invalid     int             `json:"invalid"`
+	Rewritten   int             `json:"rewritten"`
+	Examples    []*URNRewrite   `json:"examples"`
+	CompletedOn time.Time       `json:"completed_on"`
+}
+
+func (r *URNRewriteReport) addExample(rewrite *URNRewrite) {
+	if len(r.Examples) < urnRewriteMaxExamples {
+		r.Examples = append(r.Examples, rewrite)
+	}
+}
+
+const sqlSelectURNsForRewriteBatch = `
+  SELECT id, COALESCE(contact_id, 0) AS contact_id, identity
+    FROM contacts_contacturn
+   WHERE org_id = $1 AND scheme = $2 AND path LIKE $3 AND id > $4
+ORDER BY id
+   LIMIT $5`
+
+// RewriteOrgURNs rewrites the URNs of the given org according to the given rule
+func RewriteOrgURNs(ctx context.Context, db Queryer, orgID OrgID, rule *URNRewriteRule, dryRun bool) (*URNRewriteReport, error) {
+	pattern, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid rewrite pattern")
+	}
+
+	report := &URNRewriteReport{Rule: rule, DryRun: dryRun, Examples: []*URNRewrite{}}
+	like := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(rule.Prefix) + "%"
+	lastID := URNID(0)
+
+	// identities taken by rewrites in earlier batches, which for a dry run won't be in the database
+	taken := make(map[urns.URN]bool)
+
+	for {
+		rows := make([]*urnRow, 0, urnRewriteBatchSize)
+		if err := db.SelectContext(ctx, &rows, sqlSelectURNsForRewriteBatch, orgID, rule.Scheme, like, lastID, urnRewriteBatchSize); err != nil {
+			return nil, errors.Wrap(err, "error selecting URNs to rewrite")
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+		report.Scanned += len(rows)
+
+		rewrites := make([]*URNRewrite, 0)
+
+		for _, row := range rows {
+			path := row.Identity.Path()
+			if !pattern.MatchString(path) {
+				continue
+			}
+
+			rewrite := &URNRewrite{URNID: row.ID, ContactID: row.ContactID, Identity: row.Identity}
+
+			rewritten, err := urns.NewURNFromParts(rule.Scheme, pattern.ReplaceAllString(path, rule.Replacement), "", "")
+			if err == nil {
+				err = rewritten.Validate()
+			}
+			if err != nil {
+				rewrite.Error = err.Error()
+				report.Invalid++
+				report.addExample(rewrite)
+				continue
+			}
+
+			rewrite.Rewritten = rewritten.Identity()
+			if rewrite.Rewritten != row.Identity {
+				rewrites = append(rewrites, rewrite)
+			}
+		}
+
+		if err := rewriteURNs(ctx, db, orgID, rewrites, taken, report); err != nil {
+			return nil, err
+		}
+	}
+
+	report.CompletedOn = time.Now()
+	return report, nil
+}
+
+// rewrites the given URNs unless another URN in the org already has the new identity
+func rewriteURNs(ctx context.Context, db Queryer, orgID OrgID, rewrites []*URNRewrite, taken map[urns.URN]bool, report *URNRewriteReport) error {
+	if len(rewrites) == 0 {
+		return nil
+	}
+
+	identities := make([]string, len(rewrites))
+	for i, rewrite := range rewrites {
+		identities[i] = string(rewrite.Rewritten)
+	}
+
+	existing := make([]urns.URN, 0)
+	if err := db.SelectContext(ctx, &existing, sqlSelectExistingURNIdentities, orgID, pq.Array(identities)); err != nil {
+		return errors.Wrap(err, "error checking for existing URNs")
+	}
+	for _, identity := range existing {
+		taken[identity] = true
+	}
+
+	contactIDs := make([]ContactID, 0, len(rewrites))
+
+	for _, rewrite := range rewrites {
+		report.Matched++
+
+		// two URNs might also be rewritten to the same identity
+		if taken[rewrite.Rewritten] {
+			rewrite.Collision = true
+			report.Collisions++
+			report.addExample(rewrite)
+			continue
+		}
+		taken[rewrite.Rewritten] = true
+
+		report.addExample(rewrite)
+
+		if !report.DryRun {
+			_, err := db.ExecContext(ctx, `UPDATE contacts_contacturn SET identity = $2, path = $3 WHERE id = $1`, rewrite.URNID, rewrite.Rewritten, rewrite.Rewritten.Path())
+			if err != nil {
+				return errors.Wrapf(err, "error rewriting URN #%d", rewrite.URNID)
+			}
+			report.Rewritten++
+
+			if rewrite.ContactID != NilContactID {
+				contactIDs = append(contactIDs, rewrite.ContactID)
+			}
+		}
+	}
+
+	return UpdateContactModifiedOn(ctx, db, contactIDs)
+}
+
+var urnRewriteKeys = orgkeys.Register("urn_rewrite:%d")
+
+func urnRewriteKey(orgID OrgID) string {
+	return urnRewriteKeys.Key(int(orgID))
+}
+
+// SetURNRewriteReport records the given report as the latest URN rewrite report for the given org
+func SetURNRewriteReport(rc redis.Conn, orgID OrgID, report *URNRewriteReport) error {
+	_, err := rc.Do("SET", urnRewriteKey(orgID), jsonx.MustMarshal(report), "EX", int(urnRewriteExpiry/time.Second))
+	return errors.Wrap(err, "error setting URN rewrite report")
+}
+
+// GetURNRewriteReport gets the latest URN rewrite report for the given org, or nil if there isn't one
+func GetURNRewriteReport(rc redis.Conn, orgID OrgID) (*URNRewriteReport, error) {
+	data, err := redis.Bytes(rc.Do("GET", urnRewriteKey(orgID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "error getting URN rewrite report")
+	}
+
+	report := &URNRewriteReport{}
+	if err := jsonx.Unmarshal(data, report); err != nil {
+		return nil, errors.Wrap(err, "error unmarshalling URN rewrite report")
+	}
+	return report, nil
+}
@@ -0,0 +1,66 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteOrgURNs(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	rewriteID := testdata.InsertContactURN(db, testdata.Org1, testdata.Cathy, "tel:+250781234567", 1000)
+	collisionID := testdata.InsertContactURN(db, testdata.Org1, testdata.Bob, "tel:+250787654321", 1000)
+	testdata.InsertContactURN(db, testdata.Org1, testdata.George, "tel:+2507987654321", 1000)
+	otherID := testdata.InsertContactURN(db, testdata.Org1, testdata.Alexandria, "tel:+250721234567", 1000)
+
+	rule := &models.URNRewriteRule{Scheme: "tel", Prefix: "+2507", Pattern: `^\+2507(8\d{7})$`, Replacement: "+25079$1"}
+
+	// a dry run changes nothing
+	report, err := models.RewriteOrgURNs(ctx, db, testdata.Org1.ID, rule, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 2, report.Matched)
+	assert.Equal(t, 1, report.Collisions)
+	assert.Equal(t, 0, report.Invalid)
+	assert.Equal(t, 0, report.Rewritten)
+	assert.Len(t, report.Examples, 2)
+
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, rewriteID).Returns("tel:+250781234567")
+
+	report, err = models.RewriteOrgURNs(ctx, db, testdata.Org1.ID, rule, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Rewritten)
+	assert.Equal(t, 1, report.Collisions)
+
+	assertdb.Query(t, db, `SELECT identity, path FROM contacts_contacturn WHERE id = $1`, rewriteID).Columns(map[string]interface{}{"identity": "tel:+2507981234567", "path": "+2507981234567"})
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, collisionID).Returns("tel:+250787654321")
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, otherID).Returns("tel:+250721234567")
+
+	// rewrites to paths which aren't valid are reported as invalid
+	rule = &models.URNRewriteRule{Scheme: "tel", Pattern: `^\+25072`, Replacement: "+250-72"}
+
+	report, err = models.RewriteOrgURNs(ctx, db, testdata.Org1.ID, rule, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.Invalid)
+	assert.Equal(t, 0, report.Rewritten)
+
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, otherID).Returns("tel:+250721234567")
+
+	// and reports can be saved
+	require.NoError(t, models.SetURNRewriteReport(rc, testdata.Org1.ID, report))
+
+	saved, err := models.GetURNRewriteReport(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, saved.Invalid)
+}
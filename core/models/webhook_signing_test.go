@@ -0,0 +1,58 @@
+package models_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWebhookSigning(t *testing.T) {
+	s, err := models.ReadWebhookSigning([]byte(`{"secrets": ["0123456789abcdef", "fedcba9876543210"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"0123456789abcdef", "fedcba9876543210"}, s.Secrets)
+
+	_, err = models.ReadWebhookSigning([]byte(`{}`))
+	assert.EqualError(t, err, "field 'secrets' is required")
+
+	_, err = models.ReadWebhookSigning([]byte(`{"secrets": ["0123456789abcdef", "fedcba9876543210", "aaaaaaaaaaaaaaaa"]}`))
+	assert.EqualError(t, err, "field 'secrets' must have a maximum of 2 items")
+
+	_, err = models.ReadWebhookSigning([]byte(`{"secrets": ["short"]}`))
+	assert.EqualError(t, err, "field 'secrets[0]' must be greater than or equal to 16")
+}
+
+func TestWebhookSigning(t *testing.T) {
+	defer dates.SetNowSource(dates.DefaultNowSource)
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)))
+
+	s, err := models.ReadWebhookSigning([]byte(`{"secrets": ["0123456789abcdef", "fedcba9876543210"]}`))
+	require.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "https://example.com/hook", strings.NewReader(`{"foo":"bar"}`))
+	require.NoError(t, err)
+
+	err = s.Sign(req)
+	assert.NoError(t, err)
+	assert.Equal(t, "t=1640995200,v1=f1b25d7b9d2ea0f94b452e5e0fa3fdc25fecf2389ea189d7e9fda3ec5228f60a,v1=7848c7f97ceb8d89b3637e0b08f37ce785b6ea931de17fd27cee1201a8160793", req.Header.Get(models.WebhookSignatureHeader))
+
+	// body can still be read
+	body, err := io.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"foo":"bar"}`, string(body))
+
+	// as can a request without a body
+	req, err = http.NewRequest("GET", "https://example.com/hook", nil)
+	require.NoError(t, err)
+
+	err = s.Sign(req)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(req.Header.Get(models.WebhookSignatureHeader), "t=1640995200,v1="))
+}
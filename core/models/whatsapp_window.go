@@ -0,0 +1,129 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+// WhatsAppWindow is how long after a contact's last incoming message that free-form messages can be sent to them on a
+// WhatsApp channel. Outside of this customer service window only template messages are allowed.
+const WhatsAppWindow = time.Hour * 24
+
+// WhatsAppWindowAction is what happens to a free-form message which would be sent outside of the WhatsApp window
+type WhatsAppWindowAction string
+
+const (
+	WhatsAppWindowActionFail     = WhatsAppWindowAction("fail")
+	WhatsAppWindowActionTemplate = WhatsAppWindowAction("template")
+)
+
+// WhatsAppWindowConfig is an org's configuration for free-form messages sent outside of the WhatsApp window. They are
+// either failed, which is what happens for orgs without this config, or converted to the given template with the text
+// of the message as its only variable.
+//
+//	{
+//	  "action": "template",
+//	  "template": {"uuid": "9c22b594-fcab-4b29-9bcb-ce4404894a80", "name": "revive_issue"},
+//	  "language": "eng",
+//	  "namespace": "2d40b45c_25cd_4965_9019_f05d0124c5fa"
+//	}
+type WhatsAppWindowConfig struct {
+	Action    WhatsAppWindowAction      `json:"action"    validate:"eq=fail|eq=template"`
+	Template  *assets.TemplateReference `json:"template"`
+	Language  envs.Language             `json:"language"`
+	Country   envs.Country              `json:"country"`
+	Namespace string                    `json:"namespace"`
+}
+
+// ReadWhatsAppWindowConfig reads and validates WhatsApp window config from the given JSON
+func ReadWhatsAppWindowConfig(data []byte) (*WhatsAppWindowConfig, error) {
+	c := &WhatsAppWindowConfig{}
+	if err := utils.UnmarshalAndValidate(data, c); err != nil {
+		return nil, err
+	}
+	if c.Action == WhatsAppWindowActionTemplate && (c.Template == nil || c.Language == envs.NilLanguage) {
+		return nil, errors.New("template and language are required to convert messages to templates")
+	}
+	return c, nil
+}
+
+// reads the WhatsApp window config from the given org config value
+func readWhatsAppWindowConfig(v interface{}) (*WhatsAppWindowConfig, error) {
+	data, err := jsonx.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return ReadWhatsAppWindowConfig(data)
+}
+
+// whether messages sent on channels of the given type are subject to the WhatsApp window
+func hasWhatsAppWindow(channel *Channel) bool {
+	return channel != nil && (channel.Type() == ChannelTypeWhatsApp || channel.Type() == ChannelTypeDialog360)
+}
+
+func whatsAppWindowKey(channelID ChannelID, contactID ContactID) string {
+	return fmt.Sprintf("whatsapp_window:%d:%d", channelID, contactID)
+}
+
+// RecordWhatsAppIncoming records that the given contact sent an incoming message on the given channel at the given time,
+// opening the WhatsApp window for them. Channels which aren't WhatsApp channels are ignored.
+func RecordWhatsAppIncoming(rc redis.Conn, channel *Channel, contactID ContactID, receivedOn time.Time) error {
+	if !hasWhatsAppWindow(channel) {
+		return nil
+	}
+
+	_, err := rc.Do("SET", whatsAppWindowKey(channel.ID(), contactID), receivedOn.Unix(), "EX", int(WhatsAppWindow/time.Second))
+	return errors.Wrapf(err, "error recording whatsapp incoming for contact #%d", contactID)
+}
+
+// GetWhatsAppLastIncoming gets when the given contact last sent an incoming message on the given channel, or nil if they
+// haven't within the WhatsApp window
+func GetWhatsAppLastIncoming(rc redis.Conn, channelID ChannelID, contactID ContactID) (*time.Time, error) {
+	ts, err := redis.Int64(rc.Do("GET", whatsAppWindowKey(channelID, contactID)))
+	if err == redis.ErrNil {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "error getting whatsapp last incoming for contact #%d", contactID)
+	}
+
+	t := time.Unix(ts, 0).UTC()
+	return &t, nil
+}
+
+// applies the WhatsApp window to this message if it's a free-form message on a WhatsApp channel, failing it or
+// converting it to a template message if the contact hasn't sent an incoming message recently enough
+func (m *Msg) applyWhatsAppWindow(rt *runtime.Runtime, org *Org, channel *Channel, out *flows.MsgOut) error {
+	if !hasWhatsAppWindow(channel) || out.Templating() != nil || m.m.Status == MsgStatusFailed {
+		return nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	lastIncoming, err := GetWhatsAppLastIncoming(rc, channel.ID(), m.m.ContactID)
+	if err != nil {
+		return err
+	}
+	if lastIncoming != nil && m.m.CreatedOn.Sub(*lastIncoming) < WhatsAppWindow {
+		return nil
+	}
+
+	cfg := org.WhatsAppWindow()
+	if cfg != nil && cfg.Action == WhatsAppWindowActionTemplate {
+		m.setMetadataValue("templating", flows.NewMsgTemplating(cfg.Template, cfg.Language, cfg.Country, []string{m.m.Text}, cfg.Namespace))
+		return nil
+	}
+
+	m.m.Status = MsgStatusFailed
+	m.m.FailedReason = MsgFailedWindowClosed
+	return nil
+}
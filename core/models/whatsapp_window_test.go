@@ -0,0 +1,105 @@
+package models_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadWhatsAppWindowConfig(t *testing.T) {
+	c, err := models.ReadWhatsAppWindowConfig([]byte(`{"action": "fail"}`))
+	require.NoError(t, err)
+	assert.Equal(t, models.WhatsAppWindowActionFail, c.Action)
+
+	c, err = models.ReadWhatsAppWindowConfig([]byte(`{"action": "template", "template": {"uuid": "9c22b594-fcab-4b29-9bcb-ce4404894a80", "name": "revive_issue"}, "language": "eng"}`))
+	require.NoError(t, err)
+	assert.Equal(t, models.WhatsAppWindowActionTemplate, c.Action)
+	assert.Equal(t, "revive_issue", c.Template.Name)
+	assert.Equal(t, envs.Language("eng"), c.Language)
+
+	_, err = models.ReadWhatsAppWindowConfig([]byte(`{"action": "template", "language": "eng"}`))
+	assert.EqualError(t, err, "template and language are required to convert messages to templates")
+
+	_, err = models.ReadWhatsAppWindowConfig([]byte(`{"action": "ignore"}`))
+	assert.EqualError(t, err, "field 'action' failed tag 'eq=fail|eq=template'")
+}
+
+func TestWhatsAppWindow(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	waChannel := testdata.InsertChannel(db, testdata.Org1, models.ChannelTypeWhatsApp, "WhatsApp", []string{"whatsapp"}, "SR", map[string]interface{}{})
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg|models.RefreshChannels)
+	require.NoError(t, err)
+
+	_, cathy := testdata.Cathy.Load(db, oa)
+	channel := oa.ChannelByID(waChannel.ID)
+	now := time.Now()
+
+	newOutgoing := func(templating *flows.MsgTemplating) *models.Msg {
+		out := flows.NewMsgOut(urns.URN(fmt.Sprintf("whatsapp:250788373373?id=%d", testdata.Cathy.URNID)), channel.ChannelReference(), "hi there", nil, nil, templating, flows.NilMsgTopic, flows.NilUnsendableReason)
+		msg, err := models.NewOutgoingBroadcastMsg(rt, oa.Org(), channel, cathy, out, now, models.NilBroadcastID)
+		require.NoError(t, err)
+		return msg
+	}
+
+	// no incoming message so window is closed and free-form messages fail
+	msg := newOutgoing(nil)
+	assert.Equal(t, models.MsgStatusFailed, msg.Status())
+	assert.Equal(t, models.MsgFailedWindowClosed, msg.FailedReason())
+
+	// template messages can be sent regardless
+	templating := flows.NewMsgTemplating(assets.NewTemplateReference("9c22b594-fcab-4b29-9bcb-ce4404894a80", "revive_issue"), "eng", "", nil, "")
+	msg = newOutgoing(templating)
+	assert.Equal(t, models.MsgStatusQueued, msg.Status())
+
+	// messages on other channels aren't affected
+	rc := rp.Get()
+	defer rc.Close()
+
+	require.NoError(t, models.RecordWhatsAppIncoming(rc, oa.ChannelByID(testdata.TwilioChannel.ID), testdata.Cathy.ID, now))
+	lastIncoming, err := models.GetWhatsAppLastIncoming(rc, testdata.TwilioChannel.ID, testdata.Cathy.ID)
+	require.NoError(t, err)
+	assert.Nil(t, lastIncoming)
+
+	// an incoming message 23 hours ago opens the window
+	require.NoError(t, models.RecordWhatsAppIncoming(rc, channel, testdata.Cathy.ID, now.Add(-time.Hour*23)))
+	lastIncoming, err = models.GetWhatsAppLastIncoming(rc, waChannel.ID, testdata.Cathy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Hour*23).Unix(), lastIncoming.Unix())
+
+	msg = newOutgoing(nil)
+	assert.Equal(t, models.MsgStatusQueued, msg.Status())
+	assert.Equal(t, models.NilMsgFailedReason, msg.FailedReason())
+
+	// but not one 25 hours ago
+	require.NoError(t, models.RecordWhatsAppIncoming(rc, channel, testdata.Cathy.ID, now.Add(-time.Hour*25)))
+
+	msg = newOutgoing(nil)
+	assert.Equal(t, models.MsgFailedWindowClosed, msg.FailedReason())
+
+	// org can be configured to convert free-form messages outside of the window to a template instead
+	db.MustExec(`UPDATE orgs_org SET config = '{"whatsapp_window": {"action": "template", "template": {"uuid": "9c22b594-fcab-4b29-9bcb-ce4404894a80", "name": "revive_issue"}, "language": "eng"}}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	oa, err = models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	msg = newOutgoing(nil)
+	assert.Equal(t, models.MsgStatusQueued, msg.Status())
+	assert.Equal(t, models.NilMsgFailedReason, msg.FailedReason())
+	assert.Equal(t, flows.NewMsgTemplating(assets.NewTemplateReference("9c22b594-fcab-4b29-9bcb-ce4404894a80", "revive_issue"), "eng", "", []string{"hi there"}, ""), msg.Metadata()["templating"])
+}
@@ -0,0 +1,95 @@
+package msgio
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/analytics"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// CourierQueueSize returns the number of batches queued to courier for the given channel, across both priorities
+func CourierQueueSize(rc redis.Conn, ch *models.Channel) (int, error) {
+	queueKey := fmt.Sprintf("msgs:%s|%d", ch.UUID(), ch.TPS())
+
+	rc.Send("MULTI")
+	rc.Send("ZCARD", queueKey+"/0")
+	rc.Send("ZCARD", queueKey+"/1")
+	sizes, err := redis.Ints(rc.Do("EXEC"))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error getting size of courier queue for channel %s", ch.UUID())
+	}
+
+	return sizes[0] + sizes[1], nil
+}
+
+// BackedUpChannels returns the courier channels of the org whose queues have more than the configured threshold of
+// batches waiting to be sent
+func BackedUpChannels(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) ([]*models.Channel, error) {
+	if rt.Config.CourierBackpressureThreshold <= 0 {
+		return nil, nil
+	}
+
+	channels, _ := oa.Channels()
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	backedUp := make([]*models.Channel, 0)
+	maxSize := 0
+
+	for _, c := range channels {
+		ch := c.(*models.Channel)
+		if ch.Type() == models.ChannelTypeAndroid || !hasSendRole(ch) {
+			continue
+		}
+
+		size, err := CourierQueueSize(rc, ch)
+		if err != nil {
+			return nil, err
+		}
+		if size > maxSize {
+			maxSize = size
+		}
+		if size > rt.Config.CourierBackpressureThreshold {
+			backedUp = append(backedUp, ch)
+
+			logrus.WithFields(logrus.Fields{"org_id": oa.OrgID(), "channel_uuid": ch.UUID(), "queue_size": size}).Warn("courier queue is backed up")
+		}
+	}
+
+	analytics.Gauge("mr.courier_queue_max_size", float64(maxSize))
+
+	return backedUp, nil
+}
+
+// CheckCourierBackpressure returns the delay after which bulk message creation for the given org should be retried if
+// any of its channels' courier queues are backed up, or zero if creation can go ahead now
+func CheckCourierBackpressure(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) (time.Duration, error) {
+	backedUp, err := BackedUpChannels(ctx, rt, oa)
+	if err != nil {
+		return 0, err
+	}
+	if len(backedUp) == 0 {
+		return 0, nil
+	}
+
+	analytics.Gauge("mr.courier_backpressure_delays", float64(len(backedUp)))
+
+	return time.Second * time.Duration(rt.Config.CourierBackpressureDelay), nil
+}
+
+func hasSendRole(ch *models.Channel) bool {
+	for _, r := range ch.Roles() {
+		if r == assets.ChannelRoleSend {
+			return true
+		}
+	}
+	return false
+}
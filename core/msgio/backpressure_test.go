@@ -0,0 +1,64 @@
+package msgio_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/msgio"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCourierBackpressure(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+	defer func() { rt.Config.CourierBackpressureThreshold = 10000 }()
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+
+	twilio := oa.ChannelByID(testdata.TwilioChannel.ID)
+
+	msgs := []*models.Msg{
+		(&msgSpec{Channel: testdata.TwilioChannel, Contact: testdata.Cathy}).createMsg(t, rt, oa),
+		(&msgSpec{Channel: testdata.TwilioChannel, Contact: testdata.Cathy, HighPriority: true}).createMsg(t, rt, oa),
+	}
+	err = msgio.QueueCourierMessages(rc, testdata.Cathy.ID, msgs)
+	require.NoError(t, err)
+
+	size, err := msgio.CourierQueueSize(rc, twilio)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, size)
+
+	// queue isn't over threshold
+	rt.Config.CourierBackpressureThreshold = 2
+
+	delay, err := msgio.CheckCourierBackpressure(ctx, rt, oa)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+
+	// now it is
+	rt.Config.CourierBackpressureThreshold = 1
+
+	backedUp, err := msgio.BackedUpChannels(ctx, rt, oa)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.Channel{twilio}, backedUp)
+
+	delay, err = msgio.CheckCourierBackpressure(ctx, rt, oa)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, delay)
+
+	// and zero disables checking
+	rt.Config.CourierBackpressureThreshold = 0
+
+	delay, err = msgio.CheckCourierBackpressure(ctx, rt, oa)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Duration(0), delay)
+}
@@ -2,8 +2,10 @@ package msgio
 
 import (
 	"context"
+	"time"
 
 	"github.com/edganiukov/fcm"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/sirupsen/logrus"
@@ -21,13 +23,88 @@ func SendMessages(ctx context.Context, rt *runtime.Runtime, tx models.Queryer, f
 	// messages that need to be marked as pending
 	pending := make([]*models.Msg, 0, 1)
 
-	// walk through our messages, separate by whether they have a channel and if it's Android
+	// messages held because their org has paused outbound
+	paused := make([]*models.Msg, 0)
+
+	// messages which can be sent now
+	sendable := make([]*models.Msg, 0, len(msgs))
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	// orgs we've checked for paused outbound
+	pausedOrgs := make(map[models.OrgID]bool)
+
+	// orgs we've checked for quiet hours, and non-urgent messages held until those end
+	quietOrgs := make(map[models.OrgID]*time.Time)
+	held := make(map[models.OrgID][]*models.Msg)
+
+	// orgs of non-urgent messages which are being sent, and those messages which are subject to frequency caps
+	nonUrgentOrgs := make(map[models.OrgID]*models.OrgAssets)
+	capped := make(map[models.OrgID][]*models.Msg)
+
+	// walk through our messages, holding any which can't be sent yet
 	for _, msg := range msgs {
 		// ignore any message already marked as failed (maybe org is suspended)
 		if msg.Status() == models.MsgStatusFailed {
 			continue
 		}
 
+		// if org has paused outbound, hold message as pending until they resume
+		orgPaused, checked := pausedOrgs[msg.OrgID()]
+		if !checked {
+			var err error
+			orgPaused, err = models.IsOrgOutboundPaused(rc, msg.OrgID())
+			if err != nil {
+				logrus.WithError(err).WithField("org_id", msg.OrgID()).Error("error checking whether org outbound is paused")
+			}
+			pausedOrgs[msg.OrgID()] = orgPaused
+		}
+		if orgPaused {
+			paused = append(paused, msg)
+			continue
+		}
+
+		// if message can wait and org is in quiet hours, hold it until they end
+		if msg.NonUrgent() {
+			quietUntil, checked := quietOrgs[msg.OrgID()]
+			if !checked {
+				oa, err := models.GetOrgAssetsScoped(ctx, rt, msg.OrgID(), models.RefreshNone)
+				if err != nil {
+					logrus.WithError(err).WithField("org_id", msg.OrgID()).Error("error loading org assets to check quiet hours")
+				} else {
+					quietUntil = oa.Org().QuietUntil(dates.Now())
+					nonUrgentOrgs[msg.OrgID()] = oa
+				}
+				quietOrgs[msg.OrgID()] = quietUntil
+			}
+			if quietUntil != nil {
+				held[msg.OrgID()] = append(held[msg.OrgID()], msg)
+				continue
+			}
+
+			// leave frequency capping until we've seen all the messages so each org is only capped once
+			if oa := nonUrgentOrgs[msg.OrgID()]; oa != nil && oa.Org().MsgFrequencyCap() != nil {
+				capped[msg.OrgID()] = append(capped[msg.OrgID()], msg)
+				continue
+			}
+		}
+
+		sendable = append(sendable, msg)
+	}
+
+	// non-urgent messages are counted against their org's frequency cap as they're sent, and those over it are
+	// deferred or dropped
+	for orgID, orgMsgs := range capped {
+		allowed, err := models.ApplyMsgFrequencyCap(ctx, rt, tx, nonUrgentOrgs[orgID].Org(), orgMsgs)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", orgID).Error("error applying msg frequency cap")
+		}
+		sendable = append(sendable, allowed...)
+	}
+
+	// separate the rest by whether they have a channel and if it's Android
+	for _, msg := range sendable {
 		channel := msg.Channel()
 		if channel != nil {
 			if channel.Type() == models.ChannelTypeAndroid {
@@ -45,9 +122,6 @@ func SendMessages(ctx context.Context, rt *runtime.Runtime, tx models.Queryer, f
 
 	// if there are courier messages to send, do so
 	if len(courierMsgs) > 0 {
-		rc := rt.RP.Get()
-		defer rc.Close()
-
 		for contactID, contactMsgs := range courierMsgs {
 			err := QueueCourierMessages(rc, contactID, contactMsgs)
 
@@ -70,6 +144,20 @@ func SendMessages(ctx context.Context, rt *runtime.Runtime, tx models.Queryer, f
 		SyncAndroidChannels(fc, androidChannels)
 	}
 
+	// any messages held for quiet hours are marked as pending until they will be released
+	for orgID, orgMsgs := range held {
+		if err := models.MarkMessagesHeld(ctx, tx, orgMsgs, *quietOrgs[orgID]); err != nil {
+			logrus.WithError(err).WithField("org_id", orgID).Error("error marking messages as held for quiet hours")
+		}
+	}
+
+	// any messages held because their org is paused are marked as pending until it resumes
+	if len(paused) > 0 {
+		if err := models.MarkMessagesPaused(ctx, tx, paused); err != nil {
+			logrus.WithError(err).Error("error marking messages as paused")
+		}
+	}
+
 	// any messages that didn't get sent should be moved back to pending (they are queued at creation to save an
 	// update in the common case)
 	if len(pending) > 0 {
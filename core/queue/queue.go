@@ -1,12 +1,15 @@
 package queue
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strconv"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/mailroom/utils/trace"
 	"github.com/pkg/errors"
 )
 
@@ -17,6 +20,7 @@ type Task struct {
 	Task       json.RawMessage `json:"task"`
 	QueuedOn   time.Time       `json:"queued_on"`
 	ErrorCount int             `json:"error_count,omitempty"`
+	TraceID    trace.ID        `json:"trace_id,omitempty"`
 }
 
 // Priority is the priority for the task
@@ -58,6 +62,30 @@ const (
 
 	// StartIVRFlowBatch is our task for starting an ivr batch
 	StartIVRFlowBatch = "start_ivr_flow_batch"
+
+	// TranscodeRecording is our task for transcoding an IVR recording
+	TranscodeRecording = "transcode_recording"
+
+	// DeliverResthookEvent is our task for delivering a resthook event to its subscribers
+	DeliverResthookEvent = "deliver_resthook_event"
+
+	// PushFHIRPatients is our task for pushing changed contacts to their patients on a FHIR server
+	PushFHIRPatients = "push_fhir_patients"
+
+	// ReleasePausedMsgs is our task for sending the messages held whilst an org had paused outbound
+	ReleasePausedMsgs = "release_paused_msgs"
+
+	// CutoffCall is our task for hanging up an IVR call which has reached its maximum duration
+	CutoffCall = "cutoff_call"
+
+	// delayedKey is the sorted set of tasks waiting to be added to their queues, scored by when they are due
+	delayedKey = "delayed_tasks"
+)
+
+// the per-org queues which tasks are added to
+var (
+	_ = orgkeys.Register(BatchQueue + ":%d")
+	_ = orgkeys.Register(HandlerQueue + ":%d")
 )
 
 // Size returns the number of tasks for the passed in queue
@@ -81,8 +109,9 @@ func Size(rc redis.Conn, queue string) (int, error) {
 	return size, nil
 }
 
-// AddTask adds the passed in task to our queue for execution
-func AddTask(rc redis.Conn, queue string, taskType string, orgID int, task interface{}, priority Priority) error {
+// AddTask adds the passed in task to our queue for execution, carrying over the trace ID of the given context so that
+// anything the task creates can be tied back to whatever queued it
+func AddTask(ctx context.Context, rc redis.Conn, queue string, taskType string, orgID int, task interface{}, priority Priority) error {
 	score := strconv.FormatFloat(float64(time.Now().UnixNano()/int64(time.Microsecond))/float64(1000000)+float64(priority), 'f', 6, 64)
 
 	taskBody, err := json.Marshal(task)
@@ -95,6 +124,7 @@ func AddTask(rc redis.Conn, queue string, taskType string, orgID int, task inter
 		OrgID:    orgID,
 		Task:     taskBody,
 		QueuedOn: time.Now(),
+		TraceID:  trace.FromContext(ctx),
 	}
 	jsonPayload, err := json.Marshal(payload)
 	if err != nil {
@@ -107,6 +137,106 @@ func AddTask(rc redis.Conn, queue string, taskType string, orgID int, task inter
 	return err
 }
 
+// ForwardTask adds a task which was popped from another queue, e.g. another region's, to the given queue unchanged
+func ForwardTask(rc redis.Conn, queue string, task *Task) error {
+	score := strconv.FormatFloat(float64(time.Now().UnixNano()/int64(time.Microsecond))/float64(1000000), 'f', 6, 64)
+
+	jsonPayload, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	rc.Send("zadd", fmt.Sprintf(queuePattern, queue, task.OrgID), score, jsonPayload)
+	rc.Send("zincrby", fmt.Sprintf(activePattern, queue), 0, task.OrgID)
+	_, err = rc.Do("")
+	return err
+}
+
+// a task waiting to be added to a queue
+type delayedTask struct {
+	Queue    string   `json:"queue"`
+	Priority Priority `json:"priority"`
+	Task     *Task    `json:"task"`
+}
+
+// AddDelayedTask adds the passed in task to be added to the given queue once the given delay has passed
+func AddDelayedTask(ctx context.Context, rc redis.Conn, queue string, taskType string, orgID int, task interface{}, priority Priority, delay time.Duration) error {
+	taskBody, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	delayed := &delayedTask{
+		Queue:    queue,
+		Priority: priority,
+		Task: &Task{
+			Type:    taskType,
+			OrgID:   orgID,
+			Task:    taskBody,
+			TraceID: trace.FromContext(ctx),
+		},
+	}
+	jsonPayload, err := json.Marshal(delayed)
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.Do("zadd", delayedKey, time.Now().Add(delay).Unix(), jsonPayload)
+	return err
+}
+
+// RequeueDelayedTask adds an already queued task back to the given queue once the given delay has passed
+func RequeueDelayedTask(rc redis.Conn, queue string, task *Task, delay time.Duration) error {
+	jsonPayload, err := json.Marshal(&delayedTask{Queue: queue, Priority: DefaultPriority, Task: task})
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.Do("zadd", delayedKey, time.Now().Add(delay).Unix(), jsonPayload)
+	return err
+}
+
+var popDelayedTasks = redis.NewScript(1, `-- KEYS: [DelayedKey] ARGV: [Now]
+	local result = redis.call("zrangebyscore", KEYS[1], 0, ARGV[1])
+	redis.call("zremrangebyscore", KEYS[1], 0, ARGV[1])
+	return result
+`)
+
+// QueueDelayedTasks adds all delayed tasks which are due by the given time to their queues, returning how many were added
+func QueueDelayedTasks(rc redis.Conn, now time.Time) (int, error) {
+	values, err := redis.Strings(popDelayedTasks.Do(rc, delayedKey, now.Unix()))
+	if err != nil {
+		return 0, errors.Wrap(err, "error popping delayed tasks")
+	}
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	for _, value := range values {
+		delayed := &delayedTask{}
+		if err := json.Unmarshal([]byte(value), delayed); err != nil {
+			return 0, errors.Wrapf(err, "error unmarshalling delayed task: %s", value)
+		}
+
+		score := strconv.FormatFloat(float64(now.UnixNano()/int64(time.Microsecond))/float64(1000000)+float64(delayed.Priority), 'f', 6, 64)
+
+		delayed.Task.QueuedOn = now
+		jsonPayload, err := json.Marshal(delayed.Task)
+		if err != nil {
+			return 0, err
+		}
+
+		rc.Send("zadd", fmt.Sprintf(queuePattern, delayed.Queue, delayed.Task.OrgID), score, jsonPayload)
+		rc.Send("zincrby", fmt.Sprintf(activePattern, delayed.Queue), 0, delayed.Task.OrgID)
+	}
+
+	if _, err := rc.Do(""); err != nil {
+		return 0, errors.Wrap(err, "error queuing delayed tasks")
+	}
+
+	return len(values), nil
+}
+
 var popTask = redis.NewScript(1, `-- KEYS: [QueueName]
     -- first get what is the active queue
 	local result = redis.call("zrange", KEYS[1] .. ":active", 0, 0, "WITHSCORES")
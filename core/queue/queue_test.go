@@ -1,14 +1,19 @@
 package queue
 
 import (
+	"context"
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/utils/trace"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestQueues(t *testing.T) {
+	ctx := trace.WithID(context.Background(), trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"))
+
 	rc, err := redis.Dial("tcp", "localhost:6379")
 	assert.NoError(t, err)
 	rc.Do("del", "test:active", "test:1", "test:2", "test:3")
@@ -60,6 +65,7 @@ func TestQueues(t *testing.T) {
 			assert.NoError(t, err)
 			assert.Equal(t, task.OrgID, tc.TaskGroup, "%d: groups mismatch", i)
 			assert.Equal(t, task.Type, tc.TaskType, "%d: types mismatch", i)
+			assert.Equal(t, trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"), task.TraceID, "%d: trace ID mismatch", i)
 
 			var value string
 			assert.NoError(t, json.Unmarshal(task.Task, &value), "%d: error unmarshalling", i)
@@ -67,7 +73,7 @@ func TestQueues(t *testing.T) {
 		} else if tc.Priority == markCompletePriority {
 			assert.NoError(t, MarkTaskComplete(rc, tc.Queue, tc.TaskGroup))
 		} else {
-			assert.NoError(t, AddTask(rc, tc.Queue, tc.TaskType, tc.TaskGroup, tc.Task, tc.Priority))
+			assert.NoError(t, AddTask(ctx, rc, tc.Queue, tc.TaskType, tc.TaskGroup, tc.Task, tc.Priority))
 		}
 
 		size, err := Size(rc, tc.Queue)
@@ -75,3 +81,98 @@ func TestQueues(t *testing.T) {
 		assert.Equal(t, tc.Size, size, "%d: mismatch", i)
 	}
 }
+
+func TestForwardTask(t *testing.T) {
+	ctx := trace.WithID(context.Background(), trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"))
+
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "test:active", "test:1", "forwarded:active", "forwarded:1")
+
+	assert.NoError(t, AddTask(ctx, rc, "test", "campaign", 1, "task1", DefaultPriority))
+
+	task, err := PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.NoError(t, MarkTaskComplete(rc, "test", 1))
+
+	assert.NoError(t, ForwardTask(rc, "forwarded", task))
+
+	size, err := Size(rc, "forwarded")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, size)
+
+	// task is unchanged, including when it was originally queued
+	forwarded, err := PopNextTask(rc, "forwarded")
+	assert.NoError(t, err)
+	assert.Equal(t, task, forwarded)
+}
+
+func TestDelayedTasks(t *testing.T) {
+	ctx := trace.WithID(context.Background(), trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"))
+
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "delayed_tasks", "test:active", "test:1", "test:2")
+
+	assert.NoError(t, AddDelayedTask(ctx, rc, "test", "cutoff_call", 1, "task1", DefaultPriority, time.Minute))
+	assert.NoError(t, AddDelayedTask(ctx, rc, "test", "cutoff_call", 2, "task2", DefaultPriority, time.Minute*5))
+
+	// nothing is due yet
+	count, err := QueueDelayedTasks(rc, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	size, err := Size(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, size)
+
+	// first task is due after a minute
+	count, err = QueueDelayedTasks(rc, time.Now().Add(time.Minute*2))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	task, err := PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, "cutoff_call", task.Type)
+	assert.Equal(t, 1, task.OrgID)
+	assert.Equal(t, trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"), task.TraceID)
+	assert.Equal(t, `"task1"`, string(task.Task))
+
+	// and isn't queued again
+	count, err = QueueDelayedTasks(rc, time.Now().Add(time.Minute*2))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestRequeueDelayedTask(t *testing.T) {
+	ctx := context.Background()
+
+	rc, err := redis.Dial("tcp", "localhost:6379")
+	assert.NoError(t, err)
+	rc.Do("del", "delayed_tasks", "test:active", "test:1")
+
+	assert.NoError(t, AddTask(ctx, rc, "test", "campaign", 1, "task1", DefaultPriority))
+
+	task, err := PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.NoError(t, MarkTaskComplete(rc, "test", 1))
+
+	task.ErrorCount = 2
+	assert.NoError(t, RequeueDelayedTask(rc, "test", task, time.Minute))
+
+	// nothing is due yet
+	count, err := QueueDelayedTasks(rc, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	count, err = QueueDelayedTasks(rc, time.Now().Add(time.Minute*2))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// task is requeued with its error count
+	requeued, err := PopNextTask(rc, "test")
+	assert.NoError(t, err)
+	assert.Equal(t, "campaign", requeued.Type)
+	assert.Equal(t, 2, requeued.ErrorCount)
+	assert.Equal(t, `"task1"`, string(requeued.Task))
+}
@@ -8,14 +8,12 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/gocommon/analytics"
 	"github.com/nyaruka/goflow/assets"
-	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/mailroom/core/goflow"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
-	"github.com/nyaruka/redisx"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -63,6 +61,12 @@ type TriggerBuilder func(contact *flows.Contact) flows.Trigger
 
 // ResumeFlow resumes the passed in session using the passed in session
 func ResumeFlow(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, session *models.Session, contact *models.Contact, resume flows.Resume, hook models.SessionCommitHook) (*models.Session, error) {
+	return ResumeFlowWithChanges(ctx, rt, oa, session, contact, resume, hook, nil)
+}
+
+// ResumeFlowWithChanges is like ResumeFlow but first lets the caller change the flow session, e.g. to record the outcome
+// of something the flow started which only finished after it had moved on
+func ResumeFlowWithChanges(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, session *models.Session, contact *models.Contact, resume flows.Resume, hook models.SessionCommitHook, change func(flows.Session) error) (*models.Session, error) {
 	start := time.Now()
 	sa := oa.SessionAssets()
 
@@ -83,6 +87,12 @@ func ResumeFlow(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets,
 		return nil, errors.Wrapf(err, "unable to create session from output")
 	}
 
+	if change != nil {
+		if err := change(fs); err != nil {
+			return nil, errors.Wrapf(err, "error changing session before resume")
+		}
+	}
+
 	// resume our session
 	sprint, err := fs.Resume(resume)
 
@@ -179,12 +189,9 @@ func StartFlowBatch(
 		}
 	}
 
-	var params *types.XObject
-	if len(batch.Extra()) > 0 {
-		params, err = types.ReadXObject(batch.Extra())
-		if err != nil {
-			return nil, errors.Wrap(err, "unable to read JSON from flow start extra")
-		}
+	params, err := batch.TriggerParams()
+	if err != nil {
+		return nil, err
 	}
 
 	var history *flows.SessionHistory
@@ -209,7 +216,7 @@ func StartFlowBatch(
 		}
 
 		tb := triggers.NewBuilder(oa.Env(), flow.Reference(), contact).Manual()
-		if batch.Extra() != nil {
+		if params != nil {
 			tb = tb.WithParams(params)
 		}
 		if batchStart {
@@ -218,12 +225,13 @@ func StartFlowBatch(
 		return tb.WithUser(flowUser).WithOrigin(startTypeToOrigin[batch.StartType()]).Build()
 	}
 
-	// before committing our runs we want to set the start they are associated with
+	// before committing our runs we want to set the start they are associated with and its metadata
 	updateStartID := func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, oa *models.OrgAssets, sessions []*models.Session) error {
-		// for each run in our sessions, set the start id
+		// for each run in our sessions, set the start id and metadata
 		for _, s := range sessions {
 			for _, r := range s.Runs() {
 				r.SetStartID(batch.StartID())
+				r.SetMetadata(batch.Metadata())
 			}
 		}
 		return nil
@@ -261,15 +269,6 @@ func FireCampaignEvents(
 
 	start := time.Now()
 
-	contactIDs := make([]models.ContactID, 0, len(fires))
-	fireMap := make(map[models.ContactID]*models.EventFire, len(fires))
-	skippedContacts := make(map[models.ContactID]*models.EventFire, len(fires))
-	for _, f := range fires {
-		contactIDs = append(contactIDs, f.ContactID)
-		fireMap[f.ContactID] = f
-		skippedContacts[f.ContactID] = f
-	}
-
 	// create our org assets
 	oa, err := models.GetOrgAssets(ctx, rt, orgID)
 	if err != nil {
@@ -302,6 +301,33 @@ func FireCampaignEvents(
 	}
 	dbFlow := flow.(*models.Flow)
 
+	// skip any fires whose contacts have been deleted, blocked, stopped or archived since they were scheduled
+	eligible, err := models.SkipIneligibleEventFires(ctx, rt.DB, fires, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// contacts whose fires were skipped are done with as far as the caller is concerned
+	handledContacts := make([]models.ContactID, 0, len(fires)-len(eligible))
+	for _, f := range fires {
+		if f.Fired != nil {
+			handledContacts = append(handledContacts, f.ContactID)
+		}
+	}
+
+	contactIDs := make([]models.ContactID, 0, len(eligible))
+	fireMap := make(map[models.ContactID]*models.EventFire, len(eligible))
+	skippedContacts := make(map[models.ContactID]*models.EventFire, len(eligible))
+	for _, f := range eligible {
+		contactIDs = append(contactIDs, f.ContactID)
+		fireMap[f.ContactID] = f
+		skippedContacts[f.ContactID] = f
+	}
+
+	if len(eligible) == 0 {
+		return handledContacts, nil
+	}
+
 	// our start options are based on the start mode for our event
 	options := NewStartOptions()
 	switch dbEvent.StartMode() {
@@ -324,13 +350,13 @@ func FireCampaignEvents(
 	// if this is an ivr flow, we need to create a task to perform the start there
 	if dbFlow.FlowType() == models.FlowTypeVoice {
 		// Trigger our IVR flow start
-		err := TriggerIVRFlow(ctx, rt, oa.OrgID(), dbFlow.ID(), contactIDs, func(ctx context.Context, tx *sqlx.Tx) error {
-			return models.MarkEventsFired(ctx, tx, fires, time.Now(), models.FireResultFired)
+		err := TriggerPacedIVRFlow(ctx, rt, oa.OrgID(), dbFlow.ID(), contactIDs, dbEvent.CallsPerMinute(), func(ctx context.Context, tx *sqlx.Tx) error {
+			return models.MarkEventsFired(ctx, tx, eligible, time.Now(), models.FireResultFired)
 		})
 		if err != nil {
 			return nil, errors.Wrapf(err, "error triggering ivr flow start")
 		}
-		return contactIDs, nil
+		return append(handledContacts, contactIDs...), nil
 	}
 
 	// our builder for the triggers that will be created for contacts
@@ -340,6 +366,12 @@ func FireCampaignEvents(
 		return triggers.NewBuilder(oa.Env(), flowRef, contact).Campaign(campaign, eventUUID).Build()
 	}
 
+	// contacts we don't build triggers for are those excluded for being in a flow
+	skipReason := models.NilFireSkipReason
+	if options.ExcludeInAFlow {
+		skipReason = models.FireSkipInFlow
+	}
+
 	// this is our pre commit callback for our sessions, we'll mark the event fires associated
 	// with the passed in sessions as complete in the same transaction
 	fired := time.Now()
@@ -367,7 +399,7 @@ func FireCampaignEvents(
 		}
 
 		// and mark those as skipped
-		err = models.MarkEventsFired(ctx, tx, fires, fired, models.FireResultSkipped)
+		err = models.MarkEventsSkipped(ctx, tx, fires, fired, skipReason)
 		if err != nil {
 			return errors.Wrapf(err, "error marking events skipped")
 		}
@@ -386,7 +418,7 @@ func FireCampaignEvents(
 		for _, e := range skippedContacts {
 			fires = append(fires, e)
 		}
-		err = models.MarkEventsFired(ctx, rt.DB, fires, fired, models.FireResultSkipped)
+		err = models.MarkEventsSkipped(ctx, rt.DB, fires, fired, skipReason)
 		if err != nil {
 			logrus.WithField("fire_ids", fires).WithError(err).Errorf("error marking events as skipped: %s", eventUUID)
 		}
@@ -397,11 +429,10 @@ func FireCampaignEvents(
 	analytics.Gauge("mr.campaign_event_count", float64(len(sessions)))
 
 	// build the list of contacts actually started
-	startedContacts := make([]models.ContactID, len(sessions))
-	for i := range sessions {
-		startedContacts[i] = sessions[i].ContactID()
+	for _, s := range sessions {
+		handledContacts = append(handledContacts, s.ContactID())
 	}
-	return startedContacts, nil
+	return handledContacts, nil
 }
 
 // StartFlow runs the passed in flow for the passed in contact
@@ -461,22 +492,20 @@ func StartFlow(
 	start := time.Now()
 
 	// map of locks we've released
-	released := make(map[*redisx.Locker]bool)
+	released := make(map[*models.ContactLock]bool)
 
 	for len(remaining) > 0 && time.Since(start) < time.Minute*5 {
 		locked := make([]models.ContactID, 0, len(remaining))
-		locks := make([]string, 0, len(remaining))
+		locks := make([]*models.ContactLock, 0, len(remaining))
 		skipped := make([]models.ContactID, 0, 5)
 
 		// try up to a second to get a lock for a contact
 		for _, contactID := range remaining {
-			locker := models.GetContactLocker(oa.OrgID(), contactID)
-
-			lock, err := locker.Grab(rt.RP, time.Second)
+			lock, err := models.LockContact(rt, oa.OrgID(), contactID, "start_flow", time.Second)
 			if err != nil {
 				return nil, errors.Wrapf(err, "error attempting to grab lock")
 			}
-			if lock == "" {
+			if lock == nil {
 				skipped = append(skipped, contactID)
 				continue
 			}
@@ -485,8 +514,8 @@ func StartFlow(
 
 			// defer unlocking if we exit due to error
 			defer func() {
-				if !released[locker] {
-					locker.Release(rt.RP, lock)
+				if !released[lock] {
+					lock.Release(rt)
 				}
 			}()
 		}
@@ -517,10 +546,9 @@ func StartFlow(
 		sessions = append(sessions, ss...)
 
 		// release all our locks
-		for i := range locked {
-			locker := models.GetContactLocker(oa.OrgID(), locked[i])
-			locker.Release(rt.RP, locks[i])
-			released[locker] = true
+		for _, lock := range locks {
+			lock.Release(rt)
+			released[lock] = true
 		}
 
 		// skipped are now our remaining
@@ -716,6 +744,12 @@ type DBHook func(ctx context.Context, tx *sqlx.Tx) error
 // TriggerIVRFlow will create a new flow start with the passed in flow and set of contacts. This will cause us to
 // request calls to start, which once we get the callback will trigger our actual flow to start.
 func TriggerIVRFlow(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, flowID models.FlowID, contactIDs []models.ContactID, hook DBHook) error {
+	return TriggerPacedIVRFlow(ctx, rt, orgID, flowID, contactIDs, 0, hook)
+}
+
+// TriggerPacedIVRFlow is like TriggerIVRFlow but the calls are spread out so that only the given number of calls are
+// requested per minute. Calls waiting their turn are held as throttled and requested by the IVR retry cron when due.
+func TriggerPacedIVRFlow(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, flowID models.FlowID, contactIDs []models.ContactID, callsPerMinute int, hook DBHook) error {
 	tx, _ := rt.DB.BeginTxx(ctx, nil)
 
 	// create our start
@@ -746,12 +780,12 @@ func TriggerIVRFlow(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID
 	}
 
 	// create our batch of all our contacts
-	task := start.CreateBatch(contactIDs, true, len(contactIDs))
+	task := start.CreateBatch(contactIDs, true, len(contactIDs)).WithCallsPerMinute(callsPerMinute)
 
 	// queue this to our ivr starter, it will take care of creating the calls then calling back in
 	rc := rt.RP.Get()
 	defer rc.Close()
-	err = queue.AddTask(rc, queue.BatchQueue, queue.StartIVRFlowBatch, int(orgID), task, queue.HighPriority)
+	err = queue.AddTask(ctx, rc, queue.BatchQueue, queue.StartIVRFlowBatch, int(orgID), task, queue.HighPriority)
 	if err != nil {
 		return errors.Wrapf(err, "error queuing ivr flow start")
 	}
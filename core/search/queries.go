@@ -26,7 +26,7 @@ func BuildStartQuery(oa *models.OrgAssets, flow *models.Flow, groups []*models.G
 	var err error
 
 	if userQuery != "" {
-		parsedQuery, err = contactql.ParseQuery(oa.Env(), userQuery, oa.SessionAssets())
+		parsedQuery, err = contactql.ParseQuery(oa.Env(), userQuery, NewResolver(oa))
 		if err != nil {
 			return "", errors.Wrap(err, "invalid user query")
 		}
@@ -0,0 +1,27 @@
+package search
+
+import (
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/mailroom/core/models"
+)
+
+// resolver is a query resolver which hides fields that can't be searched on, i.e. sensitive fields whose values are
+// encrypted and so aren't indexed
+type resolver struct {
+	contactql.Resolver
+	org *models.Org
+}
+
+// NewResolver creates a new query resolver for the given org
+func NewResolver(oa *models.OrgAssets) contactql.Resolver {
+	return &resolver{Resolver: oa.SessionAssets(), org: oa.Org()}
+}
+
+// ResolveField resolves the field with the given key unless it is sensitive
+func (r *resolver) ResolveField(key string) assets.Field {
+	if r.org.IsSensitiveField(key) {
+		return nil
+	}
+	return r.Resolver.ResolveField(key)
+}
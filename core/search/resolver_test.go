@@ -0,0 +1,37 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/search"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"field_encryption": {"key": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=", "fields": ["gender"]}}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	resolver := search.NewResolver(oa)
+	assert.Nil(t, resolver.ResolveField("gender"))
+	assert.NotNil(t, resolver.ResolveField("age"))
+	assert.NotNil(t, resolver.ResolveGroup("Doctors"))
+
+	// sensitive fields can't be searched on
+	_, err = contactql.ParseQuery(oa.Env(), "gender = M", resolver)
+	assert.EqualError(t, err, "can't resolve 'gender' to attribute, scheme or field")
+
+	_, err = contactql.ParseQuery(oa.Env(), "age > 18", resolver)
+	assert.NoError(t, err)
+}
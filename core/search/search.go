@@ -78,7 +78,7 @@ func GetContactIDsForQueryPage(ctx context.Context, client *elastic.Client, oa *
 	}
 
 	if query != "" {
-		parsed, err = contactql.ParseQuery(env, query, oa.SessionAssets())
+		parsed, err = contactql.ParseQuery(env, query, NewResolver(oa))
 		if err != nil {
 			return nil, nil, 0, errors.Wrapf(err, "error parsing query: %s", query)
 		}
@@ -86,7 +86,7 @@ func GetContactIDsForQueryPage(ctx context.Context, client *elastic.Client, oa *
 
 	eq := BuildElasticQuery(oa, group, models.NilContactStatus, excludeIDs, parsed)
 
-	fieldSort, err := es.ToElasticFieldSort(sort, oa.SessionAssets())
+	fieldSort, err := es.ToElasticFieldSort(sort, NewResolver(oa))
 	if err != nil {
 		return nil, nil, 0, errors.Wrapf(err, "error parsing sort")
 	}
@@ -126,7 +126,7 @@ func GetContactIDsForQuery(ctx context.Context, client *elastic.Client, oa *mode
 	}
 
 	// turn into elastic query
-	parsed, err := contactql.ParseQuery(env, query, oa.SessionAssets())
+	parsed, err := contactql.ParseQuery(env, query, NewResolver(oa))
 	if err != nil {
 		return nil, errors.Wrapf(err, "error parsing query: %s", query)
 	}
@@ -145,27 +145,93 @@ func GetContactIDsForQuery(ctx context.Context, client *elastic.Client, oa *mode
 	}
 
 	// for larger limits, use scroll service
-	// note that this is no longer recommended, see https://www.elastic.co/guide/en/elasticsearch/reference/current/scroll-api.html
 	scroll := client.Scroll("contacts").Routing(routing).KeepAlive("15m").Size(10000).Query(eq).FetchSource(false)
+	_, err = scrollContactIDs(ctx, scroll, func(batch []models.ContactID) error {
+		ids = append(ids, batch...)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error scrolling through results for search: %s", query)
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"org_id":      oa.OrgID(),
+		"query":       query,
+		"elapsed":     time.Since(start),
+		"match_count": len(ids),
+	}).Debug("contact query complete")
+
+	return ids, nil
+}
+
+// StreamContactIDsForQuery scrolls through all the contact ids that match the given query and sort, passing each batch
+// to the given callback so that callers can process very large result sets without holding them all in memory.
+func StreamContactIDsForQuery(ctx context.Context, client *elastic.Client, oa *models.OrgAssets, group *models.Group, excludeIDs []models.ContactID, query string, sort string, callback func([]models.ContactID) error) (*contactql.ContactQuery, int64, error) {
+	env := oa.Env()
+	start := time.Now()
+	var parsed *contactql.ContactQuery
+	var err error
+
+	if client == nil {
+		return nil, 0, errors.Errorf("no elastic client available, check your configuration")
+	}
+
+	if query != "" {
+		parsed, err = contactql.ParseQuery(env, query, NewResolver(oa))
+		if err != nil {
+			return nil, 0, errors.Wrapf(err, "error parsing query: %s", query)
+		}
+	}
+
+	eq := BuildElasticQuery(oa, group, models.NilContactStatus, excludeIDs, parsed)
+
+	fieldSort, err := es.ToElasticFieldSort(sort, NewResolver(oa))
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "error parsing sort")
+	}
+
+	routing := strconv.FormatInt(int64(oa.OrgID()), 10)
+	scroll := client.Scroll("contacts").Routing(routing).KeepAlive("15m").Size(streamBatchSize).Query(eq).SortBy(fieldSort).FetchSource(false)
+
+	total, err := scrollContactIDs(ctx, scroll, callback)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "error scrolling through results for search: %s", query)
+	}
+
+	logrus.WithFields(logrus.Fields{"org_id": oa.OrgID(), "query": query, "elapsed": time.Since(start), "total_count": total}).Debug("streamed contact query complete")
+
+	return parsed, total, nil
+}
+
+// the number of hits we fetch per scroll request when streaming results
+const streamBatchSize = 1000
+
+// utility to page through all the results of a scroll, passing the contact ids in each page to the callback, and
+// returning the total number of hits
+func scrollContactIDs(ctx context.Context, scroll *elastic.ScrollService, callback func([]models.ContactID) error) (int64, error) {
+	// note that this is no longer recommended, see https://www.elastic.co/guide/en/elasticsearch/reference/current/scroll-api.html
+	var total int64
+
 	for {
 		results, err := scroll.Do(ctx)
 		if err == io.EOF {
-			logrus.WithFields(logrus.Fields{
-				"org_id":      oa.OrgID(),
-				"query":       query,
-				"elapsed":     time.Since(start),
-				"match_count": len(ids),
-			}).Debug("contact query complete")
-
-			return ids, nil
+			return total, nil
 		}
 		if err != nil {
-			return nil, errors.Wrapf(err, "error scrolling through results for search: %s", query)
+			return 0, err
 		}
 
-		ids, err = appendIDsFromHits(ids, results.Hits.Hits)
+		ids, err := appendIDsFromHits(make([]models.ContactID, 0, len(results.Hits.Hits)), results.Hits.Hits)
 		if err != nil {
-			return nil, err
+			return 0, err
+		}
+
+		if results.Hits.TotalHits != nil {
+			total = results.Hits.TotalHits.Value
+		}
+
+		if err := callback(ids); err != nil {
+			return 0, err
 		}
 	}
 }
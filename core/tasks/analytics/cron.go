@@ -6,6 +6,7 @@ import (
 
 	"github.com/nyaruka/gocommon/analytics"
 	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/ivr/state"
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/sirupsen/logrus"
@@ -21,6 +22,9 @@ var (
 	dbWaitCount       int64
 	redisWaitDuration time.Duration
 	redisWaitCount    int64
+
+	// as are our counts of IVR call state operations
+	ivrStateStats state.Stats
 )
 
 // calculates a bunch of stats every minute and both logs them and sends them to librato
@@ -60,6 +64,12 @@ func reportAnalytics(ctx context.Context, rt *runtime.Runtime) error {
 	redisWaitDuration = redisStats.WaitDuration
 	redisWaitCount = redisStats.WaitCount
 
+	stateStats := state.GetStats()
+	ivrStateSetsInPeriod := stateStats.Sets - ivrStateStats.Sets
+	ivrStateHitsInPeriod := stateStats.Hits - ivrStateStats.Hits
+	ivrStateMissesInPeriod := stateStats.Misses - ivrStateStats.Misses
+	ivrStateStats = stateStats
+
 	analytics.Gauge("mr.db_busy", float64(dbStats.InUse))
 	analytics.Gauge("mr.db_idle", float64(dbStats.Idle))
 	analytics.Gauge("mr.db_wait_ms", float64(dbWaitDurationInPeriod/time.Millisecond))
@@ -68,6 +78,9 @@ func reportAnalytics(ctx context.Context, rt *runtime.Runtime) error {
 	analytics.Gauge("mr.redis_wait_count", float64(redisWaitCountInPeriod))
 	analytics.Gauge("mr.handler_queue", float64(handlerSize))
 	analytics.Gauge("mr.batch_queue", float64(batchSize))
+	analytics.Gauge("mr.ivr_state_sets", float64(ivrStateSetsInPeriod))
+	analytics.Gauge("mr.ivr_state_hits", float64(ivrStateHitsInPeriod))
+	analytics.Gauge("mr.ivr_state_misses", float64(ivrStateMissesInPeriod))
 
 	logrus.WithFields(logrus.Fields{
 		"db_busy":          dbStats.InUse,
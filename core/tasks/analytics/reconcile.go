@@ -0,0 +1,62 @@
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the local hour of the night in which an org's analytics for the previous day are reconciled
+const reconcileAnalyticsHour = 1
+
+func init() {
+	mailroom.RegisterCron("reconcile_analytics", time.Hour, false, ReconcileAnalytics)
+}
+
+// ReconcileAnalytics recalculates the analytics rollups for the previous day of each org for which it's currently
+// the early hours of the morning, so that each org is reconciled once a night in its own timezone
+func ReconcileAnalytics(ctx context.Context, rt *runtime.Runtime) error {
+	start := time.Now()
+
+	orgs, err := models.LoadActiveOrgTimezones(ctx, rt.DB)
+	if err != nil {
+		return err
+	}
+
+	numReconciled := 0
+
+	for _, o := range orgs {
+		tz, err := time.LoadLocation(o.Timezone)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", o.OrgID).Error("error loading timezone for org")
+			continue
+		}
+
+		now := dates.Now().In(tz)
+		if now.Hour() != reconcileAnalyticsHour {
+			continue
+		}
+
+		oa, err := models.GetOrgAssets(ctx, rt, o.OrgID)
+		if err != nil {
+			return errors.Wrapf(err, "error loading org assets for org #%d", o.OrgID)
+		}
+
+		yesterday := dates.ExtractDate(now.AddDate(0, 0, -1))
+
+		if err := models.ReconcileAnalytics(ctx, rt.DB, oa, yesterday); err != nil {
+			return errors.Wrapf(err, "error reconciling analytics for org #%d", o.OrgID)
+		}
+
+		numReconciled++
+	}
+
+	logrus.WithFields(logrus.Fields{"elapsed": time.Since(start), "orgs": numReconciled}).Info("reconciled org analytics")
+	return nil
+}
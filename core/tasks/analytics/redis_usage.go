@@ -0,0 +1,60 @@
+package analytics
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/nyaruka/gocommon/analytics"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// number of orgs with the highest redis usage which are logged
+const redisUsageTopOrgs = 10
+
+func init() {
+	mailroom.RegisterCron("org_redis_usage", time.Minute*15, false, ReportOrgRedisUsage)
+}
+
+// ReportOrgRedisUsage calculates and records how many redis keys each org has and how much memory they use, so that
+// orgs using more than their share can be identified
+func ReportOrgRedisUsage(ctx context.Context, rt *runtime.Runtime) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	start := time.Now()
+
+	usages, err := models.CalculateOrgRedisUsage(rc)
+	if err != nil {
+		return errors.Wrap(err, "error calculating org redis usage")
+	}
+
+	if err := models.SetOrgRedisUsages(rc, usages); err != nil {
+		return err
+	}
+
+	orgIDs := make([]models.OrgID, 0, len(usages))
+	totalKeys, totalBytes := 0, int64(0)
+	for orgID, usage := range usages {
+		orgIDs = append(orgIDs, orgID)
+		totalKeys += usage.Keys
+		totalBytes += usage.Bytes
+	}
+
+	// log the orgs using the most memory
+	sort.Slice(orgIDs, func(i, j int) bool { return usages[orgIDs[i]].Bytes > usages[orgIDs[j]].Bytes })
+	for i := 0; i < len(orgIDs) && i < redisUsageTopOrgs; i++ {
+		usage := usages[orgIDs[i]]
+		logrus.WithFields(logrus.Fields{"org_id": orgIDs[i], "keys": usage.Keys, "bytes": usage.Bytes}).Info("org redis usage")
+	}
+
+	analytics.Gauge("mr.redis_org_keys", float64(totalKeys))
+	analytics.Gauge("mr.redis_org_bytes", float64(totalBytes))
+
+	logrus.WithFields(logrus.Fields{"elapsed": time.Since(start), "orgs": len(usages), "keys": totalKeys, "bytes": totalBytes}).Info("calculated org redis usage")
+	return nil
+}
@@ -0,0 +1,255 @@
+package contacts
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/search"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TypeExportGroups is the type of the task to export a set of groups
+	TypeExportGroups = "export_groups"
+
+	// TypeImportGroups is the type of the task to import groups exported from another org
+	TypeImportGroups = "import_groups"
+)
+
+// how many groups we process between saving a group job's progress
+const groupJobsBatchSize = 10
+
+func init() {
+	tasks.RegisterType(TypeExportGroups, func() tasks.Task { return &ExportGroupsTask{} })
+	tasks.RegisterType(TypeImportGroups, func() tasks.Task { return &ImportGroupsTask{} })
+}
+
+// ExportGroupsTask is our task to export a set of groups as a JSON file, with manual groups as the UUIDs of their
+// contacts and smart groups as their queries. The file is saved to attachment storage and its URL recorded on the job.
+type ExportGroupsTask struct {
+	JobUUID  uuids.UUID       `json:"job_uuid"  validate:"required"`
+	GroupIDs []models.GroupID `json:"group_ids" validate:"required"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ExportGroupsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *ExportGroupsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	start := time.Now()
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	job, err := startGroupJob(rc, orgID, t.JobUUID)
+	if err != nil {
+		return err
+	}
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, orgID, models.RefreshGroups)
+	if err != nil {
+		return failGroupJob(rc, orgID, job, errors.Wrap(err, "error loading org assets"))
+	}
+
+	exported := make([]*models.ExportedGroup, 0, len(t.GroupIDs))
+
+	for i, groupID := range t.GroupIDs {
+		group := oa.GroupByID(groupID)
+		result := &models.GroupJobResult{}
+
+		if group == nil || (group.Type() != models.GroupTypeManual && group.Type() != models.GroupTypeSmart) {
+			result.Error = fmt.Sprintf("no such group: %d", groupID)
+		} else {
+			g, err := models.ExportGroup(ctx, rt.DB, group)
+			if err != nil {
+				return failGroupJob(rc, orgID, job, err)
+			}
+			exported = append(exported, g)
+
+			result.UUID, result.Name, result.Query, result.Members = g.UUID, g.Name, g.Query, len(g.Contacts)
+		}
+
+		job.AddResult(result)
+
+		if (i+1)%groupJobsBatchSize == 0 {
+			if err := models.SetGroupJob(rc, orgID, job); err != nil {
+				return err
+			}
+		}
+	}
+
+	data := jsonx.MustMarshal(map[string]interface{}{"groups": exported})
+
+	job.URL, err = rt.AttachmentStorage.Put(ctx, models.GroupJobPath(rt, orgID, job.UUID, "groups.json"), "application/json", data)
+	if err != nil {
+		return failGroupJob(rc, orgID, job, errors.Wrap(err, "error saving groups file"))
+	}
+
+	job.Complete()
+
+	if err := models.SetGroupJob(rc, orgID, job); err != nil {
+		return err
+	}
+
+	logGroupJob(orgID, job, time.Since(start))
+	return nil
+}
+
+// ImportGroupsTask is our task to import groups from an uploaded file like that produced by an export. Groups which
+// already exist in the org, by UUID or name, are reused. Contacts of manual groups are matched by UUID, and new smart
+// groups are populated from their queries.
+type ImportGroupsTask struct {
+	JobUUID uuids.UUID    `json:"job_uuid" validate:"required"`
+	UserID  models.UserID `json:"user_id"  validate:"required"`
+	Upload  string        `json:"upload"   validate:"required"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ImportGroupsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *ImportGroupsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	start := time.Now()
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	job, err := startGroupJob(rc, orgID, t.JobUUID)
+	if err != nil {
+		return err
+	}
+
+	_, upload, err := rt.AttachmentStorage.Get(ctx, t.Upload)
+	if err != nil {
+		return failGroupJob(rc, orgID, job, errors.Wrap(err, "error fetching uploaded groups file"))
+	}
+
+	groups, err := ReadUploadedGroups(upload)
+	if err != nil {
+		// an invalid upload isn't a problem with the task itself so just record it on the job
+		failGroupJob(rc, orgID, job, err)
+		return nil
+	}
+	job.Total = len(groups)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, orgID, models.RefreshFields|models.RefreshGroups)
+	if err != nil {
+		return failGroupJob(rc, orgID, job, errors.Wrap(err, "error loading org assets"))
+	}
+
+	for i, g := range groups {
+		result := &models.GroupJobResult{UUID: g.UUID, Name: g.Name, Query: g.Query}
+
+		if err := t.importGroup(ctx, rt, rc, oa, g, result); err != nil {
+			return failGroupJob(rc, orgID, job, err)
+		}
+
+		job.AddResult(result)
+
+		if (i+1)%groupJobsBatchSize == 0 {
+			if err := models.SetGroupJob(rc, orgID, job); err != nil {
+				return err
+			}
+		}
+	}
+
+	job.Complete()
+
+	if err := models.SetGroupJob(rc, orgID, job); err != nil {
+		return err
+	}
+
+	logGroupJob(orgID, job, time.Since(start))
+	return nil
+}
+
+// imports a single group. Problems with the group are recorded on the result whereas an error is only returned if we
+// couldn't save it.
+func (t *ImportGroupsTask) importGroup(ctx context.Context, rt *runtime.Runtime, rc redis.Conn, oa *models.OrgAssets, g *models.ExportedGroup, result *models.GroupJobResult) error {
+	// queries may reference fields which don't exist in this org
+	if g.Query != "" {
+		if _, err := contactql.ParseQuery(oa.Env(), g.Query, search.NewResolver(oa)); err != nil {
+			result.Error = errors.Wrap(err, "invalid group query").Error()
+			return nil
+		}
+	}
+
+	groupID, err := models.ImportGroup(ctx, rt.DB, oa, t.UserID, g, result)
+	if err != nil {
+		return err
+	}
+
+	if groupID != models.NilGroupID && result.Created && g.Query != "" {
+		task := &PopulateDynamicGroupTask{GroupID: groupID, Query: g.Query}
+		if err := queue.AddTask(ctx, rc, queue.BatchQueue, TypePopulateDynamicGroup, int(oa.OrgID()), task, queue.DefaultPriority); err != nil {
+			return errors.Wrapf(err, "error queuing population of group %s", g.Name)
+		}
+	}
+	return nil
+}
+
+// the file of groups produced by an export
+type groupsFile struct {
+	Groups []*models.ExportedGroup `json:"groups" validate:"required,min=1,dive"`
+}
+
+// ReadUploadedGroups reads an uploaded file of groups like that produced by an export
+func ReadUploadedGroups(data []byte) ([]*models.ExportedGroup, error) {
+	file := &groupsFile{}
+
+	if err := utils.UnmarshalAndValidate(data, file); err != nil {
+		return nil, errors.Wrap(err, "invalid groups file")
+	}
+	return file.Groups, nil
+}
+
+func startGroupJob(rc redis.Conn, orgID models.OrgID, jobUUID uuids.UUID) (*models.GroupJob, error) {
+	job, err := models.GetGroupJob(rc, orgID, jobUUID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, errors.Errorf("no group job with UUID %s for org #%d", jobUUID, orgID)
+	}
+
+	job.Status = models.GroupJobStatusInProgress
+
+	return job, models.SetGroupJob(rc, orgID, job)
+}
+
+// marks the given job as failed, returning the error which caused it to fail
+func failGroupJob(rc redis.Conn, orgID models.OrgID, job *models.GroupJob, err error) error {
+	job.Fail(err.Error())
+
+	if serr := models.SetGroupJob(rc, orgID, job); serr != nil {
+		logrus.WithError(serr).WithField("org_id", orgID).Error("error saving failed group job")
+	}
+	return err
+}
+
+func logGroupJob(orgID models.OrgID, job *models.GroupJob, elapsed time.Duration) {
+	logrus.WithFields(logrus.Fields{
+		"org_id":    orgID,
+		"elapsed":   elapsed,
+		"type":      job.Type,
+		"total":     job.Total,
+		"succeeded": job.Succeeded,
+		"failed":    job.Failed,
+	}).Info("completed group job")
+}
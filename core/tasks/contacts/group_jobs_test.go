@@ -0,0 +1,119 @@
+package contacts_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupJobs(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis | testsuite.ResetStorage)
+
+	db.MustExec(`DELETE FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1`, testdata.TestersGroup.ID)
+	db.MustExec(`INSERT INTO contacts_contactgroup_contacts(contactgroup_id, contact_id) VALUES($1, $2), ($1, $3)`, testdata.TestersGroup.ID, testdata.Cathy.ID, testdata.Bob.ID)
+	smart := testdata.InsertContactGroup(db, testdata.Org1, "4cb9a3a1-9f6e-4f2c-9d6b-5d0b6c1b1a5e", "Females", `gender = "F"`)
+
+	// export a manual group, a smart group and a group which doesn't exist
+	job := models.NewGroupJob(models.GroupJobTypeExport, 3)
+	require.NoError(t, models.SetGroupJob(rc, testdata.Org1.ID, job))
+
+	exportTask := &contacts.ExportGroupsTask{JobUUID: job.UUID, GroupIDs: []models.GroupID{testdata.TestersGroup.ID, smart.ID, 12345}}
+	require.NoError(t, exportTask.Perform(ctx, rt, testdata.Org1.ID))
+
+	job, err := models.GetGroupJob(rc, testdata.Org1.ID, job.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, models.GroupJobStatusComplete, job.Status)
+	assert.Equal(t, 2, job.Succeeded)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, 2, job.Results[0].Members)
+	assert.Equal(t, "no such group: 12345", job.Results[2].Error)
+	assert.NotEqual(t, "", job.URL)
+
+	exportPath := models.GroupJobPath(rt, testdata.Org1.ID, job.UUID, "groups.json")
+	_, data, err := rt.AttachmentStorage.Get(ctx, exportPath)
+	require.NoError(t, err)
+
+	groups, err := contacts.ReadUploadedGroups(data)
+	require.NoError(t, err)
+	assert.Len(t, groups, 2)
+	assert.Equal(t, `gender = "F"`, groups[1].Query)
+
+	// import them into the other org where the UUIDs are already taken and the contacts don't exist
+	db.MustExec(`UPDATE contacts_contactfield SET is_active = FALSE WHERE org_id = $1 AND key = 'gender'`, testdata.Org2.ID)
+
+	job = models.NewGroupJob(models.GroupJobTypeImport, 2)
+	require.NoError(t, models.SetGroupJob(rc, testdata.Org2.ID, job))
+
+	importTask := &contacts.ImportGroupsTask{JobUUID: job.UUID, UserID: testdata.Admin.ID, Upload: exportPath}
+	require.NoError(t, importTask.Perform(ctx, rt, testdata.Org2.ID))
+
+	job, err = models.GetGroupJob(rc, testdata.Org2.ID, job.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, models.GroupJobStatusComplete, job.Status)
+	assert.True(t, job.Results[0].Created)
+	assert.NotEqual(t, testdata.TestersGroup.UUID, job.Results[0].UUID)
+	assert.Equal(t, 0, job.Results[0].Members)
+	assert.Equal(t, 2, job.Results[0].Missing)
+
+	// org 2 doesn't have a gender field so the smart group can't be imported
+	assert.Equal(t, 1, job.Failed)
+	assert.Contains(t, job.Results[1].Error, "invalid group query")
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactgroup WHERE org_id = $1 AND name = 'Testers'`, testdata.Org2.ID).Returns(1)
+
+	// import them back into the same org where the groups already exist
+	db.MustExec(`DELETE FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1`, testdata.TestersGroup.ID)
+	models.FlushCache()
+
+	job = models.NewGroupJob(models.GroupJobTypeImport, 2)
+	require.NoError(t, models.SetGroupJob(rc, testdata.Org1.ID, job))
+
+	importTask = &contacts.ImportGroupsTask{JobUUID: job.UUID, UserID: testdata.Admin.ID, Upload: exportPath}
+	require.NoError(t, importTask.Perform(ctx, rt, testdata.Org1.ID))
+
+	job, err = models.GetGroupJob(rc, testdata.Org1.ID, job.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, job.Succeeded)
+	assert.False(t, job.Results[0].Created)
+	assert.Equal(t, 2, job.Results[0].Members)
+	assert.False(t, job.Results[1].Created)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactgroup_contacts WHERE contactgroup_id = $1`, testdata.TestersGroup.ID).Returns(2)
+
+	// existing smart groups aren't repopulated
+	task, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Nil(t, task)
+
+	// a smart group which doesn't exist is created and populated
+	upload := models.GroupJobPath(rt, testdata.Org1.ID, job.UUID, "upload.json")
+	_, err = rt.AttachmentStorage.Put(ctx, upload, "application/json", jsonx.MustMarshal(map[string]interface{}{
+		"groups": []*models.ExportedGroup{{UUID: "0d4f5b8f-9b7c-4b45-a5b0-98ad79d0a0a4", Name: "Women", Query: `gender = "F"`}},
+	}))
+	require.NoError(t, err)
+
+	job = models.NewGroupJob(models.GroupJobTypeImport, 1)
+	require.NoError(t, models.SetGroupJob(rc, testdata.Org1.ID, job))
+
+	importTask = &contacts.ImportGroupsTask{JobUUID: job.UUID, UserID: testdata.Admin.ID, Upload: upload}
+	require.NoError(t, importTask.Perform(ctx, rt, testdata.Org1.ID))
+
+	assertdb.Query(t, db, `SELECT status FROM contacts_contactgroup WHERE uuid = '0d4f5b8f-9b7c-4b45-a5b0-98ad79d0a0a4'`).Returns("I")
+
+	task, err = queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, contacts.TypePopulateDynamicGroup, task.Type)
+}
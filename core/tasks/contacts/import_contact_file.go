@@ -0,0 +1,173 @@
+package contacts
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeImportContactFile is the type of the import contact file task
+const TypeImportContactFile = "import_contact_file"
+
+// maximum size of an import file that we'll read
+const maxImportFileBytes = 50 * 1024 * 1024
+
+func init() {
+	tasks.RegisterType(TypeImportContactFile, func() tasks.Task { return &ImportContactFileTask{} })
+}
+
+// ImportContactFileTask is our task to parse the uploaded CSV or XLSX file of an import into batches, which are then
+// queued for importing like batches created upstream
+type ImportContactFileTask struct {
+	ContactImportID models.ContactImportID `json:"contact_import_id" validate:"required"`
+	FileURL         string                 `json:"file_url"          validate:"required,url"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ImportContactFileTask) Timeout() time.Duration {
+	return time.Minute * 30
+}
+
+// Perform downloads and parses the import file and queues its batches
+func (t *ImportContactFileTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	imp, err := models.LoadContactImport(ctx, rt.DB, t.ContactImportID)
+	if err != nil {
+		return err
+	}
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, orgID, models.RefreshGroups)
+	if err != nil {
+		return errors.Wrap(err, "error loading org assets")
+	}
+
+	batchIDs, err := t.createBatches(ctx, rt, oa, imp)
+	if err != nil {
+		// a file we can't read means the import can't happen so mark it as failed and let the user know
+		if err := imp.MarkFinished(ctx, rt.DB, models.ContactImportStatusFailed); err != nil {
+			return errors.Wrap(err, "error marking import as failed")
+		}
+		if err := models.NotifyImportFinished(ctx, rt.DB, imp); err != nil {
+			return errors.Wrap(err, "error creating import finished notification")
+		}
+		return errors.Wrapf(err, "unable to parse file of contact import %d", t.ContactImportID)
+	}
+
+	if len(batchIDs) == 0 {
+		if err := imp.MarkFinished(ctx, rt.DB, models.ContactImportStatusComplete); err != nil {
+			return errors.Wrap(err, "error marking import as finished")
+		}
+		return errors.Wrap(models.NotifyImportFinished(ctx, rt.DB, imp), "error creating import finished notification")
+	}
+
+	// orgs which require approval of imports have them staged until someone approves them
+	if oa.Org().ContactImportApproval() {
+		return stageImport(ctx, rt, oa, imp)
+	}
+
+	return QueueImportBatches(ctx, rt, imp, batchIDs)
+}
+
+// stages an import whose batches have been created by working out what it would do, so that it can be approved
+func stageImport(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, imp *models.ContactImport) error {
+	summary, err := models.SummarizeContactImport(ctx, rt.DB, oa, imp.ID)
+	if err != nil {
+		return errors.Wrap(err, "error summarizing contact import")
+	}
+
+	if err := imp.MarkStaged(ctx, rt.DB); err != nil {
+		return err
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.SetStagedContactImport(rc, imp.ID, summary); err != nil {
+		return err
+	}
+
+	logrus.WithField("import_id", imp.ID).WithField("creates", summary.Creates).WithField("updates", summary.Updates).Info("staged contact import for approval")
+	return nil
+}
+
+// QueueImportBatches queues the given batches of an import to be imported
+func QueueImportBatches(ctx context.Context, rt *runtime.Runtime, imp *models.ContactImport, batchIDs []models.ContactImportBatchID) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	// batch tasks decrement this as they complete so the last one can mark the import as finished
+	if _, err := rc.Do("SET", fmt.Sprintf("contact_import_batches_remaining:%d", imp.ID), len(batchIDs), "EX", 60*60*24*7); err != nil {
+		return errors.Wrap(err, "error setting remaining batch count")
+	}
+
+	for _, batchID := range batchIDs {
+		task := &ImportContactBatchTask{ContactImportBatchID: batchID}
+		if err := queue.AddTask(ctx, rc, queue.BatchQueue, TypeImportContactBatch, int(imp.OrgID), task, queue.DefaultPriority); err != nil {
+			return errors.Wrapf(err, "error queuing import batch %d", batchID)
+		}
+	}
+
+	logrus.WithField("import_id", imp.ID).WithField("batches", len(batchIDs)).Info("queued batches of contact import")
+	return nil
+}
+
+// fetches an import file from the given URL, using basic auth if a username is provided, and restricting which hosts can
+// be fetched from if an access config is provided
+func fetchImportFile(ctx context.Context, rt *runtime.Runtime, fileURL, username, password string, access *httpx.AccessConfig) (models.ContactImportRecordReader, func(), error) {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid file URL")
+	}
+
+	headers := map[string]string{}
+	if username != "" {
+		headers["Authorization"] = "Basic " + httpx.BasicAuth(username, password)
+	}
+
+	req, err := httpx.NewRequest(http.MethodGet, fileURL, nil, headers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, retries, _ := goflow.HTTP(rt.Config)
+
+	resp, err := httpx.Do(client, req.WithContext(ctx), retries, access)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error fetching import file")
+	}
+
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, nil, errors.Errorf("error fetching import file, got status %d", resp.StatusCode)
+	}
+
+	reader, err := models.NewContactImportRecordReader(u.Path, io.LimitReader(resp.Body, maxImportFileBytes))
+	if err != nil {
+		resp.Body.Close()
+		return nil, nil, err
+	}
+
+	return reader, func() { resp.Body.Close() }, nil
+}
+
+func (t *ImportContactFileTask) createBatches(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, imp *models.ContactImport) ([]models.ContactImportBatchID, error) {
+	// uploaded files are in our own storage so no access restrictions
+	reader, done, err := fetchImportFile(ctx, rt, t.FileURL, "", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	return imp.CreateBatches(ctx, rt.DB, oa, reader)
+}
@@ -0,0 +1,92 @@
+package contacts_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportContactFile(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://storage.example.com/contact_imports/1234.csv": {
+			httpx.NewMockResponse(200, nil, []byte("URN:Tel,Name\n+16055740001,Norbert\n+16055740002,Leah\n")),
+		},
+		"https://storage.example.com/contact_imports/5678.csv": {
+			httpx.NewMockResponse(404, nil, []byte("not found")),
+		},
+	}))
+
+	importID := testdata.InsertContactImport(db, testdata.Org1, testdata.Admin)
+	db.MustExec(`UPDATE contacts_contactimport SET mappings = '[{"header": "URN:Tel", "mapping": {"type": "scheme", "scheme": "tel"}}, {"header": "Name", "mapping": {"type": "attribute", "name": "name"}}]' WHERE id = $1`, importID)
+
+	task := &contacts.ImportContactFileTask{ContactImportID: importID, FileURL: "https://storage.example.com/contact_imports/1234.csv"}
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactimportbatch WHERE contact_import_id = $1 AND status = 'P'`, importID).Returns(1)
+	assertdb.Query(t, db, `SELECT num_records FROM contacts_contactimport WHERE id = $1`, importID).Returns(2)
+
+	remaining, err := rc.Do("GET", fmt.Sprintf("contact_import_batches_remaining:%d", importID))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("1"), remaining)
+
+	// batch task is queued and performing it completes the import
+	qt, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, contacts.TypeImportContactBatch, qt.Type)
+
+	batchTask := &contacts.ImportContactBatchTask{}
+	require.NoError(t, json.Unmarshal(qt.Task, batchTask))
+	require.NoError(t, batchTask.Perform(ctx, rt, testdata.Org1.ID))
+
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contact WHERE name IN ('Norbert', 'Leah')`).Returns(2)
+	assertdb.Query(t, db, `SELECT status FROM contacts_contactimport WHERE id = $1`, importID).Returns("C")
+
+	// an import whose file can't be fetched fails
+	importID = testdata.InsertContactImport(db, testdata.Org1, testdata.Admin)
+
+	task = &contacts.ImportContactFileTask{ContactImportID: importID, FileURL: "https://storage.example.com/contact_imports/5678.csv"}
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	assert.EqualError(t, err, fmt.Sprintf("unable to parse file of contact import %d: error fetching import file, got status 404", importID))
+
+	assertdb.Query(t, db, `SELECT status FROM contacts_contactimport WHERE id = $1`, importID).Returns("F")
+
+	// orgs which require approval have their imports staged rather than queued
+	db.MustExec(`UPDATE orgs_org SET config = '{"contact_import_approval": true}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	importID = testdata.InsertContactImport(db, testdata.Org1, testdata.Admin)
+	db.MustExec(`UPDATE contacts_contactimport SET mappings = '[{"header": "URN:Tel", "mapping": {"type": "scheme", "scheme": "tel"}}, {"header": "Name", "mapping": {"type": "attribute", "name": "name"}}]' WHERE id = $1`, importID)
+
+	task = &contacts.ImportContactFileTask{ContactImportID: importID, FileURL: "https://storage.example.com/contact_imports/1234.csv"}
+	require.NoError(t, task.Perform(ctx, rt, testdata.Org1.ID))
+
+	assertdb.Query(t, db, `SELECT status FROM contacts_contactimport WHERE id = $1`, importID).Returns("P")
+
+	qt, err = queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Nil(t, qt)
+
+	// both contacts now exist so would be updated but their names wouldn't change
+	summary, err := models.GetStagedContactImport(rc, importID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.ContactImportSummary{Updates: 2, FieldChanges: map[string]int{}}, summary)
+}
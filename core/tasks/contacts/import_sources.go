@@ -0,0 +1,104 @@
+package contacts
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.RegisterCron("import_contact_sources", time.Minute*15, false, ImportContactSources)
+}
+
+// ImportContactSources imports the changed records of any contact import sources which are due to be imported
+func ImportContactSources(ctx context.Context, rt *runtime.Runtime) error {
+	orgIDs, err := models.LoadContactImportSourceOrgs(ctx, rt.DB)
+	if err != nil {
+		return err
+	}
+
+	for _, orgID := range orgIDs {
+		oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, orgID, models.RefreshOrg|models.RefreshGroups|models.RefreshUsers)
+		if err != nil {
+			return errors.Wrapf(err, "error loading org assets for org #%d", orgID)
+		}
+
+		for _, source := range oa.Org().ContactImportSources() {
+			log := logrus.WithField("org_id", orgID).WithField("source_uuid", source.UUID)
+
+			// a source failing to import shouldn't stop other sources being imported
+			if err := importContactSource(ctx, rt, oa, source); err != nil {
+				log.WithError(err).Error("error importing contact import source")
+			}
+		}
+	}
+
+	return nil
+}
+
+func importContactSource(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, source *models.ContactImportSource) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	due, err := models.ClaimContactImportSource(rc, source)
+	if err != nil || !due {
+		return err
+	}
+
+	_, _, access := goflow.HTTP(rt.Config)
+
+	reader, done, err := fetchImportFile(ctx, rt, source.URL, source.Username, source.Password, access)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	// we need all the records to compare them with those of the previous import
+	records := make([][]string, 0, 1000)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrap(err, "error reading import file")
+		}
+		records = append(records, record)
+	}
+	if len(records) == 0 {
+		return errors.New("import file is empty")
+	}
+
+	changed, hashes, err := models.DiffContactImportRecords(rc, source, records)
+	if err != nil {
+		return err
+	}
+	if changed == 0 {
+		return nil
+	}
+
+	imp, batchIDs, err := models.ImportFromSource(ctx, rt.DB, oa, source, records)
+	if err != nil {
+		return err
+	}
+
+	if len(batchIDs) == 0 {
+		if err := imp.MarkFinished(ctx, rt.DB, models.ContactImportStatusComplete); err != nil {
+			return errors.Wrap(err, "error marking import as finished")
+		}
+	} else if oa.Org().ContactImportApproval() {
+		if err := stageImport(ctx, rt, oa, imp); err != nil {
+			return err
+		}
+	} else if err := QueueImportBatches(ctx, rt, imp, batchIDs); err != nil {
+		return err
+	}
+
+	return models.SaveContactImportRecords(rc, source, hashes)
+}
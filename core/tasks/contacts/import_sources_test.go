@@ -0,0 +1,67 @@
+package contacts_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportContactSources(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://crm.example.com/exports/contacts.csv": {
+			httpx.NewMockResponse(200, nil, []byte("Phone,Name\n+16055741111,Catherine\n+16055740001,Norbert\n")),
+			httpx.NewMockResponse(200, nil, []byte("Phone,Name\n+16055741111,Catherine\n+16055740001,Norbert\n")),
+		},
+	}))
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"contact_import_sources": [{
+		"uuid": "4b9a0a50-ff44-4ab8-9b5d-0e2f3f1c7a8b",
+		"name": "CRM Export",
+		"url": "https://crm.example.com/exports/contacts.csv",
+		"username": "mailroom",
+		"password": "sesame",
+		"mappings": [{"header": "Phone", "mapping": {"type": "scheme", "scheme": "tel"}}, {"header": "Name", "mapping": {"type": "attribute", "name": "name"}}],
+		"match": "existing",
+		"interval": 24,
+		"created_by": "admin1@nyaruka.com"
+	}]}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+
+	err := contacts.ImportContactSources(ctx, rt)
+	require.NoError(t, err)
+
+	// only the record for an existing contact is imported
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactimport WHERE org_id = $1 AND original_filename = 'CRM Export' AND num_records = 1`, testdata.Org1.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactimportbatch`).Returns(1)
+
+	task, err := queue.PopNextTask(rc, queue.BatchQueue)
+	require.NoError(t, err)
+	assert.Equal(t, contacts.TypeImportContactBatch, task.Type)
+
+	// source isn't due again until its interval has passed
+	err = contacts.ImportContactSources(ctx, rt)
+	require.NoError(t, err)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactimport`).Returns(1)
+
+	// and when it is, unchanged records aren't imported again
+	rc.Do("DEL", "contact_import_source_due:4b9a0a50-ff44-4ab8-9b5d-0e2f3f1c7a8b")
+
+	err = contacts.ImportContactSources(ctx, rt)
+	require.NoError(t, err)
+	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contactimport`).Returns(1)
+
+}
@@ -0,0 +1,81 @@
+package contacts
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/redisx"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeNormalizeURNs is the type of the task to normalize an org's URNs
+const TypeNormalizeURNs = "normalize_urns"
+
+var normalizeURNsLockKeys = orgkeys.Register("lock:normalize_urns_%d")
+
+func init() {
+	tasks.RegisterType(TypeNormalizeURNs, func() tasks.Task { return &NormalizeURNsTask{} })
+}
+
+// NormalizeURNsTask is our task to check an org's tel URNs against the current phone number metadata, e.g. after a
+// country changes its numbering plan. Unnormalized URNs are fixed and invalid URNs are detached from their contacts if
+// requested. A dry run makes no changes, and in either case a report is saved which can be fetched afterwards.
+type NormalizeURNsTask struct {
+	DryRun        bool `json:"dry_run"`
+	DetachInvalid bool `json:"detach_invalid"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *NormalizeURNsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *NormalizeURNsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	locker := redisx.NewLocker(normalizeURNsLockKeys.Key(int(orgID)), time.Hour)
+	lock, err := locker.Grab(rt.RP, time.Minute*5)
+	if err != nil {
+		return errors.Wrapf(err, "error grabbing lock to normalize URNs for org #%d", orgID)
+	}
+	defer locker.Release(rt.RP, lock)
+
+	start := time.Now()
+
+	// only the org's default country is needed
+	oa, err := models.GetOrgAssetsScoped(ctx, rt, orgID, models.RefreshNone)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load org #%d", orgID)
+	}
+
+	report, err := models.NormalizeOrgURNs(ctx, rt.DB, oa, t.DryRun, t.DetachInvalid)
+	if err != nil {
+		return errors.Wrapf(err, "error normalizing URNs for org #%d", orgID)
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.SetURNNormalizationReport(rc, orgID, report); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"org_id":       orgID,
+		"elapsed":      time.Since(start),
+		"dry_run":      t.DryRun,
+		"scanned":      report.Scanned,
+		"unnormalized": report.Unnormalized,
+		"conflicts":    report.Conflicts,
+		"invalid":      report.Invalid,
+		"fixed":        report.Fixed,
+		"detached":     report.Detached,
+	}).Info("normalized org URNs")
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package contacts_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeURNsTask(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// give our org a country by setting country on a channel
+	db.MustExec(`UPDATE channels_channel SET country = 'RW' WHERE id = $1`, testdata.TwilioChannel.ID)
+	models.FlushCache()
+
+	urnID := testdata.InsertContactURN(db, testdata.Org1, testdata.Bob, "tel:0788123123", 1000)
+
+	// dry run just saves a report
+	task := &contacts.NormalizeURNsTask{DryRun: true}
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, urnID).Returns("tel:0788123123")
+
+	report, err := models.GetURNNormalizationReport(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Unnormalized)
+	assert.Equal(t, 0, report.Fixed)
+
+	task = &contacts.NormalizeURNsTask{}
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, urnID).Returns("tel:+250788123123")
+
+	report, err = models.GetURNNormalizationReport(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 1, report.Fixed)
+}
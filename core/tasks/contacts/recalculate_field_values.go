@@ -0,0 +1,82 @@
+package contacts
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/redisx"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeRecalculateFieldValues is the type of the task to reparse the values of a field
+const TypeRecalculateFieldValues = "recalculate_field_values"
+
+var recalculateFieldValuesLockKeys = orgkeys.Register("lock:recalculate_field_values_%d_%s")
+
+func init() {
+	tasks.RegisterType(TypeRecalculateFieldValues, func() tasks.Task { return &RecalculateFieldValuesTask{} })
+}
+
+// RecalculateFieldValuesTask is our task to reparse the existing values of a field after its type has changed, e.g.
+// from text to datetime. A report is saved afterwards which includes the values which couldn't be parsed as the new type.
+type RecalculateFieldValuesTask struct {
+	FieldKey string `json:"field_key"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *RecalculateFieldValuesTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *RecalculateFieldValuesTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	locker := redisx.NewLocker(recalculateFieldValuesLockKeys.Key(int(orgID), t.FieldKey), time.Hour)
+	lock, err := locker.Grab(rt.RP, time.Minute*5)
+	if err != nil {
+		return errors.Wrapf(err, "error grabbing lock to recalculate field values for org #%d", orgID)
+	}
+	defer locker.Release(rt.RP, lock)
+
+	start := time.Now()
+
+	// refresh fields so we parse values as the field's current type
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, orgID, models.RefreshFields)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load org #%d", orgID)
+	}
+
+	field := oa.FieldByKey(t.FieldKey)
+	if field == nil {
+		return errors.Errorf("no field with key %s for org #%d", t.FieldKey, orgID)
+	}
+
+	report, err := models.RecalculateFieldValues(ctx, rt, oa, field)
+	if err != nil {
+		return errors.Wrapf(err, "error recalculating values of field %s for org #%d", t.FieldKey, orgID)
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.SetFieldRecalculationReport(rc, orgID, report); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"org_id":     orgID,
+		"elapsed":    time.Since(start),
+		"field_key":  t.FieldKey,
+		"field_type": field.Type(),
+		"scanned":    report.Scanned,
+		"updated":    report.Updated,
+		"failed":     report.Failed,
+	}).Info("recalculated field values")
+
+	return nil
+}
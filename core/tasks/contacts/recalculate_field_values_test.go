@@ -0,0 +1,57 @@
+package contacts_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecalculateFieldValuesTask(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// values of the age field as they'd be if it used to be a text field
+	setAge := func(contact *testdata.Contact, text string) {
+		db.MustExec(fmt.Sprintf(`UPDATE contacts_contact SET fields = '{"%s": {"text": "%s"}}' WHERE id = $1`, testdata.AgeField.UUID, text), contact.ID)
+	}
+	setAge(testdata.Cathy, "30")
+	setAge(testdata.Bob, "old")
+
+	task := &contacts.RecalculateFieldValuesTask{FieldKey: "age"}
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT fields->$2->>'number' FROM contacts_contact WHERE id = $1`, testdata.Cathy.ID, testdata.AgeField.UUID).Returns("30")
+	assertdb.Query(t, db, `SELECT fields->$2->>'text' FROM contacts_contact WHERE id = $1`, testdata.Bob.ID, testdata.AgeField.UUID).Returns("old")
+
+	report, err := models.GetFieldRecalculationReport(rc, testdata.Org1.ID, "age")
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Scanned)
+	assert.Equal(t, 1, report.Updated)
+	assert.Equal(t, 1, report.Failed)
+	assert.Equal(t, []*models.FieldRecalculationFailure{{ContactID: testdata.Bob.ID, Value: "old"}}, report.Failures)
+
+	// running it again changes nothing
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	report, err = models.GetFieldRecalculationReport(rc, testdata.Org1.ID, "age")
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.Updated)
+	assert.Equal(t, 1, report.Failed)
+
+	// unknown fields are an error
+	task = &contacts.RecalculateFieldValuesTask{FieldKey: "xxx"}
+	assert.EqualError(t, task.Perform(ctx, rt, testdata.Org1.ID), "no field with key xxx for org #1")
+}
@@ -0,0 +1,74 @@
+package contacts
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/redisx"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeRewriteURNs is the type of the task to rewrite an org's URNs
+const TypeRewriteURNs = "rewrite_urns"
+
+var rewriteURNsLockKeys = orgkeys.Register("lock:rewrite_urns_%d")
+
+func init() {
+	tasks.RegisterType(TypeRewriteURNs, func() tasks.Task { return &RewriteURNsTask{} })
+}
+
+// RewriteURNsTask is our task to rewrite an org's URNs of a scheme according to a prefix or pattern mapping, e.g. after
+// a telco changes a country prefix or its number length. URNs whose new identity collides with another URN are left as
+// they are. A dry run makes no changes, and in either case a report is saved which can be fetched afterwards.
+type RewriteURNsTask struct {
+	Rule   *models.URNRewriteRule `json:"rule"    validate:"required"`
+	DryRun bool                   `json:"dry_run"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *RewriteURNsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *RewriteURNsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	locker := redisx.NewLocker(rewriteURNsLockKeys.Key(int(orgID)), time.Hour)
+	lock, err := locker.Grab(rt.RP, time.Minute*5)
+	if err != nil {
+		return errors.Wrapf(err, "error grabbing lock to rewrite URNs for org #%d", orgID)
+	}
+	defer locker.Release(rt.RP, lock)
+
+	start := time.Now()
+
+	report, err := models.RewriteOrgURNs(ctx, rt.DB, orgID, t.Rule, t.DryRun)
+	if err != nil {
+		return errors.Wrapf(err, "error rewriting URNs for org #%d", orgID)
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.SetURNRewriteReport(rc, orgID, report); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"org_id":     orgID,
+		"elapsed":    time.Since(start),
+		"dry_run":    t.DryRun,
+		"scanned":    report.Scanned,
+		"matched":    report.Matched,
+		"collisions": report.Collisions,
+		"invalid":    report.Invalid,
+		"rewritten":  report.Rewritten,
+	}).Info("rewrote org URNs")
+
+	return nil
+}
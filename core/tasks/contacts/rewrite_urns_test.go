@@ -0,0 +1,50 @@
+package contacts_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteURNsTask(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	urnID := testdata.InsertContactURN(db, testdata.Org1, testdata.Bob, "tel:+250781234567", 1000)
+
+	rule := &models.URNRewriteRule{Scheme: "tel", Prefix: "+25078", Pattern: `^\+25078`, Replacement: "+250798"}
+
+	// dry run just saves a report
+	task := &contacts.RewriteURNsTask{Rule: rule, DryRun: true}
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, urnID).Returns("tel:+250781234567")
+
+	report, err := models.GetURNRewriteReport(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Matched)
+	assert.Equal(t, 0, report.Rewritten)
+
+	task = &contacts.RewriteURNsTask{Rule: rule}
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT identity FROM contacts_contacturn WHERE id = $1`, urnID).Returns("tel:+2507981234567")
+
+	report, err = models.GetURNRewriteReport(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.False(t, report.DryRun)
+	assert.Equal(t, 1, report.Rewritten)
+}
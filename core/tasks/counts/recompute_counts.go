@@ -0,0 +1,32 @@
+package counts
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+// TypeRecomputeCounts is the type of the task to recompute an org's counts
+const TypeRecomputeCounts = "recompute_counts"
+
+func init() {
+	tasks.RegisterType(TypeRecomputeCounts, func() tasks.Task { return &RecomputeCountsTask{} })
+}
+
+// RecomputeCountsTask is our task to recompute the group, label and flow run counts of an org from the underlying
+// data, to repair counts which have drifted
+type RecomputeCountsTask struct{}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *RecomputeCountsTask) Timeout() time.Duration {
+	return time.Minute * 15
+}
+
+// Perform implements tasks.Task
+func (t *RecomputeCountsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	return errors.Wrapf(models.RecomputeOrgCounts(ctx, rt.DB, orgID), "error recomputing counts for org #%d", orgID)
+}
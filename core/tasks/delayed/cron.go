@@ -0,0 +1,35 @@
+package delayed
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.RegisterCron("queue_delayed_tasks", time.Second*15, false, QueueDelayedTasks)
+}
+
+// QueueDelayedTasks adds delayed tasks which are now due to their queues
+func QueueDelayedTasks(ctx context.Context, rt *runtime.Runtime) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	start := time.Now()
+
+	count, err := queue.QueueDelayedTasks(rc, start)
+	if err != nil {
+		return errors.Wrap(err, "error queuing delayed tasks")
+	}
+
+	if count > 0 {
+		logrus.WithField("elapsed", time.Since(start)).WithField("count", count).Info("queued delayed tasks")
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package fhir
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+const (
+	// the most patients we request in each page of a search
+	searchPageSize = 100
+
+	// bundles of patients can be much bigger than webhook responses
+	maxResponseBytes = 10 * 1024 * 1024
+
+	contentType = "application/fhir+json"
+)
+
+// errPatientChanged is returned when a patient is changed on the server between us reading and updating it
+var errPatientChanged = errors.New("patient was changed by another update")
+
+// client for the Patient resources of an org's FHIR server
+type client struct {
+	baseURL string
+	token   string
+
+	httpClient *http.Client
+	retries    *httpx.RetryConfig
+	access     *httpx.AccessConfig
+}
+
+func newClient(rt *runtime.Runtime, s *models.FHIRSync) *client {
+	httpClient, retries, access := goflow.HTTP(rt.Config)
+
+	return &client{
+		baseURL:    strings.TrimSuffix(s.URL, "/"),
+		token:      s.Token,
+		httpClient: httpClient,
+		retries:    retries,
+		access:     access,
+	}
+}
+
+// gets the patient with the given id, returning nil if it doesn't exist
+func (c *client) getPatient(ctx context.Context, id string) (models.FHIRPatient, error) {
+	trace, err := c.request(ctx, http.MethodGet, fmt.Sprintf("%s/Patient/%s", c.baseURL, url.PathEscape(id)), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if trace.Response.StatusCode == http.StatusNotFound || trace.Response.StatusCode == http.StatusGone {
+		return nil, nil
+	}
+	if trace.Response.StatusCode/100 != 2 {
+		return nil, errors.Errorf("error fetching patient %s, got status %d", id, trace.Response.StatusCode)
+	}
+
+	patient := models.FHIRPatient{}
+	if err := json.Unmarshal(trace.ResponseBody, &patient); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling patient %s", id)
+	}
+	return patient, nil
+}
+
+// updates the given patient, returning the updated patient with its new version. The update is conditional on the
+// version we read so that we never overwrite changes we haven't seen.
+func (c *client) putPatient(ctx context.Context, patient models.FHIRPatient) (models.FHIRPatient, error) {
+	headers := map[string]string{"Prefer": "return=representation"}
+	if v := patient.VersionID(); v != "" {
+		headers["If-Match"] = fmt.Sprintf(`W/"%s"`, v)
+	}
+
+	body, err := json.Marshal(patient)
+	if err != nil {
+		return nil, err
+	}
+
+	trace, err := c.request(ctx, http.MethodPut, fmt.Sprintf("%s/Patient/%s", c.baseURL, url.PathEscape(patient.ID())), body, headers)
+	if err != nil {
+		return nil, err
+	}
+	if trace.Response.StatusCode == http.StatusPreconditionFailed || trace.Response.StatusCode == http.StatusConflict {
+		return nil, errPatientChanged
+	}
+	if trace.Response.StatusCode/100 != 2 {
+		return nil, errors.Errorf("error updating patient %s, got status %d", patient.ID(), trace.Response.StatusCode)
+	}
+
+	updated := models.FHIRPatient{}
+	if err := json.Unmarshal(trace.ResponseBody, &updated); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshalling updated patient %s", patient.ID())
+	}
+	return updated, nil
+}
+
+// a page of search results
+type bundle struct {
+	Link []struct {
+		Relation string `json:"relation"`
+		URL      string `json:"url"`
+	} `json:"link"`
+	Entry []struct {
+		Resource models.FHIRPatient `json:"resource"`
+	} `json:"entry"`
+}
+
+// searches for the patients updated since the given time, oldest first, returning up to the given number of pages
+func (c *client) changedPatients(ctx context.Context, since time.Time, maxPages int) ([]models.FHIRPatient, error) {
+	query := url.Values{"_sort": []string{"_lastUpdated"}, "_count": []string{fmt.Sprint(searchPageSize)}}
+	if !since.IsZero() {
+		// patients updated at exactly the same time are seen again but that's harmless as their versions haven't changed
+		query.Set("_lastUpdated", "ge"+since.Format(time.RFC3339Nano))
+	}
+
+	next := fmt.Sprintf("%s/Patient?%s", c.baseURL, query.Encode())
+	patients := make([]models.FHIRPatient, 0, searchPageSize)
+
+	for page := 0; next != "" && page < maxPages; page++ {
+		trace, err := c.request(ctx, http.MethodGet, next, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if trace.Response.StatusCode/100 != 2 {
+			return nil, errors.Errorf("error searching patients, got status %d", trace.Response.StatusCode)
+		}
+
+		b := &bundle{}
+		if err := json.Unmarshal(trace.ResponseBody, b); err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling patients bundle")
+		}
+
+		for _, e := range b.Entry {
+			if e.Resource != nil {
+				patients = append(patients, e.Resource)
+			}
+		}
+
+		next = ""
+		for _, l := range b.Link {
+			if l.Relation == "next" {
+				next = l.URL
+			}
+		}
+	}
+
+	return patients, nil
+}
+
+func (c *client) request(ctx context.Context, method, url string, body []byte, headers map[string]string) (*httpx.Trace, error) {
+	allHeaders := map[string]string{"Accept": contentType}
+	if body != nil {
+		allHeaders["Content-Type"] = contentType
+	}
+	if c.token != "" {
+		allHeaders["Authorization"] = "Bearer " + c.token
+	}
+	for k, v := range headers {
+		allHeaders[k] = v
+	}
+
+	req, err := httpx.NewRequest(method, url, bytes.NewReader(body), allHeaders)
+	if err != nil {
+		return nil, err
+	}
+
+	trace, err := httpx.DoTrace(c.httpClient, req.WithContext(ctx), c.retries, c.access, maxResponseBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error making %s request to FHIR server", method)
+	}
+	return trace, nil
+}
@@ -0,0 +1,82 @@
+package fhir_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/fhir"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushAndPullPatients(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://fhir.example.com/r4/Patient/123": {
+			httpx.NewMockResponse(200, nil, []byte(`{"resourceType": "Patient", "id": "123", "meta": {"versionId": "1", "lastUpdated": "2022-10-01T12:00:00Z"}, "name": [{"text": "Catherine"}], "gender": "female"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"resourceType": "Patient", "id": "123", "meta": {"versionId": "1", "lastUpdated": "2022-10-01T12:00:00Z"}, "name": [{"text": "Catherine"}], "gender": "female"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"resourceType": "Patient", "id": "123", "meta": {"versionId": "2", "lastUpdated": "2022-10-02T12:00:00Z"}, "name": [{"text": "Cat"}], "gender": "female"}`)),
+		},
+		"https://fhir.example.com/r4/Patient?_count=100&_sort=_lastUpdated": {
+			httpx.NewMockResponse(200, nil, []byte(`{"resourceType": "Bundle", "entry": [
+				{"resource": {"resourceType": "Patient", "id": "456", "meta": {"versionId": "1", "lastUpdated": "2022-10-02T13:00:00Z"}, "name": [{"text": "Nobody"}]}},
+				{"resource": {"resourceType": "Patient", "id": "123", "meta": {"versionId": "3", "lastUpdated": "2022-10-03T12:00:00Z"}, "name": [{"text": "Katherine"}], "gender": "female"}}
+			]}`)),
+		},
+	}))
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"fhir_sync": {
+		"url": "https://fhir.example.com/r4",
+		"token": "sesame",
+		"id_field": "age",
+		"name": "name.0.text",
+		"mappings": [{"field": "gender", "path": "gender"}]
+	}}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	db.MustExec(`UPDATE contacts_contact SET fields = '{"903f51da-2717-47c7-a0d3-f2f32877013d": {"text": "123", "number": 123}}' WHERE id = $1`, testdata.Cathy.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	// contacts which have never been synced are updated from their patients
+	err = fhir.PushPatients(ctx, rt, oa, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID})
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT name FROM contacts_contact WHERE id = $1`, testdata.Cathy.ID).Returns("Catherine")
+	assertdb.Query(t, db, `SELECT fields->'3a5891e4-756e-4dc9-8e12-b7a766168824'->>'text' FROM contacts_contact WHERE id = $1`, testdata.Cathy.ID).Returns("female")
+
+	states, err := models.GetFHIRSyncStates(rc, testdata.Org1.ID, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID})
+	require.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.Equal(t, "1", states[testdata.Cathy.ID].VersionID)
+
+	// once synced, changes to the contact are pushed to the patient
+	db.MustExec(`UPDATE contacts_contact SET name = 'Cat', modified_on = NOW() WHERE id = $1`, testdata.Cathy.ID)
+
+	err = fhir.PushPatients(ctx, rt, oa, []models.ContactID{testdata.Cathy.ID})
+	require.NoError(t, err)
+
+	states, err = models.GetFHIRSyncStates(rc, testdata.Org1.ID, []models.ContactID{testdata.Cathy.ID})
+	require.NoError(t, err)
+	assert.Equal(t, "2", states[testdata.Cathy.ID].VersionID)
+
+	// and changes to the patient are pulled into the contact, ignoring patients which aren't linked to contacts
+	err = fhir.PullPatients(ctx, rt, oa)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT name FROM contacts_contact WHERE id = $1`, testdata.Cathy.ID).Returns("Katherine")
+
+	pulledOn, err := models.GetFHIRPulledOn(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "2022-10-03T12:00:00Z", pulledOn.Format("2006-01-02T15:04:05Z07:00"))
+}
@@ -0,0 +1,106 @@
+package fhir
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// the most pages of changed patients we pull for an org at a time, any more are pulled the next time
+const maxPullPages = 20
+
+func init() {
+	mailroom.RegisterCron("pull_fhir_patients", time.Minute*5, false, PullFHIRPatients)
+}
+
+// PullFHIRPatients pulls the patients which have changed on each org's FHIR server into their linked contacts
+func PullFHIRPatients(ctx context.Context, rt *runtime.Runtime) error {
+	orgIDs, err := models.LoadFHIRSyncOrgs(ctx, rt.DB)
+	if err != nil {
+		return err
+	}
+
+	for _, orgID := range orgIDs {
+		oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, orgID, models.RefreshOrg|models.RefreshFields)
+		if err != nil {
+			return errors.Wrapf(err, "error loading org assets for org #%d", orgID)
+		}
+		if oa.Org().FHIRSync() == nil {
+			continue
+		}
+
+		// an org's server failing shouldn't stop other orgs being synced
+		if err := PullPatients(ctx, rt, oa); err != nil {
+			logrus.WithError(err).WithField("org_id", orgID).Error("error pulling FHIR patients")
+		}
+	}
+
+	return nil
+}
+
+// PullPatients pulls the patients which have changed since they were last pulled for the given org into the contacts
+// they're linked to. Patients which aren't linked to a contact are ignored.
+func PullPatients(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets) error {
+	c := newClient(rt, oa.Org().FHIRSync())
+
+	rc := rt.RP.Get()
+	since, err := models.GetFHIRPulledOn(rc, oa.OrgID())
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	changed, err := c.changedPatients(ctx, since, maxPullPages)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	patientIDs := make([]string, len(changed))
+	for i, p := range changed {
+		patientIDs[i] = p.ID()
+	}
+
+	contactIDsByPatient, err := models.LoadContactIDsByPatientID(ctx, rt.DB, oa, patientIDs)
+	if err != nil {
+		return err
+	}
+
+	patients := make(map[models.ContactID]models.FHIRPatient, len(contactIDsByPatient))
+	contactIDs := make([]models.ContactID, 0, len(contactIDsByPatient))
+	for _, p := range changed {
+		if contactID, linked := contactIDsByPatient[p.ID()]; linked {
+			patients[contactID] = p
+			contactIDs = append(contactIDs, contactID)
+		}
+	}
+
+	if len(contactIDs) > 0 {
+		contacts, err := models.LoadContacts(ctx, rt.DB, oa, contactIDs)
+		if err != nil {
+			return errors.Wrap(err, "error loading contacts")
+		}
+
+		if err := syncContacts(ctx, rt, oa, c, contacts, patients); err != nil {
+			return err
+		}
+	}
+
+	// patients are returned oldest first so we can carry on from the last one we saw
+	lastUpdated := changed[len(changed)-1].LastUpdated()
+	if lastUpdated.IsZero() {
+		return nil
+	}
+
+	rc = rt.RP.Get()
+	defer rc.Close()
+
+	return models.SetFHIRPulledOn(rc, oa.OrgID(), lastUpdated)
+}
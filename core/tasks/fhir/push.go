@@ -0,0 +1,77 @@
+package fhir
+
+import (
+	"context"
+
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.AddTaskFunction(queue.PushFHIRPatients, handlePushFHIRPatients)
+}
+
+func handlePushFHIRPatients(ctx context.Context, rt *runtime.Runtime, task *queue.Task) error {
+	push := &models.FHIRPush{}
+	if err := utils.UnmarshalAndValidate(task.Task, push); err != nil {
+		return errors.Wrapf(err, "error unmarshalling FHIR push: %s", string(task.Task))
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, models.OrgID(task.OrgID))
+	if err != nil {
+		return errors.Wrap(err, "error loading org assets")
+	}
+
+	// org may have stopped syncing since the task was queued
+	if oa.Org().FHIRSync() == nil {
+		return nil
+	}
+
+	return PushPatients(ctx, rt, oa, push.ContactIDs)
+}
+
+// PushPatients syncs the given contacts which are linked to patients with those patients
+func PushPatients(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, contactIDs []models.ContactID) error {
+	s := oa.Org().FHIRSync()
+	c := newClient(rt, s)
+
+	contacts, err := models.LoadContacts(ctx, rt.DB, oa, contactIDs)
+	if err != nil {
+		return errors.Wrap(err, "error loading contacts")
+	}
+
+	patients := make(map[models.ContactID]models.FHIRPatient, len(contacts))
+
+	for _, contact := range contacts {
+		fc, err := contact.FlowContact(oa)
+		if err != nil {
+			return errors.Wrapf(err, "error creating flow contact for contact %d", contact.ID())
+		}
+
+		patientID := s.PatientID(oa, fc)
+		if patientID == "" {
+			continue
+		}
+
+		log := logrus.WithFields(logrus.Fields{"org_id": oa.OrgID(), "contact_id": contact.ID(), "patient_id": patientID})
+
+		patient, err := c.getPatient(ctx, patientID)
+		if err != nil {
+			log.WithError(err).Error("error fetching patient")
+			continue
+		}
+		if patient == nil {
+			log.Warn("contact is linked to patient which doesn't exist")
+			continue
+		}
+
+		patients[contact.ID()] = patient
+	}
+
+	return syncContacts(ctx, rt, oa, c, contacts, patients)
+}
@@ -0,0 +1,94 @@
+package fhir
+
+import (
+	"context"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// reconciles each of the given contacts with its patient. If only one side has changed since they were last synced,
+// it's copied to the other, and if both have then the org's conflict setting decides which wins. Contacts which have
+// never been synced are updated from their patients, so that linking a contact can't wipe out a patient's details.
+func syncContacts(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, c *client, contacts []*models.Contact, patients map[models.ContactID]models.FHIRPatient) error {
+	s := oa.Org().FHIRSync()
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	contactIDs := make([]models.ContactID, len(contacts))
+	for i, contact := range contacts {
+		contactIDs[i] = contact.ID()
+	}
+
+	states, err := models.GetFHIRSyncStates(rc, oa.OrgID(), contactIDs)
+	if err != nil {
+		return err
+	}
+
+	synced := make(map[models.ContactID]*models.FHIRSyncState, len(contacts))
+	pulled := make(map[*flows.Contact][]flows.Modifier)
+	pulledVersions := make(map[models.ContactID]string)
+
+	for _, contact := range contacts {
+		patient := patients[contact.ID()]
+		if patient == nil {
+			continue
+		}
+
+		log := logrus.WithFields(logrus.Fields{"org_id": oa.OrgID(), "contact_id": contact.ID(), "patient_id": patient.ID()})
+
+		fc, err := contact.FlowContact(oa)
+		if err != nil {
+			return errors.Wrapf(err, "error creating flow contact for contact %d", contact.ID())
+		}
+
+		state := states[contact.ID()]
+		patientChanged := state == nil || state.VersionID != patient.VersionID()
+		contactChanged := state != nil && contact.ModifiedOn().After(state.SyncedOn)
+
+		pull := patientChanged && !contactChanged
+		if patientChanged && contactChanged {
+			pull = !s.ContactWins(contact.ModifiedOn(), patient.LastUpdated())
+			log.WithField("contact_wins", !pull).Info("contact and patient both changed since last synced")
+		}
+
+		if pull {
+			if mods := s.ContactModifiers(oa, fc, patient); len(mods) > 0 {
+				pulled[fc] = mods
+			}
+			pulledVersions[contact.ID()] = patient.VersionID()
+			continue
+		}
+
+		if s.PatientChanged(oa, fc, patient) {
+			s.UpdatePatient(oa, fc, patient)
+
+			patient, err = c.putPatient(ctx, patient)
+			if err != nil {
+				// if the patient has changed since we read it, we'll see it again on the next pull
+				log.WithError(err).Error("error updating patient")
+				continue
+			}
+		}
+
+		synced[contact.ID()] = &models.FHIRSyncState{VersionID: patient.VersionID(), SyncedOn: dates.Now()}
+	}
+
+	if len(pulled) > 0 {
+		if _, err := models.ApplyModifiers(ctx, rt, oa, models.NilUserID, pulled); err != nil {
+			return errors.Wrap(err, "error updating contacts from patients")
+		}
+	}
+
+	// contacts we've updated are only synced as of after that update, so that pushing them doesn't push them back
+	for contactID, versionID := range pulledVersions {
+		synced[contactID] = &models.FHIRSyncState{VersionID: versionID, SyncedOn: dates.Now()}
+	}
+
+	return models.SetFHIRSyncStates(rc, oa.OrgID(), synced)
+}
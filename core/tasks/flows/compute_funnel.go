@@ -0,0 +1,83 @@
+package flows
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/redisx"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeComputeFlowFunnel is the type of the task to compute the funnel of a flow
+const TypeComputeFlowFunnel = "compute_flow_funnel"
+
+var computeFlowFunnelLockKeys = orgkeys.Register("lock:compute_flow_funnel_%d_%s")
+
+func init() {
+	tasks.RegisterType(TypeComputeFlowFunnel, func() tasks.Task { return &ComputeFlowFunnelTask{} })
+}
+
+// ComputeFlowFunnelTask is our task to compute how many runs passed through and dropped off at each node of a flow for
+// runs created in a date range. The funnel is saved afterwards so that the editor can fetch it to show as an overlay.
+type ComputeFlowFunnelTask struct {
+	FlowUUID assets.FlowUUID `json:"flow_uuid" validate:"required"`
+	Since    time.Time       `json:"since"     validate:"required"`
+	Until    time.Time       `json:"until"     validate:"required"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ComputeFlowFunnelTask) Timeout() time.Duration {
+	return time.Minute * 15
+}
+
+// Perform implements tasks.Task
+func (t *ComputeFlowFunnelTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	locker := redisx.NewLocker(computeFlowFunnelLockKeys.Key(int(orgID), t.FlowUUID), time.Minute*15)
+	lock, err := locker.Grab(rt.RP, time.Minute)
+	if err != nil {
+		return errors.Wrapf(err, "error grabbing lock to compute funnel for flow %s", t.FlowUUID)
+	}
+	defer locker.Release(rt.RP, lock)
+
+	start := time.Now()
+
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load org #%d", orgID)
+	}
+
+	flowAsset, err := oa.FlowByUUID(t.FlowUUID)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load flow %s for org #%d", t.FlowUUID, orgID)
+	}
+	flow := flowAsset.(*models.Flow)
+
+	funnel, err := models.ComputeFlowFunnel(ctx, rt.ReadonlyDB, flow, t.Since, t.Until)
+	if err != nil {
+		return errors.Wrapf(err, "error computing funnel for flow %s", t.FlowUUID)
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.SetFlowFunnel(rc, orgID, funnel); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"org_id":    orgID,
+		"elapsed":   time.Since(start),
+		"flow_uuid": t.FlowUUID,
+		"runs":      funnel.Runs,
+		"nodes":     len(funnel.Nodes),
+	}).Info("computed flow funnel")
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package flows_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/flows"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeFlowFunnelTask(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	// three runs which all pass through the first node, two of which reach the second node
+	path1 := `[{"uuid": "b7d9be6b-dd8c-4ef0-a4c1-5cd1e1d0c8f6", "node_uuid": "72a1f5df-49f9-45df-94c9-d86f7ea064e5", "arrived_on": "2022-10-01T12:00:00Z"}]`
+	path2 := `[{"uuid": "8d4a8f9c-4e0b-4d5e-8d69-3b8d1f2f6f40", "node_uuid": "72a1f5df-49f9-45df-94c9-d86f7ea064e5", "arrived_on": "2022-10-01T12:00:00Z"}, {"uuid": "9b7b5a8e-9a05-4b89-8f0e-6b7f9c2d3c11", "node_uuid": "3dcccbb4-d29c-41dd-a01f-16d814c9ab82", "arrived_on": "2022-10-01T12:01:00Z"}]`
+
+	run1 := testdata.InsertFlowRun(db, testdata.Org1, models.SessionID(0), testdata.Cathy, testdata.Favorites, models.RunStatusExpired)
+	run2 := testdata.InsertFlowRun(db, testdata.Org1, models.SessionID(0), testdata.Bob, testdata.Favorites, models.RunStatusCompleted)
+	run3 := testdata.InsertFlowRun(db, testdata.Org1, models.SessionID(0), testdata.George, testdata.Favorites, models.RunStatusInterrupted)
+
+	db.MustExec(`UPDATE flows_flowrun SET path = $2 WHERE id = $1`, run1, path1)
+	db.MustExec(`UPDATE flows_flowrun SET path = $2 WHERE id = ANY(ARRAY[$1, $3]::int[])`, run2, path2, run3)
+
+	task := &flows.ComputeFlowFunnelTask{FlowUUID: testdata.Favorites.UUID, Since: time.Now().Add(-time.Hour), Until: time.Now().Add(time.Hour)}
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	funnel, err := models.GetFlowFunnel(rc, testdata.Org1.ID, testdata.Favorites.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, testdata.Favorites.UUID, funnel.FlowUUID)
+	assert.Equal(t, 3, funnel.Runs)
+	assert.Equal(t, []*models.FlowFunnelNode{
+		{NodeUUID: "72a1f5df-49f9-45df-94c9-d86f7ea064e5", Visits: 3, DropOffs: 1, DropOffRate: 0.3333},
+		{NodeUUID: "3dcccbb4-d29c-41dd-a01f-16d814c9ab82", Visits: 2, DropOffs: 1, DropOffRate: 0.5},
+	}, funnel.Nodes)
+
+	// no funnel for a flow that hasn't been computed
+	funnel, err = models.GetFlowFunnel(rc, testdata.Org1.ID, testdata.PickANumber.UUID)
+	assert.NoError(t, err)
+	assert.Nil(t, funnel)
+}
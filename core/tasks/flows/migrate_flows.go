@@ -0,0 +1,159 @@
+package flows
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/redisx"
+
+	"github.com/Masterminds/semver"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeMigrateFlows is the type of the task to migrate all of an org's flows
+const TypeMigrateFlows = "migrate_flows"
+
+var migrateFlowsLockKeys = orgkeys.Register("lock:migrate_flows_%d")
+
+// how many flows we migrate between saving the migration's progress
+const migrateFlowsBatchSize = 50
+
+func init() {
+	tasks.RegisterType(TypeMigrateFlows, func() tasks.Task { return &MigrateFlowsTask{} })
+}
+
+// MigrateFlowsTask is our task to migrate all of an org's flows to a spec version, which defaults to the current spec
+// version. Each migrated flow gets a new revision so that its previous revision can be restored by rolling back the
+// migration. Progress and the result for each flow are recorded as the migration runs and can be fetched afterwards.
+type MigrateFlowsTask struct {
+	UserID    models.UserID   `json:"user_id" validate:"required"`
+	ToVersion *semver.Version `json:"to_version"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *MigrateFlowsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *MigrateFlowsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	locker := redisx.NewLocker(migrateFlowsLockKeys.Key(int(orgID)), time.Hour)
+	lock, err := locker.Grab(rt.RP, time.Minute*5)
+	if err != nil {
+		return errors.Wrapf(err, "error grabbing lock to migrate flows for org #%d", orgID)
+	}
+	defer locker.Release(rt.RP, lock)
+
+	start := time.Now()
+
+	toVersion := t.ToVersion
+	if toVersion == nil {
+		toVersion = goflow.SpecVersion()
+	}
+
+	revs, err := models.LoadFlowRevisionsToMigrate(ctx, rt.DB, orgID)
+	if err != nil {
+		return err
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	migration := models.NewFlowMigration(toVersion.String(), len(revs))
+	if err := models.SetFlowMigration(rc, orgID, migration); err != nil {
+		return err
+	}
+
+	for i, rev := range revs {
+		result, err := t.migrateFlow(ctx, rt, rev, toVersion)
+		if err != nil {
+			return err
+		}
+
+		if result == nil {
+			migration.Skipped++
+		} else {
+			if result.Error != "" {
+				migration.Failed++
+			} else {
+				migration.Migrated++
+			}
+			migration.Results = append(migration.Results, result)
+		}
+
+		if (i+1)%migrateFlowsBatchSize == 0 {
+			if err := models.SetFlowMigration(rc, orgID, migration); err != nil {
+				return err
+			}
+		}
+	}
+
+	migration.Complete()
+
+	if err := models.SetFlowMigration(rc, orgID, migration); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"org_id":     orgID,
+		"elapsed":    time.Since(start),
+		"to_version": migration.ToVersion,
+		"total":      migration.Total,
+		"migrated":   migration.Migrated,
+		"skipped":    migration.Skipped,
+		"failed":     migration.Failed,
+	}).Info("migrated org flows")
+
+	return nil
+}
+
+// migrates a single flow, returning nil if it doesn't need migrating. Problems with the flow itself are recorded on the
+// result whereas an error is only returned if we couldn't save a migrated flow.
+func (t *MigrateFlowsTask) migrateFlow(ctx context.Context, rt *runtime.Runtime, rev *models.FlowRevisionToMigrate, toVersion *semver.Version) (*models.FlowMigrationResult, error) {
+	result := &models.FlowMigrationResult{FlowID: rev.FlowID, Name: rev.Name, FromVersion: rev.SpecVersion, FromRevision: rev.Revision}
+
+	fromVersion, err := semver.NewVersion(rev.SpecVersion)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid spec version: %s", rev.SpecVersion)
+		return result, nil
+	}
+	if !fromVersion.LessThan(toVersion) {
+		return nil, nil
+	}
+
+	migrated, err := goflow.MigrateDefinition(rt.Config, rev.Definition, toVersion)
+	if err != nil {
+		result.Error = errors.Wrap(err, "unable to migrate flow").Error()
+		return result, nil
+	}
+
+	// check that what we'll save as the new revision is actually a valid flow
+	if _, err := goflow.ReadFlow(rt.Config, migrated); err != nil {
+		result.Error = errors.Wrap(err, "unable to read migrated flow").Error()
+		return result, nil
+	}
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error starting transaction")
+	}
+
+	result.Revision, err = models.InsertFlowRevision(ctx, tx, rev.FlowID, migrated, toVersion.String(), t.UserID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrap(err, "error committing migrated flow")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,70 @@
+package flows_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/flows"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateFlowsTask(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// make the latest revision of one flow an older spec version and another unreadable
+	db.MustExec(`UPDATE flows_flowrevision SET spec_version = '13.0.0' WHERE flow_id = $1`, testdata.Favorites.ID)
+	db.MustExec(`UPDATE flows_flowrevision SET spec_version = 'xx' WHERE flow_id = $1`, testdata.PickANumber.ID)
+
+	var fromRevision int
+	db.Get(&fromRevision, `SELECT max(revision) FROM flows_flowrevision WHERE flow_id = $1`, testdata.Favorites.ID)
+
+	task := &flows.MigrateFlowsTask{UserID: testdata.Admin.ID}
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	migration, err := models.GetFlowMigration(rc, testdata.Org1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.FlowMigrationStatusComplete, migration.Status)
+	assert.Equal(t, "13.1.0", migration.ToVersion)
+	assert.Equal(t, 1, migration.Migrated)
+	assert.Equal(t, 1, migration.Failed)
+	assert.Equal(t, migration.Total-2, migration.Skipped)
+	assert.NotNil(t, migration.CompletedOn)
+
+	results := make(map[models.FlowID]*models.FlowMigrationResult)
+	for _, r := range migration.Results {
+		results[r.FlowID] = r
+	}
+
+	assert.Equal(t, "13.0.0", results[testdata.Favorites.ID].FromVersion)
+	assert.Equal(t, fromRevision+1, results[testdata.Favorites.ID].Revision)
+	assert.Equal(t, "", results[testdata.Favorites.ID].Error)
+	assert.Equal(t, "invalid spec version: xx", results[testdata.PickANumber.ID].Error)
+
+	assertdb.Query(t, db, `SELECT spec_version FROM flows_flowrevision WHERE flow_id = $1 AND revision = $2 AND is_active`, testdata.Favorites.ID, fromRevision+1).Returns("13.1.0")
+	assertdb.Query(t, db, `SELECT version_number FROM flows_flow WHERE id = $1`, testdata.Favorites.ID).Returns("13.1.0")
+
+	// roll it back which restores the previous revision
+	err = models.RollbackFlowMigration(ctx, db, testdata.Org1.ID, migration)
+	require.NoError(t, err)
+	assert.Equal(t, models.FlowMigrationStatusRolledBack, migration.Status)
+	assert.True(t, results[testdata.Favorites.ID].RolledBack)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrevision WHERE flow_id = $1 AND revision = $2 AND is_active`, testdata.Favorites.ID, fromRevision+1).Returns(0)
+	assertdb.Query(t, db, `SELECT version_number FROM flows_flow WHERE id = $1`, testdata.Favorites.ID).Returns("13.0.0")
+
+	// migrating again creates a new revision rather than reusing the rolled back one
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT spec_version FROM flows_flowrevision WHERE flow_id = $1 AND revision = $2 AND is_active`, testdata.Favorites.ID, fromRevision+2).Returns("13.1.0")
+}
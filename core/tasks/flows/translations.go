@@ -0,0 +1,313 @@
+package flows
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/translation"
+	"github.com/nyaruka/goflow/utils/i18n"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TypeExportTranslations is the type of the task to export the translations of a set of flows
+	TypeExportTranslations = "export_translations"
+
+	// TypeImportTranslations is the type of the task to import translations into a set of flows
+	TypeImportTranslations = "import_translations"
+)
+
+// how many flows we process between saving a translation job's progress
+const translationsBatchSize = 50
+
+func init() {
+	tasks.RegisterType(TypeExportTranslations, func() tasks.Task { return &ExportTranslationsTask{} })
+	tasks.RegisterType(TypeImportTranslations, func() tasks.Task { return &ImportTranslationsTask{} })
+}
+
+// ExportTranslationsTask is our task to export the translations of a set of flows as a zip archive of PO files, one
+// per flow, named by flow UUID. The archive is saved to attachment storage and its URL recorded on the job.
+type ExportTranslationsTask struct {
+	JobUUID  uuids.UUID      `json:"job_uuid" validate:"required"`
+	FlowIDs  []models.FlowID `json:"flow_ids" validate:"required"`
+	Language envs.Language   `json:"language"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ExportTranslationsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *ExportTranslationsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	start := time.Now()
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	job, err := startTranslationJob(rc, orgID, t.JobUUID)
+	if err != nil {
+		return err
+	}
+
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+
+	for i, flowID := range t.FlowIDs {
+		result := &models.TranslationJobResult{FlowID: flowID}
+
+		if flow, err := readFlowForTranslation(ctx, rt, orgID, flowID, result); err != nil {
+			result.Error = err.Error()
+		} else if po, err := translation.ExtractFromFlows("Generated by mailroom", t.Language, []string{"arguments"}, flow); err != nil {
+			result.Error = errors.Wrap(err, "unable to extract PO from flow").Error()
+		} else {
+			w, err := zw.Create(fmt.Sprintf("%s.po", flow.UUID()))
+			if err != nil {
+				return failTranslationJob(rc, orgID, job, errors.Wrap(err, "error writing translations archive"))
+			}
+			po.Write(w)
+		}
+
+		job.AddResult(result)
+
+		if (i+1)%translationsBatchSize == 0 {
+			if err := models.SetTranslationJob(rc, orgID, job); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return failTranslationJob(rc, orgID, job, errors.Wrap(err, "error writing translations archive"))
+	}
+
+	job.URL, err = rt.AttachmentStorage.Put(ctx, models.TranslationJobPath(rt, orgID, job.UUID, "translations.zip"), "application/zip", archive.Bytes())
+	if err != nil {
+		return failTranslationJob(rc, orgID, job, errors.Wrap(err, "error saving translations archive"))
+	}
+
+	job.Complete()
+
+	if err := models.SetTranslationJob(rc, orgID, job); err != nil {
+		return err
+	}
+
+	logTranslationJob(orgID, job, time.Since(start))
+	return nil
+}
+
+// ImportTranslationsTask is our task to import translations from an uploaded PO file into a set of flows. The upload
+// is either a single PO file which is imported into every flow, or a zip archive like that produced by an export, in
+// which case each flow gets the PO file named by its UUID. Each updated flow is saved as a new revision.
+type ImportTranslationsTask struct {
+	JobUUID  uuids.UUID      `json:"job_uuid" validate:"required"`
+	UserID   models.UserID   `json:"user_id"  validate:"required"`
+	FlowIDs  []models.FlowID `json:"flow_ids" validate:"required"`
+	Language envs.Language   `json:"language" validate:"required"`
+	Upload   string          `json:"upload"   validate:"required"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ImportTranslationsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *ImportTranslationsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	start := time.Now()
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	job, err := startTranslationJob(rc, orgID, t.JobUUID)
+	if err != nil {
+		return err
+	}
+
+	_, upload, err := rt.AttachmentStorage.Get(ctx, t.Upload)
+	if err != nil {
+		return failTranslationJob(rc, orgID, job, errors.Wrap(err, "error fetching uploaded PO file"))
+	}
+
+	shared, byFlow, err := ReadUploadedPOs(t.Upload, upload)
+	if err != nil {
+		// an invalid upload isn't a problem with the task itself so just record it on the job
+		failTranslationJob(rc, orgID, job, err)
+		return nil
+	}
+
+	for i, flowID := range t.FlowIDs {
+		result := &models.TranslationJobResult{FlowID: flowID}
+
+		if err := t.importIntoFlow(ctx, rt, orgID, flowID, shared, byFlow, result); err != nil {
+			return failTranslationJob(rc, orgID, job, err)
+		}
+
+		job.AddResult(result)
+
+		if (i+1)%translationsBatchSize == 0 {
+			if err := models.SetTranslationJob(rc, orgID, job); err != nil {
+				return err
+			}
+		}
+	}
+
+	job.Complete()
+
+	if err := models.SetTranslationJob(rc, orgID, job); err != nil {
+		return err
+	}
+
+	logTranslationJob(orgID, job, time.Since(start))
+	return nil
+}
+
+// imports translations into a single flow. Problems with the flow or its translations are recorded on the result
+// whereas an error is only returned if we couldn't save the updated flow.
+func (t *ImportTranslationsTask) importIntoFlow(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, flowID models.FlowID, shared *i18n.PO, byFlow map[assets.FlowUUID]*i18n.PO, result *models.TranslationJobResult) error {
+	flow, err := readFlowForTranslation(ctx, rt, orgID, flowID, result)
+	if err != nil {
+		result.Error = err.Error()
+		return nil
+	}
+
+	po := shared
+	if po == nil {
+		po = byFlow[flow.UUID()]
+		if po == nil {
+			result.Error = fmt.Sprintf("no PO file for flow %s", flow.UUID())
+			return nil
+		}
+	}
+
+	if err := translation.ImportIntoFlows(po, t.Language, flow); err != nil {
+		result.Error = errors.Wrap(err, "unable to import PO into flow").Error()
+		return nil
+	}
+
+	definition, err := jsonx.Marshal(flow)
+	if err != nil {
+		return errors.Wrapf(err, "error marshalling flow #%d", flowID)
+	}
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "error starting transaction")
+	}
+
+	result.Revision, err = models.InsertFlowRevision(ctx, tx, flowID, definition, goflow.SpecVersion().String(), t.UserID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "error committing translated flow")
+}
+
+// ReadUploadedPOs reads an uploaded file of translations, which is either a single PO file or a zip archive of PO files
+// named by flow UUID, returning either the single PO or the map of flow UUIDs to POs
+func ReadUploadedPOs(filename string, data []byte) (*i18n.PO, map[assets.FlowUUID]*i18n.PO, error) {
+	if !strings.HasSuffix(strings.ToLower(filename), ".zip") {
+		po, err := i18n.ReadPO(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "invalid po file")
+		}
+		return po, nil, nil
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "invalid zip file")
+	}
+
+	byFlow := make(map[assets.FlowUUID]*i18n.PO, len(zr.File))
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !strings.HasSuffix(f.Name, ".po") {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "unable to open %s", f.Name)
+		}
+		po, err := i18n.ReadPO(r)
+		r.Close()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "invalid po file %s", f.Name)
+		}
+
+		byFlow[assets.FlowUUID(strings.TrimSuffix(f.Name[strings.LastIndex(f.Name, "/")+1:], ".po"))] = po
+	}
+
+	return nil, byFlow, nil
+}
+
+// reads the latest definition of a flow, recording its name on the given result
+func readFlowForTranslation(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, flowID models.FlowID, result *models.TranslationJobResult) (flows.Flow, error) {
+	dbFlow, err := models.LoadFlowByID(ctx, rt.DB, orgID, flowID)
+	if err != nil {
+		return nil, err
+	}
+	if dbFlow == nil {
+		return nil, errors.Errorf("no such flow: %d", flowID)
+	}
+
+	result.Name = dbFlow.Name()
+
+	flow, err := goflow.ReadFlow(rt.Config, dbFlow.Definition())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read flow")
+	}
+	return flow, nil
+}
+
+func startTranslationJob(rc redis.Conn, orgID models.OrgID, jobUUID uuids.UUID) (*models.TranslationJob, error) {
+	job, err := models.GetTranslationJob(rc, orgID, jobUUID)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, errors.Errorf("no translation job with UUID %s for org #%d", jobUUID, orgID)
+	}
+
+	job.Status = models.TranslationJobStatusInProgress
+
+	return job, models.SetTranslationJob(rc, orgID, job)
+}
+
+// marks the given job as failed, returning the error which caused it to fail
+func failTranslationJob(rc redis.Conn, orgID models.OrgID, job *models.TranslationJob, err error) error {
+	job.Fail(err.Error())
+
+	if serr := models.SetTranslationJob(rc, orgID, job); serr != nil {
+		logrus.WithError(serr).WithField("org_id", orgID).Error("error saving failed translation job")
+	}
+	return err
+}
+
+func logTranslationJob(orgID models.OrgID, job *models.TranslationJob, elapsed time.Duration) {
+	logrus.WithFields(logrus.Fields{
+		"org_id":    orgID,
+		"elapsed":   elapsed,
+		"type":      job.Type,
+		"total":     job.Total,
+		"succeeded": job.Succeeded,
+		"failed":    job.Failed,
+	}).Info("completed translation job")
+}
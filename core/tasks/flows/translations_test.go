@@ -0,0 +1,135 @@
+package flows_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/flows"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportTranslationsTask(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis | testsuite.ResetStorage)
+
+	job := models.NewTranslationJob(models.TranslationJobTypeExport, "spa", 2)
+	require.NoError(t, models.SetTranslationJob(rc, testdata.Org1.ID, job))
+
+	task := &flows.ExportTranslationsTask{JobUUID: job.UUID, FlowIDs: []models.FlowID{testdata.Favorites.ID, 123456}, Language: "spa"}
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	job, err = models.GetTranslationJob(rc, testdata.Org1.ID, job.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TranslationJobStatusComplete, job.Status)
+	assert.Equal(t, 1, job.Succeeded)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, "Favorites", job.Results[0].Name)
+	assert.Equal(t, "no such flow: 123456", job.Results[1].Error)
+	assert.NotEqual(t, "", job.URL)
+	assert.NotNil(t, job.CompletedOn)
+
+	// archive should have a PO file for the flow that could be exported
+	_, data, err := rt.AttachmentStorage.Get(ctx, models.TranslationJobPath(rt, testdata.Org1.ID, job.UUID, "translations.zip"))
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	require.Len(t, zr.File, 1)
+	assert.Equal(t, string(testdata.Favorites.UUID)+".po", zr.File[0].Name)
+
+	f, _ := zr.File[0].Open()
+	po, _ := io.ReadAll(f)
+	assert.Contains(t, string(po), `msgid "Blue"`)
+
+	// can't perform a task for a job which doesn't exist
+	task = &flows.ExportTranslationsTask{JobUUID: "e4c1d6f4-a9b7-4a92-9c47-1a3fbbe42e65", FlowIDs: []models.FlowID{testdata.Favorites.ID}}
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	assert.EqualError(t, err, "no translation job with UUID e4c1d6f4-a9b7-4a92-9c47-1a3fbbe42e65 for org #1")
+}
+
+func TestImportTranslationsTask(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	var fromRevision int
+	db.Get(&fromRevision, `SELECT max(revision) FROM flows_flowrevision WHERE flow_id = $1`, testdata.Favorites.ID)
+
+	job := models.NewTranslationJob(models.TranslationJobTypeImport, "spa", 2)
+	require.NoError(t, models.SetTranslationJob(rc, testdata.Org1.ID, job))
+
+	uploadPath := models.TranslationJobPath(rt, testdata.Org1.ID, job.UUID, "upload.po")
+	_, err := rt.AttachmentStorage.Put(ctx, uploadPath, "application/octet-stream", []byte("msgid \"Blue\"\nmsgstr \"Azul\"\n\n"))
+	require.NoError(t, err)
+
+	task := &flows.ImportTranslationsTask{JobUUID: job.UUID, UserID: testdata.Admin.ID, FlowIDs: []models.FlowID{testdata.Favorites.ID, 123456}, Language: "spa", Upload: uploadPath}
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	job, err = models.GetTranslationJob(rc, testdata.Org1.ID, job.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TranslationJobStatusComplete, job.Status)
+	assert.Equal(t, 1, job.Succeeded)
+	assert.Equal(t, 1, job.Failed)
+	assert.Equal(t, fromRevision+1, job.Results[0].Revision)
+	assert.Equal(t, "no such flow: 123456", job.Results[1].Error)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM flows_flowrevision WHERE flow_id = $1 AND revision = $2 AND definition::text LIKE '%Azul%'`, testdata.Favorites.ID, fromRevision+1).Returns(1)
+
+	// an unreadable upload fails the job
+	job = models.NewTranslationJob(models.TranslationJobTypeImport, "spa", 1)
+	require.NoError(t, models.SetTranslationJob(rc, testdata.Org1.ID, job))
+
+	uploadPath = models.TranslationJobPath(rt, testdata.Org1.ID, job.UUID, "upload.zip")
+	_, err = rt.AttachmentStorage.Put(ctx, uploadPath, "application/octet-stream", []byte("not a zip"))
+	require.NoError(t, err)
+
+	task = &flows.ImportTranslationsTask{JobUUID: job.UUID, UserID: testdata.Admin.ID, FlowIDs: []models.FlowID{testdata.Favorites.ID}, Language: "spa", Upload: uploadPath}
+	err = task.Perform(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	job, err = models.GetTranslationJob(rc, testdata.Org1.ID, job.UUID)
+	require.NoError(t, err)
+	assert.Equal(t, models.TranslationJobStatusFailed, job.Status)
+	assert.Equal(t, "invalid zip file: zip: not a valid zip file", job.Error)
+}
+
+func TestReadUploadedPOs(t *testing.T) {
+	// a single PO file
+	po, byFlow, err := flows.ReadUploadedPOs("test.po", []byte("msgid \"Blue\"\nmsgstr \"Azul\"\n\n"))
+	assert.NoError(t, err)
+	assert.Nil(t, byFlow)
+	assert.Equal(t, "Azul", po.GetText("", "Blue"))
+
+	// an archive of PO files
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	w, _ := zw.Create("9de3663f-c5c5-4c92-9f45-ecbc09abcc85.po")
+	w.Write([]byte("msgid \"Red\"\nmsgstr \"Rojo\"\n\n"))
+	w, _ = zw.Create("README.txt")
+	w.Write([]byte("ignored"))
+	zw.Close()
+
+	po, byFlow, err = flows.ReadUploadedPOs("translations.ZIP", archive.Bytes())
+	assert.NoError(t, err)
+	assert.Nil(t, po)
+	assert.Len(t, byFlow, 1)
+	assert.Equal(t, "Rojo", byFlow["9de3663f-c5c5-4c92-9f45-ecbc09abcc85"].GetText("", "Red"))
+
+	_, _, err = flows.ReadUploadedPOs("test.zip", []byte("not a zip"))
+	assert.EqualError(t, err, "invalid zip file: zip: not a valid zip file")
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/flows/actions"
+	"github.com/nyaruka/goflow/flows/resumes"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/runner"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/logs"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+)
+
+// AirtimeStatusEvent is the final status of a pending airtime transfer, as reported later by its provider
+type AirtimeStatusEvent struct {
+	ContactID     models.ContactID             `json:"contact_id"`
+	OrgID         models.OrgID                 `json:"org_id"`
+	SessionID     models.SessionID             `json:"session_id"`
+	Status        models.AirtimeTransferStatus `json:"status"`
+	ActualAmount  decimal.Decimal              `json:"actual_amount"`
+	TransferredOn time.Time                    `json:"transferred_on"`
+}
+
+// NewAirtimeStatusTask creates a new event task for the final status of a pending airtime transfer
+func NewAirtimeStatusTask(orgID models.OrgID, contactID models.ContactID, sessionID models.SessionID, status models.AirtimeTransferStatus, actualAmount decimal.Decimal, transferredOn time.Time) *queue.Task {
+	event := &AirtimeStatusEvent{
+		ContactID:     contactID,
+		OrgID:         orgID,
+		SessionID:     sessionID,
+		Status:        status,
+		ActualAmount:  actualAmount,
+		TransferredOn: transferredOn,
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		panic(err)
+	}
+
+	return &queue.Task{
+		Type:     AirtimeStatusEventType,
+		OrgID:    int(orgID),
+		Task:     eventJSON,
+		QueuedOn: time.Now(),
+	}
+}
+
+// handleAirtimeStatusEvent is called when the final status of a pending airtime transfer is reported. When the transfer
+// was made the flow could only treat it as a failure, so if the session which made it has since started waiting with a
+// timeout, e.g. to see how the transfer went, we update the transfer's result with its real outcome and end the wait,
+// so that the flow can route on that result.
+func handleAirtimeStatusEvent(ctx context.Context, rt *runtime.Runtime, event *AirtimeStatusEvent) error {
+	log := logs.From(ctx).WithFields(logrus.Fields{"contact_id": event.ContactID, "session_id": event.SessionID})
+
+	oa, err := models.GetOrgAssets(ctx, rt, event.OrgID)
+	if err != nil {
+		return errors.Wrapf(err, "error loading org")
+	}
+
+	contacts, err := models.LoadContacts(ctx, rt.ReadonlyDB, oa, []models.ContactID{event.ContactID})
+	if err != nil {
+		return errors.Wrapf(err, "error loading contact")
+	}
+
+	// contact has been deleted, ignore this event
+	if len(contacts) == 0 {
+		return nil
+	}
+
+	modelContact := contacts[0]
+
+	contact, err := modelContact.FlowContact(oa)
+	if err != nil {
+		return errors.Wrapf(err, "error creating flow contact")
+	}
+
+	session, err := models.FindWaitingSessionForContact(ctx, rt.DB, rt.SessionStorage, oa, models.FlowTypeMessaging, contact)
+	if err != nil {
+		return errors.Wrapf(err, "error loading waiting session for contact")
+	}
+
+	// only the session which made the transfer, and which has waited since, can be resumed
+	if session == nil || session.ID() != event.SessionID || session.WaitStartedOn() == nil || session.WaitStartedOn().Before(event.TransferredOn) {
+		log.Info("ignoring airtime status, transferring session isn't waiting")
+		return nil
+	}
+	if session.WaitTimeoutOn() == nil {
+		log.Info("ignoring airtime status, session wait has no timeout")
+		return nil
+	}
+
+	resume := resumes.NewWaitTimeout(oa.Env(), contact)
+
+	_, err = runner.ResumeFlowWithChanges(ctx, rt, oa, session, modelContact, resume, nil, func(fs flows.Session) error {
+		updateAirtimeResult(fs, event)
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "error resuming flow for airtime status")
+	}
+
+	log.WithField("status", event.Status).Info("resumed session after airtime transfer status")
+	return nil
+}
+
+// updates the result saved by the transfer airtime action which made the given transfer with its final outcome
+func updateAirtimeResult(fs flows.Session, event *AirtimeStatusEvent) {
+	var run flows.Run
+	var result *flows.Result
+
+	// the action saves its result just after the transfer is made, so look for the first one after that
+	for _, r := range fs.Runs() {
+		if r.Flow() == nil {
+			continue
+		}
+		for _, res := range r.Results() {
+			if res.CreatedOn.Before(event.TransferredOn) || !isTransferAirtimeNode(r.Flow().GetNode(res.NodeUUID)) {
+				continue
+			}
+			if result == nil || res.CreatedOn.Before(result.CreatedOn) {
+				run, result = r, res
+			}
+		}
+	}
+	if result == nil {
+		return
+	}
+
+	value, category := "0", actions.CategoryFailure
+	if event.Status == models.AirtimeTransferStatusSuccess {
+		value, category = event.ActualAmount.String(), actions.CategorySuccess
+	}
+
+	run.SaveResult(flows.NewResult(result.Name, value, category, "", result.NodeUUID, "", nil, time.Now()))
+}
+
+func isTransferAirtimeNode(node flows.Node) bool {
+	if node != nil {
+		for _, action := range node.Actions() {
+			if action.Type() == actions.TypeTransferAirtime {
+				return true
+			}
+		}
+	}
+	return false
+}
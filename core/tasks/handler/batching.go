@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+// the most messages from a contact that will be handled together
+const maxMsgBatchSize = 10
+
+// if the handler is batching messages and batching is enabled for the org, pops any following text messages from the
+// same contact, URN and channel which were queued within the batch window of the given message event, combining them
+// into the given event so that they're handled together. We never wait for more messages as we hold the contact's lock,
+// so only messages which are already queued, e.g. because the contact sent them while we were busy, are batched.
+//
+// The texts of the batched messages are joined with newlines to form the text of the given event, and so of the message
+// the flow sees, but the messages themselves aren't changed. Once the event has been handled, the batched messages are
+// updated to have been handled the same way (see models.CopyMsgHandling). Returns the tasks which were popped so that
+// they can be requeued if handling fails.
+func batchMsgEvents(ctx context.Context, rt *runtime.Runtime, contactQ string, task *queue.Task, event *MsgEvent) ([]*queue.Task, error) {
+	window := time.Duration(rt.Config.HandlerBatchWindow) * time.Millisecond
+	if window <= 0 || !isBatchable(event) || !models.IsFeatureEnabled(ctx, rt, models.FeatureMsgBatching, event.OrgID) {
+		return nil, nil
+	}
+
+	windowEnd := task.QueuedOn.Add(window)
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	batched := make([]*queue.Task, 0)
+	texts := []string{event.Text}
+
+	// we hold the contact lock so nothing else can pop from the contact's queue while we peek at it
+	for len(batched) < maxMsgBatchSize-1 {
+		next, err := redis.Bytes(rc.Do("LINDEX", contactQ, 0))
+		if err == redis.ErrNil {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "error peeking at contact queue")
+		}
+
+		nextTask := &queue.Task{}
+		if err := json.Unmarshal(next, nextTask); err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling contact event")
+		}
+		if nextTask.Type != MsgEventType || nextTask.QueuedOn.After(windowEnd) {
+			break
+		}
+
+		nextEvent := &MsgEvent{}
+		if err := json.Unmarshal(nextTask.Task, nextEvent); err != nil {
+			return nil, errors.Wrap(err, "error unmarshalling msg event")
+		}
+		if !isBatchable(nextEvent) || nextEvent.ChannelID != event.ChannelID || nextEvent.URN != event.URN {
+			break
+		}
+
+		if _, err := rc.Do("LPOP", contactQ); err != nil {
+			return nil, errors.Wrap(err, "error popping contact event")
+		}
+
+		batched = append(batched, nextTask)
+		texts = append(texts, nextEvent.Text)
+		event.BatchedMsgIDs = append(event.BatchedMsgIDs, nextEvent.MsgID)
+		event.NewContact = event.NewContact || nextEvent.NewContact
+	}
+
+	event.Text = strings.Join(texts, "\n")
+
+	return batched, nil
+}
+
+// only plain text messages are batched, as attachments are saved on the message which is handled
+func isBatchable(event *MsgEvent) bool {
+	return len(event.Attachments) == 0 && event.Subject == "" && event.Text != ""
+}
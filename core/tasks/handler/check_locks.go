@@ -0,0 +1,29 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.RegisterCron("check_contact_locks", time.Minute, false, CheckContactLocks)
+}
+
+// CheckContactLocks looks for contact locks which have been held for too long, which usually means a task is stuck
+func CheckContactLocks(ctx context.Context, rt *runtime.Runtime) error {
+	held, err := models.CheckHeldContactLocks(rt)
+	if err != nil {
+		return errors.Wrap(err, "error checking held contact locks")
+	}
+
+	if held > 0 {
+		logrus.WithField("comp", "contact_locks").WithField("held", held).Info("found contact locks held past threshold")
+	}
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/urns"
@@ -429,6 +430,68 @@ func TestMsgEvents(t *testing.T) {
 	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND direction = 'O' AND created_on > $2`, testdata.Org2Contact.ID, previous).Returns(0)
 }
 
+func TestMsgBatching(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+	defer func() {
+		rt.Config.HandlerBatchWindow = 0
+		db.MustExec(`DELETE FROM orgs_featureflag`)
+		models.FlushCache()
+	}()
+
+	testdata.InsertKeywordTrigger(db, testdata.Org1, testdata.Favorites, "start", models.MatchOnly, nil, nil)
+
+	// batching is only done for orgs with the feature enabled
+	db.MustExec(`INSERT INTO orgs_featureflag(name, is_active, org_ids, percentage) VALUES('msg_batching', TRUE, $1, 0)`, pq.Array([]models.OrgID{testdata.Org1.ID}))
+	models.FlushCache()
+
+	queueMsg := func(text string) *flows.MsgIn {
+		msg := testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwitterChannel, testdata.Cathy, text, models.MsgStatusPending)
+		task := &queue.Task{Type: handler.MsgEventType, OrgID: int(testdata.Org1.ID), QueuedOn: time.Now(), Task: jsonx.MustMarshal(&handler.MsgEvent{
+			ContactID: testdata.Cathy.ID,
+			OrgID:     testdata.Org1.ID,
+			ChannelID: testdata.TwitterChannel.ID,
+			MsgID:     msg.ID(),
+			MsgUUID:   msg.UUID(),
+			URN:       testdata.Cathy.URN,
+			URNID:     testdata.Cathy.URNID,
+			Text:      text,
+		})}
+		require.NoError(t, handler.QueueHandleTask(rc, testdata.Cathy.ID, task))
+		return msg
+	}
+	handleTasks := func() {
+		for {
+			task, err := queue.PopNextTask(rc, queue.HandlerQueue)
+			require.NoError(t, err)
+			if task == nil {
+				break
+			}
+			require.NoError(t, handler.HandleEvent(ctx, rt, task))
+		}
+	}
+
+	// start Cathy in the favorites flow so she's waiting for a color
+	queueMsg("start")
+	handleTasks()
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND direction = 'O'`, testdata.Cathy.ID).Returns(1)
+
+	rt.Config.HandlerBatchWindow = 50
+
+	// send two messages in quick succession which are handled together as one resume
+	msg1 := queueMsg("purple")
+	msg2 := queueMsg("blue")
+	handleTasks()
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND direction = 'O'`, testdata.Cathy.ID).Returns(2)
+	assertdb.Query(t, db, `SELECT text FROM msgs_msg WHERE contact_id = $1 AND direction = 'O' ORDER BY id DESC LIMIT 1`, testdata.Cathy.ID).Returns("Good choice, I like Blue too! What is your favorite beer?")
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE id = ANY($1) AND status = 'H' AND msg_type = 'F' AND flow_id = $2`, pq.Array([]flows.MsgID{msg1.ID(), msg2.ID()}), testdata.Favorites.ID).Returns(2)
+}
+
 func TestChannelEvents(t *testing.T) {
 	ctx, rt, db, rp := testsuite.Get()
 	rc := rp.Get()
@@ -566,9 +629,10 @@ func TestStopEvent(t *testing.T) {
 	// that cathy is stopped
 	assertdb.Query(t, db, `SELECT count(*) FROM contacts_contact WHERE id = $1 AND status = 'S'`, testdata.Cathy.ID).Returns(1)
 
-	// and has no upcoming events
-	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1`, testdata.Cathy.ID).Returns(0)
-	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1`, testdata.George.ID).Returns(1)
+	// and has no upcoming events, with her event recorded as skipped
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1 AND fired IS NULL`, testdata.Cathy.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT skip_reason FROM campaigns_eventfire WHERE contact_id = $1 AND fired_result = 'S'`, testdata.Cathy.ID).Returns("contact_inactive")
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_eventfire WHERE contact_id = $1 AND fired IS NULL`, testdata.George.ID).Returns(1)
 }
 
 func TestTimedEvents(t *testing.T) {
@@ -1,17 +1,22 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
 	"github.com/pkg/errors"
 )
 
+var contactQueueKeys = orgkeys.Register("c:%d:%d")
+
 // QueueHandleTask queues a single task for the given contact
 func QueueHandleTask(rc redis.Conn, contactID models.ContactID, task *queue.Task) error {
 	return queueHandleTask(rc, contactID, task, false)
@@ -27,7 +32,7 @@ func queueHandleTask(rc redis.Conn, contactID models.ContactID, task *queue.Task
 	}
 
 	// first push the event on our contact queue
-	contactQ := fmt.Sprintf("c:%d:%d", task.OrgID, contactID)
+	contactQ := contactQueueKeys.Key(task.OrgID, contactID)
 	if front {
 		_, err = redis.Int64(rc.Do("lpush", contactQ, string(taskJSON)))
 
@@ -41,6 +46,47 @@ func queueHandleTask(rc redis.Conn, contactID models.ContactID, task *queue.Task
 	return queueContactTask(rc, models.OrgID(task.OrgID), contactID)
 }
 
+// moves the events queued for a contact to another region's Redis, so that they're there when the forwarded handle task
+// for the contact is handled in that region
+func forwardContactEvents(ctx context.Context, rt *runtime.Runtime, task *queue.Task, regionRC redis.Conn) error {
+	eventTask := &HandleEventTask{}
+	if err := json.Unmarshal(task.Task, eventTask); err != nil {
+		return errors.Wrapf(err, "error decoding contact event task")
+	}
+
+	// don't move events out from under a handler which is handling them here
+	lock, err := models.LockContact(rt, models.OrgID(task.OrgID), eventTask.ContactID, task.Type, time.Second*10)
+	if err != nil {
+		return errors.Wrapf(err, "error acquiring lock for contact %d", eventTask.ContactID)
+	}
+	if lock == nil {
+		return errors.Errorf("unable to acquire lock for contact %d", eventTask.ContactID)
+	}
+	defer lock.Release(rt)
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	contactQ := contactQueueKeys.Key(task.OrgID, eventTask.ContactID)
+	events, err := redis.Strings(rc.Do("lrange", contactQ, 0, -1))
+	if err != nil {
+		return errors.Wrapf(err, "error reading contact events")
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	if _, err := regionRC.Do("rpush", redis.Args{}.Add(contactQ).AddFlat(events)...); err != nil {
+		return errors.Wrapf(err, "error adding contact events to region")
+	}
+
+	// only remove the events we've forwarded, with the lock held any new events can only have been added after them
+	if _, err := rc.Do("ltrim", contactQ, len(events), -1); err != nil {
+		return errors.Wrapf(err, "error removing forwarded contact events")
+	}
+	return nil
+}
+
 // pushes a single contact task on our queue. Note this does not push the actual content of the task
 // only that a task exists for the contact, addHandleTask should be used if the task has already been pushed
 // off the contact specific queue.
@@ -48,8 +94,9 @@ func queueContactTask(rc redis.Conn, orgID models.OrgID, contactID models.Contac
 	// create our contact event
 	contactTask := &HandleEventTask{ContactID: contactID}
 
-	// then add a handle task for that contact on our global handler queue
-	err := queue.AddTask(rc, queue.HandlerQueue, queue.HandleContactEvent, int(orgID), contactTask, queue.DefaultPriority)
+	// then add a handle task for that contact on our global handler queue, events from different sources can be queued for
+	// the same contact so these don't carry a trace ID and each gets its own when handled
+	err := queue.AddTask(context.Background(), rc, queue.HandlerQueue, queue.HandleContactEvent, int(orgID), contactTask, queue.DefaultPriority)
 	if err != nil {
 		return errors.Wrapf(err, "error adding handle event task")
 	}
@@ -73,3 +120,15 @@ func QueueTicketEvent(rc redis.Conn, contactID models.ContactID, evt *models.Tic
 
 	return queueHandleTask(rc, contactID, task, false)
 }
+
+// QueueLinkClickedEvent queues a handle task for the given link clicked channel event
+func QueueLinkClickedEvent(rc redis.Conn, evt *models.ChannelEvent) error {
+	task := &queue.Task{
+		Type:     LinkClickedEventType,
+		OrgID:    int(evt.OrgID()),
+		Task:     jsonx.MustMarshal(evt),
+		QueuedOn: dates.Now(),
+	}
+
+	return queueHandleTask(rc, evt.ContactID(), task, false)
+}
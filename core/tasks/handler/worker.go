@@ -4,18 +4,23 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
 	"github.com/nyaruka/gocommon/analytics"
+	"github.com/nyaruka/gocommon/dates"
 	"github.com/nyaruka/gocommon/dbutil"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/engine"
 	"github.com/nyaruka/goflow/flows/events"
 	"github.com/nyaruka/goflow/flows/resumes"
+	"github.com/nyaruka/goflow/flows/routers"
 	"github.com/nyaruka/goflow/flows/triggers"
 	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/mailroom"
@@ -24,6 +29,7 @@ import (
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/core/runner"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/logs"
 	"github.com/nyaruka/null"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -39,10 +45,13 @@ const (
 	ExpirationEventType      = "expiration_event"
 	TimeoutEventType         = "timeout_event"
 	TicketClosedEventType    = "ticket_closed"
+	LinkClickedEventType     = string(models.LinkClickedEventType)
+	AirtimeStatusEventType   = "airtime_status"
 )
 
 func init() {
 	mailroom.AddTaskFunction(queue.HandleContactEvent, HandleEvent)
+	mailroom.AddTaskForwarder(queue.HandleContactEvent, forwardContactEvents)
 }
 
 func HandleEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Task) error {
@@ -61,32 +70,29 @@ func handleContactEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Ta
 		return errors.Wrapf(err, "error decoding contact event task")
 	}
 
-	// acquire the lock for this contact
-	locker := models.GetContactLocker(models.OrgID(task.OrgID), eventTask.ContactID)
+	ctx = logs.With(ctx, "contact_id", eventTask.ContactID)
 
-	lock, err := locker.Grab(rt.RP, time.Second*10)
+	// acquire the lock for this contact
+	lock, err := models.LockContact(rt, models.OrgID(task.OrgID), eventTask.ContactID, task.Type, time.Second*10)
 	if err != nil {
 		return errors.Wrapf(err, "error acquiring lock for contact %d", eventTask.ContactID)
 	}
 
 	// we didn't get the lock within our timeout, skip and requeue for later
-	if lock == "" {
+	if lock == nil {
 		rc := rt.RP.Get()
 		defer rc.Close()
 		err = queueContactTask(rc, models.OrgID(task.OrgID), eventTask.ContactID)
 		if err != nil {
 			return errors.Wrapf(err, "error re-adding contact task after failing to get lock")
 		}
-		logrus.WithFields(logrus.Fields{
-			"org_id":     task.OrgID,
-			"contact_id": eventTask.ContactID,
-		}).Info("failed to get lock for contact, requeued and skipping")
+		logs.From(ctx).Info("failed to get lock for contact, requeued and skipping")
 		return nil
 	}
-	defer locker.Release(rt.RP, lock)
+	defer lock.Release(rt)
 
 	// read all the events for this contact, one by one
-	contactQ := fmt.Sprintf("c:%d:%d", task.OrgID, eventTask.ContactID)
+	contactQ := contactQueueKeys.Key(task.OrgID, eventTask.ContactID)
 	for {
 		// pop the next event off this contacts queue
 		rc := rt.RP.Get()
@@ -105,6 +111,9 @@ func handleContactEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Ta
 
 		start := time.Now()
 
+		// any other events which are handled together with this one
+		var batched []*queue.Task
+
 		// decode our event, this is a normal task at its top level
 		contactEvent := &queue.Task{}
 		err = json.Unmarshal([]byte(event), contactEvent)
@@ -137,7 +146,14 @@ func handleContactEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Ta
 			if err != nil {
 				return errors.Wrapf(err, "error unmarshalling msg event: %s", event)
 			}
+			batched, err = batchMsgEvents(ctx, rt, contactQ, contactEvent, msg)
+			if err != nil {
+				return errors.Wrapf(err, "error batching msg events")
+			}
 			err = handleMsgEvent(ctx, rt, msg)
+			if err == nil && len(msg.BatchedMsgIDs) > 0 {
+				err = models.CopyMsgHandling(ctx, rt.DB, msg.MsgID, msg.BatchedMsgIDs)
+			}
 
 		case TicketClosedEventType:
 			evt := &models.TicketEvent{}
@@ -147,6 +163,22 @@ func handleContactEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Ta
 			}
 			err = handleTicketEvent(ctx, rt, evt)
 
+		case LinkClickedEventType:
+			evt := &models.ChannelEvent{}
+			err = json.Unmarshal(contactEvent.Task, evt)
+			if err != nil {
+				return errors.Wrapf(err, "error unmarshalling link clicked event: %s", event)
+			}
+			err = handleLinkClickedEvent(ctx, rt, evt)
+
+		case AirtimeStatusEventType:
+			evt := &AirtimeStatusEvent{}
+			err = json.Unmarshal(contactEvent.Task, evt)
+			if err != nil {
+				return errors.Wrapf(err, "error unmarshalling airtime status event: %s", event)
+			}
+			err = handleAirtimeStatusEvent(ctx, rt, evt)
+
 		case TimeoutEventType, ExpirationEventType:
 			evt := &TimedEvent{}
 			err = json.Unmarshal(contactEvent.Task, evt)
@@ -167,23 +199,30 @@ func handleContactEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Ta
 
 		// if we get an error processing an event, requeue it for later and return our error
 		if err != nil {
-			log := logrus.WithFields(logrus.Fields{
-				"org_id":     task.OrgID,
-				"contact_id": eventTask.ContactID,
-				"event":      event,
-			})
+			log := logs.From(ctx).WithField("event", event)
 
 			if qerr := dbutil.AsQueryError(err); qerr != nil {
 				query, params := qerr.Query()
 				log = log.WithFields(logrus.Fields{"sql": query, "sql_params": params})
 			}
 
+			// requeue any events which were batched with this one so they're retried individually or batched again
+			if len(batched) > 0 {
+				rc := rt.RP.Get()
+				for i := len(batched) - 1; i >= 0; i-- {
+					if retryErr := queueHandleTask(rc, eventTask.ContactID, batched[i], true); retryErr != nil {
+						log.WithError(retryErr).Error("error requeuing batched contact event")
+					}
+				}
+				rc.Close()
+			}
+
 			contactEvent.ErrorCount++
 			if contactEvent.ErrorCount < 3 {
 				rc := rt.RP.Get()
 				retryErr := queueHandleTask(rc, eventTask.ContactID, contactEvent, true)
 				if retryErr != nil {
-					logrus.WithError(retryErr).Error("error requeuing errored contact event")
+					log.WithError(retryErr).Error("error requeuing errored contact event")
 				}
 				rc.Close()
 
@@ -199,7 +238,7 @@ func handleContactEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Ta
 // handleTimedEvent is called for timeout events
 func handleTimedEvent(ctx context.Context, rt *runtime.Runtime, eventType string, event *TimedEvent) error {
 	start := time.Now()
-	log := logrus.WithFields(logrus.Fields{"event_type": eventType, "contact_id": event.ContactID, "session_id": event.SessionID})
+	log := logs.From(ctx).WithFields(logrus.Fields{"event_type": eventType, "session_id": event.SessionID})
 
 	oa, err := models.GetOrgAssets(ctx, rt, event.OrgID)
 	if err != nil {
@@ -361,26 +400,46 @@ func HandleChannelEvent(ctx context.Context, rt *runtime.Runtime, eventType mode
 	}
 
 	if event.IsNewContact() {
+		if err := models.LookupNewContactNumber(ctx, rt, oa, contact); err != nil {
+			return nil, errors.Wrapf(err, "error looking up new contact number")
+		}
+
 		err = models.CalculateDynamicGroups(ctx, rt.DB, oa, []*flows.Contact{contact})
 		if err != nil {
 			return nil, errors.Wrapf(err, "unable to initialize new contact")
 		}
 	}
 
-	// no trigger, noop, move on
-	if trigger == nil {
-		logrus.WithField("channel_id", event.ChannelID()).WithField("event_type", eventType).WithField("extra", event.Extra()).Info("ignoring channel event, no trigger found")
-		return nil, nil
+	// incoming calls can be routed to a specific flow by call screening, which takes precedence over any trigger
+	var flow *models.Flow
+	if routeTo := event.ExtraValue(models.ChannelEventExtraFlowUUID); eventType == models.MOCallEventType && routeTo != "" {
+		routed, err := oa.FlowByUUID(assets.FlowUUID(routeTo))
+		if err != nil && err != models.ErrNotFound {
+			return nil, errors.Wrapf(err, "error loading flow for routed call")
+		}
+		if routed != nil {
+			flow = routed.(*models.Flow)
+		} else {
+			logrus.WithField("flow_uuid", routeTo).Warn("ignoring routing of call to non-existent flow")
+		}
 	}
 
-	// load our flow
-	flow, err := oa.FlowByID(trigger.FlowID())
-	if err == models.ErrNotFound {
-		return nil, nil
-	}
+	if flow == nil {
+		// no trigger, noop, move on
+		if trigger == nil {
+			logrus.WithField("channel_id", event.ChannelID()).WithField("event_type", eventType).WithField("extra", event.Extra()).Info("ignoring channel event, no trigger found")
+			return nil, nil
+		}
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "error loading flow for trigger")
+		// load our flow
+		flow, err = oa.FlowByID(trigger.FlowID())
+		if err == models.ErrNotFound {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err, "error loading flow for trigger")
+		}
 	}
 
 	// if this is an IVR flow and we don't have a call, trigger that asynchronously
@@ -419,6 +478,7 @@ func HandleChannelEvent(ctx context.Context, rt *runtime.Runtime, eventType mode
 		urn := contacts[0].URNForID(event.URNID())
 		flowTrigger = triggers.NewBuilder(oa.Env(), flow.Reference(), contact).
 			Channel(channel.ChannelReference(), triggers.ChannelEventTypeIncomingCall).
+			WithParams(params).
 			WithCall(urn).
 			Build()
 
@@ -448,6 +508,119 @@ func HandleChannelEvent(ctx context.Context, rt *runtime.Runtime, eventType mode
 	return sessions[0], nil
 }
 
+// handleLinkClickedEvent is called when a contact clicks a tracked link. The engine has no dedicated wait for link
+// clicks so if the session which sent the link is still waiting on a node which tests for the link URL, it's resumed
+// with the link URL as the input. Clicks on links which other waits aren't expecting are only recorded.
+func handleLinkClickedEvent(ctx context.Context, rt *runtime.Runtime, event *models.ChannelEvent) error {
+	oa, err := models.GetOrgAssets(ctx, rt, event.OrgID())
+	if err != nil {
+		return errors.Wrapf(err, "error loading org")
+	}
+
+	channel := oa.ChannelByID(event.ChannelID())
+	if channel == nil {
+		logrus.WithField("channel_id", event.ChannelID()).Info("ignoring link click, couldn't find channel")
+		return nil
+	}
+
+	link, err := models.LoadTrackedLinkByCode(ctx, rt.DB, event.ExtraValue("code"))
+	if err != nil {
+		return err
+	}
+	if link == nil {
+		return nil
+	}
+
+	modelContact, err := models.LoadContact(ctx, rt.ReadonlyDB, oa, event.ContactID())
+	if err != nil {
+		return errors.Wrapf(err, "error loading contact")
+	}
+
+	// contact has been deleted or is blocked, ignore this event
+	if modelContact == nil || modelContact.Status() == models.ContactStatusBlocked {
+		return nil
+	}
+
+	err = modelContact.UpdateLastSeenOn(ctx, rt.DB, event.OccurredOn())
+	if err != nil {
+		return errors.Wrap(err, "error updating contact last_seen_on")
+	}
+
+	// link wasn't sent by a flow so nothing to resume
+	if link.SessionID == 0 {
+		return nil
+	}
+
+	contact, err := modelContact.FlowContact(oa)
+	if err != nil {
+		return errors.Wrapf(err, "error creating flow contact")
+	}
+
+	session, err := models.FindWaitingSessionForContact(ctx, rt.DB, rt.SessionStorage, oa, models.FlowTypeMessaging, contact)
+	if err != nil {
+		return errors.Wrapf(err, "error loading waiting session for contact")
+	}
+
+	// if there's no waiting session or it's not the session which sent the link, nothing to resume
+	if session == nil || session.ID() != link.SessionID {
+		return nil
+	}
+
+	// and the flow it's waiting in must still exist
+	if _, err := oa.FlowByID(session.CurrentFlowID()); err == models.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return errors.Wrapf(err, "error loading flow for session")
+	}
+
+	fs, err := session.FlowSession(rt.Config, oa.SessionAssets(), oa.Env())
+	if err != nil {
+		return errors.Wrapf(err, "error creating flow session")
+	}
+
+	// don't resume waits which aren't expecting this link, e.g. a question sent after the link
+	if !waitExpectsLink(fs, link.URL) {
+		return nil
+	}
+
+	msgIn := flows.NewMsgIn(flows.MsgUUID(uuids.New()), modelContact.URNForID(event.URNID()), channel.ChannelReference(), link.URL, nil)
+
+	_, err = runner.ResumeFlow(ctx, rt, oa, session, modelContact, resumes.NewMsg(oa.Env(), contact, msgIn), nil)
+	if err != nil {
+		return errors.Wrapf(err, "error resuming flow for link click")
+	}
+	return nil
+}
+
+// checks whether the node the given session is waiting at has a case which tests for the given link URL
+func waitExpectsLink(fs flows.Session, url string) bool {
+	for _, run := range fs.Runs() {
+		if run.Status() != flows.RunStatusWaiting || len(run.Path()) == 0 {
+			continue
+		}
+
+		node := run.Flow().GetNode(run.Path()[len(run.Path())-1].NodeUUID())
+		if node == nil {
+			return false
+		}
+
+		router, isSwitch := node.Router().(*routers.SwitchRouter)
+		if !isSwitch {
+			return false
+		}
+
+		for _, c := range router.Cases() {
+			for _, arg := range c.Arguments {
+				if strings.Contains(arg, url) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
+
 // handleStopEvent is called when a contact is stopped by courier
 func handleStopEvent(ctx context.Context, rt *runtime.Runtime, event *StopEvent) error {
 	tx, err := rt.DB.BeginTxx(ctx, nil)
@@ -506,6 +679,14 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 		}
 	}
 
+	// an incoming message opens the window in which free-form messages can be sent to the contact on WhatsApp
+	rc := rt.RP.Get()
+	err = models.RecordWhatsAppIncoming(rc, channel, event.ContactID, dates.Now())
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
 	// load our contact
 	modelContact, err := models.LoadContact(ctx, rt.ReadonlyDB, oa, event.ContactID)
 	if err != nil {
@@ -514,7 +695,7 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 
 	// contact has been deleted, or is blocked, or channel no longer exists, ignore this message but mark it as handled
 	if modelContact == nil || modelContact.Status() == models.ContactStatusBlocked || channel == nil {
-		err := models.UpdateMessage(ctx, rt.DB, event.MsgID, models.MsgStatusHandled, models.VisibilityArchived, models.MsgTypeInbox, models.NilFlowID, attachments, logUUIDs)
+		err := archiveMsg(ctx, rt, oa, event, attachments, logUUIDs)
 		if err != nil {
 			return errors.Wrapf(err, "error updating message for deleted contact")
 		}
@@ -546,6 +727,34 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 		return errors.Wrapf(err, "error creating flow contact")
 	}
 
+	// check this message against the org's abuse rules before it can trigger anything, and if the contact is now blocked
+	// or stopped, ignore it like we would any other message from a blocked contact
+	abusive, err := models.CheckMsgAbuse(ctx, rt, oa, contact, event.Text)
+	if err != nil {
+		return errors.Wrapf(err, "error checking message for abuse")
+	}
+	if abusive {
+		err := archiveMsg(ctx, rt, oa, event, attachments, logUUIDs)
+		if err != nil {
+			return errors.Wrapf(err, "error updating message for abusive contact")
+		}
+		return nil
+	}
+
+	// if this is a new contact, look up its number so flows can use the results
+	if event.NewContact {
+		if err := models.LookupNewContactNumber(ctx, rt, oa, contact); err != nil {
+			return errors.Wrapf(err, "error looking up new contact number")
+		}
+	}
+
+	// if org detects languages, this message may tell us which language to localize flows in for this contact
+	if event.Text != "" {
+		if err := models.DetectContactLanguage(ctx, rt, oa, contact, event.Text); err != nil {
+			return errors.Wrapf(err, "error detecting contact language")
+		}
+	}
+
 	// if this is a new contact, we need to calculate dynamic groups and campaigns
 	if newContact {
 		err = models.CalculateDynamicGroups(ctx, rt.DB, oa, []*flows.Contact{contact})
@@ -563,8 +772,13 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 		ticket.ForwardIncoming(ctx, rt, oa, event.MsgUUID, event.Text, attachments)
 	}
 
-	// find any matching triggers
-	trigger := models.FindMatchingMsgTrigger(oa, contact, event.Text)
+	// find any matching triggers, which for emails can also be keywords in their subject
+	var trigger *models.Trigger
+	if event.Subject != "" {
+		trigger = models.FindMatchingEmailTrigger(oa, contact, event.Subject, event.Text)
+	} else {
+		trigger = models.FindMatchingMsgTrigger(oa, contact, event.Text)
+	}
 
 	// look for a waiting session for this contact
 	session, err := models.FindWaitingSessionForContact(ctx, rt.DB, rt.SessionStorage, oa, models.FlowTypeMessaging, contact)
@@ -592,6 +806,11 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 	msgIn.SetExternalID(string(event.MsgExternalID))
 	msgIn.SetID(event.MsgID)
 
+	// if org is sampling messages for analytics, maybe queue a sample of this one
+	if sampling := oa.Org().MsgSampling(); sampling != nil && sampling.ShouldSample() {
+		queueMsgSample(rt, oa, contact, msgIn)
+	}
+
 	// build our hook to mark a flow message as handled
 	flowMsgHook := func(ctx context.Context, tx *sqlx.Tx, rp *redis.Pool, oa *models.OrgAssets, sessions []*models.Session) error {
 		// set our incoming message event on our session
@@ -600,7 +819,7 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 		}
 		sessions[0].SetIncomingMsg(event.MsgID, event.MsgExternalID)
 
-		return markMsgHandled(ctx, tx, contact, msgIn, flow, attachments, tickets, logUUIDs)
+		return markMsgHandled(ctx, tx, oa, event, msgIn, flow, attachments, tickets, logUUIDs)
 	}
 
 	// we found a trigger and their session is nil or doesn't ignore keywords
@@ -617,7 +836,7 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 			// if this is an IVR flow, we need to trigger that start (which happens in a different queue)
 			if flow.FlowType() == models.FlowTypeVoice {
 				ivrMsgHook := func(ctx context.Context, tx *sqlx.Tx) error {
-					return markMsgHandled(ctx, tx, contact, msgIn, flow, attachments, tickets, logUUIDs)
+					return markMsgHandled(ctx, tx, oa, event, msgIn, flow, attachments, tickets, logUUIDs)
 				}
 				err = runner.TriggerIVRFlow(ctx, rt, oa.OrgID(), flow.ID(), []models.ContactID{modelContact.ID()}, ivrMsgHook)
 				if err != nil {
@@ -626,6 +845,12 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 				return nil
 			}
 
+			// if the flow only sends a static reply and the contact isn't waiting in another flow, we can send that reply
+			// without starting a session if the org has the fast path enabled
+			if trigger.TriggerType() == models.KeywordTriggerType && session == nil && flow.AutoReply() != nil && oa.Org().AutoReplyFastPath() {
+				return handleAsAutoReply(ctx, rt, oa, event, channel, contact, flow, msgIn, attachments, logUUIDs, tickets)
+			}
+
 			// otherwise build the trigger and start the flow directly
 			trigger := triggers.NewBuilder(oa.Env(), flow.Reference(), contact).Msg(msgIn).WithMatch(trigger.Match()).Build()
 			_, err = runner.StartFlowForContacts(ctx, rt, oa, flow, []*models.Contact{modelContact}, []flows.Trigger{trigger}, flowMsgHook, true)
@@ -647,7 +872,7 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 	}
 
 	// this message didn't trigger and new sessions or resume any existing ones, so handle as inbox
-	err = handleAsInbox(ctx, rt, oa, contact, msgIn, attachments, logUUIDs, tickets)
+	err = handleAsInbox(ctx, rt, oa, event, contact, msgIn, attachments, logUUIDs, tickets)
 	if err != nil {
 		return errors.Wrapf(err, "error handling inbox message")
 	}
@@ -655,6 +880,15 @@ func handleMsgEvent(ctx context.Context, rt *runtime.Runtime, event *MsgEvent) e
 }
 
 func handleTicketEvent(ctx context.Context, rt *runtime.Runtime, event *models.TicketEvent) error {
+	// most orgs don't have ticket closed triggers so check for any with only triggers loaded before loading everything
+	scoped, err := models.GetOrgAssetsScoped(ctx, rt, event.OrgID(), models.RefreshTriggers)
+	if err != nil {
+		return errors.Wrapf(err, "error loading org")
+	}
+	if event.EventType() == models.TicketEventTypeClosed && !models.HasTriggerOfType(scoped, models.TicketClosedTriggerType) {
+		return nil
+	}
+
 	oa, err := models.GetOrgAssets(ctx, rt, event.OrgID())
 	if err != nil {
 		return errors.Wrapf(err, "error loading org")
@@ -751,7 +985,7 @@ func handleTicketEvent(ctx context.Context, rt *runtime.Runtime, event *models.T
 }
 
 // handles a message as an inbox message
-func handleAsInbox(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, contact *flows.Contact, msg *flows.MsgIn, attachments []utils.Attachment, logUUIDs []models.ChannelLogUUID, tickets []*models.Ticket) error {
+func handleAsInbox(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, event *MsgEvent, contact *flows.Contact, msg *flows.MsgIn, attachments []utils.Attachment, logUUIDs []models.ChannelLogUUID, tickets []*models.Ticket) error {
 	// usually last_seen_on is updated by handling the msg_received event in the engine sprint, but since this is an inbox
 	// message we manually create that event and handle it
 	msgEvent := events.NewMsgReceived(msg)
@@ -763,11 +997,61 @@ func handleAsInbox(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsset
 		return errors.Wrap(err, "error handling inbox message events")
 	}
 
-	return markMsgHandled(ctx, rt.DB, contact, msg, nil, attachments, tickets, logUUIDs)
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "error starting transaction")
+	}
+
+	if err := markMsgHandled(ctx, tx, oa, event, msg, nil, attachments, tickets, logUUIDs); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "error committing handled message")
 }
 
-// utility to mark as message as handled and update any open contact tickets
-func markMsgHandled(ctx context.Context, db models.Queryer, contact *flows.Contact, msg *flows.MsgIn, flow *models.Flow, attachments []utils.Attachment, tickets []*models.Ticket, logUUIDs []models.ChannelLogUUID) error {
+// handles a message which triggered a flow with a static reply by sending that reply directly
+func handleAsAutoReply(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, event *MsgEvent, channel *models.Channel, contact *flows.Contact, flow *models.Flow, msg *flows.MsgIn, attachments []utils.Attachment, logUUIDs []models.ChannelLogUUID, tickets []*models.Ticket) error {
+	// handle the msg_received event ourselves as we do for inbox messages
+	msgEvent := events.NewMsgReceived(msg)
+	contact.SetLastSeenOn(msgEvent.CreatedOn())
+
+	err := models.HandleAndCommitEvents(ctx, rt, oa, models.NilUserID, map[*flows.Contact][]flows.Event{contact: {msgEvent}})
+	if err != nil {
+		return errors.Wrap(err, "error handling auto reply message events")
+	}
+
+	receivedHook := func(ctx context.Context, tx *sqlx.Tx) error {
+		return recordMsgReceived(ctx, tx, oa, event)
+	}
+
+	replies, err := models.SendAutoReply(ctx, rt, oa, channel, contact, flow, msg, attachments, logUUIDs, receivedHook)
+	if err != nil {
+		return errors.Wrap(err, "error creating auto reply")
+	}
+
+	if len(tickets) > 0 {
+		if err := models.UpdateTicketLastActivity(ctx, rt.DB, tickets); err != nil {
+			return errors.Wrapf(err, "error updating last activity for open tickets")
+		}
+	}
+
+	msgio.SendMessages(ctx, rt, rt.DB, nil, replies)
+	return nil
+}
+
+// queues a redacted sample of the given message, failures are logged but shouldn't stop the message being handled
+func queueMsgSample(rt *runtime.Runtime, oa *models.OrgAssets, contact *flows.Contact, msg *flows.MsgIn) {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.QueueMsgSample(rc, oa.OrgID(), models.NewMsgSample(contact, msg, dates.Now())); err != nil {
+		logrus.WithError(err).WithField("org_id", oa.OrgID()).Error("error queuing message sample")
+	}
+}
+
+// utility to mark as message as handled, record that it was received and update any open contact tickets
+func markMsgHandled(ctx context.Context, tx *sqlx.Tx, oa *models.OrgAssets, event *MsgEvent, msg *flows.MsgIn, flow *models.Flow, attachments []utils.Attachment, tickets []*models.Ticket, logUUIDs []models.ChannelLogUUID) error {
 	msgType := models.MsgTypeInbox
 	flowID := models.NilFlowID
 	if flow != nil {
@@ -775,13 +1059,17 @@ func markMsgHandled(ctx context.Context, db models.Queryer, contact *flows.Conta
 		flowID = flow.ID()
 	}
 
-	err := models.UpdateMessage(ctx, db, msg.ID(), models.MsgStatusHandled, models.VisibilityVisible, msgType, flowID, attachments, logUUIDs)
+	err := models.UpdateMessage(ctx, tx, msg.ID(), models.MsgStatusHandled, models.VisibilityVisible, msgType, flowID, attachments, logUUIDs)
 	if err != nil {
 		return errors.Wrapf(err, "error marking message as handled")
 	}
 
+	if err := recordMsgReceived(ctx, tx, oa, event); err != nil {
+		return err
+	}
+
 	if len(tickets) > 0 {
-		err = models.UpdateTicketLastActivity(ctx, db, tickets)
+		err = models.UpdateTicketLastActivity(ctx, tx, tickets)
 		if err != nil {
 			return errors.Wrapf(err, "error updating last activity for open tickets")
 		}
@@ -790,6 +1078,43 @@ func markMsgHandled(ctx context.Context, db models.Queryer, contact *flows.Conta
 	return nil
 }
 
+// utility to mark a message which won't be handled as archived and record that it was received
+func archiveMsg(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, event *MsgEvent, attachments []utils.Attachment, logUUIDs []models.ChannelLogUUID) error {
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "error starting transaction")
+	}
+
+	err = models.UpdateMessage(ctx, tx, event.MsgID, models.MsgStatusHandled, models.VisibilityArchived, models.MsgTypeInbox, models.NilFlowID, attachments, logUUIDs)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordMsgReceived(ctx, tx, oa, event); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// records that the given message, and any batched with it, were received in the transaction which marks them handled
+// so that they're only counted once, and only added to the contact's conversation once, even if handling is retried
+func recordMsgReceived(ctx context.Context, tx *sqlx.Tx, oa *models.OrgAssets, event *MsgEvent) error {
+	increments := []*models.AnalyticsIncrement{{Type: models.AnalyticsCountMsgsIn, ChannelID: event.ChannelID, Count: 1 + len(event.BatchedMsgIDs)}}
+
+	if err := models.InsertAnalyticsCounts(ctx, tx, oa, increments); err != nil {
+		return errors.Wrapf(err, "error inserting message analytics counts")
+	}
+
+	conversationMsg := &models.ConversationMsg{ContactID: event.ContactID, ChannelID: event.ChannelID, Direction: models.DirectionIn, CreatedOn: dates.Now()}
+	if err := models.RecordConversations(ctx, tx, oa, []*models.ConversationMsg{conversationMsg}); err != nil {
+		return errors.Wrapf(err, "error recording message conversation")
+	}
+	return nil
+}
+
 type HandleEventTask struct {
 	ContactID models.ContactID `json:"contact_id"`
 }
@@ -812,7 +1137,11 @@ type MsgEvent struct {
 	URNID         models.URNID     `json:"urn_id"`
 	Text          string           `json:"text"`
 	Attachments   []string         `json:"attachments"`
+	Subject       string           `json:"subject,omitempty"`
 	NewContact    bool             `json:"new_contact"`
+
+	// messages which were batched with this one and are handled with it
+	BatchedMsgIDs []flows.MsgID `json:"-"`
 }
 
 type StopEvent struct {
@@ -12,8 +12,16 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// how many calls to retry at a time, and the most batches the retry cron works through in a run, which needs to be
+// enough for paced campaign events to make their calls when they're due
+const (
+	retryCallsBatchSize  = 100
+	retryCallsMaxBatches = 20
+)
+
 func init() {
 	mailroom.RegisterCron("retry_ivr_calls", time.Minute, false, RetryCalls)
+	mailroom.RegisterCron("repair_ivr_calls", time.Minute*5, false, RepairCalls)
 }
 
 // RetryCalls looks for calls that need to be retried and retries them
@@ -25,17 +33,49 @@ func RetryCalls(ctx context.Context, rt *runtime.Runtime) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
 	defer cancel()
 
-	calls, err := models.LoadCallsToRetry(ctx, rt.DB, 100)
-	if err != nil {
-		return errors.Wrapf(err, "error loading calls to retry")
+	throttledChannels := make(map[models.ChannelID]bool)
+	retried := make(map[models.CallID]bool)
+	count := 0
+
+	for i := 0; i < retryCallsMaxBatches; i++ {
+		calls, err := models.LoadCallsToRetry(ctx, rt.DB, retryCallsBatchSize)
+		if err != nil {
+			return errors.Wrapf(err, "error loading calls to retry")
+		}
+
+		// calls we couldn't retry stay due so stop once a batch has nothing new
+		fresh := make([]*models.Call, 0, len(calls))
+		for _, call := range calls {
+			if !retried[call.ID()] {
+				retried[call.ID()] = true
+				fresh = append(fresh, call)
+			}
+		}
+		if len(fresh) == 0 {
+			break
+		}
+
+		retryCalls(ctx, rt, fresh, throttledChannels)
+		count += len(fresh)
+
+		if len(calls) < retryCallsBatchSize {
+			break
+		}
 	}
 
-	throttledChannels := make(map[models.ChannelID]bool)
+	log.WithField("count", count).WithField("elapsed", time.Since(start)).Info("retried errored calls")
+
+	return nil
+}
+
+// retries the given calls, skipping those on channels which have become throttled
+func retryCalls(ctx context.Context, rt *runtime.Runtime, calls []*models.Call, throttledChannels map[models.ChannelID]bool) {
+	log := logrus.WithField("comp", "ivr_cron_retryer")
 	clogs := make([]*models.ChannelLog, 0, len(calls))
 
 	// schedules requests for each call
 	for _, call := range calls {
-		log = log.WithField("call_id", call.ID())
+		log := log.WithField("call_id", call.ID())
 
 		// if the channel for this call is throttled, move on
 		if throttledChannels[call.ChannelID()] {
@@ -78,8 +118,59 @@ func RetryCalls(ctx context.Context, rt *runtime.Runtime) error {
 			continue
 		}
 
-		// queued status on a call we just tried means it is throttled, mark our channel as such
-		throttledChannels[call.ChannelID()] = true
+		// queued status on a call we just tried means it is throttled, mark our channel as such. A channel which took the
+		// call isn't throttled and can take more, which paced calls rely on as they come due several a minute.
+		if call.Status() == models.CallStatusQueued {
+			throttledChannels[call.ChannelID()] = true
+		}
+	}
+
+	// log any error inserting our channel logs, but continue
+	if err := models.InsertChannelLogs(ctx, rt.DB, clogs); err != nil {
+		logrus.WithError(err).Error("error inserting channel logs")
+	}
+}
+
+// RepairCalls looks for calls that have been wired or in progress for too long, checks their real status with the
+// provider and updates them to match, interrupting the sessions of any which have actually ended
+func RepairCalls(ctx context.Context, rt *runtime.Runtime) error {
+	if rt.Config.IVRMaxCallDuration <= 0 {
+		return nil
+	}
+
+	log := logrus.WithField("comp", "ivr_cron_repairer")
+	start := time.Now()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	since := time.Now().Add(-time.Second * time.Duration(rt.Config.IVRMaxCallDuration))
+
+	calls, err := models.LoadStuckCalls(ctx, rt.DB, since, 100)
+	if err != nil {
+		return errors.Wrapf(err, "error loading stuck calls")
+	}
+
+	endedCalls := make([]models.CallID, 0, len(calls))
+	clogs := make([]*models.ChannelLog, 0, len(calls))
+
+	for _, call := range calls {
+		clog, ended, err := ivr.RepairCall(ctx, rt, call)
+		if clog != nil {
+			clogs = append(clogs, clog)
+		}
+		if err != nil {
+			// log error but carry on with other calls
+			log.WithError(err).WithField("call_id", call.ID()).Error("error repairing call")
+			continue
+		}
+		if ended {
+			endedCalls = append(endedCalls, call.ID())
+		}
+	}
+
+	if err := models.InterruptSessionsForCalls(ctx, rt.DB, endedCalls); err != nil {
+		return errors.Wrapf(err, "error interrupting sessions for ended calls")
 	}
 
 	// log any error inserting our channel logs, but continue
@@ -87,7 +178,7 @@ func RetryCalls(ctx context.Context, rt *runtime.Runtime) error {
 		logrus.WithError(err).Error("error inserting channel logs")
 	}
 
-	log.WithField("count", len(calls)).WithField("elapsed", time.Since(start)).Info("retried errored calls")
+	log.WithField("count", len(calls)).WithField("ended", len(endedCalls)).WithField("elapsed", time.Since(start)).Info("repaired stuck calls")
 
 	return nil
 }
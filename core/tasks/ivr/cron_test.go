@@ -3,6 +3,7 @@ package ivr_test
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
 	"github.com/nyaruka/mailroom/core/ivr"
@@ -73,3 +74,86 @@ func TestRetries(t *testing.T) {
 	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE contact_id = $1 AND status = $2 AND external_id = $3`,
 		testdata.Cathy.ID, models.CallStatusFailed, "call1").Returns(1)
 }
+
+func TestRetriesOnSameChannel(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	ivr.RegisterServiceType(models.ChannelType("ZZ"), NewMockProvider)
+
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'ZZ', config = '{}' WHERE id = $1`, testdata.TwilioChannel.ID)
+
+	// two calls on the same channel which are both due
+	for _, c := range []*testdata.Contact{testdata.Cathy, testdata.Bob} {
+		_, err := models.InsertCall(ctx, db, testdata.Org1.ID, testdata.TwilioChannel.ID, models.NilStartID, c.ID, c.URNID, models.CallDirectionOut, models.CallStatusQueued, "")
+		assert.NoError(t, err)
+	}
+	db.MustExec(`UPDATE ivr_call SET next_attempt = NOW() - INTERVAL '1 second'`)
+
+	service.callError = nil
+	service.callID = ivr.CallID("call1")
+
+	err := ivrtasks.RetryCalls(ctx, rt)
+	assert.NoError(t, err)
+
+	// the channel took the first call so isn't throttled and the second call is made in the same run
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE status = 'W'`).Returns(2)
+
+	// but once the channel is at its limit, the remaining calls wait
+	db.MustExec(`UPDATE channels_channel SET config = '{"max_concurrent_events": 2}' WHERE id = $1`, testdata.TwilioChannel.ID)
+	models.FlushCache()
+
+	for _, c := range []*testdata.Contact{testdata.George, testdata.Alexandria} {
+		_, err := models.InsertCall(ctx, db, testdata.Org1.ID, testdata.TwilioChannel.ID, models.NilStartID, c.ID, c.URNID, models.CallDirectionOut, models.CallStatusQueued, "")
+		assert.NoError(t, err)
+	}
+	db.MustExec(`UPDATE ivr_call SET next_attempt = NOW() - INTERVAL '1 second' WHERE status = 'Q'`)
+
+	err = ivrtasks.RetryCalls(ctx, rt)
+	assert.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE status = 'W'`).Returns(2)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE status = 'Q' AND next_attempt > NOW()`).Returns(2)
+}
+
+func TestRepairs(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// register our mock client
+	ivr.RegisterServiceType(models.ChannelType("ZZ"), NewMockProvider)
+
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'ZZ' WHERE id = $1`, testdata.TwilioChannel.ID)
+
+	// cathy has a call which has been in progress for hours and bob a call which was only just wired
+	cathyCallID := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy)
+	bobCallID := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob)
+	db.MustExec(`UPDATE ivr_call SET status = 'I', external_id = 'call1', started_on = NOW() - INTERVAL '3 hours' WHERE id = $1`, cathyCallID)
+	db.MustExec(`UPDATE ivr_call SET status = 'W', external_id = 'call2' WHERE id = $1`, bobCallID)
+
+	cathySessionID := testdata.InsertWaitingSession(db, testdata.Org1, testdata.Cathy, models.FlowTypeVoice, testdata.IVRFlow, cathyCallID, time.Now(), time.Now().Add(time.Hour), false, nil)
+
+	// provider says the call is still in progress so nothing changes
+	service.callStatus = models.CallStatusInProgress
+
+	err := ivrtasks.RepairCalls(ctx, rt)
+	assert.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT status FROM ivr_call WHERE id = $1`, cathyCallID).Returns("I")
+	assertdb.Query(t, db, `SELECT status FROM flows_flowsession WHERE id = $1`, cathySessionID).Returns("W")
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog WHERE log_type = 'ivr_status'`).Returns(1)
+
+	// provider says the call actually completed so call is updated and session interrupted
+	service.callStatus = models.CallStatusCompleted
+
+	err = ivrtasks.RepairCalls(ctx, rt)
+	assert.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT status, duration FROM ivr_call WHERE id = $1`, cathyCallID).Columns(map[string]interface{}{"status": "D", "duration": int64(10)})
+	assertdb.Query(t, db, `SELECT status FROM flows_flowsession WHERE id = $1`, cathySessionID).Returns("I")
+
+	// bob's call wasn't old enough to be checked
+	assertdb.Query(t, db, `SELECT status FROM ivr_call WHERE id = $1`, bobCallID).Returns("W")
+}
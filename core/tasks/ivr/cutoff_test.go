@@ -0,0 +1,69 @@
+package ivr_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCutoffs(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	ivr.RegisterServiceType(models.ChannelType("ZZ"), NewMockProvider)
+
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'ZZ', config = '{"max_call_duration": 600}' WHERE id = $1`, testdata.TwilioChannel.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	assert.NoError(t, err)
+
+	channel := oa.ChannelByID(testdata.TwilioChannel.ID)
+	assert.Equal(t, time.Minute*10, ivr.MaxCallDuration(oa, channel))
+
+	cathyCallID := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy)
+	db.MustExec(`UPDATE ivr_call SET status = 'I', external_id = 'call1', started_on = NOW() WHERE id = $1`, cathyCallID)
+	cathySessionID := testdata.InsertWaitingSession(db, testdata.Org1, testdata.Cathy, models.FlowTypeVoice, testdata.IVRFlow, cathyCallID, time.Now(), time.Now().Add(time.Hour), false, nil)
+
+	call, err := models.GetCallByID(ctx, db, testdata.Org1.ID, cathyCallID)
+	assert.NoError(t, err)
+
+	// scheduling a cutoff creates a delayed task which isn't due yet
+	assert.NoError(t, ivr.ScheduleCutoff(ctx, rt, oa, channel, call))
+
+	count, err := queue.QueueDelayedTasks(rc, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	// but is once the max duration has passed
+	count, err = queue.QueueDelayedTasks(rc, time.Now().Add(time.Minute*11))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	task, err := queue.PopNextTask(rc, queue.HandlerQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, queue.CutoffCall, task.Type)
+
+	// performing it hangs up the call and records that it was cut off
+	err = ivr.CutoffCall(ctx, rt, testdata.Org1.ID, &ivr.CutoffCallTask{CallID: cathyCallID})
+	assert.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT status, error_reason FROM ivr_call WHERE id = $1`, cathyCallID).Columns(map[string]interface{}{"status": "D", "error_reason": "C"})
+	assertdb.Query(t, db, `SELECT status FROM flows_flowsession WHERE id = $1`, cathySessionID).Returns("I")
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog WHERE log_type = 'ivr_hangup'`).Returns(1)
+
+	// cutting off a call which has already ended does nothing
+	err = ivr.CutoffCall(ctx, rt, testdata.Org1.ID, &ivr.CutoffCallTask{CallID: cathyCallID})
+	assert.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog WHERE log_type = 'ivr_hangup'`).Returns(1)
+}
@@ -0,0 +1,151 @@
+package ivr
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeExportCallRecords is the type of the task to export call detail records
+const TypeExportCallRecords = "export_call_records"
+
+func init() {
+	tasks.RegisterType(TypeExportCallRecords, func() tasks.Task { return &ExportCallRecordsTask{} })
+}
+
+// ExportCallRecordsTask is our task to export a detail record of every call created in a date range as a CSV file, for
+// reconciling with provider bills and reporting. The file is saved to attachment storage at the path given by
+// CallRecordsExportPath.
+type ExportCallRecordsTask struct {
+	ExportUUID uuids.UUID `json:"export_uuid" validate:"required"`
+	Start      time.Time  `json:"start"       validate:"required"`
+	End        time.Time  `json:"end"         validate:"required"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *ExportCallRecordsTask) Timeout() time.Duration {
+	return time.Hour
+}
+
+// Perform implements tasks.Task
+func (t *ExportCallRecordsTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	start := time.Now()
+
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return errors.Wrapf(err, "error loading org assets")
+	}
+
+	records, err := models.LoadCallRecords(ctx, rt.DB, orgID, t.Start, t.End)
+	if err != nil {
+		return err
+	}
+
+	data, err := WriteCallRecords(oa, records)
+	if err != nil {
+		return errors.Wrap(err, "error writing call records")
+	}
+
+	url, err := rt.AttachmentStorage.Put(ctx, CallRecordsExportPath(rt, orgID, t.ExportUUID), "text/csv", data)
+	if err != nil {
+		return errors.Wrap(err, "error saving call records")
+	}
+
+	logrus.WithFields(logrus.Fields{"org_id": orgID, "elapsed": time.Since(start), "count": len(records), "url": url}).Info("exported call records")
+	return nil
+}
+
+// CallRecordsExportPath gets the path in attachment storage of the CSV file of the given call records export
+func CallRecordsExportPath(rt *runtime.Runtime, orgID models.OrgID, exportUUID uuids.UUID) string {
+	return path.Join(rt.Config.S3AttachmentsPrefix, fmt.Sprint(orgID), "call_records", fmt.Sprintf("%s.csv", exportUUID))
+}
+
+var callRecordsHeader = []string{
+	"ID", "External ID", "Channel UUID", "Channel", "Contact UUID", "Direction", "Status", "Error Reason", "Error Count",
+	"Created On", "Started On", "Ended On", "Duration", "Cost",
+}
+
+var callDirectionNames = map[models.CallDirection]string{
+	models.CallDirectionIn:  "incoming",
+	models.CallDirectionOut: "outgoing",
+}
+
+var callStatusNames = map[models.CallStatus]string{
+	models.CallStatusPending:    "pending",
+	models.CallStatusQueued:     "queued",
+	models.CallStatusWired:      "wired",
+	models.CallStatusInProgress: "in_progress",
+	models.CallStatusCompleted:  "completed",
+	models.CallStatusErrored:    "errored",
+	models.CallStatusFailed:     "failed",
+}
+
+var callErrorNames = map[models.CallError]string{
+	models.CallErrorProvider:    "provider",
+	models.CallErrorBusy:        "busy",
+	models.CallErrorNoAnswer:    "no_answer",
+	models.CallErrorMachine:     "machine",
+	models.CallErrorUnreachable: "unreachable",
+	models.CallErrorCutoff:      "cutoff",
+}
+
+// WriteCallRecords writes the given call records as CSV, with the cost of each call calculated from the rate of its
+// channel. Cost is left empty for calls on channels without a rate or which have since been deleted.
+func WriteCallRecords(oa *models.OrgAssets, records []*models.CallRecord) ([]byte, error) {
+	b := &bytes.Buffer{}
+	w := csv.NewWriter(b)
+
+	if err := w.Write(callRecordsHeader); err != nil {
+		return nil, err
+	}
+
+	for _, r := range records {
+		cost := ""
+		if channel := oa.ChannelByID(r.ChannelID); channel != nil {
+			if c := channel.CallCost(r.Duration); c != nil {
+				cost = c.String()
+			}
+		}
+
+		row := []string{
+			strconv.Itoa(int(r.ID)),
+			r.ExternalID,
+			r.ChannelUUID,
+			r.ChannelName,
+			r.ContactUUID,
+			callDirectionNames[r.Direction],
+			callStatusNames[r.Status],
+			callErrorNames[models.CallError(r.ErrorReason)],
+			strconv.Itoa(r.ErrorCount),
+			formatRecordTime(&r.CreatedOn),
+			formatRecordTime(r.StartedOn),
+			formatRecordTime(r.EndedOn),
+			strconv.Itoa(r.Duration),
+			cost,
+		}
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	return b.Bytes(), w.Error()
+}
+
+func formatRecordTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,50 @@
+package ivr_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/models"
+	ivrtasks "github.com/nyaruka/mailroom/core/tasks/ivr"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportCallRecords(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	db.MustExec(`UPDATE channels_channel SET config = '{"call_cost_per_minute": "0.05"}' WHERE id = $1`, testdata.TwilioChannel.ID)
+	models.FlushCache()
+
+	cathyCallID := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy)
+	bobCallID := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob)
+	georgeCallID := testdata.InsertCall(db, testdata.Org1, testdata.TwilioChannel, testdata.George)
+	db.MustExec(`UPDATE ivr_call SET status = 'D', direction = 'O', duration = 125, created_on = '2022-03-01T10:00:00Z', started_on = '2022-03-01T10:00:10Z', ended_on = '2022-03-01T10:02:15Z' WHERE id = $1`, cathyCallID)
+	db.MustExec(`UPDATE ivr_call SET status = 'F', error_reason = 'B', error_count = 2, created_on = '2022-03-02T10:00:00Z' WHERE id = $1`, bobCallID)
+	db.MustExec(`UPDATE ivr_call SET created_on = '2022-04-01T10:00:00Z' WHERE id = $1`, georgeCallID)
+
+	task := &ivrtasks.ExportCallRecordsTask{
+		ExportUUID: uuids.UUID("4d7bd1ce-3bd4-4e2e-9bf9-a4b2f3e6f21a"),
+		Start:      time.Date(2022, 3, 1, 0, 0, 0, 0, time.UTC),
+		End:        time.Date(2022, 4, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	err := task.Perform(ctx, rt, testdata.Org1.ID)
+	assert.NoError(t, err)
+
+	_, data, err := rt.AttachmentStorage.Get(ctx, ivrtasks.CallRecordsExportPath(rt, testdata.Org1.ID, task.ExportUUID))
+	assert.NoError(t, err)
+
+	// george's call is outside of the range
+	assert.Equal(t, fmt.Sprintf(
+		"ID,External ID,Channel UUID,Channel,Contact UUID,Direction,Status,Error Reason,Error Count,Created On,Started On,Ended On,Duration,Cost\n"+
+			"%d,ext1,%s,Twilio,%s,outgoing,completed,,0,2022-03-01T10:00:00Z,2022-03-01T10:00:10Z,2022-03-01T10:02:15Z,125,0.15\n"+
+			"%d,ext1,%s,Twilio,%s,incoming,failed,busy,2,2022-03-02T10:00:00Z,,,0,0\n",
+		cathyCallID, testdata.TwilioChannel.UUID, testdata.Cathy.UUID, bobCallID, testdata.TwilioChannel.UUID, testdata.Bob.UUID,
+	), string(data))
+}
@@ -0,0 +1,30 @@
+package ivr
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	mailroom.AddTaskFunction(queue.TranscodeRecording, handleTranscodeRecordingTask)
+}
+
+func handleTranscodeRecordingTask(ctx context.Context, rt *runtime.Runtime, task *queue.Task) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+	defer cancel()
+
+	t := &ivr.TranscodeRecordingTask{}
+	if err := json.Unmarshal(task.Task, t); err != nil {
+		return errors.Wrapf(err, "error unmarshalling transcode recording task: %s", string(task.Task))
+	}
+
+	return ivr.TranscodeRecording(ctx, rt, models.OrgID(task.OrgID), t)
+}
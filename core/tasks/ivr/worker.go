@@ -64,6 +64,23 @@ func HandleFlowStartBatch(bg context.Context, rt *runtime.Runtime, batch *models
 		}
 	}
 
+	// filter out anybody who is already on a call or was recently called by this start, so that retries of this task or
+	// overlapping starts don't call them again
+	if rt.Config.IVRDuplicateCallWindow > 0 {
+		since := time.Now().Add(-time.Duration(rt.Config.IVRDuplicateCallWindow) * time.Second)
+
+		duplicates, err := models.FindDuplicateCallContacts(ctx, rt.DB, batch.StartID(), since, batch.ContactIDs())
+		if err != nil {
+			return errors.Wrapf(err, "error finding duplicate calls for start: %d", batch.StartID())
+		}
+		for _, c := range duplicates {
+			exclude[c] = true
+		}
+		if len(duplicates) > 0 {
+			logrus.WithField("start_id", batch.StartID()).WithField("count", len(duplicates)).Info("suppressed duplicate calls")
+		}
+	}
+
 	// filter into our final list of contacts
 	contactIDs := make([]models.ContactID, 0, len(batch.ContactIDs()))
 	for _, c := range batch.ContactIDs() {
@@ -84,12 +101,20 @@ func HandleFlowStartBatch(bg context.Context, rt *runtime.Runtime, batch *models
 		return errors.Wrapf(err, "error loading contacts")
 	}
 
+	// if the calls of this start are paced, reserve their slots
+	rc := rt.RP.Get()
+	delays, err := batch.ReserveCallDelays(rc, len(contacts))
+	rc.Close()
+	if err != nil {
+		return errors.Wrapf(err, "error reserving paced calls for start: %d", batch.StartID())
+	}
+
 	// for each contacts, request a call start
-	for _, contact := range contacts {
+	for i, contact := range contacts {
 		start := time.Now()
 
 		ctx, cancel := context.WithTimeout(bg, time.Minute)
-		session, err := ivr.RequestCall(ctx, rt, oa, batch, contact)
+		session, err := ivr.RequestCall(ctx, rt, oa, batch, contact, delays[i])
 		cancel()
 		if err != nil {
 			logrus.WithError(err).Errorf("error starting ivr flow for contact: %d and flow: %d", contact.ID(), batch.FlowID())
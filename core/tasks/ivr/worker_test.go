@@ -15,6 +15,7 @@ import (
 	ivrtasks "github.com/nyaruka/mailroom/core/tasks/ivr"
 	"github.com/nyaruka/mailroom/core/tasks/starts"
 	"github.com/nyaruka/mailroom/runtime"
+	_ "github.com/nyaruka/mailroom/services/lookup/vonage"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 
@@ -67,6 +68,115 @@ func TestIVR(t *testing.T) {
 	err = ivrtasks.HandleFlowStartBatch(ctx, rt, batch)
 	assert.NoError(t, err)
 	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE contact_id = $1 AND status = $2 AND next_attempt IS NOT NULL;`, testdata.Cathy.ID, models.CallStatusQueued).Returns(1)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE contact_id = $1`, testdata.Cathy.ID).Returns(3)
+
+	// with duplicate call suppression enabled, trying again shouldn't create another call
+	rt.Config.IVRDuplicateCallWindow = 300
+	defer func() { rt.Config.IVRDuplicateCallWindow = 0 }()
+
+	err = ivrtasks.HandleFlowStartBatch(ctx, rt, batch)
+	assert.NoError(t, err)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE contact_id = $1`, testdata.Cathy.ID).Returns(3)
+
+	// and neither should another start whilst cathy's call is still active
+	start2 := models.NewFlowStart(testdata.Org1.ID, models.StartTypeTrigger, models.FlowTypeVoice, testdata.IVRFlow.ID).
+		WithContactIDs([]models.ContactID{testdata.Cathy.ID})
+	err = models.InsertFlowStarts(ctx, db, []*models.FlowStart{start2})
+	assert.NoError(t, err)
+
+	err = ivrtasks.HandleFlowStartBatch(ctx, rt, start2.CreateBatch([]models.ContactID{testdata.Cathy.ID}, true, 1))
+	assert.NoError(t, err)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE contact_id = $1`, testdata.Cathy.ID).Returns(3)
+}
+
+func TestIVRPreDialCheck(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://api.nexmo.com/ni/advanced/json?api_key=key123&api_secret=sesame&number=16055741111": {
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 0, "current_carrier": {"name": "Verizon", "network_type": "mobile"}, "valid_number": "valid", "reachable": "absent"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 0, "current_carrier": {"name": "Verizon", "network_type": "mobile"}, "valid_number": "valid", "reachable": "reachable"}`)),
+		},
+	}))
+
+	ivr.RegisterServiceType(models.ChannelType("ZZ"), NewMockProvider)
+
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'ZZ', config = '{"pre_dial_check": true}' WHERE id = $1`, testdata.TwilioChannel.ID)
+	db.MustExec(`UPDATE orgs_org SET config = '{"number_lookup_provider": "vonage", "vonage_insight_api_key": "key123", "vonage_insight_api_secret": "sesame", "vonage_insight_advanced": true}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+
+	start := models.NewFlowStart(testdata.Org1.ID, models.StartTypeTrigger, models.FlowTypeVoice, testdata.IVRFlow.ID).
+		WithContactIDs([]models.ContactID{testdata.Cathy.ID})
+	err := models.InsertFlowStarts(ctx, db, []*models.FlowStart{start})
+	assert.NoError(t, err)
+
+	batch := start.CreateBatch([]models.ContactID{testdata.Cathy.ID}, true, 1)
+
+	service.callError = nil
+	service.callID = ivr.CallID("call1")
+
+	// number is unreachable so call fails without being requested
+	err = ivrtasks.HandleFlowStartBatch(ctx, rt, batch)
+	assert.NoError(t, err)
+	assertdb.Query(t, db, `SELECT status, error_reason, external_id FROM ivr_call WHERE contact_id = $1`, testdata.Cathy.ID).
+		Columns(map[string]interface{}{"status": "F", "error_reason": "U", "external_id": ""})
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog WHERE log_type = 'ivr_start' AND is_error = TRUE AND http_logs::text NOT LIKE '%sesame%'`).Returns(1)
+
+	db.MustExec(`DELETE FROM channels_channellog`)
+	db.MustExec(`DELETE FROM ivr_call`)
+
+	// number is reachable so call is requested
+	err = ivrtasks.HandleFlowStartBatch(ctx, rt, batch)
+	assert.NoError(t, err)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE contact_id = $1 AND status = $2 AND external_id = $3`, testdata.Cathy.ID, models.CallStatusWired, "call1").Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog WHERE log_type = 'ivr_start'`).Returns(2)
+}
+
+func TestIVRPacing(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	ivr.RegisterServiceType(models.ChannelType("ZZ"), NewMockProvider)
+
+	db.MustExec(`UPDATE channels_channel SET channel_type = 'ZZ', config = '{}' WHERE id = $1`, testdata.TwilioChannel.ID)
+
+	contactIDs := []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID, testdata.George.ID}
+	start := models.NewFlowStart(testdata.Org1.ID, models.StartTypeTrigger, models.FlowTypeVoice, testdata.IVRFlow.ID).
+		WithContactIDs(contactIDs)
+	err := models.InsertFlowStarts(ctx, db, []*models.FlowStart{start})
+	assert.NoError(t, err)
+
+	batch := start.CreateBatch(contactIDs, true, 3).WithCallsPerMinute(2)
+
+	service.callError = nil
+	service.callID = ivr.CallID("call1")
+
+	// first call is requested, the others are held until their turn 30 and 60 seconds later
+	err = ivrtasks.HandleFlowStartBatch(ctx, rt, batch)
+	assert.NoError(t, err)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE status = 'W'`).Returns(1)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE status = 'Q' AND next_attempt > NOW() + INTERVAL '20 seconds'`).Returns(2)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE status = 'Q' AND next_attempt > NOW() + INTERVAL '50 seconds'`).Returns(1)
+
+	// another start of the same flow has to wait behind those
+	start2 := models.NewFlowStart(testdata.Org1.ID, models.StartTypeTrigger, models.FlowTypeVoice, testdata.IVRFlow.ID).
+		WithContactIDs([]models.ContactID{testdata.Alexandria.ID})
+	err = models.InsertFlowStarts(ctx, db, []*models.FlowStart{start2})
+	assert.NoError(t, err)
+
+	err = ivrtasks.HandleFlowStartBatch(ctx, rt, start2.CreateBatch([]models.ContactID{testdata.Alexandria.ID}, true, 1).WithCallsPerMinute(2))
+	assert.NoError(t, err)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE contact_id = $1 AND status = 'Q' AND next_attempt > NOW() + INTERVAL '80 seconds'`, testdata.Alexandria.ID).Returns(1)
+
+	// once they're due they're all requested by the retry cron
+	db.MustExec(`UPDATE ivr_call SET next_attempt = NOW() WHERE status = 'Q'`)
+
+	err = ivrtasks.RetryCalls(ctx, rt)
+	assert.NoError(t, err)
+	assertdb.Query(t, db, `SELECT COUNT(*) FROM ivr_call WHERE status = 'W'`).Returns(4)
 }
 
 var service = &MockService{}
@@ -76,8 +186,13 @@ func NewMockProvider(httpClient *http.Client, channel *models.Channel) (ivr.Serv
 }
 
 type MockService struct {
-	callID    ivr.CallID
-	callError error
+	callID     ivr.CallID
+	callError  error
+	callStatus models.CallStatus
+}
+
+func (s *MockService) Capabilities() ivr.Capabilities {
+	return ivr.Capabilities{Dial: true, Record: true, MachineDetection: true}
 }
 
 func (s *MockService) RequestCall(number urns.URN, handleURL string, statusURL string, machineDetection bool) (ivr.CallID, *httpx.Trace, error) {
@@ -88,6 +203,10 @@ func (s *MockService) HangupCall(externalID string) (*httpx.Trace, error) {
 	return nil, nil
 }
 
+func (s *MockService) GetCallStatus(externalID string) (models.CallStatus, models.CallError, int, *httpx.Trace, error) {
+	return s.callStatus, "", 10, nil, nil
+}
+
 func (s *MockService) WriteSessionResponse(ctx context.Context, rt *runtime.Runtime, channel *models.Channel, call *models.Call, session *models.Session, number urns.URN, resumeURL string, req *http.Request, w http.ResponseWriter) error {
 	return nil
 }
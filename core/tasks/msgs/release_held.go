@@ -0,0 +1,42 @@
+package msgs
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/msgio"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.RegisterCron("release_held_messages", time.Second*60, false, ReleaseHeldMessages)
+}
+
+// ReleaseHeldMessages sends non-urgent messages which were held during their org's quiet hours or deferred by its
+// frequency cap, once they are due
+func ReleaseHeldMessages(ctx context.Context, rt *runtime.Runtime) error {
+	start := time.Now()
+
+	msgs, err := models.GetMessagesToRelease(ctx, rt.DB)
+	if err != nil {
+		return errors.Wrap(err, "error fetching held messages to release")
+	}
+	if len(msgs) == 0 {
+		return nil // nothing to release
+	}
+
+	err = models.ReleaseHeldMessages(ctx, rt.DB, msgs)
+	if err != nil {
+		return errors.Wrap(err, "error marking held messages as queued")
+	}
+
+	msgio.SendMessages(ctx, rt, rt.DB, nil, msgs)
+
+	logrus.WithField("count", len(msgs)).WithField("elapsed", time.Since(start)).Info("released held messages")
+
+	return nil
+}
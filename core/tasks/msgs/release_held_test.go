@@ -0,0 +1,49 @@
+package msgs_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/msgs"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleaseHeldMessages(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	// nothing to release
+	err := msgs.ReleaseHeldMessages(ctx, rt)
+	require.NoError(t, err)
+
+	testsuite.AssertCourierQueues(t, map[string][]int{})
+
+	// a pending message which wasn't held (should be ignored)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi", nil, models.MsgStatusPending, false)
+
+	// a message held until quiet hours end in the future (should be ignored)
+	m2 := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi", nil, models.MsgStatusPending, false)
+
+	// messages held until quiet hours which have now ended
+	m3 := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Hi", nil, models.MsgStatusPending, false)
+	m4 := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.VonageChannel, testdata.Bob, "Hi", nil, models.MsgStatusPending, false)
+
+	db.MustExec(`UPDATE msgs_msg SET next_attempt = $2 WHERE id = $1`, m2.ID(), time.Now().Add(time.Hour))
+	db.MustExec(`UPDATE msgs_msg SET next_attempt = $2 WHERE id = ANY(ARRAY[$1, $3])`, m3.ID(), time.Now().Add(-time.Minute), m4.ID())
+
+	err = msgs.ReleaseHeldMessages(ctx, rt)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE status = 'P'`).Returns(2)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE status = 'Q' AND next_attempt IS NULL`).Returns(2)
+
+	testsuite.AssertCourierQueues(t, map[string][]int{
+		"msgs:74729f45-7f29-4868-9dc4-90e491e3c7d8|10/0": {1}, // twilio, bulk priority
+		"msgs:19012bfd-3ce3-4cae-9bb9-76cf92c73d49|10/0": {1}, // vonage, bulk priority
+	})
+}
@@ -0,0 +1,72 @@
+package msgs
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/msgio"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// how many messages held whilst an org was paused are sent at a time
+const releasePausedBatchSize = 1000
+
+func init() {
+	mailroom.AddTaskFunction(queue.ReleasePausedMsgs, handleReleasePausedMsgs)
+}
+
+// QueueReleasePausedMsgs queues a task to send the messages held whilst the given org had paused outbound
+func QueueReleasePausedMsgs(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	return queue.AddTask(ctx, rc, queue.BatchQueue, queue.ReleasePausedMsgs, int(orgID), nil, queue.DefaultPriority)
+}
+
+func handleReleasePausedMsgs(ctx context.Context, rt *runtime.Runtime, task *queue.Task) error {
+	return ReleasePausedMessages(ctx, rt, models.OrgID(task.OrgID))
+}
+
+// ReleasePausedMessages sends a batch of the messages held whilst the given org had paused outbound, queuing another
+// task to send the next batch if there may be more
+func ReleasePausedMessages(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	start := time.Now()
+
+	rc := rt.RP.Get()
+	paused, err := models.IsOrgOutboundPaused(rc, orgID)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+
+	// org may have paused again since this was queued, in which case its messages wait for the next resume
+	if paused {
+		return nil
+	}
+
+	msgs, err := models.GetPausedMessages(ctx, rt.DB, orgID, releasePausedBatchSize)
+	if err != nil {
+		return errors.Wrap(err, "error loading paused messages")
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	if err := models.MarkMessagesQueued(ctx, rt.DB, msgs); err != nil {
+		return errors.Wrap(err, "error marking paused messages as queued")
+	}
+
+	msgio.SendMessages(ctx, rt, rt.DB, nil, msgs)
+
+	logrus.WithField("org_id", orgID).WithField("count", len(msgs)).WithField("elapsed", time.Since(start)).Info("released paused messages")
+
+	if len(msgs) == releasePausedBatchSize {
+		return QueueReleasePausedMsgs(ctx, rt, orgID)
+	}
+	return nil
+}
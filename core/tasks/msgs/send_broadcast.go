@@ -3,9 +3,11 @@ package msgs
 import (
 	"context"
 	"encoding/json"
+	"sort"
 	"time"
 
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/mailroom"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/msgio"
@@ -44,6 +46,19 @@ func handleSendBroadcast(ctx context.Context, rt *runtime.Runtime, task *queue.T
 
 // CreateBroadcastBatches takes our master broadcast and creates batches of broadcast sends for all the unique contacts
 func CreateBroadcastBatches(ctx context.Context, rt *runtime.Runtime, bcast *models.Broadcast) error {
+	// a broadcast with invalid attachments would fail for every contact so fail it before we create any batches
+	if err := bcast.ValidateAttachments(); err != nil {
+		if err := models.MarkBroadcastFailed(ctx, rt.DB, bcast.ID()); err != nil {
+			return err
+		}
+		return errors.Wrapf(err, "broadcast #%d has invalid attachments", bcast.ID())
+	}
+
+	// if broadcast has a preview group, that's who we send to until the preview is confirmed
+	if bcast.PreviewGroupID() != models.NilGroupID {
+		return createBroadcastPreview(ctx, rt, bcast)
+	}
+
 	// we are building a set of contact ids, start with the explicit ones
 	contactIDs := make(map[models.ContactID]bool)
 	for _, id := range bcast.ContactIDs() {
@@ -88,6 +103,11 @@ func CreateBroadcastBatches(ctx context.Context, rt *runtime.Runtime, bcast *mod
 	rc := rt.RP.Get()
 	defer rc.Close()
 
+	// track the broadcast's progress so that it can be paused, resumed or cancelled whilst its batches are being sent
+	if err := models.InitBroadcastProgress(rc, bcast.OrgID(), bcast.ID(), len(contactIDs)+len(urnContacts)); err != nil {
+		return err
+	}
+
 	contacts := make([]models.ContactID, 0, 100)
 
 	// utility functions for queueing the current set of contacts
@@ -107,7 +127,7 @@ func CreateBroadcastBatches(ctx context.Context, rt *runtime.Runtime, bcast *mod
 			batch.URNs = urnContacts
 		}
 
-		err = queue.AddTask(rc, q, queue.SendBroadcastBatch, int(bcast.OrgID()), batch, queue.DefaultPriority)
+		err = queue.AddTask(ctx, rc, q, queue.SendBroadcastBatch, int(bcast.OrgID()), batch, queue.DefaultPriority)
 		if err != nil {
 			logrus.WithError(err).Error("error while queuing broadcast batch")
 		}
@@ -128,6 +148,50 @@ func CreateBroadcastBatches(ctx context.Context, rt *runtime.Runtime, bcast *mod
 	return nil
 }
 
+// creates batches which send the broadcast to its preview group in each of its languages, and then holds the broadcast
+// until the preview is confirmed
+func createBroadcastPreview(ctx context.Context, rt *runtime.Runtime, bcast *models.Broadcast) error {
+	contactIDs, err := models.ContactIDsForGroupIDs(ctx, rt.DB, []models.GroupID{bcast.PreviewGroupID()})
+	if err != nil {
+		return errors.Wrapf(err, "error getting contact ids for preview group")
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.StoreBroadcastPreview(ctx, rt.DB, bcast); err != nil {
+		return err
+	}
+
+	// every preview contact gets the broadcast in every language so that all translations get checked
+	languages := make([]envs.Language, 0, len(bcast.Translations()))
+	for lang := range bcast.Translations() {
+		languages = append(languages, lang)
+	}
+	sort.Slice(languages, func(i, j int) bool { return languages[i] < languages[j] })
+
+	for _, lang := range languages {
+		for i := 0; i < len(contactIDs); i += startBatchSize {
+			end := i + startBatchSize
+			if end > len(contactIDs) {
+				end = len(contactIDs)
+			}
+
+			// preview messages aren't part of the broadcast itself
+			batch := bcast.CreateBatch(contactIDs[i:end])
+			batch.BroadcastID = models.NilBroadcastID
+			batch.TicketID = models.NilTicketID
+			batch.Language = lang
+
+			if err := queue.AddTask(ctx, rc, queue.HandlerQueue, queue.SendBroadcastBatch, int(bcast.OrgID()), batch, queue.HighPriority); err != nil {
+				return errors.Wrapf(err, "error queuing broadcast preview batch")
+			}
+		}
+	}
+
+	return nil
+}
+
 // handleSendBroadcastBatch sends our messages
 func handleSendBroadcastBatch(ctx context.Context, rt *runtime.Runtime, task *queue.Task) error {
 	ctx, cancel := context.WithTimeout(ctx, time.Minute*60)
@@ -149,6 +213,42 @@ func handleSendBroadcastBatch(ctx context.Context, rt *runtime.Runtime, task *qu
 
 // SendBroadcastBatch sends the passed in broadcast batch
 func SendBroadcastBatch(ctx context.Context, rt *runtime.Runtime, bcast *models.BroadcastBatch) error {
+	if bcast.BroadcastID != models.NilBroadcastID {
+		rc := rt.RP.Get()
+		status, err := models.HoldBroadcastBatch(rc, bcast)
+		rc.Close()
+
+		if err != nil {
+			return err
+		}
+
+		// batches of paused broadcasts are held until they're resumed, and batches of cancelled broadcasts are dropped
+		if status == models.BroadcastStatusPaused || status == models.BroadcastStatusCancelled {
+			logrus.WithFields(logrus.Fields{"broadcast_id": bcast.BroadcastID, "status": status}).Info("broadcast batch not sent")
+			return nil
+		}
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, bcast.OrgID)
+	if err != nil {
+		return errors.Wrapf(err, "error getting org assets")
+	}
+
+	// if any of the org's courier queues are backed up, try this batch again later rather than adding to them
+	if bcast.BroadcastID != models.NilBroadcastID {
+		delay, err := msgio.CheckCourierBackpressure(ctx, rt, oa)
+		if err != nil {
+			return err
+		}
+		if delay > 0 {
+			rc := rt.RP.Get()
+			defer rc.Close()
+
+			logrus.WithFields(logrus.Fields{"broadcast_id": bcast.BroadcastID, "delay": delay}).Info("broadcast batch delayed by courier backpressure")
+			return queue.AddDelayedTask(ctx, rc, queue.BatchQueue, queue.SendBroadcastBatch, int(bcast.OrgID), bcast, queue.DefaultPriority, delay)
+		}
+	}
+
 	// always set our broadcast as sent if it is our last
 	defer func() {
 		if bcast.IsLast {
@@ -159,11 +259,6 @@ func SendBroadcastBatch(ctx context.Context, rt *runtime.Runtime, bcast *models.
 		}
 	}()
 
-	oa, err := models.GetOrgAssets(ctx, rt, bcast.OrgID)
-	if err != nil {
-		return errors.Wrapf(err, "error getting org assets")
-	}
-
 	// create this batch of messages
 	msgs, err := bcast.CreateMessages(ctx, rt, oa)
 	if err != nil {
@@ -171,5 +266,15 @@ func SendBroadcastBatch(ctx context.Context, rt *runtime.Runtime, bcast *models.
 	}
 
 	msgio.SendMessages(ctx, rt, rt.DB, nil, msgs)
+
+	if bcast.BroadcastID != models.NilBroadcastID {
+		rc := rt.RP.Get()
+		defer rc.Close()
+
+		if err := models.RecordBroadcastBatchProcessed(rc, bcast.OrgID, bcast.BroadcastID, bcast.NumContacts(), models.TotalMsgCosts(msgs)); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
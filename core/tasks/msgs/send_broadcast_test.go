@@ -2,15 +2,18 @@ package msgs_test
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/gocommon/urns"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
+	"github.com/nyaruka/goflow/utils"
 	_ "github.com/nyaruka/mailroom/core/handlers"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/queue"
@@ -19,6 +22,7 @@ import (
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBroadcastEvents(t *testing.T) {
@@ -289,3 +293,130 @@ func TestBroadcastTask(t *testing.T) {
 
 	assertdb.Query(t, db, `SELECT SUM(count) FROM tickets_ticketdailytiming WHERE count_type = 'R' AND scope = CONCAT('o:', $1::text)`, testdata.Org1.ID).Returns(1)
 }
+
+func TestBroadcastAttachmentTemplates(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	eng := envs.Language("eng")
+
+	// attachments are evaluated for each contact, and those which aren't valid for a contact are skipped
+	translations := map[envs.Language]*models.BroadcastTranslation{
+		eng: {Text: "Your certificate", Attachments: []utils.Attachment{"image/jpeg:https://example.com/@contact.uuid.jpg", "@fields.gender"}},
+	}
+	bcastID := testdata.InsertBroadcast(db, testdata.Org1, eng, map[envs.Language]string{eng: "Your certificate"}, models.NilScheduleID, nil, nil)
+	bcast := models.NewBroadcast(testdata.Org1.ID, bcastID, translations, models.TemplateStateUnevaluated, eng, nil, []models.ContactID{testdata.Cathy.ID, testdata.Bob.ID}, nil, models.NilTicketID, models.NilUserID)
+
+	err := msgs.CreateBroadcastBatches(ctx, rt, bcast)
+	require.NoError(t, err)
+
+	task, err := queue.PopNextTask(rc, queue.HandlerQueue)
+	require.NoError(t, err)
+
+	batch := &models.BroadcastBatch{}
+	jsonx.MustUnmarshal(task.Task, batch)
+
+	err = msgs.SendBroadcastBatch(ctx, rt, batch)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT attachments FROM msgs_msg WHERE contact_id = $1 AND broadcast_id = $2`, testdata.Cathy.ID, bcastID).
+		Returns(fmt.Sprintf("{image/jpeg:https://example.com/%s.jpg}", testdata.Cathy.UUID))
+	assertdb.Query(t, db, `SELECT attachments FROM msgs_msg WHERE contact_id = $1 AND broadcast_id = $2`, testdata.Bob.ID, bcastID).
+		Returns(fmt.Sprintf("{image/jpeg:https://example.com/%s.jpg}", testdata.Bob.UUID))
+
+	// a broadcast with an attachment that can't be valid for any contact is failed without being sent
+	translations = map[envs.Language]*models.BroadcastTranslation{
+		eng: {Text: "Your certificate", Attachments: []utils.Attachment{"https://example.com/cert.jpg"}},
+	}
+	bcastID = testdata.InsertBroadcast(db, testdata.Org1, eng, map[envs.Language]string{eng: "Your certificate"}, models.NilScheduleID, nil, nil)
+	bcast = models.NewBroadcast(testdata.Org1.ID, bcastID, translations, models.TemplateStateUnevaluated, eng, nil, []models.ContactID{testdata.Cathy.ID}, nil, models.NilTicketID, models.NilUserID)
+
+	err = msgs.CreateBroadcastBatches(ctx, rt, bcast)
+	assert.EqualError(t, err, fmt.Sprintf("broadcast #%d has invalid attachments: invalid attachment 'https://example.com/cert.jpg' in eng translation: attachment has no content type", bcastID))
+
+	assertdb.Query(t, db, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcastID).Returns("F")
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1`, bcastID).Returns(0)
+
+	task, err = queue.PopNextTask(rc, queue.HandlerQueue)
+	assert.NoError(t, err)
+	assert.Nil(t, task)
+}
+
+func TestBroadcastPreview(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// put cathy and bob in our testers group
+	db.MustExec(`INSERT INTO contacts_contactgroup_contacts(contactgroup_id, contact_id) VALUES($1, $2), ($1, $3)`, testdata.TestersGroup.ID, testdata.Cathy.ID, testdata.Bob.ID)
+
+	bcastID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "hello", "spa": "hola"}, models.NilScheduleID, nil, []*testdata.Group{testdata.DoctorsGroup})
+
+	bcast := &models.Broadcast{}
+	err := json.Unmarshal([]byte(fmt.Sprintf(`{
+		"broadcast_id": %d,
+		"org_id": 1,
+		"translations": {"eng": {"text": "hello"}, "spa": {"text": "hola"}},
+		"base_language": "eng",
+		"template_state": "evaluated",
+		"group_ids": [%d],
+		"preview_group_id": %d
+	}`, bcastID, testdata.DoctorsGroup.ID, testdata.TestersGroup.ID)), bcast)
+	require.NoError(t, err)
+
+	err = msgs.CreateBroadcastBatches(ctx, rt, bcast)
+	assert.NoError(t, err)
+
+	// should have a batch for each language, all high priority on the handler queue
+	count := 0
+	for {
+		task, err := queue.PopNextTask(rc, queue.HandlerQueue)
+		require.NoError(t, err)
+		if task == nil {
+			break
+		}
+		count++
+
+		batch := &models.BroadcastBatch{}
+		jsonx.MustUnmarshal(task.Task, batch)
+		assert.Equal(t, models.NilBroadcastID, batch.BroadcastID)
+
+		err = msgs.SendBroadcastBatch(ctx, rt, batch)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, count)
+
+	// testers get the broadcast in every language, nobody else gets anything yet
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND text IN ('hello', 'hola')`, testdata.Cathy.ID).Returns(2)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE contact_id = $1 AND text IN ('hello', 'hola')`, testdata.Bob.ID).Returns(2)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE text IN ('hello', 'hola')`).Returns(4)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE broadcast_id = $1`, bcastID).Returns(0)
+
+	// confirming it gives us back the broadcast without the preview group
+	confirmed, err := models.PopBroadcastPreview(ctx, db, testdata.Org1.ID, bcastID)
+	require.NoError(t, err)
+	require.NotNil(t, confirmed)
+	assert.Equal(t, bcastID, confirmed.ID())
+	assert.Equal(t, models.NilGroupID, confirmed.PreviewGroupID())
+	assert.Equal(t, []models.GroupID{testdata.DoctorsGroup.ID}, confirmed.GroupIDs())
+
+	// can only be confirmed once
+	confirmed, err = models.PopBroadcastPreview(ctx, db, testdata.Org1.ID, bcastID)
+	assert.NoError(t, err)
+	assert.Nil(t, confirmed)
+
+	// and can't be confirmed once the preview has expired
+	err = models.StoreBroadcastPreview(ctx, db, bcast)
+	require.NoError(t, err)
+
+	db.MustExec(`UPDATE msgs_broadcastpreview SET created_on = NOW() - INTERVAL '8 days' WHERE broadcast_id = $1`, bcastID)
+
+	confirmed, err = models.PopBroadcastPreview(ctx, db, testdata.Org1.ID, bcastID)
+	assert.Equal(t, models.ErrBroadcastPreviewExpired, err)
+	assert.Nil(t, confirmed)
+}
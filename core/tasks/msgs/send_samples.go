@@ -0,0 +1,96 @@
+package msgs
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// max number of samples we post to an org's endpoint in a single request
+const sampleBatchSize = 100
+
+func init() {
+	mailroom.RegisterCron("send_msg_samples", time.Second*60, false, SendMsgSamples)
+}
+
+// SendMsgSamples posts queued message samples to each org's analytics endpoint in batches
+func SendMsgSamples(ctx context.Context, rt *runtime.Runtime) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	orgIDs, err := models.GetMsgSampleOrgs(rc)
+	if err != nil {
+		return err
+	}
+
+	for _, orgID := range orgIDs {
+		// one org we can't load shouldn't stop samples being sent for the others, and its samples stay queued
+		oa, err := models.GetOrgAssets(ctx, rt, orgID)
+		if err != nil {
+			logrus.WithError(err).WithField("org_id", orgID).Error("error loading org assets to send message samples")
+			continue
+		}
+
+		// sampling may have been disabled since these were queued, in which case we still pop them to discard them
+		sampling := oa.Org().MsgSampling()
+
+		for {
+			samples, err := models.PopMsgSamples(rc, orgID, sampleBatchSize)
+			if err != nil {
+				return err
+			}
+			if len(samples) == 0 {
+				break
+			}
+
+			if sampling != nil {
+				// samples are best effort so a failing endpoint means we drop this batch rather than retrying it
+				if err := postMsgSamples(ctx, rt, oa, sampling.URL, samples); err != nil {
+					logrus.WithError(err).WithField("org_id", orgID).WithField("count", len(samples)).Error("error posting message samples")
+					break
+				}
+			}
+
+			if len(samples) < sampleBatchSize {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+func postMsgSamples(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, url string, samples []*models.MsgSample) error {
+	client, retries, access := goflow.HTTP(rt.Config)
+
+	body := jsonx.MustMarshal(map[string]interface{}{"samples": samples})
+
+	req, err := httpx.NewRequest(http.MethodPost, url, bytes.NewReader(body), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+
+	if err := oa.SignWebhook(req); err != nil {
+		return err
+	}
+
+	trace, err := httpx.DoTrace(client, req, retries, access, -1)
+	if err != nil {
+		return err
+	}
+	if trace.Response.StatusCode/100 != 2 {
+		return errors.Errorf("analytics endpoint returned status %d", trace.Response.StatusCode)
+	}
+	return nil
+}
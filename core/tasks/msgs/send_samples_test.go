@@ -0,0 +1,64 @@
+package msgs_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/msgs"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendMsgSamples(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://analytics.example.com/samples": {
+			httpx.NewMockResponse(200, nil, []byte(`{"status": "ok"}`)),
+		},
+	})
+	httpx.SetRequestor(mocks)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"msg_sampling": {"url": "https://analytics.example.com/samples", "percent": 10}}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	models.FlushCache()
+
+	// nothing queued
+	err := msgs.SendMsgSamples(ctx, rt)
+	require.NoError(t, err)
+	assert.Equal(t, 0, len(mocks.Requests()))
+
+	createdOn := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, models.QueueMsgSample(rc, testdata.Org1.ID, &models.MsgSample{MsgUUID: "1bf6f3d5-6b3b-4b3d-8ab0-9ecb5ad59a2f", ContactUUID: testdata.Cathy.UUID, Text: "Hi", CreatedOn: createdOn}))
+	require.NoError(t, models.QueueMsgSample(rc, testdata.Org1.ID, &models.MsgSample{MsgUUID: "6f0f2a56-1bc7-4e14-bb4d-8c8b2e0f8a4e", ContactUUID: testdata.Bob.UUID, Text: "I'm on ****", CreatedOn: createdOn}))
+
+	// org 2 doesn't have sampling configured so its samples are discarded
+	require.NoError(t, models.QueueMsgSample(rc, testdata.Org2.ID, &models.MsgSample{MsgUUID: "b2c4b7c8-4f0b-4c52-b9b8-6a0b6f2ad0b3", Text: "Hola", CreatedOn: createdOn}))
+
+	// an org which can't be loaded doesn't stop the others being sent, and keeps its samples
+	require.NoError(t, models.QueueMsgSample(rc, models.OrgID(1000), &models.MsgSample{MsgUUID: "0c7a1a0e-5a39-4b0e-9d41-5b8f0b6c1e2d", Text: "Hey", CreatedOn: createdOn}))
+
+	err = msgs.SendMsgSamples(ctx, rt)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, len(mocks.Requests()))
+	body, err := io.ReadAll(mocks.Requests()[0].Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"samples": [
+		{"msg_uuid": "1bf6f3d5-6b3b-4b3d-8ab0-9ecb5ad59a2f", "contact_uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf", "channel_uuid": "", "text": "Hi", "attachments": 0, "created_on": "2022-10-01T12:00:00Z"},
+		{"msg_uuid": "6f0f2a56-1bc7-4e14-bb4d-8c8b2e0f8a4e", "contact_uuid": "b699a406-7e44-49be-9f01-1a82893e8a10", "channel_uuid": "", "text": "I'm on ****", "attachments": 0, "created_on": "2022-10-01T12:00:00Z"}
+	]}`, string(body))
+
+	orgIDs, err := models.GetMsgSampleOrgs(rc)
+	require.NoError(t, err)
+	assert.Equal(t, []models.OrgID{1000}, orgIDs)
+}
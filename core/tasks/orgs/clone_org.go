@@ -0,0 +1,123 @@
+package orgs
+
+import (
+	"context"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks"
+	"github.com/nyaruka/mailroom/core/tasks/campaigns"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+	"github.com/nyaruka/redisx"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// TypeCloneOrg is the type of the task to clone a template org into another org
+const TypeCloneOrg = "clone_org"
+
+var cloneOrgLockKeys = orgkeys.Register("lock:clone_org_%d")
+
+func init() {
+	tasks.RegisterType(TypeCloneOrg, func() tasks.Task { return &CloneOrgTask{} })
+}
+
+// CloneOrgTask is our task to bootstrap an org by cloning the fields, groups, flows, campaigns and triggers of a
+// template org into it. The clone happens in a single transaction and its outcome, including the mapping of template
+// UUIDs to new UUIDs, is recorded against the org and can be fetched afterwards.
+type CloneOrgTask struct {
+	SourceOrgID models.OrgID  `json:"source_org_id" validate:"required"`
+	UserID      models.UserID `json:"user_id"       validate:"required"`
+}
+
+// Timeout is the maximum amount of time the task can run for
+func (t *CloneOrgTask) Timeout() time.Duration {
+	return time.Minute * 30
+}
+
+// Perform implements tasks.Task
+func (t *CloneOrgTask) Perform(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID) error {
+	if t.SourceOrgID == orgID {
+		return errors.Errorf("can't clone org #%d into itself", orgID)
+	}
+
+	locker := redisx.NewLocker(cloneOrgLockKeys.Key(int(orgID)), time.Minute*30)
+	lock, err := locker.Grab(rt.RP, time.Minute*5)
+	if err != nil {
+		return errors.Wrapf(err, "error grabbing lock to clone into org #%d", orgID)
+	}
+	defer locker.Release(rt.RP, lock)
+
+	start := time.Now()
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	clone := models.NewOrgClone(t.SourceOrgID)
+	if err := models.SetOrgClone(rc, orgID, clone); err != nil {
+		return err
+	}
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return failOrgClone(rc, orgID, clone, errors.Wrap(err, "error starting transaction"))
+	}
+
+	if err := models.CloneOrg(ctx, tx, t.SourceOrgID, orgID, t.UserID, clone); err != nil {
+		tx.Rollback()
+		return failOrgClone(rc, orgID, clone, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return failOrgClone(rc, orgID, clone, errors.Wrap(err, "error committing org clone"))
+	}
+
+	// populate new smart groups and schedule new campaign events
+	for groupID, query := range clone.NewSmartGroups {
+		task := &contacts.PopulateDynamicGroupTask{GroupID: groupID, Query: query}
+		if err := queue.AddTask(ctx, rc, queue.BatchQueue, contacts.TypePopulateDynamicGroup, int(orgID), task, queue.DefaultPriority); err != nil {
+			return failOrgClone(rc, orgID, clone, errors.Wrapf(err, "error queuing population of group #%d", groupID))
+		}
+	}
+	for _, eventID := range clone.NewCampaignEvents {
+		task := &campaigns.ScheduleCampaignEventTask{CampaignEventID: eventID}
+		if err := queue.AddTask(ctx, rc, queue.BatchQueue, campaigns.TypeScheduleCampaignEvent, int(orgID), task, queue.DefaultPriority); err != nil {
+			return failOrgClone(rc, orgID, clone, errors.Wrapf(err, "error queuing scheduling of campaign event #%d", eventID))
+		}
+	}
+
+	clone.Complete()
+
+	if err := models.SetOrgClone(rc, orgID, clone); err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"org_id":          orgID,
+		"source_org_id":   t.SourceOrgID,
+		"elapsed":         time.Since(start),
+		"fields":          clone.Fields,
+		"groups":          clone.Groups,
+		"flows":           clone.Flows,
+		"campaigns":       clone.Campaigns,
+		"campaign_events": clone.CampaignEvents,
+		"triggers":        clone.Triggers,
+	}).Info("cloned template org")
+
+	return nil
+}
+
+// marks the given clone as failed, returning the error which caused it to fail
+func failOrgClone(rc redis.Conn, orgID models.OrgID, clone *models.OrgClone, err error) error {
+	clone.Fail(err.Error())
+
+	if serr := models.SetOrgClone(rc, orgID, clone); serr != nil {
+		logrus.WithError(serr).WithField("org_id", orgID).Error("error saving failed org clone")
+	}
+	return err
+}
@@ -0,0 +1,82 @@
+package orgs_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/campaigns"
+	"github.com/nyaruka/mailroom/core/tasks/orgs"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloneOrgTask(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	// can't clone an org into itself
+	task := &orgs.CloneOrgTask{SourceOrgID: testdata.Org1.ID, UserID: testdata.Admin.ID}
+	assert.EqualError(t, task.Perform(ctx, rt, testdata.Org1.ID), "can't clone org #1 into itself")
+
+	// make one of the template's groups a smart group
+	db.MustExec(`UPDATE contacts_contactgroup SET group_type = 'Q', query = 'age > 18' WHERE id = $1`, testdata.TestersGroup.ID)
+
+	var numFlows, numTriggers int
+	db.Get(&numFlows, `SELECT count(*) FROM flows_flow WHERE org_id = $1 AND is_active AND NOT is_archived`, testdata.Org1.ID)
+	db.Get(&numTriggers, `SELECT count(*) FROM triggers_trigger WHERE org_id = $1 AND is_active AND NOT is_archived`, testdata.Org1.ID)
+
+	task = &orgs.CloneOrgTask{SourceOrgID: testdata.Org1.ID, UserID: testdata.Admin.ID}
+	require.NoError(t, task.Perform(ctx, rt, testdata.Org2.ID))
+
+	clone, err := models.GetOrgClone(rc, testdata.Org2.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrgCloneStatusComplete, clone.Status)
+	assert.Equal(t, numFlows, clone.Flows)
+	assert.Equal(t, 1, clone.Campaigns)
+	assert.Equal(t, 3, clone.CampaignEvents)
+	assert.Equal(t, numTriggers, clone.Triggers+clone.SkippedTriggers)
+	assert.NotNil(t, clone.CompletedOn)
+
+	// everything cloned gets a new UUID in the target org
+	favoritesUUID := clone.UUIDs[string(testdata.Favorites.UUID)]
+	assert.NotEqual(t, "", favoritesUUID)
+	assert.NotEqual(t, string(testdata.Favorites.UUID), favoritesUUID)
+
+	assertdb.Query(t, db, `SELECT org_id FROM flows_flow WHERE uuid = $1`, favoritesUUID).Returns(int64(testdata.Org2.ID))
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_campaign WHERE uuid = $1 AND org_id = $2`, clone.UUIDs[string(testdata.RemindersCampaign.UUID)], testdata.Org2.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM campaigns_campaignevent WHERE uuid = $1`, clone.UUIDs[string(testdata.RemindersEvent1.UUID)]).Returns(1)
+
+	// and references to flows and groups in flow definitions are rewritten
+	var definition string
+	db.Get(&definition, `SELECT fr.definition FROM flows_flowrevision fr JOIN flows_flow f ON f.id = fr.flow_id WHERE f.uuid = $1 ORDER BY fr.revision DESC LIMIT 1`, favoritesUUID)
+	assert.True(t, strings.Contains(definition, favoritesUUID))
+	assert.False(t, strings.Contains(definition, string(testdata.Favorites.UUID)))
+
+	// new smart groups are created as initializing
+	assertdb.Query(t, db, `SELECT status FROM contacts_contactgroup WHERE uuid = $1`, clone.UUIDs[string(testdata.TestersGroup.UUID)]).Returns("I")
+
+	// and tasks queued to populate them and schedule the new campaign events
+	taskTypes := make(map[string]int)
+	for {
+		task, err := queue.PopNextTask(rc, queue.BatchQueue)
+		require.NoError(t, err)
+		if task == nil {
+			break
+		}
+		taskTypes[task.Type]++
+	}
+	assert.Equal(t, 3, taskTypes[campaigns.TypeScheduleCampaignEvent])
+	assert.Equal(t, 1, taskTypes["populate_dynamic_group"])
+
+	// the template org is left as is
+	assertdb.Query(t, db, `SELECT org_id FROM flows_flow WHERE uuid = $1`, testdata.Favorites.UUID).Returns(int64(testdata.Org1.ID))
+}
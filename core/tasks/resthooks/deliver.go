@@ -0,0 +1,148 @@
+package resthooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.AddTaskFunction(queue.DeliverResthookEvent, handleDeliverResthookEvent)
+}
+
+// deliveries which fail with a server error are retried by requeuing them, up to this many attempts in total
+const maxDeliveryAttempts = 4
+
+// whether a delivery which got the given response, or none if the request failed, should be retried
+func shouldRetryDelivery(response *http.Response) bool {
+	return response == nil || response.StatusCode/100 == 5 || response.StatusCode == http.StatusTooManyRequests
+}
+
+func handleDeliverResthookEvent(ctx context.Context, rt *runtime.Runtime, task *queue.Task) error {
+	delivery := &models.ResthookDelivery{}
+	if err := utils.UnmarshalAndValidate(task.Task, delivery); err != nil {
+		return errors.Wrapf(err, "error unmarshalling resthook delivery: %s", string(task.Task))
+	}
+
+	return DeliverResthookEvent(ctx, rt, models.OrgID(task.OrgID), delivery)
+}
+
+// DeliverResthookEvent delivers the given resthook event to each of the resthook's current subscribers, logging each
+// delivery and unsubscribing any subscriber which has repeatedly told us it's gone. Rather than waiting to retry failed
+// deliveries, they're requeued at a lower priority for each subscriber that they failed for.
+func DeliverResthookEvent(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, delivery *models.ResthookDelivery) error {
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return errors.Wrap(err, "error loading org assets")
+	}
+
+	subscribers, err := models.LoadResthookSubscribers(ctx, rt.DB, orgID, delivery.Resthook)
+	if err != nil {
+		return err
+	}
+
+	logs := make([]*models.HTTPLog, 0, len(subscribers))
+	unsubs := make([]*models.ResthookUnsubscribe, 0)
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	for _, sub := range subscribers {
+		if delivery.URL != "" && sub.URL != delivery.URL {
+			continue
+		}
+
+		log := logrus.WithField("org_id", orgID).WithField("resthook", delivery.Resthook).WithField("url", sub.URL)
+
+		trace, err := deliver(rt, oa, sub.URL, delivery.Payload)
+		if trace == nil {
+			log.WithError(err).Error("error creating resthook delivery request")
+			continue
+		}
+
+		statusCode := 0
+		if trace.Response != nil {
+			statusCode = trace.Response.StatusCode
+		}
+
+		logs = append(logs, models.NewResthookDeliveredLog(
+			orgID, sub.URL, statusCode, string(trace.RequestTrace), trace.SanitizedResponse("..."),
+			statusCode/100 != 2, trace.EndTime.Sub(trace.StartTime), trace.Retries, trace.StartTime,
+		))
+
+		if statusCode == http.StatusGone {
+			gone, err := models.RecordResthookGone(rc, orgID, delivery.Resthook, sub.URL)
+			if err != nil {
+				return err
+			}
+			if gone {
+				log.Info("unsubscribing resthook subscriber after repeated 410 responses")
+				unsubs = append(unsubs, &models.ResthookUnsubscribe{OrgID: orgID, Slug: delivery.Resthook, URL: sub.URL})
+			}
+		} else if statusCode/100 == 2 {
+			if err := models.ClearResthookGone(rc, orgID, delivery.Resthook, sub.URL); err != nil {
+				return err
+			}
+		} else {
+			log.WithError(err).WithField("status_code", statusCode).Warn("error delivering resthook event")
+
+			if shouldRetryDelivery(trace.Response) && delivery.Attempts+1 < maxDeliveryAttempts {
+				retry := &models.ResthookDelivery{
+					Resthook:  delivery.Resthook,
+					Payload:   delivery.Payload,
+					CreatedOn: delivery.CreatedOn,
+					URL:       sub.URL,
+					Attempts:  delivery.Attempts + 1,
+				}
+				if err := queue.AddTask(ctx, rc, queue.BatchQueue, queue.DeliverResthookEvent, int(orgID), retry, queue.LowPriority); err != nil {
+					return errors.Wrap(err, "error requeuing resthook delivery")
+				}
+			}
+		}
+	}
+
+	if err := models.InsertHTTPLogs(ctx, rt.DB, logs); err != nil {
+		return errors.Wrap(err, "error inserting resthook delivery logs")
+	}
+	if err := models.UnsubscribeResthooks(ctx, rt.DB, unsubs); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// DeliverTestEvent makes a single delivery of the given payload to the given URL without any retries, so that users
+// can check that a URL is ready to receive events before subscribing it
+func DeliverTestEvent(rt *runtime.Runtime, oa *models.OrgAssets, url string, payload json.RawMessage) (*httpx.Trace, error) {
+	return deliver(rt, oa, url, payload)
+}
+
+// makes a single delivery without any retries, returning the trace if a request was made even if it failed
+func deliver(rt *runtime.Runtime, oa *models.OrgAssets, url string, payload json.RawMessage) (*httpx.Trace, error) {
+	client, _, access := goflow.HTTP(rt.Config)
+
+	request, err := httpx.NewRequest(http.MethodPost, url, bytes.NewReader(payload), map[string]string{
+		"Content-Type": "application/json",
+		"User-Agent":   "RapidProMailroom/" + rt.Config.Version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := oa.SignWebhook(request); err != nil {
+		return nil, errors.Wrap(err, "error signing resthook delivery")
+	}
+
+	return httpx.DoTrace(client, request, nil, access, rt.Config.WebhooksMaxBodyBytes)
+}
@@ -0,0 +1,83 @@
+package resthooks_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/resthooks"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeliverResthookEvent(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://rapidpro.io/": {
+			httpx.NewMockResponse(200, nil, []byte("OK")),
+			httpx.NewMockResponse(200, nil, []byte("OK")),
+			httpx.NewMockResponse(200, nil, []byte("OK")),
+		},
+		"http://rapidpro.io/?unsub=1": {
+			httpx.NewMockResponse(410, nil, []byte("Gone")),
+			httpx.NewMockResponse(410, nil, []byte("Gone")),
+			httpx.NewMockResponse(410, nil, []byte("Gone")),
+		},
+		"http://rapidpro.io/?down=1": {
+			httpx.NewMockResponse(503, nil, []byte("Unavailable")),
+			httpx.NewMockResponse(503, nil, []byte("Unavailable")),
+			httpx.NewMockResponse(503, nil, []byte("Unavailable")),
+			httpx.NewMockResponse(503, nil, []byte("Unavailable")),
+		},
+	}))
+
+	_, err := models.SubscribeResthook(ctx, db, testdata.Org1.ID, testdata.Admin.ID, "foo", "http://rapidpro.io/")
+	require.NoError(t, err)
+	_, err = models.SubscribeResthook(ctx, db, testdata.Org1.ID, testdata.Admin.ID, "foo", "http://rapidpro.io/?unsub=1")
+	require.NoError(t, err)
+	_, err = models.SubscribeResthook(ctx, db, testdata.Org1.ID, testdata.Admin.ID, "foo", "http://rapidpro.io/?down=1")
+	require.NoError(t, err)
+
+	delivery := &models.ResthookDelivery{Resthook: "foo", Payload: json.RawMessage(`{"contact": {"name": "Cathy"}}`)}
+
+	for i := 0; i < 3; i++ {
+		err = resthooks.DeliverResthookEvent(ctx, rt, testdata.Org1.ID, delivery)
+		require.NoError(t, err)
+	}
+
+	// every delivery is logged
+	assertdb.Query(t, db, `SELECT count(*) FROM request_logs_httplog WHERE log_type = 'resthook_delivered' AND status_code = 200 AND NOT is_error`).Returns(3)
+	assertdb.Query(t, db, `SELECT count(*) FROM request_logs_httplog WHERE log_type = 'resthook_delivered' AND status_code = 410 AND is_error`).Returns(3)
+
+	// and the subscriber which was repeatedly gone has been unsubscribed
+	assertdb.Query(t, db, `SELECT count(*) FROM api_resthooksubscriber WHERE is_active`).Returns(2)
+	assertdb.Query(t, db, `SELECT target_url FROM api_resthooksubscriber WHERE NOT is_active`).Returns("http://rapidpro.io/?unsub=1")
+
+	// and each failed delivery to the subscriber which is down has been requeued for just that subscriber
+	tasks := testsuite.CurrentOrgTasks(t, rp)[testdata.Org1.ID]
+	require.Len(t, tasks, 3)
+
+	retry := &models.ResthookDelivery{}
+	jsonx.MustUnmarshal(tasks[0].Task, retry)
+	assert.Equal(t, queue.DeliverResthookEvent, tasks[0].Type)
+	assert.Equal(t, "http://rapidpro.io/?down=1", retry.URL)
+	assert.Equal(t, 1, retry.Attempts)
+
+	// a retry is only delivered to that subscriber and isn't requeued once it's used up its attempts
+	retry.Attempts = 3
+	err = resthooks.DeliverResthookEvent(ctx, rt, testdata.Org1.ID, retry)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM request_logs_httplog WHERE log_type = 'resthook_delivered' AND status_code = 503`).Returns(4)
+	assert.Len(t, testsuite.CurrentOrgTasks(t, rp)[testdata.Org1.ID], 3)
+}
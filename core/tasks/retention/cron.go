@@ -0,0 +1,71 @@
+package retention
+
+import (
+	"context"
+	"time"
+
+	"github.com/nyaruka/gocommon/analytics"
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	mailroom.RegisterCron("apply_retention_policies", time.Hour, false, ApplyRetentionPolicies)
+}
+
+// ApplyRetentionPolicies clears or deletes data which is older than allowed by the retention policy of its org
+func ApplyRetentionPolicies(ctx context.Context, rt *runtime.Runtime) error {
+	start := time.Now()
+
+	policies, err := models.LoadOrgRetentionPolicies(ctx, rt.DB)
+	if err != nil {
+		return errors.Wrap(err, "error loading retention policies")
+	}
+
+	total := &models.RetentionReport{}
+
+	for _, p := range policies {
+		log := logrus.WithField("org_id", p.OrgID)
+
+		// an invalid policy for one org shouldn't stop us applying the policies of other orgs
+		policy, err := models.ReadRetentionPolicy(p.Policy)
+		if err != nil {
+			log.WithError(err).Error("error reading retention policy for org")
+			continue
+		}
+
+		report, err := models.ApplyRetentionPolicy(ctx, rt.DB, p.OrgID, policy, start)
+		if err != nil {
+			return errors.Wrapf(err, "error applying retention policy for org #%d", p.OrgID)
+		}
+
+		if report.MsgBodiesCleared > 0 || report.RunsDeleted > 0 || report.SessionsDeleted > 0 {
+			log.WithFields(logrus.Fields{
+				"msg_bodies_cleared": report.MsgBodiesCleared,
+				"runs_deleted":       report.RunsDeleted,
+				"sessions_deleted":   report.SessionsDeleted,
+			}).Info("applied retention policy")
+		}
+
+		total.MsgBodiesCleared += report.MsgBodiesCleared
+		total.RunsDeleted += report.RunsDeleted
+		total.SessionsDeleted += report.SessionsDeleted
+	}
+
+	analytics.Gauge("mr.retention_msg_bodies_cleared", float64(total.MsgBodiesCleared))
+	analytics.Gauge("mr.retention_runs_deleted", float64(total.RunsDeleted))
+	analytics.Gauge("mr.retention_sessions_deleted", float64(total.SessionsDeleted))
+
+	logrus.WithFields(logrus.Fields{
+		"elapsed":            time.Since(start),
+		"orgs":               len(policies),
+		"msg_bodies_cleared": total.MsgBodiesCleared,
+		"runs_deleted":       total.RunsDeleted,
+		"sessions_deleted":   total.SessionsDeleted,
+	}).Info("applied retention policies")
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package retention_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/retention"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyRetentionPolicies(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	msg1 := testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "hello", models.MsgStatusHandled)
+	msg2 := testdata.InsertIncomingMsg(db, testdata.Org2, testdata.Org2Channel, testdata.Org2Contact, "hola", models.MsgStatusHandled)
+	db.MustExec(`UPDATE msgs_msg SET created_on = NOW() - INTERVAL '100 days'`)
+
+	// org 1 has a policy, org 2 has an invalid one which is ignored
+	db.MustExec(`UPDATE orgs_org SET config = '{"retention_policy": {"msg_bodies": 90}}' WHERE id = $1`, testdata.Org1.ID)
+	db.MustExec(`UPDATE orgs_org SET config = '{"retention_policy": {"msg_bodies": -1}}' WHERE id = $1`, testdata.Org2.ID)
+
+	policies, err := models.LoadOrgRetentionPolicies(ctx, db)
+	require.NoError(t, err)
+	assert.Len(t, policies, 2)
+
+	err = retention.ApplyRetentionPolicies(ctx, rt)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT text FROM msgs_msg WHERE id = $1`, msg1.ID()).Returns("")
+	assertdb.Query(t, db, `SELECT text FROM msgs_msg WHERE id = $1`, msg2.ID()).Returns("hola")
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/mailroom"
 	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/msgio"
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/core/runner"
 	"github.com/nyaruka/mailroom/core/search"
@@ -72,6 +73,15 @@ func CreateFlowBatches(ctx context.Context, rt *runtime.Runtime, start *models.F
 		return errors.Wrapf(err, "error loading org assets")
 	}
 
+	// starts of deleted flows are rejected rather than being silently skipped when batches are started
+	deleted, err := models.IsFlowDeleted(ctx, rt.DB, start.OrgID(), start.FlowID())
+	if err != nil {
+		return err
+	}
+	if deleted {
+		return errors.Errorf("unable to start flow #%d which has been deleted", start.FlowID())
+	}
+
 	// look up any contacts by URN
 	if len(start.URNs()) > 0 {
 		urnContactIDs, err := models.GetOrCreateContactIDsFromURNs(ctx, rt.DB, oa, start.URNs())
@@ -182,7 +192,7 @@ func CreateFlowBatches(ctx context.Context, rt *runtime.Runtime, start *models.F
 	contacts := make([]models.ContactID, 0, 100)
 	queueBatch := func(last bool) {
 		batch := start.CreateBatch(contacts, last, len(contactIDs))
-		err = queue.AddTask(rc, q, taskType, int(start.OrgID()), batch, queue.DefaultPriority)
+		err = queue.AddTask(ctx, rc, q, taskType, int(start.OrgID()), batch, queue.DefaultPriority)
 		if err != nil {
 			// TODO: is continuing the right thing here? what do we do if redis is down? (panic!)
 			logrus.WithError(err).WithField("start_id", start.ID()).Error("error while queuing start")
@@ -221,6 +231,24 @@ func handleFlowStartBatch(ctx context.Context, rt *runtime.Runtime, task *queue.
 		return errors.Wrapf(err, "error unmarshalling flow start batch: %s", string(task.Task))
 	}
 
+	oa, err := models.GetOrgAssets(ctx, rt, startBatch.OrgID())
+	if err != nil {
+		return errors.Wrapf(err, "error getting org assets")
+	}
+
+	// if any of the org's courier queues are backed up, try this batch again later rather than adding to them
+	delay, err := msgio.CheckCourierBackpressure(ctx, rt, oa)
+	if err != nil {
+		return err
+	}
+	if delay > 0 {
+		rc := rt.RP.Get()
+		defer rc.Close()
+
+		logrus.WithFields(logrus.Fields{"start_id": startBatch.StartID(), "delay": delay}).Info("flow start batch delayed by courier backpressure")
+		return queue.AddDelayedTask(ctx, rc, queue.BatchQueue, queue.StartFlowBatch, int(startBatch.OrgID()), startBatch, queue.DefaultPriority, delay)
+	}
+
 	// start these contacts in our flow
 	_, err = runner.StartFlowBatch(ctx, rt, startBatch)
 	if err != nil {
@@ -0,0 +1,106 @@
+package templates
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// catalog requests are made from a cron so can take a while, but not so long that they hold up the next run
+var syncHTTPClient = &http.Client{Timeout: time.Minute}
+
+func init() {
+	mailroom.RegisterCron("sync_templates", time.Minute*15, false, SyncTemplates)
+}
+
+// SyncTemplates syncs the template translations of every channel which has a provider template catalog, so that the
+// templates loaded into org assets only include those currently approved by the provider
+func SyncTemplates(ctx context.Context, rt *runtime.Runtime) error {
+	start := time.Now()
+
+	orgIDs, err := models.LoadTemplateCatalogOrgs(ctx, rt.DB)
+	if err != nil {
+		return err
+	}
+
+	numSynced := 0
+
+	for _, orgID := range orgIDs {
+		oa, err := models.GetOrgAssets(ctx, rt, orgID)
+		if err != nil {
+			return errors.Wrapf(err, "error loading org assets for org #%d", orgID)
+		}
+
+		channels, err := oa.Channels()
+		if err != nil {
+			return errors.Wrapf(err, "error loading channels for org #%d", orgID)
+		}
+
+		for _, c := range channels {
+			channel := c.(*models.Channel)
+
+			synced, err := syncChannelTemplates(ctx, rt, oa, channel)
+			if err != nil {
+				// one channel's provider failing shouldn't prevent others being synced
+				logrus.WithError(err).WithField("org_id", orgID).WithField("channel_uuid", channel.UUID()).Error("error syncing channel templates")
+			}
+			if synced {
+				numSynced++
+			}
+		}
+	}
+
+	logrus.WithFields(logrus.Fields{"elapsed": time.Since(start), "channels": numSynced}).Info("synced channel templates")
+	return nil
+}
+
+// syncs the templates of a single channel, returning whether it has a template catalog which was synced
+func syncChannelTemplates(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, channel *models.Channel) (bool, error) {
+	svc, err := channel.TemplateCatalogService(syncHTTPClient, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "error creating template catalog service")
+	}
+	if svc == nil {
+		return false, nil
+	}
+
+	clog := models.NewChannelLog(models.ChannelLogTypeTemplatesSync, channel, svc.RedactValues())
+
+	templates, traces, fetchErr := svc.FetchTemplates()
+
+	for _, trace := range traces {
+		clog.HTTP(trace)
+	}
+	if fetchErr != nil {
+		clog.Error(fetchErr)
+	}
+	clog.End()
+
+	if err := models.InsertChannelLogs(ctx, rt.DB, []*models.ChannelLog{clog}); err != nil {
+		return false, errors.Wrap(err, "error inserting templates sync channel log")
+	}
+	if fetchErr != nil {
+		return false, errors.Wrap(fetchErr, "error fetching template catalog")
+	}
+
+	tx, err := rt.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, errors.Wrap(err, "error starting transaction")
+	}
+	defer tx.Rollback()
+
+	if err := models.SyncChannelTemplates(ctx, tx, oa, channel, templates); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, errors.Wrap(err, "error committing synced templates")
+	}
+	return true, nil
+}
@@ -0,0 +1,50 @@
+package templates_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/templates"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/nyaruka/mailroom/services/templates/whatsapp"
+)
+
+func TestSyncTemplates(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://graph.facebook.com/v14.0/1234/message_templates?limit=255": {
+			httpx.NewMockResponse(200, nil, []byte(`{"data": [{"id": "1", "name": "order_update", "language": "en", "status": "APPROVED", "components": [{"type": "BODY", "text": "Your order {{1}} has shipped"}]}], "paging": {}}`)),
+		},
+		"https://waba.360dialog.io/v1/configs/templates": {
+			httpx.NewMockResponse(500, nil, []byte(`oops`)),
+		},
+	})
+	httpx.SetRequestor(mocks)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	waChannel := testdata.InsertChannel(db, testdata.Org1, models.ChannelTypeWhatsApp, "WhatsApp", []string{"whatsapp"}, "SR", map[string]interface{}{"fb_business_id": "1234", "fb_access_token": "sesame"})
+	d3Channel := testdata.InsertChannel(db, testdata.Org2, models.ChannelTypeDialog360, "360dialog", []string{"whatsapp"}, "SR", map[string]interface{}{"base_url": "https://waba.360dialog.io", "auth_token": "sesame"})
+	models.FlushCache()
+
+	// a failing provider doesn't prevent other channels being synced
+	err := templates.SyncTemplates(ctx, rt)
+	require.NoError(t, err)
+	assert.Equal(t, 2, len(mocks.Requests()))
+
+	assertdb.Query(t, db, `SELECT count(*) FROM templates_templatetranslation WHERE channel_id = $1 AND status = 'A' AND is_active = TRUE`, waChannel.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM templates_templatetranslation WHERE channel_id = $1`, d3Channel.ID).Returns(0)
+
+	// both syncs are logged with the access tokens redacted
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog WHERE log_type = 'templates_sync' AND channel_id = $1 AND is_error = FALSE`, waChannel.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog WHERE log_type = 'templates_sync' AND channel_id = $1 AND is_error = TRUE`, d3Channel.ID).Returns(1)
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channellog WHERE log_type = 'templates_sync' AND http_logs::text LIKE '%sesame%'`).Returns(0)
+}
@@ -2,7 +2,10 @@ package mailroom
 
 import (
 	"context"
+	"fmt"
+	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -12,7 +15,10 @@ import (
 	"github.com/nyaruka/gocommon/storage"
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/services/storage/azure"
+	"github.com/nyaruka/mailroom/services/storage/gcs"
 	"github.com/nyaruka/mailroom/utils/cron"
+	"github.com/nyaruka/mailroom/utils/metrics"
 	"github.com/nyaruka/mailroom/web"
 	"github.com/pkg/errors"
 
@@ -49,6 +55,23 @@ func AddTaskFunction(taskType string, taskFunc TaskFunction) {
 	taskFunctions[taskType] = taskFunc
 }
 
+// HasTaskFunction returns whether a task function has been added for the given type of task
+func HasTaskFunction(taskType string) bool {
+	_, found := taskFunctions[taskType]
+	return found
+}
+
+// TaskForwarder is the function that will be called before a type of task is forwarded to another region, to move any
+// state the task depends on which is stored outside of the task itself to that region's Redis
+type TaskForwarder func(ctx context.Context, rt *runtime.Runtime, task *queue.Task, regionRC redis.Conn) error
+
+var taskForwarders = make(map[string]TaskForwarder)
+
+// AddTaskForwarder adds a task forwarder that will be called for a type of task before it is forwarded to another region
+func AddTaskForwarder(taskType string, taskForwarder TaskForwarder) {
+	taskForwarders[taskType] = taskForwarder
+}
+
 // Mailroom is a service for handling RapidPro events
 type Mailroom struct {
 	ctx    context.Context
@@ -105,35 +128,43 @@ func (mr *Mailroom) Start() error {
 		log.Warn("no distinct readonly db configured")
 	}
 
-	mr.rt.RP, err = openAndCheckRedisPool(c.Redis)
+	mr.rt.RP, err = openAndCheckRedisPool(c.Redis, 36, true)
 	if err != nil {
 		log.WithError(err).Error("redis not reachable")
 	} else {
 		log.Info("redis ok")
 	}
 
-	// create our storage (S3 or file system)
-	if mr.rt.Config.AWSAccessKeyID != "" || mr.rt.Config.AWSUseCredChain {
-		s3config := &storage.S3Options{
-			Endpoint:       c.S3Endpoint,
-			Region:         c.S3Region,
-			DisableSSL:     c.S3DisableSSL,
-			ForcePathStyle: c.S3ForcePathStyle,
-			MaxRetries:     3,
-		}
-		if mr.rt.Config.AWSAccessKeyID != "" && !mr.rt.Config.AWSUseCredChain {
-			s3config.AWSAccessKeyID = c.AWSAccessKeyID
-			s3config.AWSSecretAccessKey = c.AWSSecretAccessKey
+	// each console streaming org events holds a subscription open, so they get their own pool which refuses any more
+	mr.rt.PubSubRP, err = openAndCheckRedisPool(c.Redis, c.WebMaxStreams, false)
+	if err != nil {
+		log.WithError(err).Error("redis pubsub not reachable")
+	}
+
+	// open connections to the Redis instances of other regions so we can forward tasks to them
+	regionURLs, _ := c.ParseRegionsRedis()
+	mr.rt.RegionPools = make(map[string]*redis.Pool, len(regionURLs))
+	for region, regionURL := range regionURLs {
+		mr.rt.RegionPools[region], err = openAndCheckRedisPool(regionURL, 36, true)
+		if err != nil {
+			log.WithError(err).WithField("region", region).Error("region redis not reachable")
+		} else {
+			log.WithField("region", region).Info("region redis ok")
 		}
-		s3Client, err := storage.NewS3Client(s3config)
+	}
+
+	// create our storage (S3, GCS, Azure or file system)
+	mr.rt.AttachmentStorage, mr.rt.SessionStorage, err = newStorage(c)
+	if err != nil {
+		return err
+	}
+
+	// create our key service if org field encryption is enabled
+	if c.KMSRegion != "" {
+		mr.rt.KMS, err = runtime.NewAWSKeyService(c)
 		if err != nil {
-			return err
+			return errors.Wrap(err, "error creating KMS key service")
 		}
-		mr.rt.AttachmentStorage = storage.NewS3(s3Client, mr.rt.Config.S3AttachmentsBucket, c.S3Region, s3.BucketCannedACLPublicRead, 32)
-		mr.rt.SessionStorage = storage.NewS3(s3Client, mr.rt.Config.S3SessionBucket, c.S3Region, s3.ObjectCannedACLPrivate, 32)
-	} else {
-		mr.rt.AttachmentStorage = storage.NewFS("_storage", 0766)
-		mr.rt.SessionStorage = storage.NewFS("_storage", 0766)
 	}
 
 	// test our attachment storage
@@ -174,12 +205,21 @@ func (mr *Mailroom) Start() error {
 		initFunc(mr.rt, mr.wg, mr.quit)
 	}
 
-	// if we have a librato token, configure it
-	if c.LibratoToken != "" {
-		analytics.RegisterBackend(analytics.NewLibrato(c.LibratoUsername, c.LibratoToken, c.InstanceName, time.Second, mr.wg))
+	// configure our metrics backend
+	switch c.MetricsBackend {
+	case "librato":
+		if c.LibratoToken != "" {
+			analytics.RegisterBackend(analytics.NewLibrato(c.LibratoUsername, c.LibratoToken, c.InstanceName, time.Second, mr.wg))
+		}
+	case "prometheus":
+		analytics.RegisterBackend(metrics.NewPrometheus(fmt.Sprintf("%s:%d", c.Address, c.PrometheusPort), mr.wg))
+	case "statsd":
+		analytics.RegisterBackend(metrics.NewStatsd(c.StatsdAddress))
 	}
 
-	analytics.Start()
+	if err := analytics.Start(); err != nil {
+		log.WithError(err).Error("error starting metrics backend")
+	}
 
 	// init our foremen and start it
 	mr.batchForeman.Start()
@@ -217,6 +257,60 @@ func (mr *Mailroom) Stop() error {
 	return nil
 }
 
+func newStorage(c *runtime.Config) (storage.Storage, storage.Storage, error) {
+	switch c.StorageBackend {
+	case "gcs":
+		credsJSON, err := os.ReadFile(c.GCSCredentialsFile)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "unable to read GCS credentials file")
+		}
+		creds, err := gcs.ReadCredentials(credsJSON)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		httpClient := &http.Client{Timeout: time.Minute}
+		attachments, err := gcs.NewStorage(httpClient, creds, c.GCSAttachmentsBucket, gcs.ACLPublicRead, 32)
+		if err != nil {
+			return nil, nil, err
+		}
+		sessions, err := gcs.NewStorage(httpClient, creds, c.GCSSessionBucket, gcs.ACLPrivate, 32)
+		if err != nil {
+			return nil, nil, err
+		}
+		return attachments, sessions, nil
+
+	case "azure":
+		httpClient := &http.Client{Timeout: time.Minute}
+		attachments := azure.NewStorage(httpClient, c.AzureAccountName, c.AzureSASToken, c.AzureAttachmentsContainer, 32)
+		sessions := azure.NewStorage(httpClient, c.AzureAccountName, c.AzureSASToken, c.AzureSessionContainer, 32)
+		return attachments, sessions, nil
+	}
+
+	if c.AWSAccessKeyID != "" || c.AWSUseCredChain {
+		s3config := &storage.S3Options{
+			Endpoint:       c.S3Endpoint,
+			Region:         c.S3Region,
+			DisableSSL:     c.S3DisableSSL,
+			ForcePathStyle: c.S3ForcePathStyle,
+			MaxRetries:     3,
+		}
+		if c.AWSAccessKeyID != "" && !c.AWSUseCredChain {
+			s3config.AWSAccessKeyID = c.AWSAccessKeyID
+			s3config.AWSSecretAccessKey = c.AWSSecretAccessKey
+		}
+		s3Client, err := storage.NewS3Client(s3config)
+		if err != nil {
+			return nil, nil, err
+		}
+		attachments := storage.NewS3(s3Client, c.S3AttachmentsBucket, c.S3Region, s3.BucketCannedACLPublicRead, 32)
+		sessions := storage.NewS3(s3Client, c.S3SessionBucket, c.S3Region, s3.ObjectCannedACLPrivate, 32)
+		return attachments, sessions, nil
+	}
+
+	return storage.NewFS("_storage", 0766), storage.NewFS("_storage", 0766), nil
+}
+
 func openAndCheckDBConnection(url string, maxOpenConns int) (*sqlx.DB, error) {
 	db, err := sqlx.Open("postgres", url)
 	if err != nil {
@@ -236,12 +330,12 @@ func openAndCheckDBConnection(url string, maxOpenConns int) (*sqlx.DB, error) {
 	return db, err
 }
 
-func openAndCheckRedisPool(redisUrl string) (*redis.Pool, error) {
+func openAndCheckRedisPool(redisUrl string, maxActive int, wait bool) (*redis.Pool, error) {
 	redisURL, _ := url.Parse(redisUrl)
 
 	rp := &redis.Pool{
-		Wait:        true,              // makes callers wait for a connection
-		MaxActive:   36,                // only open this many concurrent connections at once
+		Wait:        wait,              // whether callers wait for a connection when all are in use
+		MaxActive:   maxActive,         // only open this many concurrent connections at once
 		MaxIdle:     4,                 // only keep up to this many idle
 		IdleTimeout: 240 * time.Second, // how long to wait before reaping a connection
 		Dial: func() (redis.Conn, error) {
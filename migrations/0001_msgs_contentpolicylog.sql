@@ -0,0 +1,13 @@
+-- audit records of content policy rules matching outgoing messages (see core/models/content_policy.go)
+CREATE TABLE IF NOT EXISTS msgs_contentpolicylog (
+    id serial PRIMARY KEY,
+    org_id integer NOT NULL REFERENCES orgs_org(id) DEFERRABLE INITIALLY DEFERRED,
+    msg_id bigint NOT NULL REFERENCES msgs_msg(id) DEFERRABLE INITIALLY DEFERRED,
+    contact_id integer NOT NULL REFERENCES contacts_contact(id) DEFERRABLE INITIALLY DEFERRED,
+    rule varchar(64) NOT NULL,
+    action varchar(16) NOT NULL,
+    created_on timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS msgs_contentpolicylog_org_created ON msgs_contentpolicylog(org_id, created_on DESC);
+CREATE INDEX IF NOT EXISTS msgs_contentpolicylog_msg_id ON msgs_contentpolicylog(msg_id);
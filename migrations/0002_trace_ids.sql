@@ -0,0 +1,6 @@
+-- trace IDs of the API request, task or cron run which created rows (see utils/trace/trace.go), nullable so adding
+-- them doesn't rewrite these tables
+ALTER TABLE msgs_msg ADD COLUMN IF NOT EXISTS trace_id varchar(64) NULL;
+ALTER TABLE flows_flowrun ADD COLUMN IF NOT EXISTS trace_id varchar(64) NULL;
+ALTER TABLE flows_flowstart ADD COLUMN IF NOT EXISTS trace_id varchar(64) NULL;
+ALTER TABLE campaigns_eventfire ADD COLUMN IF NOT EXISTS trace_id varchar(64) NULL;
@@ -0,0 +1,12 @@
+-- daily counts of the tokens used by LLM classifiers, scoped by org and classifier (see core/models/classifiers.go)
+CREATE TABLE IF NOT EXISTS classifiers_llmdailycount (
+    id bigserial PRIMARY KEY,
+    is_squashed boolean NOT NULL,
+    count_type varchar(1) NOT NULL,
+    scope varchar(32) NOT NULL,
+    day date NOT NULL,
+    count integer NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS classifiers_llmdailycount_type_scope ON classifiers_llmdailycount(count_type, scope, day);
+CREATE INDEX IF NOT EXISTS classifiers_llmdailycount_unsquashed ON classifiers_llmdailycount(count_type, scope, day) WHERE NOT is_squashed;
@@ -0,0 +1,6 @@
+-- the ID a provider gave a transfer and the session which made it, so that providers which report the final status
+-- of transfers asynchronously can update the right transfer and resume the right session (see core/models/airtime.go)
+ALTER TABLE airtime_airtimetransfer ADD COLUMN IF NOT EXISTS external_id varchar(64) NULL;
+ALTER TABLE airtime_airtimetransfer ADD COLUMN IF NOT EXISTS session_id bigint NULL;
+
+CREATE INDEX IF NOT EXISTS airtime_airtimetransfer_org_external_id ON airtime_airtimetransfer(org_id, external_id) WHERE external_id IS NOT NULL;
@@ -0,0 +1,3 @@
+-- metadata given by the creator of a flow start which is passed through to the runs it creates (see core/models/starts.go)
+ALTER TABLE flows_flowstart ADD COLUMN IF NOT EXISTS metadata jsonb NULL;
+ALTER TABLE flows_flowrun ADD COLUMN IF NOT EXISTS metadata jsonb NULL;
@@ -0,0 +1,12 @@
+-- audit records of outgoing messages deferred or dropped by an org's frequency cap (see core/models/msg_frequency.go)
+CREATE TABLE IF NOT EXISTS msgs_msgsuppression (
+    id serial PRIMARY KEY,
+    org_id integer NOT NULL REFERENCES orgs_org(id) DEFERRABLE INITIALLY DEFERRED,
+    msg_id bigint NOT NULL REFERENCES msgs_msg(id) DEFERRABLE INITIALLY DEFERRED,
+    contact_id integer NOT NULL REFERENCES contacts_contact(id) DEFERRABLE INITIALLY DEFERRED,
+    action varchar(8) NOT NULL,
+    created_on timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS msgs_msgsuppression_org_created ON msgs_msgsuppression(org_id, created_on DESC);
+CREATE INDEX IF NOT EXISTS msgs_msgsuppression_msg_id ON msgs_msgsuppression(msg_id);
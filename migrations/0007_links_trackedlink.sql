@@ -0,0 +1,16 @@
+-- short links created for URLs in outgoing messages whose clicks are tracked (see core/models/links.go)
+CREATE TABLE IF NOT EXISTS links_trackedlink (
+    id bigserial PRIMARY KEY,
+    org_id integer NOT NULL REFERENCES orgs_org(id) DEFERRABLE INITIALLY DEFERRED,
+    code varchar(16) NOT NULL,
+    url text NOT NULL,
+    contact_id integer NOT NULL REFERENCES contacts_contact(id) DEFERRABLE INITIALLY DEFERRED,
+    channel_id integer NOT NULL REFERENCES channels_channel(id) DEFERRABLE INITIALLY DEFERRED,
+    contact_urn_id integer NOT NULL REFERENCES contacts_contacturn(id) DEFERRABLE INITIALLY DEFERRED,
+    msg_id bigint NOT NULL REFERENCES msgs_msg(id) DEFERRABLE INITIALLY DEFERRED,
+    session_id bigint NULL,
+    created_on timestamp with time zone NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS links_trackedlink_code ON links_trackedlink(code);
+CREATE INDEX IF NOT EXISTS links_trackedlink_msg_id ON links_trackedlink(msg_id);
@@ -0,0 +1,10 @@
+-- notes added to contacts by users which are shown in their history (see core/models/contact_notes.go)
+CREATE TABLE IF NOT EXISTS contacts_contactnote (
+    id serial PRIMARY KEY,
+    contact_id integer NOT NULL REFERENCES contacts_contact(id) DEFERRABLE INITIALLY DEFERRED,
+    text text NOT NULL,
+    created_by_id integer NOT NULL REFERENCES auth_user(id) DEFERRABLE INITIALLY DEFERRED,
+    created_on timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS contacts_contactnote_contact_created ON contacts_contactnote(contact_id, created_on);
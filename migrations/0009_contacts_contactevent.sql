@@ -0,0 +1,12 @@
+-- events pushed onto contact histories by external systems (see core/models/contact_events.go)
+CREATE TABLE IF NOT EXISTS contacts_contactevent (
+    id serial PRIMARY KEY,
+    contact_id integer NOT NULL REFERENCES contacts_contact(id) DEFERRABLE INITIALLY DEFERRED,
+    event_type varchar(64) NOT NULL,
+    source varchar(64) NOT NULL,
+    payload jsonb NULL,
+    occurred_on timestamp with time zone NOT NULL,
+    created_on timestamp with time zone NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS contacts_contactevent_contact_occurred ON contacts_contactevent(contact_id, occurred_on DESC, id DESC);
@@ -0,0 +1,4 @@
+-- full text indexes for searching the messages and tickets of an org (see core/models/org_search.go). On a large
+-- existing database these should be created CONCURRENTLY ahead of deploying.
+CREATE INDEX IF NOT EXISTS msgs_msg_text_search ON msgs_msg USING GIN (to_tsvector('simple', text)) WHERE visibility = 'V';
+CREATE INDEX IF NOT EXISTS tickets_ticket_body_search ON tickets_ticket USING GIN (to_tsvector('simple', body));
@@ -0,0 +1,8 @@
+-- flags for gradually rolling out new behaviors to orgs (see core/models/feature_flags.go)
+CREATE TABLE IF NOT EXISTS orgs_featureflag (
+    id serial PRIMARY KEY,
+    name varchar(64) NOT NULL UNIQUE,
+    is_active boolean NOT NULL,
+    org_ids integer[] NOT NULL DEFAULT '{}',
+    percentage integer NOT NULL DEFAULT 0 CHECK (percentage >= 0 AND percentage <= 100)
+);
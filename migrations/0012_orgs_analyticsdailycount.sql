@@ -0,0 +1,12 @@
+-- daily analytics rollups of orgs, scoped by org and channel (see core/models/analytics.go)
+CREATE TABLE IF NOT EXISTS orgs_analyticsdailycount (
+    id bigserial PRIMARY KEY,
+    is_squashed boolean NOT NULL,
+    count_type varchar(16) NOT NULL,
+    scope varchar(32) NOT NULL,
+    day date NOT NULL,
+    count bigint NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS orgs_analyticsdailycount_scope_day ON orgs_analyticsdailycount(scope varchar_pattern_ops, day);
+CREATE INDEX IF NOT EXISTS orgs_analyticsdailycount_unsquashed ON orgs_analyticsdailycount(count_type, scope, day) WHERE NOT is_squashed;
@@ -0,0 +1,15 @@
+-- conversations between contacts and channels, for orgs which record them (see core/models/conversations.go)
+CREATE TABLE IF NOT EXISTS msgs_conversation (
+    id bigserial PRIMARY KEY,
+    org_id integer NOT NULL REFERENCES orgs_org(id),
+    contact_id integer NOT NULL REFERENCES contacts_contact(id),
+    channel_id integer NOT NULL REFERENCES channels_channel(id),
+    initiated_by varchar(1) NOT NULL,
+    started_on timestamp with time zone NOT NULL,
+    last_msg_on timestamp with time zone NOT NULL,
+    msgs_in integer NOT NULL,
+    msgs_out integer NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS msgs_conversation_contact_channel ON msgs_conversation(contact_id, channel_id, last_msg_on DESC);
+CREATE INDEX IF NOT EXISTS msgs_conversation_org_started ON msgs_conversation(org_id, started_on);
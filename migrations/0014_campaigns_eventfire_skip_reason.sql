@@ -0,0 +1,3 @@
+-- why campaign event fires were skipped rather than fired (see core/models/campaigns.go), nullable so adding it doesn't
+-- rewrite the table
+ALTER TABLE campaigns_eventfire ADD COLUMN IF NOT EXISTS skip_reason varchar(16) NULL;
@@ -0,0 +1,3 @@
+-- how many calls per minute a voice campaign event makes (see core/models/campaigns.go), nullable so adding it doesn't
+-- rewrite the table, with NULL meaning unpaced
+ALTER TABLE campaigns_campaignevent ADD COLUMN IF NOT EXISTS calls_per_minute integer NULL;
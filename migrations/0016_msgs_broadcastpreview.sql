@@ -0,0 +1,7 @@
+-- broadcasts whose preview has been sent and which are waiting to be confirmed (see core/models/broadcast_previews.go)
+CREATE TABLE IF NOT EXISTS msgs_broadcastpreview (
+    broadcast_id integer PRIMARY KEY REFERENCES msgs_broadcast(id),
+    org_id integer NOT NULL REFERENCES orgs_org(id),
+    broadcast jsonb NOT NULL,
+    created_on timestamp with time zone NOT NULL
+);
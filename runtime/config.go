@@ -5,6 +5,7 @@ import (
 	"io"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/nyaruka/goflow/utils"
@@ -14,6 +15,9 @@ import (
 
 func init() {
 	utils.RegisterValidatorAlias("session_storage", "eq=db|eq=s3", func(e validator.FieldError) string { return "is not a valid session storage mode" })
+	utils.RegisterValidatorAlias("transcode_format", "eq=mp3|eq=ogg|eq=wav", func(e validator.FieldError) string { return "is not a valid transcoding format" })
+	utils.RegisterValidatorAlias("transcription_service", "eq=whisper|eq=google", func(e validator.FieldError) string { return "is not a valid transcription service" })
+	utils.RegisterValidatorAlias("storage_backend", "eq=s3|eq=gcs|eq=azure", func(e validator.FieldError) string { return "is not a valid storage backend" })
 }
 
 // Config is our top level configuration object
@@ -31,9 +35,19 @@ type Config struct {
 	Domain           string `help:"the domain that mailroom is listening on"`
 	AttachmentDomain string `help:"the domain that will be used for relative attachment"`
 
+	WebRateLimit    float64 `help:"the number of requests per second each client can make to each class of web endpoint, 0 to disable"`
+	WebRateBurst    int     `help:"the number of requests each client can make in a burst above the web rate limit"`
+	WebRateLimits   string  `help:"comma separated list of class=rate pairs which override WebRateLimit for classes of web endpoint, e.g. contact=20,flow=5"`
+	WebRateExempt   string  `help:"comma separated list of additional auth tokens for internal clients, which aren't rate limited"`
+	WebMaxBodyBytes int64   `help:"the maximum size in bytes of request bodies accepted by the web server"`
+	WebMaxStreams   int     `help:"the maximum number of agent consoles which can stream org events at once"`
+
 	BatchWorkers         int  `help:"the number of go routines that will be used to handle batch events"`
 	HandlerWorkers       int  `help:"the number of go routines that will be used to handle messages"`
 	RetryPendingMessages bool `help:"whether to requeue pending messages older than five minutes to retry"`
+	ImportMaxInFlight    int  `help:"the maximum number of records of a contact import batch which are decoded and imported at once, 0 for no limit"`
+	HandlerBatchWindow   int  `help:"the time in milliseconds after a text message from a contact within which any more already queued text messages from them are handled together with it, for orgs with the msg_batching feature flag, 0 to disable"`
+	ContactLockWarnAfter int  `help:"the time in seconds a task can hold a contact lock before it's logged as possibly stuck"`
 
 	WebhooksTimeout              int     `help:"the timeout in milliseconds for webhook calls from engine"`
 	WebhooksMaxRetries           int     `help:"the number of times to retry a failed webhook call"`
@@ -42,12 +56,17 @@ type Config struct {
 	WebhooksBackoffJitter        float64 `help:"the amount of jitter to apply to backoff times"`
 	WebhooksHealthyResponseLimit int     `help:"the limit in milliseconds for webhook response to be considered healthy"`
 
+	LLMTimeout      int `help:"the timeout in milliseconds for calls to LLM classifiers"`
+	LLMMaxBodyBytes int `help:"the maximum size of bytes to an LLM classifier response body"`
+	LLMMaxTokens    int `help:"the maximum number of tokens an LLM classifier can generate per call"`
+
 	SMTPServer           string `help:"the smtp configuration for sending emails ex: smtp://user%40password@server:port/?from=foo%40gmail.com"`
 	DisallowedNetworks   string `help:"comma separated list of IP addresses and networks which engine can't make HTTP calls to"`
 	MaxStepsPerSprint    int    `help:"the maximum number of steps allowed per engine sprint"`
 	MaxResumesPerSession int    `help:"the maximum number of resumes allowed per engine session"`
 	MaxValueLength       int    `help:"the maximum size in characters for contact field values and run result values"`
-	SessionStorage       string `validate:"omitempty,session_storage"         help:"where to store session output (s3|db)"`
+	SessionStorage       string `validate:"omitempty,session_storage"         help:"where to store session output (s3|db), where s3 means the configured storage backend"`
+	StorageBackend       string `validate:"omitempty,storage_backend"         help:"the storage backend for attachments and sessions (s3|gcs|azure)"`
 
 	S3Endpoint          string `help:"the S3 endpoint we will write attachments to"`
 	S3Region            string `help:"the S3 region we will write attachments to"`
@@ -62,14 +81,49 @@ type Config struct {
 	AWSSecretAccessKey string `help:"the secret access key id to use when authenticating S3"`
 	AWSUseCredChain    bool   `help:"whether to use the AWS credentials chain. Defaults to false."`
 
-	CourierAuthToken  string `help:"the authentication token used for requests to Courier"`
+	KMSRegion string `help:"the AWS region of the KMS keys which encrypt org data keys, leave empty to disable field encryption"`
+
+	GCSCredentialsFile   string `help:"the path of the service account JSON key used to authenticate with Google Cloud Storage"`
+	GCSAttachmentsBucket string `help:"the GCS bucket we will write attachments to"`
+	GCSSessionBucket     string `help:"the GCS bucket we will write sessions to"`
+
+	AzureAccountName          string `help:"the Azure storage account we will write attachments and sessions to"`
+	AzureSASToken             string `help:"the shared access signature used to authenticate with Azure Blob storage"`
+	AzureAttachmentsContainer string `help:"the Azure Blob container we will write attachments to"`
+	AzureSessionContainer     string `help:"the Azure Blob container we will write sessions to"`
+
+	IVRTranscodeFormat  string `validate:"omitempty,transcode_format" help:"the format IVR recordings are transcoded to (mp3|ogg|wav), leave empty to disable transcoding"`
+	IVRTranscodeBitrate string `help:"the audio bitrate IVR recordings are transcoded to"`
+	IVRTranscodeFFmpeg  string `help:"the path of the ffmpeg binary used to transcode IVR recordings"`
+	IVRTranscodeURL     string `help:"the URL of an external service to transcode IVR recordings with instead of ffmpeg"`
+
+	IVRDuplicateCallWindow int `help:"the time in seconds after a call from a flow start during which that start won't call the same contact again, 0 to disable"`
+	IVRMaxWaitTimeouts     int `help:"the number of times in a row a wait in an IVR flow can time out before the call is ended, 0 for no limit"`
+	IVRMaxCallDuration     int `help:"the time in seconds after which a wired or in progress call is checked with its provider in case it's stuck, 0 to disable"`
+
+	IVRTranscriptionService  string `validate:"omitempty,transcription_service" help:"the speech-to-text service used to transcribe IVR recordings (whisper|google), leave empty to disable"`
+	IVRTranscriptionKey      string `help:"the API key used to authenticate with the transcription service"`
+	IVRTranscriptionURL      string `help:"the URL of the transcription service if not the default for that service"`
+	IVRTranscriptionLanguage string `help:"the language code of IVR recordings passed to the transcription service, e.g. en-US"`
+
+	CourierAuthToken             string `help:"the authentication token used for requests to Courier"`
+	CourierBackpressureThreshold int    `help:"the number of batches in a channel's courier queue above which bulk message creation for its org is delayed, 0 to disable"`
+	CourierBackpressureDelay     int    `help:"the time in seconds that bulk message creation is delayed by when a channel's courier queue is backed up"`
+
 	LibratoUsername   string `help:"the username that will be used to authenticate to Librato"`
 	LibratoToken      string `help:"the token that will be used to authenticate to Librato"`
+	MetricsBackend    string `validate:"eq=librato|eq=prometheus|eq=statsd" help:"the backend that metrics are sent to (librato|prometheus|statsd)"`
+	PrometheusPort    int    `help:"the port metrics are served on for scraping when the metrics backend is prometheus"`
+	StatsdAddress     string `help:"the host:port of the StatsD server metrics are sent to when the metrics backend is statsd"`
 	FCMKey            string `help:"the FCM API key used to notify Android relayers to sync"`
 	MailgunSigningKey string `help:"the signing key used to validate requests from mailgun"`
 
+	Region       string `help:"the region of this cluster, tasks for orgs pinned to other regions are forwarded to those regions, leave empty to disable"`
+	RegionsRedis string `help:"comma separated list of region=URL pairs of the Redis instances of other regions' clusters"`
+
 	InstanceName string `help:"the unique name of this instance used for analytics"`
 	LogLevel     string `help:"the logging level courier should use"`
+	LogFormat    string `validate:"eq=text|eq=json" help:"the format of log output (text|json)"`
 	UUIDSeed     int    `help:"seed to use for UUID generation in a testing environment"`
 	Version      string `help:"the version of this mailroom install"`
 }
@@ -88,9 +142,18 @@ func NewDefaultConfig() *Config {
 		Address: "localhost",
 		Port:    8090,
 
+		WebRateLimit:    0,
+		WebRateBurst:    50,
+		WebRateLimits:   "",
+		WebRateExempt:   "",
+		WebMaxBodyBytes: 1024 * 1024 * 50, // 50MB
+		WebMaxStreams:   100,
+
 		BatchWorkers:         4,
 		HandlerWorkers:       32,
 		RetryPendingMessages: true,
+		ImportMaxInFlight:    100,
+		ContactLockWarnAfter: 60,
 
 		WebhooksTimeout:              15000,
 		WebhooksMaxRetries:           2,
@@ -99,12 +162,17 @@ func NewDefaultConfig() *Config {
 		WebhooksBackoffJitter:        0.5,
 		WebhooksHealthyResponseLimit: 10000,
 
+		LLMTimeout:      30000,
+		LLMMaxBodyBytes: 256 * 1024, // 256KB
+		LLMMaxTokens:    500,
+
 		SMTPServer:           "",
 		DisallowedNetworks:   `127.0.0.1,::1,10.0.0.0/8,172.16.0.0/12,192.168.0.0/16,169.254.0.0/16,fe80::/10`,
 		MaxStepsPerSprint:    200,
 		MaxResumesPerSession: 250,
 		MaxValueLength:       640,
 		SessionStorage:       "db",
+		StorageBackend:       "s3",
 
 		S3Endpoint:          "https://s3.amazonaws.com",
 		S3Region:            "us-east-1",
@@ -119,8 +187,27 @@ func NewDefaultConfig() *Config {
 		AWSSecretAccessKey: "",
 		AWSUseCredChain:    false,
 
+		GCSAttachmentsBucket: "mailroom-attachments",
+		GCSSessionBucket:     "mailroom-sessions",
+
+		AzureAttachmentsContainer: "mailroom-attachments",
+		AzureSessionContainer:     "mailroom-sessions",
+
+		IVRTranscodeBitrate: "32k",
+		IVRTranscodeFFmpeg:  "ffmpeg",
+		IVRMaxWaitTimeouts:  3,
+		IVRMaxCallDuration:  7200,
+
+		CourierBackpressureThreshold: 10000,
+		CourierBackpressureDelay:     60,
+
+		MetricsBackend: "librato",
+		PrometheusPort: 9090,
+		StatsdAddress:  "localhost:8125",
+
 		InstanceName: hostname,
 		LogLevel:     "error",
+		LogFormat:    "text",
 		UUIDSeed:     0,
 		Version:      "Dev",
 	}
@@ -135,6 +222,12 @@ func (c *Config) Validate() error {
 	if _, _, err := c.ParseDisallowedNetworks(); err != nil {
 		return errors.Wrap(err, "unable to parse 'DisallowedNetworks'")
 	}
+	if _, err := c.ParseRegionsRedis(); err != nil {
+		return errors.Wrap(err, "unable to parse 'RegionsRedis'")
+	}
+	if _, err := c.ParseWebRateLimits(); err != nil {
+		return errors.Wrap(err, "unable to parse 'WebRateLimits'")
+	}
 	return nil
 }
 
@@ -166,3 +259,57 @@ func (c *Config) ParseDisallowedNetworks() ([]net.IP, []*net.IPNet, error) {
 
 	return ips, ipNets, nil
 }
+
+// ParseRegionsRedis parses the Redis URLs of other regions' clusters into a map of region to URL
+func (c *Config) ParseRegionsRedis() (map[string]string, error) {
+	urls := make(map[string]string)
+	if c.RegionsRedis == "" {
+		return urls, nil
+	}
+
+	for _, pair := range strings.Split(c.RegionsRedis, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || !strings.HasPrefix(parts[1], "redis:") {
+			return nil, errors.Errorf("couldn't parse '%s' as a region and Redis URL", pair)
+		}
+		if parts[0] == c.Region {
+			return nil, errors.Errorf("region '%s' is this cluster's region", parts[0])
+		}
+		urls[parts[0]] = parts[1]
+	}
+
+	return urls, nil
+}
+
+// ParseWebRateLimits parses the rate limits of classes of web endpoint into a map of class to requests per second
+func (c *Config) ParseWebRateLimits() (map[string]float64, error) {
+	limits := make(map[string]float64)
+	if c.WebRateLimits == "" {
+		return limits, nil
+	}
+
+	for _, pair := range strings.Split(c.WebRateLimits, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, errors.Errorf("couldn't parse '%s' as an endpoint class and rate", pair)
+		}
+		rate, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || rate < 0 {
+			return nil, errors.Errorf("couldn't parse '%s' as an endpoint class and rate", pair)
+		}
+		limits[parts[0]] = rate
+	}
+
+	return limits, nil
+}
+
+// ParseWebRateExempt parses the auth tokens of clients which aren't rate limited
+func (c *Config) ParseWebRateExempt() []string {
+	exempt := make([]string, 0)
+	for _, client := range strings.Split(c.WebRateExempt, ",") {
+		if client = strings.TrimSpace(client); client != "" {
+			exempt = append(exempt, client)
+		}
+	}
+	return exempt
+}
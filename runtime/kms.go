@@ -0,0 +1,43 @@
+package runtime
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/aws/aws-sdk-go/service/kms/kmsiface"
+)
+
+// KeyService decrypts data keys which have been encrypted with a master key held by a key management service
+type KeyService interface {
+	Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error)
+}
+
+type awsKeyService struct {
+	client kmsiface.KMSAPI
+}
+
+// NewAWSKeyService creates a new key service backed by AWS KMS
+func NewAWSKeyService(c *Config) (KeyService, error) {
+	config := &aws.Config{Region: aws.String(c.KMSRegion), MaxRetries: aws.Int(3)}
+	if c.AWSAccessKeyID != "" && !c.AWSUseCredChain {
+		config.Credentials = credentials.NewStaticCredentials(c.AWSAccessKeyID, c.AWSSecretAccessKey, "")
+	}
+
+	s, err := session.NewSession(config)
+	if err != nil {
+		return nil, err
+	}
+	return &awsKeyService{client: kms.New(s)}, nil
+}
+
+// Decrypt decrypts the given data key, the master key being identified by the ciphertext itself
+func (s *awsKeyService) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	out, err := s.client.DecryptWithContext(ctx, &kms.DecryptInput{CiphertextBlob: ciphertext})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
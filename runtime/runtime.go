@@ -13,8 +13,11 @@ type Runtime struct {
 	DB                *sqlx.DB
 	ReadonlyDB        *sqlx.DB
 	RP                *redis.Pool
+	PubSubRP          *redis.Pool // separate pool for long lived subscriptions so they can't starve RP
 	ES                *elastic.Client
 	AttachmentStorage storage.Storage
 	SessionStorage    storage.Storage
+	KMS               KeyService
+	RegionPools       map[string]*redis.Pool
 	Config            *Config
 }
@@ -0,0 +1,198 @@
+package reloadly
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	authURL        = "https://auth.reloadly.com/oauth/token"
+	apiURL         = "https://topups.reloadly.com"
+	sandboxAPIURL  = "https://topups-sandbox.reloadly.com"
+	apiContentType = "application/com.reloadly.topups-v1+json"
+)
+
+// topup statuses, see https://developers.reloadly.com/airtime/topup-status
+const (
+	StatusSuccessful = "SUCCESSFUL"
+	StatusPending    = "PENDING"
+	StatusProcessing = "PROCESSING"
+	StatusRefunded   = "REFUNDED"
+	StatusFailed     = "FAILED"
+)
+
+// denomination types of operators
+const (
+	DenominationFixed = "FIXED"
+	DenominationRange = "RANGE"
+)
+
+// Client is a Reloadly airtime client, see https://developers.reloadly.com/airtime for API docs
+type Client struct {
+	httpClient   *http.Client
+	httpRetries  *httpx.RetryConfig
+	clientID     string
+	clientSecret string
+	baseURL      string
+	accessToken  string
+}
+
+// NewClient creates a new Reloadly client, using the sandbox API if sandbox is true
+func NewClient(httpClient *http.Client, httpRetries *httpx.RetryConfig, clientID, clientSecret string, sandbox bool) *Client {
+	baseURL := apiURL
+	if sandbox {
+		baseURL = sandboxAPIURL
+	}
+	return &Client{httpClient: httpClient, httpRetries: httpRetries, clientID: clientID, clientSecret: clientSecret, baseURL: baseURL}
+}
+
+// error response contains the error when a request fails
+type errorResponse struct {
+	Message   string `json:"message"`
+	ErrorCode string `json:"errorCode"`
+}
+
+func (e *errorResponse) Error() string {
+	return e.Message
+}
+
+// Authenticate gets an access token for the client's credentials which is used for subsequent requests
+func (c *Client) Authenticate() (*httpx.Trace, error) {
+	payload := map[string]string{
+		"client_id":     c.clientID,
+		"client_secret": c.clientSecret,
+		"grant_type":    "client_credentials",
+		"audience":      c.baseURL,
+	}
+	response := &struct {
+		AccessToken string `json:"access_token"`
+	}{}
+
+	req, err := httpx.NewRequest("POST", authURL, bytes.NewReader(jsonx.MustMarshal(payload)), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+
+	trace, err := c.do(req, response)
+	if err != nil {
+		return trace, err
+	}
+
+	c.accessToken = response.AccessToken
+	return trace, nil
+}
+
+// Balance is the balance of an account
+type Balance struct {
+	Balance      decimal.Decimal `json:"balance"`
+	CurrencyCode string          `json:"currencyCode"`
+}
+
+// AccountBalance gets the balance of the account, see https://developers.reloadly.com/airtime/account-balance
+func (c *Client) AccountBalance() (*Balance, *httpx.Trace, error) {
+	response := &Balance{}
+	trace, err := c.request("GET", "accounts/balance", nil, response)
+	return response, trace, err
+}
+
+// Operator is a mobile operator
+type Operator struct {
+	ID                      int               `json:"id"`
+	Name                    string            `json:"name"`
+	DenominationType        string            `json:"denominationType"`
+	SupportsLocalAmounts    bool              `json:"supportsLocalAmounts"`
+	DestinationCurrencyCode string            `json:"destinationCurrencyCode"`
+	LocalMinAmount          decimal.Decimal   `json:"localMinAmount"`
+	LocalMaxAmount          decimal.Decimal   `json:"localMaxAmount"`
+	FixedAmounts            []decimal.Decimal `json:"fixedAmounts"`
+	LocalFixedAmounts       []decimal.Decimal `json:"localFixedAmounts"`
+	FX                      struct {
+		Rate         decimal.Decimal `json:"rate"`
+		CurrencyCode string          `json:"currencyCode"`
+	} `json:"fx"`
+}
+
+// DetectOperator looks up the operator of a phone number, see https://developers.reloadly.com/airtime/operator-auto-detect
+func (c *Client) DetectOperator(phone, country string) (*Operator, *httpx.Trace, error) {
+	response := &Operator{}
+	trace, err := c.request("GET", fmt.Sprintf("operators/auto-detect/phone/%s/countries/%s", phone, country), nil, response)
+	return response, trace, err
+}
+
+// Phone is a phone number with its country
+type Phone struct {
+	CountryCode string `json:"countryCode"`
+	Number      string `json:"number"`
+}
+
+// TopupRequest is a request to send airtime
+type TopupRequest struct {
+	OperatorID       int             `json:"operatorId"`
+	Amount           decimal.Decimal `json:"amount"`
+	UseLocalAmount   bool            `json:"useLocalAmount"`
+	CustomIdentifier string          `json:"customIdentifier"`
+	RecipientPhone   *Phone          `json:"recipientPhone"`
+}
+
+// Topup is a sent airtime topup
+type Topup struct {
+	TransactionID               int             `json:"transactionId"`
+	Status                      string          `json:"status"`
+	CustomIdentifier            string          `json:"customIdentifier"`
+	RecipientPhone              string          `json:"recipientPhone"`
+	CountryCode                 string          `json:"countryCode"`
+	DeliveredAmount             decimal.Decimal `json:"deliveredAmount"`
+	DeliveredAmountCurrencyCode string          `json:"deliveredAmountCurrencyCode"`
+}
+
+// Topup sends airtime, see https://developers.reloadly.com/airtime/topups
+func (c *Client) Topup(topup *TopupRequest) (*Topup, *httpx.Trace, error) {
+	response := &Topup{}
+	trace, err := c.request("POST", "topups", topup, response)
+	return response, trace, err
+}
+
+func (c *Client) request(method, endpoint string, payload interface{}, response interface{}) (*httpx.Trace, error) {
+	url := fmt.Sprintf("%s/%s", c.baseURL, endpoint)
+	headers := map[string]string{
+		"Accept":        apiContentType,
+		"Authorization": "Bearer " + c.accessToken,
+	}
+
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(jsonx.MustMarshal(payload))
+		headers["Content-Type"] = "application/json"
+	}
+
+	req, err := httpx.NewRequest(method, url, body, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(req, response)
+}
+
+func (c *Client) do(req *http.Request, response interface{}) (*httpx.Trace, error) {
+	trace, err := httpx.DoTrace(c.httpClient, req, c.httpRetries, nil, -1)
+	if err != nil {
+		return trace, err
+	}
+
+	if trace.Response.StatusCode/100 != 2 {
+		errResp := &errorResponse{}
+		if err := jsonx.Unmarshal(trace.ResponseBody, errResp); err != nil || errResp.Message == "" {
+			return trace, errors.Errorf("Reloadly API request failed with status %d", trace.Response.StatusCode)
+		}
+		return trace, errResp
+	}
+
+	return trace, jsonx.Unmarshal(trace.ResponseBody, response)
+}
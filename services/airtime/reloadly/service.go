@@ -0,0 +1,178 @@
+package reloadly
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	typeReloadly = "reloadly"
+
+	configClientID      = "reloadly_client_id"
+	configClientSecret  = "reloadly_client_secret"
+	configSandbox       = "reloadly_sandbox"
+	configWebhookSecret = "reloadly_webhook_secret"
+)
+
+func init() {
+	models.RegisterAirtimeService(typeReloadly, newOrgService)
+}
+
+func newOrgService(org *models.Org, httpClient *http.Client, httpRetries *httpx.RetryConfig) (flows.AirtimeService, error) {
+	clientID := org.ConfigValue(configClientID, "")
+	clientSecret := org.ConfigValue(configClientSecret, "")
+
+	if clientID == "" || clientSecret == "" {
+		return nil, errors.Errorf("missing %s or %s on Reloadly configuration for org: %d", configClientID, configClientSecret, org.ID())
+	}
+	return NewService(httpClient, httpRetries, clientID, clientSecret, org.ConfigValue(configSandbox, "") == "true"), nil
+}
+
+type service struct {
+	client *Client
+}
+
+// NewService creates a new Reloadly airtime service
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, clientID, clientSecret string, sandbox bool) flows.AirtimeService {
+	return &service{client: NewClient(httpClient, httpRetries, clientID, clientSecret, sandbox)}
+}
+
+func (s *service) Transfer(sender urns.URN, recipient urns.URN, amounts map[string]decimal.Decimal, logHTTP flows.HTTPLogCallback) (*flows.AirtimeTransfer, error) {
+	transfer := &flows.AirtimeTransfer{
+		UUID:          uuids.New(),
+		Sender:        sender,
+		Recipient:     recipient,
+		DesiredAmount: decimal.Zero,
+		ActualAmount:  decimal.Zero,
+	}
+
+	trace, err := s.client.Authenticate()
+	s.log(trace, logHTTP)
+	if err != nil {
+		return transfer, errors.Wrap(err, "authentication failed")
+	}
+
+	country := envs.DeriveCountryFromTel(recipient.Path())
+	if country == envs.NilCountry {
+		return transfer, errors.Errorf("unable to determine country for number %s", recipient.Path())
+	}
+	phone := &Phone{CountryCode: string(country), Number: strings.TrimPrefix(recipient.Path(), "+")}
+
+	operator, trace, err := s.client.DetectOperator(phone.Number, phone.CountryCode)
+	s.log(trace, logHTTP)
+	if err != nil {
+		return transfer, errors.Wrap(err, "operator lookup failed")
+	}
+
+	desiredAmount, found := amounts[operator.DestinationCurrencyCode]
+	if !found {
+		return transfer, errors.Errorf("no amount configured for operator '%s' currency %s", operator.Name, operator.DestinationCurrencyCode)
+	}
+
+	transfer.Currency = operator.DestinationCurrencyCode
+	transfer.DesiredAmount = desiredAmount
+
+	localAmount, senderAmount, err := chooseAmounts(operator, desiredAmount)
+	if err != nil {
+		return transfer, err
+	}
+
+	// check we can afford this before trying to send it
+	balance, trace, err := s.client.AccountBalance()
+	s.log(trace, logHTTP)
+	if err != nil {
+		return transfer, errors.Wrap(err, "balance check failed")
+	}
+	if balance.CurrencyCode == operator.FX.CurrencyCode && balance.Balance.LessThan(senderAmount) {
+		return transfer, errors.Errorf("insufficient balance of %s %s to send %s %s", balance.Balance, balance.CurrencyCode, senderAmount, balance.CurrencyCode)
+	}
+
+	request := &TopupRequest{OperatorID: operator.ID, CustomIdentifier: string(transfer.UUID), RecipientPhone: phone}
+	if operator.SupportsLocalAmounts {
+		request.Amount = localAmount
+		request.UseLocalAmount = true
+	} else {
+		request.Amount = senderAmount
+	}
+
+	topup, trace, err := s.client.Topup(request)
+	log := s.log(trace, logHTTP)
+	if err != nil {
+		return transfer, errors.Wrap(err, "topup failed")
+	}
+
+	pending := topup.Status == StatusPending || topup.Status == StatusProcessing
+
+	// record the transaction ID so that the status webhook can find this transfer
+	if log != nil {
+		models.AirtimeExternalTransfers.Put(log, models.ExternalAirtimeTransfer{ID: strconv.Itoa(topup.TransactionID), Pending: pending})
+	}
+
+	switch {
+	case topup.Status == StatusSuccessful:
+		transfer.ActualAmount = topup.DeliveredAmount
+	case pending:
+		// nothing has been delivered yet, so the flow can't treat this as a success, and the final status will be
+		// reported to our status webhook
+		return transfer, errors.Errorf("topup %d to operator '%s' is %s and awaiting its final status", topup.TransactionID, operator.Name, topup.Status)
+	default:
+		return transfer, errors.Errorf("topup %d to operator '%s' ended with status %s", topup.TransactionID, operator.Name, topup.Status)
+	}
+
+	return transfer, nil
+}
+
+func (s *service) log(trace *httpx.Trace, logHTTP flows.HTTPLogCallback) *flows.HTTPLog {
+	if trace != nil {
+		// redact our secret and the access token we got with it
+		values := []string{s.client.clientSecret}
+		if s.client.accessToken != "" {
+			values = append(values, s.client.accessToken)
+		}
+		redactor := stringsx.NewRedactor(flows.RedactionMask, values...)
+
+		log := flows.NewHTTPLog(trace, flows.HTTPStatusFromCode, redactor)
+		logHTTP(log)
+		return log
+	}
+	return nil
+}
+
+// picks the largest amount the operator supports which doesn't exceed the desired amount, returning it in the local
+// currency and in our sender currency
+func chooseAmounts(operator *Operator, desired decimal.Decimal) (decimal.Decimal, decimal.Decimal, error) {
+	if operator.DenominationType == DenominationFixed {
+		best := -1
+		for i, amount := range operator.LocalFixedAmounts {
+			if amount.LessThanOrEqual(desired) && (best < 0 || amount.GreaterThan(operator.LocalFixedAmounts[best])) {
+				best = i
+			}
+		}
+		if best < 0 || best >= len(operator.FixedAmounts) {
+			return decimal.Zero, decimal.Zero, errors.Errorf("operator '%s' has no fixed amount of %s %s or less", operator.Name, desired, operator.DestinationCurrencyCode)
+		}
+		return operator.LocalFixedAmounts[best], operator.FixedAmounts[best], nil
+	}
+
+	local := decimal.Min(desired, operator.LocalMaxAmount)
+	if local.LessThan(operator.LocalMinAmount) {
+		return decimal.Zero, decimal.Zero, errors.Errorf("amount of %s %s is less than the minimum of operator '%s'", desired, operator.DestinationCurrencyCode, operator.Name)
+	}
+	if !operator.FX.Rate.IsPositive() {
+		return decimal.Zero, decimal.Zero, errors.Errorf("operator '%s' has no exchange rate", operator.Name)
+	}
+
+	return local, local.DivRound(operator.FX.Rate, 2), nil
+}
@@ -0,0 +1,183 @@
+package reloadly_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/services/airtime/reloadly"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const authResponse = `{"access_token": "eyJhbGciOi", "scope": "send-topups read-operators", "expires_in": 5184000, "token_type": "Bearer"}`
+
+const rangeOperatorResponse = `{
+	"id": 173,
+	"name": "Claro Ecuador",
+	"denominationType": "RANGE",
+	"supportsLocalAmounts": true,
+	"destinationCurrencyCode": "USD",
+	"localMinAmount": 1,
+	"localMaxAmount": 50,
+	"fixedAmounts": [],
+	"localFixedAmounts": [],
+	"fx": {"rate": 0.9, "currencyCode": "EUR"}
+}`
+
+const fixedOperatorResponse = `{
+	"id": 535,
+	"name": "MTN Rwanda",
+	"denominationType": "FIXED",
+	"supportsLocalAmounts": false,
+	"destinationCurrencyCode": "RWF",
+	"fixedAmounts": [1.00, 2.50, 5.00],
+	"localFixedAmounts": [1000, 2500, 5000],
+	"fx": {"rate": 1000, "currencyCode": "EUR"}
+}`
+
+func TestServiceWithSuccessfulTransfer(t *testing.T) {
+	defer uuids.SetGenerator(uuids.DefaultGenerator)
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	uuids.SetGenerator(uuids.NewSeededGenerator(12345))
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token": {
+			httpx.NewMockResponse(200, nil, []byte(authResponse)),
+		},
+		"https://topups.reloadly.com/operators/auto-detect/phone/593979123456/countries/EC": {
+			httpx.NewMockResponse(200, nil, []byte(rangeOperatorResponse)),
+		},
+		"https://topups.reloadly.com/accounts/balance": {
+			httpx.NewMockResponse(200, nil, []byte(`{"balance": 550.75, "currencyCode": "EUR"}`)),
+		},
+		"https://topups.reloadly.com/topups": {
+			httpx.NewMockResponse(200, nil, []byte(`{"transactionId": 4602, "status": "SUCCESSFUL", "deliveredAmount": 3.5, "deliveredAmountCurrencyCode": "USD"}`)),
+		},
+	})
+	httpx.SetRequestor(mocks)
+
+	svc := reloadly.NewService(http.DefaultClient, nil, "client123", "sesame", false)
+
+	httpLogger := &flows.HTTPLogger{}
+
+	transfer, err := svc.Transfer(
+		urns.URN("tel:+593979000000"),
+		urns.URN("tel:+593979123456"),
+		map[string]decimal.Decimal{
+			"USD": decimal.RequireFromString("3.5"),
+			"RWF": decimal.RequireFromString("5000"),
+		},
+		httpLogger.Log,
+	)
+	require.NoError(t, err)
+	assert.Equal(t, &flows.AirtimeTransfer{
+		UUID:          "1ae96956-4b34-433e-8d1a-f05fe6923d6d",
+		Sender:        urns.URN("tel:+593979000000"),
+		Recipient:     urns.URN("tel:+593979123456"),
+		Currency:      "USD",
+		DesiredAmount: decimal.RequireFromString("3.5"),
+		ActualAmount:  decimal.RequireFromString("3.5"),
+	}, transfer)
+
+	assert.False(t, mocks.HasUnused())
+	assert.Equal(t, 4, len(httpLogger.Logs))
+
+	// secret and access token should be redacted from logs
+	for _, l := range httpLogger.Logs {
+		assert.NotContains(t, l.Request, "sesame")
+		assert.NotContains(t, l.Request, "eyJhbGciOi")
+		assert.NotContains(t, l.Response, "eyJhbGciOi")
+	}
+	assert.Contains(t, httpLogger.Logs[3].Request, `"operatorId":173,"amount":3.5,"useLocalAmount":true,"customIdentifier":"1ae96956-4b34-433e-8d1a-f05fe6923d6d"`)
+}
+
+func TestServiceWithPendingTransfer(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token": {
+			httpx.NewMockResponse(200, nil, []byte(authResponse)),
+		},
+		"https://topups-sandbox.reloadly.com/operators/auto-detect/phone/250788123456/countries/RW": {
+			httpx.NewMockResponse(200, nil, []byte(fixedOperatorResponse)),
+		},
+		"https://topups-sandbox.reloadly.com/accounts/balance": {
+			httpx.NewMockResponse(200, nil, []byte(`{"balance": 100, "currencyCode": "EUR"}`)),
+		},
+		"https://topups-sandbox.reloadly.com/topups": {
+			httpx.NewMockResponse(200, nil, []byte(`{"transactionId": 4603, "status": "PENDING", "deliveredAmount": 0, "deliveredAmountCurrencyCode": "RWF"}`)),
+		},
+	})
+	httpx.SetRequestor(mocks)
+
+	svc := reloadly.NewService(http.DefaultClient, nil, "client123", "sesame", true)
+
+	httpLogger := &flows.HTTPLogger{}
+
+	transfer, err := svc.Transfer(urns.NilURN, urns.URN("tel:+250788123456"), map[string]decimal.Decimal{"RWF": decimal.RequireFromString("3000")}, httpLogger.Log)
+	assert.EqualError(t, err, "topup 4603 to operator 'MTN Rwanda' is PENDING and awaiting its final status")
+
+	// transaction ID is recorded against the topup request so the status webhook can find the transfer
+	require.Equal(t, 4, len(httpLogger.Logs))
+	external, found := models.AirtimeExternalTransfers.Take(httpLogger.Logs[3])
+	assert.True(t, found)
+	assert.Equal(t, models.ExternalAirtimeTransfer{ID: "4603", Pending: true}, external)
+
+	// fixed amount closest to what we wanted, and in our currency because operator doesn't support local amounts, but
+	// nothing delivered yet
+	assert.Equal(t, "RWF", transfer.Currency)
+	assert.Equal(t, decimal.RequireFromString("3000"), transfer.DesiredAmount)
+	assert.Equal(t, decimal.Zero, transfer.ActualAmount)
+	assert.False(t, mocks.HasUnused())
+}
+
+func TestServiceWithFailedTransfers(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://auth.reloadly.com/oauth/token": {
+			httpx.NewMockResponse(401, nil, []byte(`{"timeStamp": "2022-07-01", "message": "Access Denied", "errorCode": "INVALID_CREDENTIALS"}`)),
+			httpx.NewMockResponse(200, nil, []byte(authResponse)),
+			httpx.NewMockResponse(200, nil, []byte(authResponse)),
+			httpx.NewMockResponse(200, nil, []byte(authResponse)),
+		},
+		"https://topups.reloadly.com/operators/auto-detect/phone/593979123456/countries/EC": {
+			httpx.NewMockResponse(200, nil, []byte(rangeOperatorResponse)),
+			httpx.NewMockResponse(200, nil, []byte(rangeOperatorResponse)),
+			httpx.NewMockResponse(200, nil, []byte(rangeOperatorResponse)),
+		},
+		"https://topups.reloadly.com/accounts/balance": {
+			httpx.NewMockResponse(200, nil, []byte(`{"balance": 2.00, "currencyCode": "EUR"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"balance": 200.00, "currencyCode": "EUR"}`)),
+		},
+		"https://topups.reloadly.com/topups": {
+			httpx.NewMockResponse(200, nil, []byte(`{"transactionId": 4604, "status": "FAILED"}`)),
+		},
+	})
+	httpx.SetRequestor(mocks)
+
+	svc := reloadly.NewService(http.DefaultClient, nil, "client123", "sesame", false)
+	amounts := map[string]decimal.Decimal{"USD": decimal.RequireFromString("3.5")}
+
+	_, err := svc.Transfer(urns.NilURN, urns.URN("tel:+593979123456"), amounts, (&flows.HTTPLogger{}).Log)
+	assert.EqualError(t, err, "authentication failed: Access Denied")
+
+	// no amount in the operator's currency
+	_, err = svc.Transfer(urns.NilURN, urns.URN("tel:+593979123456"), map[string]decimal.Decimal{"RWF": decimal.RequireFromString("500")}, (&flows.HTTPLogger{}).Log)
+	assert.EqualError(t, err, "no amount configured for operator 'Claro Ecuador' currency USD")
+
+	_, err = svc.Transfer(urns.NilURN, urns.URN("tel:+593979123456"), amounts, (&flows.HTTPLogger{}).Log)
+	assert.EqualError(t, err, "insufficient balance of 2 EUR to send 3.89 EUR")
+
+	_, err = svc.Transfer(urns.NilURN, urns.URN("tel:+593979123456"), amounts, (&flows.HTTPLogger{}).Log)
+	assert.EqualError(t, err, "topup 4604 to operator 'Claro Ecuador' ended with status FAILED")
+
+	assert.False(t, mocks.HasUnused())
+}
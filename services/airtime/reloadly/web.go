@@ -0,0 +1,122 @@
+package reloadly
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/handler"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/bodies"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+func init() {
+	base := "/mr/airtime/types/reloadly"
+
+	web.RegisterJSONRoute(http.MethodPost, base+"/{org}/status", web.WithHTTPLogs(handleStatus))
+}
+
+// statusEvent is the webhook event Reloadly sends when a topup reaches its final status
+//
+//	{
+//	  "id": "d1c2a4b7-6a3e-4d0b-9f5b-6c2a1f3e9b20",
+//	  "type": "airtime_transaction.status",
+//	  "data": {
+//	    "transactionId": 4602,
+//	    "status": "SUCCESSFUL",
+//	    "customIdentifier": "1ae96956-4b34-433e-8d1a-f05fe6923d6d",
+//	    "recipientPhone": "593979123456",
+//	    "countryCode": "EC",
+//	    "deliveredAmount": 5,
+//	    "deliveredAmountCurrencyCode": "USD"
+//	  }
+//	}
+type statusEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data *Topup `json:"data"`
+}
+
+// see https://developers.reloadly.com/airtime/webhooks
+func verifySignature(r *http.Request, body []byte, secret string) bool {
+	timestamp := r.Header.Get("X-Reloadly-Request-Timestamp")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	mac.Write([]byte(":" + timestamp))
+	expectedMAC := hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(r.Header.Get("X-Reloadly-Signature")), []byte(expectedMAC))
+}
+
+func handleStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request, l *models.HTTPLogger) (interface{}, int, error) {
+	orgID, err := strconv.Atoi(chi.URLParam(r, "org"))
+	if err != nil {
+		return errors.New("invalid org id"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, models.OrgID(orgID))
+	if err != nil {
+		return errors.Wrapf(err, "error loading org assets"), http.StatusBadRequest, nil
+	}
+
+	body, err := bodies.Read(r)
+	if err != nil {
+		return errors.Wrapf(err, "error reading request body"), http.StatusBadRequest, nil
+	}
+
+	secret := oa.Org().ConfigValue(configWebhookSecret, "")
+	if secret == "" || !verifySignature(r, body, secret) {
+		return errors.New("request signature validation failed"), http.StatusForbidden, nil
+	}
+
+	event := &statusEvent{}
+	if err := jsonx.Unmarshal(body, event); err != nil || event.Data == nil {
+		return errors.New("invalid status event"), http.StatusBadRequest, nil
+	}
+
+	var status models.AirtimeTransferStatus
+	actualAmount := decimal.Zero
+
+	switch event.Data.Status {
+	case StatusSuccessful:
+		status = models.AirtimeTransferStatusSuccess
+		actualAmount = event.Data.DeliveredAmount
+	case StatusFailed, StatusRefunded:
+		status = models.AirtimeTransferStatusFailed
+	default:
+		// not a final status so nothing to do yet
+		return map[string]string{"status": "ignored"}, http.StatusOK, nil
+	}
+
+	transfer, err := models.UpdateAirtimeTransferByExternalID(ctx, rt.DB, oa.OrgID(), strconv.Itoa(event.Data.TransactionID), status, actualAmount)
+	if err != nil {
+		return nil, 0, err
+	}
+	if transfer == nil {
+		return map[string]string{"status": "ignored"}, http.StatusOK, nil
+	}
+
+	// let the session which made the transfer route on how it actually went
+	if transfer.SessionID != 0 {
+		rc := rt.RP.Get()
+		defer rc.Close()
+
+		task := handler.NewAirtimeStatusTask(oa.OrgID(), transfer.ContactID, transfer.SessionID, status, actualAmount, transfer.CreatedOn)
+		if err := handler.QueueHandleTask(rc, transfer.ContactID, task); err != nil {
+			return nil, 0, errors.Wrapf(err, "error queuing airtime status")
+		}
+	}
+
+	return map[string]string{"status": string(status)}, http.StatusOK, nil
+}
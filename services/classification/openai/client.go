@@ -0,0 +1,108 @@
+package openai
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/pkg/errors"
+)
+
+// DefaultBaseURL is the base URL of the OpenAI API, which is used unless a classifier is configured to use another
+// OpenAI compatible endpoint
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// Message is a message in a chat completion
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Usage is the number of tokens used by a request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// ChatRequest is the request body of a /chat/completions request
+type ChatRequest struct {
+	Model       string     `json:"model"`
+	Messages    []*Message `json:"messages"`
+	MaxTokens   int        `json:"max_tokens,omitempty"`
+	Temperature float64    `json:"temperature"`
+}
+
+// ChatResponse is the response from a /chat/completions request
+type ChatResponse struct {
+	Choices []struct {
+		Message *Message `json:"message"`
+	} `json:"choices"`
+	Usage Usage `json:"usage"`
+}
+
+// Content returns the content of the first choice or empty string if there isn't one
+func (r *ChatResponse) Content() string {
+	if len(r.Choices) > 0 && r.Choices[0].Message != nil {
+		return strings.TrimSpace(r.Choices[0].Message.Content)
+	}
+	return ""
+}
+
+// Client is a basic client for the chat completions API of OpenAI or any compatible LLM endpoint
+type Client struct {
+	httpClient   *http.Client
+	httpRetries  *httpx.RetryConfig
+	httpAccess   *httpx.AccessConfig
+	baseURL      string
+	apiKey       string
+	maxBodyBytes int
+}
+
+// NewClient creates a new client, responses larger than maxBodyBytes are treated as errors
+func NewClient(httpClient *http.Client, httpRetries *httpx.RetryConfig, httpAccess *httpx.AccessConfig, baseURL, apiKey string, maxBodyBytes int) *Client {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	return &Client{
+		httpClient:   httpClient,
+		httpRetries:  httpRetries,
+		httpAccess:   httpAccess,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		apiKey:       apiKey,
+		maxBodyBytes: maxBodyBytes,
+	}
+}
+
+// Chat gets a completion of the given messages
+func (c *Client) Chat(chat *ChatRequest) (*ChatResponse, *httpx.Trace, error) {
+	endpoint := fmt.Sprintf("%s/chat/completions", c.baseURL)
+	headers := map[string]string{
+		"Content-Type":  "application/json",
+		"Authorization": "Bearer " + c.apiKey,
+	}
+
+	request, err := httpx.NewRequest("POST", endpoint, bytes.NewReader(jsonx.MustMarshal(chat)), headers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trace, err := httpx.DoTrace(c.httpClient, request, c.httpRetries, c.httpAccess, c.maxBodyBytes)
+	if err != nil {
+		return nil, trace, err
+	}
+
+	if trace.Response != nil && trace.Response.StatusCode == 200 {
+		response := &ChatResponse{}
+		if err := jsonx.Unmarshal(trace.ResponseBody, response); err != nil {
+			return nil, trace, err
+		}
+		return response, trace, nil
+	}
+
+	return nil, trace, errors.New("LLM API request failed")
+}
@@ -0,0 +1,144 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// ModeClassify classifies input as one of the classifier's intents
+	ModeClassify = "classify"
+
+	// ModeGenerate generates text from input, with the text available in the classification as the "text" entity
+	ModeGenerate = "generate"
+
+	// GeneratedEntity is the entity which generated text is returned as
+	GeneratedEntity = "text"
+
+	// intent returned by the model when input doesn't match any intent
+	noIntent = "none"
+)
+
+const classifyPrompt = `Classify the user's message as one of the following intents: %s.
+
+Respond only with JSON of the form {"intent": "<intent>", "confidence": <number between 0 and 1>} and use "none" as the intent if the message doesn't match any of them.`
+
+var jsonObjectRegex = regexp.MustCompile(`(?s)\{.*\}`)
+
+// Options are the options of an LLM classifier
+type Options struct {
+	Model     string
+	Mode      string
+	Prompt    string
+	MaxTokens int
+}
+
+// a classification service implementation for OpenAI or any compatible LLM endpoint
+type service struct {
+	client     *Client
+	classifier *flows.Classifier
+	options    *Options
+	redactor   stringsx.Redactor
+}
+
+// NewService creates a new classification service
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, httpAccess *httpx.AccessConfig, classifier *flows.Classifier, baseURL, apiKey string, maxBodyBytes int, options *Options) flows.ClassificationService {
+	return &service{
+		client:     NewClient(httpClient, httpRetries, httpAccess, baseURL, apiKey, maxBodyBytes),
+		classifier: classifier,
+		options:    options,
+		redactor:   stringsx.NewRedactor(flows.RedactionMask, apiKey),
+	}
+}
+
+func (s *service) Classify(env envs.Environment, input string, logHTTP flows.HTTPLogCallback) (*flows.Classification, error) {
+	if s.options.Mode == ModeGenerate {
+		return s.generate(input, logHTTP)
+	}
+	return s.classify(input, logHTTP)
+}
+
+func (s *service) classify(input string, logHTTP flows.HTTPLogCallback) (*flows.Classification, error) {
+	intents := s.classifier.Intents()
+
+	response, err := s.chat([]*Message{
+		{Role: "system", Content: fmt.Sprintf(classifyPrompt, strings.Join(intents, ", "))},
+		{Role: "user", Content: input},
+	}, logHTTP)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &flows.Classification{
+		Intents:  []flows.ExtractedIntent{},
+		Entities: map[string][]flows.ExtractedEntity{},
+	}
+
+	// models don't always respond with just JSON so look for the object in whatever they did respond with
+	match := &struct {
+		Intent     string          `json:"intent"`
+		Confidence decimal.Decimal `json:"confidence"`
+	}{}
+	if err := jsonx.Unmarshal([]byte(jsonObjectRegex.FindString(response.Content())), match); err != nil {
+		return result, nil
+	}
+
+	// only accept intents the classifier actually has
+	for _, intent := range intents {
+		if match.Intent != noIntent && strings.EqualFold(match.Intent, intent) {
+			result.Intents = append(result.Intents, flows.ExtractedIntent{Name: intent, Confidence: match.Confidence})
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (s *service) generate(input string, logHTTP flows.HTTPLogCallback) (*flows.Classification, error) {
+	messages := make([]*Message, 0, 2)
+	if s.options.Prompt != "" {
+		messages = append(messages, &Message{Role: "system", Content: s.options.Prompt})
+	}
+	messages = append(messages, &Message{Role: "user", Content: input})
+
+	response, err := s.chat(messages, logHTTP)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &flows.Classification{
+		Intents:  []flows.ExtractedIntent{},
+		Entities: map[string][]flows.ExtractedEntity{},
+	}
+	if content := response.Content(); content != "" {
+		result.Entities[GeneratedEntity] = []flows.ExtractedEntity{{Value: content, Confidence: decimal.NewFromInt(1)}}
+	}
+
+	return result, nil
+}
+
+func (s *service) chat(messages []*Message, logHTTP flows.HTTPLogCallback) (*ChatResponse, error) {
+	response, trace, err := s.client.Chat(&ChatRequest{Model: s.options.Model, Messages: messages, MaxTokens: s.options.MaxTokens})
+	if trace != nil {
+		log := flows.NewHTTPLog(trace, flows.HTTPStatusFromCode, s.redactor)
+
+		// usage is taken from the decoded response as the logged response may be truncated
+		if response != nil && response.Usage.TotalTokens > 0 {
+			usages.Put(log, response.Usage.TotalTokens)
+		}
+
+		logHTTP(log)
+	}
+	return response, err
+}
+
+var _ flows.ClassificationService = (*service)(nil)
@@ -0,0 +1,121 @@
+package openai_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/services/classification/openai"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://api.openai.com/v1/chat/completions": {
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": "{\"intent\": \"book_flight\", \"confidence\": 0.92}"}}],
+				"usage": {"prompt_tokens": 60, "completion_tokens": 12, "total_tokens": 72}
+			}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": "Sure! {\"intent\": \"none\", \"confidence\": 0.8}"}}],
+				"usage": {"prompt_tokens": 55, "completion_tokens": 14, "total_tokens": 69}
+			}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": "I think you want a hotel"}}],
+				"usage": {"prompt_tokens": 55, "completion_tokens": 6, "total_tokens": 61}
+			}`)),
+			httpx.NewMockResponse(401, nil, []byte(`{"error": {"message": "Incorrect API key provided"}}`)),
+		},
+	}))
+
+	svc := openai.NewService(
+		http.DefaultClient,
+		nil,
+		nil,
+		test.NewClassifier("Booking", "openai", []string{"book_flight", "book_hotel"}),
+		"",
+		"sk-sesame",
+		1024,
+		&openai.Options{Model: "gpt-3.5-turbo", Mode: openai.ModeClassify, MaxTokens: 100},
+	)
+
+	env := envs.NewBuilder().Build()
+	httpLogger := &flows.HTTPLogger{}
+
+	classification, err := svc.Classify(env, "book flight to Quito", httpLogger.Log)
+	require.NoError(t, err)
+	assert.Equal(t, []flows.ExtractedIntent{{Name: "book_flight", Confidence: decimal.RequireFromString(`0.92`)}}, classification.Intents)
+	assert.Equal(t, map[string][]flows.ExtractedEntity{}, classification.Entities)
+
+	// key should be redacted from our HTTP logs and usage should be recorded for the call
+	require.Equal(t, 1, len(httpLogger.Logs))
+	assert.NotContains(t, httpLogger.Logs[0].Request, "sk-sesame")
+	assert.Contains(t, httpLogger.Logs[0].Request, `"model":"gpt-3.5-turbo"`)
+	assert.Equal(t, 72, openai.TakeUsage(httpLogger.Logs[0]))
+	assert.Equal(t, 0, openai.TakeUsage(httpLogger.Logs[0])) // can only be taken once
+
+	// no matching intent
+	classification, err = svc.Classify(env, "hi", httpLogger.Log)
+	require.NoError(t, err)
+	assert.Equal(t, []flows.ExtractedIntent{}, classification.Intents)
+
+	// response isn't JSON
+	classification, err = svc.Classify(env, "hotel please", httpLogger.Log)
+	require.NoError(t, err)
+	assert.Equal(t, []flows.ExtractedIntent{}, classification.Intents)
+
+	_, err = svc.Classify(env, "boom", httpLogger.Log)
+	assert.EqualError(t, err, "LLM API request failed")
+	assert.Equal(t, 4, len(httpLogger.Logs))
+	assert.Equal(t, 0, openai.TakeUsage(httpLogger.Logs[3]))
+}
+
+func TestGenerate(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://llm.example.com/v1/chat/completions": {
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"choices": [{"index": 0, "message": {"role": "assistant", "content": " Hola Bob, ¿cómo estás? "}}],
+				"usage": {"prompt_tokens": 20, "completion_tokens": 8, "total_tokens": 28}
+			}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "`+strings.Repeat("bla ", 200)+`"}}]}`)),
+		},
+	}))
+
+	svc := openai.NewService(
+		http.DefaultClient,
+		nil,
+		nil,
+		test.NewClassifier("Translator", "openai", []string{}),
+		"http://llm.example.com/v1/",
+		"sk-sesame",
+		500,
+		&openai.Options{Model: "llama-3", Mode: openai.ModeGenerate, Prompt: "Translate to Spanish"},
+	)
+
+	env := envs.NewBuilder().Build()
+	httpLogger := &flows.HTTPLogger{}
+
+	classification, err := svc.Classify(env, "Hi Bob, how are you?", httpLogger.Log)
+	require.NoError(t, err)
+	assert.Equal(t, []flows.ExtractedIntent{}, classification.Intents)
+	assert.Equal(t, map[string][]flows.ExtractedEntity{
+		"text": {{Value: "Hola Bob, ¿cómo estás?", Confidence: decimal.RequireFromString(`1`)}},
+	}, classification.Entities)
+	assert.Contains(t, httpLogger.Logs[0].Request, `{"role":"system","content":"Translate to Spanish"}`)
+	assert.Equal(t, 28, openai.TakeUsage(httpLogger.Logs[0]))
+
+	// response too big
+	_, err = svc.Classify(env, "Hi", httpLogger.Log)
+	assert.EqualError(t, err, "webhook response body exceeds 500 bytes limit")
+}
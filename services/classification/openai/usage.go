@@ -0,0 +1,16 @@
+package openai
+
+import (
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/utils/httplogs"
+)
+
+// the number of tokens used by each call, decoded from its response
+var usages = httplogs.NewStore[int]()
+
+// TakeUsage returns the number of tokens used by the call with the given HTTP log, or zero if it wasn't a successful
+// call to an LLM classifier. Usage can only be taken once.
+func TakeUsage(log *flows.HTTPLog) int {
+	tokens, _ := usages.Take(log)
+	return tokens
+}
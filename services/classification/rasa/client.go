@@ -0,0 +1,88 @@
+package rasa
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// IntentMatch is a possible intent match
+type IntentMatch struct {
+	Name       string          `json:"name"`
+	Confidence decimal.Decimal `json:"confidence"`
+}
+
+// EntityMatch is an extracted entity
+type EntityMatch struct {
+	Entity     string          `json:"entity"`
+	Value      interface{}     `json:"value"`
+	Confidence decimal.Decimal `json:"confidence_entity"`
+	Extractor  string          `json:"extractor"`
+}
+
+// ParseResponse is the response from a /model/parse request
+type ParseResponse struct {
+	Text          string         `json:"text"`
+	Intent        *IntentMatch   `json:"intent"`
+	IntentRanking []*IntentMatch `json:"intent_ranking"`
+	Entities      []*EntityMatch `json:"entities"`
+}
+
+// Client is a basic client for the REST API of a Rasa server
+type Client struct {
+	httpClient  *http.Client
+	httpRetries *httpx.RetryConfig
+	httpAccess  *httpx.AccessConfig
+	endpoint    string
+	token       string
+}
+
+// NewClient creates a new client for the Rasa server at the given endpoint, token is optional and only needed if the
+// server has token authentication enabled
+func NewClient(httpClient *http.Client, httpRetries *httpx.RetryConfig, httpAccess *httpx.AccessConfig, endpoint, token string) *Client {
+	return &Client{
+		httpClient:  httpClient,
+		httpRetries: httpRetries,
+		httpAccess:  httpAccess,
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		token:       token,
+	}
+}
+
+// Parse gets the intents and entities of a message
+func (c *Client) Parse(text string) (*ParseResponse, *httpx.Trace, error) {
+	endpoint := fmt.Sprintf("%s/model/parse", c.endpoint)
+	if c.token != "" {
+		endpoint += "?token=" + url.QueryEscape(c.token)
+	}
+
+	body := jsonx.MustMarshal(map[string]string{"text": text})
+
+	request, err := httpx.NewRequest("POST", endpoint, bytes.NewReader(body), map[string]string{"Content-Type": "application/json"})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trace, err := httpx.DoTrace(c.httpClient, request, c.httpRetries, c.httpAccess, -1)
+	if err != nil {
+		return nil, trace, err
+	}
+
+	if trace.Response != nil && trace.Response.StatusCode == 200 {
+		response := &ParseResponse{}
+		if err := utils.UnmarshalAndValidate(trace.ResponseBody, response); err != nil {
+			return nil, trace, err
+		}
+		return response, trace, nil
+	}
+
+	return nil, trace, errors.New("Rasa API request failed")
+}
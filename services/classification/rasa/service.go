@@ -0,0 +1,67 @@
+package rasa
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/stringsx"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+)
+
+// a classification service implementation for a self-hosted Rasa server
+type service struct {
+	client     *Client
+	classifier *flows.Classifier
+	redactor   stringsx.Redactor
+}
+
+// NewService creates a new classification service
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, httpAccess *httpx.AccessConfig, classifier *flows.Classifier, endpoint, token string) flows.ClassificationService {
+	redactValues := []string{}
+	if token != "" {
+		redactValues = append(redactValues, token)
+	}
+
+	return &service{
+		client:     NewClient(httpClient, httpRetries, httpAccess, endpoint, token),
+		classifier: classifier,
+		redactor:   stringsx.NewRedactor(flows.RedactionMask, redactValues...),
+	}
+}
+
+func (s *service) Classify(env envs.Environment, input string, logHTTP flows.HTTPLogCallback) (*flows.Classification, error) {
+	response, trace, err := s.client.Parse(input)
+	if trace != nil {
+		logHTTP(flows.NewHTTPLog(trace, flows.HTTPStatusFromCode, s.redactor))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &flows.Classification{
+		Intents:  make([]flows.ExtractedIntent, 0, len(response.IntentRanking)),
+		Entities: make(map[string][]flows.ExtractedEntity),
+	}
+
+	// ranking includes the top intent but isn't provided by all pipelines
+	if len(response.IntentRanking) > 0 {
+		for _, intent := range response.IntentRanking {
+			result.Intents = append(result.Intents, flows.ExtractedIntent{Name: intent.Name, Confidence: intent.Confidence})
+		}
+	} else if response.Intent != nil && response.Intent.Name != "" {
+		result.Intents = append(result.Intents, flows.ExtractedIntent{Name: response.Intent.Name, Confidence: response.Intent.Confidence})
+	}
+
+	for _, entity := range response.Entities {
+		result.Entities[entity.Entity] = append(result.Entities[entity.Entity], flows.ExtractedEntity{
+			Value:      fmt.Sprint(entity.Value),
+			Confidence: entity.Confidence,
+		})
+	}
+
+	return result, nil
+}
+
+var _ flows.ClassificationService = (*service)(nil)
@@ -0,0 +1,87 @@
+package rasa_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/test"
+	"github.com/nyaruka/mailroom/services/classification/rasa"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"http://rasa.example.com:5005/model/parse?token=sesame": {
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"text": "book flight to Quito",
+				"intent": {"id": 1234, "name": "book_flight", "confidence": 0.9024},
+				"entities": [
+					{"entity": "destination", "start": 15, "end": 20, "confidence_entity": 0.9648, "value": "Quito", "extractor": "DIETClassifier"},
+					{"entity": "destination", "start": 24, "end": 28, "confidence_entity": 0.6123, "value": "Lima", "extractor": "DIETClassifier"},
+					{"entity": "passengers", "start": 30, "end": 31, "confidence_entity": 0.8, "value": 2, "extractor": "DIETClassifier"}
+				],
+				"intent_ranking": [
+					{"id": 1234, "name": "book_flight", "confidence": 0.9024},
+					{"id": 5678, "name": "book_hotel", "confidence": 0.0976}
+				]
+			}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"text": "hi",
+				"intent": {"name": "greet", "confidence": 0.75},
+				"entities": []
+			}`)),
+			httpx.NewMockResponse(500, nil, []byte(`{"version": "3.3.0", "status": "failure", "message": "boom"}`)),
+		},
+	}))
+
+	svc := rasa.NewService(
+		http.DefaultClient,
+		nil,
+		nil,
+		test.NewClassifier("Booking", "rasa", []string{"book_flight", "book_hotel", "greet"}),
+		"http://rasa.example.com:5005/",
+		"sesame",
+	)
+
+	env := envs.NewBuilder().Build()
+	httpLogger := &flows.HTTPLogger{}
+
+	classification, err := svc.Classify(env, "book flight to Quito", httpLogger.Log)
+	require.NoError(t, err)
+	assert.Equal(t, []flows.ExtractedIntent{
+		{Name: "book_flight", Confidence: decimal.RequireFromString(`0.9024`)},
+		{Name: "book_hotel", Confidence: decimal.RequireFromString(`0.0976`)},
+	}, classification.Intents)
+	assert.Equal(t, map[string][]flows.ExtractedEntity{
+		"destination": {
+			{Value: "Quito", Confidence: decimal.RequireFromString(`0.9648`)},
+			{Value: "Lima", Confidence: decimal.RequireFromString(`0.6123`)},
+		},
+		"passengers": {
+			{Value: "2", Confidence: decimal.RequireFromString(`0.8`)},
+		},
+	}, classification.Entities)
+
+	// token should be redacted from our HTTP logs
+	require.Equal(t, 1, len(httpLogger.Logs))
+	assert.Equal(t, "http://rasa.example.com:5005/model/parse?token=****************", httpLogger.Logs[0].URL)
+	assert.NotContains(t, httpLogger.Logs[0].Request, "sesame")
+
+	// pipelines without intent ranking just give us the top intent
+	classification, err = svc.Classify(env, "hi", httpLogger.Log)
+	require.NoError(t, err)
+	assert.Equal(t, []flows.ExtractedIntent{{Name: "greet", Confidence: decimal.RequireFromString(`0.75`)}}, classification.Intents)
+	assert.Equal(t, map[string][]flows.ExtractedEntity{}, classification.Entities)
+
+	_, err = svc.Classify(env, "boom", httpLogger.Log)
+	assert.EqualError(t, err, "Rasa API request failed")
+	assert.Equal(t, 3, len(httpLogger.Logs))
+}
@@ -28,11 +28,18 @@ type Redirect struct {
 }
 
 type Dial struct {
-	XMLName   string `xml:"Dial"`
-	Number    string `xml:",chardata"`
-	Action    string `xml:"action,attr"`
-	Timeout   int    `xml:"timeout,attr,omitempty"`
-	TimeLimit int    `xml:"timeLimit,attr,omitempty"`
+	XMLName    string      `xml:"Dial"`
+	Number     string      `xml:",chardata"`
+	Action     string      `xml:"action,attr,omitempty"`
+	Timeout    int         `xml:"timeout,attr,omitempty"`
+	TimeLimit  int         `xml:"timeLimit,attr,omitempty"`
+	Conference *Conference `xml:"Conference"`
+}
+
+type Conference struct {
+	XMLName             string `xml:"Conference"`
+	Name                string `xml:",chardata"`
+	EndConferenceOnExit bool   `xml:"endConferenceOnExit,attr,omitempty"`
 }
 
 type Gather struct {
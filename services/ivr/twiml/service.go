@@ -16,6 +16,7 @@ import (
 
 	"github.com/nyaruka/gocommon/httpx"
 	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/goflow/flows/events"
@@ -31,6 +32,17 @@ import (
 // IgnoreSignatures controls whether we ignore signatures (public for testing overriding)
 var IgnoreSignatures = false
 
+// the features supported by each type of channel, generic TwiML endpoints can't be assumed to support answering
+// machine detection which is a Twilio extension
+var channelCapabilities = map[models.ChannelType]ivr.Capabilities{
+	twilioChannelType:     {Dial: true, Record: true, MachineDetection: true},
+	twimlChannelType:      {Dial: true, Record: true, MachineDetection: false},
+	signalWireChannelType: {Dial: true, Record: true, MachineDetection: true},
+}
+
+// call statuses which mean a dial leg has ended
+var legEndedStatuses = map[string]bool{"completed": true, "busy": true, "no-answer": true, "canceled": true, "failed": true}
+
 var dialStatusMap = map[string]flows.DialStatus{
 	"completed": flows.DialStatusAnswered,
 	"answered":  flows.DialStatusAnswered,
@@ -60,6 +72,9 @@ const (
 
 	sendURLConfig = "send_url"
 	baseURLConfig = "base_url"
+
+	// whether dials are made by putting the call in a conference which the dialed number joins
+	conferenceDialConfig = "conference_dial"
 )
 
 // https://www.twilio.com/docs/voice/twiml/say
@@ -93,12 +108,14 @@ var supportedSayLanguages = utils.StringSet([]string{
 })
 
 type service struct {
-	httpClient   *http.Client
-	channel      *models.Channel
-	baseURL      string
-	accountSID   string
-	authToken    string
-	validateSigs bool
+	httpClient     *http.Client
+	channel        *models.Channel
+	baseURL        string
+	accountSID     string
+	authToken      string
+	validateSigs   bool
+	capabilities   ivr.Capabilities
+	conferenceDial bool
 }
 
 func init() {
@@ -117,27 +134,35 @@ func NewServiceFromChannel(httpClient *http.Client, channel *models.Channel) (iv
 	baseURL := channel.ConfigValue(baseURLConfig, channel.ConfigValue(sendURLConfig, BaseURL))
 
 	return &service{
-		httpClient:   httpClient,
-		channel:      channel,
-		baseURL:      baseURL,
-		accountSID:   accountSID,
-		authToken:    authToken,
-		validateSigs: channel.Type() != signalWireChannelType,
+		httpClient:     httpClient,
+		channel:        channel,
+		baseURL:        baseURL,
+		accountSID:     accountSID,
+		authToken:      authToken,
+		validateSigs:   channel.Type() != signalWireChannelType,
+		capabilities:   channelCapabilities[channel.Type()],
+		conferenceDial: channel.ConfigValue(conferenceDialConfig, "") == "true",
 	}, nil
 }
 
 // NewService creates a new Twilio IVR service for the passed in account and and auth token
 func NewService(httpClient *http.Client, accountSID string, authToken string) ivr.Service {
 	return &service{
-		httpClient: httpClient,
-		baseURL:    BaseURL,
-		accountSID: accountSID,
-		authToken:  authToken,
+		httpClient:   httpClient,
+		baseURL:      BaseURL,
+		accountSID:   accountSID,
+		authToken:    authToken,
+		capabilities: channelCapabilities[twilioChannelType],
 	}
 }
 
+// Capabilities returns the features supported by this service
+func (s *service) Capabilities() ivr.Capabilities {
+	return s.capabilities
+}
+
 func (s *service) DownloadMedia(url string) (*http.Response, error) {
-	return http.Get(url)
+	return s.httpClient.Get(url)
 }
 
 func (s *service) CheckStartRequest(r *http.Request) models.CallError {
@@ -150,7 +175,58 @@ func (s *service) CheckStartRequest(r *http.Request) models.CallError {
 }
 
 func (s *service) PreprocessStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request) ([]byte, error) {
-	return nil, nil
+	// only channels which dial by conference have dial legs whose statuses we need to intercept
+	if !s.conferenceDial {
+		return nil, nil
+	}
+
+	r.ParseForm()
+	legSID := r.Form.Get("CallSid")
+	twStatus := r.Form.Get("CallStatus")
+	if legSID == "" || twStatus == "" {
+		return nil, nil
+	}
+
+	status := dialStatusMap[twStatus]
+	if twStatus == "in-progress" {
+		status = flows.DialStatusAnswered
+	}
+	duration, _ := strconv.Atoi(r.Form.Get("CallDuration"))
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	leg, err := ivr.UpdateDialLeg(rc, legSID, status, legEndedStatuses[twStatus], duration)
+	if err != nil {
+		return nil, err
+	}
+
+	// not a dial leg, move on
+	if leg == nil {
+		return nil, nil
+	}
+
+	// the leg has ended so redirect the original call out of the conference and back to our handle with the dial wait type
+	if leg.Ended {
+		form := url.Values{}
+		form.Set("Url", leg.ResumeURL)
+		form.Set("Method", http.MethodPost)
+
+		sendURL := s.baseURL + strings.Replace(hangupPath, "{AccountSID}", s.accountSID, -1)
+		sendURL = strings.Replace(sendURL, "{SID}", leg.CallID, -1)
+
+		trace, err := s.postRequest(sendURL, form)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reconnecting flow for call: %s", leg.CallID)
+		}
+		if trace.Response.StatusCode != 200 {
+			return nil, errors.Errorf("error reconnecting flow for call: %s, received %d from Twilio", leg.CallID, trace.Response.StatusCode)
+		}
+
+		return emptyResponseBody(fmt.Sprintf("reconnected call: %s to flow with dial status: %s", leg.CallID, leg.Status)), nil
+	}
+
+	return emptyResponseBody(fmt.Sprintf("updated status for call: %s to: %s", leg.CallID, leg.Status)), nil
 }
 
 func (s *service) PreprocessResume(ctx context.Context, rt *runtime.Runtime, call *models.Call, r *http.Request) ([]byte, error) {
@@ -180,8 +256,9 @@ func (s *service) URNForRequest(r *http.Request) (urns.URN, error) {
 
 // CallResponse is our struct for a Twilio call response
 type CallResponse struct {
-	SID    string `json:"sid" validate:"required"`
-	Status string `json:"status"`
+	SID      string `json:"sid" validate:"required"`
+	Status   string `json:"status"`
+	Duration string `json:"duration"`
 }
 
 // RequestCall causes this client to request a new outgoing call for this provider
@@ -239,12 +316,40 @@ func (s *service) HangupCall(callID string) (*httpx.Trace, error) {
 	return trace, nil
 }
 
+// GetCallStatus asks Twilio for the current status of the call that is passed in
+func (s *service) GetCallStatus(callID string) (models.CallStatus, models.CallError, int, *httpx.Trace, error) {
+	sendURL := s.baseURL + strings.Replace(hangupPath, "{AccountSID}", s.accountSID, -1)
+	sendURL = strings.Replace(sendURL, "{SID}", callID, -1)
+
+	req, _ := http.NewRequest(http.MethodGet, sendURL, nil)
+	req.SetBasicAuth(s.accountSID, s.authToken)
+	req.Header.Set("Accept", "application/json")
+
+	trace, err := httpx.DoTrace(s.httpClient, req, nil, nil, -1)
+	if err != nil {
+		return "", "", 0, trace, errors.Wrapf(err, "error trying to fetch call status")
+	}
+
+	if trace.Response.StatusCode != 200 {
+		return "", "", 0, trace, errors.Errorf("received non 200 status for call status: %d", trace.Response.StatusCode)
+	}
+
+	call := &CallResponse{}
+	if err := utils.UnmarshalAndValidate(trace.ResponseBody, call); err != nil {
+		return "", "", 0, trace, errors.Wrap(err, "unable parse Twilio response")
+	}
+
+	duration, _ := strconv.Atoi(call.Duration)
+	status, errorReason, duration := callStatus(call.Status, duration)
+	return status, errorReason, duration, trace, nil
+}
+
 // InputForRequest returns the input for the passed in request, if any
 func (s *service) ResumeForRequest(r *http.Request) (ivr.Resume, error) {
-	// this could be a timeout, in which case we return an empty input
+	// this could be a timeout
 	timeout := r.Form.Get("timeout")
 	if timeout == "true" {
-		return ivr.InputResume{}, nil
+		return ivr.TimeoutResume{}, nil
 	}
 
 	// this could be empty, in which case we return an empty input
@@ -267,6 +372,12 @@ func (s *service) ResumeForRequest(r *http.Request) (ivr.Resume, error) {
 		return ivr.InputResume{Attachment: utils.Attachment("audio/mp3:" + url + ".mp3")}, nil
 
 	case "dial":
+		// dials by conference are resumed with the status of the dialed leg
+		if dialStatus := r.Form.Get("dial_status"); dialStatus != "" {
+			duration, _ := strconv.Atoi(r.Form.Get("dial_duration"))
+			return ivr.DialResume{Status: flows.DialStatus(dialStatus), Duration: duration}, nil
+		}
+
 		twStatus := r.Form.Get("DialCallStatus")
 		status := dialStatusMap[twStatus]
 		if status == "" {
@@ -292,7 +403,12 @@ func (s *service) ResumeForRequest(r *http.Request) (ivr.Resume, error) {
 // StatusForRequest returns the call status for the passed in request, and if it's an error the reason,
 // and if available, the current call duration
 func (s *service) StatusForRequest(r *http.Request) (models.CallStatus, models.CallError, int) {
-	status := r.Form.Get("CallStatus")
+	duration, _ := strconv.Atoi(r.Form.Get("CallDuration"))
+	return callStatus(r.Form.Get("CallStatus"), duration)
+}
+
+// converts a Twilio call status to our call status, and if it's an error the reason
+func callStatus(status string, duration int) (models.CallStatus, models.CallError, int) {
 	switch status {
 
 	case "queued", "ringing":
@@ -300,7 +416,6 @@ func (s *service) StatusForRequest(r *http.Request) (models.CallStatus, models.C
 	case "in-progress", "initiated":
 		return models.CallStatusInProgress, "", 0
 	case "completed":
-		duration, _ := strconv.Atoi(r.Form.Get("CallDuration"))
 		return models.CallStatusCompleted, "", duration
 
 	case "busy":
@@ -311,7 +426,7 @@ func (s *service) StatusForRequest(r *http.Request) (models.CallStatus, models.C
 		return models.CallStatusErrored, models.CallErrorProvider, 0
 
 	default:
-		logrus.WithField("call_status", status).Error("unknown call status in status callback")
+		logrus.WithField("call_status", status).Error("unknown call status")
 		return models.CallStatusFailed, models.CallErrorProvider, 0
 	}
 }
@@ -363,8 +478,22 @@ func (s *service) WriteSessionResponse(ctx context.Context, rt *runtime.Runtime,
 		return errors.Errorf("cannot write IVR response for session with no sprint")
 	}
 
+	// if we dial by conference, start the call to the dialed number which will join it
+	conference := ""
+	if s.conferenceDial && s.capabilities.Dial {
+		for _, e := range sprint.Events() {
+			if wait, isDial := e.(*events.DialWaitEvent); isDial {
+				conference = string(uuids.New())
+
+				if err := s.startDialLeg(rt, channel, call, wait, conference, resumeURL); err != nil {
+					return errors.Wrap(err, "unable to start dial")
+				}
+			}
+		}
+	}
+
 	// get our response
-	response, err := ResponseForSprint(rt.Config, number, resumeURL, sprint.Events(), true)
+	response, err := ResponseForSprint(rt.Config, s.capabilities, conference, number, resumeURL, sprint.Events(), true)
 	if err != nil {
 		return errors.Wrap(err, "unable to build response for IVR call")
 	}
@@ -401,6 +530,11 @@ func (s *service) WriteEmptyResponse(w http.ResponseWriter, msg string) error {
 	})
 }
 
+func emptyResponseBody(msg string) []byte {
+	marshalled, _ := xml.Marshal(&Response{Message: strings.Replace(msg, "--", "__", -1)})
+	return append([]byte(xml.Header), marshalled...)
+}
+
 func (s *service) writeResponse(w http.ResponseWriter, resp *Response) error {
 	marshalled, err := xml.Marshal(resp)
 	if err != nil {
@@ -452,7 +586,48 @@ func twCalculateSignature(url string, form url.Values, authToken string) ([]byte
 
 // TWIML building utilities
 
-func ResponseForSprint(cfg *runtime.Config, urn urns.URN, resumeURL string, es []flows.Event, indent bool) (string, error) {
+// starts a call to the number of the given dial wait which joins the given conference, and tracks it as a leg of the dial
+func (s *service) startDialLeg(rt *runtime.Runtime, channel *models.Channel, call *models.Call, wait *events.DialWaitEvent, conference, resumeURL string) error {
+	legTwiML, _ := xml.Marshal(&Response{Commands: []interface{}{Dial{Conference: &Conference{Name: conference}}}})
+
+	form := url.Values{}
+	form.Set("To", wait.URN.Path())
+	form.Set("From", channel.Address())
+	form.Set("Twiml", string(legTwiML))
+	form.Set("StatusCallback", ivr.StatusURL(rt, channel))
+	if wait.DialLimitSeconds > 0 {
+		form.Set("Timeout", strconv.Itoa(wait.DialLimitSeconds))
+	}
+	if wait.CallLimitSeconds > 0 {
+		form.Set("TimeLimit", strconv.Itoa(wait.CallLimitSeconds))
+	}
+
+	sendURL := s.baseURL + strings.Replace(callPath, "{AccountSID}", s.accountSID, -1)
+
+	trace, err := s.postRequest(sendURL, form)
+	logrus.WithField("trace", trace).Debug("initiated new call for dial")
+	if err != nil {
+		return errors.Wrapf(err, "error trying to start call")
+	}
+
+	if trace.Response.StatusCode != 201 {
+		return errors.Errorf("received non 201 status for call start: %d", trace.Response.StatusCode)
+	}
+
+	leg := &CallResponse{}
+	if err := utils.UnmarshalAndValidate(trace.ResponseBody, leg); err != nil {
+		return errors.Wrap(err, "unable parse Twilio response")
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	return ivr.TrackDialLeg(rc, leg.SID, call.ExternalID(), resumeURL+"&wait_type=dial")
+}
+
+// ResponseForSprint builds the TwiML response for the given sprint events, with dial waits joining the given conference if
+// there is one rather than dialing directly
+func ResponseForSprint(cfg *runtime.Config, caps ivr.Capabilities, conference string, urn urns.URN, resumeURL string, es []flows.Event, indent bool) (string, error) {
 	r := &Response{}
 	commands := make([]interface{}, 0)
 	hasWait := false
@@ -488,6 +663,9 @@ func ResponseForSprint(cfg *runtime.Config, urn urns.URN, resumeURL string, es [
 					Commands: commands,
 					Timeout:  gatherTimeout,
 				}
+				if event.TimeoutSeconds != nil {
+					gather.Timeout = *event.TimeoutSeconds
+				}
 				if hint.Count != nil {
 					gather.NumDigits = *hint.Count
 				}
@@ -497,7 +675,10 @@ func ResponseForSprint(cfg *runtime.Config, urn urns.URN, resumeURL string, es [
 
 			case *hints.AudioHint:
 				resumeURL = resumeURL + "&wait_type=record"
-				commands = append(commands, Record{Action: resumeURL, MaxLength: recordTimeout})
+				if caps.Record {
+					commands = append(commands, Record{Action: resumeURL, MaxLength: recordTimeout})
+				}
+				// if recording isn't supported, resume straight away as if nothing was recorded
 				commands = append(commands, Redirect{URL: resumeURL + "&empty=true"})
 				r.Commands = commands
 
@@ -507,8 +688,16 @@ func ResponseForSprint(cfg *runtime.Config, urn urns.URN, resumeURL string, es [
 
 		case *events.DialWaitEvent:
 			hasWait = true
-			dial := Dial{Action: resumeURL + "&wait_type=dial", Number: event.URN.Path(), Timeout: event.DialLimitSeconds, TimeLimit: event.CallLimitSeconds}
-			commands = append(commands, dial)
+			if caps.Dial && conference != "" {
+				// join the conference which the dialed number will also join, until we're redirected out of it when that call ends
+				commands = append(commands, Dial{Conference: &Conference{Name: conference, EndConferenceOnExit: true}})
+			} else if caps.Dial {
+				dial := Dial{Action: resumeURL + "&wait_type=dial", Number: event.URN.Path(), Timeout: event.DialLimitSeconds, TimeLimit: event.CallLimitSeconds}
+				commands = append(commands, dial)
+			} else {
+				// if dialing isn't supported, resume straight away as if the dial failed
+				commands = append(commands, Redirect{URL: resumeURL + "&wait_type=dial&DialCallStatus=failed"})
+			}
 			r.Commands = commands
 		}
 	}
@@ -27,6 +27,7 @@ func TestResponseForSprint(t *testing.T) {
 	urn := urns.URN("tel:+12067799294")
 	expiresOn := time.Now().Add(time.Hour)
 	channelRef := assets.NewChannelReference(assets.ChannelUUID(uuids.New()), "Twilio Channel")
+	timeout := 10
 
 	resumeURL := "http://temba.io/resume?session=1"
 
@@ -82,6 +83,14 @@ func TestResponseForSprint(t *testing.T) {
 			},
 			expected: `<Response><Gather numDigits="1" timeout="30" action="http://temba.io/resume?session=1&amp;wait_type=gather"><Say>enter a number</Say></Gather><Redirect>http://temba.io/resume?session=1&amp;wait_type=gather&amp;timeout=true</Redirect></Response>`,
 		},
+		{
+			// ivr msg followed by wait for digits with a timeout
+			events: []flows.Event{
+				events.NewIVRCreated(flows.NewIVRMsgOut(urn, channelRef, "enter a number", "", "")),
+				events.NewMsgWait(&timeout, nil, hints.NewFixedDigitsHint(1)),
+			},
+			expected: `<Response><Gather numDigits="1" timeout="10" action="http://temba.io/resume?session=1&amp;wait_type=gather"><Say>enter a number</Say></Gather><Redirect>http://temba.io/resume?session=1&amp;wait_type=gather&amp;timeout=true</Redirect></Response>`,
+		},
 		{
 			// ivr msg followed by wait for terminated digits
 			events: []flows.Event{
@@ -107,11 +116,34 @@ func TestResponseForSprint(t *testing.T) {
 		},
 	}
 
+	allCaps := ivr.Capabilities{Dial: true, Record: true, MachineDetection: true}
+
 	for i, tc := range tcs {
-		response, err := twiml.ResponseForSprint(rt.Config, urn, resumeURL, tc.events, false)
+		response, err := twiml.ResponseForSprint(rt.Config, allCaps, "", urn, resumeURL, tc.events, false)
 		assert.NoError(t, err, "%d: unexpected error")
 		assert.Equal(t, xml.Header+tc.expected, response, "%d: unexpected response", i)
 	}
+
+	// a dial by conference joins the conference instead of dialing directly
+	response, err := twiml.ResponseForSprint(rt.Config, allCaps, "8bcb9ef2-d4a6-4314-b68d-6d299761ea9e", urn, resumeURL, []flows.Event{
+		events.NewDialWait(urns.URN(`tel:+1234567890`), 60, 7200, &expiresOn),
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, xml.Header+`<Response><Dial><Conference endConferenceOnExit="true">8bcb9ef2-d4a6-4314-b68d-6d299761ea9e</Conference></Dial></Response>`, response)
+
+	// a service which can't record or dial resumes immediately instead
+	response, err = twiml.ResponseForSprint(rt.Config, ivr.Capabilities{}, "", urn, resumeURL, []flows.Event{
+		events.NewIVRCreated(flows.NewIVRMsgOut(urn, channelRef, "say something", "", "")),
+		events.NewMsgWait(nil, nil, hints.NewAudioHint()),
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, xml.Header+`<Response><Say>say something</Say><Redirect>http://temba.io/resume?session=1&amp;wait_type=record&amp;empty=true</Redirect></Response>`, response)
+
+	response, err = twiml.ResponseForSprint(rt.Config, ivr.Capabilities{}, "", urn, resumeURL, []flows.Event{
+		events.NewDialWait(urns.URN(`tel:+1234567890`), 60, 7200, &expiresOn),
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, xml.Header+`<Response><Redirect>http://temba.io/resume?session=1&amp;wait_type=dial&amp;DialCallStatus=failed</Redirect></Response>`, response)
 }
 
 func TestURNForRequest(t *testing.T) {
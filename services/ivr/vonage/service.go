@@ -30,8 +30,10 @@ import (
 	"github.com/nyaruka/goflow/flows/routers/waits/hints"
 	"github.com/nyaruka/goflow/utils"
 	"github.com/nyaruka/mailroom/core/ivr"
+	"github.com/nyaruka/mailroom/core/ivr/state"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/bodies"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -64,11 +66,12 @@ const (
 var indentMarshal = true
 
 type service struct {
-	httpClient *http.Client
-	channel    *models.Channel
-	callURL    string
-	appID      string
-	privateKey *rsa.PrivateKey
+	httpClient   *http.Client
+	channel      *models.Channel
+	callURL      string
+	appID        string
+	privateKey   *rsa.PrivateKey
+	capabilities ivr.Capabilities
 }
 
 func init() {
@@ -89,28 +92,22 @@ func NewServiceFromChannel(httpClient *http.Client, channel *models.Channel) (iv
 	}
 
 	return &service{
-		httpClient: httpClient,
-		channel:    channel,
-		callURL:    CallURL,
-		appID:      appID,
-		privateKey: privateKey,
+		httpClient:   httpClient,
+		channel:      channel,
+		callURL:      CallURL,
+		appID:        appID,
+		privateKey:   privateKey,
+		capabilities: ivr.Capabilities{Dial: true, Record: true, MachineDetection: true},
 	}, nil
 }
 
-func readBody(r *http.Request) ([]byte, error) {
-	if r.Body == http.NoBody {
-		return nil, nil
-	}
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		return nil, nil
-	}
-	r.Body = io.NopCloser(bytes.NewBuffer(body))
-	return body, nil
+// Capabilities returns the features supported by this service
+func (s *service) Capabilities() ivr.Capabilities {
+	return s.capabilities
 }
 
 func (s *service) CallIDForRequest(r *http.Request) (string, error) {
-	body, err := readBody(r)
+	body, err := bodies.Read(r)
 	if err != nil {
 		return "", errors.Wrapf(err, "error reading body from request")
 	}
@@ -127,7 +124,7 @@ func (s *service) CallIDForRequest(r *http.Request) (string, error) {
 
 func (s *service) URNForRequest(r *http.Request) (urns.URN, error) {
 	// get our recording url out
-	body, err := readBody(r)
+	body, err := bodies.Read(r)
 	if err != nil {
 		return "", errors.Wrapf(err, "error reading body from request")
 	}
@@ -163,7 +160,7 @@ func (s *service) DownloadMedia(url string) (*http.Response, error) {
 	}
 
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	return http.DefaultClient.Do(req)
+	return s.httpClient.Do(req)
 }
 
 func (s *service) CheckStartRequest(r *http.Request) models.CallError {
@@ -173,7 +170,7 @@ func (s *service) CheckStartRequest(r *http.Request) models.CallError {
 func (s *service) PreprocessStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request) ([]byte, error) {
 	// parse out the call status, we are looking for a leg of one of our conferences ending in the "forward" case
 	// get our recording url out
-	body, _ := readBody(r)
+	body, _ := bodies.Read(r)
 	if len(body) == 0 {
 		return nil, nil
 	}
@@ -199,47 +196,28 @@ func (s *service) PreprocessStatus(ctx context.Context, rt *runtime.Runtime, r *
 		return nil, nil
 	}
 
-	// look up to see whether this is a call we need to track
+	// look up to see whether this is a leg of a dial we are tracking, recording its status if so
 	rc := rt.RP.Get()
 	defer rc.Close()
 
-	redisKey := fmt.Sprintf("dial_%s", legUUID)
-	dialContinue, err := redis.String(rc.Do("get", redisKey))
+	nxDuration, _ := jsonparser.GetString(body, "duration")
+	duration, _ := strconv.Atoi(nxDuration)
 
-	logrus.WithField("redisKey", redisKey).WithField("redisValue", dialContinue).WithError(err).WithField("status", nxStatus).Debug("looking up dial continue")
+	leg, err := ivr.UpdateDialLeg(rc, legUUID, callStatusMap[nxStatus], nxStatus == "completed", duration)
+	if err != nil {
+		return nil, err
+	}
 
 	// no associated call, move on
-	if err == redis.ErrNil {
+	if leg == nil {
 		return nil, nil
 	}
 
-	if err != nil {
-		return nil, errors.Wrapf(err, "error looking up leg uuid: %s", redisKey)
-	}
-
-	// transfer the call back to our handle with the dial wait type
-	parts := strings.SplitN(dialContinue, ":", 2)
-	callUUID, resumeURL := parts[0], parts[1]
-
-	// we found an associated call, if the status is complete, have it continue, we call out to
-	// redis and hand it our flow to resume on to get the next NCCO
-	if nxStatus == "completed" {
-		logrus.Debug("found completed call, trying to finish with call ID: ", callUUID)
-		statusKey := fmt.Sprintf("dial_status_%s", callUUID)
-		status, err := redis.String(rc.Do("get", statusKey))
-		if err == redis.ErrNil {
-			return nil, fmt.Errorf("unable to find call status for: %s", callUUID)
-		}
-		if err != nil {
-			return nil, errors.Wrapf(err, "error looking up call status for: %s", callUUID)
-		}
+	// the leg has ended so transfer the original call back to our handle with the dial wait type to get the next NCCO
+	if leg.Ended {
+		logrus.Debug("found completed call, trying to finish with call ID: ", leg.CallID)
 
-		// duration of the call is in our body
-		duration, _ := jsonparser.GetString(body, "duration")
-
-		resumeURL += "&dial_status=" + status
-		resumeURL += "&dial_duration=" + duration
-		resumeURL += "&sig=" + s.calculateSignature(resumeURL)
+		resumeURL := leg.ResumeURL + "&sig=" + s.calculateSignature(leg.ResumeURL)
 
 		nxBody := map[string]interface{}{
 			"action": "transfer",
@@ -248,33 +226,22 @@ func (s *service) PreprocessStatus(ctx context.Context, rt *runtime.Runtime, r *
 				"url":  []string{resumeURL},
 			},
 		}
-		trace, err := s.makeRequest(http.MethodPut, s.callURL+"/"+callUUID, nxBody)
+		trace, err := s.makeRequest(http.MethodPut, s.callURL+"/"+leg.CallID, nxBody)
 		if err != nil {
-			return nil, errors.Wrapf(err, "error reconnecting flow for call: %s", callUUID)
+			return nil, errors.Wrapf(err, "error reconnecting flow for call: %s", leg.CallID)
 		}
 
 		// vonage return 204 on successful updates
 		if trace.Response.StatusCode != http.StatusNoContent {
-			return nil, fmt.Errorf("error reconnecting flow for call: %s, received %d from vonage", callUUID, trace.Response.StatusCode)
+			return nil, fmt.Errorf("error reconnecting flow for call: %s, received %d from vonage", leg.CallID, trace.Response.StatusCode)
 		}
 
-		return s.MakeEmptyResponseBody(fmt.Sprintf("reconnected call: %s to flow with dial status: %s", callUUID, status)), nil
+		return s.MakeEmptyResponseBody(fmt.Sprintf("reconnected call: %s to flow with dial status: %s", leg.CallID, leg.Status)), nil
 	}
 
-	// otherwise the call isn't over yet, instead stash away our status so we can use it to
-	// determine if the call was answered, busy etc..
-	status := callStatusMap[nxStatus]
-
-	// only store away valid final states
-	if status != "" {
-		redisKey := fmt.Sprintf("dial_status_%s", callUUID)
-		_, err = rc.Do("setex", redisKey, 300, status)
-		if err != nil {
-			return nil, errors.Wrapf(err, "error inserting recording URL into redis")
-		}
-
-		logrus.WithField("redisKey", redisKey).WithField("status", status).WithField("callUUID", callUUID).Debug("saved intermediary dial status for call")
-		return s.MakeEmptyResponseBody(fmt.Sprintf("updated status for call: %s to: %s", callUUID, status)), nil
+	// otherwise the call isn't over yet but we may have a status which tells us if the call was answered, busy etc..
+	if leg.Status != "" {
+		return s.MakeEmptyResponseBody(fmt.Sprintf("updated status for call: %s to: %s", leg.CallID, leg.Status)), nil
 	}
 
 	return s.MakeEmptyResponseBody("ignoring non final status for tranfer leg"), nil
@@ -294,17 +261,16 @@ func (s *service) PreprocessResume(ctx context.Context, rt *runtime.Runtime, cal
 		rc := rt.RP.Get()
 		defer rc.Close()
 
-		redisKey := fmt.Sprintf("recording_%s", recordingUUID)
-		recordingURL, err := redis.String(rc.Do("get", redisKey))
-		if err != nil && err != redis.ErrNil {
-			return nil, errors.Wrapf(err, "error getting recording url from redis")
+		recordingURL, err := state.GetRecordingURL(rc, recordingUUID)
+		if err != nil {
+			return nil, err
 		}
 
 		// found a URL, stuff it in our request and move on
 		if recordingURL != "" {
 			r.URL.RawQuery = "&recording_url=" + url.QueryEscape(recordingURL)
 			logrus.WithField("recording_url", recordingURL).Info("found recording URL")
-			rc.Do("del", redisKey)
+			state.DeleteRecordingURL(rc, recordingUUID)
 			return nil, nil
 		}
 
@@ -333,7 +299,7 @@ func (s *service) PreprocessResume(ctx context.Context, rt *runtime.Runtime, cal
 		}
 
 		// get our recording url out
-		body, err := io.ReadAll(r.Body)
+		body, err := bodies.Read(r)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error reading body from request")
 		}
@@ -345,14 +311,12 @@ func (s *service) PreprocessResume(ctx context.Context, rt *runtime.Runtime, cal
 			return nil, errors.Errorf("no recording_url found in request")
 		}
 
-		// write it to redis
+		// save it so that it can be picked up by the resume
 		rc := rt.RP.Get()
 		defer rc.Close()
 
-		redisKey := fmt.Sprintf("recording_%s", recordingUUID)
-		_, err = rc.Do("setex", redisKey, 300, recordingURL)
-		if err != nil {
-			return nil, errors.Wrapf(err, "error inserting recording URL into redis")
+		if err := state.SetRecordingURL(rc, recordingUUID, recordingURL); err != nil {
+			return nil, err
 		}
 
 		msgBody := map[string]string{
@@ -422,6 +386,26 @@ func (s *service) HangupCall(callID string) (*httpx.Trace, error) {
 	return trace, nil
 }
 
+// GetCallStatus asks Vonage for the current status of the call that is passed in
+func (s *service) GetCallStatus(callID string) (models.CallStatus, models.CallError, int, *httpx.Trace, error) {
+	trace, err := s.makeRequest(http.MethodGet, s.callURL+"/"+callID, nil)
+	if err != nil {
+		return "", "", 0, trace, errors.Wrapf(err, "error trying to fetch call status")
+	}
+
+	if trace.Response.StatusCode != 200 {
+		return "", "", 0, trace, errors.Errorf("received non 200 status for call status: %d", trace.Response.StatusCode)
+	}
+
+	call := &StatusRequest{}
+	if err := json.Unmarshal(trace.ResponseBody, call); err != nil {
+		return "", "", 0, trace, errors.Wrapf(err, "unable to parse call status response")
+	}
+
+	status, errorReason, duration := callStatus(call.Status, call.Duration)
+	return status, errorReason, duration, trace, nil
+}
+
 type NCCOInput struct {
 	DTMF             string `json:"dtmf"`
 	TimedOut         bool   `json:"timed_out"`
@@ -444,7 +428,7 @@ func (s *service) ResumeForRequest(r *http.Request) (ivr.Resume, error) {
 	if waitType == "gather" || waitType == "record" {
 		// parse our input
 		input := &NCCOInput{}
-		bb, err := readBody(r)
+		bb, err := bodies.Read(r)
 		if err != nil {
 			return nil, errors.Wrapf(err, "error reading request body")
 		}
@@ -457,9 +441,9 @@ func (s *service) ResumeForRequest(r *http.Request) (ivr.Resume, error) {
 		// otherwise grab the right field based on our wait type
 		switch waitType {
 		case "gather":
-			// this could be a timeout, in which case we return nothing at all
+			// this could be a timeout
 			if input.TimedOut {
-				return ivr.InputResume{}, nil
+				return ivr.TimeoutResume{}, nil
 			}
 
 			return ivr.InputResume{Input: input.DTMF}, nil
@@ -513,7 +497,7 @@ func (s *service) StatusForRequest(r *http.Request) (models.CallStatus, models.C
 		return models.CallStatusInProgress, "", 0
 	}
 
-	bb, err := readBody(r)
+	bb, err := bodies.Read(r)
 	if err != nil {
 		logrus.WithError(err).Error("error reading status request body")
 		return models.CallStatusErrored, models.CallErrorProvider, 0
@@ -531,7 +515,12 @@ func (s *service) StatusForRequest(r *http.Request) (models.CallStatus, models.C
 		return models.CallStatusInProgress, "", 0
 	}
 
-	switch status.Status {
+	return callStatus(status.Status, status.Duration)
+}
+
+// converts a Vonage call status to our call status, and if it's an error the reason
+func callStatus(status string, duration string) (models.CallStatus, models.CallError, int) {
+	switch status {
 
 	case "started", "ringing":
 		return models.CallStatusWired, "", 0
@@ -540,8 +529,8 @@ func (s *service) StatusForRequest(r *http.Request) (models.CallStatus, models.C
 		return models.CallStatusInProgress, "", 0
 
 	case "completed":
-		duration, _ := strconv.Atoi(status.Duration)
-		return models.CallStatusCompleted, "", duration
+		secs, _ := strconv.Atoi(duration)
+		return models.CallStatusCompleted, "", secs
 
 	case "busy":
 		return models.CallStatusErrored, models.CallErrorBusy, 0
@@ -553,7 +542,7 @@ func (s *service) StatusForRequest(r *http.Request) (models.CallStatus, models.C
 		return models.CallStatusErrored, models.CallErrorProvider, 0
 
 	default:
-		logrus.WithField("status", status.Status).Error("unknown call status in ncco callback")
+		logrus.WithField("status", status).Error("unknown call status")
 		return models.CallStatusFailed, models.CallErrorProvider, 0
 	}
 }
@@ -650,8 +639,11 @@ func (s *service) MakeEmptyResponseBody(msg string) []byte {
 }
 
 func (s *service) makeRequest(method string, sendURL string, body interface{}) (*httpx.Trace, error) {
-	bb := jsonx.MustMarshal(body)
-	req, _ := http.NewRequest(method, sendURL, bytes.NewReader(bb))
+	var reqBody io.Reader
+	if body != nil {
+		reqBody = bytes.NewReader(jsonx.MustMarshal(body))
+	}
+	req, _ := http.NewRequest(method, sendURL, reqBody)
 	token, err := s.generateToken()
 	if err != nil {
 		return nil, errors.Wrapf(err, "error generating jwt token")
@@ -750,6 +742,9 @@ func (s *service) responseForSprint(ctx context.Context, rp *redis.Pool, channel
 					EventURL:     []string{eventURL},
 					EventMethod:  http.MethodPost,
 				}
+				if wait.TimeoutSeconds != nil {
+					input.Timeout = *wait.TimeoutSeconds
+				}
 				// limit our digits if asked to
 				if hint.Count != nil {
 					input.MaxDigits = *hint.Count
@@ -759,6 +754,12 @@ func (s *service) responseForSprint(ctx context.Context, rp *redis.Pool, channel
 				waitActions = append(waitActions, input)
 
 			case *hints.AudioHint:
+				if !s.capabilities.Record {
+					// recording isn't supported so resume straight away as if nothing was recorded
+					waitActions = append(waitActions, s.immediateResume(resumeURL+"&wait_type=record&empty=true"))
+					break
+				}
+
 				// Vonage is goofy in that they do not synchronously send us recordings. Rather the move on in
 				// the NCCO script immediately and then asynchronously call the event URL on the record URL
 				// when the recording is ready.
@@ -799,6 +800,12 @@ func (s *service) responseForSprint(ctx context.Context, rp *redis.Pool, channel
 			}
 
 		case *events.DialWaitEvent:
+			if !s.capabilities.Dial {
+				// dialing isn't supported so resume straight away as if the dial failed
+				waitActions = append(waitActions, s.immediateResume(resumeURL+"&wait_type=dial&dial_status="+string(flows.DialStatusFailed)))
+				break
+			}
+
 			// Vonage handles forwards a bit differently. We have to create a new call to the forwarded number, then
 			// join the current call with the call we are starting.
 			//
@@ -838,18 +845,14 @@ func (s *service) responseForSprint(ctx context.Context, rp *redis.Pool, channel
 				return "", errors.Wrapf(err, "error reading call id from transfer")
 			}
 
-			// save away the tranfer id, connecting it to this connection
+			// track the transfer leg, connecting it to this call
 			rc := rp.Get()
 			defer rc.Close()
 
-			eventURL := resumeURL + "&wait_type=dial"
-			redisKey := fmt.Sprintf("dial_%s", transferUUID)
-			redisValue := fmt.Sprintf("%s:%s", call.ExternalID(), eventURL)
-			_, err = rc.Do("setex", redisKey, 3600, redisValue)
-			if err != nil {
-				return "", errors.Wrapf(err, "error inserting transfer ID into redis")
+			if err := ivr.TrackDialLeg(rc, transferUUID, call.ExternalID(), resumeURL+"&wait_type=dial"); err != nil {
+				return "", err
 			}
-			logrus.WithField("transferUUID", transferUUID).WithField("callID", call.ExternalID()).WithField("redisKey", redisKey).WithField("redisValue", redisValue).Debug("saved away call id")
+			logrus.WithField("transferUUID", transferUUID).WithField("callID", call.ExternalID()).Debug("tracking dial leg for call")
 		}
 	}
 
@@ -894,6 +897,18 @@ func (s *service) responseForSprint(ctx context.Context, rp *redis.Pool, channel
 	return string(body), nil
 }
 
+// returns an input action which times out after a second, calling the given resume URL
+func (s *service) immediateResume(resumeURL string) *Input {
+	eventURL := resumeURL + "&sig=" + url.QueryEscape(s.calculateSignature(resumeURL))
+	return &Input{
+		Action:       "input",
+		Timeout:      1,
+		SubmitOnHash: true,
+		EventURL:     []string{eventURL},
+		EventMethod:  http.MethodPost,
+	}
+}
+
 func (s *service) RedactValues(ch *models.Channel) []string {
 	return []string{ch.ConfigValue(privateKeyConfig, "")}
 }
@@ -0,0 +1,101 @@
+package twilio
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	typeTwilio = "twilio"
+
+	configAccountSID = "twilio_lookup_account_sid"
+	configAuthToken  = "twilio_lookup_auth_token"
+
+	lookupURL = "https://lookups.twilio.com/v2/PhoneNumbers/%s?Fields=line_type_intelligence"
+)
+
+func init() {
+	models.RegisterNumberLookupService(typeTwilio, newOrgService)
+}
+
+func newOrgService(org *models.Org, httpClient *http.Client, httpRetries *httpx.RetryConfig) (models.NumberLookupService, error) {
+	accountSID := org.ConfigValue(configAccountSID, "")
+	authToken := org.ConfigValue(configAuthToken, "")
+
+	if accountSID == "" || authToken == "" {
+		return nil, errors.Errorf("missing %s or %s on Twilio lookup configuration for org: %d", configAccountSID, configAuthToken, org.ID())
+	}
+	return NewService(httpClient, httpRetries, accountSID, authToken), nil
+}
+
+type service struct {
+	httpClient  *http.Client
+	httpRetries *httpx.RetryConfig
+	accountSID  string
+	authToken   string
+}
+
+// NewService creates a new Twilio Lookup service, see https://www.twilio.com/docs/lookup/v2-api/line-type-intelligence
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, accountSID, authToken string) models.NumberLookupService {
+	return &service{httpClient: httpClient, httpRetries: httpRetries, accountSID: accountSID, authToken: authToken}
+}
+
+type lookupResponse struct {
+	LineTypeIntelligence *struct {
+		Type        string `json:"type"`
+		CarrierName string `json:"carrier_name"`
+		ErrorCode   *int   `json:"error_code"`
+	} `json:"line_type_intelligence"`
+}
+
+// line types returned by Twilio mapped to our line types
+var lineTypes = map[string]string{
+	"mobile":       models.LineTypeMobile,
+	"landline":     models.LineTypeLandline,
+	"fixedVoip":    models.LineTypeVoIP,
+	"nonFixedVoip": models.LineTypeVoIP,
+}
+
+func (s *service) RedactValues() []string {
+	return []string{s.authToken, httpx.BasicAuth(s.accountSID, s.authToken)}
+}
+
+func (s *service) Lookup(number string) (*models.NumberInfo, *httpx.Trace, error) {
+	req, err := httpx.NewRequest("GET", fmt.Sprintf(lookupURL, url.PathEscape(number)), nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.SetBasicAuth(s.accountSID, s.authToken)
+
+	trace, err := httpx.DoTrace(s.httpClient, req, s.httpRetries, nil, -1)
+	if err != nil {
+		return nil, trace, err
+	}
+	if trace.Response.StatusCode != http.StatusOK {
+		return nil, trace, errors.Errorf("Twilio lookup request failed with status %d", trace.Response.StatusCode)
+	}
+
+	response := &lookupResponse{}
+	if err := jsonx.Unmarshal(trace.ResponseBody, response); err != nil {
+		return nil, trace, errors.Wrap(err, "error unmarshalling Twilio lookup response")
+	}
+
+	lti := response.LineTypeIntelligence
+	if lti == nil || lti.ErrorCode != nil {
+		return nil, trace, errors.New("Twilio lookup response has no line type intelligence")
+	}
+
+	lineType := lineTypes[lti.Type]
+	if lineType == "" {
+		lineType = models.LineTypeOther
+	}
+
+	return &models.NumberInfo{LineType: lineType, Carrier: lti.CarrierName}, trace, nil
+}
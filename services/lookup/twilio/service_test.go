@@ -0,0 +1,50 @@
+package twilio_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/services/lookup/twilio"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://lookups.twilio.com/v2/PhoneNumbers/+250788123123?Fields=line_type_intelligence": {
+			httpx.NewMockResponse(200, nil, []byte(`{"phone_number": "+250788123123", "line_type_intelligence": {"type": "mobile", "carrier_name": "MTN Rwanda", "error_code": null}}`)),
+		},
+		"https://lookups.twilio.com/v2/PhoneNumbers/+12025550123?Fields=line_type_intelligence": {
+			httpx.NewMockResponse(200, nil, []byte(`{"phone_number": "+12025550123", "line_type_intelligence": {"type": "nonFixedVoip", "carrier_name": "Google Voice", "error_code": null}}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"phone_number": "+12025550123", "line_type_intelligence": {"type": "tollFree", "carrier_name": "Toll Co", "error_code": null}}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"phone_number": "+12025550123", "line_type_intelligence": {"type": null, "carrier_name": null, "error_code": 60600}}`)),
+			httpx.NewMockResponse(401, nil, []byte(`{"code": 20003, "message": "Authenticate"}`)),
+		},
+	}))
+
+	svc := twilio.NewService(http.DefaultClient, nil, "AC123", "sesame")
+
+	info, trace, err := svc.Lookup("+250788123123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeMobile, Carrier: "MTN Rwanda"}, info)
+	assert.Equal(t, "Basic QUMxMjM6c2VzYW1l", trace.Request.Header.Get("Authorization"))
+
+	info, _, err = svc.Lookup("+12025550123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeVoIP, Carrier: "Google Voice"}, info)
+
+	info, _, err = svc.Lookup("+12025550123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeOther, Carrier: "Toll Co"}, info)
+
+	_, _, err = svc.Lookup("+12025550123")
+	assert.EqualError(t, err, "Twilio lookup response has no line type intelligence")
+
+	_, _, err = svc.Lookup("+12025550123")
+	assert.EqualError(t, err, "Twilio lookup request failed with status 401")
+}
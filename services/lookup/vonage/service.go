@@ -0,0 +1,134 @@
+package vonage
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	typeVonage = "vonage"
+
+	configAPIKey    = "vonage_insight_api_key"
+	configAPISecret = "vonage_insight_api_secret"
+	configAdvanced  = "vonage_insight_advanced"
+
+	standardURL = "https://api.nexmo.com/ni/standard/json"
+	advancedURL = "https://api.nexmo.com/ni/advanced/json"
+)
+
+func init() {
+	models.RegisterNumberLookupService(typeVonage, newOrgService)
+}
+
+func newOrgService(org *models.Org, httpClient *http.Client, httpRetries *httpx.RetryConfig) (models.NumberLookupService, error) {
+	apiKey := org.ConfigValue(configAPIKey, "")
+	apiSecret := org.ConfigValue(configAPISecret, "")
+
+	if apiKey == "" || apiSecret == "" {
+		return nil, errors.Errorf("missing %s or %s on Vonage number insight configuration for org: %d", configAPIKey, configAPISecret, org.ID())
+	}
+	return NewService(httpClient, httpRetries, apiKey, apiSecret, org.ConfigValue(configAdvanced, "") == "true"), nil
+}
+
+type service struct {
+	httpClient  *http.Client
+	httpRetries *httpx.RetryConfig
+	apiKey      string
+	apiSecret   string
+	advanced    bool
+}
+
+// NewService creates a new Vonage Number Insight service, see https://developer.vonage.com/en/number-insight/overview.
+// Only advanced lookups, which cost more, can tell if a number is unreachable.
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, apiKey, apiSecret string, advanced bool) models.NumberLookupService {
+	return &service{httpClient: httpClient, httpRetries: httpRetries, apiKey: apiKey, apiSecret: apiSecret, advanced: advanced}
+}
+
+type insightResponse struct {
+	Status         int    `json:"status"`
+	StatusMessage  string `json:"status_message"`
+	CurrentCarrier *struct {
+		Name        string `json:"name"`
+		NetworkType string `json:"network_type"`
+	} `json:"current_carrier"`
+
+	// only included in advanced responses
+	ValidNumber string `json:"valid_number"`
+	Reachable   string `json:"reachable"`
+}
+
+// network types returned by Vonage mapped to our line types
+var lineTypes = map[string]string{
+	"mobile":   models.LineTypeMobile,
+	"landline": models.LineTypeLandline,
+	"virtual":  models.LineTypeVoIP,
+}
+
+// reachable values of advanced responses which mean a number can't be reached
+var unreachableValues = map[string]bool{
+	"unreachable":   true,
+	"undeliverable": true,
+	"absent":        true,
+	"bad_number":    true,
+}
+
+func (s *service) RedactValues() []string {
+	return []string{s.apiSecret}
+}
+
+func (s *service) Lookup(number string) (*models.NumberInfo, *httpx.Trace, error) {
+	form := url.Values{
+		"api_key":    []string{s.apiKey},
+		"api_secret": []string{s.apiSecret},
+		"number":     []string{strings.TrimPrefix(number, "+")},
+	}
+
+	insightURL := standardURL
+	if s.advanced {
+		insightURL = advancedURL
+	}
+
+	req, err := httpx.NewRequest("GET", insightURL+"?"+form.Encode(), nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trace, err := httpx.DoTrace(s.httpClient, req, s.httpRetries, nil, -1)
+	if err != nil {
+		return nil, trace, err
+	}
+	if trace.Response.StatusCode != http.StatusOK {
+		return nil, trace, errors.Errorf("Vonage number insight request failed with status %d", trace.Response.StatusCode)
+	}
+
+	response := &insightResponse{}
+	if err := jsonx.Unmarshal(trace.ResponseBody, response); err != nil {
+		return nil, trace, errors.Wrap(err, "error unmarshalling Vonage number insight response")
+	}
+
+	// a status of 0 is success, see https://developer.vonage.com/en/api/number-insight#getNumberInsightStandard
+	if response.Status != 0 {
+		return nil, trace, errors.Errorf("Vonage number insight request failed: %s", response.StatusMessage)
+	}
+	if response.CurrentCarrier == nil {
+		return nil, trace, errors.New("Vonage number insight response has no current carrier")
+	}
+
+	lineType := lineTypes[response.CurrentCarrier.NetworkType]
+	if lineType == "" {
+		lineType = models.LineTypeOther
+	}
+
+	return &models.NumberInfo{
+		LineType:    lineType,
+		Carrier:     response.CurrentCarrier.Name,
+		Unreachable: response.ValidNumber == "not_valid" || unreachableValues[response.Reachable],
+	}, trace, nil
+}
@@ -0,0 +1,74 @@
+package vonage_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/services/lookup/vonage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://api.nexmo.com/ni/standard/json?api_key=key123&api_secret=sesame&number=250788123123": {
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 0, "status_message": "Success", "current_carrier": {"name": "MTN Rwanda", "network_type": "mobile"}}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 0, "status_message": "Success", "current_carrier": {"name": "Rwandatel", "network_type": "landline"}}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 0, "status_message": "Success", "current_carrier": {"name": "Pager Co", "network_type": "pager"}}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 3, "status_message": "Invalid request"}`)),
+			httpx.NewMockResponse(500, nil, []byte(`Error`)),
+		},
+	}))
+
+	svc := vonage.NewService(http.DefaultClient, nil, "key123", "sesame", false)
+
+	info, _, err := svc.Lookup("+250788123123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeMobile, Carrier: "MTN Rwanda"}, info)
+
+	info, _, err = svc.Lookup("+250788123123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeLandline, Carrier: "Rwandatel"}, info)
+
+	info, _, err = svc.Lookup("+250788123123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeOther, Carrier: "Pager Co"}, info)
+
+	_, _, err = svc.Lookup("+250788123123")
+	assert.EqualError(t, err, "Vonage number insight request failed: Invalid request")
+
+	_, _, err = svc.Lookup("+250788123123")
+	assert.EqualError(t, err, "Vonage number insight request failed with status 500")
+}
+
+func TestServiceAdvanced(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://api.nexmo.com/ni/advanced/json?api_key=key123&api_secret=sesame&number=250788123123": {
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 0, "current_carrier": {"name": "MTN Rwanda", "network_type": "mobile"}, "valid_number": "valid", "reachable": "reachable"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 0, "current_carrier": {"name": "MTN Rwanda", "network_type": "mobile"}, "valid_number": "valid", "reachable": "absent"}`)),
+			httpx.NewMockResponse(200, nil, []byte(`{"status": 0, "current_carrier": {"name": "Unknown", "network_type": "unknown"}, "valid_number": "not_valid", "reachable": "unknown"}`)),
+		},
+	}))
+
+	svc := vonage.NewService(http.DefaultClient, nil, "key123", "sesame", true)
+	assert.Equal(t, []string{"sesame"}, svc.RedactValues())
+
+	info, _, err := svc.Lookup("+250788123123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeMobile, Carrier: "MTN Rwanda", Unreachable: false}, info)
+
+	info, _, err = svc.Lookup("+250788123123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeMobile, Carrier: "MTN Rwanda", Unreachable: true}, info)
+
+	info, _, err = svc.Lookup("+250788123123")
+	require.NoError(t, err)
+	assert.Equal(t, &models.NumberInfo{LineType: models.LineTypeOther, Carrier: "Unknown", Unreachable: true}, info)
+}
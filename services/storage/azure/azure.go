@@ -0,0 +1,93 @@
+package azure
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/storage"
+	mrstorage "github.com/nyaruka/mailroom/services/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	blobBaseURL = "https://%s.blob.core.windows.net"
+	apiVersion  = "2021-08-06"
+)
+
+type azureStorage struct {
+	httpClient      *http.Client
+	baseURL         string
+	sasToken        string
+	container       string
+	workersPerBatch int
+}
+
+// NewStorage creates a new Azure Blob storage service for the given account and container. Requests are authorized
+// with the given shared access signature which must grant read, write and list permissions on the container. Callers
+// can specify how many parallel uploads will take place at once when calling BatchPut with workersPerBatch.
+func NewStorage(httpClient *http.Client, account, sasToken, container string, workersPerBatch int) storage.Storage {
+	return &azureStorage{
+		httpClient:      httpClient,
+		baseURL:         fmt.Sprintf(blobBaseURL, account),
+		sasToken:        strings.TrimPrefix(sasToken, "?"),
+		container:       container,
+		workersPerBatch: workersPerBatch,
+	}
+}
+
+func (s *azureStorage) Name() string {
+	return "Azure"
+}
+
+// Test tests whether we can access our container
+func (s *azureStorage) Test(ctx context.Context) error {
+	_, _, err := s.do(ctx, http.MethodGet, fmt.Sprintf("%s/%s?restype=container&%s", s.baseURL, s.container, s.sasToken), nil, nil)
+	return err
+}
+
+// Get retrieves the blob at the given path, returning its content type and body
+func (s *azureStorage) Get(ctx context.Context, path string) (string, []byte, error) {
+	resp, body, err := s.do(ctx, http.MethodGet, s.url(path)+"?"+s.sasToken, nil, nil)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "error getting Azure blob")
+	}
+
+	return resp.Header.Get("Content-Type"), body, nil
+}
+
+// Put writes the given body to a block blob at the given path, returning the URL of the blob
+func (s *azureStorage) Put(ctx context.Context, path string, contentType string, body []byte) (string, error) {
+	headers := map[string]string{"Content-Type": contentType, "x-ms-blob-type": "BlockBlob"}
+
+	_, _, err := s.do(ctx, http.MethodPut, s.url(path)+"?"+s.sasToken, body, headers)
+	if err != nil {
+		return "", errors.Wrapf(err, "error putting Azure blob")
+	}
+
+	return s.url(path), nil
+}
+
+// BatchPut writes the entire batch of items, setting the URL or error on each
+func (s *azureStorage) BatchPut(ctx context.Context, uploads []*storage.Upload) error {
+	return mrstorage.BatchPut(ctx, s, uploads, s.workersPerBatch)
+}
+
+func (s *azureStorage) do(ctx context.Context, method, u string, body []byte, headers map[string]string) (*http.Response, []byte, error) {
+	req, err := httpx.NewRequest(method, u, bytes.NewReader(body), headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("x-ms-version", apiVersion)
+
+	return mrstorage.Do(s.httpClient, req)
+}
+
+// returns the URL of the blob at the given path, which doesn't include our SAS token
+func (s *azureStorage) url(path string) string {
+	return fmt.Sprintf("%s/%s/%s", s.baseURL, s.container, strings.TrimPrefix(path, "/"))
+}
@@ -0,0 +1,63 @@
+package azure_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/storage"
+	"github.com/nyaruka/mailroom/services/storage/azure"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://myaccount.blob.core.windows.net/attachments?restype=container&sv=2021&sig=xyz": {
+			httpx.NewMockResponse(200, nil, nil),
+			httpx.NewMockResponse(403, nil, []byte(`<Error><Code>AuthenticationFailed</Code></Error>`)),
+		},
+		"https://myaccount.blob.core.windows.net/attachments/1/abcd/hello.txt?sv=2021&sig=xyz": {
+			httpx.NewMockResponse(201, nil, nil),
+			httpx.NewMockResponse(200, map[string]string{"Content-Type": "text/plain"}, []byte(`hello`)),
+		},
+		"https://myaccount.blob.core.windows.net/attachments/a.txt?sv=2021&sig=xyz": {
+			httpx.NewMockResponse(201, nil, nil),
+		},
+		"https://myaccount.blob.core.windows.net/attachments/b.txt?sv=2021&sig=xyz": {
+			httpx.NewMockResponse(201, nil, nil),
+		},
+	})
+	httpx.SetRequestor(mocks)
+
+	s := azure.NewStorage(http.DefaultClient, "myaccount", "?sv=2021&sig=xyz", "attachments", 2)
+	assert.Equal(t, "Azure", s.Name())
+
+	assert.NoError(t, s.Test(ctx))
+	assert.EqualError(t, s.Test(ctx), "request to myaccount.blob.core.windows.net failed with status 403")
+
+	url, err := s.Put(ctx, "/1/abcd/hello.txt", "text/plain", []byte(`hello`))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://myaccount.blob.core.windows.net/attachments/1/abcd/hello.txt", url)
+	assert.Equal(t, "BlockBlob", mocks.Requests()[2].Header.Get("x-ms-blob-type"))
+	assert.Equal(t, "text/plain", mocks.Requests()[2].Header.Get("Content-Type"))
+
+	contentType, body, err := s.Get(ctx, "/1/abcd/hello.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", contentType)
+	assert.Equal(t, []byte(`hello`), body)
+
+	uploads := []*storage.Upload{
+		{Path: "/a.txt", ContentType: "text/plain", Body: []byte(`a`)},
+		{Path: "/b.txt", ContentType: "text/plain", Body: []byte(`b`)},
+	}
+	assert.NoError(t, s.BatchPut(ctx, uploads))
+	assert.Equal(t, "https://myaccount.blob.core.windows.net/attachments/a.txt", uploads[0].URL)
+	assert.Equal(t, "https://myaccount.blob.core.windows.net/attachments/b.txt", uploads[1].URL)
+
+	assert.False(t, mocks.HasUnused())
+}
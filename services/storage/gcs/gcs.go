@@ -0,0 +1,194 @@
+package gcs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/storage"
+	"github.com/nyaruka/goflow/utils"
+	mrstorage "github.com/nyaruka/mailroom/services/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	apiBaseURL    = "https://storage.googleapis.com/storage/v1"
+	uploadBaseURL = "https://storage.googleapis.com/upload/storage/v1"
+	publicBaseURL = "https://storage.googleapis.com"
+	tokenScope    = "https://www.googleapis.com/auth/devstorage.read_write"
+
+	// ACLPublicRead makes uploaded objects readable by anyone, used for attachments
+	ACLPublicRead = "publicRead"
+
+	// ACLPrivate restricts uploaded objects to the project, used for sessions
+	ACLPrivate = "projectPrivate"
+)
+
+// Credentials is the subset of a Google service account JSON key that we need
+type Credentials struct {
+	ClientEmail string `json:"client_email" validate:"required"`
+	PrivateKey  string `json:"private_key"  validate:"required"`
+	TokenURI    string `json:"token_uri"    validate:"required"`
+}
+
+// ReadCredentials reads service account credentials from the given JSON key
+func ReadCredentials(data []byte) (*Credentials, error) {
+	c := &Credentials{}
+	if err := utils.UnmarshalAndValidate(data, c); err != nil {
+		return nil, errors.Wrap(err, "error reading GCS credentials")
+	}
+	return c, nil
+}
+
+type gcsStorage struct {
+	httpClient      *http.Client
+	creds           *Credentials
+	privateKey      *rsa.PrivateKey
+	bucket          string
+	acl             string
+	workersPerBatch int
+
+	tokenMutex  sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewStorage creates a new Google Cloud Storage service using the given service account credentials. Callers can
+// specify how many parallel uploads will take place at once when calling BatchPut with workersPerBatch.
+func NewStorage(httpClient *http.Client, creds *Credentials, bucket, acl string, workersPerBatch int) (storage.Storage, error) {
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(creds.PrivateKey))
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing GCS private key")
+	}
+
+	return &gcsStorage{
+		httpClient:      httpClient,
+		creds:           creds,
+		privateKey:      privateKey,
+		bucket:          bucket,
+		acl:             acl,
+		workersPerBatch: workersPerBatch,
+	}, nil
+}
+
+func (s *gcsStorage) Name() string {
+	return "GCS"
+}
+
+// Test tests whether we can access our bucket
+func (s *gcsStorage) Test(ctx context.Context) error {
+	_, _, err := s.do(ctx, http.MethodGet, fmt.Sprintf("%s/b/%s", apiBaseURL, s.bucket), nil, nil)
+	return err
+}
+
+// Get retrieves the object at the given path, returning its content type and body
+func (s *gcsStorage) Get(ctx context.Context, path string) (string, []byte, error) {
+	u := fmt.Sprintf("%s/b/%s/o/%s?alt=media", apiBaseURL, s.bucket, url.PathEscape(objectName(path)))
+
+	resp, body, err := s.do(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "error getting GCS object")
+	}
+
+	return resp.Header.Get("Content-Type"), body, nil
+}
+
+// Put writes the given body to the given path, returning the public URL of the object
+func (s *gcsStorage) Put(ctx context.Context, path string, contentType string, body []byte) (string, error) {
+	params := url.Values{"uploadType": []string{"media"}, "name": []string{objectName(path)}}
+	if s.acl != "" {
+		params.Set("predefinedAcl", s.acl)
+	}
+	u := fmt.Sprintf("%s/b/%s/o?%s", uploadBaseURL, s.bucket, params.Encode())
+
+	_, _, err := s.do(ctx, http.MethodPost, u, body, map[string]string{"Content-Type": contentType})
+	if err != nil {
+		return "", errors.Wrapf(err, "error putting GCS object")
+	}
+
+	return fmt.Sprintf("%s/%s/%s", publicBaseURL, s.bucket, objectName(path)), nil
+}
+
+// BatchPut writes the entire batch of items, setting the URL or error on each
+func (s *gcsStorage) BatchPut(ctx context.Context, uploads []*storage.Upload) error {
+	return mrstorage.BatchPut(ctx, s, uploads, s.workersPerBatch)
+}
+
+func (s *gcsStorage) do(ctx context.Context, method, u string, body []byte, headers map[string]string) (*http.Response, []byte, error) {
+	token, err := s.accessToken(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := httpx.NewRequest(method, u, bytes.NewReader(body), headers)
+	if err != nil {
+		return nil, nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return mrstorage.Do(s.httpClient, req)
+}
+
+// gets an access token for our service account, fetching a new one if we don't have one or it's about to expire
+func (s *gcsStorage) accessToken(ctx context.Context) (string, error) {
+	s.tokenMutex.Lock()
+	defer s.tokenMutex.Unlock()
+
+	if s.token != "" && time.Now().Add(time.Minute).Before(s.tokenExpiry) {
+		return s.token, nil
+	}
+
+	now := time.Now()
+	assertion, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   s.creds.ClientEmail,
+		"scope": tokenScope,
+		"aud":   s.creds.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}).SignedString(s.privateKey)
+	if err != nil {
+		return "", errors.Wrap(err, "error signing GCS token assertion")
+	}
+
+	form := url.Values{
+		"grant_type": []string{"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  []string{assertion},
+	}
+	req, err := httpx.NewRequest(http.MethodPost, s.creds.TokenURI, strings.NewReader(form.Encode()), map[string]string{"Content-Type": "application/x-www-form-urlencoded"})
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+
+	_, body, err := mrstorage.Do(s.httpClient, req)
+	if err != nil {
+		return "", errors.Wrap(err, "error requesting GCS access token")
+	}
+
+	response := &struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err := jsonx.Unmarshal(body, response); err != nil {
+		return "", errors.Wrap(err, "error reading GCS access token response")
+	}
+
+	s.token = response.AccessToken
+	s.tokenExpiry = now.Add(time.Duration(response.ExpiresIn) * time.Second)
+	return s.token, nil
+}
+
+// our paths start with a slash like S3 keys, but GCS object names shouldn't
+func objectName(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
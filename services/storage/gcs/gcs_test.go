@@ -0,0 +1,79 @@
+package gcs_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/services/storage/gcs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	_, err = gcs.ReadCredentials([]byte(`{"client_email": "mailroom@example.iam.gserviceaccount.com"}`))
+	assert.Error(t, err)
+
+	creds, err := gcs.ReadCredentials(jsonx.MustMarshal(map[string]string{
+		"type":         "service_account",
+		"client_email": "mailroom@example.iam.gserviceaccount.com",
+		"private_key":  string(keyPEM),
+		"token_uri":    "https://oauth2.googleapis.com/token",
+	}))
+	require.NoError(t, err)
+
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+	mocks := httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://oauth2.googleapis.com/token": {
+			httpx.NewMockResponse(200, nil, []byte(`{"access_token": "ya29.abc", "expires_in": 3599, "token_type": "Bearer"}`)),
+		},
+		"https://storage.googleapis.com/storage/v1/b/mybucket": {
+			httpx.NewMockResponse(200, nil, []byte(`{"name": "mybucket"}`)),
+		},
+		"https://storage.googleapis.com/upload/storage/v1/b/mybucket/o?name=1%2Fabcd%2Fhello.txt&predefinedAcl=publicRead&uploadType=media": {
+			httpx.NewMockResponse(200, nil, []byte(`{"name": "1/abcd/hello.txt"}`)),
+		},
+		"https://storage.googleapis.com/storage/v1/b/mybucket/o/1%2Fabcd%2Fhello.txt?alt=media": {
+			httpx.NewMockResponse(200, map[string]string{"Content-Type": "text/plain"}, []byte(`hello`)),
+			httpx.NewMockResponse(404, nil, []byte(`Not Found`)),
+		},
+	})
+	httpx.SetRequestor(mocks)
+
+	s, err := gcs.NewStorage(http.DefaultClient, creds, "mybucket", gcs.ACLPublicRead, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "GCS", s.Name())
+
+	assert.NoError(t, s.Test(ctx))
+
+	url, err := s.Put(ctx, "/1/abcd/hello.txt", "text/plain", []byte(`hello`))
+	assert.NoError(t, err)
+	assert.Equal(t, "https://storage.googleapis.com/mybucket/1/abcd/hello.txt", url)
+
+	contentType, body, err := s.Get(ctx, "/1/abcd/hello.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", contentType)
+	assert.Equal(t, []byte(`hello`), body)
+
+	_, _, err = s.Get(ctx, "/1/abcd/hello.txt")
+	assert.EqualError(t, err, "error getting GCS object: request to storage.googleapis.com failed with status 404")
+
+	// token should only have been fetched once and used for all requests
+	assert.False(t, mocks.HasUnused())
+	for _, r := range mocks.Requests()[1:] {
+		assert.Equal(t, "Bearer ya29.abc", r.Header.Get("Authorization"))
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/storage"
+	"github.com/pkg/errors"
+)
+
+// Do makes the given request to a storage API, returning the response and its body, and an error if the request
+// failed or returned a non-2XX status
+func Do(client *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	resp, err := httpx.Do(client, req, nil, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, errors.Wrap(err, "error reading response body")
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return resp, body, errors.Errorf("request to %s failed with status %d", req.URL.Host, resp.StatusCode)
+	}
+
+	return resp, body, nil
+}
+
+// BatchPut writes the given uploads using the given storage's Put method with up to the given number of parallel
+// workers. Each upload is retried up to three times and we stop at the first upload which still fails.
+func BatchPut(ctx context.Context, s storage.Storage, us []*storage.Upload, workers int) error {
+	uploads := make(chan *storage.Upload, len(us))
+	errors := make(chan error, len(us))
+	stop := make(chan bool)
+	wg := &sync.WaitGroup{}
+
+	worker := func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case u := <-uploads:
+				var err error
+				for tries := 0; tries < 3; tries++ {
+					// use a short timeout per request, better to retry than wait on a stalled connection
+					uctx, cancel := context.WithTimeout(ctx, time.Second*15)
+					u.URL, err = s.Put(uctx, u.Path, u.ContentType, u.Body)
+					cancel()
+
+					if err == nil {
+						break
+					}
+				}
+
+				u.Error = err
+				errors <- err
+
+			case <-stop:
+				return
+			}
+		}
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go worker()
+	}
+
+	for _, u := range us {
+		uploads <- u
+	}
+
+	// read all our errors out, stopping if we encounter one
+	var err error
+	for i := 0; i < len(us); i++ {
+		if e := <-errors; e != nil {
+			err = e
+			break
+		}
+	}
+
+	close(stop)
+	wg.Wait()
+
+	return err
+}
@@ -0,0 +1,123 @@
+package rcs
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/sirupsen/logrus"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	configTemplatesURL   = "rcs_templates_url"
+	configTemplatesToken = "rcs_templates_token"
+)
+
+func init() {
+	models.RegisterTemplateCatalogService(models.TemplateCatalogRCS, newService)
+}
+
+func newService(channel *models.Channel, httpClient *http.Client, httpRetries *httpx.RetryConfig) (models.TemplateCatalogService, error) {
+	templatesURL := channel.ConfigValue(configTemplatesURL, "")
+
+	// RCS channels don't have to use templates
+	if templatesURL == "" {
+		return nil, nil
+	}
+	return NewService(httpClient, httpRetries, templatesURL, channel.ConfigValue(configTemplatesToken, "")), nil
+}
+
+type service struct {
+	httpClient   *http.Client
+	httpRetries  *httpx.RetryConfig
+	templatesURL string
+	token        string
+}
+
+// NewService creates a new template catalog service for RCS enabled channels which fetches templates from the
+// provider's template list endpoint configured on the channel
+func NewService(httpClient *http.Client, httpRetries *httpx.RetryConfig, templatesURL, token string) models.TemplateCatalogService {
+	return &service{httpClient: httpClient, httpRetries: httpRetries, templatesURL: templatesURL, token: token}
+}
+
+type templatesResponse struct {
+	Templates []struct {
+		ID       string `json:"id"`
+		Name     string `json:"name"`
+		Language string `json:"language"`
+		Status   string `json:"status"`
+		Content  string `json:"content"`
+	} `json:"templates"`
+}
+
+// RCS template statuses mapped to our statuses, anything else is treated as pending
+var statuses = map[string]models.TemplateStatus{
+	"approved": models.TemplateStatusApproved,
+	"rejected": models.TemplateStatusRejected,
+}
+
+func (s *service) RedactValues() []string {
+	if s.token == "" {
+		return nil
+	}
+	return []string{s.token}
+}
+
+func (s *service) FetchTemplates() ([]*models.CatalogTemplate, []*httpx.Trace, error) {
+	headers := map[string]string{}
+	if s.token != "" {
+		headers["Authorization"] = "Bearer " + s.token
+	}
+
+	req, err := httpx.NewRequest("GET", s.templatesURL, nil, headers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	traces := make([]*httpx.Trace, 0, 1)
+
+	trace, err := httpx.DoTrace(s.httpClient, req, s.httpRetries, nil, -1)
+	if trace != nil {
+		traces = append(traces, trace)
+	}
+	if err != nil {
+		return nil, traces, err
+	}
+	if trace.Response.StatusCode != http.StatusOK {
+		return nil, traces, errors.Errorf("RCS templates request failed with status %d", trace.Response.StatusCode)
+	}
+
+	response := &templatesResponse{}
+	if err := jsonx.Unmarshal(trace.ResponseBody, response); err != nil {
+		return nil, traces, errors.Wrap(err, "error unmarshalling RCS templates response")
+	}
+
+	catalog := make([]*models.CatalogTemplate, 0, len(response.Templates))
+	for _, t := range response.Templates {
+		lang, country, err := models.ParseTemplateLocale(t.Language)
+		if err != nil {
+			logrus.WithError(err).WithField("template", t.Name).Warn("ignoring template with unrecognized locale")
+			continue
+		}
+
+		status, found := statuses[strings.ToLower(t.Status)]
+		if !found {
+			status = models.TemplateStatusPending
+		}
+
+		catalog = append(catalog, &models.CatalogTemplate{
+			ExternalID: t.ID,
+			Name:       t.Name,
+			Language:   lang,
+			Country:    country,
+			Content:    t.Content,
+			Status:     status,
+		})
+	}
+
+	return catalog, traces, nil
+}
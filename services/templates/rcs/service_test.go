@@ -0,0 +1,44 @@
+package rcs_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/services/templates/rcs"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://rcs.example.com/templates": {
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"templates": [
+					{"id": "t1", "name": "welcome", "language": "en-GB", "status": "APPROVED", "content": "Welcome {{1}}!"},
+					{"id": "t2", "name": "promo", "language": "en", "status": "rejected", "content": "Buy now"},
+					{"id": "t3", "name": "promo", "language": "rw", "status": "review", "content": "Gura nonaha"}
+				]
+			}`)),
+			httpx.NewMockResponse(403, nil, []byte(`{"error": "forbidden"}`)),
+		},
+	}))
+
+	svc := rcs.NewService(http.DefaultClient, nil, "https://rcs.example.com/templates", "sesame")
+
+	templates, traces, err := svc.FetchTemplates()
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer sesame", traces[0].Request.Header.Get("Authorization"))
+	assert.Equal(t, []*models.CatalogTemplate{
+		{ExternalID: "t1", Name: "welcome", Language: "eng", Country: "GB", Content: "Welcome {{1}}!", Status: models.TemplateStatusApproved},
+		{ExternalID: "t2", Name: "promo", Language: "eng", Content: "Buy now", Status: models.TemplateStatusRejected},
+		{ExternalID: "t3", Name: "promo", Language: "kin", Content: "Gura nonaha", Status: models.TemplateStatusPending},
+	}, templates)
+
+	_, _, err = svc.FetchTemplates()
+	assert.EqualError(t, err, "RCS templates request failed with status 403")
+}
@@ -0,0 +1,230 @@
+package whatsapp
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/sirupsen/logrus"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	configBusinessID         = "fb_business_id"
+	configAccessToken        = "fb_access_token"
+	configNamespace          = "fb_namespace"
+	configTemplateListDomain = "fb_template_list_domain"
+	configAuthToken          = "auth_token"
+	configBaseURL            = "base_url"
+
+	defaultTemplateListDomain = "graph.facebook.com"
+
+	graphTemplatesURL = "https://%s/v14.0/%s/message_templates?limit=255"
+	d360TemplatesURL  = "%s/v1/configs/templates"
+)
+
+func init() {
+	models.RegisterTemplateCatalogService(string(models.ChannelTypeWhatsApp), newGraphService)
+	models.RegisterTemplateCatalogService(string(models.ChannelTypeDialog360), newDialog360Service)
+}
+
+func newGraphService(channel *models.Channel, httpClient *http.Client, httpRetries *httpx.RetryConfig) (models.TemplateCatalogService, error) {
+	businessID := channel.ConfigValue(configBusinessID, "")
+	accessToken := channel.ConfigValue(configAccessToken, "")
+	if businessID == "" || accessToken == "" {
+		return nil, errors.Errorf("missing %s or %s on WhatsApp channel: %s", configBusinessID, configAccessToken, channel.UUID())
+	}
+
+	domain := channel.ConfigValue(configTemplateListDomain, defaultTemplateListDomain)
+	return NewGraphService(httpClient, httpRetries, domain, businessID, accessToken, channel.ConfigValue(configNamespace, "")), nil
+}
+
+func newDialog360Service(channel *models.Channel, httpClient *http.Client, httpRetries *httpx.RetryConfig) (models.TemplateCatalogService, error) {
+	baseURL := channel.ConfigValue(configBaseURL, "")
+	authToken := channel.ConfigValue(configAuthToken, "")
+	if baseURL == "" || authToken == "" {
+		return nil, errors.Errorf("missing %s or %s on 360dialog channel: %s", configBaseURL, configAuthToken, channel.UUID())
+	}
+	return NewDialog360Service(httpClient, httpRetries, baseURL, authToken), nil
+}
+
+// the template format used by the WhatsApp Business Management API which 360dialog also uses
+type waTemplate struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Language   string `json:"language"`
+	Status     string `json:"status"`
+	Namespace  string `json:"namespace"`
+	Components []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"components"`
+}
+
+// WhatsApp template statuses mapped to our statuses, anything else like PENDING or IN_APPEAL is treated as pending
+var waStatuses = map[string]models.TemplateStatus{
+	"APPROVED": models.TemplateStatusApproved,
+	"REJECTED": models.TemplateStatusRejected,
+	"DISABLED": models.TemplateStatusRejected,
+	"PAUSED":   models.TemplateStatusRejected,
+	"DELETED":  models.TemplateStatusRejected,
+}
+
+// converts WhatsApp templates to catalog templates, skipping any without body content
+func toCatalogTemplates(templates []*waTemplate, namespace string) []*models.CatalogTemplate {
+	catalog := make([]*models.CatalogTemplate, 0, len(templates))
+
+	for _, t := range templates {
+		content := ""
+		for _, c := range t.Components {
+			if c.Type == "BODY" {
+				content = c.Text
+			}
+		}
+		if content == "" {
+			continue
+		}
+
+		status, found := waStatuses[strings.ToUpper(t.Status)]
+		if !found {
+			status = models.TemplateStatusPending
+		}
+
+		lang, country, err := models.ParseTemplateLocale(t.Language)
+		if err != nil {
+			logrus.WithError(err).WithField("template", t.Name).Warn("ignoring template with unrecognized locale")
+			continue
+		}
+
+		ns := t.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+
+		catalog = append(catalog, &models.CatalogTemplate{
+			ExternalID: t.ID,
+			Name:       t.Name,
+			Language:   lang,
+			Country:    country,
+			Namespace:  ns,
+			Content:    content,
+			Status:     status,
+		})
+	}
+
+	return catalog
+}
+
+type graphService struct {
+	httpClient  *http.Client
+	httpRetries *httpx.RetryConfig
+	domain      string
+	businessID  string
+	accessToken string
+	namespace   string
+}
+
+// NewGraphService creates a new template catalog service for WhatsApp channels which uses the WhatsApp Business
+// Management API, see https://developers.facebook.com/docs/whatsapp/business-management-api/message-templates
+func NewGraphService(httpClient *http.Client, httpRetries *httpx.RetryConfig, domain, businessID, accessToken, namespace string) models.TemplateCatalogService {
+	return &graphService{httpClient: httpClient, httpRetries: httpRetries, domain: domain, businessID: businessID, accessToken: accessToken, namespace: namespace}
+}
+
+type graphResponse struct {
+	Data   []*waTemplate `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+func (s *graphService) RedactValues() []string {
+	return []string{s.accessToken}
+}
+
+func (s *graphService) FetchTemplates() ([]*models.CatalogTemplate, []*httpx.Trace, error) {
+	templates := make([]*waTemplate, 0, 50)
+	traces := make([]*httpx.Trace, 0, 1)
+
+	// follow the pages of templates until there's no next page
+	next := fmt.Sprintf(graphTemplatesURL, s.domain, url.PathEscape(s.businessID))
+	for next != "" {
+		req, err := httpx.NewRequest("GET", next, nil, map[string]string{"Authorization": "Bearer " + s.accessToken})
+		if err != nil {
+			return nil, traces, err
+		}
+
+		trace, err := httpx.DoTrace(s.httpClient, req, s.httpRetries, nil, -1)
+		if trace != nil {
+			traces = append(traces, trace)
+		}
+		if err != nil {
+			return nil, traces, err
+		}
+		if trace.Response.StatusCode != http.StatusOK {
+			return nil, traces, errors.Errorf("WhatsApp templates request failed with status %d", trace.Response.StatusCode)
+		}
+
+		page := &graphResponse{}
+		if err := jsonx.Unmarshal(trace.ResponseBody, page); err != nil {
+			return nil, traces, errors.Wrap(err, "error unmarshalling WhatsApp templates response")
+		}
+
+		templates = append(templates, page.Data...)
+		next = page.Paging.Next
+	}
+
+	return toCatalogTemplates(templates, s.namespace), traces, nil
+}
+
+type dialog360Service struct {
+	httpClient  *http.Client
+	httpRetries *httpx.RetryConfig
+	baseURL     string
+	authToken   string
+}
+
+// NewDialog360Service creates a new template catalog service for 360dialog channels, see
+// https://docs.360dialog.com/whatsapp-api/whatsapp-api/media/template-messages
+func NewDialog360Service(httpClient *http.Client, httpRetries *httpx.RetryConfig, baseURL, authToken string) models.TemplateCatalogService {
+	return &dialog360Service{httpClient: httpClient, httpRetries: httpRetries, baseURL: strings.TrimSuffix(baseURL, "/"), authToken: authToken}
+}
+
+type dialog360Response struct {
+	Templates []*waTemplate `json:"waba_templates"`
+}
+
+func (s *dialog360Service) RedactValues() []string {
+	return []string{s.authToken}
+}
+
+func (s *dialog360Service) FetchTemplates() ([]*models.CatalogTemplate, []*httpx.Trace, error) {
+	req, err := httpx.NewRequest("GET", fmt.Sprintf(d360TemplatesURL, s.baseURL), nil, map[string]string{"D360-API-KEY": s.authToken})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	traces := make([]*httpx.Trace, 0, 1)
+
+	trace, err := httpx.DoTrace(s.httpClient, req, s.httpRetries, nil, -1)
+	if trace != nil {
+		traces = append(traces, trace)
+	}
+	if err != nil {
+		return nil, traces, err
+	}
+	if trace.Response.StatusCode != http.StatusOK {
+		return nil, traces, errors.Errorf("360dialog templates request failed with status %d", trace.Response.StatusCode)
+	}
+
+	response := &dialog360Response{}
+	if err := jsonx.Unmarshal(trace.ResponseBody, response); err != nil {
+		return nil, traces, errors.Wrap(err, "error unmarshalling 360dialog templates response")
+	}
+
+	return toCatalogTemplates(response.Templates, ""), traces, nil
+}
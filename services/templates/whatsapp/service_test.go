@@ -0,0 +1,87 @@
+package whatsapp_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/nyaruka/gocommon/httpx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/services/templates/whatsapp"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphService(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://graph.facebook.com/v14.0/1234/message_templates?limit=255": {
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"data": [
+					{"id": "1", "name": "revive_issue", "language": "en_US", "status": "APPROVED", "components": [{"type": "BODY", "text": "Hi {{1}}, are you still experiencing problems with {{2}}?"}]},
+					{"id": "2", "name": "goodbye", "language": "fr", "status": "REJECTED", "components": [{"type": "BODY", "text": "Salut!"}]},
+					{"id": "3", "name": "header_only", "language": "en", "status": "APPROVED", "components": [{"type": "HEADER", "text": "Hi"}]}
+				],
+				"paging": {"next": "https://graph.facebook.com/v14.0/1234/message_templates?limit=255&after=MjQZD"}
+			}`)),
+			httpx.NewMockResponse(401, nil, []byte(`{"error": {"message": "Invalid OAuth access token"}}`)),
+		},
+		"https://graph.facebook.com/v14.0/1234/message_templates?limit=255&after=MjQZD": {
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"data": [
+					{"id": "4", "name": "reminder", "language": "xx_YY", "status": "APPROVED", "components": [{"type": "BODY", "text": "Hi"}]},
+					{"id": "5", "name": "reminder", "language": "es", "status": "IN_APPEAL", "components": [{"type": "BODY", "text": "Hola {{1}}"}]}
+				],
+				"paging": {}
+			}`)),
+		},
+	}))
+
+	svc := whatsapp.NewGraphService(http.DefaultClient, nil, "graph.facebook.com", "1234", "sesame", "2d40b45c_25cd_4965_9019_f05d0124c5fa")
+
+	templates, traces, err := svc.FetchTemplates()
+	require.NoError(t, err)
+	assert.Len(t, traces, 2)
+	assert.Equal(t, "Bearer sesame", traces[0].Request.Header.Get("Authorization"))
+	assert.Equal(t, []*models.CatalogTemplate{
+		{ExternalID: "1", Name: "revive_issue", Language: "eng", Country: "US", Namespace: "2d40b45c_25cd_4965_9019_f05d0124c5fa", Content: "Hi {{1}}, are you still experiencing problems with {{2}}?", Status: models.TemplateStatusApproved},
+		{ExternalID: "2", Name: "goodbye", Language: "fra", Country: "", Namespace: "2d40b45c_25cd_4965_9019_f05d0124c5fa", Content: "Salut!", Status: models.TemplateStatusRejected},
+		{ExternalID: "5", Name: "reminder", Language: "spa", Country: "", Namespace: "2d40b45c_25cd_4965_9019_f05d0124c5fa", Content: "Hola {{1}}", Status: models.TemplateStatusPending},
+	}, templates)
+	assert.Equal(t, []string{"sesame"}, svc.RedactValues())
+
+	_, traces, err = svc.FetchTemplates()
+	assert.EqualError(t, err, "WhatsApp templates request failed with status 401")
+	assert.Len(t, traces, 1)
+}
+
+func TestDialog360Service(t *testing.T) {
+	defer httpx.SetRequestor(httpx.DefaultRequestor)
+
+	httpx.SetRequestor(httpx.NewMockRequestor(map[string][]*httpx.MockResponse{
+		"https://waba.360dialog.io/v1/configs/templates": {
+			httpx.NewMockResponse(200, nil, []byte(`{
+				"waba_templates": [
+					{"name": "revive_issue", "language": "en", "status": "approved", "namespace": "abc_123", "components": [{"type": "BODY", "text": "Hi {{1}}"}]},
+					{"name": "goodbye", "language": "pt_BR", "status": "submitted", "namespace": "abc_123", "components": [{"type": "BODY", "text": "Tchau!"}]}
+				]
+			}`)),
+			httpx.NewMockResponse(500, nil, []byte(`oops`)),
+		},
+	}))
+
+	svc := whatsapp.NewDialog360Service(http.DefaultClient, nil, "https://waba.360dialog.io/", "sesame")
+
+	templates, traces, err := svc.FetchTemplates()
+	require.NoError(t, err)
+	assert.Len(t, traces, 1)
+	assert.Equal(t, "sesame", traces[0].Request.Header.Get("D360-API-KEY"))
+	assert.Equal(t, []*models.CatalogTemplate{
+		{Name: "revive_issue", Language: "eng", Namespace: "abc_123", Content: "Hi {{1}}", Status: models.TemplateStatusApproved},
+		{Name: "goodbye", Language: "por", Country: "BR", Namespace: "abc_123", Content: "Tchau!", Status: models.TemplateStatusPending},
+	}, templates)
+
+	_, _, err = svc.FetchTemplates()
+	assert.EqualError(t, err, "360dialog templates request failed with status 500")
+}
@@ -145,6 +145,8 @@ func Close(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, ticke
 		return errors.Wrap(err, "error closing ticket")
 	}
 
+	models.PublishTicketEvents(ctx, rt, oa.OrgID(), events)
+
 	if len(events) == 1 {
 		rc := rt.RP.Get()
 		defer rc.Close()
@@ -160,6 +162,11 @@ func Close(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, ticke
 
 // Reopen reopens the given ticket
 func Reopen(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, ticket *models.Ticket, externally bool, l *models.HTTPLogger) error {
-	_, err := models.ReopenTickets(ctx, rt, oa, models.NilUserID, []*models.Ticket{ticket}, externally, l)
-	return err
+	events, err := models.ReopenTickets(ctx, rt, oa, models.NilUserID, []*models.Ticket{ticket}, externally, l)
+	if err != nil {
+		return err
+	}
+
+	models.PublishTicketEvents(ctx, rt, oa.OrgID(), events)
+	return nil
 }
@@ -6,6 +6,8 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 	"testing"
 
@@ -70,6 +72,7 @@ func Get() (context.Context, *runtime.Runtime, *sqlx.DB, *redis.Pool) {
 		DB:                db,
 		ReadonlyDB:        db,
 		RP:                rp,
+		PubSubRP:          rp,
 		ES:                nil,
 		AttachmentStorage: storage.NewFS(AttachmentStorageDir, 0766),
 		SessionStorage:    storage.NewFS(SessionStorageDir, 0766),
@@ -159,6 +162,24 @@ func loadTestDump() {
 		_db.Close()
 		_db = nil
 	}
+
+	applyMigrations(path.Join(dir, "migrations"))
+}
+
+// applies the schema changes in the given directory, in order, which haven't yet made it into the RapidPro dump
+func applyMigrations(dir string) {
+	files, err := filepath.Glob(path.Join(dir, "*.sql"))
+	noError(err)
+	sort.Strings(files)
+
+	db := getDB()
+
+	for _, file := range files {
+		sql, err := os.ReadFile(file)
+		noError(err)
+
+		db.MustExec(string(sql))
+	}
 }
 
 // resets our redis database
@@ -187,12 +208,20 @@ DELETE FROM notifications_notification;
 DELETE FROM notifications_incident;
 DELETE FROM request_logs_httplog;
 DELETE FROM tickets_ticketdailycount;
+DELETE FROM classifiers_llmdailycount;
+DELETE FROM orgs_analyticsdailycount;
 DELETE FROM tickets_ticketevent;
 DELETE FROM tickets_ticket;
 DELETE FROM triggers_trigger_contacts WHERE trigger_id >= 30000;
 DELETE FROM triggers_trigger_groups WHERE trigger_id >= 30000;
 DELETE FROM triggers_trigger WHERE id >= 30000;
 DELETE FROM channels_channelcount;
+DELETE FROM orgs_featureflag;
+DELETE FROM msgs_contentpolicylog;
+DELETE FROM links_trackedlink;
+DELETE FROM msgs_msgsuppression;
+DELETE FROM msgs_broadcastpreview;
+DELETE FROM msgs_conversation;
 DELETE FROM msgs_msg;
 DELETE FROM flows_flowrun;
 DELETE FROM flows_flowpathcount;
@@ -206,6 +235,8 @@ DELETE FROM ivr_call;
 DELETE FROM campaigns_eventfire;
 DELETE FROM campaigns_campaignevent WHERE id >= 30000;
 DELETE FROM campaigns_campaign WHERE id >= 30000;
+DELETE FROM contacts_contactevent;
+DELETE FROM contacts_contactnote;
 DELETE FROM contacts_contactimportbatch;
 DELETE FROM contacts_contactimport;
 DELETE FROM contacts_contacturn WHERE id >= 30000;
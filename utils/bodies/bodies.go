@@ -0,0 +1,54 @@
+package bodies
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// buffers are reused between requests so that reading lots of bodies doesn't mean lots of allocations as each grows
+var buffers = sync.Pool{New: func() interface{} { return &bytes.Buffer{} }}
+
+// Read reads the body of the given request, replacing it with a copy so that it can be read again. Request bodies should
+// be limited by the server, see Limit, in which case reading a body that is too large returns an error for which
+// IsTooLarge is true.
+func Read(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	buf := buffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer buffers.Put(buf)
+
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		return nil, err
+	}
+	r.Body.Close()
+
+	body := make([]byte, buf.Len())
+	copy(body, buf.Bytes())
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// Limit limits the body of the given request to the given number of bytes, returning false if its content length
+// already says that it's too large
+func Limit(w http.ResponseWriter, r *http.Request, maxBytes int64) bool {
+	if r.ContentLength > maxBytes {
+		return false
+	}
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	}
+	return true
+}
+
+// IsTooLarge returns whether the given error is from reading a request body which is larger than its limit
+func IsTooLarge(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
@@ -0,0 +1,43 @@
+package bodies_test
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/utils/bodies"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodies(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"foo": "bar"}`))
+	w := httptest.NewRecorder()
+
+	assert.True(t, bodies.Limit(w, r, 100))
+
+	body, err := bodies.Read(r)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"foo": "bar"}`, string(body))
+
+	// body can be read again
+	again, err := io.ReadAll(r.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"foo": "bar"}`, string(again))
+
+	// content length says body is too large
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"foo": "bar"}`))
+	assert.False(t, bodies.Limit(w, r, 10))
+
+	// content length doesn't say so but reading finds out
+	r = httptest.NewRequest("POST", "/", strings.NewReader(`{"foo": "bar"}`))
+	r.ContentLength = -1
+	assert.True(t, bodies.Limit(w, r, 10))
+
+	_, err = bodies.Read(r)
+	assert.Error(t, err)
+	assert.True(t, bodies.IsTooLarge(err))
+	assert.True(t, bodies.IsTooLarge(errors.Wrap(err, "error reading body")))
+	assert.False(t, bodies.IsTooLarge(errors.New("boom")))
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/trace"
 	"github.com/nyaruka/redisx"
 	"github.com/sirupsen/logrus"
 )
@@ -95,9 +96,12 @@ func Start(rt *runtime.Runtime, wg *sync.WaitGroup, name string, interval time.D
 // fireCron is just a wrapper around the cron function we will call for the purposes of
 // catching and logging panics
 func fireCron(rt *runtime.Runtime, cronFunc Function, lockName string, lockValue string) error {
-	log := logrus.WithField("lockValue", lockValue).WithField("func", cronFunc)
+	// each run of a cron gets its own trace ID
+	traceID := trace.NewID()
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	log := logrus.WithField("lockValue", lockValue).WithField("func", cronFunc).WithField("trace_id", traceID)
+
+	ctx, cancel := context.WithTimeout(trace.WithID(context.Background(), traceID), time.Minute*5)
 	defer cancel()
 
 	defer func() {
@@ -0,0 +1,60 @@
+package httplogs
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nyaruka/goflow/flows"
+)
+
+// how long a value is kept for if it's never taken, e.g. because the call was made in a simulation
+const expiry = 5 * time.Minute
+
+// the number of values held at which we start pruning expired ones
+const pruneSize = 1000
+
+type entry[T any] struct {
+	value      T
+	recordedOn time.Time
+}
+
+// Store holds values which services get from the responses of their calls against the HTTP logs of those calls. The
+// engine only tells us about service calls through events with their HTTP logs, so this is how values like the number
+// of tokens an LLM call used reach the handlers of those events.
+type Store[T any] struct {
+	mutex   sync.Mutex
+	entries map[*flows.HTTPLog]entry[T]
+}
+
+// NewStore creates a new empty store
+func NewStore[T any]() *Store[T] {
+	return &Store[T]{entries: make(map[*flows.HTTPLog]entry[T])}
+}
+
+// Put records the given value against the given log
+func (s *Store[T]) Put(log *flows.HTTPLog, value T) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+
+	if len(s.entries) >= pruneSize {
+		for l, e := range s.entries {
+			if now.Sub(e.recordedOn) > expiry {
+				delete(s.entries, l)
+			}
+		}
+	}
+
+	s.entries[log] = entry[T]{value: value, recordedOn: now}
+}
+
+// Take returns the value recorded against the given log, and removes it so it can only be taken once
+func (s *Store[T]) Take(log *flows.HTTPLog) (T, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, found := s.entries[log]
+	delete(s.entries, log)
+	return e.value, found
+}
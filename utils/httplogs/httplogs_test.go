@@ -0,0 +1,28 @@
+package httplogs_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/utils/httplogs"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	store := httplogs.NewStore[int]()
+	log1, log2 := &flows.HTTPLog{}, &flows.HTTPLog{}
+
+	store.Put(log1, 72)
+
+	v, found := store.Take(log2)
+	assert.False(t, found)
+	assert.Equal(t, 0, v)
+
+	v, found = store.Take(log1)
+	assert.True(t, found)
+	assert.Equal(t, 72, v)
+
+	// values can only be taken once
+	_, found = store.Take(log1)
+	assert.False(t, found)
+}
@@ -0,0 +1,49 @@
+package logs
+
+import (
+	"context"
+
+	"github.com/nyaruka/mailroom/utils/trace"
+	"github.com/sirupsen/logrus"
+)
+
+type contextKey int
+
+const fieldsKey contextKey = 0
+
+// With returns a copy of the given context whose logger has the given field, e.g. the org or contact that the request or
+// task is working on, so that everything logged while doing that work can be tied together
+func With(ctx context.Context, key string, value interface{}) context.Context {
+	existing, _ := ctx.Value(fieldsKey).(logrus.Fields)
+
+	fields := make(logrus.Fields, len(existing)+1)
+	for k, v := range existing {
+		fields[k] = v
+	}
+	fields[key] = value
+
+	return context.WithValue(ctx, fieldsKey, fields)
+}
+
+// From returns the logger for the given context which has the trace ID of the context and any fields added to it
+func From(ctx context.Context) *logrus.Entry {
+	entry := logrus.NewEntry(logrus.StandardLogger())
+
+	if fields, _ := ctx.Value(fieldsKey).(logrus.Fields); len(fields) > 0 {
+		entry = entry.WithFields(fields)
+	}
+	if traceID := trace.FromContext(ctx); traceID != trace.NilID {
+		entry = entry.WithField("trace_id", traceID)
+	}
+
+	return entry
+}
+
+// SetFormat sets the format of log output which can be text or json
+func SetFormat(format string) {
+	if format == "json" {
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	} else {
+		logrus.SetFormatter(&logrus.TextFormatter{})
+	}
+}
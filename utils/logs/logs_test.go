@@ -0,0 +1,23 @@
+package logs_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/mailroom/utils/logs"
+	"github.com/nyaruka/mailroom/utils/trace"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogs(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, logrus.Fields{}, logs.From(ctx).Data)
+
+	ctx = trace.WithID(ctx, trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"))
+	ctx1 := logs.With(ctx, "org_id", 1)
+	ctx2 := logs.With(ctx1, "contact_id", 1234)
+
+	assert.Equal(t, logrus.Fields{"trace_id": trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"), "org_id": 1}, logs.From(ctx1).Data)
+	assert.Equal(t, logrus.Fields{"trace_id": trace.ID("5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2"), "org_id": 1, "contact_id": 1234}, logs.From(ctx2).Data)
+}
@@ -0,0 +1,64 @@
+package logs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/getsentry/raven-go"
+	"github.com/nyaruka/logrus_sentry"
+	"github.com/sirupsen/logrus"
+)
+
+// fields of log entries which are sent to Sentry as tags so that errors can be triaged by them
+var sentryTagFields = map[string]bool{"org_id": true, "task_type": true, "queue": true, "channel_uuid": true, "channel_type": true}
+
+// SentryHook is a logrus hook which reports errors to Sentry, tagged with the org, task type and channel they relate to
+type SentryHook struct {
+	*logrus_sentry.SentryHook
+}
+
+// NewSentryHook creates a new hook which reports errors to Sentry using the given DSN
+func NewSentryHook(dsn string) (*SentryHook, error) {
+	hook, err := logrus_sentry.NewSentryHook(dsn, []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel})
+	if err != nil {
+		return nil, err
+	}
+
+	hook.Timeout = 0
+	hook.StacktraceConfiguration.Enable = true
+	hook.StacktraceConfiguration.Skip = 5
+	hook.StacktraceConfiguration.Context = 5
+	hook.StacktraceConfiguration.IncludeErrorBreadcrumb = true
+
+	return &SentryHook{hook}, nil
+}
+
+// Fire reports the given entry to Sentry
+func (h *SentryHook) Fire(entry *logrus.Entry) error {
+	tagged := *entry
+	tagged.Data = TagFields(entry.Data)
+
+	return h.SentryHook.Fire(&tagged)
+}
+
+// TagFields returns a copy of the given fields with those that should be tags also added as Sentry tags
+func TagFields(fields logrus.Fields) logrus.Fields {
+	tags := make(raven.Tags, 0, len(sentryTagFields))
+	tagged := make(logrus.Fields, len(fields)+1)
+
+	for key, value := range fields {
+		tagged[key] = value
+
+		if sentryTagFields[key] {
+			tags = append(tags, raven.Tag{Key: key, Value: fmt.Sprint(value)})
+		}
+	}
+
+	if len(tags) > 0 {
+		// sort our tags so that they're consistent across events
+		sort.Slice(tags, func(i, j int) bool { return tags[i].Key < tags[j].Key })
+		tagged["tags"] = tags
+	}
+
+	return tagged
+}
@@ -0,0 +1,31 @@
+package logs_test
+
+import (
+	"testing"
+
+	"github.com/getsentry/raven-go"
+	"github.com/nyaruka/mailroom/utils/logs"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagFields(t *testing.T) {
+	// fields without any tag fields are copied as is
+	fields := logrus.Fields{"contact_id": 1234}
+	assert.Equal(t, logrus.Fields{"contact_id": 1234}, logs.TagFields(fields))
+
+	fields = logrus.Fields{"task_type": "start_flow", "contact_id": 1234, "org_id": 1, "channel_type": "T"}
+	assert.Equal(t, logrus.Fields{
+		"task_type":    "start_flow",
+		"contact_id":   1234,
+		"org_id":       1,
+		"channel_type": "T",
+		"tags":         raven.Tags{{Key: "channel_type", Value: "T"}, {Key: "org_id", Value: "1"}, {Key: "task_type", Value: "start_flow"}},
+	}, logs.TagFields(fields))
+
+	// original fields aren't modified
+	assert.NotContains(t, fields, "tags")
+
+	_, err := logs.NewSentryHook("not a dsn")
+	assert.Error(t, err)
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/nyaruka/gocommon/analytics"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// PrometheusBackend is an analytics backend which holds the latest value of each gauge and serves them for scraping
+// by Prometheus
+type PrometheusBackend struct {
+	address string
+	server  *http.Server
+	wg      *sync.WaitGroup
+
+	mutex  sync.Mutex
+	gauges map[string]float64
+}
+
+// NewPrometheus creates a new Prometheus backend which will serve metrics at /metrics on the given address
+func NewPrometheus(address string, wg *sync.WaitGroup) *PrometheusBackend {
+	return &PrometheusBackend{address: address, wg: wg, gauges: make(map[string]float64)}
+}
+
+func (b *PrometheusBackend) Name() string {
+	return "prometheus"
+}
+
+func (b *PrometheusBackend) Start() error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", string(expfmt.FmtText))
+		b.WriteTo(w)
+	})
+
+	b.server = &http.Server{Addr: b.address, Handler: mux}
+	b.wg.Add(1)
+
+	go func() {
+		defer b.wg.Done()
+
+		if err := b.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.WithError(err).WithField("comp", "prometheus").Error("error serving metrics")
+		}
+	}()
+
+	return nil
+}
+
+// Gauge records the value of a gauge, e.g. mr.handle_elapsed becomes the metric mr_handle_elapsed
+func (b *PrometheusBackend) Gauge(name string, value float64) {
+	b.mutex.Lock()
+	b.gauges[invalidNameChars.ReplaceAllString(name, "_")] = value
+	b.mutex.Unlock()
+}
+
+// WriteTo writes the latest value of each gauge in the Prometheus text format
+func (b *PrometheusBackend) WriteTo(w io.Writer) (int64, error) {
+	b.mutex.Lock()
+	names := make([]string, 0, len(b.gauges))
+	for name := range b.gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	families := make([]*dto.MetricFamily, len(names))
+	for i, name := range names {
+		families[i] = &dto.MetricFamily{
+			Name:   proto.String(name),
+			Help:   proto.String(fmt.Sprintf("the latest value of %s", name)),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: proto.Float64(b.gauges[name])}}},
+		}
+	}
+	b.mutex.Unlock()
+
+	var total int64
+	for _, family := range families {
+		n, err := expfmt.MetricFamilyToText(w, family)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+func (b *PrometheusBackend) Stop() error {
+	if b.server != nil {
+		return b.server.Shutdown(context.Background())
+	}
+	return nil
+}
+
+var _ analytics.Backend = (*PrometheusBackend)(nil)
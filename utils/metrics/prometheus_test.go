@@ -0,0 +1,30 @@
+package metrics_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/nyaruka/mailroom/utils/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrometheus(t *testing.T) {
+	b := metrics.NewPrometheus("localhost:0", &sync.WaitGroup{})
+	assert.Equal(t, "prometheus", b.Name())
+
+	b.Gauge("mr.handle_elapsed", 1.5)
+	b.Gauge("mr.batch-latency", 3)
+	b.Gauge("mr.handle_elapsed", 2.25)
+
+	out := &strings.Builder{}
+	_, err := b.WriteTo(out)
+	assert.NoError(t, err)
+	assert.Equal(t, `# HELP mr_batch_latency the latest value of mr_batch_latency
+# TYPE mr_batch_latency gauge
+mr_batch_latency 3
+# HELP mr_handle_elapsed the latest value of mr_handle_elapsed
+# TYPE mr_handle_elapsed gauge
+mr_handle_elapsed 2.25
+`, out.String())
+}
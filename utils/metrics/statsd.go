@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/nyaruka/gocommon/analytics"
+	"github.com/pkg/errors"
+)
+
+// StatsdBackend is an analytics backend which sends gauges to a StatsD server over UDP
+type StatsdBackend struct {
+	address string
+	conn    net.Conn
+}
+
+// NewStatsd creates a new StatsD backend which will send to the server at the given host:port
+func NewStatsd(address string) *StatsdBackend {
+	return &StatsdBackend{address: address}
+}
+
+func (b *StatsdBackend) Name() string {
+	return "statsd"
+}
+
+func (b *StatsdBackend) Start() error {
+	conn, err := net.Dial("udp", b.address)
+	if err != nil {
+		return errors.Wrapf(err, "error connecting to statsd server at %s", b.address)
+	}
+	b.conn = conn
+	return nil
+}
+
+// Gauge sends the value of a gauge, ignoring any errors as StatsD delivery is best effort anyway
+func (b *StatsdBackend) Gauge(name string, value float64) {
+	if b.conn == nil {
+		return
+	}
+
+	formatted := strconv.FormatFloat(value, 'f', -1, 64)
+
+	// a signed value would be read as a change to the gauge, so negative values have to be sent after zeroing it
+	if value < 0 {
+		fmt.Fprintf(b.conn, "%s:0|g\n%s:%s|g", name, name, formatted)
+	} else {
+		fmt.Fprintf(b.conn, "%s:%s|g", name, formatted)
+	}
+}
+
+func (b *StatsdBackend) Stop() error {
+	if b.conn != nil {
+		return b.conn.Close()
+	}
+	return nil
+}
+
+var _ analytics.Backend = (*StatsdBackend)(nil)
@@ -0,0 +1,44 @@
+package metrics_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/utils/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsd(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer server.Close()
+
+	receive := func() string {
+		buf := make([]byte, 1024)
+		server.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := server.ReadFrom(buf)
+		require.NoError(t, err)
+		return string(buf[:n])
+	}
+
+	b := metrics.NewStatsd(server.LocalAddr().String())
+	assert.Equal(t, "statsd", b.Name())
+
+	// gauges before starting are dropped
+	b.Gauge("mr.dropped", 1)
+
+	require.NoError(t, b.Start())
+
+	b.Gauge("mr.handle_elapsed", 1.5)
+	assert.Equal(t, "mr.handle_elapsed:1.5|g", receive())
+
+	b.Gauge("mr.queue_size", 2000000)
+	assert.Equal(t, "mr.queue_size:2000000|g", receive())
+
+	b.Gauge("mr.drift", -3)
+	assert.Equal(t, "mr.drift:0|g\nmr.drift:-3|g", receive())
+
+	assert.NoError(t, b.Stop())
+}
@@ -0,0 +1,79 @@
+package orgkeys
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Pattern is the format of redis keys which belong to a single org, where the first verb is the org id. Everything which
+// builds such keys registers its pattern so that we can tell which org any key in the keyspace belongs to.
+type Pattern struct {
+	format string
+	regex  *regexp.Regexp
+}
+
+var (
+	registered []*Pattern
+	mutex      sync.RWMutex
+)
+
+// Register registers the format of redis keys which belong to a single org, returning the pattern which should be used
+// to build those keys. The first verb of the format must be the %d of the org id, and the others can be %d or %s.
+func Register(format string) *Pattern {
+	if i := strings.Index(format, "%"); i < 0 || !strings.HasPrefix(format[i:], "%d") {
+		panic(fmt.Sprintf("org key format '%s' doesn't start with the org id", format))
+	}
+
+	// the first verb is captured as the org id, the rest just have to match something
+	expr := regexp.QuoteMeta(format)
+	expr = strings.Replace(expr, "%d", `(\d+)`, 1)
+	expr = strings.ReplaceAll(expr, "%d", `\d+`)
+	expr = strings.ReplaceAll(expr, "%s", `.+`)
+
+	p := &Pattern{format: format, regex: regexp.MustCompile("^" + expr + "$")}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	registered = append(registered, p)
+	return p
+}
+
+// Key builds a key with this pattern for the given org
+func (p *Pattern) Key(orgID int, args ...interface{}) string {
+	return fmt.Sprintf(p.format, append([]interface{}{orgID}, args...)...)
+}
+
+// Format returns the format of this pattern
+func (p *Pattern) Format() string {
+	return p.format
+}
+
+// OrgID returns the id of the org the given key belongs to, or zero if it doesn't match any registered pattern
+func OrgID(key string) int {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for _, p := range registered {
+		if m := p.regex.FindStringSubmatch(key); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			return id
+		}
+	}
+	return 0
+}
+
+// Formats returns the formats of all registered patterns
+func Formats() []string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	formats := make([]string, len(registered))
+	for i, p := range registered {
+		formats[i] = p.format
+	}
+	return formats
+}
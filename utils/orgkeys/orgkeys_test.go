@@ -0,0 +1,132 @@
+package orgkeys_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	_ "github.com/nyaruka/mailroom/core/models"
+	_ "github.com/nyaruka/mailroom/core/queue"
+	_ "github.com/nyaruka/mailroom/core/tasks/contacts"
+	_ "github.com/nyaruka/mailroom/core/tasks/flows"
+	_ "github.com/nyaruka/mailroom/core/tasks/handler"
+	_ "github.com/nyaruka/mailroom/core/tasks/orgs"
+	"github.com/nyaruka/mailroom/utils/orgkeys"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatterns(t *testing.T) {
+	p1 := orgkeys.Register("test_things:%d")
+	p2 := orgkeys.Register("test_stuff:%d:%s:%d")
+
+	assert.Equal(t, "test_things:%d", p1.Format())
+	assert.Equal(t, "test_things:12", p1.Key(12))
+	assert.Equal(t, "test_stuff:34:foo:56", p2.Key(34, "foo", 56))
+	assert.Contains(t, orgkeys.Formats(), "test_stuff:%d:%s:%d")
+
+	assert.Equal(t, 12, orgkeys.OrgID("test_things:12"))
+	assert.Equal(t, 34, orgkeys.OrgID("test_stuff:34:foo:bar:56"))
+	assert.Equal(t, 0, orgkeys.OrgID("test_things:active"))
+	assert.Equal(t, 0, orgkeys.OrgID("test_things:12:extra"))
+	assert.Equal(t, 0, orgkeys.OrgID("test_stuff:34:foo"))
+	assert.Equal(t, 0, orgkeys.OrgID("other_things:12"))
+
+	assert.Panics(t, func() { orgkeys.Register("test_things") })
+	assert.Panics(t, func() { orgkeys.Register("test_things:%s:%d") })
+}
+
+// keys which are built with an org id but aren't stored in redis
+var notRedisKeys = map[string]bool{
+	"o:%d":          true, // counts scopes
+	"o:%d:u:%d":     true,
+	"o:%d:ch:%d":    true,
+	"org_events:%d": true, // pubsub channel
+}
+
+// TestAllOrgKeysRegistered looks for keys built by formatting an org id into a prefix anywhere in our code, and checks
+// that each has a registered pattern so that its usage is attributed to the org
+func TestAllOrgKeysRegistered(t *testing.T) {
+	keyFormat := regexp.MustCompile(`^[a-z_:]+%d`)
+	fset := token.NewFileSet()
+
+	err := filepath.WalkDir("../..", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "testsuite" || name == "vendor" || strings.HasPrefix(name, ".") && name != ".." {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+
+		src, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+
+		// formats can be string constants declared in the same file
+		consts := make(map[string]string)
+		ast.Inspect(src, func(n ast.Node) bool {
+			if spec, ok := n.(*ast.ValueSpec); ok {
+				for i, name := range spec.Names {
+					if i < len(spec.Values) {
+						if lit, ok := spec.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+							consts[name.Name], _ = strconv.Unquote(lit.Value)
+						}
+					}
+				}
+			}
+			return true
+		})
+
+		ast.Inspect(src, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) < 2 {
+				return true
+			}
+			if sel, ok := call.Fun.(*ast.SelectorExpr); !ok || sel.Sel.Name != "Sprintf" {
+				return true
+			}
+
+			var format string
+			switch arg := call.Args[0].(type) {
+			case *ast.BasicLit:
+				format, _ = strconv.Unquote(arg.Value)
+			case *ast.Ident:
+				format = consts[arg.Name]
+			}
+
+			if !keyFormat.MatchString(format) || notRedisKeys[format] || !mentionsOrg(call.Args[1]) {
+				return true
+			}
+
+			sample := strings.ReplaceAll(strings.ReplaceAll(format, "%d", "123"), "%s", "abc")
+			assert.Equal(t, 123, orgkeys.OrgID(sample), "org key '%s' built at %s has no registered pattern", format, fset.Position(call.Pos()))
+			return true
+		})
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func mentionsOrg(expr ast.Expr) bool {
+	found := false
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && strings.Contains(strings.ToLower(id.Name), "org") {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
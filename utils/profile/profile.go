@@ -0,0 +1,141 @@
+package profile
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/pkg/errors"
+)
+
+// Kind is the kind of profile to capture
+type Kind string
+
+const (
+	KindCPU  = Kind("cpu")
+	KindHeap = Kind("heap")
+)
+
+// the redis hash of task type to kind of profile requested
+const requestsKey = "profile_requests"
+
+// how often each process refreshes its view of which task types have pending requests
+const refreshInterval = 10 * time.Second
+
+// Request requests that a profile of the given kind be captured for the next task of the given type which runs on
+// any instance. A later request for the same task type replaces any that hasn't been claimed yet.
+func Request(rc redis.Conn, taskType string, kind Kind) error {
+	_, err := rc.Do("HSET", requestsKey, taskType, string(kind))
+	return errors.Wrap(err, "error requesting profile")
+}
+
+var claimScript = redis.NewScript(2, `
+local key, task_type = KEYS[1], KEYS[2]
+
+local kind = redis.call("HGET", key, task_type)
+if kind then
+	redis.call("HDEL", key, task_type)
+	return kind
+end
+return ""
+`)
+
+// Claim claims the pending profile request for the given task type, returning the kind of profile to capture or
+// empty string if there isn't one. Requests are only seen by each process every few seconds so this is cheap to call
+// before every task.
+func Claim(rp *redis.Pool, taskType string) (Kind, error) {
+	if !pending.has(rp, taskType) {
+		return "", nil
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	kind, err := redis.String(claimScript.Do(rc, requestsKey, taskType))
+	if err != nil {
+		return "", errors.Wrap(err, "error claiming profile request")
+	}
+	return Kind(kind), nil
+}
+
+// Capture runs the given function whilst capturing a profile of the given kind, returning the encoded profile.
+// CPU profiles cover only the running of the function but since only one can be captured at a time by a process,
+// other work happening concurrently will be included too. Heap profiles are a snapshot taken when the function ends.
+func Capture(kind Kind, fn func()) ([]byte, error) {
+	b := &bytes.Buffer{}
+
+	switch kind {
+	case KindCPU:
+		if err := captureCPU(b, fn); err != nil {
+			return nil, err
+		}
+
+	case KindHeap:
+		fn()
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(b); err != nil {
+			return nil, errors.Wrap(err, "error writing heap profile")
+		}
+
+	default:
+		fn()
+		return nil, errors.Errorf("unknown profile kind: %s", kind)
+	}
+
+	return b.Bytes(), nil
+}
+
+// runs the given function while capturing a CPU profile, which is stopped even if the function panics as otherwise the
+// profile would keep running and no other profile could be captured
+func captureCPU(w io.Writer, fn func()) error {
+	// the function must always run, even if we can't profile it
+	if err := pprof.StartCPUProfile(w); err != nil {
+		fn()
+		return errors.Wrap(err, "error starting CPU profile")
+	}
+	defer pprof.StopCPUProfile()
+
+	fn()
+	return nil
+}
+
+// Path returns the storage path for a profile of the given kind captured for a task of the given type
+func Path(taskType string, kind Kind, capturedOn time.Time) string {
+	return fmt.Sprintf("profiles/%s/%s_%s.pprof", taskType, capturedOn.UTC().Format("20060102T150405.000"), kind)
+}
+
+// a periodically refreshed local copy of which task types have pending requests
+type pendingTypes struct {
+	mutex       sync.Mutex
+	types       map[string]bool
+	refreshedOn time.Time
+}
+
+var pending = &pendingTypes{}
+
+func (p *pendingTypes) has(rp *redis.Pool, taskType string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if time.Since(p.refreshedOn) > refreshInterval {
+		rc := rp.Get()
+		types, err := redis.Strings(rc.Do("HKEYS", requestsKey))
+		rc.Close()
+
+		// on error keep using what we have and try again next time
+		if err == nil {
+			p.types = make(map[string]bool, len(types))
+			for _, t := range types {
+				p.types[t] = true
+			}
+		}
+		p.refreshedOn = time.Now()
+	}
+
+	return p.types[taskType]
+}
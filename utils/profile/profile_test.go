@@ -0,0 +1,76 @@
+package profile_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/utils/profile"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCapture(t *testing.T) {
+	ran := 0
+	work := func() {
+		ran++
+		x := make([]int, 0)
+		for i := 0; i < 100000; i++ {
+			x = append(x, i)
+		}
+	}
+
+	data, err := profile.Capture(profile.KindCPU, work)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+	assert.Equal(t, 1, ran)
+
+	data, err = profile.Capture(profile.KindHeap, work)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+	assert.Equal(t, 2, ran)
+
+	// function is still run even if we can't profile it
+	_, err = profile.Capture(profile.Kind("goroutine"), work)
+	assert.EqualError(t, err, "unknown profile kind: goroutine")
+	assert.Equal(t, 3, ran)
+
+	// a panicking function doesn't leave the CPU profile running
+	assert.Panics(t, func() { profile.Capture(profile.KindCPU, func() { panic("boom") }) })
+
+	data, err = profile.Capture(profile.KindCPU, work)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, data)
+	assert.Equal(t, 4, ran)
+}
+
+func TestPath(t *testing.T) {
+	capturedOn := time.Date(2022, 12, 20, 15, 30, 45, 123456789, time.UTC)
+
+	assert.Equal(t, "profiles/start_flow_batch/20221220T153045.123_cpu.pprof", profile.Path("start_flow_batch", profile.KindCPU, capturedOn))
+}
+
+func TestRequestAndClaim(t *testing.T) {
+	_, _, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	require.NoError(t, profile.Request(rc, "start_flow_batch", profile.KindCPU))
+
+	kind, err := profile.Claim(rp, "handle_contact_event")
+	assert.NoError(t, err)
+	assert.Equal(t, profile.Kind(""), kind)
+
+	kind, err = profile.Claim(rp, "start_flow_batch")
+	assert.NoError(t, err)
+	assert.Equal(t, profile.KindCPU, kind)
+
+	// request can only be claimed once
+	kind, err = profile.Claim(rp, "start_flow_batch")
+	assert.NoError(t, err)
+	assert.Equal(t, profile.Kind(""), kind)
+}
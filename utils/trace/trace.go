@@ -0,0 +1,59 @@
+package trace
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"github.com/nyaruka/gocommon/uuids"
+)
+
+// ID identifies the API request, task or cron run which is doing some work, so that any rows it creates can be tied
+// back to it
+type ID string
+
+// NilID is our nil value for trace IDs
+const NilID = ID("")
+
+// MaxLength is the longest trace ID which can be stored on rows
+const MaxLength = 64
+
+type contextKey int
+
+const idKey contextKey = 0
+
+// NewID generates a new random trace ID
+func NewID() ID {
+	return ID(uuids.New())
+}
+
+// WithID returns a copy of the given context which carries the given trace ID
+func WithID(ctx context.Context, id ID) context.Context {
+	return context.WithValue(ctx, idKey, id)
+}
+
+// FromContext returns the trace ID carried by the given context or NilID if it doesn't have one
+func FromContext(ctx context.Context) ID {
+	id, _ := ctx.Value(idKey).(ID)
+	return id
+}
+
+// Value returns the SQL value of this trace ID, writing nil IDs as NULL
+func (i ID) Value() (driver.Value, error) {
+	if i == NilID {
+		return nil, nil
+	}
+	return string(i), nil
+}
+
+// Scan scans a trace ID from a SQL value, reading NULL as the nil ID
+func (i *ID) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*i = NilID
+	case string:
+		*i = ID(v)
+	case []byte:
+		*i = ID(v)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package trace_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/utils/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrace(t *testing.T) {
+	defer uuids.SetGenerator(uuids.DefaultGenerator)
+	uuids.SetGenerator(uuids.NewSeededGenerator(1234))
+
+	ctx := context.Background()
+	assert.Equal(t, trace.NilID, trace.FromContext(ctx))
+
+	id := trace.NewID()
+	assert.Equal(t, trace.ID("c00e5d67-c275-4389-aded-7d8b151cbd5b"), id)
+
+	ctx = trace.WithID(ctx, id)
+	assert.Equal(t, id, trace.FromContext(ctx))
+
+	v, err := trace.NilID.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+
+	v, err = id.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "c00e5d67-c275-4389-aded-7d8b151cbd5b", v)
+
+	var scanned trace.ID
+	assert.NoError(t, scanned.Scan([]byte("abc")))
+	assert.Equal(t, trace.ID("abc"), scanned)
+	assert.NoError(t, scanned.Scan(nil))
+	assert.Equal(t, trace.NilID, scanned)
+}
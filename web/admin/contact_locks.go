@@ -0,0 +1,79 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/admin/contact_locks", web.RequireAuthToken(handleContactLocks))
+}
+
+// Request for diagnostics of contact locking, i.e. how long tasks waited for contact locks today and which contact
+// locks are currently held, longest held first.
+//
+//	{
+//	  "limit": 20
+//	}
+type contactLocksRequest struct {
+	Limit int `json:"limit" validate:"omitempty,gt=0,lte=1000"`
+}
+
+type heldContactLock struct {
+	*models.ContactLock
+	HeldMS int `json:"held_ms"`
+}
+
+// handles a request for contact lock diagnostics, e.g.
+//
+//	{
+//	  "waits": {
+//	    "count": 1234,
+//	    "timeouts": 2,
+//	    "avg_ms": 15,
+//	    "buckets": {"10ms": 1200, "100ms": 20, "500ms": 8, "1s": 3, "5s": 1, "10s": 2, "+Inf": 0}
+//	  },
+//	  "held": [
+//	    {
+//	      "org_id": 1,
+//	      "contact_id": 10000,
+//	      "holder": "handle_contact_event",
+//	      "acquired_on": "2022-10-01T12:00:00.000000Z",
+//	      "held_ms": 65000
+//	    }
+//	  ]
+//	}
+func handleContactLocks(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &contactLocksRequest{Limit: 20}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	now := time.Now()
+
+	waits, err := models.GetContactLockWaits(rc, now)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error getting contact lock waits")
+	}
+
+	locks, err := models.GetHeldContactLocks(rc, now, request.Limit)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error getting held contact locks")
+	}
+
+	held := make([]*heldContactLock, len(locks))
+	for i, l := range locks {
+		held[i] = &heldContactLock{ContactLock: l, HeldMS: int(now.Sub(l.AcquiredOn) / time.Millisecond)}
+	}
+
+	return map[string]interface{}{"waits": waits, "held": held}, http.StatusOK, nil
+}
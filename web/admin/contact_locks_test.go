@@ -0,0 +1,16 @@
+package admin_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestContactLocks(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	web.RunWebTests(t, ctx, rt, "testdata/contact_locks.json", nil)
+}
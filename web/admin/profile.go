@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/profile"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/admin/profile", web.RequireAuthToken(handleProfile))
+}
+
+// Requests a profile of the next task of the given type to run on any instance. The profile starts when that task
+// starts and stops when it ends, and is saved to session storage under profiles/<task_type>/ with its URL logged.
+//
+//	{
+//	  "task_type": "start_flow_batch",
+//	  "kind": "cpu"
+//	}
+type profileRequest struct {
+	TaskType string       `json:"task_type" validate:"required"`
+	Kind     profile.Kind `json:"kind"      validate:"required,eq=cpu|eq=heap"`
+}
+
+func handleProfile(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &profileRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	if !mailroom.HasTaskFunction(request.TaskType) {
+		return web.Errorf(web.ErrorCodeTaskUnknownType, "no such task type: %s", request.TaskType), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := profile.Request(rc, request.TaskType, request.Kind); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return map[string]interface{}{"task_type": request.TaskType, "kind": request.Kind}, http.StatusOK, nil
+}
@@ -0,0 +1,28 @@
+package admin_test
+
+import (
+	"testing"
+
+	"github.com/gomodule/redigo/redis"
+	_ "github.com/nyaruka/mailroom/core/tasks/starts"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	web.RunWebTests(t, ctx, rt, "testdata/profile.json", nil)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	requests, err := redis.StringMap(rc.Do("HGETALL", "profile_requests"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"start_flow_batch": "heap"}, requests)
+}
@@ -0,0 +1,81 @@
+package campaign
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+const fireAuditDefaultWindow = time.Hour * 24 * 7
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/campaign/fire_audit", web.RequireAuthToken(handleFireAudit))
+}
+
+// Request for a breakdown of the fires of each event of a campaign, including why fires were skipped. If since isn't
+// provided, fires from the last week are included.
+//
+//	{
+//	  "org_id": 1,
+//	  "campaign_id": 10000,
+//	  "since": "2022-11-01T00:00:00Z"
+//	}
+type fireAuditRequest struct {
+	OrgID      models.OrgID      `json:"org_id"      validate:"required"`
+	CampaignID models.CampaignID `json:"campaign_id" validate:"required"`
+	Since      *time.Time        `json:"since"`
+}
+
+// Response for a fire audit, with an entry for each active event of the campaign.
+//
+//	{
+//	  "since": "2022-11-01T00:00:00Z",
+//	  "events": [
+//	    {
+//	      "event_id": 10001,
+//	      "event_uuid": "aff4b8ac-2534-420f-a353-66a3e74b6e16",
+//	      "pending": 12,
+//	      "fired": 230,
+//	      "skipped": {"in_flow": 14, "left_group": 3, "field_changed": 1, "contact_inactive": 2}
+//	    }
+//	  ]
+//	}
+type fireAuditResponse struct {
+	Since  time.Time                `json:"since"`
+	Events []*models.EventFireAudit `json:"events"`
+}
+
+// handles a request to audit the fires of a campaign so that it's possible to see why contacts didn't receive events
+func handleFireAudit(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &fireAuditRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	since := time.Now().Add(-fireAuditDefaultWindow)
+	if request.Since != nil {
+		since = *request.Since
+	}
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, request.OrgID, models.RefreshCampaigns)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	campaign := oa.CampaignByID(request.CampaignID)
+	if campaign == nil {
+		return web.Errorf(web.ErrorCodeCampaignNotFound, "no such active campaign"), http.StatusNotFound, nil
+	}
+
+	events, err := models.AuditCampaignFires(ctx, rt.DB, campaign, since)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error auditing campaign fires")
+	}
+
+	return &fireAuditResponse{Since: since, Events: events}, http.StatusOK, nil
+}
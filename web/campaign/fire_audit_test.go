@@ -0,0 +1,14 @@
+package campaign_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestFireAudit(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	web.RunWebTests(t, ctx, rt, "testdata/fire_audit.json", nil)
+}
@@ -0,0 +1,115 @@
+package campaign
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+const (
+	simulateDefaultWindow    = time.Hour * 24 * 7
+	simulateMaxWindow        = time.Hour * 24 * 90
+	simulateMaxEventFires    = 1000
+	simulateMaxScheduleFires = 100
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/campaign/simulate", web.RequireAuthToken(handleSimulate))
+}
+
+// Request to simulate which campaign events and schedules of an org would fire if the current time were the given
+// time. If until isn't provided, fires in the week after as_of are returned.
+//
+//	{
+//	  "org_id": 1,
+//	  "as_of": "2022-11-01T09:00:00Z",
+//	  "until": "2022-11-08T09:00:00Z"
+//	}
+type simulateRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	AsOf  time.Time    `json:"as_of"  validate:"required"`
+	Until *time.Time   `json:"until"`
+}
+
+// Response for a simulation, with at most 1000 campaign event fires in the order they'd fire.
+//
+//	{
+//	  "as_of": "2022-11-01T09:00:00Z",
+//	  "until": "2022-11-08T09:00:00Z",
+//	  "event_fires": [
+//	    {
+//	      "campaign_uuid": "72aa12c5-cc11-4bc7-9406-044047845c70",
+//	      "event_uuid": "aff4b8ac-2534-420f-a353-66a3e74b6e16",
+//	      "contact_id": 10000,
+//	      "scheduled": "2022-11-02T12:00:00Z"
+//	    }
+//	  ],
+//	  "event_fires_total": 1,
+//	  "schedule_fires": [
+//	    {
+//	      "schedule_id": 234,
+//	      "broadcast_id": 123,
+//	      "fires": ["2022-11-01T10:00:00Z", "2022-11-02T10:00:00Z"]
+//	    }
+//	  ]
+//	}
+type simulateResponse struct {
+	AsOf            time.Time                        `json:"as_of"`
+	Until           time.Time                        `json:"until"`
+	EventFires      []*models.SimulatedEventFire     `json:"event_fires"`
+	EventFiresTotal int                              `json:"event_fires_total"`
+	ScheduleFires   []*models.SimulatedScheduleFires `json:"schedule_fires"`
+}
+
+// handles a request to evaluate the campaign events and schedules of an org against a simulated time, so that campaign
+// setup can be verified before launch. Nothing is scheduled or fired.
+func handleSimulate(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &simulateRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	until := request.AsOf.Add(simulateDefaultWindow)
+	if request.Until != nil {
+		until = *request.Until
+	}
+	if !until.After(request.AsOf) {
+		return web.Errorf(web.ErrorCodeInvalid, "until must be after as_of"), http.StatusBadRequest, nil
+	}
+	if until.Sub(request.AsOf) > simulateMaxWindow {
+		return web.Errorf(web.ErrorCodeInvalid, "can't simulate more than 90 days"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, request.OrgID, models.RefreshCampaigns)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	eventFires, eventFiresTotal, err := models.SimulateCampaignFires(ctx, rt.DB, oa, request.AsOf, until, simulateMaxEventFires)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error simulating campaign event fires")
+	}
+
+	schedules, err := models.LoadActiveSchedules(ctx, rt.DB, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	scheduleFires, err := models.SimulateScheduleFires(schedules, request.AsOf, until, simulateMaxScheduleFires)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error simulating schedule fires")
+	}
+
+	return &simulateResponse{
+		AsOf:            request.AsOf,
+		Until:           until,
+		EventFires:      eventFires,
+		EventFiresTotal: eventFiresTotal,
+		ScheduleFires:   scheduleFires,
+	}, http.StatusOK, nil
+}
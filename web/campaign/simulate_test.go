@@ -0,0 +1,21 @@
+package campaign_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestSimulate(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	// give bob a joined date so that the reminders campaign has fires for him
+	testdata.DoctorsGroup.Add(db, testdata.Bob)
+	db.MustExec(`UPDATE contacts_contact SET fields = '{"d83aae24-4bbf-49d0-ab85-6bfd201eac6d": {"datetime": "2030-01-01T00:00:00Z"}}' WHERE id = $1`, testdata.Bob.ID)
+
+	web.RunWebTests(t, ctx, rt, "testdata/simulate.json", nil)
+}
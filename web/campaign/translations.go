@@ -0,0 +1,86 @@
+package campaign
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/campaign/check_translations", web.RequireAuthToken(handleCheckTranslations))
+}
+
+// Request to check that every message event in a campaign has a translation for every language of the org.
+//
+//	{
+//	  "org_id": 1,
+//	  "campaign_id": 10000
+//	}
+type checkTranslationsRequest struct {
+	OrgID      models.OrgID      `json:"org_id"      validate:"required"`
+	CampaignID models.CampaignID `json:"campaign_id" validate:"required"`
+}
+
+// Response for a translations check, listing only those events which have missing translations.
+//
+//	{
+//	  "complete": false,
+//	  "languages": ["eng", "spa"],
+//	  "events": [
+//	    {
+//	      "uuid": "aff4b8ac-2534-420f-a353-66a3e74b6e16",
+//	      "missing": ["spa"]
+//	    }
+//	  ]
+//	}
+type checkTranslationsResponse struct {
+	Complete  bool                 `json:"complete"`
+	Languages []envs.Language      `json:"languages"`
+	Events    []*eventTranslations `json:"events"`
+}
+
+type eventTranslations struct {
+	UUID    models.CampaignEventUUID `json:"uuid"`
+	Missing []envs.Language          `json:"missing"`
+}
+
+// handles a request to check the translations of a campaign's message events before it is activated, so that missing
+// translations can be flagged rather than contacts receiving messages in the base language
+func handleCheckTranslations(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &checkTranslationsRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	events, err := models.LoadCampaignEventMessages(ctx, rt.DB, request.OrgID, request.CampaignID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	languages := oa.Env().AllowedLanguages()
+	if languages == nil {
+		languages = []envs.Language{}
+	}
+
+	response := &checkTranslationsResponse{Complete: true, Languages: languages, Events: []*eventTranslations{}}
+
+	for _, e := range events {
+		missing := e.MissingLanguages(languages)
+		if len(missing) > 0 {
+			response.Events = append(response.Events, &eventTranslations{UUID: e.UUID, Missing: missing})
+			response.Complete = false
+		}
+	}
+
+	return response, http.StatusOK, nil
+}
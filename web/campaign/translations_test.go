@@ -0,0 +1,20 @@
+package campaign_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestCheckTranslations(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	db.MustExec(`UPDATE orgs_org SET flow_languages = '{"eng", "spa", "fra"}' WHERE id = $1`, testdata.Org1.ID)
+	db.MustExec(`UPDATE campaigns_campaignevent SET message = hstore(ARRAY['eng', 'Hi there', 'spa', 'Hola', 'fra', ' ']) WHERE id = $1`, testdata.RemindersEvent2.ID)
+
+	web.RunWebTests(t, ctx, rt, "testdata/check_translations.json", nil)
+}
@@ -20,6 +20,7 @@ func init() {
 	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/modify", web.RequireAuthToken(handleModify))
 	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/resolve", web.RequireAuthToken(handleResolve))
 	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/interrupt", web.RequireAuthToken(handleInterrupt))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/anonymize", web.RequireAuthToken(handleAnonymize))
 }
 
 // Request to create a new contact.
@@ -45,7 +46,7 @@ type createRequest struct {
 func handleCreate(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &createRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org
@@ -56,12 +57,12 @@ func handleCreate(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 
 	c, err := SpecToCreation(request.Contact, oa.Env(), oa.SessionAssets())
 	if err != nil {
-		return err, http.StatusBadRequest, nil
+		return web.NewError(web.ErrorCodeContactInvalid, err), http.StatusBadRequest, nil
 	}
 
 	_, contact, err := models.CreateContact(ctx, rt.DB, oa, request.UserID, c.Name, c.Language, c.URNs)
 	if err != nil {
-		return err, http.StatusBadRequest, nil
+		return web.NewError(web.ErrorCodeContactInvalid, err), http.StatusBadRequest, nil
 	}
 
 	modifiersByContact := map[*flows.Contact][]flows.Modifier{contact: c.Mods}
@@ -120,7 +121,7 @@ type modifyResult struct {
 func handleModify(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &modifyRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org assets
@@ -186,7 +187,7 @@ type resolveRequest struct {
 func handleResolve(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &resolveRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org
@@ -198,7 +199,7 @@ func handleResolve(ctx context.Context, rt *runtime.Runtime, r *http.Request) (i
 	urn := request.URN.Normalize(string(oa.Env().DefaultCountry()))
 
 	if err := urn.Validate(); err != nil {
-		return errors.Wrapf(err, "URN failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeContactURNInvalid, "URN failed validation"), http.StatusBadRequest, nil
 	}
 
 	_, contact, created, err := models.GetOrCreateContact(ctx, rt.DB, oa, []urns.URN{urn}, request.ChannelID)
@@ -241,7 +242,7 @@ type interruptRequest struct {
 func handleInterrupt(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &interruptRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	count, err := models.InterruptSessionsForContacts(ctx, rt.DB, []models.ContactID{request.ContactID})
@@ -251,3 +252,50 @@ func handleInterrupt(ctx context.Context, rt *runtime.Runtime, r *http.Request)
 
 	return map[string]interface{}{"sessions": count}, http.StatusOK, nil
 }
+
+// Request that contacts are anonymized instead of deleted. Only allowed for orgs which have chosen anonymization.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "contact_ids": [235, 236]
+//	}
+type anonymizeRequest struct {
+	OrgID      models.OrgID       `json:"org_id"      validate:"required"`
+	UserID     models.UserID      `json:"user_id"     validate:"required"`
+	ContactIDs []models.ContactID `json:"contact_ids" validate:"required"`
+}
+
+// handles a request to anonymize contacts
+func handleAnonymize(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &anonymizeRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	if oa.Org().ContactErasure() != models.ContactErasureAnonymize {
+		return web.Errorf(web.ErrorCodeOrgAnonymizationDisabled, "org is not configured to anonymize contacts"), http.StatusBadRequest, nil
+	}
+
+	// ignore any contacts which don't belong to this org
+	contactIDs, err := models.FilterContactIDsByOrg(ctx, rt.DB, request.OrgID, request.ContactIDs)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// anonymized contacts shouldn't carry on in any flows
+	if _, err := models.InterruptSessionsForContacts(ctx, rt.DB, contactIDs); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to interrupt contacts")
+	}
+
+	if err := models.AnonymizeContacts(ctx, rt.DB, request.OrgID, request.UserID, contactIDs); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to anonymize contacts")
+	}
+
+	return map[string]interface{}{"contact_ids": contactIDs}, http.StatusOK, nil
+}
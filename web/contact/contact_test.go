@@ -79,3 +79,22 @@ func TestInterruptContact(t *testing.T) {
 
 	web.RunWebTests(t, ctx, rt, "testdata/interrupt.json", nil)
 }
+
+func TestAnonymizeContacts(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	db.MustExec(`UPDATE orgs_org SET config = '{"contact_erasure": "anonymize"}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+	db.MustExec(`UPDATE contacts_contact SET fields = '{"3a5891e4-756e-4dc9-8e12-b7a766168824": {"text": "F"}}' WHERE id = $1`, testdata.Cathy.ID)
+	models.FlushCache()
+
+	// give Cathy a waiting session and a message
+	testdata.InsertWaitingSession(db, testdata.Org1, testdata.Cathy, models.FlowTypeMessaging, testdata.Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), true, nil)
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "my number is 0788123123", models.MsgStatusHandled)
+
+	// and a contact in another org a waiting session, which shouldn't be touched
+	testdata.InsertWaitingSession(db, testdata.Org2, testdata.Org2Contact, models.FlowTypeMessaging, testdata.Org2Favorites, models.NilCallID, time.Now(), time.Now().Add(time.Hour), true, nil)
+
+	web.RunWebTests(t, ctx, rt, "testdata/anonymize.json", nil)
+}
@@ -0,0 +1,51 @@
+package contact
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+// default number of conversations returned in one page of a contact's conversations
+const defaultConversationsLimit = 50
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/conversations", web.RequireAuthToken(handleConversations))
+}
+
+// Request for a page of the conversations of a contact across all channels, newest first. Older pages are fetched by
+// passing the started_on of the last conversation of the previous page as before.
+//
+//	{
+//	  "org_id": 1,
+//	  "contact_id": 235,
+//	  "before": "2022-10-01T12:00:00Z",
+//	  "limit": 50
+//	}
+type conversationsRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	ContactID models.ContactID `json:"contact_id" validate:"required"`
+	Before    *time.Time       `json:"before"`
+	Limit     int              `json:"limit"      validate:"omitempty,min=1,max=100"`
+}
+
+// handles a request for the conversations of a contact
+func handleConversations(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &conversationsRequest{Limit: defaultConversationsLimit}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	conversations, err := models.LoadContactConversations(ctx, rt.DB, request.OrgID, request.ContactID, request.Before, request.Limit)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load contact conversations")
+	}
+
+	return map[string]interface{}{"conversations": conversations}, http.StatusOK, nil
+}
@@ -0,0 +1,40 @@
+package contact_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConversations(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	db.MustExec(`UPDATE orgs_org SET config = config || '{"conversations": true}'::jsonb WHERE id = $1`, testdata.Org1.ID)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshOrg)
+	require.NoError(t, err)
+
+	day1 := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	day3 := time.Date(2022, 10, 3, 9, 0, 0, 0, time.UTC)
+
+	for _, msgs := range [][]*models.ConversationMsg{
+		{
+			{ContactID: testdata.Cathy.ID, ChannelID: testdata.TwilioChannel.ID, Direction: models.DirectionIn, CreatedOn: day1},
+			{ContactID: testdata.Cathy.ID, ChannelID: testdata.VonageChannel.ID, Direction: models.DirectionIn, CreatedOn: day1.Add(time.Minute * 30)},
+		},
+		{{ContactID: testdata.Cathy.ID, ChannelID: testdata.TwilioChannel.ID, Direction: models.DirectionOut, CreatedOn: day1.Add(time.Hour)}},
+		{{ContactID: testdata.Cathy.ID, ChannelID: testdata.TwilioChannel.ID, Direction: models.DirectionOut, CreatedOn: day3}},
+	} {
+		require.NoError(t, models.RecordConversations(ctx, db, oa, msgs))
+	}
+
+	web.RunWebTests(t, ctx, rt, "testdata/conversations.json", nil)
+}
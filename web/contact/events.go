@@ -0,0 +1,90 @@
+package contact
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+// default number of events returned in one page of a contact's events
+const defaultEventsLimit = 50
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/add_event", web.RequireAuthToken(handleAddEvent))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/events", web.RequireAuthToken(handleEvents))
+}
+
+// Request from an external system to add an event to a contact's history. The type is a snake case slug and the
+// payload can be any JSON object. If occurred_on isn't given the event is recorded as happening now.
+//
+//	{
+//	  "org_id": 1,
+//	  "contact_id": 235,
+//	  "type": "order_shipped",
+//	  "source": "shopify",
+//	  "payload": {"order_id": "A1234", "carrier": "DHL"},
+//	  "occurred_on": "2022-10-01T12:00:00Z"
+//	}
+type addEventRequest struct {
+	OrgID      models.OrgID           `json:"org_id"     validate:"required"`
+	ContactID  models.ContactID       `json:"contact_id" validate:"required"`
+	Type       string                 `json:"type"       validate:"required,contact_event_type"`
+	Source     string                 `json:"source"     validate:"required,max=64"`
+	Payload    map[string]interface{} `json:"payload"`
+	OccurredOn *time.Time             `json:"occurred_on"`
+}
+
+// handles a request to add an event to a contact
+func handleAddEvent(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &addEventRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	event, err := models.InsertContactEvent(ctx, rt.DB, request.OrgID, request.ContactID, request.Type, request.Source, request.Payload, request.OccurredOn)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to add contact event")
+	}
+	if event == nil {
+		return web.Errorf(web.ErrorCodeContactNotFound, "no such contact: %d", request.ContactID), http.StatusNotFound, nil
+	}
+
+	return event, http.StatusOK, nil
+}
+
+// Request for a page of the events on a contact, newest first. Older pages are fetched by passing the occurred_on of
+// the last event of the previous page as before.
+//
+//	{
+//	  "org_id": 1,
+//	  "contact_id": 235,
+//	  "before": "2022-10-01T12:00:00Z",
+//	  "limit": 50
+//	}
+type eventsRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	ContactID models.ContactID `json:"contact_id" validate:"required"`
+	Before    *time.Time       `json:"before"`
+	Limit     int              `json:"limit"      validate:"omitempty,min=1,max=100"`
+}
+
+// handles a request for the events on a contact
+func handleEvents(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &eventsRequest{Limit: defaultEventsLimit}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	events, err := models.LoadContactEvents(ctx, rt.DB, request.OrgID, request.ContactID, request.Before, request.Limit)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load contact events")
+	}
+
+	return map[string]interface{}{"events": events}, http.StatusOK, nil
+}
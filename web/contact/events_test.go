@@ -0,0 +1,16 @@
+package contact_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestEvents(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	web.RunWebTests(t, ctx, rt, "testdata/events.json", nil)
+}
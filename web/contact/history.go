@@ -0,0 +1,83 @@
+package contact
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/contact/history_stream", web.RequireAuthTokenHandler(handleHistoryStream))
+}
+
+// Streams the messages and runs of a contact as newline delimited JSON, newest first, optionally limited to those
+// created after and before the given times. Each item is written on its own line and followed by a final summary line.
+//
+//	{
+//	  "org_id": 1,
+//	  "contact_id": 235,
+//	  "after": "2022-09-01T00:00:00Z",
+//	  "before": "2022-10-01T00:00:00Z"
+//	}
+//
+//	{"type": "msg", "created_on": "2022-09-30T10:00:00Z", "data": {"id": 1234, "text": "hi", ...}}
+//	{"type": "run", "created_on": "2022-09-29T10:00:00Z", "data": {"id": 567, "flow_id": 12, ...}}
+//	{"total": 2}
+type historyStreamRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	ContactID models.ContactID `json:"contact_id" validate:"required"`
+	After     *time.Time       `json:"after"`
+	Before    *time.Time       `json:"before"`
+}
+
+type historyStreamSummary struct {
+	Total int `json:"total"`
+}
+
+// handles a streamed contact history request
+func handleHistoryStream(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	request := &historyStreamRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		web.WriteErrorResponse(w, web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest)
+		return nil
+	}
+
+	after, before := time.Time{}, dates.Now()
+	if request.After != nil {
+		after = *request.After
+	}
+	if request.Before != nil {
+		before = *request.Before
+	}
+
+	out := web.NewNDJSONWriter(w)
+	total := 0
+
+	err := models.StreamContactHistory(ctx, rt.ReadonlyDB, request.OrgID, request.ContactID, after, before, func(item *models.HistoryItem) error {
+		total++
+
+		if err := out.Write(item); err != nil {
+			return err
+		}
+
+		// flush every so often so that callers can start processing before we're done
+		if total%1000 == 0 {
+			out.Flush()
+		}
+		return nil
+	})
+
+	if err != nil {
+		if !out.Started() {
+			return err
+		}
+		return out.WriteError(err)
+	}
+
+	return out.Write(&historyStreamSummary{Total: total})
+}
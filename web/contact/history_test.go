@@ -0,0 +1,63 @@
+package contact
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContactHistoryStream(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	testdata.InsertIncomingMsg(rt.DB, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "hi", models.MsgStatusHandled)
+	testdata.InsertOutgoingMsg(rt.DB, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "hello", nil, models.MsgStatusSent, false)
+	testdata.InsertFlowRun(rt.DB, testdata.Org1, models.SessionID(0), testdata.Cathy, testdata.Favorites, models.RunStatusCompleted)
+	testdata.InsertIncomingMsg(rt.DB, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "not cathy", models.MsgStatusHandled)
+
+	wg := &sync.WaitGroup{}
+	server := web.NewServer(ctx, rt, wg)
+	server.Start()
+
+	// give our server time to start
+	time.Sleep(time.Second)
+
+	defer server.Stop()
+
+	body := fmt.Sprintf(`{"org_id": 1, "contact_id": %d}`, testdata.Cathy.ID)
+	req, _ := http.NewRequest("POST", "http://localhost:8090/mr/contact/history_stream", bytes.NewReader([]byte(body)))
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	content, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, 2, strings.Count(string(content), `"type":"msg"`))
+	assert.Equal(t, 1, strings.Count(string(content), `"type":"run"`))
+	assert.Equal(t, `{"total":3}`, lines[3])
+
+	// invalid requests get a regular error response
+	req, _ = http.NewRequest("POST", "http://localhost:8090/mr/contact/history_stream", bytes.NewReader([]byte(`{"org_id": 1}`)))
+
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
@@ -0,0 +1,118 @@
+package contact
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/import_summary", web.RequireAuthToken(handleImportSummary))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/approve_import", web.RequireAuthToken(handleApproveImport))
+}
+
+// Request for the summary of a contact import which is staged awaiting approval.
+//
+//	{
+//	  "org_id": 1,
+//	  "import_id": 123
+//	}
+type importRequest struct {
+	OrgID    models.OrgID           `json:"org_id"    validate:"required"`
+	ImportID models.ContactImportID `json:"import_id" validate:"required"`
+}
+
+// handles a request for the summary of a staged contact import, e.g.
+//
+//	{
+//	  "creates": 12,
+//	  "updates": 3,
+//	  "errors": 0,
+//	  "field_changes": {"age": 2, "name": 1}
+//	}
+func handleImportSummary(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &importRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	imp, resp, status, err := loadStagedImport(ctx, rt, request)
+	if imp == nil {
+		return resp, status, err
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	summary, err := models.GetStagedContactImport(rc, imp.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if summary == nil {
+		return web.Errorf(web.ErrorCodeImportNotStaged, "import %d is not awaiting approval", request.ImportID), http.StatusBadRequest, nil
+	}
+
+	return summary, http.StatusOK, nil
+}
+
+// handles a request to approve a staged contact import so that its batches are imported
+func handleApproveImport(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &importRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	imp, resp, status, err := loadStagedImport(ctx, rt, request)
+	if imp == nil {
+		return resp, status, err
+	}
+
+	rc := rt.RP.Get()
+	staged, err := models.ClearStagedContactImport(rc, imp.ID)
+	rc.Close()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if !staged {
+		return web.Errorf(web.ErrorCodeImportNotStaged, "import %d is not awaiting approval", request.ImportID), http.StatusBadRequest, nil
+	}
+
+	batches, err := models.LoadPendingContactImportBatches(ctx, rt.DB, imp.ID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	batchIDs := make([]models.ContactImportBatchID, len(batches))
+	for i, b := range batches {
+		batchIDs[i] = b.ID
+	}
+
+	if err := imp.MarkApproved(ctx, rt.DB); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if err := contacts.QueueImportBatches(ctx, rt, imp, batchIDs); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error queuing batches of import %d", imp.ID)
+	}
+
+	return map[string]interface{}{"batches": len(batchIDs)}, http.StatusOK, nil
+}
+
+// loads the import of the given request, returning an error response if it doesn't exist or isn't staged
+func loadStagedImport(ctx context.Context, rt *runtime.Runtime, request *importRequest) (*models.ContactImport, interface{}, int, error) {
+	imp, err := models.LoadContactImport(ctx, rt.DB, request.ImportID)
+	if errors.Cause(err) == sql.ErrNoRows || (err == nil && imp.OrgID != request.OrgID) {
+		return nil, web.Errorf(web.ErrorCodeImportNotFound, "no such import: %d", request.ImportID), http.StatusNotFound, nil
+	} else if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	if imp.Status != models.ContactImportStatusPending {
+		return nil, web.Errorf(web.ErrorCodeImportNotStaged, "import %d is not awaiting approval", request.ImportID), http.StatusBadRequest, nil
+	}
+	return imp, nil, 0, nil
+}
@@ -0,0 +1,43 @@
+package contact_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestImports(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	// an import staged for approval
+	stagedID := testdata.InsertContactImport(db, testdata.Org1, testdata.Admin)
+	testdata.InsertContactImportBatch(db, stagedID, []byte(`[
+		{"uuid": "6393abc0-283d-4c9b-a1b3-641a035c34bf", "name": "Catherine", "fields": {"gender": "F"}},
+		{"name": "Norbert", "urns": ["tel:+16055740001"]}
+	]`))
+	db.MustExec(`UPDATE contacts_contactimport SET status = 'P' WHERE id = $1`, stagedID)
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+	summary, err := models.SummarizeContactImport(ctx, db, oa, stagedID)
+	require.NoError(t, err)
+	require.NoError(t, models.SetStagedContactImport(rc, stagedID, summary))
+
+	// and one which isn't
+	otherID := testdata.InsertContactImport(db, testdata.Org1, testdata.Admin)
+
+	web.RunWebTests(t, ctx, rt, "testdata/imports.json", map[string]string{
+		"staged_id": fmt.Sprint(stagedID),
+		"other_id":  fmt.Sprint(otherID),
+	})
+}
@@ -0,0 +1,76 @@
+package contact
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/add_note", web.RequireAuthToken(handleAddNote))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/notes", web.RequireAuthToken(handleNotes))
+}
+
+// Request to add a note to a contact.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "contact_id": 235,
+//	  "text": "Prefers to be contacted in the evening"
+//	}
+type addNoteRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	UserID    models.UserID    `json:"user_id"    validate:"required"`
+	ContactID models.ContactID `json:"contact_id" validate:"required"`
+	Text      string           `json:"text"       validate:"required,max=10000"`
+}
+
+// handles a request to add a note to a contact
+func handleAddNote(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &addNoteRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	note, err := models.AddContactNote(ctx, rt.DB, request.OrgID, request.ContactID, request.UserID, request.Text)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to add contact note")
+	}
+	if note == nil {
+		return web.Errorf(web.ErrorCodeContactNotFound, "no such contact: %d", request.ContactID), http.StatusNotFound, nil
+	}
+
+	return note, http.StatusOK, nil
+}
+
+// Request for the notes on a contact.
+//
+//	{
+//	  "org_id": 1,
+//	  "contact_id": 235
+//	}
+type notesRequest struct {
+	OrgID     models.OrgID     `json:"org_id"     validate:"required"`
+	ContactID models.ContactID `json:"contact_id" validate:"required"`
+}
+
+// handles a request for the notes on a contact
+func handleNotes(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &notesRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	notes, err := models.LoadContactNotes(ctx, rt.DB, request.OrgID, request.ContactID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load contact notes")
+	}
+
+	return map[string]interface{}{"notes": notes}, http.StatusOK, nil
+}
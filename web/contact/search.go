@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/goflow/assets"
 	"github.com/nyaruka/goflow/contactql"
 	"github.com/nyaruka/mailroom/core/models"
@@ -17,6 +18,7 @@ import (
 func init() {
 	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/search", web.RequireAuthToken(handleSearch))
 	web.RegisterJSONRoute(http.MethodPost, "/mr/contact/parse_query", web.RequireAuthToken(handleParseQuery))
+	web.RegisterRoute(http.MethodPost, "/mr/contact/search_stream", web.RequireAuthTokenHandler(handleSearchStream))
 }
 
 // Searches the contacts for an org
@@ -69,7 +71,7 @@ func handleSearch(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 		Sort:     "-id",
 	}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org assets
@@ -118,6 +120,76 @@ func handleSearch(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 	return response, http.StatusOK, nil
 }
 
+// Streams all contacts matching a search as newline delimited JSON. Takes the same request as search except that
+// paging parameters are ignored. Each match is written on its own line and followed by a final summary line.
+//
+//	{"contact_id": 15}
+//	{"contact_id": 235}
+//	{"query": "age > 10", "total": 2}
+type searchStreamHit struct {
+	ContactID models.ContactID `json:"contact_id"`
+}
+
+type searchStreamSummary struct {
+	Query string `json:"query"`
+	Total int64  `json:"total"`
+}
+
+// handles a streamed contact search request
+func handleSearchStream(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	request := &searchRequest{Sort: "-id"}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation")
+	}
+
+	// grab our org assets
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, request.OrgID, models.RefreshFields|models.RefreshGroups)
+	if err != nil {
+		return errors.Wrapf(err, "unable to load org assets")
+	}
+
+	var group *models.Group
+	if request.GroupID != 0 {
+		group = oa.GroupByID(request.GroupID)
+	} else if request.GroupUUID != "" {
+		group = oa.GroupByUUID(request.GroupUUID)
+	}
+
+	out := web.NewNDJSONWriter(w)
+
+	parsed, total, err := search.StreamContactIDsForQuery(ctx, rt.ES, oa, group, request.ExcludeIDs, request.Query, request.Sort, func(ids []models.ContactID) error {
+		for _, id := range ids {
+			if err := out.Write(&searchStreamHit{ContactID: id}); err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		return nil
+	})
+
+	if err != nil {
+		// if we haven't written anything yet, we can still return a proper error response
+		if !out.Started() {
+			isQueryError, qerr := contactql.IsQueryError(err)
+			if isQueryError {
+				w.Header().Set("Content-type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(jsonx.MustMarshal(web.NewErrorResponse(qerr)))
+				return nil
+			}
+			return err
+		}
+		return out.WriteError(err)
+	}
+
+	normalized := ""
+	if parsed != nil {
+		normalized = parsed.String()
+	}
+
+	return out.Write(&searchStreamSummary{Query: normalized, Total: total})
+}
+
 // Request to parse the passed in query
 //
 //	{
@@ -155,7 +227,7 @@ type parseResponse struct {
 func handleParseQuery(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &parseRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org assets
@@ -174,7 +246,7 @@ func handleParseQuery(ctx context.Context, rt *runtime.Runtime, r *http.Request)
 	env := oa.Env()
 	var resolver contactql.Resolver
 	if !request.ParseOnly {
-		resolver = oa.SessionAssets()
+		resolver = search.NewResolver(oa)
 	}
 
 	parsed, err := contactql.ParseQuery(env, request.Query, resolver)
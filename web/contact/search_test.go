@@ -235,3 +235,45 @@ func TestParseQuery(t *testing.T) {
 
 	web.RunWebTests(t, ctx, rt, "testdata/parse_query.json", nil)
 }
+
+func TestContactSearchStream(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	wg := &sync.WaitGroup{}
+
+	mockES := testsuite.NewMockElasticServer()
+	defer mockES.Close()
+
+	rt.ES = mockES.Client()
+
+	server := web.NewServer(ctx, rt, wg)
+	server.Start()
+
+	// give our server time to start
+	time.Sleep(time.Second)
+
+	defer server.Stop()
+
+	mockES.AddResponse(testdata.Cathy.ID, testdata.George.ID)
+
+	body := fmt.Sprintf(`{"org_id": 1, "query": "Cathy", "group_uuid": "%s"}`, testdata.ActiveGroup.UUID)
+	req, err := http.NewRequest("POST", "http://localhost:8090/mr/contact/search_stream", bytes.NewReader([]byte(body)))
+	assert.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	content, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("{\"contact_id\":%d}\n{\"contact_id\":%d}\n{\"query\":\"name ~ \\\"Cathy\\\"\",\"total\":2}\n", testdata.Cathy.ID, testdata.George.ID), string(content))
+
+	// query errors before anything is written are returned as regular error responses
+	body = `{"org_id": 1, "query": "birthday = tomorrow"}`
+	req, _ = http.NewRequest("POST", "http://localhost:8090/mr/contact/search_stream", bytes.NewReader([]byte(body)))
+
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, 400, resp.StatusCode)
+}
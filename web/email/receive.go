@@ -0,0 +1,210 @@
+package email
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/gocommon/urns"
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/handler"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/email/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/receive", handleReceive)
+}
+
+// Request to receive an email on an email channel, posted as a multipart form by an inbound parse service. The secret
+// must match the secret in the channel's config. Headers are the raw headers of the email, which are used to find the
+// contact that a reply was sent to, and attachments is the number of attachment files, named attachment1, attachment2..
+// Emails are handled like any other incoming message except that keyword triggers can also match their subject.
+//
+//	POST /mr/email/8a0b2a6e-f5ee-45e7-b8b4-bfa5e7b2d1a8/receive?secret=sesame
+//
+//	from=Bob <bob@example.com>&subject=Re: Hello&text=Hi there&headers=Message-ID: <abc@example.com>...
+type receiveRequest struct {
+	Secret      string `form:"secret"      validate:"required"`
+	From        string `form:"from"        validate:"required"`
+	Subject     string `form:"subject"`
+	Text        string `form:"text"`
+	Headers     string `form:"headers"`
+	Attachments int    `form:"attachments"`
+}
+
+// headers of the received email that we care about
+type emailHeaders struct {
+	MessageID  string
+	InReplyTo  string
+	References []string
+}
+
+func handleReceive(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &receiveRequest{}
+	if err := web.DecodeAndValidateForm(request, r); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	channelUUID := assets.ChannelUUID(chi.URLParam(r, "uuid"))
+
+	orgID, err := models.OrgIDForChannelUUID(ctx, rt.DB, channelUUID)
+	if err != nil {
+		return web.Errorf(web.ErrorCodeChannelNotFound, "no such channel: %s", channelUUID), http.StatusNotFound, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return nil, 0, errors.Wrap(err, "error loading org assets")
+	}
+
+	channel := oa.ChannelByUUID(channelUUID)
+	if channel == nil || channel.Type() != models.ChannelTypeEmail {
+		return web.Errorf(web.ErrorCodeChannelNotFound, "no such email channel: %s", channelUUID), http.StatusNotFound, nil
+	}
+
+	secret := channel.ConfigValue(models.ChannelConfigEmailSecret, "")
+	if secret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(request.Secret)) != 1 {
+		return web.Errorf(web.ErrorCodeUnauthorized, "invalid secret"), http.StatusUnauthorized, nil
+	}
+
+	from, err := mail.ParseAddress(request.From)
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeEmailInvalid, "invalid from address"), http.StatusBadRequest, nil
+	}
+
+	headers, err := parseHeaders(request.Headers)
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeEmailInvalid, "invalid headers"), http.StatusBadRequest, nil
+	}
+
+	contactID, urn, isNew, err := resolveContact(ctx, rt, oa, channel, from, headers)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	attachments := make([]utils.Attachment, 0, request.Attachments)
+	attachmentStrs := make([]string, 0, request.Attachments)
+	for i := 1; i <= request.Attachments; i++ {
+		file, header, err := r.FormFile(fmt.Sprintf("attachment%d", i))
+		if err != nil {
+			return web.WrapError(err, web.ErrorCodeEmailInvalid, "missing attachment%d", i), http.StatusBadRequest, nil
+		}
+
+		filename := string(uuids.New()) + filepath.Ext(header.Filename)
+
+		attachment, err := oa.Org().StoreAttachment(ctx, rt, filename, header.Header.Get("Content-Type"), file)
+		if err != nil {
+			return nil, 0, errors.Wrap(err, "error storing attachment")
+		}
+		attachments = append(attachments, attachment)
+		attachmentStrs = append(attachmentStrs, string(attachment))
+	}
+
+	msgIn := flows.NewMsgIn(flows.MsgUUID(uuids.New()), urn, channel.ChannelReference(), strings.TrimSpace(request.Text), attachments)
+	msg := models.NewIncomingEmail(rt.Config, oa.OrgID(), channel, contactID, msgIn, request.Subject, headers.MessageID, dates.Now())
+
+	if err := models.InsertMessages(ctx, rt.DB, []*models.Msg{msg}); err != nil {
+		return nil, 0, errors.Wrap(err, "error inserting email message")
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	// remember this email so that our replies are threaded with it
+	if headers.MessageID != "" {
+		thread := &models.EmailThread{MessageID: headers.MessageID, Subject: request.Subject, References: headers.References}
+		if err := models.SetEmailThread(rc, orgID, channel, contactID, thread); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	event := &handler.MsgEvent{
+		ContactID:   contactID,
+		OrgID:       oa.OrgID(),
+		ChannelID:   channel.ID(),
+		MsgID:       msg.ID(),
+		MsgUUID:     msg.UUID(),
+		URN:         urn,
+		URNID:       models.GetURNID(urn),
+		Text:        msg.Text(),
+		Attachments: attachmentStrs,
+		Subject:     request.Subject,
+		NewContact:  isNew,
+	}
+
+	task := &queue.Task{Type: handler.MsgEventType, OrgID: int(oa.OrgID()), Task: jsonx.MustMarshal(event), QueuedOn: dates.Now()}
+	if err := handler.QueueHandleTask(rc, contactID, task); err != nil {
+		return nil, 0, errors.Wrap(err, "error queuing email message for handling")
+	}
+
+	return map[string]interface{}{"msg_uuid": msg.UUID(), "contact_id": contactID}, http.StatusOK, nil
+}
+
+// finds the contact and URN for a received email. If it's a reply to an email we sent, from one of the addresses of the
+// contact that email was sent to, then it goes to that contact, otherwise it goes to the contact with the from address.
+func resolveContact(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets, channel *models.Channel, from *mail.Address, headers *emailHeaders) (models.ContactID, urns.URN, bool, error) {
+	urn, err := urns.NewURNFromParts(urns.EmailScheme, strings.ToLower(from.Address), "", from.Name)
+	if err != nil {
+		return models.NilContactID, urns.NilURN, false, errors.Wrap(err, "error creating email URN")
+	}
+
+	replyTo := append([]string{headers.InReplyTo}, headers.References...)
+
+	contactID, urnID, err := models.GetEmailReplyRecipient(ctx, rt.DB, oa.OrgID(), channel, urn, replyTo)
+	if err != nil {
+		return models.NilContactID, urns.NilURN, false, err
+	}
+
+	if contactID != models.NilContactID {
+		urn, err := models.URNForID(ctx, rt.DB, oa, urnID)
+		if err != nil {
+			return models.NilContactID, urns.NilURN, false, errors.Wrap(err, "error loading reply recipient URN")
+		}
+		return contactID, urn, false, nil
+	}
+
+	contact, _, isNew, err := models.GetOrCreateContact(ctx, rt.DB, oa, []urns.URN{urn}, channel.ID())
+	if err != nil {
+		return models.NilContactID, urns.NilURN, false, errors.Wrap(err, "error getting or creating contact")
+	}
+
+	urn, err = models.URNForURN(ctx, rt.DB, oa, urn)
+	if err != nil {
+		return models.NilContactID, urns.NilURN, false, errors.Wrap(err, "error loading email URN")
+	}
+
+	return contact.ID(), urn, isNew, nil
+}
+
+// parses the raw headers of a received email
+func parseHeaders(raw string) (*emailHeaders, error) {
+	headers := &emailHeaders{}
+	if strings.TrimSpace(raw) == "" {
+		return headers, nil
+	}
+
+	m, err := mail.ReadMessage(strings.NewReader(strings.TrimRight(raw, "\r\n") + "\r\n\r\n"))
+	if err != nil {
+		return nil, err
+	}
+
+	headers.MessageID = strings.TrimSpace(m.Header.Get("Message-ID"))
+	headers.InReplyTo = strings.TrimSpace(m.Header.Get("In-Reply-To"))
+	headers.References = strings.Fields(m.Header.Get("References"))
+
+	return headers, nil
+}
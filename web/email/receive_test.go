@@ -0,0 +1,121 @@
+package email_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceive(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis | testsuite.ResetStorage)
+
+	channel := testdata.InsertChannel(db, testdata.Org1, models.ChannelTypeEmail, "Email", []string{"mailto"}, "SR", map[string]interface{}{"subject": "Hello", "secret": "sesame"})
+	db.MustExec(`UPDATE channels_channel SET address = 'support@example.com' WHERE id = $1`, channel.ID)
+
+	cathyURNID := testdata.InsertContactURN(db, testdata.Org1, testdata.Cathy, "mailto:cathy@example.com", 1000)
+
+	wg := &sync.WaitGroup{}
+	server := web.NewServer(ctx, rt, wg)
+	server.Start()
+
+	// wait for the server to start
+	time.Sleep(time.Second)
+	defer server.Stop()
+
+	receive := func(secret string, parts []web.MultiPartPart) (int, string) {
+		url := fmt.Sprintf("http://localhost:8090/mr/email/%s/receive?secret=%s", channel.UUID, secret)
+		req, err := web.MakeMultipartRequest(http.MethodPost, url, parts, nil)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	status, body := receive("sesame", []web.MultiPartPart{{Name: "subject", Data: "Hi"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, body, "field 'from' is required")
+
+	status, _ = receive("xyz", []web.MultiPartPart{{Name: "from", Data: "cathy@example.com"}})
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// an email from a known address goes to that contact
+	status, _ = receive("sesame", []web.MultiPartPart{
+		{Name: "from", Data: "Cathy <Cathy@example.com>"},
+		{Name: "subject", Data: "Question"},
+		{Name: "text", Data: "How do I join?\n"},
+		{Name: "headers", Data: "Message-ID: <q1@mail.example.com>\r\nSubject: Question\r\n"},
+		{Name: "attachments", Data: "1"},
+		{Name: "attachment1", Filename: "photo.jpg", ContentType: "image/jpeg", Data: "..."},
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE direction = 'I' AND status = 'P' AND msg_type = 'I' AND contact_id = $1 AND contact_urn_id = $2 AND text = 'How do I join?' AND array_length(attachments, 1) = 1 AND metadata::jsonb->'email'->>'message_id' = '<q1@mail.example.com>'`, testdata.Cathy.ID, cathyURNID).Returns(1)
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	count, err := redis.Int(rc.Do("LLEN", fmt.Sprintf("c:%d:%d", testdata.Org1.ID, testdata.Cathy.ID)))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, testdata.Org1.ID, models.RefreshChannels)
+	require.NoError(t, err)
+
+	thread, err := models.GetEmailThread(rc, testdata.Org1.ID, oa.ChannelByID(channel.ID), testdata.Cathy.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.EmailThread{MessageID: "<q1@mail.example.com>", Subject: "Question"}, thread)
+
+	// a reply to an email we sent goes to that contact if it's from one of their addresses
+	bobURNID := testdata.InsertContactURN(db, testdata.Org1, testdata.Bob, "mailto:bob@example.com", 1000)
+	out := testdata.InsertOutgoingMsg(db, testdata.Org1, channel, testdata.Bob, "Welcome", nil, models.MsgStatusSent, false)
+
+	status, _ = receive("sesame", []web.MultiPartPart{
+		{Name: "from", Data: "Bob@example.com"},
+		{Name: "subject", Data: "Re: Welcome"},
+		{Name: "text", Data: "Thanks"},
+		{Name: "headers", Data: fmt.Sprintf("Message-ID: <r1@example.com>\r\nIn-Reply-To: <%s@example.com>\r\n", out.UUID())},
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE direction = 'I' AND contact_id = $1 AND contact_urn_id = $2 AND text = 'Thanks'`, testdata.Bob.ID, bobURNID).Returns(1)
+
+	// but a reply from any other address can't claim to be that contact, and goes to the contact with that address
+	status, _ = receive("sesame", []web.MultiPartPart{
+		{Name: "from", Data: "bobby@other.com"},
+		{Name: "subject", Data: "Re: Welcome"},
+		{Name: "text", Data: "It's me Bob"},
+		{Name: "headers", Data: fmt.Sprintf("Message-ID: <r2@other.com>\r\nIn-Reply-To: <%s@example.com>\r\n", out.UUID())},
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE direction = 'I' AND contact_id = $1 AND text = 'It''s me Bob'`, testdata.Bob.ID).Returns(0)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg m JOIN contacts_contacturn u ON u.id = m.contact_urn_id WHERE m.direction = 'I' AND u.identity = 'mailto:bobby@other.com' AND m.text = 'It''s me Bob'`).Returns(1)
+
+	// an email from an unknown address creates a new contact
+	status, _ = receive("sesame", []web.MultiPartPart{
+		{Name: "from", Data: "Jim <jim@example.com>"},
+		{Name: "subject", Data: "Hello"},
+		{Name: "text", Data: "Hi there"},
+	})
+	assert.Equal(t, http.StatusOK, status)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg m JOIN contacts_contacturn u ON u.id = m.contact_urn_id WHERE m.direction = 'I' AND u.identity = 'mailto:jim@example.com' AND m.text = 'Hi there'`).Returns(1)
+}
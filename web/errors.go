@@ -1,11 +1,108 @@
 package web
 
 import (
+	"fmt"
+	"net/http"
+
+	"github.com/nyaruka/goflow/contactql"
 	"github.com/nyaruka/goflow/utils"
 
 	"github.com/pkg/errors"
 )
 
+// ErrorCode is a machine readable code for an error response so that clients can branch on failures without parsing
+// error messages. Codes take the form <area>.<problem>.
+type ErrorCode string
+
+const (
+	ErrorCodeServer        = ErrorCode("server.error")
+	ErrorCodeInvalid       = ErrorCode("request.invalid")
+	ErrorCodeNotFound      = ErrorCode("request.not_found")
+	ErrorCodeIllegalMethod = ErrorCode("request.illegal_method")
+	ErrorCodeRateLimited   = ErrorCode("request.rate_limited")
+	ErrorCodeTooLarge      = ErrorCode("request.too_large")
+	ErrorCodeUnauthorized  = ErrorCode("auth.invalid")
+
+	ErrorCodeBroadcastNotFound       = ErrorCode("broadcast.not_found")
+	ErrorCodeBroadcastInvalidStatus  = ErrorCode("broadcast.invalid_status")
+	ErrorCodeBroadcastPreviewExpired = ErrorCode("broadcast.preview_expired")
+
+	ErrorCodeCampaignNotFound = ErrorCode("campaign.not_found")
+
+	ErrorCodeChannelNotFound = ErrorCode("channel.not_found")
+
+	ErrorCodeContactNotFound   = ErrorCode("contact.not_found")
+	ErrorCodeContactInvalid    = ErrorCode("contact.invalid")
+	ErrorCodeContactURNInvalid = ErrorCode("contact.urn_invalid")
+
+	ErrorCodeEmailInvalid = ErrorCode("email.invalid")
+
+	ErrorCodeExpressionInvalid = ErrorCode("expression.invalid")
+
+	ErrorCodeFlowNotFound            = ErrorCode("flow.not_found")
+	ErrorCodeFlowInvalid             = ErrorCode("flow.invalid")
+	ErrorCodeFlowHasDependents       = ErrorCode("flow.has_dependents")
+	ErrorCodeFlowMissingDependencies = ErrorCode("flow.missing_dependencies")
+	ErrorCodeFlowMigrationNotFound   = ErrorCode("flow.migration_not_found")
+	ErrorCodeFlowMigrationInProgress = ErrorCode("flow.migration_in_progress")
+	ErrorCodeFlowFunnelNotFound      = ErrorCode("flow.funnel_not_found")
+
+	ErrorCodeImportNotFound  = ErrorCode("import.not_found")
+	ErrorCodeImportNotStaged = ErrorCode("import.not_staged")
+
+	ErrorCodeGroupInvalid     = ErrorCode("group.invalid")
+	ErrorCodeGroupJobNotFound = ErrorCode("group.job_not_found")
+
+	ErrorCodeOrgAnonymizationDisabled = ErrorCode("org.anonymization_disabled")
+	ErrorCodeOrgEventUnknownType      = ErrorCode("org.event_unknown_type")
+	ErrorCodeOrgEventStreamsExhausted = ErrorCode("org.event_streams_exhausted")
+
+	ErrorCodePOInvalid     = ErrorCode("po.invalid")
+	ErrorCodePOJobNotFound = ErrorCode("po.job_not_found")
+
+	ErrorCodeTaskUnknownType = ErrorCode("task.unknown_type")
+)
+
+// query errors keep the codes given them by the query parser, e.g. unexpected_token, under this prefix
+const errorCodeQueryPrefix = "query."
+
+// codes for error responses which handlers haven't given a code
+var defaultErrorCodes = map[int]ErrorCode{
+	http.StatusBadRequest:            ErrorCodeInvalid,
+	http.StatusUnauthorized:          ErrorCodeUnauthorized,
+	http.StatusNotFound:              ErrorCodeNotFound,
+	http.StatusMethodNotAllowed:      ErrorCodeIllegalMethod,
+	http.StatusTooManyRequests:       ErrorCodeRateLimited,
+	http.StatusRequestEntityTooLarge: ErrorCodeTooLarge,
+}
+
+// Error is an error with a code which handlers can return as their response, e.g.
+//
+//	return web.Errorf(web.ErrorCodeContactNotFound, "no such contact: %d", contactID), http.StatusNotFound, nil
+type Error struct {
+	code ErrorCode
+	err  error
+}
+
+// Errorf creates a new error with the given code and message
+func Errorf(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{code: code, err: fmt.Errorf(format, args...)}
+}
+
+// WrapError wraps the given error with the given code and message
+func WrapError(err error, code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{code: code, err: errors.Wrapf(err, format, args...)}
+}
+
+// NewError gives the given error the given code
+func NewError(code ErrorCode, err error) *Error {
+	return &Error{code: code, err: err}
+}
+
+func (e *Error) Error() string   { return e.err.Error() }
+func (e *Error) Code() ErrorCode { return e.code }
+func (e *Error) Unwrap() error   { return e.err }
+
 // ErrorResponse is the type for our error responses
 type ErrorResponse struct {
 	Error string            `json:"error"`
@@ -17,11 +114,34 @@ type ErrorResponse struct {
 func NewErrorResponse(err error) *ErrorResponse {
 	rich, isRich := errors.Cause(err).(utils.RichError)
 	if isRich {
+		code := rich.Code()
+		if _, isQueryError := rich.(*contactql.QueryError); isQueryError {
+			code = errorCodeQueryPrefix + code
+		}
+
 		return &ErrorResponse{
 			Error: rich.Error(),
-			Code:  rich.Code(),
+			Code:  code,
 			Extra: rich.Extra(),
 		}
 	}
+
+	coded := &Error{}
+	if errors.As(err, &coded) {
+		return &ErrorResponse{Error: err.Error(), Code: string(coded.code)}
+	}
+
 	return &ErrorResponse{Error: err.Error()}
 }
+
+// creates an error response for a response with the given status, which gets a default code if it doesn't have one
+func newErrorResponseForStatus(err error, status int) *ErrorResponse {
+	response := NewErrorResponse(err)
+	if response.Code == "" {
+		response.Code = string(defaultErrorCodes[status])
+		if response.Code == "" {
+			response.Code = string(ErrorCodeServer)
+		}
+	}
+	return response
+}
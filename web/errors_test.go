@@ -26,9 +26,23 @@ func TestErrorResponse(t *testing.T) {
 
 	er2 := web.NewErrorResponse(err)
 	assert.Equal(t, "mismatched input '$' expecting {'(', TEXT, STRING}", er2.Error)
-	assert.Equal(t, "unexpected_token", er2.Code)
+	assert.Equal(t, "query.unexpected_token", er2.Code)
 
 	er2JSON, err := jsonx.Marshal(er2)
 	assert.NoError(t, err)
-	assert.JSONEq(t, `{"error": "mismatched input '$' expecting {'(', TEXT, STRING}", "code": "unexpected_token", "extra": {"token": "$"}}`, string(er2JSON))
+	assert.JSONEq(t, `{"error": "mismatched input '$' expecting {'(', TEXT, STRING}", "code": "query.unexpected_token", "extra": {"token": "$"}}`, string(er2JSON))
+
+	// create an error with a code
+	er3 := web.NewErrorResponse(web.Errorf(web.ErrorCodeContactNotFound, "no such contact: %d", 123))
+	assert.Equal(t, "no such contact: 123", er3.Error)
+	assert.Equal(t, "contact.not_found", er3.Code)
+
+	// codes are found on wrapped errors too
+	er4 := web.NewErrorResponse(errors.Wrap(web.WrapError(errors.New("boom"), web.ErrorCodeFlowInvalid, "unable to read flow"), "outer"))
+	assert.Equal(t, "outer: unable to read flow: boom", er4.Error)
+	assert.Equal(t, "flow.invalid", er4.Code)
+
+	er4JSON, err := jsonx.Marshal(er4)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"error": "outer: unable to read flow: boom", "code": "flow.invalid"}`, string(er4JSON))
 }
@@ -2,9 +2,14 @@ package expression
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
+	"strings"
 
+	"github.com/nyaruka/goflow/excellent"
+	"github.com/nyaruka/goflow/excellent/types"
 	"github.com/nyaruka/goflow/flows/definition/legacy/expressions"
+	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/nyaruka/mailroom/web"
 
@@ -13,6 +18,7 @@ import (
 
 func init() {
 	web.RegisterJSONRoute(http.MethodPost, "/mr/expression/migrate", web.RequireAuthToken(handleMigrate))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/expression/evaluate", web.RequireAuthToken(handleEvaluate))
 }
 
 // Migrates a legacy expression to the new flow definition specification
@@ -31,13 +37,84 @@ type migrateResponse struct {
 func handleMigrate(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &migrateRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	migrated, err := expressions.MigrateTemplate(request.Expression, nil)
 	if err != nil {
-		return errors.Wrapf(err, "unable to migrate expression"), http.StatusUnprocessableEntity, nil
+		return web.WrapError(err, web.ErrorCodeExpressionInvalid, "unable to migrate expression"), http.StatusUnprocessableEntity, nil
 	}
 
 	return &migrateResponse{migrated}, http.StatusOK, nil
 }
+
+// Evaluates an expression, or a template containing expressions, against an example context in the org's environment.
+// The context is a JSON object whose top level keys are what expressions can reference, e.g. contact and results.
+//
+//	{
+//	  "org_id": 1,
+//	  "expression": "Hi @contact.name, you said @results.color",
+//	  "context": {
+//	    "contact": {"name": "Bob"},
+//	    "results": {"color": "red"}
+//	  }
+//	}
+type evaluateRequest struct {
+	OrgID      models.OrgID    `json:"org_id"     validate:"required"`
+	Expression string          `json:"expression" validate:"required"`
+	Context    json.RawMessage `json:"context"    validate:"required"`
+}
+
+// Result of evaluating an expression. Expressions which errored are left out of the result and their errors returned.
+//
+//	{
+//	  "result": "Hi Bob, you said red",
+//	  "errors": []
+//	}
+type evaluateResponse struct {
+	Result string   `json:"result"`
+	Errors []string `json:"errors"`
+}
+
+func handleEvaluate(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &evaluateRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	evalCtx, isObject := types.JSONToXValue(request.Context).(*types.XObject)
+	if !isObject {
+		return web.Errorf(web.ErrorCodeInvalid, "context must be a JSON object"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+	env := oa.Env()
+
+	// unlike excellent.EvaluateTemplate, keep going after errors so that we can report all of them
+	var result strings.Builder
+	errs := make([]string, 0)
+
+	err = excellent.VisitTemplate(request.Expression, evalCtx.Properties(), func(tokenType excellent.XTokenType, token string) error {
+		switch tokenType {
+		case excellent.BODY:
+			result.WriteString(token)
+		case excellent.IDENTIFIER, excellent.EXPRESSION:
+			value := excellent.EvaluateExpression(env, evalCtx, token)
+			if types.IsXError(value) {
+				errs = append(errs, value.(error).Error())
+			} else {
+				asText, _ := types.ToXText(env, value)
+				result.WriteString(asText.Native())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeExpressionInvalid, "unable to evaluate expression"), http.StatusUnprocessableEntity, nil
+	}
+
+	return &evaluateResponse{Result: result.String(), Errors: errs}, http.StatusOK, nil
+}
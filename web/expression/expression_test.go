@@ -11,4 +11,5 @@ func TestServer(t *testing.T) {
 	ctx, rt, _, _ := testsuite.Get()
 
 	web.RunWebTests(t, ctx, rt, "testdata/migrate.json", nil)
+	web.RunWebTests(t, ctx, rt, "testdata/evaluate.json", nil)
 }
@@ -0,0 +1,149 @@
+package flow
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/delete", web.RequireAuthToken(handleDelete))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/restore", web.RequireAuthToken(handleRestore))
+}
+
+// Soft-deletes a flow so that it can later be restored. A flow which is still used by active triggers, campaign events
+// or other flows can't be deleted. Sessions currently in the flow can optionally be interrupted.
+//
+//	{
+//	  "org_id": 1,
+//	  "flow_id": 23,
+//	  "interrupt": true
+//	}
+type deleteRequest struct {
+	OrgID     models.OrgID  `json:"org_id"    validate:"required"`
+	FlowID    models.FlowID `json:"flow_id"   validate:"required"`
+	Interrupt bool          `json:"interrupt"`
+}
+
+// Response for a delete request which was rejected because the flow has dependents.
+//
+//	{
+//	  "error": "flow has active dependents",
+//	  "code": "flow.has_dependents",
+//	  "dependents": {"triggers": [12], "campaign_events": [], "flows": [34]}
+//	}
+type dependentsResponse struct {
+	Error      string                 `json:"error"`
+	Code       web.ErrorCode          `json:"code"`
+	Dependents *models.FlowDependents `json:"dependents"`
+}
+
+func handleDelete(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &deleteRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	if _, err := oa.FlowByID(request.FlowID); err == models.ErrNotFound {
+		return web.Errorf(web.ErrorCodeFlowNotFound, "no such active flow"), http.StatusNotFound, nil
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load flow")
+	}
+
+	dependents, err := models.GetFlowDependents(ctx, rt.DB, request.FlowID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if !dependents.IsEmpty() {
+		return &dependentsResponse{Error: "flow has active dependents", Code: web.ErrorCodeFlowHasDependents, Dependents: dependents}, http.StatusUnprocessableEntity, nil
+	}
+
+	if err := models.DeleteFlows(ctx, rt.DB, request.OrgID, []models.FlowID{request.FlowID}); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if request.Interrupt {
+		if err := models.InterruptSessionsForFlows(ctx, rt.DB, []models.FlowID{request.FlowID}); err != nil {
+			return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to interrupt sessions")
+		}
+	}
+
+	return map[string]interface{}{"deleted": true}, http.StatusOK, nil
+}
+
+// Restores a soft-deleted flow, provided that everything it depends on still exists.
+//
+//	{
+//	  "org_id": 1,
+//	  "flow_id": 23
+//	}
+type restoreRequest struct {
+	OrgID  models.OrgID  `json:"org_id"  validate:"required"`
+	FlowID models.FlowID `json:"flow_id" validate:"required"`
+}
+
+// Response for a restore request which was rejected because the flow has missing dependencies.
+//
+//	{
+//	  "error": "flow has missing dependencies",
+//	  "code": "flow.missing_dependencies",
+//	  "missing": [{"uuid": "3a7a2d8e-c3b7-4d43-b6f1-98f4e2c1b0f5", "name": "Testers", "type": "group", "missing": true}]
+//	}
+type missingDependenciesResponse struct {
+	Error   string             `json:"error"`
+	Code    web.ErrorCode      `json:"code"`
+	Missing []flows.Dependency `json:"missing"`
+}
+
+func handleRestore(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &restoreRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	dbFlow, err := models.LoadDeletedFlowByID(ctx, rt.DB, request.OrgID, request.FlowID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load flow")
+	}
+	if dbFlow == nil {
+		return web.Errorf(web.ErrorCodeFlowNotFound, "no such deleted flow"), http.StatusNotFound, nil
+	}
+
+	flow, err := goflow.ReadFlow(rt.Config, dbFlow.Definition())
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to read flow"), http.StatusUnprocessableEntity, nil
+	}
+
+	// revalidate dependencies against current org assets as they may have changed whilst the flow was deleted
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, request.OrgID, models.RefreshFields|models.RefreshGroups|models.RefreshFlows)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	missing := make([]flows.Dependency, 0)
+	for _, dep := range flow.Inspect(oa.SessionAssets()).Dependencies {
+		if dep.Missing() {
+			missing = append(missing, dep)
+		}
+	}
+	if len(missing) > 0 {
+		return &missingDependenciesResponse{Error: "flow has missing dependencies", Code: web.ErrorCodeFlowMissingDependencies, Missing: missing}, http.StatusUnprocessableEntity, nil
+	}
+
+	if err := models.RestoreFlows(ctx, rt.DB, request.OrgID, []models.FlowID{request.FlowID}); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return map[string]interface{}{"restored": true}, http.StatusOK, nil
+}
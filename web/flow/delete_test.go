@@ -0,0 +1,28 @@
+package flow_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestDeleteAndRestore(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	// remove any existing dependents of our flows so we know what we're dealing with
+	db.MustExec(`UPDATE triggers_trigger SET is_active = FALSE`)
+	db.MustExec(`UPDATE campaigns_campaignevent SET is_active = FALSE`)
+	db.MustExec(`DELETE FROM flows_flow_flow_dependencies`)
+
+	triggerID := testdata.InsertKeywordTrigger(db, testdata.Org1, testdata.Favorites, "fav", models.MatchFirst, nil, nil)
+
+	web.RunWebTests(t, ctx, rt, "testdata/delete.json", map[string]string{
+		"trigger_id": fmt.Sprint(triggerID),
+	})
+}
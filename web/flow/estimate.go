@@ -0,0 +1,231 @@
+package flow
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/nyaruka/gocommon/gsm7"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/goflow/flows/actions"
+	"github.com/nyaruka/mailroom/core/goflow"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/search"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// how far back we look at an org's calls to estimate how long calls will last
+const estimateCallsSince = time.Hour * 24 * 30
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/estimate_start", web.RequireAuthToken(handleEstimateStart))
+}
+
+// Request to estimate the audience and cost of starting the given flow. Inclusions and exclusions are the same as for
+// previewing a start.
+//
+//	{
+//	  "org_id": 1,
+//	  "flow_id": 2,
+//	  "include": {
+//	    "group_uuids": ["5fa925e4-edd8-4e2a-ab24-b3dbb5932ddd"],
+//	    "query": ""
+//	  },
+//	  "exclude": {
+//	    "in_a_flow": true
+//	  }
+//	}
+type estimateStartRequest struct {
+	OrgID   models.OrgID      `json:"org_id"   validate:"required"`
+	FlowID  models.FlowID     `json:"flow_id"  validate:"required"`
+	Include startInclusions   `json:"include"  validate:"required"`
+	Exclude search.Exclusions `json:"exclude"`
+}
+
+type schemeEstimate struct {
+	Scheme   string                     `json:"scheme"`
+	Contacts int                        `json:"contacts"`
+	Channels []*assets.ChannelReference `json:"channels"`
+	Cost     *decimal.Decimal           `json:"cost,omitempty"`
+}
+
+type estimateStartResponse struct {
+	Query        string            `json:"query"`
+	Total        int               `json:"total"`
+	Reachable    int               `json:"reachable"`
+	Schemes      []*schemeEstimate `json:"schemes"`
+	MsgSegments  int               `json:"msg_segments"`
+	CallDuration int               `json:"call_duration,omitempty"`
+	IVRMinutes   int               `json:"ivr_minutes"`
+	Cost         *decimal.Decimal  `json:"cost,omitempty"`
+}
+
+// handles a request to estimate a flow start without starting anything, e.g.
+//
+//	{
+//	  "query": "group = \"Farmers\" AND flow = \"\"",
+//	  "total": 120,
+//	  "reachable": 115,
+//	  "schemes": [
+//	    {"scheme": "tel", "contacts": 100, "channels": [{"uuid": "74729f45-7f29-4868-9dc4-90e491e3c7d8", "name": "Twilio"}], "cost": "4.5"},
+//	    {"scheme": "whatsapp", "contacts": 15, "channels": [{"uuid": "0f661e8b-ea9d-4bd3-9953-d368340acf91", "name": "WhatsApp"}]},
+//	    {"scheme": "", "contacts": 5, "channels": []}
+//	  ],
+//	  "msg_segments": 345,
+//	  "ivr_minutes": 0,
+//	  "cost": "4.5"
+//	}
+//
+// Contacts are counted by the scheme of their preferred URN and are reachable if the org has a channel for that scheme.
+// Message segments assume every message in the flow is sent to each reachable contact so is an upper bound. For voice
+// flows, IVR minutes are estimated from the average duration of the org's recent calls.
+func handleEstimateStart(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &estimateStartRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	flow, err := oa.FlowByID(request.FlowID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load flow")
+	}
+
+	query, err := buildStartQuery(oa, flow, &request.Include, request.Exclude)
+	if err != nil {
+		isQueryError, qerr := contactql.IsQueryError(err)
+		if isQueryError {
+			return qerr, http.StatusBadRequest, nil
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	response := &estimateStartResponse{Schemes: []*schemeEstimate{}}
+	if query == "" {
+		return response, http.StatusOK, nil
+	}
+
+	counts := make(map[string]int)
+
+	parsedQuery, _, err := search.StreamContactIDsForQuery(ctx, rt.ES, oa, nil, nil, query, "", func(ids []models.ContactID) error {
+		batchCounts, err := models.CountContactsByPreferredScheme(ctx, rt.DB, ids)
+		if err != nil {
+			return err
+		}
+		for scheme, count := range batchCounts {
+			counts[scheme] += count
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "error querying start contacts")
+	}
+
+	response.Query = parsedQuery.String()
+
+	isVoice := flow.FlowType() == models.FlowTypeVoice
+	role := assets.ChannelRoleSend
+	if isVoice {
+		role = assets.ChannelRoleCall
+		response.CallDuration, err = models.GetAverageCallDuration(ctx, rt.DB, oa.OrgID(), time.Now().Add(-estimateCallsSince))
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	segmentsPerContact := 0
+	if !isVoice {
+		segmentsPerContact, err = countFlowSegments(rt, flow)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	for scheme, count := range counts {
+		estimate := &schemeEstimate{Scheme: scheme, Contacts: count, Channels: []*assets.ChannelReference{}}
+		response.Total += count
+		response.Schemes = append(response.Schemes, estimate)
+
+		if scheme == "" {
+			continue
+		}
+
+		channels := oa.ChannelsForScheme(scheme, role)
+		for _, ch := range channels {
+			estimate.Channels = append(estimate.Channels, ch.ChannelReference())
+		}
+		if len(channels) == 0 {
+			continue
+		}
+
+		response.Reachable += count
+
+		// costs are based on the channel which would be used first
+		var unitCost *decimal.Decimal
+		var units int
+		if isVoice {
+			unitCost = channels[0].CallCost(response.CallDuration)
+			units = count
+			response.IVRMinutes += count * ((response.CallDuration + 59) / 60)
+		} else {
+			unitCost = channels[0].MsgCost()
+			units = count * segmentsPerContact
+			response.MsgSegments += units
+		}
+
+		if unitCost != nil {
+			cost := unitCost.Mul(decimal.NewFromInt(int64(units)))
+			estimate.Cost = &cost
+
+			total := cost
+			if response.Cost != nil {
+				total = response.Cost.Add(cost)
+			}
+			response.Cost = &total
+		}
+	}
+
+	// largest audiences first so output is stable
+	sort.SliceStable(response.Schemes, func(i, j int) bool {
+		if response.Schemes[i].Contacts != response.Schemes[j].Contacts {
+			return response.Schemes[i].Contacts > response.Schemes[j].Contacts
+		}
+		return response.Schemes[i].Scheme < response.Schemes[j].Scheme
+	})
+
+	return response, http.StatusOK, nil
+}
+
+// counts the message segments, including attachments, of all the messages a flow could send in its base language
+func countFlowSegments(rt *runtime.Runtime, flow *models.Flow) (int, error) {
+	def, err := goflow.ReadFlow(rt.Config, flow.Definition())
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to read flow")
+	}
+
+	segments := 0
+	for _, node := range def.Nodes() {
+		for _, action := range node.Actions() {
+			if sendMsg, isSendMsg := action.(*actions.SendMsgAction); isSendMsg {
+				segments += countMsgSegments(sendMsg.Text) + len(sendMsg.Attachments)
+			}
+		}
+	}
+	return segments, nil
+}
+
+func countMsgSegments(text string) int {
+	if text == "" {
+		return 0
+	}
+	return gsm7.Segments(text)
+}
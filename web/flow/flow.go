@@ -14,12 +14,12 @@ import (
 	"github.com/nyaruka/mailroom/web"
 
 	"github.com/Masterminds/semver"
-	"github.com/pkg/errors"
 )
 
 func init() {
 	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/migrate", web.RequireAuthToken(handleMigrate))
 	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/inspect", web.RequireAuthToken(handleInspect))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/validate", web.RequireAuthToken(handleValidate))
 	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/clone", web.RequireAuthToken(handleClone))
 	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/change_language", web.RequireAuthToken(handleChangeLanguage))
 }
@@ -38,19 +38,19 @@ type migrateRequest struct {
 func handleMigrate(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &migrateRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// do a JSON to JSON migration of the definition
 	migrated, err := goflow.MigrateDefinition(rt.Config, request.Flow, request.ToVersion)
 	if err != nil {
-		return errors.Wrapf(err, "unable to migrate flow"), http.StatusUnprocessableEntity, nil
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to migrate flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	// try to read result to check that it's valid
 	_, err = goflow.ReadFlow(rt.Config, migrated)
 	if err != nil {
-		return errors.Wrapf(err, "unable to read migrated flow"), http.StatusUnprocessableEntity, nil
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to read migrated flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	return migrated, http.StatusOK, nil
@@ -72,12 +72,12 @@ type inspectRequest struct {
 func handleInspect(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &inspectRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	flow, err := goflow.ReadFlow(rt.Config, request.Flow)
 	if err != nil {
-		return errors.Wrapf(err, "unable to read flow"), http.StatusUnprocessableEntity, nil
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to read flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	var sa flows.SessionAssets
@@ -93,6 +93,51 @@ func handleInspect(ctx context.Context, rt *runtime.Runtime, r *http.Request) (i
 	return flow.Inspect(sa), http.StatusOK, nil
 }
 
+// Validates a flow against the current assets of an org before it is published, returning any issues such as missing
+// groups, fields, channels or templates, and expressions which can't be parsed.
+//
+//	{
+//	  "flow": { "uuid": "468621a8-32e6-4cd2-afc1-04416f7151f0", "nodes": [...]},
+//	  "org_id": 1
+//	}
+//
+//	{
+//	  "issues": [
+//	    {
+//	      "type": "missing_dependency",
+//	      "node_uuid": "a58be63b-907d-4a1a-856b-0bb5579d7507",
+//	      "action_uuid": "2d3a4a2f-e9a1-4b7a-a8a0-f6f4e1bbd1f2",
+//	      "description": "missing group dependency '5e9d8fab-5e7e-4f51-b533-261af5dea70d'",
+//	      "dependency": {"uuid": "5e9d8fab-5e7e-4f51-b533-261af5dea70d", "name": "Testers", "type": "group"}
+//	    }
+//	  ]
+//	}
+type validateRequest struct {
+	Flow  json.RawMessage `json:"flow"   validate:"required"`
+	OrgID models.OrgID    `json:"org_id" validate:"required"`
+}
+
+func handleValidate(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &validateRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	flow, err := goflow.ReadFlow(rt.Config, request.Flow)
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to read flow"), http.StatusUnprocessableEntity, nil
+	}
+
+	// editors may have just created the assets the flow uses so make sure we have the latest
+	refresh := models.RefreshChannels | models.RefreshFields | models.RefreshGroups | models.RefreshGlobals | models.RefreshTemplates | models.RefreshLabels | models.RefreshFlows
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, request.OrgID, refresh)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return map[string]interface{}{"issues": goflow.CheckFlow(oa.SessionAssets(), flow)}, http.StatusOK, nil
+}
+
 // Clones a flow, replacing all UUIDs with either the given mapping or new random UUIDs.
 //
 //	{
@@ -110,19 +155,19 @@ type cloneRequest struct {
 func handleClone(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &cloneRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// try to clone the flow definition
 	cloneJSON, err := goflow.CloneDefinition(request.Flow, request.DependencyMapping)
 	if err != nil {
-		return errors.Wrapf(err, "unable to read flow"), http.StatusUnprocessableEntity, nil
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to read flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	// read flow to check that cloning produced something valid
 	_, err = goflow.ReadFlow(rt.Config, cloneJSON)
 	if err != nil {
-		return errors.Wrapf(err, "unable to clone flow"), http.StatusUnprocessableEntity, nil
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to clone flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	return cloneJSON, http.StatusOK, nil
@@ -142,17 +187,17 @@ type changeLanguageRequest struct {
 func handleChangeLanguage(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &changeLanguageRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	flow, err := goflow.ReadFlow(rt.Config, request.Flow)
 	if err != nil {
-		return errors.Wrapf(err, "unable to read flow"), http.StatusUnprocessableEntity, nil
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to read flow"), http.StatusUnprocessableEntity, nil
 	}
 
 	copy, err := flow.ChangeLanguage(request.Language)
 	if err != nil {
-		return errors.Wrapf(err, "unable to change flow language"), http.StatusUnprocessableEntity, nil
+		return web.WrapError(err, web.ErrorCodeFlowInvalid, "unable to change flow language"), http.StatusUnprocessableEntity, nil
 	}
 
 	return copy, http.StatusOK, nil
@@ -14,4 +14,5 @@ func TestServer(t *testing.T) {
 	web.RunWebTests(t, ctx, rt, "testdata/clone.json", nil)
 	web.RunWebTests(t, ctx, rt, "testdata/inspect.json", nil)
 	web.RunWebTests(t, ctx, rt, "testdata/migrate.json", nil)
+	web.RunWebTests(t, ctx, rt, "testdata/validate.json", nil)
 }
@@ -0,0 +1,59 @@
+package flow
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/funnel", web.RequireAuthToken(handleFunnel))
+}
+
+// Request for the latest computed funnel of a flow.
+//
+//	{
+//	  "org_id": 1,
+//	  "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85"
+//	}
+type funnelRequest struct {
+	OrgID    models.OrgID    `json:"org_id"    validate:"required"`
+	FlowUUID assets.FlowUUID `json:"flow_uuid" validate:"required"`
+}
+
+// handles a request for the latest funnel computed for a flow, e.g.
+//
+//	{
+//	  "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85",
+//	  "since": "2022-10-01T00:00:00Z",
+//	  "until": "2022-11-01T00:00:00Z",
+//	  "runs": 120,
+//	  "nodes": [
+//	    {"node_uuid": "72a1f5df-49f9-45df-94c9-d86f7ea064e5", "visits": 120, "drop_offs": 10, "drop_off_rate": 0.0833},
+//	    {"node_uuid": "3dcccbb4-d29c-41dd-a01f-16d814c9ab82", "visits": 110, "drop_offs": 0, "drop_off_rate": 0}
+//	  ],
+//	  "computed_on": "2022-11-02T12:00:00.000000Z"
+//	}
+func handleFunnel(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &funnelRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	funnel, err := models.GetFlowFunnel(rc, request.OrgID, request.FlowUUID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if funnel == nil {
+		return web.Errorf(web.ErrorCodeFlowFunnelNotFound, "no funnel computed for flow"), http.StatusNotFound, nil
+	}
+
+	return funnel, http.StatusOK, nil
+}
@@ -0,0 +1,32 @@
+package flow_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunnel(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	funnel := &models.FlowFunnel{
+		FlowUUID:   testdata.Favorites.UUID,
+		Since:      time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC),
+		Until:      time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC),
+		Runs:       3,
+		Nodes:      []*models.FlowFunnelNode{{NodeUUID: "72a1f5df-49f9-45df-94c9-d86f7ea064e5", Visits: 3, DropOffs: 1, DropOffRate: 0.3333}},
+		ComputedOn: time.Date(2022, 11, 2, 12, 0, 0, 0, time.UTC),
+	}
+	require.NoError(t, models.SetFlowFunnel(rc, testdata.Org1.ID, funnel))
+
+	web.RunWebTests(t, ctx, rt, "testdata/funnel.json", nil)
+}
@@ -0,0 +1,93 @@
+package flow
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/migration", web.RequireAuthToken(handleMigration))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/flow/migration/rollback", web.RequireAuthToken(handleMigrationRollback))
+}
+
+// Request for the status of the latest migration of an org's flows, or to roll it back.
+//
+//	{
+//	  "org_id": 1
+//	}
+type migrationRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+}
+
+// handles a request for the status of an org's latest flow migration, e.g.
+//
+//	{
+//	  "status": "complete",
+//	  "to_version": "13.1.0",
+//	  "total": 3,
+//	  "migrated": 1,
+//	  "skipped": 1,
+//	  "failed": 1,
+//	  "results": [
+//	    {"flow_id": 12, "name": "Registration", "from_version": "13.0.0", "from_revision": 4, "revision": 5},
+//	    {"flow_id": 14, "name": "Survey", "from_version": "11.12", "from_revision": 2, "error": "unable to migrate flow: ..."}
+//	  ],
+//	  "started_on": "2022-10-01T12:00:00.000000Z",
+//	  "completed_on": "2022-10-01T12:00:03.000000Z"
+//	}
+func handleMigration(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &migrationRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	migration, err := models.GetFlowMigration(rc, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if migration == nil {
+		return web.Errorf(web.ErrorCodeFlowMigrationNotFound, "no flow migration for org"), http.StatusNotFound, nil
+	}
+
+	return migration, http.StatusOK, nil
+}
+
+// handles a request to roll back an org's latest flow migration, restoring the previous revision of each migrated flow
+// which hasn't been saved again since. Returns the updated migration.
+func handleMigrationRollback(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &migrationRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	migration, err := models.GetFlowMigration(rc, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if migration == nil {
+		return web.Errorf(web.ErrorCodeFlowMigrationNotFound, "no flow migration for org"), http.StatusNotFound, nil
+	}
+	if migration.Status == models.FlowMigrationStatusInProgress {
+		return web.Errorf(web.ErrorCodeFlowMigrationInProgress, "flow migration is still in progress"), http.StatusConflict, nil
+	}
+
+	if err := models.RollbackFlowMigration(ctx, rt.DB, request.OrgID, migration); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	if err := models.SetFlowMigration(rc, request.OrgID, migration); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return migration, http.StatusOK, nil
+}
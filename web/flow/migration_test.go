@@ -0,0 +1,31 @@
+package flow_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigration(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetAll)
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)))
+	defer dates.SetNowSource(dates.DefaultNowSource)
+
+	migration := models.NewFlowMigration("13.1.0", 3)
+	migration.Skipped = 2
+	migration.Results = append(migration.Results, &models.FlowMigrationResult{FlowID: testdata.Favorites.ID, Name: "Favorites", FromVersion: "13.0.0", FromRevision: 1, Error: "unable to migrate flow"})
+	require.NoError(t, models.SetFlowMigration(rc, testdata.Org2.ID, migration))
+
+	web.RunWebTests(t, ctx, rt, "testdata/migration.json", nil)
+}
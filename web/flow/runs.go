@@ -0,0 +1,93 @@
+package flow
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodPost, "/mr/flow/export_runs", web.RequireAuthTokenHandler(handleExportRuns))
+}
+
+// Streams the runs of a flow as newline delimited JSON in order of id, optionally limited to those modified since the
+// given time. Each run is written on its own line and followed by a final summary line with the id of the last run,
+// which can be passed as after_id to resume an export which was cut short.
+//
+//	{
+//	  "org_id": 1,
+//	  "flow_uuid": "9de3663f-c5c5-4c92-9f45-ecbc09abcc85",
+//	  "after_id": 0,
+//	  "modified_since": "2022-10-01T00:00:00Z"
+//	}
+//
+//	{"id": 1234, "uuid": "...", "contact_id": 235, "status": "C", "results": {...}, ...}
+//	{"id": 1235, "uuid": "...", "contact_id": 236, "status": "W", "results": {...}, ...}
+//	{"total": 2, "last_id": 1235}
+type exportRunsRequest struct {
+	OrgID         models.OrgID     `json:"org_id"    validate:"required"`
+	FlowUUID      assets.FlowUUID  `json:"flow_uuid" validate:"required"`
+	AfterID       models.FlowRunID `json:"after_id"`
+	ModifiedSince *time.Time       `json:"modified_since"`
+}
+
+type exportRunsSummary struct {
+	Total  int              `json:"total"`
+	LastID models.FlowRunID `json:"last_id"`
+}
+
+// handles a streamed export of a flow's runs
+func handleExportRuns(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	request := &exportRunsRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		web.WriteErrorResponse(w, web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest)
+		return nil
+	}
+
+	flow, err := models.LoadFlowByUUID(ctx, rt.DB, request.OrgID, request.FlowUUID)
+	if err != nil {
+		return errors.Wrapf(err, "error loading flow")
+	}
+	if flow == nil {
+		web.WriteErrorResponse(w, web.Errorf(web.ErrorCodeFlowNotFound, "no such flow: %s", request.FlowUUID), http.StatusNotFound)
+		return nil
+	}
+
+	since := time.Time{}
+	if request.ModifiedSince != nil {
+		since = *request.ModifiedSince
+	}
+
+	out := web.NewNDJSONWriter(w)
+	summary := &exportRunsSummary{LastID: request.AfterID}
+
+	err = models.StreamFlowRuns(ctx, rt.ReadonlyDB, request.OrgID, flow.ID(), request.AfterID, since, func(run *models.ExportedRun) error {
+		summary.Total++
+		summary.LastID = run.ID
+
+		if err := out.Write(run); err != nil {
+			return err
+		}
+
+		// flush every so often so that callers can start processing before we're done
+		if summary.Total%1000 == 0 {
+			out.Flush()
+		}
+		return nil
+	})
+
+	if err != nil {
+		if !out.Started() {
+			return err
+		}
+		return out.WriteError(err)
+	}
+
+	return out.Write(summary)
+}
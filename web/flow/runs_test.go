@@ -0,0 +1,61 @@
+package flow_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportRuns(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	testdata.InsertFlowRun(rt.DB, testdata.Org1, models.SessionID(0), testdata.Cathy, testdata.Favorites, models.RunStatusCompleted)
+	run2ID := testdata.InsertFlowRun(rt.DB, testdata.Org1, models.SessionID(0), testdata.Bob, testdata.Favorites, models.RunStatusWaiting)
+	testdata.InsertFlowRun(rt.DB, testdata.Org1, models.SessionID(0), testdata.Bob, testdata.PickANumber, models.RunStatusWaiting)
+
+	wg := &sync.WaitGroup{}
+	server := web.NewServer(ctx, rt, wg)
+	server.Start()
+
+	// give our server time to start
+	time.Sleep(time.Second)
+
+	defer server.Stop()
+
+	export := func(body string) (int, []string) {
+		req, _ := http.NewRequest("POST", "http://localhost:8090/mr/flow/export_runs", bytes.NewReader([]byte(body)))
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+
+		content, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, strings.Split(strings.TrimSpace(string(content)), "\n")
+	}
+
+	status, lines := export(fmt.Sprintf(`{"org_id": 1, "flow_uuid": "%s"}`, testdata.Favorites.UUID))
+	assert.Equal(t, 200, status)
+	assert.Len(t, lines, 3)
+	assert.Equal(t, fmt.Sprintf(`{"total":2,"last_id":%d}`, run2ID), lines[2])
+
+	// exports can be resumed from the last run seen
+	status, lines = export(fmt.Sprintf(`{"org_id": 1, "flow_uuid": "%s", "after_id": %d}`, testdata.Favorites.UUID, run2ID))
+	assert.Equal(t, 200, status)
+	assert.Equal(t, []string{fmt.Sprintf(`{"total":0,"last_id":%d}`, run2ID)}, lines)
+
+	status, _ = export(`{"org_id": 1, "flow_uuid": "3a5ed3d1-0a4f-4f2c-9a2e-7f1c0e57f2a1"}`)
+	assert.Equal(t, 404, status)
+}
@@ -51,18 +51,20 @@ func init() {
 //	  }
 //	}
 type previewStartRequest struct {
-	OrgID   models.OrgID  `json:"org_id"    validate:"required"`
-	FlowID  models.FlowID `json:"flow_id"   validate:"required"`
-	Include struct {
-		GroupUUIDs   []assets.GroupUUID  `json:"group_uuids"`
-		ContactUUIDs []flows.ContactUUID `json:"contact_uuids"`
-		URNs         []urns.URN          `json:"urns"`
-		Query        string              `json:"query"`
-	} `json:"include"   validate:"required"`
+	OrgID      models.OrgID      `json:"org_id"       validate:"required"`
+	FlowID     models.FlowID     `json:"flow_id"      validate:"required"`
+	Include    startInclusions   `json:"include"      validate:"required"`
 	Exclude    search.Exclusions `json:"exclude"`
 	SampleSize int               `json:"sample_size"  validate:"required"`
 }
 
+type startInclusions struct {
+	GroupUUIDs   []assets.GroupUUID  `json:"group_uuids"`
+	ContactUUIDs []flows.ContactUUID `json:"contact_uuids"`
+	URNs         []urns.URN          `json:"urns"`
+	Query        string              `json:"query"`
+}
+
 type previewStartResponse struct {
 	Query     string                `json:"query"`
 	Total     int                   `json:"total"`
@@ -73,7 +75,7 @@ type previewStartResponse struct {
 func handlePreviewStart(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &previewStartRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
@@ -86,15 +88,7 @@ func handlePreviewStart(ctx context.Context, rt *runtime.Runtime, r *http.Reques
 		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load flow")
 	}
 
-	groups := make([]*models.Group, 0, len(request.Include.GroupUUIDs))
-	for _, groupUUID := range request.Include.GroupUUIDs {
-		g := oa.GroupByUUID(groupUUID)
-		if g != nil {
-			groups = append(groups, g)
-		}
-	}
-
-	query, err := search.BuildStartQuery(oa, flow, groups, request.Include.ContactUUIDs, request.Include.URNs, request.Include.Query, request.Exclude)
+	query, err := buildStartQuery(oa, flow, &request.Include, request.Exclude)
 	if err != nil {
 		isQueryError, qerr := contactql.IsQueryError(err)
 		if isQueryError {
@@ -120,3 +114,15 @@ func handlePreviewStart(ctx context.Context, rt *runtime.Runtime, r *http.Reques
 		Metadata:  inspection,
 	}, http.StatusOK, nil
 }
+
+func buildStartQuery(oa *models.OrgAssets, flow *models.Flow, include *startInclusions, exclude search.Exclusions) (string, error) {
+	groups := make([]*models.Group, 0, len(include.GroupUUIDs))
+	for _, groupUUID := range include.GroupUUIDs {
+		g := oa.GroupByUUID(groupUUID)
+		if g != nil {
+			groups = append(groups, g)
+		}
+	}
+
+	return search.BuildStartQuery(oa, flow, groups, include.ContactUUIDs, include.URNs, include.Query, exclude)
+}
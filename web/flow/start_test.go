@@ -23,3 +23,9 @@ func TestPreviewStart(t *testing.T) {
 
 	web.RunWebTests(t, ctx, rt, "testdata/preview_start.json", nil)
 }
+
+func TestEstimateStart(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	web.RunWebTests(t, ctx, rt, "testdata/estimate_start.json", nil)
+}
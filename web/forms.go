@@ -6,6 +6,7 @@ import (
 
 	"github.com/gorilla/schema"
 	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/utils/bodies"
 	validator "gopkg.in/go-playground/validator.v9"
 )
 
@@ -52,6 +53,11 @@ func DecodeAndValidateForm(form interface{}, r *http.Request) error {
 	return validate.Struct(form)
 }
 
+// ReadAndValidateJSON reads the body of the passed in request as JSON into the given struct and validates it
 func ReadAndValidateJSON(r *http.Request, v interface{}) error {
-	return utils.UnmarshalAndValidateWithLimit(r.Body, v, maxRequestBytes)
+	body, err := bodies.Read(r)
+	if err != nil {
+		return err
+	}
+	return utils.UnmarshalAndValidate(body, v)
 }
@@ -0,0 +1,161 @@
+package group
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/contacts"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/group/export/start", web.RequireAuthToken(handleExportStart))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/group/import/start", web.RequireAuthToken(handleImportStart))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/group/job", web.RequireAuthToken(handleJob))
+}
+
+// Starts a background export of the given set of groups, which produces a JSON file of the groups that can be imported
+// into another org. Returns the new job whose status can be fetched from /mr/group/job.
+//
+//	{
+//	  "org_id": 1,
+//	  "group_ids": [123, 354]
+//	}
+type exportStartRequest struct {
+	OrgID    models.OrgID     `json:"org_id"    validate:"required"`
+	GroupIDs []models.GroupID `json:"group_ids" validate:"required"`
+}
+
+func handleExportStart(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &exportStartRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	job := models.NewGroupJob(models.GroupJobTypeExport, len(request.GroupIDs))
+	task := &contacts.ExportGroupsTask{JobUUID: job.UUID, GroupIDs: request.GroupIDs}
+
+	if err := queueGroupJob(ctx, rt, request.OrgID, job, contacts.TypeExportGroups, task); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return job, http.StatusOK, nil
+}
+
+// Starts a background import of groups from an uploaded file like that produced by an export. Returns the new job
+// whose status can be fetched from /mr/group/job.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3
+//	}
+type importStartForm struct {
+	OrgID  models.OrgID  `form:"org_id"  validate:"required"`
+	UserID models.UserID `form:"user_id" validate:"required"`
+}
+
+func handleImportStart(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	form := &importStartForm{}
+	if err := web.DecodeAndValidateForm(form, r); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	file, _, err := r.FormFile("groups")
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "missing groups file on request"), http.StatusBadRequest, nil
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error reading groups file")
+	}
+
+	// check the upload is readable before queuing anything
+	groups, err := contacts.ReadUploadedGroups(data)
+	if err != nil {
+		return web.NewError(web.ErrorCodeGroupInvalid, err), http.StatusBadRequest, nil
+	}
+
+	job := models.NewGroupJob(models.GroupJobTypeImport, len(groups))
+	uploadPath := models.GroupJobPath(rt, form.OrgID, job.UUID, "upload.json")
+
+	if _, err := rt.AttachmentStorage.Put(ctx, uploadPath, "application/json", data); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error saving groups file")
+	}
+
+	task := &contacts.ImportGroupsTask{JobUUID: job.UUID, UserID: form.UserID, Upload: uploadPath}
+
+	if err := queueGroupJob(ctx, rt, form.OrgID, job, contacts.TypeImportGroups, task); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return job, http.StatusOK, nil
+}
+
+// Request for the status of a group job.
+//
+//	{
+//	  "org_id": 1,
+//	  "job_uuid": "a0c8f0a6-1fd2-4e9c-b4b4-79ab5e9b0e4f"
+//	}
+type jobRequest struct {
+	OrgID   models.OrgID `json:"org_id"   validate:"required"`
+	JobUUID uuids.UUID   `json:"job_uuid" validate:"required"`
+}
+
+// handles a request for the status of a group job, e.g.
+//
+//	{
+//	  "uuid": "a0c8f0a6-1fd2-4e9c-b4b4-79ab5e9b0e4f",
+//	  "type": "import",
+//	  "status": "complete",
+//	  "total": 2,
+//	  "succeeded": 1,
+//	  "failed": 1,
+//	  "results": [
+//	    {"uuid": "c153e265-f7c9-4539-9dbc-9b358714b638", "name": "Doctors", "created": true, "members": 120, "missing": 3},
+//	    {"uuid": "d636c966-79c1-4417-9f1c-82ad629773a2", "name": "Youth", "query": "age < 25", "error": "invalid group query: ..."}
+//	  ],
+//	  "created_on": "2022-10-01T12:00:00.000000Z",
+//	  "completed_on": "2022-10-01T12:00:03.000000Z"
+//	}
+func handleJob(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &jobRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	job, err := models.GetGroupJob(rc, request.OrgID, request.JobUUID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if job == nil {
+		return web.Errorf(web.ErrorCodeGroupJobNotFound, "no such group job: %s", request.JobUUID), http.StatusNotFound, nil
+	}
+
+	return job, http.StatusOK, nil
+}
+
+// saves the given pending job and queues the task which will perform it
+func queueGroupJob(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, job *models.GroupJob, taskType string, task interface{}) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.SetGroupJob(rc, orgID, job); err != nil {
+		return err
+	}
+
+	err := queue.AddTask(ctx, rc, queue.BatchQueue, taskType, int(orgID), task, queue.DefaultPriority)
+	return errors.Wrapf(err, "error queuing %s task", taskType)
+}
@@ -0,0 +1,16 @@
+package group_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestJobs(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis | testsuite.ResetStorage)
+
+	web.RunWebTests(t, ctx, rt, "testdata/jobs.json", nil)
+}
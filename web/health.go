@@ -0,0 +1,122 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/pkg/errors"
+)
+
+// how long each dependency has to respond to a readiness check
+const readyCheckTimeout = 5 * time.Second
+
+// component status constants
+const (
+	componentStatusOK    = "ok"
+	componentStatusError = "error"
+)
+
+type componentStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthResponse struct {
+	Status     string                      `json:"status"`
+	Components map[string]*componentStatus `json:"components,omitempty"`
+}
+
+// the dependencies we check before reporting that we're ready to serve requests
+var readyChecks = map[string]func(context.Context, *runtime.Runtime) error{
+	"database": func(ctx context.Context, rt *runtime.Runtime) error {
+		return rt.DB.PingContext(ctx)
+	},
+	"redis": func(ctx context.Context, rt *runtime.Runtime) error {
+		rc, err := rt.RP.GetContext(ctx)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		_, err = rc.Do("PING")
+		return err
+	},
+	"elastic": func(ctx context.Context, rt *runtime.Runtime) error {
+		if rt.ES == nil {
+			return errors.New("no elastic client")
+		}
+		_, _, err := rt.ES.Ping(rt.Config.Elastic).Do(ctx)
+		return err
+	},
+	"attachment_storage": func(ctx context.Context, rt *runtime.Runtime) error {
+		return rt.AttachmentStorage.Test(ctx)
+	},
+	"session_storage": func(ctx context.Context, rt *runtime.Runtime) error {
+		return rt.SessionStorage.Test(ctx)
+	},
+}
+
+// handleHealth is the liveness check which only tells the caller that we're up and handling requests
+//
+//	GET /mr/health
+//
+//	{"status": "ok"}
+func handleHealth(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return &healthResponse{Status: componentStatusOK}, http.StatusOK, nil
+}
+
+// handleReady is the readiness check which checks that we can reach all the things we depend on, returning a 503 if
+// any of them can't be reached
+//
+//	GET /mr/ready
+//
+//	{
+//	  "status": "error",
+//	  "components": {
+//	    "database": {"status": "ok"},
+//	    "redis": {"status": "error", "error": "dial tcp 127.0.0.1:6379: connect: connection refused"},
+//	    ...
+//	  }
+//	}
+func handleReady(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, readyCheckTimeout)
+	defer cancel()
+
+	response := &healthResponse{Status: componentStatusOK, Components: make(map[string]*componentStatus, len(readyChecks))}
+
+	// run our checks in parallel so one slow dependency doesn't hold up the others
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range readyChecks {
+		wg.Add(1)
+
+		go func(name string, check func(context.Context, *runtime.Runtime) error) {
+			defer wg.Done()
+
+			status := &componentStatus{Status: componentStatusOK}
+			if err := check(ctx, rt); err != nil {
+				status.Status = componentStatusError
+				status.Error = err.Error()
+			}
+
+			mutex.Lock()
+			response.Components[name] = status
+			mutex.Unlock()
+		}(name, check)
+	}
+
+	wg.Wait()
+
+	for _, status := range response.Components {
+		if status.Status != componentStatusOK {
+			response.Status = componentStatusError
+			return response, http.StatusServiceUnavailable, nil
+		}
+	}
+
+	return response, http.StatusOK, nil
+}
@@ -17,9 +17,9 @@ import (
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/tasks/handler"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/logs"
 	"github.com/nyaruka/mailroom/web"
 	"github.com/pkg/errors"
-	"github.com/sirupsen/logrus"
 )
 
 func init() {
@@ -40,6 +40,9 @@ func newIVRHandler(handler ivrHandlerFn, logType models.ChannelLogType) web.Hand
 			return writeGenericErrorResponse(w, err)
 		}
 
+		ctx = logs.With(ctx, "org_id", orgID)
+		ctx = logs.With(ctx, "channel_uuid", channelUUID)
+
 		// load our org assets
 		oa, err := models.GetOrgAssets(ctx, rt, orgID)
 		if err != nil {
@@ -52,6 +55,8 @@ func newIVRHandler(handler ivrHandlerFn, logType models.ChannelLogType) web.Hand
 			return writeGenericErrorResponse(w, errors.Wrapf(err, "no active channel with uuid: %s", channelUUID))
 		}
 
+		ctx = logs.With(ctx, "channel_type", ch.Type())
+
 		// get the IVR service for this channel
 		svc, err := ivr.GetService(ch)
 		if svc == nil {
@@ -61,6 +66,7 @@ func newIVRHandler(handler ivrHandlerFn, logType models.ChannelLogType) web.Hand
 		// validate this request's signature
 		err = svc.ValidateRequestSignature(r)
 		if err != nil {
+			ivr.RecordSignatureFailure(orgID, ch)
 			return svc.WriteErrorResponse(w, errors.Wrapf(err, "request failed signature validation"))
 		}
 
@@ -71,22 +77,28 @@ func newIVRHandler(handler ivrHandlerFn, logType models.ChannelLogType) web.Hand
 
 		clog := models.NewChannelLogForIncoming(logType, ch, recorder, svc.RedactValues(ch))
 
+		start := time.Now()
+
 		call, rerr := handler(ctx, rt, oa, ch, svc, r, recorder.ResponseWriter)
+
+		ivr.RecordCallbackDuration(orgID, ch, logType, time.Since(start))
 		if call != nil {
+			ctx = logs.With(ctx, "call_id", call.ID())
+
 			clog.SetCall(call)
 			if err := call.AttachLog(ctx, rt.DB, clog); err != nil {
-				logrus.WithError(err).WithField("http_request", r).Error("error attaching ivr channel log")
+				logs.From(ctx).WithError(err).Error("error attaching ivr channel log")
 			}
 		}
 
 		if err := recorder.End(); err != nil {
-			logrus.WithError(err).WithField("http_request", r).Error("error recording IVR request")
+			logs.From(ctx).WithError(err).Error("error recording IVR request")
 		}
 
 		clog.End()
 
 		if err := models.InsertChannelLogs(ctx, rt.DB, []*models.ChannelLog{clog}); err != nil {
-			logrus.WithError(err).WithField("http_request", r).Error("error writing ivr channel log")
+			logs.From(ctx).WithError(err).Error("error writing ivr channel log")
 		}
 
 		return rerr
@@ -101,7 +113,7 @@ func handleIncoming(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 	}
 
 	// get the contact for this URN
-	contact, _, _, err := models.GetOrCreateContact(ctx, rt.DB, oa, []urns.URN{urn}, ch.ID())
+	contact, flowContact, isNewContact, err := models.GetOrCreateContact(ctx, rt.DB, oa, []urns.URN{urn}, ch.ID())
 	if err != nil {
 		return nil, svc.WriteErrorResponse(w, errors.Wrapf(err, "unable to get contact by urn"))
 	}
@@ -117,9 +129,6 @@ func handleIncoming(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 		return nil, svc.WriteErrorResponse(w, errors.Wrapf(err, "unable to get id for URN"))
 	}
 
-	// we first create an incoming call channel event and see if that matches
-	event := models.NewChannelEvent(models.MOCallEventType, oa.OrgID(), ch.ID(), contact.ID(), urnID, nil, false)
-
 	externalID, err := svc.CallIDForRequest(r)
 	if err != nil {
 		return nil, svc.WriteErrorResponse(w, errors.Wrapf(err, "unable to get external id from request"))
@@ -131,10 +140,39 @@ func handleIncoming(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 		return nil, svc.WriteErrorResponse(w, errors.Wrapf(err, "error creating call"))
 	}
 
+	ctx = logs.With(ctx, "contact_id", contact.ID())
+	ctx = logs.With(ctx, "call_id", call.ID())
+
+	// if the org screens incoming calls, ask its hook what to do with this one
+	var extra map[string]interface{}
+
+	screening, sclog := ivr.ScreenCall(ctx, oa, ch, call, flowContact, urn, isNewContact)
+	if sclog != nil {
+		if err := models.InsertChannelLogs(ctx, rt.DB, []*models.ChannelLog{sclog}); err != nil {
+			logs.From(ctx).WithError(err).Error("error inserting channel log")
+		}
+	}
+	if screening != nil {
+		if screening.Action == ivr.ScreeningActionReject {
+			return call, svc.WriteRejectResponse(w)
+		}
+
+		extra = make(map[string]interface{}, len(screening.Params)+1)
+		for k, v := range screening.Params {
+			extra[k] = v
+		}
+		if screening.Action == ivr.ScreeningActionRoute {
+			extra[models.ChannelEventExtraFlowUUID] = string(screening.FlowUUID)
+		}
+	}
+
+	// we first create an incoming call channel event and see if that matches
+	event := models.NewChannelEvent(models.MOCallEventType, oa.OrgID(), ch.ID(), contact.ID(), urnID, extra, false)
+
 	// try to handle this event
 	session, err := handler.HandleChannelEvent(ctx, rt, models.MOCallEventType, event, call)
 	if err != nil {
-		logrus.WithError(err).WithField("http_request", r).Error("error handling incoming call")
+		logs.From(ctx).WithError(err).Error("error handling incoming call")
 
 		return call, svc.WriteErrorResponse(w, errors.Wrapf(err, "error handling incoming call"))
 	}
@@ -146,6 +184,10 @@ func handleIncoming(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 			return call, svc.WriteRejectResponse(w)
 		}
 
+		if err := ivr.ScheduleCutoff(ctx, rt, oa, ch, call); err != nil {
+			logs.From(ctx).WithError(err).Error("error scheduling call cutoff")
+		}
+
 		// build our resume URL
 		resumeURL := buildResumeURL(rt.Config, ch, call, urn)
 
@@ -209,6 +251,9 @@ func handleCallback(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 		return nil, errors.Wrapf(err, "unable to load call with id: %d", request.ConnectionID)
 	}
 
+	ctx = logs.With(ctx, "contact_id", conn.ContactID())
+	ctx = logs.With(ctx, "call_id", conn.ID())
+
 	// load our contact
 	contacts, err := models.LoadContacts(ctx, rt.ReadonlyDB, oa, []models.ContactID{conn.ContactID()})
 	if err != nil {
@@ -255,7 +300,7 @@ func handleCallback(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAsse
 
 	// had an error? mark our call as errored and log it
 	if err != nil {
-		logrus.WithError(err).WithField("http_request", r).Error("error while handling IVR")
+		logs.From(ctx).WithError(err).Error("error while handling IVR")
 		return conn, ivr.HandleAsFailure(ctx, rt.DB, svc, conn, w, err)
 	}
 
@@ -294,11 +339,14 @@ func handleStatus(ctx context.Context, rt *runtime.Runtime, oa *models.OrgAssets
 		return nil, svc.WriteErrorResponse(w, errors.Wrapf(err, "unable to load call with id: %s", externalID))
 	}
 
+	ctx = logs.With(ctx, "contact_id", conn.ContactID())
+	ctx = logs.With(ctx, "call_id", conn.ID())
+
 	err = ivr.HandleIVRStatus(ctx, rt, oa, svc, conn, r, w)
 
 	// had an error? mark our call as errored and log it
 	if err != nil {
-		logrus.WithError(err).WithField("http_request", r).Error("error while handling status")
+		logs.From(ctx).WithError(err).Error("error while handling status")
 		return conn, ivr.HandleAsFailure(ctx, rt.DB, svc, conn, w, err)
 	}
 
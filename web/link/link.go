@@ -0,0 +1,54 @@
+package link
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/handler"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	web.RegisterRoute(http.MethodGet, "/mr/link/{code:[0-9a-zA-Z]+}", handleClick)
+}
+
+// Redirects a tracked short link to its URL, recording the click as a channel event on the contact it was sent to.
+// Failing to record a click shouldn't stop the contact getting to where they clicked, so errors are only logged.
+//
+//	GET /mr/link/Ab3dEf7h
+func handleClick(ctx context.Context, rt *runtime.Runtime, r *http.Request, rawW http.ResponseWriter) error {
+	link, err := models.LoadTrackedLinkByCode(ctx, rt.DB, chi.URLParam(r, "code"))
+	if err != nil {
+		return err
+	}
+
+	if link == nil {
+		rawW.WriteHeader(http.StatusNotFound)
+		rawW.Write([]byte(`{"error": "no such link"}`))
+		return nil
+	}
+
+	if err := recordClick(ctx, rt, link); err != nil {
+		logrus.WithError(err).WithField("link_id", link.ID).Error("error recording link click")
+	}
+
+	http.Redirect(rawW, r, link.URL, http.StatusFound)
+	return nil
+}
+
+func recordClick(ctx context.Context, rt *runtime.Runtime, link *models.TrackedLink) error {
+	event := link.NewClickEvent()
+	if err := event.Insert(ctx, rt.DB); err != nil {
+		return errors.Wrap(err, "error inserting link clicked event")
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	return errors.Wrap(handler.QueueLinkClickedEvent(rc, event), "error queuing link clicked event")
+}
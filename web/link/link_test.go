@@ -0,0 +1,59 @@
+package link_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClick(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	db.MustExec(
+		`INSERT INTO links_trackedlink(org_id, code, url, contact_id, channel_id, contact_urn_id, msg_id, session_id, created_on)
+		 VALUES($1, 'Ab3dEf7h', 'https://nyaruka.com/about', $2, $3, $4, NULL, NULL, NOW())`,
+		testdata.Org1.ID, testdata.Cathy.ID, testdata.TwilioChannel.ID, testdata.Cathy.URNID,
+	)
+
+	wg := &sync.WaitGroup{}
+	server := web.NewServer(ctx, rt, wg)
+	server.Start()
+
+	// wait for the server to start
+	time.Sleep(time.Second)
+	defer server.Stop()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	resp, err := client.Get("http://localhost:8090/mr/link/Xyz12345")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = client.Get("http://localhost:8090/mr/link/Ab3dEf7h")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "https://nyaruka.com/about", resp.Header.Get("Location"))
+
+	assertdb.Query(t, db, `SELECT count(*) FROM channels_channelevent WHERE event_type = 'link_clicked' AND contact_id = $1 AND extra->>'code' = 'Ab3dEf7h'`, testdata.Cathy.ID).Returns(1)
+
+	// click has been queued for handling
+	rc := rp.Get()
+	defer rc.Close()
+
+	count, err := redis.Int(rc.Do("LLEN", fmt.Sprintf("c:%d:%d", testdata.Org1.ID, testdata.Cathy.ID)))
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
@@ -9,9 +9,28 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/middleware"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/utils/bodies"
+	"github.com/nyaruka/mailroom/utils/logs"
+	"github.com/nyaruka/mailroom/utils/trace"
 	log "github.com/sirupsen/logrus"
 )
 
+// sets the trace ID of each request, using the request ID given by the caller if there is one so that rows we create
+// can be tied back to the API call which created them. Request IDs too long to be stored are replaced.
+func traceRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID := trace.ID(r.Header.Get(middleware.RequestIDHeader))
+		if traceID == trace.NilID || len(traceID) > trace.MaxLength {
+			traceID = trace.NewID()
+		}
+
+		w.Header().Set("X-Trace-ID", string(traceID))
+
+		next.ServeHTTP(w, r.WithContext(trace.WithID(r.Context(), traceID)))
+	})
+}
+
 func requestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
@@ -28,8 +47,9 @@ func requestLogger(next http.Handler) http.Handler {
 		uri := fmt.Sprintf("%s://%s%s", scheme, r.Host, r.RequestURI)
 		ww.Header().Set("X-Elapsed-NS", strconv.FormatInt(int64(elapsed), 10))
 
-		if r.RequestURI != "/" {
-			log.WithFields(log.Fields{
+		// don't log requests to the index or probes of our health
+		if r.RequestURI != "/" && r.RequestURI != "/mr/health" && r.RequestURI != "/mr/ready" {
+			logs.From(r.Context()).WithFields(log.Fields{
 				"method":     r.Method,
 				"status":     ww.Status(),
 				"elapsed":    elapsed,
@@ -41,6 +61,23 @@ func requestLogger(next http.Handler) http.Handler {
 	})
 }
 
+// limits the size of request bodies, rejecting requests which say they're too large up front and otherwise erroring
+// when handlers try to read too much
+func limitBodies(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !bodies.Limit(w, r, maxBytes) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				w.Write(jsonx.MustMarshal(newErrorResponseForStatus(fmt.Errorf("request body exceeds %d bytes", maxBytes), http.StatusRequestEntityTooLarge)))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // recovers from panics, logs them to sentry and returns an HTTP 500 response
 func panicRecovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
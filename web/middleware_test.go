@@ -0,0 +1,71 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nyaruka/mailroom/utils/bodies"
+	"github.com/nyaruka/mailroom/utils/trace"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitBodies(t *testing.T) {
+	echo := limitBodies(20)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := &struct {
+			Text string `json:"text"`
+		}{}
+		if err := ReadAndValidateJSON(r, request); err != nil {
+			status := http.StatusBadRequest
+			if bodies.IsTooLarge(err) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(request.Text))
+	}))
+
+	// body within limit
+	w := httptest.NewRecorder()
+	echo.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"text": "hello"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hello", w.Body.String())
+
+	// content length says body is too large
+	w = httptest.NewRecorder()
+	echo.ServeHTTP(w, httptest.NewRequest("POST", "/", strings.NewReader(`{"text": "hello world, how are you?"}`)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"error": "request body exceeds 20 bytes", "code": "request.too_large"}`, w.Body.String())
+
+	// no content length but body is too large when read
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"text": "hello world, how are you?"}`))
+	r.ContentLength = -1
+	w = httptest.NewRecorder()
+	echo.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+}
+
+func TestTraceRequest(t *testing.T) {
+	var traced trace.ID
+	handler := traceRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traced = trace.FromContext(r.Context())
+	}))
+
+	// request ID given by the caller is used
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Id", "abc123")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, trace.ID("abc123"), traced)
+	assert.Equal(t, "abc123", w.Header().Get("X-Trace-ID"))
+
+	// as long as it isn't too long to store
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Id", strings.Repeat("x", 65))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Len(t, string(traced), 36)
+	assert.Equal(t, string(traced), w.Header().Get("X-Trace-ID"))
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/gomodule/redigo/redis"
 	"github.com/nyaruka/goflow/flows"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/msgio"
+	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/nyaruka/mailroom/web"
 
@@ -15,6 +17,10 @@ import (
 
 func init() {
 	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/resend", web.RequireAuthToken(handleResend))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/confirm_broadcast", web.RequireAuthToken(handleConfirmBroadcast))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/pause_broadcast", web.RequireAuthToken(handlePauseBroadcast))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/resume_broadcast", web.RequireAuthToken(handleResumeBroadcast))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/cancel_broadcast", web.RequireAuthToken(handleCancelBroadcast))
 }
 
 // Request to resend failed messages.
@@ -32,11 +38,11 @@ type resendRequest struct {
 func handleResend(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &resendRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
-	// grab our org
-	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	// grab our org, resending only needs its channels
+	oa, err := models.GetOrgAssetsScoped(ctx, rt, request.OrgID, models.RefreshChannels)
 	if err != nil {
 		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
 	}
@@ -60,3 +66,131 @@ func handleResend(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 	}
 	return map[string]interface{}{"msg_ids": resentMsgIDs}, http.StatusOK, nil
 }
+
+// Request to confirm a broadcast whose preview has been sent to its preview group, so that it's sent to its real
+// audience.
+//
+//	{
+//	  "org_id": 1,
+//	  "broadcast_id": 12345
+//	}
+type confirmBroadcastRequest struct {
+	OrgID       models.OrgID       `json:"org_id"        validate:"required"`
+	BroadcastID models.BroadcastID `json:"broadcast_id"  validate:"required"`
+}
+
+// handles a request to confirm a previewed broadcast
+func handleConfirmBroadcast(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &confirmBroadcastRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	bcast, err := models.PopBroadcastPreview(ctx, rt.DB, request.OrgID, request.BroadcastID)
+	if err == models.ErrBroadcastPreviewExpired {
+		return web.Errorf(web.ErrorCodeBroadcastPreviewExpired, "preview of broadcast with id %d has expired", request.BroadcastID), http.StatusGone, nil
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if bcast == nil {
+		return web.Errorf(web.ErrorCodeBroadcastNotFound, "no broadcast awaiting confirmation with id %d", request.BroadcastID), http.StatusNotFound, nil
+	}
+
+	if err := queue.AddTask(ctx, rc, queue.BatchQueue, queue.SendBroadcast, int(bcast.OrgID()), bcast, queue.DefaultPriority); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error queuing broadcast")
+	}
+
+	return map[string]interface{}{"broadcast_id": bcast.ID()}, http.StatusOK, nil
+}
+
+// Request to pause, resume or cancel a broadcast which is being sent.
+//
+//	{
+//	  "org_id": 1,
+//	  "broadcast_id": 12345
+//	}
+type broadcastControlRequest struct {
+	OrgID       models.OrgID       `json:"org_id"        validate:"required"`
+	BroadcastID models.BroadcastID `json:"broadcast_id"  validate:"required"`
+}
+
+// handles a request to pause a queued or sending broadcast
+func handlePauseBroadcast(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return handleBroadcastControl(ctx, rt, r, func(rc redis.Conn, request *broadcastControlRequest) error {
+		return models.PauseBroadcast(rc, request.OrgID, request.BroadcastID)
+	})
+}
+
+// handles a request to resume a paused broadcast, queuing again any batches which were held whilst it was paused
+func handleResumeBroadcast(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return handleBroadcastControl(ctx, rt, r, func(rc redis.Conn, request *broadcastControlRequest) error {
+		batches, err := models.ResumeBroadcast(rc, request.OrgID, request.BroadcastID)
+		if err != nil {
+			return err
+		}
+
+		for _, batch := range batches {
+			if err := queue.AddTask(ctx, rc, queue.BatchQueue, queue.SendBroadcastBatch, int(batch.OrgID), batch, queue.DefaultPriority); err != nil {
+				return errors.Wrap(err, "error queuing held broadcast batch")
+			}
+		}
+		return nil
+	})
+}
+
+// handles a request to cancel a broadcast so that no more of its messages are sent
+func handleCancelBroadcast(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return handleBroadcastControl(ctx, rt, r, func(rc redis.Conn, request *broadcastControlRequest) error {
+		return models.CancelBroadcast(ctx, rt.DB, rc, request.OrgID, request.BroadcastID)
+	})
+}
+
+// changes the status of a broadcast with the given function and responds with its new status, how many of its
+// messages have been sent vs how many contacts remain, and the segments and cost of what's been sent
+func handleBroadcastControl(ctx context.Context, rt *runtime.Runtime, r *http.Request, change func(redis.Conn, *broadcastControlRequest) error) (interface{}, int, error) {
+	request := &broadcastControlRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	progress, err := models.GetBroadcastProgress(rc, request.OrgID, request.BroadcastID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if progress == nil {
+		return web.Errorf(web.ErrorCodeBroadcastNotFound, "no broadcast being sent with id %d", request.BroadcastID), http.StatusNotFound, nil
+	}
+
+	if err := change(rc, request); err != nil {
+		if err == models.ErrBroadcastStatusUnchanged {
+			return web.Errorf(web.ErrorCodeBroadcastInvalidStatus, "broadcast with id %d is %s", request.BroadcastID, progress.Status), http.StatusConflict, nil
+		}
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// re-read progress as batches may have completed whilst we were changing the status
+	progress, err = models.GetBroadcastProgress(rc, request.OrgID, request.BroadcastID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	sent, err := models.CountBroadcastMsgs(ctx, rt.DB, request.BroadcastID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return map[string]interface{}{
+		"broadcast_id": request.BroadcastID,
+		"status":       progress.Status,
+		"sent":         sent,
+		"remaining":    progress.Remaining(),
+		"segments":     progress.Segments,
+		"cost":         progress.Cost,
+	}, http.StatusOK, nil
+}
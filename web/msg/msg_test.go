@@ -1,13 +1,22 @@
 package msg_test
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"testing"
+	"time"
 
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/goflow/envs"
 	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/testsuite"
 	"github.com/nyaruka/mailroom/testsuite/testdata"
 	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestServer(t *testing.T) {
@@ -28,3 +37,118 @@ func TestServer(t *testing.T) {
 		"george_msgout_id": fmt.Sprintf("%d", georgeOut.ID()),
 	})
 }
+
+func TestConfirmBroadcast(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	bcastID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "hello"}, models.NilScheduleID, nil, []*testdata.Group{testdata.DoctorsGroup})
+	bcast := models.NewBroadcast(testdata.Org1.ID, bcastID, map[envs.Language]*models.BroadcastTranslation{"eng": {Text: "hello"}}, models.TemplateStateEvaluated, "eng", nil, nil, []models.GroupID{testdata.DoctorsGroup.ID}, models.NilTicketID, models.NilUserID)
+
+	err := models.StoreBroadcastPreview(ctx, db, bcast)
+	require.NoError(t, err)
+
+	// and another broadcast whose preview was sent too long ago to be confirmed
+	expiredID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "hi"}, models.NilScheduleID, nil, []*testdata.Group{testdata.DoctorsGroup})
+	expired := models.NewBroadcast(testdata.Org1.ID, expiredID, map[envs.Language]*models.BroadcastTranslation{"eng": {Text: "hi"}}, models.TemplateStateEvaluated, "eng", nil, nil, []models.GroupID{testdata.DoctorsGroup.ID}, models.NilTicketID, models.NilUserID)
+
+	err = models.StoreBroadcastPreview(ctx, db, expired)
+	require.NoError(t, err)
+
+	db.MustExec(`UPDATE msgs_broadcastpreview SET created_on = NOW() - INTERVAL '8 days' WHERE broadcast_id = $1`, expiredID)
+
+	web.RunWebTests(t, ctx, rt, "testdata/confirm_broadcast.json", map[string]string{
+		"bcast_id":         fmt.Sprintf("%d", bcastID),
+		"expired_bcast_id": fmt.Sprintf("%d", expiredID),
+	})
+
+	// broadcast should now be queued to send to its real audience
+	size, err := queue.Size(rc, queue.BatchQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, size)
+}
+
+func TestBroadcastControl(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+	rc := rp.Get()
+	defer rc.Close()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	bcastID := testdata.InsertBroadcast(db, testdata.Org1, "eng", map[envs.Language]string{"eng": "hello"}, models.NilScheduleID, nil, []*testdata.Group{testdata.DoctorsGroup})
+
+	// simulate a broadcast to 3 contacts whose first batch of 1 contact has been sent
+	err := models.InitBroadcastProgress(rc, testdata.Org1.ID, bcastID, 3)
+	require.NoError(t, err)
+
+	_, err = models.HoldBroadcastBatch(rc, &models.BroadcastBatch{BroadcastID: bcastID, OrgID: testdata.Org1.ID, ContactIDs: []models.ContactID{testdata.Cathy.ID}})
+	require.NoError(t, err)
+
+	err = models.RecordBroadcastBatchProcessed(rc, testdata.Org1.ID, bcastID, 1, models.MsgCostTotals{Segments: 2, CostMicros: 50000})
+	require.NoError(t, err)
+
+	cathyOut := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "hello", nil, models.MsgStatusSent, false)
+	db.MustExec(`UPDATE msgs_msg SET broadcast_id = $2 WHERE id = $1`, cathyOut.ID(), bcastID)
+
+	web.RunWebTests(t, ctx, rt, "testdata/broadcast_control.json", map[string]string{
+		"bcast_id": fmt.Sprintf("%d", bcastID),
+	})
+
+	// no batches were held whilst paused so nothing should have been queued by resuming
+	size, err := queue.Size(rc, queue.BatchQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, size)
+
+	assertdb.Query(t, db, `SELECT status FROM msgs_broadcast WHERE id = $1`, bcastID).Returns("F")
+}
+
+func TestStatus(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	db.MustExec(`UPDATE channels_channel SET config = config || '{"status_secret": "sesame"}'::jsonb WHERE id = $1`, testdata.TwilioChannel.ID)
+	models.FlushCache()
+
+	cathyOut := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "how can we help", nil, models.MsgStatusWired, false)
+	bobOut := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "hello", nil, models.MsgStatusDelivered, false)
+	georgeOut := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.George, "hi", nil, models.MsgStatusWired, false)
+	db.MustExec(`UPDATE msgs_msg SET external_id = 'EX' || id WHERE id IN ($1, $2, $3)`, cathyOut.ID(), bobOut.ID(), georgeOut.ID())
+
+	// george's message has already errored twice
+	db.MustExec(`UPDATE msgs_msg SET error_count = 2 WHERE id = $1`, georgeOut.ID())
+
+	timestamp := fmt.Sprint(time.Now().Unix())
+	staleTimestamp := fmt.Sprint(time.Now().Add(-time.Minute * 10).Unix())
+
+	sign := func(timestamp, body string) string {
+		mac := hmac.New(sha256.New, []byte("sesame"))
+		mac.Write([]byte(timestamp + "." + body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	sentBody := fmt.Sprintf(`{"statuses": [{"external_id": "EX%d", "status": "S"}, {"external_id": "EX%d", "status": "S"}]}`, cathyOut.ID(), bobOut.ID())
+	erroredBody := fmt.Sprintf(`{"statuses": [{"external_id": "EX%d", "status": "E"}]}`, cathyOut.ID())
+	erroredAgainBody := fmt.Sprintf(`{"statuses": [{"external_id": "EX%d", "status": "E"}]}`, georgeOut.ID())
+	failedBody := fmt.Sprintf(`{"statuses": [{"external_id": "EX%d", "status": "F"}]}`, cathyOut.ID())
+	invalidBody := `{"statuses": [{"external_id": "EX1", "status": "X"}]}`
+
+	web.RunWebTests(t, ctx, rt, "testdata/status.json", map[string]string{
+		"cathy_msgout_id":         fmt.Sprintf("%d", cathyOut.ID()),
+		"bob_msgout_id":           fmt.Sprintf("%d", bobOut.ID()),
+		"george_msgout_id":        fmt.Sprintf("%d", georgeOut.ID()),
+		"timestamp":               timestamp,
+		"stale_timestamp":         staleTimestamp,
+		"sent_signature":          sign(timestamp, sentBody),
+		"stale_signature":         sign(staleTimestamp, sentBody),
+		"errored_signature":       sign(timestamp, erroredBody),
+		"errored_again_signature": sign(timestamp, erroredAgainBody),
+		"failed_signature":        sign(timestamp, failedBody),
+		"invalid_signature":       sign(timestamp, invalidBody),
+	})
+
+	assertdb.Query(t, db, `SELECT status FROM msgs_msg WHERE id = $1`, bobOut.ID()).Returns("D")
+}
@@ -0,0 +1,116 @@
+package msg
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/goflow/utils"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/bodies"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/msg/c/{uuid:[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}}/status", handleStatus)
+}
+
+// Request from a channel's provider with delivery receipts for outgoing messages, for deployments where the provider
+// doesn't send them via courier. Requests are signed with the channel's status secret by passing the current unix time
+// in the X-Mailroom-Timestamp header, and the hex encoded HMAC-SHA256 of that timestamp, a period and the body in the
+// X-Mailroom-Signature header. Requests with timestamps more than 5 minutes from our time are rejected so that they
+// can't be replayed later. An errored status (E) schedules the message to be retried, unless it has already errored too
+// many times in which case it's failed.
+//
+//	{
+//	  "statuses": [
+//	    {"external_id": "SM1234", "status": "D"},
+//	    {"external_id": "SM2345", "status": "F"}
+//	  ]
+//	}
+type statusRequest struct {
+	Statuses []*models.MsgStatusUpdate `json:"statuses" validate:"required,min=1,max=100,dive"`
+}
+
+// how far the timestamp of a status request can be from our time
+const signatureTolerance = time.Minute * 5
+
+// checks the timestamp and signature of a status request against the given secret
+func verifySignature(r *http.Request, body []byte, secret string) bool {
+	timestamp := r.Header.Get("X-Mailroom-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := dates.Since(time.Unix(unix, 0)); age > signatureTolerance || age < -signatureTolerance {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	expectedMAC := hex.EncodeToString(mac.Sum(nil))
+
+	return hmac.Equal([]byte(r.Header.Get("X-Mailroom-Signature")), []byte(expectedMAC))
+}
+
+// handles a request with delivery receipts for outgoing messages
+func handleStatus(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	channelUUID := assets.ChannelUUID(chi.URLParam(r, "uuid"))
+
+	orgID, err := models.OrgIDForChannelUUID(ctx, rt.DB, channelUUID)
+	if err != nil {
+		return errors.New("no such channel"), http.StatusNotFound, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, orgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	channel := oa.ChannelByUUID(channelUUID)
+	if channel == nil {
+		return errors.New("no such channel"), http.StatusNotFound, nil
+	}
+
+	body, err := bodies.Read(r)
+	if err != nil {
+		return errors.Wrapf(err, "error reading request body"), http.StatusBadRequest, nil
+	}
+
+	secret := channel.ConfigValue(models.ChannelConfigStatusSecret, "")
+	if secret == "" || !verifySignature(r, body, secret) {
+		return errors.New("request signature validation failed"), http.StatusForbidden, nil
+	}
+
+	request := &statusRequest{}
+	if err := utils.UnmarshalAndValidate(body, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	updated, err := models.UpdateMessageStatusesByExternalID(ctx, rt.DB, channel.ID(), request.Statuses)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error updating message statuses")
+	}
+
+	// let anyone watching the org's event stream know about messages which failed
+	events := make([]*models.OrgEvent, 0)
+	for _, m := range updated {
+		if m.Status == models.MsgStatusFailed {
+			events = append(events, models.NewMsgFailedOrgEvent(m, dates.Now()))
+		}
+	}
+	models.PublishOrgEvents(ctx, rt, orgID, events)
+
+	return map[string]interface{}{"updated": updated}, http.StatusOK, nil
+}
@@ -0,0 +1,63 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/jsonx"
+)
+
+// NDJSONContentType is the content type of newline delimited JSON responses
+const NDJSONContentType = "application/x-ndjson"
+
+// NDJSONWriter writes a stream of values to a response as newline delimited JSON, so that callers can process large
+// result sets incrementally and we don't have to buffer the entire response in memory
+type NDJSONWriter struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	started bool
+}
+
+// NewNDJSONWriter creates a new NDJSON writer for the given response
+func NewNDJSONWriter(w http.ResponseWriter) *NDJSONWriter {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+
+	return &NDJSONWriter{w: w, enc: enc}
+}
+
+// Started returns whether anything has been written to the response yet
+func (n *NDJSONWriter) Started() bool { return n.started }
+
+// Write writes the given value as a single line
+func (n *NDJSONWriter) Write(v interface{}) error {
+	if !n.started {
+		n.w.Header().Set("Content-Type", NDJSONContentType)
+		n.w.WriteHeader(http.StatusOK)
+		n.started = true
+	}
+
+	// encoder takes care of appending the newline
+	return n.enc.Encode(v)
+}
+
+// WriteError writes the given error as a line. Once we've started writing we can no longer change the status code so
+// this is how errors are reported to callers mid-stream.
+func (n *NDJSONWriter) WriteError(err error) error {
+	return n.Write(newErrorResponseForStatus(err, http.StatusInternalServerError))
+}
+
+// Flush flushes anything buffered so far to the client
+func (n *NDJSONWriter) Flush() {
+	if f, ok := n.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// WriteErrorResponse writes the given error as a regular JSON error response, for handlers which write their own
+// responses and fail before they've started streaming
+func WriteErrorResponse(w http.ResponseWriter, err error, status int) {
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(status)
+	w.Write(jsonx.MustMarshal(newErrorResponseForStatus(err, status)))
+}
@@ -0,0 +1,30 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNDJSONWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	out := web.NewNDJSONWriter(rec)
+
+	assert.False(t, out.Started())
+
+	out.Write(map[string]interface{}{"contact_id": 1})
+	out.Write(map[string]interface{}{"contact_id": 2, "name": "<Bob>"})
+	out.Flush()
+	out.WriteError(errors.New("boom"))
+
+	assert.True(t, out.Started())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-ndjson", rec.Header().Get("Content-Type"))
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "{\"contact_id\":1}\n{\"contact_id\":2,\"name\":\"<Bob>\"}\n{\"error\":\"boom\",\"code\":\"server.error\"}\n", rec.Body.String())
+}
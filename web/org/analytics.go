@@ -0,0 +1,71 @@
+package org
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/analytics", web.RequireAuthToken(handleAnalytics))
+}
+
+// Request for the daily analytics rollups of an org over a range of days in the org's timezone.
+//
+//	{
+//	  "org_id": 1,
+//	  "since": "2022-10-01",
+//	  "until": "2022-10-07"
+//	}
+type analyticsRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	Since string       `json:"since"  validate:"required"`
+	Until string       `json:"until"  validate:"required"`
+}
+
+// handles a request for an org's analytics, with a rollup for each day that has counts, e.g.
+//
+//	{
+//	  "days": [
+//	    {
+//	      "day": "2022-10-01",
+//	      "counts": {"msgs_in": 12, "msgs_out": 30, "flow_starts": 8, "flow_completions": 5, "ivr_seconds": 340, "tickets_opened": 2, "tickets_closed": 1},
+//	      "channels": {
+//	        "74729f45-7f29-4868-9dc4-90e491e3c7d8": {"msgs_in": 12, "msgs_out": 30}
+//	      }
+//	    }
+//	  ]
+//	}
+func handleAnalytics(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &analyticsRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	since, err := time.Parse("2006-01-02", request.Since)
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "invalid since date"), http.StatusBadRequest, nil
+	}
+	until, err := time.Parse("2006-01-02", request.Until)
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "invalid until date"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "unable to load org assets")
+	}
+
+	days, err := models.GetAnalytics(ctx, rt.DB, oa, dates.ExtractDate(since), dates.ExtractDate(until))
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error getting analytics")
+	}
+
+	return map[string]interface{}{"days": days}, http.StatusOK, nil
+}
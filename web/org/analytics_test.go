@@ -0,0 +1,33 @@
+package org_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalytics(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+	defer dates.SetNowSource(dates.DefaultNowSource)
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 10, 1, 20, 0, 0, 0, time.UTC)))
+
+	oa, err := models.GetOrgAssets(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	err = models.InsertAnalyticsCounts(ctx, db, oa, []*models.AnalyticsIncrement{
+		{Type: models.AnalyticsCountMsgsIn, ChannelID: testdata.TwilioChannel.ID, Count: 2},
+		{Type: models.AnalyticsCountTicketsOpened, Count: 1},
+	})
+	require.NoError(t, err)
+
+	web.RunWebTests(t, ctx, rt, "testdata/analytics.json", nil)
+}
@@ -0,0 +1,48 @@
+package org
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/counts", web.RequireAuthToken(handleCounts))
+}
+
+// Request for the current counts of an org's groups, labels and flows.
+//
+//	{
+//	  "org_id": 1
+//	}
+type countsRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+}
+
+// handles a request for an org's counts. Group counts are numbers of contacts, label counts are numbers of visible
+// messages and flow counts are numbers of active runs. All counts are read from the same snapshot of the rollup tables
+// and the time of that snapshot is returned, e.g.
+//
+//	{
+//	  "as_of": "2022-10-01T12:00:00.000000Z",
+//	  "groups": {"c153e265-f7c9-4539-9dbc-9b358714b638": 124},
+//	  "labels": {"ebc4dedc-91c4-4ed4-9dd6-daa05ea82698": 3},
+//	  "flows": {"9de3663f-c5c5-4c92-9f45-ecbc09abcc85": 12}
+//	}
+func handleCounts(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &countsRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	counts, err := models.GetOrgCounts(ctx, rt.ReadonlyDB, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error getting org counts")
+	}
+
+	return counts, http.StatusOK, nil
+}
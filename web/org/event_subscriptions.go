@@ -0,0 +1,200 @@
+package org
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/resthooks"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodGet, "/mr/org/event_catalog", web.RequireAuthToken(handleEventCatalog))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/event_subscribe", web.RequireAuthToken(handleEventSubscribe))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/event_unsubscribe", web.RequireAuthToken(handleEventUnsubscribe))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/event_subscriptions", web.RequireAuthToken(handleEventSubscriptions))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/event_test_fire", web.RequireAuthToken(handleEventTestFire))
+}
+
+// handles a request for the types of org events which can be subscribed to, with sample payloads so that integrations
+// like Zapier can show users the fields of each event, e.g.
+//
+//	{
+//	  "events": [
+//	    {
+//	      "type": "msg_received",
+//	      "description": "A contact sent a message",
+//	      "sample": {
+//	        "type": "msg_received",
+//	        "contact_id": 123,
+//	        "data": {"uuid": "8b7f1c5e-ba3c-4fbc-9b8e-6a1ee6b28c5f", "text": "hi there", ...},
+//	        "created_on": "2022-10-13T10:42:53.123456Z"
+//	      }
+//	    },
+//	    ...
+//	  ]
+//	}
+func handleEventCatalog(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	return map[string]interface{}{"events": models.OrgEventCatalog()}, http.StatusOK, nil
+}
+
+// Request to subscribe a URL to a type of org event. Events are POSTed to the URL as they happen, in the same format as
+// the samples in the event catalog.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "event": "msg_received",
+//	  "url": "https://hooks.zapier.com/hooks/standard/1234"
+//	}
+type eventSubscribeRequest struct {
+	OrgID  models.OrgID        `json:"org_id"  validate:"required"`
+	UserID models.UserID       `json:"user_id" validate:"required"`
+	Event  models.OrgEventType `json:"event"   validate:"required"`
+	URL    string              `json:"url"     validate:"required,url,max=200"`
+}
+
+// handles a request to subscribe to an org event
+func handleEventSubscribe(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &eventSubscribeRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+	if models.GetOrgEventInfo(request.Event) == nil {
+		return web.Errorf(web.ErrorCodeOrgEventUnknownType, "unknown event type: %s", request.Event), http.StatusBadRequest, nil
+	}
+
+	sub, err := models.SubscribeOrgEvent(ctx, rt.DB, request.OrgID, request.UserID, request.Event, request.URL)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return sub, http.StatusOK, nil
+}
+
+// Request to unsubscribe a URL from a type of org event.
+//
+//	{
+//	  "org_id": 1,
+//	  "event": "msg_received",
+//	  "url": "https://hooks.zapier.com/hooks/standard/1234"
+//	}
+type eventUnsubscribeRequest struct {
+	OrgID models.OrgID        `json:"org_id" validate:"required"`
+	Event models.OrgEventType `json:"event"  validate:"required"`
+	URL   string              `json:"url"    validate:"required"`
+}
+
+// handles a request to unsubscribe from an org event
+func handleEventUnsubscribe(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &eventUnsubscribeRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+	if models.GetOrgEventInfo(request.Event) == nil {
+		return web.Errorf(web.ErrorCodeOrgEventUnknownType, "unknown event type: %s", request.Event), http.StatusBadRequest, nil
+	}
+
+	if err := models.UnsubscribeOrgEvent(ctx, rt.DB, request.OrgID, request.Event, request.URL); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return map[string]interface{}{}, http.StatusOK, nil
+}
+
+// Request for the URLs subscribed to an org's events.
+//
+//	{
+//	  "org_id": 1
+//	}
+//
+//	{
+//	  "subscriptions": [
+//	    {
+//	      "event": "msg_received",
+//	      "id": 12,
+//	      "resthook": "org-event-msg-received",
+//	      "url": "https://hooks.zapier.com/hooks/standard/1234",
+//	      "created_on": "2022-10-13T10:42:53.123456Z"
+//	    }
+//	  ]
+//	}
+type eventSubscriptionsRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+}
+
+// handles a request for an org's event subscriptions
+func handleEventSubscriptions(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &eventSubscriptionsRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	subs, err := models.LoadOrgEventSubscriptions(ctx, rt.DB, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return map[string]interface{}{"subscriptions": subs}, http.StatusOK, nil
+}
+
+// Request to send the sample payload of a type of org event to a URL, which needn't be subscribed yet, so that users
+// can check an integration works.
+//
+//	{
+//	  "org_id": 1,
+//	  "event": "msg_received",
+//	  "url": "https://hooks.zapier.com/hooks/standard/1234"
+//	}
+//
+//	{
+//	  "status_code": 200,
+//	  "is_error": false,
+//	  "elapsed_ms": 123,
+//	  "response": "{\"status\": \"success\"}"
+//	}
+type eventTestFireRequest struct {
+	OrgID models.OrgID        `json:"org_id" validate:"required"`
+	Event models.OrgEventType `json:"event"  validate:"required"`
+	URL   string              `json:"url"    validate:"required,url"`
+}
+
+// handles a request to test fire an org event
+func handleEventTestFire(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &eventTestFireRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	info := models.GetOrgEventInfo(request.Event)
+	if info == nil {
+		return web.Errorf(web.ErrorCodeOrgEventUnknownType, "unknown event type: %s", request.Event), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "unable to load org assets")
+	}
+
+	trace, err := resthooks.DeliverTestEvent(rt, oa, request.URL, jsonx.MustMarshal(info.Sample))
+	if trace == nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "unable to make request"), http.StatusBadRequest, nil
+	}
+
+	statusCode, response := 0, ""
+	if trace.Response != nil {
+		statusCode = trace.Response.StatusCode
+		response = trace.SanitizedResponse("...")
+	}
+
+	return map[string]interface{}{
+		"status_code": statusCode,
+		"is_error":    statusCode/100 != 2,
+		"elapsed_ms":  int(trace.EndTime.Sub(trace.StartTime).Milliseconds()),
+		"response":    response,
+	}, http.StatusOK, nil
+}
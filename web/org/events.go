@@ -0,0 +1,166 @@
+package org
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	// how often we ping connected consoles so that dead connections are noticed and idle ones aren't closed by proxies
+	eventsPingInterval = time.Second * 30
+
+	// how long we wait for a console to accept a write before giving up on it
+	eventsWriteTimeout = time.Second * 10
+)
+
+func init() {
+	web.RegisterRoute(http.MethodGet, "/mr/org/events", web.RequireAuthTokenHandler(handleEvents))
+}
+
+// codec which writes an empty ping frame, which browsers respond to automatically
+var pingCodec = websocket.Codec{Marshal: func(interface{}) ([]byte, byte, error) { return nil, websocket.PingFrame, nil }}
+
+// Streams an org's incoming messages, ticket events and contact changes over a WebSocket so that agent consoles don't
+// have to poll for them. The org is given by the org_id query parameter, e.g. /mr/org/events?org_id=1, and each event
+// is sent as a text message like:
+//
+//	{
+//	  "type": "msg_received",
+//	  "contact_id": 1234,
+//	  "data": {"uuid": "8b7f1c5e-ba3c-4fbc-9b8e-6a1ee6b28c5f", "text": "hi there", ...},
+//	  "created_on": "2022-10-13T10:42:53.123456Z"
+//	}
+//
+// Only events which happen while the console is connected are sent so consoles should reload their state on reconnect.
+// The number of consoles which can be connected at once is capped, and beyond that a 503 is returned.
+func handleEvents(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+	orgID, _ := strconv.Atoi(r.URL.Query().Get("org_id"))
+	if orgID <= 0 {
+		w.Header().Set("Content-type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(jsonx.MustMarshal(web.NewErrorResponse(web.Errorf(web.ErrorCodeInvalid, "missing or invalid org_id"))))
+		return nil
+	}
+
+	// subscriptions come from their own capped pool so consoles can't use up the connections everything else needs
+	conn := rt.PubSubRP.Get()
+	if err := conn.Err(); err != nil {
+		conn.Close()
+		if err == redis.ErrPoolExhausted {
+			w.Header().Set("Content-type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write(jsonx.MustMarshal(web.NewErrorResponse(web.Errorf(web.ErrorCodeOrgEventStreamsExhausted, "too many event streams open, try again later"))))
+			return nil
+		}
+		return errors.Wrap(err, "error getting redis connection for org events")
+	}
+
+	streamed := false
+	server := websocket.Server{
+		// consoles are served from other origins and requests are already authenticated by token
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			streamed = true
+			streamOrgEvents(models.OrgID(orgID), conn, ws)
+		},
+	}
+	server.ServeHTTP(w, r)
+
+	// if the upgrade failed, the handler never ran to close the connection
+	if !streamed {
+		conn.Close()
+	}
+	return nil
+}
+
+// relays everything published to the org's events channel to the given connection until either side goes away
+func streamOrgEvents(orgID models.OrgID, conn redis.Conn, ws *websocket.Conn) {
+	log := logrus.WithField("org_id", orgID)
+
+	// the HTTP server's timeouts don't make sense for a long lived connection, we set our own for each write
+	ws.SetDeadline(time.Time{})
+
+	psc := redis.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if err := psc.Subscribe(models.OrgEventsChannel(orgID)); err != nil {
+		log.WithError(err).Error("error subscribing to org events")
+		return
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	defer ws.Close()
+
+	done := make(chan struct{})
+	wg.Add(2)
+
+	// consoles don't send us anything but reading lets us notice when they disconnect
+	go func() {
+		defer wg.Done()
+		defer close(done)
+
+		var discard []byte
+		for {
+			if err := websocket.Message.Receive(ws, &discard); err != nil {
+				return
+			}
+		}
+	}()
+
+	// only this goroutine writes to the subscription connection, so that's where we unsubscribe when the console
+	// disconnects, and where we ping redis so that we can ping the console in turn when it replies
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(eventsPingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				psc.Unsubscribe()
+				return
+			case <-ticker.C:
+				psc.Ping("")
+			}
+		}
+	}()
+
+	for {
+		var err error
+
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			ws.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+			err = websocket.Message.Send(ws, string(v.Data))
+		case redis.Pong:
+			ws.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+			err = pingCodec.Send(ws, nil)
+		case redis.Subscription:
+			if v.Count == 0 {
+				return
+			}
+		case error:
+			log.WithError(v).Error("error receiving org events")
+			return
+		}
+
+		if err != nil {
+			log.WithError(err).Debug("error writing org event, closing connection")
+			return
+		}
+	}
+}
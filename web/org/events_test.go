@@ -0,0 +1,83 @@
+package org_test
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/nyaruka/gocommon/jsonx"
+	"github.com/nyaruka/goflow/flows"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestEvents(t *testing.T) {
+	ctx, rt, _, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	// only allow one console to be connected at a time
+	rt.PubSubRP = &redis.Pool{Dial: rp.Dial, MaxActive: 1}
+
+	wg := &sync.WaitGroup{}
+	server := web.NewServer(ctx, rt, wg)
+	server.Start()
+
+	// wait for the server to start
+	time.Sleep(time.Second)
+	defer server.Stop()
+
+	// no org id is a bad request
+	resp, err := http.Get("http://localhost:8090/mr/org/events")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	ws, err := websocket.Dial(fmt.Sprintf("ws://localhost:8090/mr/org/events?org_id=%d", testdata.Org1.ID), "", "http://localhost:8090")
+	require.NoError(t, err)
+	defer ws.Close()
+
+	// give the server a moment to subscribe
+	time.Sleep(100 * time.Millisecond)
+
+	msg := flows.NewMsgIn(flows.MsgUUID("0c9cd2e4-865e-40bf-92bb-3c958d5f6f0d"), "tel:+16055741111", nil, "hi there", nil)
+
+	models.PublishOrgEvents(ctx, rt, testdata.Org2.ID, []*models.OrgEvent{models.NewContactChangedOrgEvent(testdata.Org2Contact.ID)})
+	models.PublishOrgEvents(ctx, rt, testdata.Org1.ID, []*models.OrgEvent{
+		models.NewMsgReceivedOrgEvent(testdata.Cathy.ID, msg, time.Date(2022, 10, 13, 10, 42, 53, 0, time.UTC)),
+		models.NewContactChangedOrgEvent(testdata.Bob.ID),
+	})
+
+	ws.SetReadDeadline(time.Now().Add(time.Second * 5))
+
+	// should only get the events for our org
+	var data string
+	require.NoError(t, websocket.Message.Receive(ws, &data))
+
+	event := map[string]interface{}{}
+	jsonx.MustUnmarshal([]byte(data), &event)
+	assert.Equal(t, "msg_received", event["type"])
+	assert.Equal(t, float64(testdata.Cathy.ID), event["contact_id"])
+	assert.Equal(t, "hi there", event["data"].(map[string]interface{})["text"])
+	assert.Equal(t, "2022-10-13T10:42:53Z", event["created_on"])
+
+	require.NoError(t, websocket.Message.Receive(ws, &data))
+
+	event = map[string]interface{}{}
+	jsonx.MustUnmarshal([]byte(data), &event)
+	assert.Equal(t, "contact_changed", event["type"])
+	assert.Equal(t, float64(testdata.Bob.ID), event["contact_id"])
+	assert.Nil(t, event["data"])
+
+	// another console can't connect whilst this one is
+	resp, err = http.Get(fmt.Sprintf("http://localhost:8090/mr/org/events?org_id=%d", testdata.Org1.ID))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
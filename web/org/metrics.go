@@ -8,6 +8,7 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/nyaruka/gocommon/uuids"
 	"github.com/nyaruka/goflow/assets"
+	"github.com/nyaruka/mailroom/core/ivr"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
 	"github.com/nyaruka/mailroom/web"
@@ -238,7 +239,7 @@ func handleMetrics(ctx context.Context, rt *runtime.Runtime, r *http.Request, ra
 	username, token, ok := r.BasicAuth()
 	if !ok || username != "metrics" {
 		rawW.WriteHeader(http.StatusUnauthorized)
-		rawW.Write([]byte(`{"error": "invalid authentication"}`))
+		rawW.Write([]byte(`{"error": "invalid authentication", "code": "auth.invalid"}`))
 		return nil
 	}
 
@@ -250,7 +251,7 @@ func handleMetrics(ctx context.Context, rt *runtime.Runtime, r *http.Request, ra
 
 	if org == nil {
 		rawW.WriteHeader(http.StatusUnauthorized)
-		rawW.Write([]byte(`{"error": "invalid authentication"}`))
+		rawW.Write([]byte(`{"error": "invalid authentication", "code": "auth.invalid"}`))
 		return nil
 	}
 
@@ -278,5 +279,14 @@ func handleMetrics(ctx context.Context, rt *runtime.Runtime, r *http.Request, ra
 		}
 	}
 
+	for _, family := range ivr.MetricFamilies(org) {
+		if len(family.Metric) > 0 {
+			_, err = expfmt.MetricFamilyToText(rawW, family)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return err
 }
@@ -47,35 +47,35 @@ func TestMetrics(t *testing.T) {
 			URL:      fmt.Sprintf("http://localhost:8090/mr/org/%s/metrics", testdata.Org1.UUID),
 			Username: "",
 			Password: "",
-			Response: `{"error": "invalid authentication"}`,
+			Response: `{"error": "invalid authentication", "code": "auth.invalid"}`,
 		},
 		{
 			Label:    "invalid password",
 			URL:      fmt.Sprintf("http://localhost:8090/mr/org/%s/metrics", testdata.Org1.UUID),
 			Username: "metrics",
 			Password: "invalid",
-			Response: `{"error": "invalid authentication"}`,
+			Response: `{"error": "invalid authentication", "code": "auth.invalid"}`,
 		},
 		{
 			Label:    "invalid username",
 			URL:      fmt.Sprintf("http://localhost:8090/mr/org/%s/metrics", testdata.Org1.UUID),
 			Username: "invalid",
 			Password: promToken,
-			Response: `{"error": "invalid authentication"}`,
+			Response: `{"error": "invalid authentication", "code": "auth.invalid"}`,
 		},
 		{
 			Label:    "valid login, wrong org",
 			URL:      fmt.Sprintf("http://localhost:8090/mr/org/%s/metrics", testdata.Org2.UUID),
 			Username: "metrics",
 			Password: promToken,
-			Response: `{"error": "invalid authentication"}`,
+			Response: `{"error": "invalid authentication", "code": "auth.invalid"}`,
 		},
 		{
 			Label:    "valid login, invalid user",
 			URL:      fmt.Sprintf("http://localhost:8090/mr/org/%s/metrics", testdata.Org1.UUID),
 			Username: "metrics",
 			Password: adminToken,
-			Response: `{"error": "invalid authentication"}`,
+			Response: `{"error": "invalid authentication", "code": "auth.invalid"}`,
 		},
 		{
 			Label:    "valid",
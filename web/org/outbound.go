@@ -0,0 +1,96 @@
+package org
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/tasks/msgs"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/pause_outbound", web.RequireAuthToken(handlePauseOutbound))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/resume_outbound", web.RequireAuthToken(handleResumeOutbound))
+}
+
+// Request to pause or resume all outbound messages and calls for an org.
+//
+//	{
+//	  "org_id": 1
+//	}
+type outboundRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+}
+
+// Response for a pause request.
+//
+//	{
+//	  "paused_on": "2022-10-01T12:00:00.000000Z"
+//	}
+type pauseOutboundResponse struct {
+	PausedOn time.Time `json:"paused_on"`
+}
+
+// handles a request to pause outbound for an org. Inbound messages continue to be handled but any outgoing messages are
+// held as pending and any calls are held as throttled until outbound is resumed.
+func handlePauseOutbound(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &outboundRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	// check org exists
+	if _, err := models.GetOrgAssetsScoped(ctx, rt, request.OrgID, models.RefreshNone); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	pausedOn, err := models.PauseOrgOutbound(rc, request.OrgID, dates.Now())
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return &pauseOutboundResponse{PausedOn: pausedOn}, http.StatusOK, nil
+}
+
+// Response for a resume request.
+//
+//	{
+//	  "resumed": true
+//	}
+type resumeOutboundResponse struct {
+	Resumed bool `json:"resumed"`
+}
+
+// handles a request to resume outbound for an org, queuing a task to send any messages which were held whilst it was
+// paused
+func handleResumeOutbound(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &outboundRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	pausedOn, err := models.ResumeOrgOutbound(rc, request.OrgID)
+	rc.Close()
+
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if pausedOn == nil {
+		return &resumeOutboundResponse{Resumed: false}, http.StatusOK, nil
+	}
+
+	if err := msgs.QueueReleasePausedMsgs(ctx, rt, request.OrgID); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error queuing release of held messages")
+	}
+
+	return &resumeOutboundResponse{Resumed: true}, http.StatusOK, nil
+}
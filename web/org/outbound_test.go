@@ -0,0 +1,44 @@
+package org_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dbutil/assertdb"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/msgs"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutbound(t *testing.T) {
+	ctx, rt, db, rp := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	// messages held whilst org was paused, and one for another org which shouldn't be sent
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "held 1", nil, models.MsgStatusPending, false)
+	testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "held 2", nil, models.MsgStatusPending, false)
+	testdata.InsertOutgoingMsg(db, testdata.Org2, testdata.Org2Channel, testdata.Org2Contact, "other org", nil, models.MsgStatusPending, false)
+
+	// and a message held until quiet hours end which shouldn't be sent on resume
+	quiet := testdata.InsertOutgoingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.George, "quiet", nil, models.MsgStatusPending, false)
+	db.MustExec(`UPDATE msgs_msg SET next_attempt = $2 WHERE id = $1`, quiet.ID(), time.Now().Add(time.Hour))
+
+	web.RunWebTests(t, ctx, rt, "testdata/outbound.json", nil)
+
+	// resuming queued a task to send the held messages
+	tasks := testsuite.CurrentOrgTasks(t, rp)[testdata.Org1.ID]
+	require.Len(t, tasks, 1)
+	assert.Equal(t, queue.ReleasePausedMsgs, tasks[0].Type)
+
+	err := msgs.ReleasePausedMessages(ctx, rt, testdata.Org1.ID)
+	require.NoError(t, err)
+
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE direction = 'O' AND status = 'Q'`).Returns(2)
+	assertdb.Query(t, db, `SELECT count(*) FROM msgs_msg WHERE id = $1 AND status = 'P'`, quiet.ID()).Returns(1)
+}
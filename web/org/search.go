@@ -0,0 +1,95 @@
+package org
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/nyaruka/goflow/contactql"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/search"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/search", web.RequireAuthToken(handleSearch))
+}
+
+// Request to search an org's contacts, messages and tickets at once.
+//
+//	{
+//	  "org_id": 1,
+//	  "query": "jasmine",
+//	  "limit": 10
+//	}
+type searchRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+	Query string       `json:"query"  validate:"required"`
+	Limit int          `json:"limit"  validate:"omitempty,min=1,max=100"`
+}
+
+type searchResults struct {
+	IDs   interface{} `json:"ids"`
+	Total int64       `json:"total"`
+}
+
+// handles an org wide search. The query is used as a contact query and as a full text search of message text and
+// ticket bodies, which also matches ticket topic names. Each returns the ids of its first matches and the total number
+// of matches, which for messages and tickets is counted up to 1000, e.g.
+//
+//	{
+//	  "contacts": {"ids": [10000, 10003], "total": 2},
+//	  "messages": {"ids": [3456, 3421], "total": 2},
+//	  "tickets": {"ids": [], "total": 0}
+//	}
+func handleSearch(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &searchRequest{Limit: 10}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	oa, err := models.GetOrgAssetsWithRefresh(ctx, rt, request.OrgID, models.RefreshFields|models.RefreshGroups)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "unable to load org assets")
+	}
+
+	var contacts, msgs, tickets searchResults
+	var contactsErr, msgsErr, ticketsErr error
+
+	// the searches are independent so do them in parallel
+	wg := &sync.WaitGroup{}
+	wg.Add(3)
+
+	go func() {
+		defer wg.Done()
+		_, contacts.IDs, contacts.Total, contactsErr = search.GetContactIDsForQueryPage(ctx, rt.ES, oa, nil, nil, request.Query, "-id", 0, request.Limit)
+	}()
+	go func() {
+		defer wg.Done()
+		msgs.IDs, msgs.Total, msgsErr = models.SearchMsgs(ctx, rt.ReadonlyDB, oa.OrgID(), request.Query, request.Limit)
+	}()
+	go func() {
+		defer wg.Done()
+		tickets.IDs, tickets.Total, ticketsErr = models.SearchTickets(ctx, rt.ReadonlyDB, oa.OrgID(), request.Query, request.Limit)
+	}()
+
+	wg.Wait()
+
+	if contactsErr != nil {
+		// queries which aren't valid contact queries can still match messages and tickets
+		if isQueryError, _ := contactql.IsQueryError(contactsErr); !isQueryError {
+			return nil, http.StatusInternalServerError, errors.Wrap(contactsErr, "error searching contacts")
+		}
+		contacts = searchResults{IDs: []models.ContactID{}}
+	}
+	if msgsErr != nil {
+		return nil, http.StatusInternalServerError, msgsErr
+	}
+	if ticketsErr != nil {
+		return nil, http.StatusInternalServerError, ticketsErr
+	}
+
+	return map[string]interface{}{"contacts": contacts, "messages": msgs, "tickets": tickets}, http.StatusOK, nil
+}
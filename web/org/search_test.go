@@ -0,0 +1,40 @@
+package org_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestSearch(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	mockES := testsuite.NewMockElasticServer()
+	defer mockES.Close()
+
+	rt.ES = mockES.Client()
+	mockES.AddResponse(testdata.Cathy.ID)
+	mockES.AddResponse()
+
+	msg1 := testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Cathy, "Where is my package?", models.MsgStatusHandled)
+	msg2 := testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "My package arrived", models.MsgStatusHandled)
+	testdata.InsertIncomingMsg(db, testdata.Org1, testdata.TwilioChannel, testdata.Bob, "Thanks", models.MsgStatusHandled)
+	testdata.InsertIncomingMsg(db, testdata.Org2, testdata.Org2Channel, testdata.Org2Contact, "Another package", models.MsgStatusHandled)
+
+	ticket1 := testdata.InsertOpenTicket(db, testdata.Org1, testdata.Cathy, testdata.Internal, testdata.DefaultTopic, "Package was lost", "", time.Now(), nil)
+	ticket2 := testdata.InsertClosedTicket(db, testdata.Org1, testdata.Bob, testdata.Internal, testdata.SalesTopic, "Wants a discount", "", nil)
+
+	web.RunWebTests(t, ctx, rt, "testdata/search.json", map[string]string{
+		"msg1_id":    fmt.Sprint(msg1.ID()),
+		"msg2_id":    fmt.Sprint(msg2.ID()),
+		"ticket1_id": fmt.Sprint(ticket1.ID),
+		"ticket2_id": fmt.Sprint(ticket2.ID),
+	})
+}
@@ -0,0 +1,59 @@
+package org
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/org/task_incidents", web.RequireAuthToken(handleTaskIncidents))
+}
+
+// Request for the recent incidents of tasks for an org which panicked.
+//
+//	{
+//	  "org_id": 1
+//	}
+type taskIncidentsRequest struct {
+	OrgID models.OrgID `json:"org_id" validate:"required"`
+}
+
+// handles a request for an org's task incidents, most recent first, e.g.
+//
+//	{
+//	  "incidents": [
+//	    {
+//	      "uuid": "d2f852ec-7b4e-457f-ae7f-f8b243c49ff5",
+//	      "org_id": 1,
+//	      "queue": "handler",
+//	      "task_type": "handle_contact_event",
+//	      "task": {"contact_id": 10000},
+//	      "panic": "runtime error: invalid memory address or nil pointer dereference",
+//	      "stack": "goroutine 21 [running]:\n...",
+//	      "trace_id": "5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2",
+//	      "started_on": "2022-10-01T12:00:00.000000Z",
+//	      "elapsed_ms": 12
+//	    }
+//	  ]
+//	}
+func handleTaskIncidents(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &taskIncidentsRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	incidents, err := models.GetTaskIncidents(rc, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error getting task incidents")
+	}
+
+	return map[string]interface{}{"incidents": incidents}, http.StatusOK, nil
+}
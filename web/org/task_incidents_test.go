@@ -0,0 +1,37 @@
+package org_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/testsuite/testdata"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskIncidents(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis)
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	err := models.RecordTaskIncident(rc, &models.TaskIncident{
+		UUID:      "d2f852ec-7b4e-457f-ae7f-f8b243c49ff5",
+		OrgID:     testdata.Org1.ID,
+		Queue:     "handler",
+		TaskType:  "handle_contact_event",
+		Task:      []byte(`{"contact_id":10000}`),
+		Panic:     "boom",
+		Stack:     "goroutine 1 [running]:",
+		TraceID:   "5b2f3bd2-63ce-4a51-8cb8-1f1b4d5a6bb2",
+		StartedOn: time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC),
+		ElapsedMS: 12,
+	})
+	require.NoError(t, err)
+
+	web.RunWebTests(t, ctx, rt, "testdata/task_incidents.json", nil)
+}
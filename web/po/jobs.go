@@ -0,0 +1,177 @@
+package flow
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/nyaruka/gocommon/uuids"
+	"github.com/nyaruka/goflow/envs"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/core/queue"
+	"github.com/nyaruka/mailroom/core/tasks/flows"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/po/export/start", web.RequireAuthToken(handleExportStart))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/po/import/start", web.RequireAuthToken(handleImportStart))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/po/job", web.RequireAuthToken(handleJob))
+}
+
+// Starts a background export of the translations of the given set of flows, which produces a zip archive of PO files,
+// one per flow. Returns the new job whose status can be fetched from /mr/po/job.
+//
+//	{
+//	  "org_id": 123,
+//	  "flow_ids": [123, 354, 456],
+//	  "language": "spa"
+//	}
+type exportStartRequest struct {
+	OrgID    models.OrgID    `json:"org_id"   validate:"required"`
+	FlowIDs  []models.FlowID `json:"flow_ids" validate:"required"`
+	Language envs.Language   `json:"language" validate:"omitempty,language"`
+}
+
+func handleExportStart(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &exportStartRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	job := models.NewTranslationJob(models.TranslationJobTypeExport, request.Language, len(request.FlowIDs))
+	task := &flows.ExportTranslationsTask{JobUUID: job.UUID, FlowIDs: request.FlowIDs, Language: request.Language}
+
+	if err := queueTranslationJob(ctx, rt, request.OrgID, job, flows.TypeExportTranslations, task); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return job, http.StatusOK, nil
+}
+
+// Starts a background import of translations into the given set of flows from an uploaded PO file, or a zip archive
+// of PO files named by flow UUID like that produced by an export. Each updated flow is saved as a new revision. Returns
+// the new job whose status can be fetched from /mr/po/job.
+//
+//	{
+//	  "org_id": 123,
+//	  "user_id": 234,
+//	  "flow_ids": [123, 354, 456],
+//	  "language": "spa"
+//	}
+type importStartForm struct {
+	OrgID    models.OrgID    `form:"org_id"   validate:"required"`
+	UserID   models.UserID   `form:"user_id"  validate:"required"`
+	FlowIDs  []models.FlowID `form:"flow_ids" validate:"required"`
+	Language envs.Language   `form:"language" validate:"required"`
+}
+
+func handleImportStart(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	form := &importStartForm{}
+	if err := web.DecodeAndValidateForm(form, r); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	poFile, header, err := r.FormFile("po")
+	if err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "missing po file on request"), http.StatusBadRequest, nil
+	}
+	defer poFile.Close()
+
+	data, err := io.ReadAll(poFile)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error reading po file")
+	}
+
+	// check the upload is readable before queuing anything
+	if _, _, err := flows.ReadUploadedPOs(header.Filename, data); err != nil {
+		return web.NewError(web.ErrorCodePOInvalid, err), http.StatusBadRequest, nil
+	}
+
+	job := models.NewTranslationJob(models.TranslationJobTypeImport, form.Language, len(form.FlowIDs))
+
+	filename := "upload.po"
+	if strings.EqualFold(filepath.Ext(header.Filename), ".zip") {
+		filename = "upload.zip"
+	}
+	uploadPath := models.TranslationJobPath(rt, form.OrgID, job.UUID, filename)
+
+	if _, err := rt.AttachmentStorage.Put(ctx, uploadPath, "application/octet-stream", data); err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrap(err, "error saving po file")
+	}
+
+	task := &flows.ImportTranslationsTask{JobUUID: job.UUID, UserID: form.UserID, FlowIDs: form.FlowIDs, Language: form.Language, Upload: uploadPath}
+
+	if err := queueTranslationJob(ctx, rt, form.OrgID, job, flows.TypeImportTranslations, task); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return job, http.StatusOK, nil
+}
+
+// Request for the status of a translation job.
+//
+//	{
+//	  "org_id": 123,
+//	  "job_uuid": "a0c8f0a6-1fd2-4e9c-b4b4-79ab5e9b0e4f"
+//	}
+type jobRequest struct {
+	OrgID   models.OrgID `json:"org_id"   validate:"required"`
+	JobUUID uuids.UUID   `json:"job_uuid" validate:"required"`
+}
+
+// handles a request for the status of a translation job, e.g.
+//
+//	{
+//	  "uuid": "a0c8f0a6-1fd2-4e9c-b4b4-79ab5e9b0e4f",
+//	  "type": "export",
+//	  "status": "complete",
+//	  "language": "spa",
+//	  "total": 2,
+//	  "succeeded": 1,
+//	  "failed": 1,
+//	  "results": [
+//	    {"flow_id": 12, "name": "Registration"},
+//	    {"flow_id": 14, "name": "Survey", "error": "unable to read flow: ..."}
+//	  ],
+//	  "url": "https://s3.amazonaws.com/mailroom-attachments/attachments/1/translations/a0c8f0a6-1fd2-4e9c-b4b4-79ab5e9b0e4f/translations.zip",
+//	  "created_on": "2022-10-01T12:00:00.000000Z",
+//	  "completed_on": "2022-10-01T12:00:03.000000Z"
+//	}
+func handleJob(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &jobRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	job, err := models.GetTranslationJob(rc, request.OrgID, request.JobUUID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if job == nil {
+		return web.Errorf(web.ErrorCodePOJobNotFound, "no such translation job: %s", request.JobUUID), http.StatusNotFound, nil
+	}
+
+	return job, http.StatusOK, nil
+}
+
+// saves the given pending job and queues the task which will perform it
+func queueTranslationJob(ctx context.Context, rt *runtime.Runtime, orgID models.OrgID, job *models.TranslationJob, taskType string, task interface{}) error {
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.SetTranslationJob(rc, orgID, job); err != nil {
+		return err
+	}
+
+	err := queue.AddTask(ctx, rc, queue.BatchQueue, taskType, int(orgID), task, queue.DefaultPriority)
+	return errors.Wrapf(err, "error queuing %s task", taskType)
+}
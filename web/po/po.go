@@ -37,7 +37,7 @@ type exportRequest struct {
 func handleExport(ctx context.Context, rt *runtime.Runtime, r *http.Request, rawW http.ResponseWriter) error {
 	request := &exportRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation")
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation")
 	}
 
 	flows, err := loadFlows(ctx, rt, request.OrgID, request.FlowIDs)
@@ -79,12 +79,12 @@ func handleImport(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 
 	poFile, _, err := r.FormFile("po")
 	if err != nil {
-		return errors.Wrapf(err, "missing po file on request"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "missing po file on request"), http.StatusBadRequest, nil
 	}
 
 	po, err := i18n.ReadPO(poFile)
 	if err != nil {
-		return errors.Wrapf(err, "invalid po file"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodePOInvalid, "invalid po file"), http.StatusBadRequest, nil
 	}
 
 	flows, err := loadFlows(ctx, rt, form.OrgID, form.FlowIDs)
@@ -94,7 +94,7 @@ func handleImport(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 
 	err = translation.ImportIntoFlows(po, form.Language, flows...)
 	if err != nil {
-		return err, http.StatusBadRequest, nil
+		return web.NewError(web.ErrorCodePOInvalid, err), http.StatusBadRequest, nil
 	}
 
 	return map[string]interface{}{"flows": flows}, http.StatusOK, nil
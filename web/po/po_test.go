@@ -13,3 +13,11 @@ func TestServer(t *testing.T) {
 	web.RunWebTests(t, ctx, rt, "testdata/export.json", nil)
 	web.RunWebTests(t, ctx, rt, "testdata/import.json", nil)
 }
+
+func TestJobs(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetRedis | testsuite.ResetStorage)
+
+	web.RunWebTests(t, ctx, rt, "testdata/jobs.json", nil)
+}
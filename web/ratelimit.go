@@ -0,0 +1,205 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/gocommon/jsonx"
+)
+
+// how often we discard the buckets of clients which haven't made requests recently
+const rateLimitPruneInterval = time.Minute
+
+// a token bucket for a single client and class of endpoint
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// the most of a request body we'll read to find its org, as the rest is left for the handler to read
+const rateLimitMaxBodyPeek = 64 * 1024
+
+// RateLimiter limits the rate at which each client can make requests to each class of endpoint, and the class of an
+// endpoint is the first part of its path after /mr/, e.g. contact for /mr/contact/search. A request authenticated with
+// our auth token is limited by the org given by its org_id query parameter or body field, or if it doesn't have one, as
+// a single client for the token. Any other request is limited by its IP address, as nothing else it says about itself
+// can be trusted. Each client gets a token bucket per class which refills at the class's rate, and requests which find
+// their bucket empty get a 429 response. Requests authenticated with an exempt token, e.g. from internal callers, aren't
+// limited.
+type RateLimiter struct {
+	rate      float64
+	burst     int
+	classes   map[string]float64
+	authToken string
+	exempt    map[string]bool
+
+	mutex     sync.Mutex
+	buckets   map[string]*rateBucket
+	lastPrune time.Time
+}
+
+// NewRateLimiter creates a new rate limiter with the given default rate in requests per second, burst size, rates
+// for particular classes of endpoint, our auth token and the auth tokens of clients which aren't limited. A rate of
+// zero means no limit.
+func NewRateLimiter(rate float64, burst int, classes map[string]float64, authToken string, exemptTokens []string) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	exemptSet := make(map[string]bool, len(exemptTokens))
+	for _, token := range exemptTokens {
+		exemptSet[token] = true
+	}
+
+	return &RateLimiter{
+		rate:      rate,
+		burst:     burst,
+		classes:   classes,
+		authToken: authToken,
+		exempt:    exemptSet,
+		buckets:   make(map[string]*rateBucket),
+		lastPrune: dates.Now(),
+	}
+}
+
+// Allow takes a token from the bucket of the given client and class, returning whether the request is allowed, and
+// if not, how long the client should wait before retrying
+func (l *RateLimiter) Allow(client, class string) (bool, time.Duration) {
+	rate := l.rateFor(class)
+	if rate == 0 {
+		return true, 0
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := dates.Now()
+	if now.Sub(l.lastPrune) >= rateLimitPruneInterval {
+		l.prune(now)
+	}
+
+	key := class + ":" + client
+	bucket := l.buckets[key]
+	if bucket == nil {
+		bucket = &rateBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = bucket
+	} else {
+		bucket.tokens = math.Min(float64(l.burst), bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+		bucket.last = now
+	}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+func (l *RateLimiter) rateFor(class string) float64 {
+	if rate, found := l.classes[class]; found {
+		return rate
+	}
+	return l.rate
+}
+
+// discards buckets which would have refilled by now, as those clients are no different to ones we haven't seen
+func (l *RateLimiter) prune(now time.Time) {
+	for key, bucket := range l.buckets {
+		class := key[:strings.IndexByte(key, ':')]
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rateFor(class) >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
+
+// Middleware returns middleware which rejects requests from clients which have exceeded their rate limit
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := endpointClass(r.URL.Path)
+		token := requestToken(r)
+		if class == "" || (token != "" && l.exempt[token]) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, wait := l.Allow(l.requestClient(r, token), class)
+		if !allowed {
+			w.Header().Set("Content-type", "application/json")
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write(jsonx.MustMarshal(NewErrorResponse(Errorf(ErrorCodeRateLimited, "rate limit exceeded for %s endpoints", class))))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// gets the class of the endpoint with the given path, e.g. contact for /mr/contact/search
+func endpointClass(path string) string {
+	if !strings.HasPrefix(path, "/mr/") {
+		return ""
+	}
+	class, _, _ := strings.Cut(path[len("/mr/"):], "/")
+	return class
+}
+
+// gets the auth token of a request
+func requestToken(r *http.Request) string {
+	return strings.TrimPrefix(r.Header.Get("Authorization"), "Token ")
+}
+
+// gets the identity of the client making a request. Only requests with our auth token can say which org they're for,
+// as otherwise callers could spread their requests across the buckets of many orgs.
+func (l *RateLimiter) requestClient(r *http.Request, token string) string {
+	if l.authToken == "" || token == l.authToken {
+		if orgID := requestOrgID(r); orgID != "" {
+			return "org:" + orgID
+		}
+		return "token"
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return "ip:" + host
+	}
+	return "ip:" + r.RemoteAddr
+}
+
+// gets the org ID of a request from its query or JSON body, leaving the body to be read again by the handler. Only the
+// start of the body is read so a large body can't be used to exhaust our memory before the handler can reject it.
+func requestOrgID(r *http.Request) string {
+	if orgID := r.URL.Query().Get("org_id"); orgID != "" {
+		return orgID
+	}
+	if r.Body == nil || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return ""
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, rateLimitMaxBodyPeek))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var payload struct {
+		OrgID json.Number `json:"org_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return ""
+	}
+	return string(payload.OrgID)
+}
@@ -0,0 +1,127 @@
+package web_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	defer dates.SetNowSource(dates.DefaultNowSource)
+
+	now := time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)
+	dates.SetNowSource(dates.NewFixedNowSource(now))
+
+	limiter := web.NewRateLimiter(2, 3, map[string]float64{"flow": 0.5, "msg": 0}, "sesame", nil)
+
+	// clients can make a burst of requests
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow("Token 123", "contact")
+		assert.True(t, allowed)
+	}
+
+	// after which they have to wait for their bucket to refill
+	allowed, wait := limiter.Allow("Token 123", "contact")
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other clients and classes of endpoint have their own buckets
+	allowed, _ = limiter.Allow("Token 234", "contact")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("Token 123", "ticket")
+	assert.True(t, allowed)
+
+	// classes can have their own rate
+	for i := 0; i < 3; i++ {
+		limiter.Allow("Token 123", "flow")
+	}
+	allowed, wait = limiter.Allow("Token 123", "flow")
+	assert.False(t, allowed)
+	assert.Equal(t, 2*time.Second, wait)
+
+	// or no limit at all
+	for i := 0; i < 10; i++ {
+		allowed, _ = limiter.Allow("Token 123", "msg")
+		assert.True(t, allowed)
+	}
+
+	// buckets refill over time
+	dates.SetNowSource(dates.NewFixedNowSource(now.Add(time.Second)))
+
+	allowed, _ = limiter.Allow("Token 123", "contact")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("Token 123", "contact")
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow("Token 123", "contact")
+	assert.False(t, allowed)
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	defer dates.SetNowSource(dates.DefaultNowSource)
+
+	dates.SetNowSource(dates.NewFixedNowSource(time.Date(2022, 10, 1, 12, 0, 0, 0, time.UTC)))
+
+	limiter := web.NewRateLimiter(0.25, 1, nil, "sesame", []string{"internal"})
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// handlers can still read the body
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	}))
+
+	serve := func(path, token, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			r.Header.Set("Authorization", "Token "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// authenticated clients with an org are limited by that org
+	w := serve("/mr/contact/search", "sesame", `{"org_id": 1, "query": "age > 10"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"org_id": 1, "query": "age > 10"}`, w.Body.String())
+
+	w = serve("/mr/contact/create", "sesame", `{"org_id": 1}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "4", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error": "rate limit exceeded for contact endpoints", "code": "request.rate_limited"}`, w.Body.String())
+
+	// which can also be given in the query, and other orgs have their own buckets
+	assert.Equal(t, http.StatusTooManyRequests, serve("/mr/contact/search?org_id=1", "sesame", ``).Code)
+	assert.Equal(t, http.StatusOK, serve("/mr/contact/search", "sesame", `{"org_id": 2}`).Code)
+
+	// authenticated clients without an org share a bucket for the token
+	assert.Equal(t, http.StatusOK, serve("/mr/contact/search", "sesame", `{}`).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/mr/contact/search", "sesame", `{}`).Code)
+
+	// clients with exempt tokens aren't limited
+	assert.Equal(t, http.StatusOK, serve("/mr/contact/search", "internal", `{"org_id": 1}`).Code)
+	assert.Equal(t, http.StatusOK, serve("/mr/contact/search", "internal", `{"org_id": 1}`).Code)
+
+	// and clients without a valid token are limited by their address, whatever org they claim
+	assert.Equal(t, http.StatusOK, serve("/mr/contact/search", "", `{"org_id": 3}`).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/mr/contact/search", "", `{"org_id": 4}`).Code)
+	assert.Equal(t, http.StatusTooManyRequests, serve("/mr/contact/search", "guess", `{"org_id": 5}`).Code)
+
+	// large bodies are only partly read by the limiter, and are still passed on whole
+	large := `{"org_id": 6, "text": "` + strings.Repeat("x", 100000) + `"}`
+	w = serve("/mr/msg/send", "sesame", large)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, large, w.Body.String())
+
+	// index pages aren't limited
+	assert.Equal(t, http.StatusOK, serve("/mr/", "", ``).Code)
+	assert.Equal(t, http.StatusOK, serve("/", "", ``).Code)
+}
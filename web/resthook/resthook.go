@@ -0,0 +1,148 @@
+package resthook
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+
+	"github.com/pkg/errors"
+)
+
+// number of recent deliveries we return for each subscriber
+const recentDeliveriesLimit = 10
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/resthook/subscribe", web.RequireAuthToken(handleSubscribe))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/resthook/unsubscribe", web.RequireAuthToken(handleUnsubscribe))
+	web.RegisterJSONRoute(http.MethodPost, "/mr/resthook/subscribers", web.RequireAuthToken(handleSubscribers))
+}
+
+// Request to subscribe a URL to a resthook, which is created if it doesn't exist.
+//
+//	{
+//	  "org_id": 1,
+//	  "user_id": 3,
+//	  "resthook": "new-registration",
+//	  "url": "https://hooks.example.com/catch/1234"
+//	}
+type subscribeRequest struct {
+	OrgID    models.OrgID  `json:"org_id"   validate:"required"`
+	UserID   models.UserID `json:"user_id"  validate:"required"`
+	Resthook string        `json:"resthook" validate:"required,max=50"`
+	URL      string        `json:"url"      validate:"required,url,max=200"`
+}
+
+// handles a request to subscribe to a resthook
+func handleSubscribe(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &subscribeRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	sub, err := models.SubscribeResthook(ctx, rt.DB, request.OrgID, request.UserID, request.Resthook, request.URL)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to subscribe to resthook")
+	}
+
+	return sub, http.StatusOK, nil
+}
+
+// Request to unsubscribe a URL from a resthook.
+//
+//	{
+//	  "org_id": 1,
+//	  "resthook": "new-registration",
+//	  "url": "https://hooks.example.com/catch/1234"
+//	}
+type unsubscribeRequest struct {
+	OrgID    models.OrgID `json:"org_id"   validate:"required"`
+	Resthook string       `json:"resthook" validate:"required"`
+	URL      string       `json:"url"      validate:"required"`
+}
+
+// handles a request to unsubscribe from a resthook
+func handleUnsubscribe(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &unsubscribeRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	unsub := &models.ResthookUnsubscribe{OrgID: request.OrgID, Slug: request.Resthook, URL: request.URL}
+	if err := models.UnsubscribeResthooks(ctx, rt.DB, []*models.ResthookUnsubscribe{unsub}); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return map[string]interface{}{}, http.StatusOK, nil
+}
+
+// Request for the subscribers of a resthook along with their recent deliveries.
+//
+//	{
+//	  "org_id": 1,
+//	  "resthook": "new-registration"
+//	}
+//
+//	{
+//	  "subscribers": [
+//	    {
+//	      "id": 12,
+//	      "resthook": "new-registration",
+//	      "url": "https://hooks.example.com/catch/1234",
+//	      "created_on": "2022-10-13T10:42:53.123456Z",
+//	      "deliveries": [
+//	        {"status_code": 200, "is_error": false, "elapsed_ms": 123, "retries": 0, "created_on": "2022-10-14T08:12:01.123456Z"}
+//	      ]
+//	    }
+//	  ]
+//	}
+type subscribersRequest struct {
+	OrgID    models.OrgID `json:"org_id"   validate:"required"`
+	Resthook string       `json:"resthook" validate:"required"`
+}
+
+type delivery struct {
+	StatusCode int       `json:"status_code"`
+	IsError    bool      `json:"is_error"`
+	ElapsedMS  int       `json:"elapsed_ms"`
+	Retries    int       `json:"retries"`
+	CreatedOn  time.Time `json:"created_on"`
+}
+
+type subscriber struct {
+	*models.ResthookSubscriber
+	Deliveries []*delivery `json:"deliveries"`
+}
+
+// handles a request for the subscribers of a resthook
+func handleSubscribers(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &subscribersRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	subs, err := models.LoadResthookSubscribers(ctx, rt.DB, request.OrgID, request.Resthook)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	subscribers := make([]*subscriber, len(subs))
+	for i, sub := range subs {
+		logs, err := models.LoadResthookDeliveryLogs(ctx, rt.DB, request.OrgID, sub.URL, recentDeliveriesLimit)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		deliveries := make([]*delivery, len(logs))
+		for j, l := range logs {
+			deliveries[j] = &delivery{StatusCode: l.StatusCode, IsError: l.IsError, ElapsedMS: l.RequestTime, Retries: l.NumRetries, CreatedOn: l.CreatedOn}
+		}
+
+		subscribers[i] = &subscriber{ResthookSubscriber: sub, Deliveries: deliveries}
+	}
+
+	return map[string]interface{}{"subscribers": subscribers}, http.StatusOK, nil
+}
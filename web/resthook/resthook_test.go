@@ -0,0 +1,16 @@
+package resthook_test
+
+import (
+	"testing"
+
+	"github.com/nyaruka/mailroom/testsuite"
+	"github.com/nyaruka/mailroom/web"
+)
+
+func TestResthooks(t *testing.T) {
+	ctx, rt, _, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData)
+
+	web.RunWebTests(t, ctx, rt, "testdata/resthooks.json", nil)
+}
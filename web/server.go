@@ -12,7 +12,8 @@ import (
 	"github.com/go-chi/chi/middleware"
 	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/mailroom/runtime"
-	"github.com/pkg/errors"
+	"github.com/nyaruka/mailroom/utils/bodies"
+	"github.com/nyaruka/mailroom/utils/logs"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,9 +23,6 @@ const (
 
 	// UserIDKey is our context key for user id
 	UserIDKey = "user_id"
-
-	// max body bytes we'll read from a incoming request
-	maxRequestBytes int64 = 1048576 * 50 // 50MB
 )
 
 type JSONHandler func(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error)
@@ -63,16 +61,26 @@ func NewServer(ctx context.Context, rt *runtime.Runtime, wg *sync.WaitGroup) *Se
 	//  set up our middlewares
 	router.Use(middleware.Compress(flate.DefaultCompression))
 	router.Use(middleware.RequestID)
+	router.Use(traceRequest)
 	router.Use(middleware.RealIP)
 	router.Use(panicRecovery)
 	router.Use(middleware.Timeout(60 * time.Second))
 	router.Use(requestLogger)
+	router.Use(limitBodies(rt.Config.WebMaxBodyBytes))
+
+	// rate limit clients if configured to
+	if rt.Config.WebRateLimit > 0 || rt.Config.WebRateLimits != "" {
+		classRates, _ := rt.Config.ParseWebRateLimits()
+		router.Use(NewRateLimiter(rt.Config.WebRateLimit, rt.Config.WebRateBurst, classRates, rt.Config.AuthToken, rt.Config.ParseWebRateExempt()).Middleware)
+	}
 
 	// wire up our main pages
 	router.NotFound(s.WrapJSONHandler(handle404))
 	router.MethodNotAllowed(s.WrapJSONHandler(handle405))
 	router.Get("/", s.WrapJSONHandler(handleIndex))
 	router.Get("/mr/", s.WrapJSONHandler(handleIndex))
+	router.Get("/mr/health", s.WrapJSONHandler(handleHealth))
+	router.Get("/mr/ready", s.WrapJSONHandler(handleReady))
 
 	// add any registered json routes
 	for _, route := range jsonRoutes {
@@ -102,14 +110,21 @@ func (s *Server) WrapJSONHandler(handler JSONHandler) http.HandlerFunc {
 
 		value, status, err := handler(r.Context(), s.rt, r)
 
+		// a body which was too large isn't an error of the handler, whether it returned it or gave it as the response
+		if asError, isError := value.(error); isError && bodies.IsTooLarge(asError) {
+			value, status, err = asError, http.StatusRequestEntityTooLarge, nil
+		} else if bodies.IsTooLarge(err) {
+			value, status, err = err, http.StatusRequestEntityTooLarge, nil
+		}
+
 		// handler errored (a hard error)
 		if err != nil {
-			value = NewErrorResponse(err)
+			value = newErrorResponseForStatus(err, http.StatusInternalServerError)
 		} else {
 			// handler returned an error to use as a the response
 			asError, isError := value.(error)
 			if isError {
-				value = NewErrorResponse(asError)
+				value = newErrorResponseForStatus(asError, status)
 			}
 		}
 
@@ -122,7 +137,7 @@ func (s *Server) WrapJSONHandler(handler JSONHandler) http.HandlerFunc {
 		}
 
 		if err != nil {
-			logrus.WithError(err).WithField("http_request", r).Error("error handling request")
+			logs.From(r.Context()).WithError(err).WithField("http_request", r).Error("error handling request")
 			w.WriteHeader(http.StatusInternalServerError)
 			w.Write(serialized)
 			return
@@ -141,9 +156,15 @@ func (s *Server) WrapHandler(handler Handler) http.HandlerFunc {
 			return
 		}
 
-		logrus.WithError(err).WithField("http_request", r).Error("error handling request")
+		if bodies.IsTooLarge(err) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write(jsonx.MustMarshal(newErrorResponseForStatus(err, http.StatusRequestEntityTooLarge)))
+			return
+		}
+
+		logs.From(r.Context()).WithError(err).WithField("http_request", r).Error("error handling request")
 		w.WriteHeader(http.StatusInternalServerError)
-		serialized := jsonx.MustMarshal(NewErrorResponse(err))
+		serialized := jsonx.MustMarshal(newErrorResponseForStatus(err, http.StatusInternalServerError))
 		w.Write(serialized)
 	}
 }
@@ -183,11 +204,11 @@ func handleIndex(ctx context.Context, rt *runtime.Runtime, r *http.Request) (int
 }
 
 func handle404(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
-	return errors.Errorf("not found: %s", r.URL.String()), http.StatusNotFound, nil
+	return Errorf(ErrorCodeNotFound, "not found: %s", r.URL.String()), http.StatusNotFound, nil
 }
 
 func handle405(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
-	return errors.Errorf("illegal method: %s", r.Method), http.StatusMethodNotAllowed, nil
+	return Errorf(ErrorCodeIllegalMethod, "illegal method: %s", r.Method), http.StatusMethodNotAllowed, nil
 }
 
 type Server struct {
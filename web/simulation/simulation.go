@@ -120,7 +120,7 @@ func handleSimulationEvents(ctx context.Context, db models.Queryer, oa *models.O
 func handleStart(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &startRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return nil, http.StatusBadRequest, errors.Wrapf(err, "request failed validation")
+		return nil, http.StatusBadRequest, web.WrapError(err, web.ErrorCodeInvalid, "request failed validation")
 	}
 
 	// grab our org assets
@@ -52,7 +52,7 @@ type submitResponse struct {
 func handleSubmit(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &submitRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return nil, http.StatusBadRequest, errors.Wrapf(err, "request failed validation")
+		return nil, http.StatusBadRequest, web.WrapError(err, web.ErrorCodeInvalid, "request failed validation")
 	}
 
 	// grab our org assets
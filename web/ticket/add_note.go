@@ -32,7 +32,7 @@ type addNoteRequest struct {
 func handleAddNote(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &addNoteRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org assets
@@ -51,5 +51,7 @@ func handleAddNote(ctx context.Context, rt *runtime.Runtime, r *http.Request) (i
 		return nil, http.StatusInternalServerError, errors.Wrap(err, "error adding notes to tickets")
 	}
 
+	models.PublishTicketEvents(ctx, rt, request.OrgID, evts)
+
 	return newBulkResponse(evts), http.StatusOK, nil
 }
@@ -33,7 +33,7 @@ type assignRequest struct {
 func handleAssign(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &assignRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org assets
@@ -52,5 +52,7 @@ func handleAssign(ctx context.Context, rt *runtime.Runtime, r *http.Request) (in
 		return nil, http.StatusInternalServerError, errors.Wrap(err, "error assigning tickets")
 	}
 
+	models.PublishTicketEvents(ctx, rt, request.OrgID, evts)
+
 	return newBulkResponse(evts), http.StatusOK, nil
 }
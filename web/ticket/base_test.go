@@ -74,3 +74,15 @@ func TestTicketReopen(t *testing.T) {
 
 	web.RunWebTests(t, ctx, rt, "testdata/reopen.json", nil)
 }
+
+func TestAgentHeartbeat(t *testing.T) {
+	ctx, rt, db, _ := testsuite.Get()
+
+	defer testsuite.Reset(testsuite.ResetData | testsuite.ResetRedis)
+
+	testdata.InsertOpenTicket(db, testdata.Org1, testdata.Cathy, testdata.Internal, testdata.DefaultTopic, "Have you seen my cookies?", "17", time.Now(), testdata.Agent)
+	testdata.InsertOpenTicket(db, testdata.Org1, testdata.Bob, testdata.Internal, testdata.DefaultTopic, "Have you seen my cookies?", "21", time.Now(), testdata.Agent)
+	testdata.InsertClosedTicket(db, testdata.Org1, testdata.Cathy, testdata.Internal, testdata.DefaultTopic, "Have you seen my cookies?", "34", testdata.Agent)
+
+	web.RunWebTests(t, ctx, rt, "testdata/agent_heartbeat.json", nil)
+}
@@ -31,7 +31,7 @@ type changeTopicRequest struct {
 func handleChangeTopic(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 	request := &changeTopicRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org assets
@@ -50,5 +50,7 @@ func handleChangeTopic(ctx context.Context, rt *runtime.Runtime, r *http.Request
 		return nil, http.StatusInternalServerError, errors.Wrap(err, "error changing topic of tickets")
 	}
 
+	models.PublishTicketEvents(ctx, rt, request.OrgID, evts)
+
 	return newBulkResponse(evts), http.StatusOK, nil
 }
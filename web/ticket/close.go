@@ -27,7 +27,7 @@ func init() {
 func handleClose(ctx context.Context, rt *runtime.Runtime, r *http.Request, l *models.HTTPLogger) (interface{}, int, error) {
 	request := &bulkTicketRequest{}
 	if err := web.ReadAndValidateJSON(r, request); err != nil {
-		return errors.Wrapf(err, "request failed validation"), http.StatusBadRequest, nil
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
 	}
 
 	// grab our org assets
@@ -56,5 +56,7 @@ func handleClose(ctx context.Context, rt *runtime.Runtime, r *http.Request, l *m
 		}
 	}
 
+	models.PublishTicketEvents(ctx, rt, request.OrgID, evts)
+
 	return newBulkResponse(evts), http.StatusOK, nil
 }
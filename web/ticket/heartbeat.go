@@ -0,0 +1,70 @@
+package ticket
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nyaruka/gocommon/dates"
+	"github.com/nyaruka/mailroom/core/models"
+	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/web"
+	"github.com/pkg/errors"
+)
+
+func init() {
+	web.RegisterJSONRoute(http.MethodPost, "/mr/ticket/agent_heartbeat", web.RequireAuthToken(handleAgentHeartbeat))
+}
+
+type agentHeartbeatRequest struct {
+	OrgID  models.OrgID       `json:"org_id"  validate:"required"`
+	UserID models.UserID      `json:"user_id" validate:"required"`
+	Status models.AgentStatus `json:"status"  validate:"omitempty,eq=online|eq=offline"`
+}
+
+type agentHeartbeatResponse struct {
+	Status      models.AgentStatus `json:"status"`
+	OpenTickets int                `json:"open_tickets"`
+}
+
+// Records that an agent is online, or has gone offline, so that new tickets are only routed to agents who are online.
+// Agents who don't send a heartbeat for 2 minutes are considered offline.
+//
+//	{
+//	  "org_id": 123,
+//	  "user_id": 234,
+//	  "status": "online"
+//	}
+func handleAgentHeartbeat(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
+	request := &agentHeartbeatRequest{}
+	if err := web.ReadAndValidateJSON(r, request); err != nil {
+		return web.WrapError(err, web.ErrorCodeInvalid, "request failed validation"), http.StatusBadRequest, nil
+	}
+
+	status := request.Status
+	if status == "" {
+		status = models.AgentStatusOnline
+	}
+
+	oa, err := models.GetOrgAssets(ctx, rt, request.OrgID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errors.Wrapf(err, "unable to load org assets")
+	}
+	if oa.UserByID(request.UserID) == nil {
+		return web.Errorf(web.ErrorCodeNotFound, "no user with id %d in org", request.UserID), http.StatusNotFound, nil
+	}
+
+	// refresh the agent's open ticket count which is otherwise only incremented as tickets are routed to them
+	openTickets, err := models.CountAgentOpenTickets(ctx, rt.DB, request.OrgID, request.UserID)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	rc := rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.RecordAgentHeartbeat(rc, request.OrgID, request.UserID, status, openTickets, dates.Now()); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	return &agentHeartbeatResponse{Status: status, OpenTickets: openTickets}, http.StatusOK, nil
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/nyaruka/gocommon/jsonx"
 	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/runtime"
 
@@ -17,7 +18,7 @@ func RequireUserToken(handler JSONHandler) JSONHandler {
 	return func(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
 		token := r.Header.Get("authorization")
 		if !strings.HasPrefix(token, "Token ") {
-			return errors.New("missing authorization header"), http.StatusUnauthorized, nil
+			return Errorf(ErrorCodeUnauthorized, "missing authorization header"), http.StatusUnauthorized, nil
 		}
 
 		// pull out the actual token
@@ -41,12 +42,12 @@ func RequireUserToken(handler JSONHandler) JSONHandler {
 			u.is_active = TRUE
 		`, token)
 		if err != nil {
-			return errors.Wrapf(err, "error looking up authorization header"), http.StatusUnauthorized, nil
+			return WrapError(err, ErrorCodeUnauthorized, "error looking up authorization header"), http.StatusUnauthorized, nil
 		}
 		defer rows.Close()
 
 		if !rows.Next() {
-			return errors.Errorf("invalid authorization header"), http.StatusUnauthorized, nil
+			return Errorf(ErrorCodeUnauthorized, "invalid authorization header"), http.StatusUnauthorized, nil
 		}
 
 		var userID int64
@@ -66,9 +67,8 @@ func RequireUserToken(handler JSONHandler) JSONHandler {
 // RequireAuthToken wraps a handler to require that our request to have our global authorization header
 func RequireAuthToken(handler JSONHandler) JSONHandler {
 	return func(ctx context.Context, rt *runtime.Runtime, r *http.Request) (interface{}, int, error) {
-		auth := r.Header.Get("authorization")
-		if rt.Config.AuthToken != "" && fmt.Sprintf("Token %s", rt.Config.AuthToken) != auth {
-			return fmt.Errorf("invalid or missing authorization header, denying"), http.StatusUnauthorized, nil
+		if err := checkAuthToken(rt, r); err != nil {
+			return err, http.StatusUnauthorized, nil
 		}
 
 		// we are authenticated, call our chain
@@ -76,6 +76,36 @@ func RequireAuthToken(handler JSONHandler) JSONHandler {
 	}
 }
 
+// RequireAuthTokenHandler is the equivalent of RequireAuthToken for handlers which write their own responses
+func RequireAuthTokenHandler(handler Handler) Handler {
+	return func(ctx context.Context, rt *runtime.Runtime, r *http.Request, w http.ResponseWriter) error {
+		if err := checkAuthToken(rt, r); err != nil {
+			w.Header().Set("Content-type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write(jsonx.MustMarshal(NewErrorResponse(err)))
+			return nil
+		}
+
+		return handler(ctx, rt, r, w)
+	}
+}
+
+func checkAuthToken(rt *runtime.Runtime, r *http.Request) error {
+	auth := r.Header.Get("authorization")
+	if rt.Config.AuthToken == "" || fmt.Sprintf("Token %s", rt.Config.AuthToken) == auth {
+		return nil
+	}
+
+	// internal clients which aren't rate limited authenticate with their own tokens
+	for _, token := range rt.Config.ParseWebRateExempt() {
+		if fmt.Sprintf("Token %s", token) == auth {
+			return nil
+		}
+	}
+
+	return Errorf(ErrorCodeUnauthorized, "invalid or missing authorization header, denying")
+}
+
 // LoggingJSONHandler is a JSON web handler which logs HTTP logs
 type LoggingJSONHandler func(ctx context.Context, rt *runtime.Runtime, r *http.Request, l *models.HTTPLogger) (interface{}, int, error)
 
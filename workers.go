@@ -6,9 +6,14 @@ import (
 	"sync"
 	"time"
 
+	"github.com/nyaruka/mailroom/core/models"
 	"github.com/nyaruka/mailroom/core/queue"
 	"github.com/nyaruka/mailroom/runtime"
+	"github.com/nyaruka/mailroom/utils/logs"
+	"github.com/nyaruka/mailroom/utils/profile"
+	"github.com/nyaruka/mailroom/utils/trace"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -159,14 +164,24 @@ func (w *Worker) Stop() {
 }
 
 func (w *Worker) handleTask(task *queue.Task) {
-	log := logrus.WithField("queue", w.foreman.queue).WithField("worker_id", w.id).WithField("task_type", task.Type).WithField("org_id", task.OrgID)
+	// tasks carry the trace ID of whatever queued them, otherwise they start their own
+	traceID := task.TraceID
+	if traceID == trace.NilID {
+		traceID = trace.NewID()
+	}
+
+	// everything logged while performing this task carries its trace ID, type and org
+	ctx := trace.WithID(context.Background(), traceID)
+	ctx = logs.With(ctx, "task_type", task.Type)
+	ctx = logs.With(ctx, "org_id", task.OrgID)
+
+	log := logs.From(ctx).WithField("queue", w.foreman.queue).WithField("worker_id", w.id)
+	start := time.Now()
 
 	defer func() {
-		// catch any panics and recover
-		panicLog := recover()
-		if panicLog != nil {
-			debug.PrintStack()
-			log.WithField("task", string(task.Task)).WithField("task_type", task.Type).WithField("org_id", task.OrgID).Errorf("panic handling task: %s", panicLog)
+		// catch any panics, recover and record an incident for them
+		if panicValue := recover(); panicValue != nil {
+			w.recordPanic(log, task, traceID, panicValue, debug.Stack(), start)
 		}
 
 		// mark our task as complete
@@ -178,14 +193,30 @@ func (w *Worker) handleTask(task *queue.Task) {
 		rc.Close()
 	}()
 
+	if w.forwardToRegion(log, task) {
+		return
+	}
+
 	log.Info("starting handling of task")
-	start := time.Now()
 
 	taskFunc, found := taskFunctions[task.Type]
 	if found {
-		err := taskFunc(context.Background(), w.foreman.rt, task)
+		run := func() {
+			err := taskFunc(ctx, w.foreman.rt, task)
+			if err != nil {
+				log.WithError(err).WithField("task", string(task.Task)).Error("error running task")
+			}
+		}
+
+		// if a profile has been requested for this task type, capture it while running the task
+		kind, err := profile.Claim(w.foreman.rt.RP, task.Type)
 		if err != nil {
-			log.WithError(err).WithField("task", string(task.Task)).Error("error running task")
+			log.WithError(err).Error("error checking for profile request")
+		}
+		if kind != "" {
+			w.runWithProfile(log, task, kind, run)
+		} else {
+			run()
 		}
 	} else {
 		log.Error("unable to find function for task type")
@@ -200,3 +231,115 @@ func (w *Worker) handleTask(task *queue.Task) {
 		log.WithField("task", string(task.Task)).WithField("elapsed", elapsed).Warn("long running task")
 	}
 }
+
+// records an incident for a task which panicked and logs it, which also reports it to Sentry if that's configured
+func (w *Worker) recordPanic(log *logrus.Entry, task *queue.Task, traceID trace.ID, panicValue interface{}, stack []byte, start time.Time) {
+	incident := models.NewTaskIncident(models.OrgID(task.OrgID), w.foreman.queue, task.Type, task.Task, panicValue, stack, traceID, start, time.Since(start))
+
+	rc := w.foreman.rt.RP.Get()
+	defer rc.Close()
+
+	if err := models.RecordTaskIncident(rc, incident); err != nil {
+		log.WithError(err).Error("error recording task incident")
+	}
+
+	log.WithField("task", string(incident.Task)).WithField("incident_uuid", incident.UUID).WithField("stack", incident.Stack).Errorf("panic handling task: %s", incident.Panic)
+}
+
+// forwards the given task to the queue of the region its org is pinned to if that isn't our region, returning whether
+// the task is done with here. Tasks which can't be forwarded, including those for orgs pinned to regions we don't know
+// about, are requeued locally to be tried again rather than being handled in the wrong region.
+func (w *Worker) forwardToRegion(log *logrus.Entry, task *queue.Task) bool {
+	rt := w.foreman.rt
+	if rt.Config.Region == "" || task.OrgID == 0 {
+		return false
+	}
+
+	oa, err := models.GetOrgAssets(context.Background(), rt, models.OrgID(task.OrgID))
+	if err != nil {
+		log.WithError(err).Error("error loading org to check its region")
+		return false
+	}
+
+	region := oa.Org().Region()
+	if region == "" || region == rt.Config.Region {
+		return false
+	}
+
+	log = log.WithField("region", region)
+
+	if err := w.forwardTask(region, task); err != nil {
+		log = log.WithError(err).WithField("task", string(task.Task))
+
+		// retry later with backoff in case region is only briefly unreachable, but don't keep trying forever
+		task.ErrorCount++
+		if task.ErrorCount >= maxForwardAttempts {
+			log.WithField("error_count", task.ErrorCount).Error("error forwarding task to region, dropping")
+			return true
+		}
+
+		log.WithField("error_count", task.ErrorCount).Warn("error forwarding task to region, retrying later")
+
+		rc := rt.RP.Get()
+		defer rc.Close()
+
+		if err := queue.RequeueDelayedTask(rc, w.foreman.queue, task, forwardRetryDelay(task.ErrorCount)); err != nil {
+			log.WithError(err).Error("error requeuing task")
+		}
+	} else {
+		log.Info("forwarded task to region")
+	}
+	return true
+}
+
+// how many times we try to forward a task to its org's region before giving up on it
+const maxForwardAttempts = 5
+
+// returns how long to wait before retrying to forward a task which has failed to be forwarded the given number of times,
+// i.e. 15s, 30s, 1m, 2m...
+func forwardRetryDelay(errorCount int) time.Duration {
+	return time.Second * 15 << (errorCount - 1)
+}
+
+// forwards the given task, and any state it depends on, to the given region
+func (w *Worker) forwardTask(region string, task *queue.Task) error {
+	rt := w.foreman.rt
+
+	rp := rt.RegionPools[region]
+	if rp == nil {
+		return errors.Errorf("no Redis configured for region '%s'", region)
+	}
+
+	rc := rp.Get()
+	defer rc.Close()
+
+	if taskForwarder := taskForwarders[task.Type]; taskForwarder != nil {
+		if err := taskForwarder(context.Background(), rt, task, rc); err != nil {
+			return errors.Wrapf(err, "error forwarding state of %s task", task.Type)
+		}
+	}
+
+	return queue.ForwardTask(rc, w.foreman.queue, task)
+}
+
+// runs the given task function while capturing a profile of the given kind, which is then saved to session storage
+func (w *Worker) runWithProfile(log *logrus.Entry, task *queue.Task, kind profile.Kind, run func()) {
+	start := time.Now()
+
+	data, err := profile.Capture(kind, run)
+	if err != nil {
+		log.WithError(err).Error("error capturing profile")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	url, err := w.foreman.rt.SessionStorage.Put(ctx, profile.Path(task.Type, kind, start), "application/octet-stream", data)
+	if err != nil {
+		log.WithError(err).Error("error saving profile")
+		return
+	}
+
+	log.WithField("profile_kind", kind).WithField("profile_url", url).Info("captured task profile")
+}